@@ -7,6 +7,7 @@ package cli
 
 import (
 	"github.com/sylabs/singularity/internal/pkg/plugin"
+	"github.com/sylabs/singularity/internal/pkg/remoteexec"
 	"github.com/sylabs/singularity/pkg/cmdline"
 )
 
@@ -14,6 +15,7 @@ import (
 var (
 	AppName           string
 	BindPaths         []string
+	Mounts            []string
 	HomePath          string
 	OverlayPath       []string
 	ScratchPath       []string
@@ -23,7 +25,11 @@ var (
 	Hostname          string
 	Network           string
 	NetworkArgs       []string
+	Publish           []string
 	DNS               string
+	DNSSearch         string
+	ResolvConfPath    string
+	AddHosts          []string
 	Security          []string
 	CgroupsPath       string
 	VMRAM             string
@@ -31,7 +37,16 @@ var (
 	VMIP              string
 	ContainLibsPath   []string
 	encryptionPEMPath string
+	encryptionKeyfile string
+	encryptionPKCS11  string
 	FuseMount         []string
+	RemoteExecHost    string
+	RemoteExecDir     string
+	RemoteExecBin     string
+	MPI               string
+	NvidiaDevices     string
+	JoinTarget        string
+	JoinNamespaces    string
 
 	IsBoot          bool
 	IsFakeroot      bool
@@ -40,10 +55,15 @@ var (
 	IsContainAll    bool
 	IsWritable      bool
 	IsWritableTmpfs bool
+	IsRootfsInRAM   bool
 	Nvidia          bool
 	NoHome          bool
+	NoHostnameFile  bool
 	NoInit          bool
+	Init            bool
 	NoNvidia        bool
+	Rocm            bool
+	NoRocm          bool
 	VM              bool
 	VMErr           bool
 	NoNet           bool
@@ -62,6 +82,10 @@ var (
 	NoPrivs   bool
 	AddCaps   string
 	DropCaps  string
+
+	TestIsolated bool
+	TestTimeout  int
+	TestJSON     bool
 )
 
 // --app
@@ -82,12 +106,24 @@ var actionBindFlag = cmdline.Flag{
 	DefaultValue: []string{},
 	Name:         "bind",
 	ShortHand:    "B",
-	Usage:        "a user-bind path specification.  spec has the format src[:dest[:opts]], where src and dest are outside and inside paths.  If dest is not given, it is set equal to src.  Mount options ('opts') may be specified as 'ro' (read-only) or 'rw' (read/write, which is the default). Multiple bind paths can be given by a comma separated list.",
+	Usage:        "a user-bind path specification.  spec has the format src[:dest[:opts]], where src and dest are outside and inside paths.  If dest is not given, it is set equal to src.  Mount options ('opts') may be specified as 'ro' (read-only) or 'rw' (read/write, which is the default), 'z' or 'Z' relabel src for SELinux, shared between containers or private to the container, several options are separated by colons. Multiple bind paths can be given by a comma separated list.",
 	EnvKeys:      []string{"BIND", "BINDPATH"},
 	Tag:          "<spec>",
 	EnvHandler:   cmdline.EnvAppendValue,
 }
 
+// --mount
+var actionMountFlag = cmdline.Flag{
+	ID:           "actionMountFlag",
+	Value:        &Mounts,
+	DefaultValue: []string{},
+	Name:         "mount",
+	Usage:        "a mount specification.  spec is a comma separated list of key=value options: type=bind|image|tmpfs (bind is the default), source|src, destination|dst|target, ro, bind-propagation=[r]private|[r]shared|[r]slave for bind mounts, id=<partition descriptor ID> to select the SIF partition of image mounts, tmpfs-size and tmpfs-mode for tmpfs mounts.  The flag may be repeated to request several mounts.",
+	EnvKeys:      []string{"MOUNT"},
+	Tag:          "<spec>",
+	StringArray:  true,
+}
+
 // -H|--home
 var actionHomeFlag = cmdline.Flag{
 	ID:           "actionHomeFlag",
@@ -186,6 +222,29 @@ var actionHostnameFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --no-hostname-file
+var actionNoHostnameFileFlag = cmdline.Flag{
+	ID:           "actionNoHostnameFileFlag",
+	Value:        &NoHostnameFile,
+	DefaultValue: false,
+	Name:         "no-hostname-file",
+	Usage:        "set the container hostname without writing it to /etc/hostname",
+	EnvKeys:      []string{"NO_HOSTNAME_FILE"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --add-host
+var actionAddHostFlag = cmdline.Flag{
+	ID:           "actionAddHostFlag",
+	Value:        &AddHosts,
+	DefaultValue: []string{},
+	Name:         "add-host",
+	Usage:        "add a host entry with the form name:ip to the container /etc/hosts",
+	EnvKeys:      []string{"ADD_HOST"},
+	Tag:          "<name:ip>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --network
 var actionNetworkFlag = cmdline.Flag{
 	ID:           "actionNetworkFlag",
@@ -210,6 +269,18 @@ var actionNetworkArgsFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --publish
+var actionPublishFlag = cmdline.Flag{
+	ID:           "actionPublishFlag",
+	Value:        &Publish,
+	DefaultValue: []string{},
+	Name:         "publish",
+	Usage:        "publish a host port to the container with the form hostPort[:containerPort][/protocol] (requires --net)",
+	EnvKeys:      []string{"PUBLISH"},
+	Tag:          "<port>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --dns
 var actionDNSFlag = cmdline.Flag{
 	ID:           "actionDnsFlag",
@@ -221,13 +292,36 @@ var actionDNSFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --dns-search
+var actionDNSSearchFlag = cmdline.Flag{
+	ID:           "actionDNSSearchFlag",
+	Value:        &DNSSearch,
+	DefaultValue: "",
+	Name:         "dns-search",
+	Usage:        "list of DNS search domains separated by commas to set in resolv.conf",
+	EnvKeys:      []string{"DNS_SEARCH"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --resolv-conf
+var actionResolvConfFlag = cmdline.Flag{
+	ID:           "actionResolvConfFlag",
+	Value:        &ResolvConfPath,
+	DefaultValue: "",
+	Name:         "resolv-conf",
+	Usage:        "use the given file as container resolv.conf instead of the host one, --dns and --dns-search apply on top of it",
+	EnvKeys:      []string{"RESOLV_CONF"},
+	Tag:          "<path>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --security
 var actionSecurityFlag = cmdline.Flag{
 	ID:           "actionSecurityFlag",
 	Value:        &Security,
 	DefaultValue: []string{},
 	Name:         "security",
-	Usage:        "enable security features (SELinux, Apparmor, Seccomp)",
+	Usage:        "enable security features (SELinux, Apparmor, Seccomp), selinux:container applies the default container SELinux context with a unique MCS level",
 	EnvKeys:      []string{"SECURITY"},
 	ExcludedOS:   []string{cmdline.Darwin},
 }
@@ -315,6 +409,25 @@ var actionPEMPathFlag = cmdline.Flag{
 	Usage:        "Enter an path to a PEM formated RSA key for an encrypted container",
 }
 
+// --keyfile
+var actionKeyfileFlag = cmdline.Flag{
+	ID:           "actionEncryptionKeyfile",
+	Value:        &encryptionKeyfile,
+	DefaultValue: "",
+	Name:         "keyfile",
+	Usage:        "Enter a path to a keyfile used as passphrase for an encrypted container",
+}
+
+// --pkcs11-uri
+var actionPKCS11URIFlag = cmdline.Flag{
+	ID:           "actionEncryptionPKCS11URI",
+	Value:        &encryptionPKCS11,
+	DefaultValue: "",
+	Name:         "pkcs11-uri",
+	Usage:        "Enter a PKCS#11 URI of a token RSA private key decrypting an encrypted container (requires pkcs11-tool)",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --fusemount, hidden for now while experimental
 var actionFuseMountFlag = cmdline.Flag{
 	ID:           "actionFuseMountFlag",
@@ -430,6 +543,39 @@ var actionNvidiaFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --rocm
+var actionRocmFlag = cmdline.Flag{
+	ID:           "actionRocmFlag",
+	Value:        &Rocm,
+	DefaultValue: false,
+	Name:         "rocm",
+	Usage:        "enable experimental ROCm support",
+	EnvKeys:      []string{"ROCM"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --nv-device
+var actionNvidiaDevicesFlag = cmdline.Flag{
+	ID:           "actionNvidiaDevicesFlag",
+	Value:        &NvidiaDevices,
+	DefaultValue: "",
+	Name:         "nv-device",
+	Usage:        "comma separated list of NVIDIA GPUs or MIG devices exposed with --nv by index, UUID or GPU:MIG indexes (default: all)",
+	EnvKeys:      []string{"NV_DEVICE"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --mpi
+var actionMPIFlag = cmdline.Flag{
+	ID:           "actionMPIFlag",
+	Value:        &MPI,
+	DefaultValue: "",
+	Name:         "mpi",
+	Usage:        "wire host MPI/PMI support for ranks launched by srun or mpirun (pmix, pmi2 or hybrid)",
+	EnvKeys:      []string{"MPI"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // -w|--writable
 var actionWritableFlag = cmdline.Flag{
 	ID:           "actionWritableFlag",
@@ -453,6 +599,17 @@ var actionWritableTmpfsFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --rootfs-in-ram
+var actionRootfsInRAMFlag = cmdline.Flag{
+	ID:           "actionRootfsInRAMFlag",
+	Value:        &IsRootfsInRAM,
+	DefaultValue: false,
+	Name:         "rootfs-in-ram",
+	Usage:        "copy the container root filesystem in memory at startup, the image is not accessed during execution",
+	EnvKeys:      []string{"ROOTFS_IN_RAM"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --no-home
 var actionNoHomeFlag = cmdline.Flag{
 	ID:           "actionNoHomeFlag",
@@ -475,6 +632,17 @@ var actionNoInitFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --init
+var actionInitFlag = cmdline.Flag{
+	ID:           "actionInitFlag",
+	Value:        &Init,
+	DefaultValue: false,
+	Name:         "init",
+	Usage:        "run a minimal init process reaping zombies and forwarding signals to the container process",
+	EnvKeys:      []string{"INIT"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --nohttps
 var actionNoHTTPSFlag = cmdline.Flag{
 	ID:           "actionNoHTTPSFlag",
@@ -505,6 +673,16 @@ var actionNoNvidiaFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// hidden flag to disable ROCm bindings when 'always use rocm = yes'
+var actionNoRocmFlag = cmdline.Flag{
+	ID:           "actionNoRocmFlag",
+	Value:        &NoRocm,
+	DefaultValue: false,
+	Name:         "no-rocm",
+	EnvKeys:      []string{"ROCM_OFF", "NO_ROCM"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // --vm
 var actionVMFlag = cmdline.Flag{
 	ID:           "actionVMFlag",
@@ -525,6 +703,39 @@ var actionVMErrFlag = cmdline.Flag{
 	EnvKeys:      []string{"VMERROR"},
 }
 
+// --remote-exec
+var actionRemoteExecFlag = cmdline.Flag{
+	ID:           "actionRemoteExecFlag",
+	Value:        &RemoteExecHost,
+	DefaultValue: "",
+	Name:         "remote-exec",
+	Usage:        "run the container on a Linux host over SSH ([user@]host)",
+	EnvKeys:      []string{"REMOTE_EXEC"},
+	ExcludedOS:   []string{cmdline.Linux},
+}
+
+// --remote-exec-dir
+var actionRemoteExecDirFlag = cmdline.Flag{
+	ID:           "actionRemoteExecDirFlag",
+	Value:        &RemoteExecDir,
+	DefaultValue: remoteexec.DefaultDir,
+	Name:         "remote-exec-dir",
+	Usage:        "directory where local images are synced on the remote host",
+	EnvKeys:      []string{"REMOTE_EXEC_DIR"},
+	ExcludedOS:   []string{cmdline.Linux},
+}
+
+// --remote-exec-bin
+var actionRemoteExecBinFlag = cmdline.Flag{
+	ID:           "actionRemoteExecBinFlag",
+	Value:        &RemoteExecBin,
+	DefaultValue: remoteexec.DefaultBinary,
+	Name:         "remote-exec-bin",
+	Usage:        "path of the singularity binary on the remote host",
+	EnvKeys:      []string{"REMOTE_EXEC_BIN"},
+	ExcludedOS:   []string{cmdline.Linux},
+}
+
 // --syos
 // TODO: Keep this in production?
 var actionSyOSFlag = cmdline.Flag{
@@ -583,6 +794,29 @@ var actionUtsNamespaceFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --join
+var actionJoinFlag = cmdline.Flag{
+	ID:           "actionJoinFlag",
+	Value:        &JoinTarget,
+	DefaultValue: "",
+	Name:         "join",
+	Usage:        "join the namespaces selected with --join-ns of a running instance, or of a process designated with pid://<pid>",
+	EnvKeys:      []string{"JOIN"},
+	Tag:          "<instance|pid://<pid>>",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --join-ns
+var actionJoinNamespacesFlag = cmdline.Flag{
+	ID:           "actionJoinNamespacesFlag",
+	Value:        &JoinNamespaces,
+	DefaultValue: "net,ipc,uts,pid",
+	Name:         "join-ns",
+	Usage:        "comma separated list of namespaces joined with --join among net, ipc, uts, mount and pid",
+	EnvKeys:      []string{"JOIN_NS"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 // -u|--userns
 var actionUserNamespaceFlag = cmdline.Flag{
 	ID:           "actionUserNamespaceFlag",
@@ -650,6 +884,39 @@ var actionAllowSetuidFlag = cmdline.Flag{
 	ExcludedOS:   []string{cmdline.Darwin},
 }
 
+// --isolated
+var testIsolatedFlag = cmdline.Flag{
+	ID:           "testIsolatedFlag",
+	Value:        &TestIsolated,
+	DefaultValue: false,
+	Name:         "isolated",
+	Usage:        "run the test in new PID, IPC and network namespaces with only a loopback interface",
+	EnvKeys:      []string{"TEST_ISOLATED"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --timeout
+var testTimeoutFlag = cmdline.Flag{
+	ID:           "testTimeoutFlag",
+	Value:        &TestTimeout,
+	DefaultValue: 0,
+	Name:         "timeout",
+	Usage:        "terminate the test if it doesn't complete within the given number of seconds, the exit code is then 124",
+	Tag:          "<seconds>",
+	EnvKeys:      []string{"TEST_TIMEOUT"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// --json
+var testJSONFlag = cmdline.Flag{
+	ID:           "testJSONFlag",
+	Value:        &TestJSON,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print the test exit code, duration and output as JSON",
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
 func init() {
 	initializePlugins()
 
@@ -673,15 +940,21 @@ func init() {
 
 	cmdManager.RegisterFlagForCmd(&actionAppFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionBindFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionMountFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionHomeFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionOverlayFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionScratchFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionWorkdirFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionShellFlag, ShellCmd)
 	cmdManager.RegisterFlagForCmd(&actionHostnameFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionNoHostnameFileFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionAddHostFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNetworkFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNetworkArgsFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionPublishFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionDNSFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionDNSSearchFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionResolvConfFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionSecurityFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionVMRAMFlag, actionsCmd...)
@@ -699,20 +972,31 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&actionContainFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionContainAllFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNvidiaFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionMPIFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionNvidiaDevicesFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionWritableFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionWritableTmpfsFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionRootfsInRAMFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNoHomeFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNoInitFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionInitFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNoHTTPSFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionDockerLoginFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNoNvidiaFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionRocmFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionNoRocmFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionVMFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionVMErrFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionSyOSFlag, ShellCmd)
+	cmdManager.RegisterFlagForCmd(&actionRemoteExecFlag, actionsCmd...)
+	cmdManager.RegisterFlagForCmd(&actionRemoteExecDirFlag, actionsCmd...)
+	cmdManager.RegisterFlagForCmd(&actionRemoteExecBinFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionPidNamespaceFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionIpcNamespaceFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNetNamespaceFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionUtsNamespaceFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionJoinFlag, actionsCmd...)
+	cmdManager.RegisterFlagForCmd(&actionJoinNamespacesFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionUserNamespaceFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionKeepPrivsFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionNoPrivsFlag, actionsInstanceCmd...)
@@ -722,6 +1006,12 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&actionPwdFlag, actionsCmd...)
 	cmdManager.RegisterFlagForCmd(&actionPassphraseFlag, actionsInstanceCmd...)
 	cmdManager.RegisterFlagForCmd(&actionPEMPathFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionKeyfileFlag, actionsInstanceCmd...)
+	cmdManager.RegisterFlagForCmd(&actionPKCS11URIFlag, actionsInstanceCmd...)
+
+	cmdManager.RegisterFlagForCmd(&testIsolatedFlag, TestCmd)
+	cmdManager.RegisterFlagForCmd(&testTimeoutFlag, TestCmd)
+	cmdManager.RegisterFlagForCmd(&testJSONFlag, TestCmd)
 
 	for _, cmd := range actionsCmd {
 		plugin.AddFlagHooks(cmd.Flags())
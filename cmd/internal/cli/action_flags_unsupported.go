@@ -0,0 +1,25 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux,!darwin
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// instanceStartCmd fake command to satisfy actions command
+// group flag registration
+var instanceStartCmd *cobra.Command
+
+// initPlatformDefaults customizes the default values for the flags
+// to make them appropriate for the build target
+func initPlatformDefaults() {
+	// there is no runtime nor hypervisor support on this platform,
+	// hide the virtual machine flags
+	actionVMFlag.Hidden = true
+	actionSyOSFlag.Hidden = true
+}
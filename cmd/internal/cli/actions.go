@@ -28,6 +28,7 @@ import (
 	"github.com/sylabs/singularity/pkg/build/types"
 	net "github.com/sylabs/singularity/pkg/client/net"
 	shub "github.com/sylabs/singularity/pkg/client/shub"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 const (
@@ -48,6 +49,11 @@ func getCacheHandle(cfg cache.Config) *cache.Handle {
 
 // actionPreRun will run replaceURIWithImage and will also do the proper path unsetting
 func actionPreRun(cmd *cobra.Command, args []string) {
+	// images are resolved by the remote host
+	if RemoteExecHost != "" {
+		return
+	}
+
 	// backup user PATH
 	userPath := strings.Join([]string{os.Getenv("PATH"), defaultPath}, ":")
 
@@ -157,7 +163,7 @@ func handleOras(imgCache *cache.Handle, cmd *cobra.Command, u string) (string, e
 	}
 
 	_, ref := uri.Split(u)
-	sum, err := oras.ImageSHA(ref, ociAuth)
+	sum, err := oras.ImageSHA(ref, ociAuth, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to get SHA of %v: %v", u, err)
 	}
@@ -169,7 +175,7 @@ func handleOras(imgCache *cache.Handle, cmd *cobra.Command, u string) (string, e
 	} else if !exists {
 		sylog.Infof("Downloading image with ORAS")
 
-		if err := oras.DownloadImage(cacheImagePath, ref, ociAuth); err != nil {
+		if err := oras.DownloadImage(cacheImagePath, ref, ociAuth, &oras.Options{Progress: &oras.ProgressBar{}}); err != nil {
 			return "", fmt.Errorf("unable to Download Image: %v", err)
 		}
 
@@ -198,7 +204,7 @@ func handleLibrary(imgCache *cache.Handle, u, libraryURL string) (string, error)
 
 	libraryImage, err := c.GetImage(ctx, runtime.GOARCH, imageRef)
 	if err == library.ErrNotFound {
-		return "", fmt.Errorf("image does not exist in the library: %s (%s)", imageRef, runtime.GOARCH)
+		return "", errcode.New(errcode.ImageNotFound, "image does not exist in the library: %s (%s)", imageRef, runtime.GOARCH)
 	}
 	if err != nil {
 		return "", err
@@ -341,7 +347,7 @@ func replaceURIWithImage(imgCache *cache.Handle, cmd *cobra.Command, args []stri
 	}
 
 	if err != nil {
-		sylog.Fatalf("Unable to handle %s uri: %v", args[0], err)
+		errcode.Fatal(errcode.Wrap(errcode.Unknown, err, "Unable to handle %s uri", args[0]))
 	}
 
 	args[0] = image
@@ -398,6 +404,10 @@ var ExecCmd = &cobra.Command{
 	PreRun:                actionPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		a := append([]string{"/.singularity.d/actions/exec"}, args[1:]...)
+		if RemoteExecHost != "" {
+			execRemote(cmd, args)
+			return
+		}
 		setVM(cmd)
 		if VM {
 			execVM(cmd, args[0], a)
@@ -420,6 +430,10 @@ var ShellCmd = &cobra.Command{
 	PreRun:                actionPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		a := []string{"/.singularity.d/actions/shell"}
+		if RemoteExecHost != "" {
+			execRemote(cmd, args)
+			return
+		}
 		setVM(cmd)
 		if VM {
 			execVM(cmd, args[0], a)
@@ -442,6 +456,10 @@ var RunCmd = &cobra.Command{
 	PreRun:                actionPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		a := append([]string{"/.singularity.d/actions/run"}, args[1:]...)
+		if RemoteExecHost != "" {
+			execRemote(cmd, args)
+			return
+		}
 		setVM(cmd)
 		if VM {
 			execVM(cmd, args[0], a)
@@ -464,6 +482,19 @@ var TestCmd = &cobra.Command{
 	PreRun:                actionPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		a := append([]string{"/.singularity.d/actions/test"}, args[1:]...)
+		if TestTimeout < 0 {
+			sylog.Fatalf("--timeout requires a positive number of seconds")
+		}
+		if TestIsolated {
+			PidNamespace = true
+			IpcNamespace = true
+			NetNamespace = true
+			Network = "none"
+		}
+		if RemoteExecHost != "" {
+			execRemote(cmd, args)
+			return
+		}
 		setVM(cmd)
 		if VM {
 			execVM(cmd, args[0], a)
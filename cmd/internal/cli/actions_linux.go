@@ -11,30 +11,38 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/sylabs/singularity/internal/pkg/plugin"
+	"github.com/sylabs/singularity/pkg/execagent"
 	imgutil "github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/image/unpacker"
+	"github.com/sylabs/singularity/pkg/network"
+	"github.com/sylabs/singularity/pkg/util/bind"
 	"github.com/sylabs/singularity/pkg/util/crypt"
+	"github.com/sylabs/singularity/pkg/util/errcode"
+	"github.com/sylabs/singularity/pkg/util/mpi"
 	"github.com/sylabs/singularity/pkg/util/namespaces"
 	"github.com/sylabs/singularity/pkg/util/nvidia"
+	"github.com/sylabs/singularity/pkg/util/rocm"
 
 	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/app/singularity"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
-	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/runtime/launch"
 	"github.com/sylabs/singularity/internal/pkg/security"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
 	"github.com/sylabs/singularity/internal/pkg/util/exec"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
@@ -96,6 +104,41 @@ func convertImage(filename string, unsquashfsPath string) (string, error) {
 	return dir, err
 }
 
+// joinPidPrefix designates a process joined by its PID with --join.
+const joinPidPrefix = "pid://"
+
+// parseJoinTarget returns the process ID designated by target with the
+// pid:// prefix or the name of the instance designated by target,
+// optionally prefixed by instance://.
+func parseJoinTarget(target string) (int, string, error) {
+	if strings.HasPrefix(target, joinPidPrefix) {
+		pid, err := strconv.Atoi(strings.TrimPrefix(target, joinPidPrefix))
+		if err != nil || pid <= 1 {
+			return 0, "", fmt.Errorf("bad process ID in %s", target)
+		}
+		return pid, "", nil
+	}
+	name := instance.ExtractName(target)
+	if err := instance.CheckName(name); err != nil {
+		return 0, "", err
+	}
+	return 0, name, nil
+}
+
+// joinTarget returns the process ID of the instance or process
+// designated by target and the instance name.
+func joinTarget(target string) (int, string, error) {
+	pid, name, err := parseJoinTarget(target)
+	if err != nil || name == "" {
+		return pid, name, err
+	}
+	file, err := instance.Get(name, instance.SingSubDir)
+	if err != nil {
+		return 0, "", err
+	}
+	return file.Pid, name, nil
+}
+
 // TODO: Let's stick this in another file so that that CLI is just CLI
 func execStarter(cobraCmd *cobra.Command, image string, args []string, name string) {
 	targetUID := 0
@@ -123,20 +166,15 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 
 	syscall.Umask(0022)
 
-	engineConfig := singularityConfig.NewConfig()
+	launchConfig := launch.NewConfig(&singularityConfig.FileConfig{}, args)
+	engineConfig := launchConfig.Engine
+	generator := launchConfig.Generator
 
 	configurationFile := buildcfg.SINGULARITY_CONF_FILE
 	if err := config.Parser(configurationFile, engineConfig.File); err != nil {
-		sylog.Fatalf("Unable to parse singularity.conf file: %s", err)
+		errcode.Fatal(errcode.Wrap(errcode.Unknown, err, "Unable to parse singularity.conf file"))
 	}
 
-	ociConfig := &oci.Config{}
-	generator := generate.Generator{Config: &ociConfig.Spec}
-
-	engineConfig.OciConfig = ociConfig
-
-	generator.SetProcessArgs(args)
-
 	uidParam := security.GetParam(Security, "uid")
 	gidParam := security.GetParam(Security, "gid")
 
@@ -175,21 +213,15 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		instanceName := instance.ExtractName(image)
 		file, err := instance.Get(instanceName, instance.SingSubDir)
 		if err != nil {
-			sylog.Fatalf("%s", err)
+			errcode.Fatal(err)
 		}
 		UserNamespace = file.UserNs
 		generator.AddProcessEnv("SINGULARITY_CONTAINER", file.Image)
 		generator.AddProcessEnv("SINGULARITY_NAME", filepath.Base(file.Image))
 		engineConfig.SetImage(image)
 		engineConfig.SetInstanceJoin(true)
-	} else {
-		abspath, err := filepath.Abs(image)
-		generator.AddProcessEnv("SINGULARITY_CONTAINER", abspath)
-		generator.AddProcessEnv("SINGULARITY_NAME", filepath.Base(abspath))
-		if err != nil {
-			sylog.Fatalf("Failed to determine image absolute path for %s: %s", image, err)
-		}
-		engineConfig.SetImage(abspath)
+	} else if err := launchConfig.SetImage(image); err != nil {
+		sylog.Fatalf("%s", err)
 	}
 
 	starter := filepath.Join(buildcfg.LIBEXECDIR, "singularity/bin/starter-suid")
@@ -224,31 +256,105 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Verbosef("binding nvidia files into container")
 		}
 
-		libs, bins, err := nvidia.Paths(buildcfg.NVIDIALIBS_FILE, userPath)
-		if err != nil {
+		driver, err := nvidia.Discover(buildcfg.NVIDIALIBS_FILE, userPath, NvidiaDevices)
+		if err != nil && NvidiaDevices != "" {
+			// don't expose all the GPUs when a selection was requested
+			sylog.Fatalf("While selecting NVIDIA devices: %v", err)
+		} else if err != nil {
 			sylog.Warningf("Unable to capture NVIDIA bind points: %v", err)
 		} else {
-			if len(bins) == 0 {
+			if driver.Version != "" {
+				sylog.Verbosef("Using NVIDIA driver version %s", driver.Version)
+			}
+			if len(driver.Binaries) == 0 {
 				sylog.Infof("Could not find any NVIDIA binaries on this host!")
 			} else {
 				if IsWritable {
 					sylog.Warningf("NVIDIA binaries may not be bound with --writable")
 				}
-				for _, binary := range bins {
+				for _, binary := range driver.Binaries {
 					usrBinBinary := filepath.Join("/usr/bin", filepath.Base(binary))
 					bind := strings.Join([]string{binary, usrBinBinary}, ":")
 					BindPaths = append(BindPaths, bind)
 				}
 			}
-			if len(libs) == 0 {
+			if len(driver.Libraries) == 0 {
 				sylog.Warningf("Could not find any NVIDIA libraries on this host!")
 				sylog.Warningf("You may need to edit %v/nvliblist.conf", buildcfg.SINGULARITY_CONFDIR)
+			} else {
+				ContainLibsPath = append(ContainLibsPath, driver.Libraries...)
+			}
+			// bind persistenced and MPS sockets if found
+			BindPaths = append(BindPaths, driver.IPCs...)
+
+			if NvidiaDevices != "" {
+				if len(driver.Devices) == 0 {
+					sylog.Fatalf("No NVIDIA device found for selection %s", NvidiaDevices)
+				}
+				if !IsContained && !IsContainAll && engineConfig.File.MountDev != "minimal" {
+					sylog.Warningf("--nv-device only restricts the GPUs of a contained /dev, use --contain")
+				}
+				engineConfig.SetNvDevices(driver.Devices)
+			}
+		}
+	}
+
+	if !NoRocm && (Rocm || engineConfig.File.AlwaysUseRocm) {
+		userPath := os.Getenv("USER_PATH")
+
+		if engineConfig.File.AlwaysUseRocm {
+			sylog.Verbosef("'always use rocm = yes' found in singularity.conf")
+			sylog.Verbosef("binding ROCm files into container")
+		}
+
+		// devices are added by the runtime engine, only request them
+		// if they are present to not abort the container creation
+		if _, err := rocm.Devices(); err != nil {
+			sylog.Warningf("Unable to find ROCm devices: %v", err)
+		} else {
+			engineConfig.SetRocm(true)
+		}
+
+		libs, bins, err := rocm.Paths(buildcfg.ROCMLIBS_FILE, userPath)
+		if err != nil {
+			sylog.Warningf("Unable to capture ROCm bind points: %v", err)
+		} else {
+			if len(bins) == 0 {
+				sylog.Infof("Could not find any ROCm binaries on this host!")
+			} else {
+				if IsWritable {
+					sylog.Warningf("ROCm binaries may not be bound with --writable")
+				}
+				for _, binary := range bins {
+					usrBinBinary := filepath.Join("/usr/bin", filepath.Base(binary))
+					bind := strings.Join([]string{binary, usrBinBinary}, ":")
+					BindPaths = append(BindPaths, bind)
+				}
+			}
+			if len(libs) == 0 {
+				sylog.Warningf("Could not find any ROCm libraries on this host!")
+				sylog.Warningf("You may need to edit %v/rocmliblist.conf", buildcfg.SINGULARITY_CONFDIR)
 			} else {
 				ContainLibsPath = append(ContainLibsPath, libs...)
 			}
 		}
-		// bind persistenced socket if found
-		BindPaths = append(BindPaths, nvidia.IpcsPath(userPath)...)
+	}
+
+	if MPI != "" {
+		paths, err := mpi.Setup(MPI, os.Environ(), os.Getenv("USER_PATH"))
+		if err != nil {
+			sylog.Fatalf("While setting up MPI support: %s", err)
+		}
+		if len(paths.Libraries) == 0 {
+			sylog.Warningf("Could not find any %s libraries on this host", MPI)
+		}
+		BindPaths = append(BindPaths, paths.Binds...)
+		ContainLibsPath = append(ContainLibsPath, paths.Libraries...)
+		for _, e := range paths.Env {
+			kv := strings.SplitN(e, "=", 2)
+			generator.AddProcessEnv(kv[0], kv[1])
+		}
+		engineConfig.SetMPIABI(paths.ABI)
 	}
 
 	// early check for key material before we start engine so we can fail fast if missing
@@ -257,7 +363,7 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		sylog.Debugf("Checking for encrypted system partition")
 		img, err := imgutil.Init(engineConfig.GetImage(), false)
 		if err != nil {
-			sylog.Fatalf("could not open image %s: %s", engineConfig.GetImage(), err)
+			errcode.Fatal(errcode.Wrap(errcode.Unknown, err, "could not open image %s", engineConfig.GetImage()))
 		}
 		defer img.File.Close()
 
@@ -265,25 +371,60 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Fatalf("no root filesystem found in %s", engineConfig.GetImage())
 		}
 
-		// ensure we have decryption material
-		if img.Partitions[0].Type == imgutil.ENCRYPTSQUASHFS {
+		encrypted := img.Partitions[0].Type == imgutil.ENCRYPTSQUASHFS
+		if encrypted {
 			sylog.Debugf("Encrypted container filesystem detected")
+		}
+
+		// encrypted overlays use the same encryption material,
+		// blank overlay images are formatted as encrypted overlay
+		for _, overlay := range OverlayPath {
+			splitted := strings.SplitN(overlay, ":", 2)
+			writable := len(splitted) == 1 || splitted[1] != "ro"
+			if ov, err := imgutil.Init(splitted[0], writable); err == nil {
+				ov.File.Close()
+				if ov.Type == imgutil.LUKS {
+					sylog.Debugf("Encrypted overlay %s detected", splitted[0])
+					encrypted = true
+				}
+			}
+		}
+
+		// ensure we have decryption material
+		if encrypted {
 
 			keyInfo, err := getEncryptionMaterial(cobraCmd)
 			if err != nil {
 				sylog.Fatalf("While handling encryption material: %v", err)
 			}
 
-			plaintextKey, err := crypt.PlaintextKey(keyInfo, engineConfig.GetImage())
-			if err != nil {
-				sylog.Fatalf("Cannot retrieve key from image %s: %+v", engineConfig.GetImage(), err)
+			if keyInfo.Format == crypt.Passphrase {
+				engineConfig.SetEncryptionKey([]byte(keyInfo.Material))
+			} else {
+				// the key is retrieved by the RPC server which
+				// negotiates the key material type with the image
+				engineConfig.SetEncryptionKeyInfo(&keyInfo)
 			}
-
-			engineConfig.SetEncryptionKey(plaintextKey)
 		}
 	}
 
 	engineConfig.SetBindPath(BindPaths)
+	if len(Mounts) > 0 {
+		mounts := make([]bind.Mount, 0, len(Mounts))
+		for _, spec := range Mounts {
+			m, err := bind.ParseMountString(spec)
+			if err != nil {
+				sylog.Fatalf("Invalid --mount specification: %s", err)
+			}
+			if m.Source != "" {
+				if m.Source, err = filepath.Abs(m.Source); err != nil {
+					sylog.Fatalf("Failed to determine absolute path for %s: %s", m.Source, err)
+				}
+			}
+			mounts = append(mounts, m)
+		}
+		engineConfig.SetMounts(mounts)
+	}
 	if FuseMount != nil {
 		/* If --fusemount is given, imply --pid */
 		PidNamespace = true
@@ -291,6 +432,21 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	}
 	engineConfig.SetNetwork(Network)
 	engineConfig.SetDNS(DNS)
+	engineConfig.SetDNSSearch(DNSSearch)
+	if ResolvConfPath != "" {
+		content, err := ioutil.ReadFile(ResolvConfPath)
+		if err != nil {
+			sylog.Fatalf("Could not read resolv.conf template: %s", err)
+		}
+		engineConfig.SetResolvConf(string(content))
+	}
+	for _, h := range AddHosts {
+		if _, _, err := files.ParseHost(h); err != nil {
+			sylog.Fatalf("Invalid --add-host value: %s", err)
+		}
+	}
+	engineConfig.SetAddHosts(AddHosts)
+	engineConfig.SetNoHostnameFile(NoHostnameFile)
 	engineConfig.SetNetworkArgs(NetworkArgs)
 	engineConfig.SetOverlayImage(OverlayPath)
 	engineConfig.SetWritableImage(IsWritable)
@@ -328,6 +484,12 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		engineConfig.SetWritableTmpfs(IsWritableTmpfs)
 	}
 
+	if IsWritable && IsRootfsInRAM {
+		sylog.Warningf("Disabling --rootfs-in-ram flag, mutually exclusive with --writable")
+	} else {
+		engineConfig.SetRootfsInRAM(IsRootfsInRAM)
+	}
+
 	homeFlag := cobraCmd.Flag("home")
 	engineConfig.SetCustomHome(homeFlag.Changed)
 
@@ -375,17 +537,8 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	engineConfig.SetScratchDir(ScratchPath)
 	engineConfig.SetWorkdir(WorkdirPath)
 
-	homeSlice := strings.Split(HomePath, ":")
-
-	if len(homeSlice) > 2 || len(homeSlice) == 0 {
-		sylog.Fatalf("home argument has incorrect number of elements: %v", len(homeSlice))
-	}
-
-	engineConfig.SetHomeSource(homeSlice[0])
-	if len(homeSlice) == 1 {
-		engineConfig.SetHomeDest(homeSlice[0])
-	} else {
-		engineConfig.SetHomeDest(homeSlice[1])
+	if err := launchConfig.SetHome(HomePath); err != nil {
+		sylog.Fatalf("%s", err)
 	}
 
 	if IsFakeroot {
@@ -399,11 +552,46 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		engineConfig.SetInstance(true)
 		engineConfig.SetBootInstance(IsBoot)
 
+		if instanceStartRestore != "" {
+			if !isPrivileged {
+				sylog.Fatalf("Only root user can restore instances")
+			}
+			dir, err := filepath.Abs(instanceStartRestore)
+			if err != nil {
+				sylog.Fatalf("Could not determine checkpoint directory: %s", err)
+			}
+			engineConfig.SetRestoreDir(dir)
+		}
+
 		_, err := instance.Get(name, instance.SingSubDir)
 		if err == nil {
 			sylog.Fatalf("instance %s already exists", name)
 		}
 
+		engineConfig.SetNoHealthcheck(instanceStartNoHealthcheck)
+		engineConfig.SetExecAgent(instanceStartExecAgent)
+		action, err := instance.ParseHealthAction(instanceStartHealthOnFailure)
+		if err != nil {
+			sylog.Fatalf("Invalid --health-on-failure value: %s", err)
+		}
+		if action != nil {
+			engineConfig.SetHealthOnFailure(instanceStartHealthOnFailure)
+			if action.Restart {
+				engineConfig.SetStartCommand(os.Args, env.CommandEnv(os.Environ()))
+			}
+		}
+
+		if instanceStartLogFormat != "" {
+			if _, ok := instance.LogFormats[instanceStartLogFormat]; !ok {
+				sylog.Fatalf("Unknown log format %s, must be json, kubernetes or basic", instanceStartLogFormat)
+			}
+			if instanceStartLogMaxSize < 0 || instanceStartLogMaxFiles < 1 {
+				sylog.Fatalf("Log rotation requires a positive size and at least one rotated file")
+			}
+			engineConfig.SetLogFormat(instanceStartLogFormat)
+			engineConfig.SetLogRotation(int64(instanceStartLogMaxSize)<<20, instanceStartLogMaxFiles)
+		}
+
 		if IsBoot {
 			UtsNamespace = true
 			NetNamespace = true
@@ -428,6 +616,50 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		procname = "Singularity runtime parent"
 	}
 
+	if len(Publish) > 0 {
+		if !NetNamespace {
+			sylog.Fatalf("--publish requires --net")
+		}
+		for _, p := range Publish {
+			if _, err := network.ParsePortMap(p); err != nil {
+				sylog.Fatalf("Invalid --publish value %s: %s", p, err)
+			}
+		}
+		engineConfig.SetPublish(Publish)
+	}
+
+	if JoinTarget != "" {
+		if name != "" || engineConfig.GetInstanceJoin() {
+			sylog.Fatalf("--join can't be used with instances")
+		}
+		pid, instanceName, err := joinTarget(JoinTarget)
+		if err != nil {
+			sylog.Fatalf("Could not join %s: %s", JoinTarget, err)
+		}
+		joined := strings.Split(JoinNamespaces, ",")
+		for _, ns := range joined {
+			conflict := false
+			switch ns {
+			case "net":
+				conflict = NetNamespace
+			case "ipc":
+				conflict = IpcNamespace
+			case "uts":
+				conflict = UtsNamespace
+			case "pid":
+				conflict = PidNamespace
+			case "mount":
+				conflict = IsBoot
+			default:
+				sylog.Fatalf("Unknown namespace %s to join, must be net, ipc, uts, mount or pid", ns)
+			}
+			if conflict {
+				sylog.Fatalf("A new %s namespace can't be requested when joining it", ns)
+			}
+		}
+		engineConfig.SetJoin(pid, instanceName, joined)
+	}
+
 	if NetNamespace {
 		if IsFakeroot && Network != "none" {
 			engineConfig.SetNetwork("fakeroot")
@@ -443,17 +675,15 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 				engineConfig.SetNetwork("none")
 			}
 		}
-		generator.AddOrReplaceLinuxNamespace("network", "")
-	}
-	if UtsNamespace {
-		generator.AddOrReplaceLinuxNamespace("uts", "")
 	}
 	if PidNamespace {
-		generator.AddOrReplaceLinuxNamespace("pid", "")
 		engineConfig.SetNoInit(NoInit)
 	}
-	if IpcNamespace {
-		generator.AddOrReplaceLinuxNamespace("ipc", "")
+	if Init {
+		if NoInit {
+			sylog.Fatalf("--init and --no-init are mutually exclusive")
+		}
+		engineConfig.SetInit(true)
 	}
 	if !UserNamespace {
 		if _, err := os.Stat(starter); os.IsNotExist(err) {
@@ -462,39 +692,37 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		}
 	}
 
-	if UserNamespace {
-		generator.AddOrReplaceLinuxNamespace("user", "")
-
-		if !IsFakeroot {
-			generator.AddLinuxUIDMapping(uid, uid, 1)
-			generator.AddLinuxGIDMapping(gid, gid, 1)
-		}
+	ns := launch.Namespaces{
+		User: UserNamespace,
+		PID:  PidNamespace,
+		IPC:  IpcNamespace,
+		Net:  NetNamespace,
+		UTS:  UtsNamespace,
 	}
-
-	// Copy and cache environment
-	environment := os.Environ()
+	launchConfig.AddNamespaces(ns, uid, gid, !IsFakeroot)
 
 	// Clean environment
-	env.SetContainerEnv(&generator, environment, IsCleanEnv, engineConfig.GetHomeDest())
+	launchConfig.SetEnv(os.Environ(), IsCleanEnv)
+
+	// GPU selection of the ROCm runtime is kept with a clean environment
+	if !NoRocm && (Rocm || engineConfig.File.AlwaysUseRocm) && IsCleanEnv {
+		for _, key := range rocm.VisibleDevicesEnv {
+			if value, ok := os.LookupEnv(key); ok {
+				generator.AddProcessEnv(key, value)
+			}
+		}
+	}
 
 	// force to use getwd syscall
 	os.Unsetenv("PWD")
 
 	if pwd, err := os.Getwd(); err == nil {
-		if PwdPath != "" {
-			generator.SetProcessCwd(PwdPath)
-		} else {
-			if engineConfig.GetContain() {
-				generator.SetProcessCwd(engineConfig.GetHomeDest())
-			} else {
-				generator.SetProcessCwd(pwd)
-			}
-		}
+		launchConfig.SetCwd(PwdPath, pwd)
 	} else {
 		sylog.Warningf("can't determine current working directory: %s", err)
 	}
 
-	Env := []string{sylog.GetEnvVar()}
+	Env := []string{sylog.GetEnvVar(), errcode.GetEnvVar()}
 
 	generator.AddProcessEnv("SINGULARITY_APPNAME", AppName)
 
@@ -584,9 +812,91 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Verbosef("you will find instance error here: %s", stderr.Name())
 			sylog.Infof("instance started successfully")
 		}
+	} else if cobraCmd.Name() == "test" && (TestTimeout > 0 || TestJSON) {
+		runTestStarter(starter, procname, image, Env, configData)
 	} else {
+		if cobraCmd.Name() == "exec" && engineConfig.GetInstanceJoin() {
+			execInstanceAgent(image, args, generator.Config.Process.Env, generator.Config.Process.Cwd)
+		}
 		if err := exec.Pipe(starter, []string{procname}, Env, configData); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	}
 }
+
+// execInstanceAgent executes args in the instance designated by image with
+// the instance exec agent and exits with the process exit code, it returns
+// if the instance doesn't serve an exec agent or if the agent failed to
+// start the process. The process environment env is the environment the
+// starter would pass to the container process.
+func execInstanceAgent(image string, args, env []string, cwd string) {
+	file, err := instance.Get(instance.ExtractName(image), instance.SingSubDir)
+	if err != nil || file.ExecAgentSocket == "" {
+		return
+	}
+
+	req := &execagent.Request{
+		Args: args,
+		Env:  env,
+		Cwd:  cwd,
+	}
+
+	// signals received before the process is started are
+	// forwarded once it is
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	p, err := execagent.Start(file.ExecAgentSocket, req, []*os.File{os.Stdin, os.Stdout, os.Stderr})
+	if err != nil {
+		signal.Reset()
+		sylog.Debugf("Instance exec agent not used: %s", err)
+		return
+	}
+	sylog.Debugf("Process %d started by the instance exec agent", p.Pid)
+
+	go func() {
+		for s := range signals {
+			p.Signal(s.(syscall.Signal))
+		}
+	}()
+
+	status, err := p.Wait()
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if status.Signaled() {
+		os.Exit(128 + int(status.Signal()))
+	}
+	os.Exit(status.ExitStatus())
+}
+
+// runTestStarter runs the starter as a child process to enforce the
+// test timeout and report the test result, the command exits with the
+// test exit code.
+func runTestStarter(starter, procname, image string, env []string, configData []byte) {
+	cmd, err := exec.PipeCommand(starter, []string{procname}, env, configData)
+	if err != nil {
+		sylog.Fatalf("failed to prepare command: %s", err)
+	}
+
+	opts := singularity.TestOptions{
+		Timeout: time.Duration(TestTimeout) * time.Second,
+		Capture: TestJSON,
+	}
+	result, err := singularity.RunTest(cmd, image, opts)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	if TestJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(result); err != nil {
+			sylog.Fatalf("could not encode test result: %s", err)
+		}
+	} else if result.TimedOut {
+		sylog.Errorf("Test didn't complete within %d seconds", TestTimeout)
+	}
+
+	os.Exit(result.ExitCode)
+}
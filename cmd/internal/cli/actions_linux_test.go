@@ -0,0 +1,46 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"testing"
+)
+
+func TestParseJoinTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		pid      int
+		instance string
+		wantErr  bool
+	}{
+		{name: "Pid", target: "pid://1234", pid: 1234},
+		{name: "BadPid", target: "pid://abc", wantErr: true},
+		{name: "InitPid", target: "pid://1", wantErr: true},
+		{name: "Instance", target: "my_instance", instance: "my_instance"},
+		{name: "InstanceURI", target: "instance://my_instance", instance: "my_instance"},
+		// a numeric name designates an instance, not a process
+		{name: "NumericInstance", target: "1234", instance: "1234"},
+		{name: "BadInstance", target: "instance://bad/name", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pid, instance, err := parseJoinTarget(tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success for %s", tt.target)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error for %s: %s", tt.target, err)
+			}
+			if pid != tt.pid || instance != tt.instance {
+				t.Errorf("got pid %d and instance %q, expected pid %d and instance %q", pid, instance, tt.pid, tt.instance)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/sylabs/singularity/internal/pkg/remoteexec"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// localOnlyFlags lists flags which only make sense for the local
+// client and are not forwarded to the remote host.
+var localOnlyFlags = map[string]bool{
+	"remote-exec":     true,
+	"remote-exec-dir": true,
+	"remote-exec-bin": true,
+	"vm":              true,
+	"vm-err":          true,
+	"vm-ram":          true,
+	"vm-cpu":          true,
+	"vm-ip":           true,
+	"syos":            true,
+}
+
+// localPathFlags lists flags taking paths of the local host, they can't
+// be forwarded as the remote host would resolve them on its own filesystem.
+var localPathFlags = map[string]bool{
+	"bind":          true,
+	"mount":         true,
+	"home":          true,
+	"overlay":       true,
+	"workdir":       true,
+	"tmpdir":        true,
+	"resolv-conf":   true,
+	"apply-cgroups": true,
+	"containlibs":   true,
+	"fusemount":     true,
+	"pem-path":      true,
+	"keyfile":       true,
+}
+
+// forwardFlags returns the command line arguments corresponding to
+// the flags set in fs, flags taking local paths are rejected.
+func forwardFlags(fs *pflag.FlagSet) ([]string, error) {
+	var args []string
+	var err error
+
+	fs.Visit(func(f *pflag.Flag) {
+		if localOnlyFlags[f.Name] || err != nil {
+			return
+		}
+		if localPathFlags[f.Name] {
+			err = fmt.Errorf("--%s takes local paths and is not supported with --remote-exec, the paths would be resolved on the remote host", f.Name)
+			return
+		}
+		value := f.Value.String()
+		if strings.HasSuffix(f.Value.Type(), "Slice") {
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, value))
+	})
+
+	return args, err
+}
+
+// execRemote runs the action command on the remote host set with
+// --remote-exec, local images are synced to the remote host first.
+func execRemote(cmd *cobra.Command, args []string) {
+	host, err := remoteexec.NewHost(RemoteExecHost)
+	if err != nil {
+		sylog.Fatalf("While configuring remote execution: %s", err)
+	}
+	host.Dir = RemoteExecDir
+	host.Binary = RemoteExecBin
+	host.TTY = cmd.Name() == "shell" || terminal.IsTerminal(int(os.Stdin.Fd()))
+
+	globalArgs, err := forwardFlags(cmd.InheritedFlags())
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	actionArgs, err := forwardFlags(cmd.LocalFlags())
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	image := args[0]
+	if remoteexec.IsLocalImage(image) {
+		sylog.Infof("Syncing %s to %s", image, host.Host)
+		image, err = host.Sync(image)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	}
+
+	remoteArgs := append(globalArgs, cmd.Name())
+	remoteArgs = append(remoteArgs, actionArgs...)
+	remoteArgs = append(remoteArgs, image)
+	remoteArgs = append(remoteArgs, args[1:]...)
+
+	err = host.Command(remoteArgs).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			os.Exit(status.ExitStatus())
+		}
+	}
+	if err != nil {
+		sylog.Fatalf("Remote execution on %s failed: %s", host.Host, err)
+	}
+}
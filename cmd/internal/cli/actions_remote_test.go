@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestForwardFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "Forwarded",
+			args:     []string{"--cleanenv", "--env=A=1,B=2", "--pwd=/data"},
+			expected: []string{"--cleanenv=true", "--env=A=1,B=2", "--pwd=/data"},
+		},
+		{
+			name:     "LocalOnly",
+			args:     []string{"--remote-exec=user@host", "--cleanenv"},
+			expected: []string{"--cleanenv=true"},
+		},
+		{
+			name:    "Bind",
+			args:    []string{"--cleanenv", "-B", "/data:/mnt"},
+			wantErr: true,
+		},
+		{
+			name:    "Home",
+			args:    []string{"--home=/home/user"},
+			wantErr: true,
+		},
+		{
+			name:    "Overlay",
+			args:    []string{"--overlay=overlay.img"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.Bool("cleanenv", false, "")
+			fs.String("pwd", "", "")
+			fs.StringSlice("env", nil, "")
+			fs.String("remote-exec", "", "")
+			fs.StringSliceP("bind", "B", nil, "")
+			fs.String("home", "", "")
+			fs.StringSlice("overlay", nil, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			args, err := forwardFlags(fs)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success with %v", tt.args)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if strings.Join(args, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("got %v, expected %v", args, tt.expected)
+			}
+		})
+	}
+}
@@ -9,9 +9,10 @@ package cli
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
 )
 
 // TODO: Let's stick this in another file so that that CLI is just CLI
 func execStarter(cobraCmd *cobra.Command, image string, args []string, name string) {
-	panic("starter is unsupported on this platform")
+	sylog.Fatalf("%s requires the Linux runtime which is not available on this platform, use a Linux host, WSL2 or --remote-exec instead", cobraCmd.CommandPath())
 }
@@ -43,7 +43,14 @@ var (
 	dockerLogin    bool
 	noCleanUp      bool
 	fakeroot       bool
+	ignoreSubuid   bool
 	encrypt        bool
+	buildVerity    bool
+	buildContext   string
+	mksquashfsArgs string
+	noBuildCache   bool
+	testIsolated   bool
+	testTimeout    int
 )
 
 // -s|--sandbox
@@ -110,6 +117,27 @@ var buildNoTestFlag = cmdline.Flag{
 	EnvKeys:      []string{"NOTEST"},
 }
 
+// --test-isolated
+var buildTestIsolatedFlag = cmdline.Flag{
+	ID:           "buildTestIsolatedFlag",
+	Value:        &testIsolated,
+	DefaultValue: false,
+	Name:         "test-isolated",
+	Usage:        "run the %test section like the test command with --contain and --isolated, in new PID, network and IPC namespaces",
+	EnvKeys:      []string{"BUILD_TEST_ISOLATED"},
+}
+
+// --test-timeout
+var buildTestTimeoutFlag = cmdline.Flag{
+	ID:           "buildTestTimeoutFlag",
+	Value:        &testTimeout,
+	DefaultValue: 0,
+	Name:         "test-timeout",
+	Usage:        "fail the build if the %test section doesn't complete within the given number of seconds",
+	Tag:          "<seconds>",
+	EnvKeys:      []string{"BUILD_TEST_TIMEOUT"},
+}
+
 // -r|--remote
 var buildRemoteFlag = cmdline.Flag{
 	ID:           "buildRemoteFlag",
@@ -172,6 +200,16 @@ var buildTmpdirFlag = cmdline.Flag{
 	EnvKeys:      []string{"TMPDIR"},
 }
 
+// --build-context
+var buildContextFlag = cmdline.Flag{
+	ID:           "buildContextFlag",
+	Value:        &buildContext,
+	DefaultValue: "",
+	Name:         "build-context",
+	Usage:        "read %files sources from a build context directory or archive uploaded by a remote build client",
+	EnvKeys:      []string{"BUILD_CONTEXT"},
+}
+
 // --disable-cache
 var buildDisableCacheFlag = cmdline.Flag{
 	ID:           "buildDisableCacheFlag",
@@ -182,6 +220,16 @@ var buildDisableCacheFlag = cmdline.Flag{
 	EnvKeys:      []string{"DISABLE_CACHE"},
 }
 
+// --no-cache
+var buildNoCacheFlag = cmdline.Flag{
+	ID:           "buildNoCacheFlag",
+	Value:        &noBuildCache,
+	DefaultValue: false,
+	Name:         "no-cache",
+	Usage:        "run every build stage instead of reusing unchanged stages from the build cache",
+	EnvKeys:      []string{"NO_CACHE"},
+}
+
 // --nohttps
 var buildNoHTTPSFlag = cmdline.Flag{
 	ID:           "buildNoHTTPSFlag",
@@ -213,6 +261,16 @@ var buildFakerootFlag = cmdline.Flag{
 	EnvKeys:      []string{"FAKEROOT"},
 }
 
+// --ignore-subuid
+var buildIgnoreSubuidFlag = cmdline.Flag{
+	ID:           "buildIgnoreSubuidFlag",
+	Value:        &ignoreSubuid,
+	DefaultValue: false,
+	Name:         "ignore-subuid",
+	Usage:        "with --fakeroot, map only your user to root and emulate ownership changes instead of using /etc/subuid and /etc/subgid ranges",
+	EnvKeys:      []string{"IGNORE_SUBUID"},
+}
+
 // -e|--encrypt
 var buildEncryptFlag = cmdline.Flag{
 	ID:           "buildEncryptFlag",
@@ -223,6 +281,27 @@ var buildEncryptFlag = cmdline.Flag{
 	Usage:        "build an image with an encrypted file system",
 }
 
+// --verity
+var buildVerityFlag = cmdline.Flag{
+	ID:           "buildVerityFlag",
+	Value:        &buildVerity,
+	DefaultValue: false,
+	Name:         "verity",
+	Usage:        "add a dm-verity hash tree of the root file system to a SIF image",
+	EnvKeys:      []string{"VERITY"},
+}
+
+// --mksquashfs-args
+var buildMksquashfsArgsFlag = cmdline.Flag{
+	ID:           "buildMksquashfsArgsFlag",
+	Value:        &mksquashfsArgs,
+	DefaultValue: "",
+	Name:         "mksquashfs-args",
+	Usage:        "additional options passed to mksquashfs when building a SIF image (eg: \"-comp xz -b 1M\"), they override the compression, block size and processors configured in singularity.conf",
+	Tag:          "<args>",
+	EnvKeys:      []string{"MKSQUASHFS_ARGS"},
+}
+
 func init() {
 	cmdManager.RegisterCmd(BuildCmd)
 
@@ -234,15 +313,22 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&buildNoCleanupFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildNoHTTPSFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildNoTestFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildTestIsolatedFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildTestTimeoutFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildRemoteFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildArchFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildSandboxFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildSectionFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildTmpdirFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildContextFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildDisableCacheFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildNoCacheFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildUpdateFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildFakerootFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildIgnoreSubuidFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&buildEncryptFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildVerityFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&buildMksquashfsArgsFlag, BuildCmd)
 
 	cmdManager.RegisterFlagForCmd(&actionDockerUsernameFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&actionDockerPasswordFlag, BuildCmd)
@@ -250,6 +336,7 @@ func init() {
 
 	cmdManager.RegisterFlagForCmd(&actionPassphraseFlag, BuildCmd)
 	cmdManager.RegisterFlagForCmd(&actionPEMPathFlag, BuildCmd)
+	cmdManager.RegisterFlagForCmd(&actionKeyfileFlag, BuildCmd)
 }
 
 // BuildCmd represents the build command
@@ -267,6 +354,9 @@ var BuildCmd = &cobra.Command{
 }
 
 func preRun(cmd *cobra.Command, args []string) {
+	if ignoreSubuid && !fakeroot {
+		sylog.Fatalf("--ignore-subuid requires --fakeroot")
+	}
 	if fakeroot && !remote {
 		fakerootExec(args)
 	}
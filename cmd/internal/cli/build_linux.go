@@ -14,10 +14,14 @@ import (
 	osExec "os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 
+	"github.com/mattn/go-shellwords"
 	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/app/singularity"
 	"github.com/sylabs/singularity/internal/pkg/build"
+	"github.com/sylabs/singularity/internal/pkg/build/buildcontext"
 	"github.com/sylabs/singularity/internal/pkg/build/remotebuilder"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/client/cache"
@@ -75,9 +79,10 @@ func fakerootExec(cmdArgs []string) {
 	}
 
 	engineConfig := &fakerootConfig.EngineConfig{
-		Args: args,
-		Envs: os.Environ(),
-		Home: user.Dir,
+		Args:         args,
+		Envs:         os.Environ(),
+		Home:         user.Dir,
+		IgnoreSubuid: ignoreSubuid,
 	}
 
 	cfg := &config.Common{
@@ -112,11 +117,45 @@ func run(cmd *cobra.Command, args []string) {
 	dest := args[0]
 	spec := args[1]
 
-	// check if target collides with existing file
-	if ok := checkBuildTarget(dest, update); !ok {
+	if buildVerity && (sandbox || encrypt || remote) {
+		sylog.Fatalf("--verity can't be used with --sandbox, --encrypt or --remote")
+	}
+
+	if testTimeout < 0 {
+		sylog.Fatalf("--test-timeout requires a positive number of seconds")
+	}
+
+	if remote && (testIsolated || testTimeout > 0) {
+		sylog.Fatalf("--test-isolated and --test-timeout can't be used with --remote")
+	}
+
+	// an OCI layout target adds a tagged image to the layout directory
+	// and never overwrites other images stored in it
+	if strings.HasPrefix(dest, "oci:") {
+		if sandbox || update || remote {
+			sylog.Fatalf("OCI layout targets can't be used with --sandbox, --update or --remote")
+		}
+		buildFormat = "oci"
+		dest = strings.TrimPrefix(dest, "oci:")
+	} else if ok := checkBuildTarget(dest, update); !ok {
+		// check if target collides with existing file
 		os.Exit(1)
 	}
 
+	// mksquashfs arguments are split like a shell would do it to
+	// allow quoted arguments containing spaces
+	var squashfsArgs []string
+	if mksquashfsArgs != "" {
+		if buildFormat != "sif" || remote {
+			sylog.Fatalf("--mksquashfs-args can't be used with --sandbox, --remote or OCI layout targets")
+		}
+		args, err := shellwords.Parse(mksquashfsArgs)
+		if err != nil {
+			sylog.Fatalf("Could not parse --mksquashfs-args %q: %s", mksquashfsArgs, err)
+		}
+		squashfsArgs = args
+	}
+
 	if remote {
 		// building encrypted containers on the remote builder is not currently supported
 		if encrypt {
@@ -195,7 +234,7 @@ func run(cmd *cobra.Command, args []string) {
 	} else {
 
 		var keyInfo *crypt.KeyInfo
-		if encrypt || EnterPassphrase || cmd.Flags().Lookup("pem-path").Changed {
+		if encrypt || EnterPassphrase || cmd.Flags().Lookup("pem-path").Changed || cmd.Flags().Lookup("keyfile").Changed {
 			if os.Getuid() != 0 {
 				sylog.Fatalf("You must be root to build an encrypted container")
 			}
@@ -208,7 +247,8 @@ func run(cmd *cobra.Command, args []string) {
 		} else {
 			_, passphraseEnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_PASSPHRASE")
 			_, pemPathEnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_PEM_PATH")
-			if passphraseEnvOK || pemPathEnvOK {
+			_, keyfileEnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_KEYFILE")
+			if passphraseEnvOK || pemPathEnvOK || keyfileEnvOK {
 				sylog.Warningf("Encryption related env vars found, but --encrypt was not specified. NOT encrypting container.")
 			}
 		}
@@ -232,6 +272,14 @@ func run(cmd *cobra.Command, args []string) {
 			sylog.Fatalf("While creating Docker credentials: %v", err)
 		}
 
+		contextDir, err := buildContextDir(buildContext)
+		if err != nil {
+			sylog.Fatalf("While preparing build context: %v", err)
+		}
+		if contextDir != buildContext {
+			defer os.RemoveAll(contextDir)
+		}
+
 		// parse definition to determine build source
 		defs, err := build.MakeAllDefs(spec)
 		if err != nil {
@@ -256,15 +304,21 @@ func run(cmd *cobra.Command, args []string) {
 					ImgCache:          imgCache,
 					TmpDir:            tmpDir,
 					NoCache:           disableCache,
+					NoBuildCache:      noBuildCache,
 					Update:            update,
 					Force:             force,
 					Sections:          sections,
 					NoTest:            noTest,
+					TestIsolated:      testIsolated,
+					TestTimeout:       testTimeout,
 					NoHTTPS:           noHTTPS,
 					LibraryURL:        libraryURL,
 					LibraryAuthToken:  authToken,
 					DockerAuthConfig:  authConf,
 					EncryptionKeyInfo: keyInfo,
+					Verity:            buildVerity,
+					ContextDir:        contextDir,
+					MksquashfsArgs:    squashfsArgs,
 				},
 			})
 		if err != nil {
@@ -274,10 +328,38 @@ func run(cmd *cobra.Command, args []string) {
 		if err = b.Full(); err != nil {
 			sylog.Fatalf("While performing build: %v", err)
 		}
+
+		singularity.EnforceCachePolicy(imgCache)
 	}
 	sylog.Infof("Build complete: %s", dest)
 }
 
+// buildContextDir returns the directory of the build context path, a
+// build context archive is extracted into a temporary directory removed
+// by the caller.
+func buildContextDir(path string) (string, error) {
+	if path == "" || fs.IsDir(path) {
+		return path, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dir, err := ioutil.TempDir(tmpDir, "build-context-")
+	if err != nil {
+		return "", err
+	}
+	sylog.Debugf("Extracting build context %s to %s", path, dir)
+	if err := buildcontext.Extract(f, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
 func checkSections() error {
 	var all, none bool
 	for _, section := range sections {
@@ -329,24 +411,36 @@ func handleBuildFlags(cmd *cobra.Command) {
 
 // getEncryptionMaterial handles the setting of encryption environment and flag parameters to eventually be
 // passed to the crypt package for handling.
-// This handles the SINGULARITY_ENCRYPTION_PASSPHRASE/PEM_PATH envvars outside of cobra in order to
-// enforce the unique flag/env precidence for the encryption flow
+// This handles the SINGULARITY_ENCRYPTION_PASSPHRASE/PEM_PATH/KEYFILE/PKCS11_URI envvars outside of cobra in
+// order to enforce the unique flag/env precidence for the encryption flow
 func getEncryptionMaterial(cmd *cobra.Command) (crypt.KeyInfo, error) {
 	passphraseFlag := cmd.Flags().Lookup("passphrase")
 	PEMFlag := cmd.Flags().Lookup("pem-path")
+	keyfileFlag := cmd.Flags().Lookup("keyfile")
+	// PKCS#11 tokens are only supported for decryption
+	pkcs11Flag := cmd.Flags().Lookup("pkcs11-uri")
+	pkcs11FlagChanged := pkcs11Flag != nil && pkcs11Flag.Changed
 	passphraseEnv, passphraseEnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_PASSPHRASE")
 	pemPathEnv, pemPathEnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_PEM_PATH")
+	keyfileEnv, keyfileEnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_KEYFILE")
+	pkcs11Env, pkcs11EnvOK := os.LookupEnv("SINGULARITY_ENCRYPTION_PKCS11_URI")
+	pkcs11EnvOK = pkcs11EnvOK && pkcs11Flag != nil
 
 	// checks for no flags/envvars being set
-	if !(PEMFlag.Changed || pemPathEnvOK || passphraseFlag.Changed || passphraseEnvOK) {
+	if !(PEMFlag.Changed || pemPathEnvOK || passphraseFlag.Changed || passphraseEnvOK ||
+		keyfileFlag.Changed || keyfileEnvOK || pkcs11FlagChanged || pkcs11EnvOK) {
 		sylog.Fatalf("Unable to use container encryption. Must supply encryption material through enironment variables or flags.")
 	}
 
 	// order of precidence:
 	// 1. PEM flag
-	// 2. Passphrase flag
-	// 3. PEM envvar
-	// 4. Passphrase envvar
+	// 2. Keyfile flag
+	// 3. PKCS#11 URI flag
+	// 4. Passphrase flag
+	// 5. PEM envvar
+	// 6. Keyfile envvar
+	// 7. PKCS#11 URI envvar
+	// 8. Passphrase envvar
 
 	if PEMFlag.Changed {
 		exists, err := fs.FileExists(encryptionPEMPath)
@@ -362,6 +456,20 @@ func getEncryptionMaterial(cmd *cobra.Command) (crypt.KeyInfo, error) {
 		return crypt.KeyInfo{Format: crypt.PEM, Path: encryptionPEMPath}, nil
 	}
 
+	if keyfileFlag.Changed {
+		if !fs.IsFile(encryptionKeyfile) {
+			sylog.Fatalf("Specified keyfile %s: does not exist or is not a file.", encryptionKeyfile)
+		}
+
+		sylog.Verbosef("Using keyfile flag for encrypted container")
+		return crypt.KeyInfo{Format: crypt.Keyfile, Path: encryptionKeyfile}, nil
+	}
+
+	if pkcs11FlagChanged {
+		sylog.Verbosef("Using PKCS#11 URI flag for encrypted container")
+		return crypt.KeyInfo{Format: crypt.PKCS11, Material: encryptionPKCS11}, nil
+	}
+
 	if passphraseFlag.Changed {
 		sylog.Verbosef("Using interactive passphrase entry for encrypted container")
 		passphrase, err := interactive.AskQuestionNoEcho("Enter encryption passphrase: ")
@@ -388,6 +496,20 @@ func getEncryptionMaterial(cmd *cobra.Command) (crypt.KeyInfo, error) {
 		return crypt.KeyInfo{Format: crypt.PEM, Path: pemPathEnv}, nil
 	}
 
+	if keyfileEnvOK {
+		if !fs.IsFile(keyfileEnv) {
+			sylog.Fatalf("Specified keyfile %s: does not exist or is not a file.", keyfileEnv)
+		}
+
+		sylog.Verbosef("Using keyfile environment variable for encrypted container")
+		return crypt.KeyInfo{Format: crypt.Keyfile, Path: keyfileEnv}, nil
+	}
+
+	if pkcs11EnvOK {
+		sylog.Verbosef("Using PKCS#11 URI environment variable for encrypted container")
+		return crypt.KeyInfo{Format: crypt.PKCS11, Material: pkcs11Env}, nil
+	}
+
 	if passphraseEnvOK {
 		sylog.Verbosef("Using passphrase environment variable for encrypted container")
 		return crypt.KeyInfo{Format: crypt.Passphrase, Material: passphraseEnv}, nil
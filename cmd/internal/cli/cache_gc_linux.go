@@ -0,0 +1,49 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&cacheGcDryFlag, cacheGcCmd)
+}
+
+var (
+	cacheGcDry bool
+
+	// -n|--dry-run
+	cacheGcDryFlag = cmdline.Flag{
+		ID:           "cacheGcDryFlag",
+		Value:        &cacheGcDry,
+		DefaultValue: false,
+		Name:         "dry-run",
+		ShortHand:    "n",
+		Usage:        "report the cache entries which would be removed without removing them",
+	}
+
+	// cacheGcCmd is 'singularity cache gc' and will enforce the cache policy
+	cacheGcCmd = &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			imgCache := getCacheHandle(cache.Config{})
+			if err := singularity.GCSingularityCache(imgCache, cacheGcDry); err != nil {
+				sylog.Fatalf("Cache garbage collection failed: %v", err)
+			}
+		},
+
+		Use:     docs.CacheGcUse,
+		Short:   docs.CacheGcShort,
+		Long:    docs.CacheGcLong,
+		Example: docs.CacheGcExample,
+	}
+)
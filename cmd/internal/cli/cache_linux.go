@@ -16,6 +16,7 @@ func init() {
 	cmdManager.RegisterCmd(CacheCmd)
 	cmdManager.RegisterSubCmd(CacheCmd, cacheCleanCmd)
 	cmdManager.RegisterSubCmd(CacheCmd, CacheListCmd)
+	cmdManager.RegisterSubCmd(CacheCmd, cacheGcCmd)
 }
 
 // CacheCmd : aka, `singularity cache`
@@ -0,0 +1,143 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterCmd(ImageCmd)
+	cmdManager.RegisterSubCmd(ImageCmd, imageAddOverlayCmd)
+	cmdManager.RegisterSubCmd(ImageCmd, imageGrowCmd)
+	cmdManager.RegisterSubCmd(ImageCmd, imageShrinkCmd)
+	cmdManager.RegisterSubCmd(ImageCmd, imageResizeCmd)
+	cmdManager.RegisterSubCmd(ImageCmd, imageUsageCmd)
+
+	cmdManager.RegisterFlagForCmd(&imageSizeFlag, imageAddOverlayCmd, imageGrowCmd, imageShrinkCmd, imageResizeCmd)
+	cmdManager.RegisterFlagForCmd(&imageUsageJSONFlag, imageUsageCmd)
+}
+
+// -s|--size
+var imageSize int
+var imageSizeFlag = cmdline.Flag{
+	ID:           "imageSizeFlag",
+	Value:        &imageSize,
+	DefaultValue: 0,
+	Name:         "size",
+	ShortHand:    "s",
+	Usage:        "overlay size in MiB, or size to add or remove for grow and shrink",
+	Tag:          "<MiB>",
+}
+
+// -j|--json
+var imageUsageJSON bool
+var imageUsageJSONFlag = cmdline.Flag{
+	ID:           "imageUsageJSONFlag",
+	Value:        &imageUsageJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print structured json instead of a table",
+}
+
+// ImageCmd : aka, `singularity image`
+var ImageCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.ImageUse,
+	Short:         docs.ImageShort,
+	Long:          docs.ImageLong,
+	Example:       docs.ImageExample,
+	SilenceErrors: true,
+}
+
+// overlaySizeCommand returns a command resizing or creating the overlay
+// partition of the image passed as argument with fn.
+func overlaySizeCommand(fn func(path string, sizeMiB int64) error, sizeRequired bool) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if imageSize < 0 || (sizeRequired && imageSize == 0) {
+			sylog.Fatalf("A positive size must be specified with --size")
+		}
+		if err := fn(args[0], int64(imageSize)); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	}
+}
+
+// singularity image add-overlay
+var imageAddOverlayCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	Run:                   overlaySizeCommand(singularity.CreateImageOverlay, true),
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.ImageAddOverlayUse,
+	Short:   docs.ImageAddOverlayShort,
+	Long:    docs.ImageAddOverlayLong,
+	Example: docs.ImageAddOverlayExample,
+}
+
+// singularity image grow
+var imageGrowCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	Run:                   overlaySizeCommand(singularity.GrowImageOverlay, true),
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.ImageGrowUse,
+	Short:   docs.ImageGrowShort,
+	Long:    docs.ImageGrowLong,
+	Example: docs.ImageGrowExample,
+}
+
+// singularity image shrink
+var imageShrinkCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	Run:                   overlaySizeCommand(singularity.ShrinkImageOverlay, false),
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.ImageShrinkUse,
+	Short:   docs.ImageShrinkShort,
+	Long:    docs.ImageShrinkLong,
+	Example: docs.ImageShrinkExample,
+}
+
+// singularity image resize
+var imageResizeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	Run:                   overlaySizeCommand(singularity.ResizeImageOverlay, true),
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.ImageResizeUse,
+	Short:   docs.ImageResizeShort,
+	Long:    docs.ImageResizeLong,
+	Example: docs.ImageResizeExample,
+}
+
+// singularity image usage
+var imageUsageCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.PrintImageOverlayUsage(os.Stdout, args[0], imageUsageJSON); err != nil {
+			sylog.Fatalf("Could not report overlay usage: %s", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.ImageUsageUse,
+	Short:   docs.ImageUsageShort,
+	Long:    docs.ImageUsageLong,
+	Example: docs.ImageUsageExample,
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+var (
+	labels      bool
+	deffile     bool
+	runscript   bool
+	testfile    bool
+	environment bool
+	helpfile    bool
+	jsonfmt     bool
+	listApps    bool
+)
+
+type inspectAttributes struct {
+	Apps        string            `json:"apps"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Deffile     string            `json:"deffile,omitempty"`
+	Runscript   string            `json:"runscript,omitempty"`
+	Test        string            `json:"test,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Helpfile    string            `json:"helpfile,omitempty"`
+}
+
+type inspectFormat struct {
+	Attributes inspectAttributes `json:"attributes"`
+	Type       string            `json:"type"`
+}
+
+// -d|--deffile
+var inspectAppsListFlag = cmdline.Flag{
+	ID:           "inspectAppsListFlag",
+	Value:        &listApps,
+	DefaultValue: false,
+	Name:         "list-apps",
+	ShortHand:    "",
+	Usage:        "list all apps in a container",
+}
+
+// --app
+var inspectAppNameFlag = cmdline.Flag{
+	ID:           "inspectAppNameFlag",
+	Value:        &AppName,
+	DefaultValue: "",
+	Name:         "app",
+	Usage:        "inspect a specific app",
+	EnvKeys:      []string{"APP"},
+}
+
+// -l|--labels
+var inspectLabelsFlag = cmdline.Flag{
+	ID:           "inspectLabelsFlag",
+	Value:        &labels,
+	DefaultValue: false,
+	Name:         "labels",
+	ShortHand:    "l",
+	Usage:        "show the labels associated with the image (default)",
+	EnvKeys:      []string{"LABELS"},
+}
+
+// -d|--deffile
+var inspectDeffileFlag = cmdline.Flag{
+	ID:           "inspectDeffileFlag",
+	Value:        &deffile,
+	DefaultValue: false,
+	Name:         "deffile",
+	ShortHand:    "d",
+	Usage:        "show the Singularity recipe file that was used to generate the image",
+	EnvKeys:      []string{"DEFFILE"},
+}
+
+// -r|--runscript
+var inspectRunscriptFlag = cmdline.Flag{
+	ID:           "inspectRunscriptFlag",
+	Value:        &runscript,
+	DefaultValue: false,
+	Name:         "runscript",
+	ShortHand:    "r",
+	Usage:        "show the runscript for the image",
+	EnvKeys:      []string{"RUNSCRIPT"},
+}
+
+// -t|--test
+var inspectTestFlag = cmdline.Flag{
+	ID:           "inspectTestFlag",
+	Value:        &testfile,
+	DefaultValue: false,
+	Name:         "test",
+	ShortHand:    "t",
+	Usage:        "show the test script for the image",
+	EnvKeys:      []string{"TEST"},
+}
+
+// -e|--environment
+var inspectEnvironmentFlag = cmdline.Flag{
+	ID:           "inspectEnvironmentFlag",
+	Value:        &environment,
+	DefaultValue: false,
+	Name:         "environment",
+	ShortHand:    "e",
+	Usage:        "show the environment settings for the image",
+	EnvKeys:      []string{"ENVIRONMENT"},
+}
+
+// -H|--helpfile
+var inspectHelpfileFlag = cmdline.Flag{
+	ID:           "inspectHelpfileFlag",
+	Value:        &helpfile,
+	DefaultValue: false,
+	Name:         "helpfile",
+	ShortHand:    "H",
+	Usage:        "inspect the runscript helpfile, if it exists",
+	EnvKeys:      []string{"HELPFILE"},
+}
+
+// -j|--json
+var inspectJSONFlag = cmdline.Flag{
+	ID:           "inspectJSONFlag",
+	Value:        &jsonfmt,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print structured json instead of sections",
+	EnvKeys:      []string{"JSON"},
+}
+
+func init() {
+	cmdManager.RegisterCmd(InspectCmd)
+
+	cmdManager.RegisterFlagForCmd(&inspectAppNameFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectDeffileFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectEnvironmentFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectHelpfileFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectJSONFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectLabelsFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectRunscriptFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectTestFlag, InspectCmd)
+	cmdManager.RegisterFlagForCmd(&inspectAppsListFlag, InspectCmd)
+}
+
+func getPathPrefix(appName string) string {
+	if appName == "" {
+		return "/.singularity.d"
+	}
+	return fmt.Sprintf("/scif/apps/%s/scif", appName)
+}
+
+func setAttribute(obj *inspectFormat, label string, value string) {
+	switch label {
+	case "apps":
+		obj.Attributes.Apps = value
+	case "deffile":
+		obj.Attributes.Deffile = value
+	case "test":
+		obj.Attributes.Test = value
+	case "helpfile":
+		obj.Attributes.Helpfile = value
+	case "labels":
+		if err := json.Unmarshal([]byte(value), &obj.Attributes.Labels); err != nil {
+			sylog.Warningf("Unable to parse labels: %s", value)
+		}
+	case "runscript":
+		obj.Attributes.Runscript = value
+	default:
+		if strings.HasSuffix(label, "environment.sh") {
+			obj.Attributes.Environment[label] = value
+		} else {
+			sylog.Warningf("Trying to set attribute for unknown label: %s", label)
+		}
+	}
+}
+
+// returns true if flags for other forms of information are unset
+func defaultToLabels() bool {
+	return !(helpfile || deffile || runscript || testfile || environment || listApps)
+}
+
+// InspectCmd represents the 'inspect' command
+// TODO: This should be in its own package, not cli
+var InspectCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.InspectUse,
+	Short:   docs.InspectShort,
+	Long:    docs.InspectLong,
+	Example: docs.InspectExample,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		// Sanity check
+		if _, err := os.Stat(args[0]); err != nil {
+			sylog.Fatalf("container not found: %s", err)
+		}
+
+		abspath, err := filepath.Abs(args[0])
+		if err != nil {
+			sylog.Fatalf("While determining absolute file path: %v", err)
+		}
+		name := filepath.Base(abspath)
+
+		inspectObj := inspectFormat{}
+		inspectObj.Type = "container"
+		inspectObj.Attributes.Labels = make(map[string]string)
+		inspectObj.Attributes.Environment = make(map[string]string)
+
+		if err := inspectImage(&inspectObj, abspath, name); err != nil {
+			sylog.Fatalf("Could not inspect container: %v", err)
+		}
+
+		// Output the inspection results (use JSON if requested).
+		if jsonfmt {
+			jsonObj, err := json.MarshalIndent(inspectObj, "", "\t")
+			if err != nil {
+				sylog.Fatalf("Could not format inspected data as JSON.")
+			}
+			fmt.Println(string(jsonObj))
+		} else {
+			if inspectObj.Attributes.Apps != "" {
+				fmt.Printf("==apps==\n")
+				fmt.Printf("%s\n", inspectObj.Attributes.Apps)
+			}
+			if inspectObj.Attributes.Helpfile != "" {
+				fmt.Println("==helpfile==\n" + inspectObj.Attributes.Helpfile)
+			}
+			if inspectObj.Attributes.Deffile != "" {
+				fmt.Println("==deffile==\n" + inspectObj.Attributes.Deffile)
+			}
+			if inspectObj.Attributes.Runscript != "" {
+				fmt.Println("==runscript==\n" + inspectObj.Attributes.Runscript)
+			}
+			if inspectObj.Attributes.Test != "" {
+				fmt.Println("==test==\n" + inspectObj.Attributes.Test)
+			}
+			if len(inspectObj.Attributes.Environment) > 0 {
+				fmt.Println("==environment==")
+				for envLabel, envValue := range inspectObj.Attributes.Environment {
+					fmt.Println("==environment:" + envLabel + "==\n" + envValue)
+				}
+			}
+			if len(inspectObj.Attributes.Labels) > 0 {
+				fmt.Println("==labels==")
+				for labLabel, labValue := range inspectObj.Attributes.Labels {
+					fmt.Println(labLabel + ": " + labValue)
+				}
+			}
+		}
+	},
+	TraverseChildren: true,
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+// sifEnvironmentLabel is the name of the file the %environment section
+// of a definition file is written to in the container.
+const sifEnvironmentLabel = "90-environment.sh"
+
+// inspectImage reads the requested metadata without the Linux runtime.
+// Sandbox files are read directly, SIF metadata comes from the definition
+// file and the OCI image configuration stored in the image, as the root
+// filesystem can't be mounted.
+func inspectImage(obj *inspectFormat, abspath, name string) error {
+	img, err := image.Init(abspath, false)
+	if err != nil {
+		return err
+	}
+	defer img.File.Close()
+
+	switch img.Type {
+	case image.SANDBOX:
+		return inspectSandbox(obj, abspath)
+	case image.SIF:
+		return inspectSIF(obj, img)
+	}
+	return fmt.Errorf("%s: only SIF images and sandboxes can be inspected without the Linux runtime", name)
+}
+
+// inspectSandbox reads the metadata files of the sandbox rootfs.
+func inspectSandbox(obj *inspectFormat, rootfs string) error {
+	prefix := filepath.Join(rootfs, filepath.FromSlash(getPathPrefix(AppName)))
+
+	if listApps {
+		dirs, _ := filepath.Glob(filepath.Join(rootfs, "scif", "apps", "*", "scif"))
+		var apps []string
+		for _, d := range dirs {
+			if fi, err := os.Stat(d); err == nil && fi.IsDir() {
+				apps = append(apps, filepath.Base(filepath.Dir(d)))
+			}
+		}
+		setAttribute(obj, "apps", strings.Join(apps, "\n"))
+	}
+
+	if AppName != "" {
+		if fi, err := os.Stat(filepath.Join(rootfs, "scif", "apps", AppName)); err != nil || !fi.IsDir() {
+			return fmt.Errorf("app %s does not exist", AppName)
+		}
+	}
+
+	files := []struct {
+		selected bool
+		file     string
+		label    string
+	}{
+		{helpfile, "runscript.help", "helpfile"},
+		{deffile && AppName == "", "Singularity", "deffile"},
+		{runscript, "runscript", "runscript"},
+		{testfile, "test", "test"},
+		{labels || defaultToLabels(), "labels.json", "labels"},
+	}
+	for _, f := range files {
+		if !f.selected {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(prefix, f.file))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		setAttribute(obj, f.label, string(b))
+	}
+
+	if environment {
+		envs, _ := filepath.Glob(filepath.Join(prefix, "env", "9*-environment.sh"))
+		for _, env := range envs {
+			b, err := ioutil.ReadFile(env)
+			if err != nil {
+				return err
+			}
+			setAttribute(obj, filepath.Base(env), string(b))
+		}
+	}
+
+	return nil
+}
+
+// inspectSIF fills the requested metadata from the definition file and
+// the OCI image configuration of a SIF image.
+func inspectSIF(obj *inspectFormat, img *image.Image) error {
+	var raw, ociConfig []byte
+
+	for _, s := range img.Sections {
+		var dst *[]byte
+
+		switch {
+		case s.Type == uint32(sif.DataDeffile):
+			dst = &raw
+		case s.Type == uint32(sif.DataGenericJSON) && s.Name == "oci-config.json":
+			dst = &ociConfig
+		default:
+			continue
+		}
+		*dst = make([]byte, s.Size)
+		if _, err := img.File.ReadAt(*dst, int64(s.Offset)); err != nil {
+			return fmt.Errorf("while reading %s: %s", img.Path, err)
+		}
+	}
+
+	def := types.Definition{}
+	if len(bytes.TrimSpace(raw)) > 0 {
+		d, err := parser.ParseDefinitionFile(bytes.NewReader(raw))
+		if err != nil && !parser.IsInvalidSectionError(err) {
+			sylog.Warningf("Unable to parse the definition file of %s: %s", img.Path, err)
+		}
+		def = d
+	}
+
+	if listApps {
+		setAttribute(obj, "apps", strings.Join(definitionApps(def), "\n"))
+	}
+
+	scripts := def.ImageData.ImageScripts
+	imgLabels := def.ImageData.Labels
+
+	if AppName != "" {
+		found := false
+		for _, app := range definitionApps(def) {
+			found = found || app == AppName
+		}
+		if !found {
+			return fmt.Errorf("app %s does not exist", AppName)
+		}
+		scripts = types.ImageScripts{
+			Help:        types.Script{Script: def.CustomData["apphelp "+AppName]},
+			Environment: types.Script{Script: def.CustomData["appenv "+AppName]},
+			Runscript:   types.Script{Script: def.CustomData["apprun "+AppName]},
+			Test:        types.Script{Script: def.CustomData["apptest "+AppName]},
+		}
+		imgLabels = parseAppLabels(def.CustomData["applabels "+AppName])
+	}
+
+	if helpfile {
+		setAttribute(obj, "helpfile", scripts.Help.Script)
+	}
+	if deffile && AppName == "" {
+		setAttribute(obj, "deffile", string(raw))
+	}
+	if runscript {
+		setAttribute(obj, "runscript", scripts.Runscript.Script)
+	}
+	if testfile {
+		setAttribute(obj, "test", scripts.Test.Script)
+	}
+	if environment && scripts.Environment.Script != "" {
+		setAttribute(obj, sifEnvironmentLabel, scripts.Environment.Script)
+	}
+
+	if labels || defaultToLabels() {
+		if AppName == "" && len(ociConfig) > 0 {
+			var conf imageSpecs.ImageConfig
+			if err := json.Unmarshal(ociConfig, &conf); err != nil {
+				sylog.Warningf("Unable to parse the OCI image configuration of %s: %s", img.Path, err)
+			}
+			for k, v := range conf.Labels {
+				obj.Attributes.Labels[k] = v
+			}
+		}
+		for k, v := range imgLabels {
+			obj.Attributes.Labels[k] = v
+		}
+	}
+
+	return nil
+}
+
+// definitionApps returns the sorted names of the SCIF apps of a definition.
+func definitionApps(def types.Definition) []string {
+	seen := make(map[string]bool)
+	var apps []string
+
+	for k := range def.CustomData {
+		s := strings.SplitN(k, " ", 2)
+		if len(s) == 2 && strings.HasPrefix(s[0], "app") && !seen[s[1]] {
+			seen[s[1]] = true
+			apps = append(apps, s[1])
+		}
+	}
+	sort.Strings(apps)
+
+	return apps
+}
+
+// parseAppLabels parses an %applabels section like the build does for
+// %labels, one "key value" pair per line.
+func parseAppLabels(section string) map[string]string {
+	labels := make(map[string]string)
+
+	for _, line := range strings.Split(section, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s := strings.SplitN(line, " ", 2)
+		if len(s) < 2 {
+			labels[s[0]] = ""
+		} else {
+			labels[s[0]] = strings.TrimSpace(s[1])
+		}
+	}
+
+	return labels
+}
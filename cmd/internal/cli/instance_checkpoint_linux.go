@@ -0,0 +1,68 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&instanceCheckpointLeaveRunningFlag, instanceCheckpointCmd)
+	cmdManager.RegisterFlagForCmd(&instanceCheckpointTimeoutFlag, instanceCheckpointCmd)
+}
+
+// --leave-running
+var instanceCheckpointLeaveRunning bool
+var instanceCheckpointLeaveRunningFlag = cmdline.Flag{
+	ID:           "instanceCheckpointLeaveRunningFlag",
+	Value:        &instanceCheckpointLeaveRunning,
+	DefaultValue: false,
+	Name:         "leave-running",
+	Usage:        "keep the instance running once checkpointed",
+}
+
+// -t|--timeout
+var instanceCheckpointTimeout int
+var instanceCheckpointTimeoutFlag = cmdline.Flag{
+	ID:           "instanceCheckpointTimeoutFlag",
+	Value:        &instanceCheckpointTimeout,
+	DefaultValue: 600,
+	Name:         "timeout",
+	ShortHand:    "t",
+	Usage:        "give up waiting for the checkpoint after X seconds, 0 waits indefinitely",
+}
+
+// singularity instance checkpoint
+var instanceCheckpointCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if os.Getuid() != 0 {
+			sylog.Fatalf("Only root user can checkpoint instances")
+		}
+
+		dir, err := filepath.Abs(args[1])
+		if err != nil {
+			sylog.Fatalf("Could not determine checkpoint directory: %s", err)
+		}
+
+		timeout := time.Duration(instanceCheckpointTimeout) * time.Second
+		return singularity.CheckpointInstance(args[0], dir, instanceCheckpointLeaveRunning, timeout)
+	},
+
+	Use:     docs.InstanceCheckpointUse,
+	Short:   docs.InstanceCheckpointShort,
+	Long:    docs.InstanceCheckpointLong,
+	Example: docs.InstanceCheckpointExample,
+}
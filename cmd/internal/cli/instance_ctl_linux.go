@@ -0,0 +1,89 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&instanceCtlFollowFlag, instanceCtlCmd)
+	cmdManager.RegisterFlagForCmd(&instanceCtlStderrFlag, instanceCtlCmd)
+
+	// options following the command are passed to exec
+	instanceCtlCmd.Flags().SetInterspersed(false)
+}
+
+// -f|--follow
+var instanceCtlFollow bool
+var instanceCtlFollowFlag = cmdline.Flag{
+	ID:           "instanceCtlFollowFlag",
+	Value:        &instanceCtlFollow,
+	DefaultValue: false,
+	Name:         "follow",
+	ShortHand:    "f",
+	Usage:        "keep reading instance logs until the instance exits",
+}
+
+// --stderr
+var instanceCtlStderr bool
+var instanceCtlStderrFlag = cmdline.Flag{
+	ID:           "instanceCtlStderrFlag",
+	Value:        &instanceCtlStderr,
+	DefaultValue: false,
+	Name:         "stderr",
+	Usage:        "read instance error log instead of output log",
+}
+
+// singularity instance ctl
+var instanceCtlCmd = &cobra.Command{
+	Args:                  cobra.MinimumNArgs(2),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, command := args[0], args[1]
+
+		if command != "exec" && len(args) > 2 {
+			sylog.Fatalf("Command %s doesn't accept arguments", command)
+		}
+
+		var err error
+		switch command {
+		case "stats":
+			err = singularity.PrintInstanceStats(os.Stdout, name)
+		case "pause":
+			err = singularity.PauseInstance(name)
+		case "resume":
+			err = singularity.ResumeInstance(name)
+		case "logs":
+			err = singularity.PrintInstanceLogs(os.Stdout, name, instanceCtlStderr, instanceCtlFollow)
+		case "exec":
+			if len(args) < 3 {
+				sylog.Fatalf("No command to execute in instance %s", name)
+			}
+			var code int
+			code, err = singularity.ExecInstance(os.Stdout, name, args[2:])
+			if err == nil && code != 0 {
+				os.Exit(code)
+			}
+		default:
+			sylog.Fatalf("Unknown instance control command %s", command)
+		}
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.InstanceCtlUse,
+	Short:   docs.InstanceCtlShort,
+	Long:    docs.InstanceCtlLong,
+	Example: docs.InstanceCtlExample,
+}
@@ -17,6 +17,10 @@ func init() {
 	cmdManager.RegisterSubCmd(instanceCmd, instanceStartCmd)
 	cmdManager.RegisterSubCmd(instanceCmd, instanceStopCmd)
 	cmdManager.RegisterSubCmd(instanceCmd, instanceListCmd)
+	cmdManager.RegisterSubCmd(instanceCmd, instanceCheckpointCmd)
+	cmdManager.RegisterSubCmd(instanceCmd, instanceCtlCmd)
+	cmdManager.RegisterSubCmd(instanceCmd, instanceLogsCmd)
+	cmdManager.RegisterSubCmd(instanceCmd, instanceStatsCmd)
 }
 
 // singularity instance
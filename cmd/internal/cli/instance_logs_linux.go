@@ -0,0 +1,75 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&instanceLogsFollowFlag, instanceLogsCmd)
+	cmdManager.RegisterFlagForCmd(&instanceLogsTailFlag, instanceLogsCmd)
+	cmdManager.RegisterFlagForCmd(&instanceLogsTimestampsFlag, instanceLogsCmd)
+}
+
+// -f|--follow
+var instanceLogsFollow bool
+var instanceLogsFollowFlag = cmdline.Flag{
+	ID:           "instanceLogsFollowFlag",
+	Value:        &instanceLogsFollow,
+	DefaultValue: false,
+	Name:         "follow",
+	ShortHand:    "f",
+	Usage:        "keep reading instance logs until the instance exits",
+}
+
+// -n|--tail
+var instanceLogsTail int
+var instanceLogsTailFlag = cmdline.Flag{
+	ID:           "instanceLogsTailFlag",
+	Value:        &instanceLogsTail,
+	DefaultValue: -1,
+	Name:         "tail",
+	ShortHand:    "n",
+	Usage:        "only print the last N log lines",
+}
+
+// --timestamps
+var instanceLogsTimestamps bool
+var instanceLogsTimestampsFlag = cmdline.Flag{
+	ID:           "instanceLogsTimestampsFlag",
+	Value:        &instanceLogsTimestamps,
+	DefaultValue: false,
+	Name:         "timestamps",
+	Usage:        "prefix log lines with their timestamp",
+}
+
+// singularity instance logs
+var instanceLogsCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := singularity.InstanceLogsOptions{
+			Follow:     instanceLogsFollow,
+			Tail:       instanceLogsTail,
+			Timestamps: instanceLogsTimestamps,
+		}
+		if err := singularity.PrintInstanceStructuredLogs(os.Stdout, os.Stderr, args[0], opts); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.InstanceLogsUse,
+	Short:   docs.InstanceLogsShort,
+	Long:    docs.InstanceLogsLong,
+	Example: docs.InstanceLogsExample,
+}
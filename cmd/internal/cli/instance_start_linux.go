@@ -15,6 +15,13 @@ import (
 
 func init() {
 	cmdManager.RegisterFlagForCmd(&instanceStartPidFileFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartRestoreFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartNoHealthcheckFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartHealthOnFailureFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartLogFormatFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartLogMaxSizeFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartLogMaxFilesFlag, instanceStartCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStartExecAgentFlag, instanceStartCmd)
 }
 
 // --pid-file
@@ -28,6 +35,82 @@ var instanceStartPidFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"PID_FILE"},
 }
 
+// --restore
+var instanceStartRestore string
+var instanceStartRestoreFlag = cmdline.Flag{
+	ID:           "instanceStartRestoreFlag",
+	Value:        &instanceStartRestore,
+	DefaultValue: "",
+	Name:         "restore",
+	Usage:        "restore the instance from a checkpoint directory created by instance checkpoint (root only)",
+}
+
+// --no-healthcheck
+var instanceStartNoHealthcheck bool
+var instanceStartNoHealthcheckFlag = cmdline.Flag{
+	ID:           "instanceStartNoHealthcheckFlag",
+	Value:        &instanceStartNoHealthcheck,
+	DefaultValue: false,
+	Name:         "no-healthcheck",
+	Usage:        "disable the healthcheck provided by the image",
+	EnvKeys:      []string{"NO_HEALTHCHECK"},
+}
+
+// --health-on-failure
+var instanceStartHealthOnFailure string
+var instanceStartHealthOnFailureFlag = cmdline.Flag{
+	ID:           "instanceStartHealthOnFailureFlag",
+	Value:        &instanceStartHealthOnFailure,
+	DefaultValue: "none",
+	Name:         "health-on-failure",
+	Usage:        "action taken when the instance becomes unhealthy: none, restart or signal:<signal>",
+	EnvKeys:      []string{"HEALTH_ON_FAILURE"},
+}
+
+// --log-format
+var instanceStartLogFormat string
+var instanceStartLogFormatFlag = cmdline.Flag{
+	ID:           "instanceStartLogFormatFlag",
+	Value:        &instanceStartLogFormat,
+	DefaultValue: "",
+	Name:         "log-format",
+	Usage:        "write the instance output to a structured log with the given format: json, kubernetes or basic",
+	EnvKeys:      []string{"LOG_FORMAT"},
+}
+
+// --log-max-size
+var instanceStartLogMaxSize int
+var instanceStartLogMaxSizeFlag = cmdline.Flag{
+	ID:           "instanceStartLogMaxSizeFlag",
+	Value:        &instanceStartLogMaxSize,
+	DefaultValue: 10,
+	Name:         "log-max-size",
+	Usage:        "size in MiB after which the structured log is rotated, 0 disables rotation",
+	EnvKeys:      []string{"LOG_MAX_SIZE"},
+}
+
+// --log-max-files
+var instanceStartLogMaxFiles int
+var instanceStartLogMaxFilesFlag = cmdline.Flag{
+	ID:           "instanceStartLogMaxFilesFlag",
+	Value:        &instanceStartLogMaxFiles,
+	DefaultValue: 3,
+	Name:         "log-max-files",
+	Usage:        "number of rotated structured log files kept",
+	EnvKeys:      []string{"LOG_MAX_FILES"},
+}
+
+// --exec-agent
+var instanceStartExecAgent bool
+var instanceStartExecAgentFlag = cmdline.Flag{
+	ID:           "instanceStartExecAgentFlag",
+	Value:        &instanceStartExecAgent,
+	DefaultValue: false,
+	Name:         "exec-agent",
+	Usage:        "serve an exec agent spawning the processes of exec instance:// directly in the instance namespaces",
+	EnvKeys:      []string{"EXEC_AGENT"},
+}
+
 // singularity instance start
 var instanceStartCmd = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(2),
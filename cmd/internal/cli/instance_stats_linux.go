@@ -0,0 +1,110 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&instanceStatsUserFlag, instanceStatsCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStatsJSONFlag, instanceStatsCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStatsPrometheusFlag, instanceStatsCmd)
+	cmdManager.RegisterFlagForCmd(&instanceStatsListenFlag, instanceStatsCmd)
+}
+
+// -u|--user
+var instanceStatsUser string
+var instanceStatsUserFlag = cmdline.Flag{
+	ID:           "instanceStatsUserFlag",
+	Value:        &instanceStatsUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        `If running as root, print statistics of instances from "<username>"`,
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// -j|--json
+var instanceStatsJSON bool
+var instanceStatsJSONFlag = cmdline.Flag{
+	ID:           "instanceStatsJSONFlag",
+	Value:        &instanceStatsJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "Print structured json instead of a table",
+	EnvKeys:      []string{"JSON"},
+}
+
+// --prometheus
+var instanceStatsPrometheus bool
+var instanceStatsPrometheusFlag = cmdline.Flag{
+	ID:           "instanceStatsPrometheusFlag",
+	Value:        &instanceStatsPrometheus,
+	DefaultValue: false,
+	Name:         "prometheus",
+	Usage:        "Print statistics in the Prometheus text format",
+}
+
+// --listen
+var instanceStatsListen string
+var instanceStatsListenFlag = cmdline.Flag{
+	ID:           "instanceStatsListenFlag",
+	Value:        &instanceStatsListen,
+	DefaultValue: "",
+	Name:         "listen",
+	Usage:        "serve statistics in the Prometheus text format on /metrics of a unix socket path or a loopback host:port address until interrupted",
+	Tag:          "<address>",
+	EnvKeys:      []string{"STATS_LISTEN"},
+}
+
+// singularity instance stats
+var instanceStatsCmd = &cobra.Command{
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := "*"
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		if instanceStatsUser != "" && os.Getuid() != 0 {
+			sylog.Fatalf("Only root user can print statistics of user's instances")
+		}
+		if instanceStatsJSON && instanceStatsPrometheus {
+			sylog.Fatalf("--json and --prometheus can't be used together")
+		}
+
+		if instanceStatsListen != "" {
+			if err := singularity.ServeInstanceMetrics(instanceStatsListen, name, instanceStatsUser); err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			return
+		}
+
+		opts := singularity.InstanceStatsOptions{
+			User:       instanceStatsUser,
+			JSON:       instanceStatsJSON,
+			Prometheus: instanceStatsPrometheus,
+		}
+		if err := singularity.PrintInstanceMetrics(os.Stdout, name, opts); err != nil {
+			sylog.Fatalf("Could not print instance statistics: %v", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceStatsUse,
+	Short:   docs.InstanceStatsShort,
+	Long:    docs.InstanceStatsLong,
+	Example: docs.InstanceStatsExample,
+}
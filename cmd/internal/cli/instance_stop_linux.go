@@ -102,7 +102,9 @@ var instanceStopCmd = &cobra.Command{
 			sylog.Fatalf("Only root user can stop user's instances")
 		}
 
-		sig := syscall.SIGINT
+		// let instance stop choose the signal according to the
+		// instance init process
+		sig := syscall.Signal(0)
 		if instanceStopSignal != "" {
 			var err error
 			sig, err = signal.Convert(instanceStopSignal)
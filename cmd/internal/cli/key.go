@@ -64,8 +64,12 @@ func init() {
 	cmdManager.RegisterSubCmd(KeyCmd, KeyImportCmd)
 	cmdManager.RegisterSubCmd(KeyCmd, KeyRemoveCmd)
 	cmdManager.RegisterSubCmd(KeyCmd, KeyExportCmd)
+	cmdManager.RegisterSubCmd(KeyCmd, KeyExportBundleCmd)
+	cmdManager.RegisterSubCmd(KeyCmd, KeySubscribeCmd)
+	cmdManager.RegisterSubCmd(KeyCmd, KeyUnsubscribeCmd)
+	cmdManager.RegisterSubCmd(KeyCmd, KeySyncCmd)
 
-	cmdManager.RegisterFlagForCmd(&keyServerURIFlag, KeySearchCmd, KeyPushCmd, KeyPullCmd)
+	cmdManager.RegisterFlagForCmd(&keyServerURIFlag, KeySearchCmd, KeyPushCmd, KeyPullCmd, KeySubscribeCmd, KeySyncCmd)
 	cmdManager.RegisterFlagForCmd(&keySearchLongListFlag, KeySearchCmd)
 	cmdManager.RegisterFlagForCmd(&keyNewpairBitLengthFlag, KeyNewPairCmd)
 }
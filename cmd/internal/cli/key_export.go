@@ -12,6 +12,7 @@ import (
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/signing"
 	"github.com/sylabs/singularity/pkg/sypgp"
 )
 
@@ -38,9 +39,20 @@ var keyExportArmorFlag = cmdline.Flag{
 	Usage:        "ascii armored format",
 }
 
+// --key-uri
+var keyExportKeyURIFlag = cmdline.Flag{
+	ID:           "keyExportKeyURIFlag",
+	Value:        &keyURI,
+	DefaultValue: "",
+	Name:         "key-uri",
+	Usage:        "export the public key of a key provider (pkcs11:, kms: or agent: URI)",
+	EnvKeys:      []string{"KEY_EXPORT_KEY_URI"},
+}
+
 func init() {
 	cmdManager.RegisterFlagForCmd(&keyExportSecretFlag, KeyExportCmd)
 	cmdManager.RegisterFlagForCmd(&keyExportArmorFlag, KeyExportCmd)
+	cmdManager.RegisterFlagForCmd(&keyExportKeyURIFlag, KeyExportCmd)
 }
 
 // KeyExportCmd is `singularity key export` and exports a public or secret
@@ -58,6 +70,17 @@ var KeyExportCmd = &cobra.Command{
 }
 
 func exportRun(cmd *cobra.Command, args []string) {
+	if keyURI != "" {
+		if secretExport {
+			sylog.Fatalf("the secret key of a key provider can't be exported")
+		}
+		if err := signing.ExportProviderKey(keyURI, args[0], armor); err != nil {
+			sylog.Errorf("key export command failed: %s", err)
+			os.Exit(10)
+		}
+		return
+	}
+
 	keyring := sypgp.NewHandle("")
 	if secretExport {
 		err := keyring.ExportPrivateKey(args[0], armor)
@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sypgp"
+)
+
+var (
+	bundleVersion      int
+	bundleKeyIdx       int
+	bundleFingerprints []string
+)
+
+// --bundle-version
+var keyExportBundleVersionFlag = cmdline.Flag{
+	ID:           "keyExportBundleVersionFlag",
+	Value:        &bundleVersion,
+	DefaultValue: 1,
+	Name:         "bundle-version",
+	Usage:        "version of the key bundle",
+}
+
+// -k|--keyidx
+var keyExportBundleKeyIdxFlag = cmdline.Flag{
+	ID:           "keyExportBundleKeyIdxFlag",
+	Value:        &bundleKeyIdx,
+	DefaultValue: -1,
+	Name:         "keyidx",
+	ShortHand:    "k",
+	Usage:        "private key used to sign the bundle (index from 'keys list --secret')",
+}
+
+// --fingerprint
+var keyExportBundleFingerprintFlag = cmdline.Flag{
+	ID:           "keyExportBundleFingerprintFlag",
+	Value:        &bundleFingerprints,
+	DefaultValue: []string{},
+	Name:         "fingerprint",
+	Usage:        "fingerprint or key ID of a public key to export, all public keys are exported by default",
+}
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&keyExportBundleVersionFlag, KeyExportBundleCmd)
+	cmdManager.RegisterFlagForCmd(&keyExportBundleKeyIdxFlag, KeyExportBundleCmd)
+	cmdManager.RegisterFlagForCmd(&keyExportBundleFingerprintFlag, KeyExportBundleCmd)
+}
+
+// KeyExportBundleCmd is `singularity key export-bundle` and exports public
+// keys from local keyring into a signed key bundle.
+var KeyExportBundleCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   exportBundleRun,
+
+	Use:     docs.KeyExportBundleUse,
+	Short:   docs.KeyExportBundleShort,
+	Long:    docs.KeyExportBundleLong,
+	Example: docs.KeyExportBundleExample,
+}
+
+func exportBundleRun(cmd *cobra.Command, args []string) {
+	keyring := sypgp.NewHandle("")
+	if err := keyring.ExportBundle(args[0], bundleFingerprints, bundleVersion, bundleKeyIdx); err != nil {
+		sylog.Errorf("key export-bundle command failed: %s", err)
+		os.Exit(10)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sypgp"
+)
+
+var (
+	keyGroupSigner  string // --signer option
+	keyGroupRefresh string // --refresh option
+)
+
+// --signer
+var keySubscribeSignerFlag = cmdline.Flag{
+	ID:           "keySubscribeSignerFlag",
+	Value:        &keyGroupSigner,
+	DefaultValue: "",
+	Name:         "signer",
+	Usage:        "fingerprint of the local public key certifying the group members (required)",
+}
+
+// --refresh
+var keySubscribeRefreshFlag = cmdline.Flag{
+	ID:           "keySubscribeRefreshFlag",
+	Value:        &keyGroupRefresh,
+	DefaultValue: "",
+	Name:         "refresh",
+	Usage:        "refresh the group when used by verify once this interval elapsed (e.g. 24h)",
+}
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&keySubscribeSignerFlag, KeySubscribeCmd)
+	cmdManager.RegisterFlagForCmd(&keySubscribeRefreshFlag, KeySubscribeCmd)
+}
+
+// KeySubscribeCmd is `singularity key subscribe' and subscribes the local
+// keyring to a key group of a key server
+var KeySubscribeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                sylabsToken,
+	Run: func(cmd *cobra.Command, args []string) {
+		handleKeyFlags(cmd)
+
+		if len(keyGroupSigner) != 40 {
+			sylog.Fatalf("The --signer option requires the 40 characters fingerprint of a key of your local keyring")
+		}
+
+		var refresh time.Duration
+		if keyGroupRefresh != "" {
+			d, err := time.ParseDuration(keyGroupRefresh)
+			if err != nil || d <= 0 {
+				sylog.Fatalf("The --refresh option requires a positive interval like 12h or 30m")
+			}
+			refresh = d
+		}
+
+		if err := sypgp.NewHandle("").SubscribeGroup(args[0], keyServerURI, authToken, keyGroupSigner, refresh); err != nil {
+			sylog.Errorf("subscribe failed: %s", err)
+			os.Exit(2)
+		}
+	},
+
+	Use:     docs.KeySubscribeUse,
+	Short:   docs.KeySubscribeShort,
+	Long:    docs.KeySubscribeLong,
+	Example: docs.KeySubscribeExample,
+}
+
+// KeyUnsubscribeCmd is `singularity key unsubscribe' and removes a key
+// group subscription along with the keys it added
+var KeyUnsubscribeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := sypgp.NewHandle("").UnsubscribeGroup(args[0]); err != nil {
+			sylog.Errorf("unsubscribe failed: %s", err)
+			os.Exit(2)
+		}
+	},
+
+	Use:     docs.KeyUnsubscribeUse,
+	Short:   docs.KeyUnsubscribeShort,
+	Long:    docs.KeyUnsubscribeLong,
+	Example: docs.KeyUnsubscribeExample,
+}
+
+// KeySyncCmd is `singularity key sync' and refreshes all the key groups
+// the local keyring is subscribed to
+var KeySyncCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	PreRun:                sylabsToken,
+	Run: func(cmd *cobra.Command, args []string) {
+		handleKeyFlags(cmd)
+
+		if err := doKeySyncCmd(keyServerURI); err != nil {
+			sylog.Errorf("sync failed: %s", err)
+			os.Exit(2)
+		}
+	},
+
+	Use:     docs.KeySyncUse,
+	Short:   docs.KeySyncShort,
+	Long:    docs.KeySyncLong,
+	Example: docs.KeySyncExample,
+}
+
+func doKeySyncCmd(url string) error {
+	keyring := sypgp.NewHandle("")
+
+	if err := keyring.SyncGroups(url, authToken); err != nil {
+		return err
+	}
+
+	groups, err := keyring.LoadGroups()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Println("Not subscribed to any key group, use 'key subscribe' first")
+		return nil
+	}
+	for _, g := range groups {
+		fmt.Printf("%s (%s): %d key(s) certified by %s", g.Name, g.KeyserverURI, len(g.Fingerprints), g.Signer)
+		if g.Refresh > 0 {
+			fmt.Printf(", refreshed every %s", g.Refresh)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
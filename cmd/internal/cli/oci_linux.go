@@ -50,6 +50,17 @@ var ociCreateEmptyProcessFlag = cmdline.Flag{
 	EnvKeys:      []string{"EMPTY_PROCESS"},
 }
 
+// --annotation
+var ociAnnotationFlag = cmdline.Flag{
+	ID:           "ociAnnotationFlag",
+	Value:        &ociArgs.Annotations,
+	DefaultValue: []string{},
+	Name:         "annotation",
+	Usage:        "add an annotation to the container configuration, overriding the bundle one (eg: --annotation key=value)",
+	Tag:          "<key=value>",
+	EnvKeys:      []string{"ANNOTATION"},
+}
+
 // -l|--log-path
 var ociLogPathFlag = cmdline.Flag{
 	ID:           "ociLogPathFlag",
@@ -128,6 +139,106 @@ var ociUpdateFromFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"FROM_FILE"},
 }
 
+// --cpu-share
+var ociUpdateCPUSharesFlag = cmdline.Flag{
+	ID:           "ociUpdateCPUSharesFlag",
+	Value:        &ociArgs.Resources.CPUShares,
+	DefaultValue: "",
+	Name:         "cpu-share",
+	Usage:        "CPU shares (relative weight vs. other containers)",
+}
+
+// --cpu-period
+var ociUpdateCPUPeriodFlag = cmdline.Flag{
+	ID:           "ociUpdateCPUPeriodFlag",
+	Value:        &ociArgs.Resources.CPUPeriod,
+	DefaultValue: "",
+	Name:         "cpu-period",
+	Usage:        "CPU CFS period in microseconds to be used for hardcapping",
+}
+
+// --cpu-quota
+var ociUpdateCPUQuotaFlag = cmdline.Flag{
+	ID:           "ociUpdateCPUQuotaFlag",
+	Value:        &ociArgs.Resources.CPUQuota,
+	DefaultValue: "",
+	Name:         "cpu-quota",
+	Usage:        "CPU CFS hardcap limit in microseconds per period",
+}
+
+// --cpuset-cpus
+var ociUpdateCpusetCpusFlag = cmdline.Flag{
+	ID:           "ociUpdateCpusetCpusFlag",
+	Value:        &ociArgs.Resources.CpusetCpus,
+	DefaultValue: "",
+	Name:         "cpuset-cpus",
+	Usage:        "CPUs allowed for execution (eg: 0-3,5)",
+}
+
+// --cpuset-mems
+var ociUpdateCpusetMemsFlag = cmdline.Flag{
+	ID:           "ociUpdateCpusetMemsFlag",
+	Value:        &ociArgs.Resources.CpusetMems,
+	DefaultValue: "",
+	Name:         "cpuset-mems",
+	Usage:        "memory nodes allowed for execution (eg: 0-1)",
+}
+
+// --memory
+var ociUpdateMemoryFlag = cmdline.Flag{
+	ID:           "ociUpdateMemoryFlag",
+	Value:        &ociArgs.Resources.Memory,
+	DefaultValue: "",
+	Name:         "memory",
+	Usage:        "memory limit (eg: 512m, -1 for unlimited)",
+}
+
+// --memory-reservation
+var ociUpdateMemoryReservationFlag = cmdline.Flag{
+	ID:           "ociUpdateMemoryReservationFlag",
+	Value:        &ociArgs.Resources.MemoryReservation,
+	DefaultValue: "",
+	Name:         "memory-reservation",
+	Usage:        "memory soft limit (eg: 256m, -1 for unlimited)",
+}
+
+// --memory-swap
+var ociUpdateMemorySwapFlag = cmdline.Flag{
+	ID:           "ociUpdateMemorySwapFlag",
+	Value:        &ociArgs.Resources.MemorySwap,
+	DefaultValue: "",
+	Name:         "memory-swap",
+	Usage:        "total memory usage including swap (eg: 1g, -1 for unlimited swap)",
+}
+
+// --pids-limit
+var ociUpdatePidsLimitFlag = cmdline.Flag{
+	ID:           "ociUpdatePidsLimitFlag",
+	Value:        &ociArgs.Resources.PidsLimit,
+	DefaultValue: "",
+	Name:         "pids-limit",
+	Usage:        "maximum number of processes (-1 for unlimited)",
+}
+
+// --interval
+var ociEventsIntervalFlag = cmdline.Flag{
+	ID:           "ociEventsIntervalFlag",
+	Value:        &ociArgs.EventsInterval,
+	DefaultValue: "5s",
+	Name:         "interval",
+	Usage:        "interval between two statistics events",
+	Tag:          "<duration>",
+}
+
+// --stats
+var ociEventsStatsFlag = cmdline.Flag{
+	ID:           "ociEventsStatsFlag",
+	Value:        &ociArgs.EventsStats,
+	DefaultValue: false,
+	Name:         "stats",
+	Usage:        "display the container statistics once and exit",
+}
+
 func init() {
 	cmdManager.RegisterCmd(OciCmd)
 	cmdManager.RegisterSubCmd(OciCmd, OciStartCmd)
@@ -139,6 +250,7 @@ func init() {
 	cmdManager.RegisterSubCmd(OciCmd, OciAttachCmd)
 	cmdManager.RegisterSubCmd(OciCmd, OciExecCmd)
 	cmdManager.RegisterSubCmd(OciCmd, OciUpdateCmd)
+	cmdManager.RegisterSubCmd(OciCmd, OciEventsCmd)
 	cmdManager.RegisterSubCmd(OciCmd, OciPauseCmd)
 	cmdManager.RegisterSubCmd(OciCmd, OciResumeCmd)
 	cmdManager.RegisterSubCmd(OciCmd, OciMountCmd)
@@ -153,10 +265,22 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&ociLogFormatFlag, createRunCmd...)
 	cmdManager.RegisterFlagForCmd(&ociPidFileFlag, createRunCmd...)
 	cmdManager.RegisterFlagForCmd(&ociCreateEmptyProcessFlag, OciCreateCmd)
+	cmdManager.RegisterFlagForCmd(&ociAnnotationFlag, createRunCmd...)
 	cmdManager.RegisterFlagForCmd(&ociKillForceFlag, OciKillCmd)
 	cmdManager.RegisterFlagForCmd(&ociKillSignalFlag, OciKillCmd)
 	cmdManager.RegisterFlagForCmd(&ociKillTimeoutFlag, OciKillCmd)
 	cmdManager.RegisterFlagForCmd(&ociUpdateFromFileFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateCPUSharesFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateCPUPeriodFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateCPUQuotaFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateCpusetCpusFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateCpusetMemsFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateMemoryFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateMemoryReservationFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdateMemorySwapFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociUpdatePidsLimitFlag, OciUpdateCmd)
+	cmdManager.RegisterFlagForCmd(&ociEventsIntervalFlag, OciEventsCmd)
+	cmdManager.RegisterFlagForCmd(&ociEventsStatsFlag, OciEventsCmd)
 	cmdManager.RegisterFlagForCmd(&ociSyncSocketFlag, OciStateCmd)
 }
 
@@ -314,6 +438,22 @@ var OciUpdateCmd = &cobra.Command{
 	Example: docs.OciUpdateExample,
 }
 
+// OciEventsCmd represents oci events command.
+var OciEventsCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                EnsureRootPriv,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.OciEvents(args[0], &ociArgs); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+	Use:     docs.OciEventsUse,
+	Short:   docs.OciEventsShort,
+	Long:    docs.OciEventsLong,
+	Example: docs.OciEventsExample,
+}
+
 // OciPauseCmd represents oci pause command.
 var OciPauseCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
@@ -300,6 +300,8 @@ func pullRun(cmd *cobra.Command, args []string) {
 	default:
 		sylog.Fatalf("Unsupported transport type: %s", transport)
 	}
+
+	singularity.EnforceCachePolicy(imgCache)
 }
 
 func handlePullFlags(cmd *cobra.Command) {
@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"os"
 
+	ocitypes "github.com/containers/image/types"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/app/singularity"
+	ociclient "github.com/sylabs/singularity/internal/pkg/client/oci"
 	"github.com/sylabs/singularity/internal/pkg/oras"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
@@ -56,6 +58,9 @@ func init() {
 
 	cmdManager.RegisterFlagForCmd(&actionDockerUsernameFlag, PushCmd)
 	cmdManager.RegisterFlagForCmd(&actionDockerPasswordFlag, PushCmd)
+	cmdManager.RegisterFlagForCmd(&actionDockerLoginFlag, PushCmd)
+	cmdManager.RegisterFlagForCmd(&pullNoHTTPSFlag, PushCmd)
+	cmdManager.RegisterFlagForCmd(&pullTmpdirFlag, PushCmd)
 }
 
 // PushCmd singularity push
@@ -90,10 +95,25 @@ var PushCmd = &cobra.Command{
 				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
 			}
 
-			if err := oras.UploadImage(file, ref, ociAuth); err != nil {
+			if err := oras.UploadImage(file, ref, ociAuth, &oras.Options{Progress: &oras.ProgressBar{}}); err != nil {
 				sylog.Fatalf("Unable to push image to oci registry: %v", err)
 			}
 			sylog.Infof("Upload complete")
+		case ociclient.IsSupported(transport):
+			ociAuth, err := makeDockerCredentials(cmd)
+			if err != nil {
+				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
+			}
+
+			sysCtx := &ocitypes.SystemContext{
+				OCIInsecureSkipTLSVerify:    noHTTPS,
+				DockerInsecureSkipTLSVerify: noHTTPS,
+				DockerAuthConfig:            ociAuth,
+			}
+			if err := singularity.OCIPush(file, dest, tmpDir, sysCtx); err != nil {
+				sylog.Fatalf("Unable to push image as OCI image: %v", err)
+			}
+			sylog.Infof("Upload complete")
 		default:
 			sylog.Fatalf("Unsupported transport type: %s", transport)
 		}
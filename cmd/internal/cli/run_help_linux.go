@@ -10,23 +10,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
-	"github.com/sylabs/singularity/internal/pkg/buildcfg"
-	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
-	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/runhelp"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
-	"github.com/sylabs/singularity/internal/pkg/util/exec"
 	"github.com/sylabs/singularity/pkg/cmdline"
-	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
-)
-
-const (
-	standardHelpPath = "/.singularity.d/runscript.help"
-	appHelpPath      = "/scif/apps/%s/scif/runscript.help"
-	runHelpCommand   = "if [ ! -f \"%s\" ]\nthen\n    echo \"No help sections were defined for this image\"\nelse\n    /bin/cat %s\nfi"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // --app
@@ -39,10 +30,24 @@ var runHelpAppNameFlag = cmdline.Flag{
 	EnvKeys:      []string{"APP"},
 }
 
+var runHelpJSON bool
+
+// -j|--json
+var runHelpJSONFlag = cmdline.Flag{
+	ID:           "runHelpJSONFlag",
+	Value:        &runHelpJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the raw help text, its sections and the declared arguments as JSON",
+	EnvKeys:      []string{"JSON"},
+}
+
 func init() {
 	cmdManager.RegisterCmd(RunHelpCmd)
 
 	cmdManager.RegisterFlagForCmd(&runHelpAppNameFlag, RunHelpCmd)
+	cmdManager.RegisterFlagForCmd(&runHelpJSONFlag, RunHelpCmd)
 }
 
 // RunHelpCmd singularity run-help <image>
@@ -63,33 +68,53 @@ var RunHelpCmd = &cobra.Command{
 		}
 		name := filepath.Base(abspath)
 
-		a := []string{"/bin/sh", "-c", getCommand(getHelpPath(cmd))}
-		starter := buildcfg.LIBEXECDIR + "/singularity/bin/starter-suid"
-		procname := "Singularity help"
-		Env := []string{sylog.GetEnvVar()}
+		appName := ""
+		if cmd.Flags().Changed("app") {
+			sylog.Debugf("App specified. Looking for help section of %s", AppName)
+			appName = AppName
+		}
 
-		engineConfig := singularityConfig.NewConfig()
-		ociConfig := &oci.Config{}
-		generator := generate.Generator{Config: &ociConfig.Spec}
-		engineConfig.OciConfig = ociConfig
+		a := []string{"/bin/sh", "-c", getRunHelpCommand(appName)}
 
-		generator.SetProcessArgs(a)
-		generator.SetProcessCwd("/")
-		engineConfig.SetImage(abspath)
+		content, err := getFileContent(abspath, name, a)
+		if err != nil {
+			sylog.Fatalf("Could not read help: %v", err)
+		}
 
-		cfg := &config.Common{
-			EngineName:   singularityConfig.Name,
-			ContainerID:  name,
-			EngineConfig: engineConfig,
+		var text, arguments string
+		readSections(content, func(label, data string) {
+			switch label {
+			case "helpfile":
+				text = data
+			case "arguments":
+				arguments = data
+			}
+		})
+
+		help := runhelp.New(text, arguments)
+		help.App = appName
+
+		if runHelpJSON {
+			b, err := json.MarshalIndent(help, "", "\t")
+			if err != nil {
+				sylog.Fatalf("Could not format help as JSON: %s", err)
+			}
+			fmt.Println(string(b))
+			return
 		}
 
-		configData, err := json.Marshal(cfg)
-		if err != nil {
-			sylog.Fatalf("CLI Failed to marshal CommonEngineConfig: %s\n", err)
+		if text == "" && len(help.Arguments) == 0 {
+			fmt.Println("No help sections were defined for this image")
+			return
 		}
 
-		if err := exec.Pipe(starter, []string{procname}, Env, configData); err != nil {
-			sylog.Fatalf("%s", err)
+		if !nocolor && terminal.IsTerminal(int(os.Stdout.Fd())) {
+			err = help.Render(os.Stdout)
+		} else {
+			err = help.Write(os.Stdout)
+		}
+		if err != nil {
+			sylog.Fatalf("While displaying help: %s", err)
 		}
 	},
 
@@ -99,15 +124,14 @@ var RunHelpCmd = &cobra.Command{
 	Example: docs.RunHelpExample,
 }
 
-func getCommand(helpFile string) string {
-	return fmt.Sprintf(runHelpCommand, helpFile, helpFile)
-}
-
-func getHelpPath(cmd *cobra.Command) string {
-	if cmd.Flags().Changed("app") {
-		sylog.Debugf("App specified. Looking for help section of %s", AppName)
-		return fmt.Sprintf(appHelpPath, AppName)
+// getRunHelpCommand returns the command reading the help text and the
+// declared arguments of the container or of appName.
+func getRunHelpCommand(appName string) string {
+	var str strings.Builder
+	if appName != "" {
+		str.WriteString(getAppCheck(appName))
 	}
-
-	return standardHelpPath
+	str.WriteString(getHelpCommand(appName))
+	str.WriteString(getSingleFileCommand("runscript.args", "arguments", appName))
+	return str.String()
 }
@@ -0,0 +1,32 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+)
+
+func init() {
+	cmdManager.RegisterCmd(securityCmd)
+	cmdManager.RegisterSubCmd(securityCmd, securitySeccompGenCmd)
+}
+
+// singularity security
+var securityCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.SecurityUse,
+	Short:         docs.SecurityShort,
+	Long:          docs.SecurityLong,
+	Example:       docs.SecurityExample,
+	SilenceErrors: true,
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+func init() {
+	cmdManager.RegisterFlagForCmd(&seccompGenOutputFlag, securitySeccompGenCmd)
+	cmdManager.RegisterFlagForCmd(&seccompGenTemplateFlag, securitySeccompGenCmd)
+	cmdManager.RegisterFlagForCmd(&seccompGenAllowFlag, securitySeccompGenCmd)
+	cmdManager.RegisterFlagForCmd(&seccompGenDenyFlag, securitySeccompGenCmd)
+
+	// options following the image are passed to the command
+	securitySeccompGenCmd.Flags().SetInterspersed(false)
+}
+
+// -o|--output
+var seccompGenOutput string
+var seccompGenOutputFlag = cmdline.Flag{
+	ID:           "seccompGenOutputFlag",
+	Value:        &seccompGenOutput,
+	DefaultValue: "",
+	Name:         "output",
+	ShortHand:    "o",
+	Usage:        "write the seccomp profile to file instead of standard output",
+	Tag:          "<file>",
+}
+
+// --template
+var seccompGenTemplate string
+var seccompGenTemplateFlag = cmdline.Flag{
+	ID:           "seccompGenTemplateFlag",
+	Value:        &seccompGenTemplate,
+	DefaultValue: "",
+	Name:         "template",
+	Usage:        "OCI seccomp profile used as template, by default all system calls return an error",
+	Tag:          "<file>",
+}
+
+// --allow
+var seccompGenAllow []string
+var seccompGenAllowFlag = cmdline.Flag{
+	ID:           "seccompGenAllowFlag",
+	Value:        &seccompGenAllow,
+	DefaultValue: []string{},
+	Name:         "allow",
+	Usage:        "comma separated list of system calls to allow",
+	Tag:          "<syscalls>",
+}
+
+// --deny
+var seccompGenDeny []string
+var seccompGenDenyFlag = cmdline.Flag{
+	ID:           "seccompGenDenyFlag",
+	Value:        &seccompGenDeny,
+	DefaultValue: []string{},
+	Name:         "deny",
+	Usage:        "comma separated list of system calls returning an error, takes precedence over allowed system calls",
+	Tag:          "<syscalls>",
+}
+
+// singularity security seccomp-gen
+var securitySeccompGenCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := singularity.SeccompGenConfig{
+			Template: seccompGenTemplate,
+			Allow:    seccompGenAllow,
+			Deny:     seccompGenDeny,
+		}
+		if len(args) > 0 {
+			if len(args) == 1 {
+				sylog.Fatalf("No command to record for image %s", args[0])
+			}
+			config.Image = args[0]
+			config.Args = args[1:]
+		}
+
+		var w io.Writer = os.Stdout
+		if seccompGenOutput != "" {
+			f, err := os.OpenFile(seccompGenOutput, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+			if err != nil {
+				sylog.Fatalf("Could not create %s: %s", seccompGenOutput, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		code, err := singularity.GenerateSeccompProfile(w, config)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+	},
+
+	Use:     docs.SecuritySeccompGenUse,
+	Short:   docs.SecuritySeccompGenShort,
+	Long:    docs.SecuritySeccompGenLong,
+	Example: docs.SecuritySeccompGenExample,
+}
@@ -17,7 +17,8 @@ import (
 )
 
 var (
-	privKey int // -k encryption key (index from 'keys list') specification
+	privKey int    // -k encryption key (index from 'keys list') specification
+	keyURI  string // --key-uri key provider URI
 )
 
 // -u|--url
@@ -61,6 +62,16 @@ var signKeyIdxFlag = cmdline.Flag{
 	Usage:        "private key to use (index from 'keys list')",
 }
 
+// --key-uri
+var signKeyURIFlag = cmdline.Flag{
+	ID:           "signKeyURIFlag",
+	Value:        &keyURI,
+	DefaultValue: "",
+	Name:         "key-uri",
+	Usage:        "sign with a key held by a key provider (pkcs11:, kms: or agent: URI)",
+	EnvKeys:      []string{"SIGN_KEY_URI"},
+}
+
 func init() {
 	cmdManager.RegisterCmd(SignCmd)
 
@@ -68,6 +79,7 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&signSifGroupIDFlag, SignCmd)
 	cmdManager.RegisterFlagForCmd(&signSifDescIDFlag, SignCmd)
 	cmdManager.RegisterFlagForCmd(&signKeyIdxFlag, SignCmd)
+	cmdManager.RegisterFlagForCmd(&signKeyURIFlag, SignCmd)
 }
 
 // SignCmd singularity sign
@@ -106,5 +118,12 @@ func doSignCmd(cpath, url string) error {
 		id = sifDescID
 	}
 
+	if keyURI != "" {
+		if privKey != -1 {
+			return fmt.Errorf("only one of -k or --key-uri may be set")
+		}
+		return signing.SignWithProvider(cpath, id, isGroup, keyURI)
+	}
+
 	return signing.Sign(cpath, id, isGroup, privKey)
 }
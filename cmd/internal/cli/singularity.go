@@ -22,6 +22,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/cmdline"
 	"github.com/sylabs/singularity/pkg/syfs"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 var cmdManager = cmdline.NewCommandManager(SingularityCmd)
@@ -55,6 +56,7 @@ var (
 	silent  bool
 	verbose bool
 	quiet   bool
+	jsonErr bool
 )
 
 // -d|--debug
@@ -106,6 +108,16 @@ var singVerboseFlag = cmdline.Flag{
 	Usage:        "print additional information",
 }
 
+// --json
+var singJSONFlag = cmdline.Flag{
+	ID:           "singJSONFlag",
+	Value:        &jsonErr,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print errors as JSON objects carrying a stable error code",
+	EnvKeys:      []string{"JSON_ERRORS"},
+}
+
 var singTokenFileFlag = cmdline.Flag{
 	ID:           "singTokenFileFlag",
 	Value:        &tokenFile,
@@ -157,6 +169,7 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&singSilentFlag, SingularityCmd)
 	cmdManager.RegisterFlagForCmd(&singQuietFlag, SingularityCmd)
 	cmdManager.RegisterFlagForCmd(&singVerboseFlag, SingularityCmd)
+	cmdManager.RegisterFlagForCmd(&singJSONFlag, SingularityCmd)
 	cmdManager.RegisterFlagForCmd(&singTokenFileFlag, SingularityCmd)
 
 	cmdManager.RegisterCmd(VersionCmd)
@@ -189,6 +202,18 @@ func setSylogColor() {
 	}
 }
 
+// setErrorFormat enables JSON error reporting if requested globally
+// or by the --json flag of the executed command and returns true if
+// JSON error reporting is enabled
+func setErrorFormat(cmd *cobra.Command) bool {
+	enabled := jsonErr
+	if f := cmd.Flags().Lookup("json"); f != nil && f.Value.String() == "true" {
+		enabled = true
+	}
+	errcode.SetJSON(enabled)
+	return enabled
+}
+
 // createConfDir tries to create the user's configuration directory and handles
 // messages and/or errors
 func createConfDir(d string) {
@@ -223,6 +248,7 @@ var SingularityCmd = &cobra.Command{
 func persistentPreRunE(cmd *cobra.Command, _ []string) error {
 	setSylogMessageLevel()
 	setSylogColor()
+	setErrorFormat(cmd)
 	createConfDir(syfs.ConfigDir())
 	return cmdManager.UpdateCmdFlagFromEnv(cmd, envPrefix)
 }
@@ -245,6 +271,19 @@ func ExecuteSingularity() {
 
 	if cmd, err := SingularityCmd.ExecuteC(); err != nil {
 		name := cmd.Name()
+		// usage errors and errors without error code keep exit code 1
+		exitCode := 1
+		if code := errcode.CodeOf(err); code != errcode.Unknown {
+			exitCode = code.ExitCode()
+		}
+		if setErrorFormat(cmd) {
+			switch err.(type) {
+			case cmdline.FlagError, cmdline.CommandError:
+				err = errcode.Wrap(errcode.InvalidArgument, err, "")
+			}
+			errcode.WriteJSON(os.Stderr, err)
+			os.Exit(exitCode)
+		}
 		switch err.(type) {
 		case cmdline.FlagError:
 			usage := cmd.Flags().FlagUsagesWrapped(getColumns())
@@ -258,7 +297,7 @@ func ExecuteSingularity() {
 		}
 		SingularityCmd.Printf("Run '%s --help' for more detailed usage information.\n",
 			cmd.CommandPath())
-		os.Exit(1)
+		os.Exit(exitCode)
 	}
 }
 
@@ -0,0 +1,126 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/slurm"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+var (
+	slurmGenOutput    string
+	slurmGenPlugstack bool
+	slurmGenArgs      []string
+)
+
+// -o|--output
+var slurmGenOutputFlag = cmdline.Flag{
+	ID:           "slurmGenOutputFlag",
+	Value:        &slurmGenOutput,
+	DefaultValue: "",
+	Name:         "output",
+	ShortHand:    "o",
+	Usage:        "write the wrapper script to file instead of standard output",
+}
+
+// --plugstack
+var slurmGenPlugstackFlag = cmdline.Flag{
+	ID:           "slurmGenPlugstackFlag",
+	Value:        &slurmGenPlugstack,
+	DefaultValue: false,
+	Name:         "plugstack",
+	Usage:        "print the plugstack.conf line enabling the SPANK plugin, with image as default image",
+}
+
+// --args
+var slurmGenArgsFlag = cmdline.Flag{
+	ID:           "slurmGenArgsFlag",
+	Value:        &slurmGenArgs,
+	DefaultValue: []string{},
+	Name:         "args",
+	Usage:        "a comma separated list of options passed to the action command (eg: --args --nv,--contain)",
+}
+
+func init() {
+	cmdManager.RegisterCmd(SlurmCmd)
+	cmdManager.RegisterSubCmd(SlurmCmd, SlurmGenCmd)
+
+	cmdManager.RegisterFlagForCmd(&slurmGenOutputFlag, SlurmGenCmd)
+	cmdManager.RegisterFlagForCmd(&slurmGenPlugstackFlag, SlurmGenCmd)
+	cmdManager.RegisterFlagForCmd(&slurmGenArgsFlag, SlurmGenCmd)
+}
+
+// SlurmCmd singularity slurm
+var SlurmCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.SlurmUse,
+	Short:         docs.SlurmShort,
+	Long:          docs.SlurmLong,
+	Example:       docs.SlurmExample,
+	SilenceErrors: true,
+}
+
+// SlurmGenCmd singularity slurm gen
+var SlurmGenCmd = &cobra.Command{
+	Args: func(cmd *cobra.Command, args []string) error {
+		if slurmGenPlugstack {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		singularityBin := filepath.Join(buildcfg.BINDIR, "singularity")
+
+		if slurmGenPlugstack {
+			line := slurm.PlugstackLine(filepath.Join(buildcfg.LIBDIR, "slurm", "singularity.so"), singularityBin)
+			if len(args) == 1 {
+				line += " default_image=" + args[0]
+			}
+			fmt.Println(line)
+			return
+		}
+
+		var w io.Writer = os.Stdout
+		if slurmGenOutput != "" {
+			f, err := os.OpenFile(slurmGenOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+			if err != nil {
+				sylog.Fatalf("Unable to create %s: %s", slurmGenOutput, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		opts := slurm.WrapperOptions{
+			Singularity: singularityBin,
+			Image:       args[0],
+			Command:     args[1:],
+			Args:        slurmGenArgs,
+		}
+		if err := slurm.WriteWrapper(w, opts); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+
+	Use:     docs.SlurmGenUse,
+	Short:   docs.SlurmGenShort,
+	Long:    docs.SlurmGenLong,
+	Example: docs.SlurmGenExample,
+}
@@ -0,0 +1,17 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux,!darwin
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+func getHypervisorArgs(sifImage, bzImage, initramfs, singAction, cliExtra string) []string {
+	sylog.Fatalf("Virtual machines are not supported on this platform")
+	return nil
+}
@@ -11,10 +11,14 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/sypgp"
 )
 
 var (
@@ -22,6 +26,7 @@ var (
 	sifDescID   uint32 // -i id specification
 	localVerify bool   // -l flag
 	jsonVerify  bool   // -j flag
+	keyBundle   string // --key-bundle flag
 )
 
 // -u|--url
@@ -76,6 +81,26 @@ var verifyJSONFlag = cmdline.Flag{
 	Usage:        "output json",
 }
 
+// --key-bundle
+var verifyKeyBundleFlag = cmdline.Flag{
+	ID:           "verifyKeyBundleFlag",
+	Value:        &keyBundle,
+	DefaultValue: "",
+	Name:         "key-bundle",
+	Usage:        "only verify with the keys of a bundle exported with 'key export-bundle'",
+	EnvKeys:      []string{"KEY_BUNDLE"},
+}
+
+// --key-uri
+var verifyKeyURIFlag = cmdline.Flag{
+	ID:           "verifyKeyURIFlag",
+	Value:        &keyURI,
+	DefaultValue: "",
+	Name:         "key-uri",
+	Usage:        "only verify with the public key of a key provider (pkcs11:, kms: or agent: URI)",
+	EnvKeys:      []string{"VERIFY_KEY_URI"},
+}
+
 func init() {
 	cmdManager.RegisterCmd(VerifyCmd)
 
@@ -84,6 +109,8 @@ func init() {
 	cmdManager.RegisterFlagForCmd(&verifySifDescIDFlag, VerifyCmd)
 	cmdManager.RegisterFlagForCmd(&verifyLocalFlag, VerifyCmd)
 	cmdManager.RegisterFlagForCmd(&verifyJSONFlag, VerifyCmd)
+	cmdManager.RegisterFlagForCmd(&verifyKeyBundleFlag, VerifyCmd)
+	cmdManager.RegisterFlagForCmd(&verifyKeyURIFlag, VerifyCmd)
 }
 
 // VerifyCmd singularity verify
@@ -99,6 +126,18 @@ var VerifyCmd = &cobra.Command{
 			sylog.Fatalf("File is a directory: %s", args[0])
 		}
 
+		if keyBundle != "" && keyURI != "" {
+			sylog.Fatalf("only one of --key-bundle or --key-uri may be set")
+		}
+		if keyBundle != "" {
+			doVerifyBundleCmd(args[0], keyBundle)
+			return
+		}
+		if keyURI != "" {
+			doVerifyProviderCmd(args[0], keyURI)
+			return
+		}
+
 		// dont need to resolve remote endpoint
 		if !localVerify {
 			handleVerifyFlags(cmd)
@@ -115,17 +154,14 @@ var VerifyCmd = &cobra.Command{
 }
 
 func doVerifyCmd(cpath, url string) {
-	if sifGroupID != 0 && sifDescID != 0 {
-		sylog.Fatalf("only one of -i or -g may be set")
-	}
+	isGroup, id := verifySelection()
 
-	var isGroup bool
-	var id uint32
-	if sifGroupID != 0 {
-		isGroup = true
-		id = sifGroupID
-	} else {
-		id = sifDescID
+	// key groups are used through the local keyring, refresh
+	// those whose refresh interval elapsed
+	if !localVerify {
+		if err := sypgp.NewHandle("").RefreshGroups(url, authToken); err != nil {
+			sylog.Warningf("Unable to refresh key groups, verifying with the current group keys: %s", err)
+		}
 	}
 
 	author, _, err := signing.Verify(cpath, url, id, isGroup, authToken, localVerify, jsonVerify)
@@ -138,6 +174,56 @@ func doVerifyCmd(cpath, url string) {
 	sylog.Infof("Container verified: %s", cpath)
 }
 
+func doVerifyBundleCmd(cpath, path string) {
+	isGroup, id := verifySelection()
+
+	c := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SINGULARITY_CONF_FILE, c); err != nil {
+		sylog.Fatalf("Unable to parse singularity.conf file: %s", err)
+	}
+
+	bundle, err := sypgp.NewHandle("").LoadBundle(path, c.KeyBundleSigner)
+	if err != nil {
+		sylog.Fatalf("Failed to load key bundle: %s", err)
+	}
+	sylog.Verbosef("Using key bundle version %d created %s with %d key(s), signed by %X",
+		bundle.Version, bundle.Created, len(bundle.Keys), bundle.Signer.PrimaryKey.Fingerprint)
+
+	author, err := signing.VerifyBundle(cpath, id, isGroup, bundle, jsonVerify)
+	fmt.Printf("%s", author)
+	if err == signing.ErrVerificationFail {
+		sylog.Fatalf("Failed to verify: %s", cpath)
+	} else if err != nil {
+		sylog.Fatalf("Failed to verify: %s: %s", cpath, err)
+	}
+	sylog.Infof("Container verified with key bundle version %d: %s", bundle.Version, cpath)
+}
+
+func doVerifyProviderCmd(cpath, uri string) {
+	isGroup, id := verifySelection()
+
+	author, err := signing.VerifyWithProvider(cpath, id, isGroup, uri, jsonVerify)
+	fmt.Printf("%s", author)
+	if err == signing.ErrVerificationFail {
+		sylog.Fatalf("Failed to verify: %s", cpath)
+	} else if err != nil {
+		sylog.Fatalf("Failed to verify: %s: %s", cpath, err)
+	}
+	sylog.Infof("Container verified with key provider key: %s", cpath)
+}
+
+// verifySelection returns the descriptor or group ID selected
+// with -i or -g.
+func verifySelection() (bool, uint32) {
+	if sifGroupID != 0 && sifDescID != 0 {
+		sylog.Fatalf("only one of -i or -g may be set")
+	}
+	if sifGroupID != 0 {
+		return true, sifGroupID
+	}
+	return false, sifDescID
+}
+
 func handleVerifyFlags(cmd *cobra.Command) {
 	// if we can load config and if default endpoint is set, use that
 	// otherwise fall back on regular authtoken and URI behavior
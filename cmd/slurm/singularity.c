@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2019, Sylabs Inc. All rights reserved.
+ * This software is licensed under a 3-clause BSD license. Please consult the
+ * LICENSE.md file distributed with the sources of this project regarding your
+ * rights to use or distribute this software.
+ *
+ * SPANK plugin executing Slurm job step tasks within a Singularity container.
+ * Tasks are re-executed through `singularity exec` from the task context right
+ * before Slurm executes the user command, so the container processes remain
+ * in the job cgroup and inherit the job environment.
+ */
+
+#define _GNU_SOURCE 1
+
+#include <errno.h>
+#include <limits.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+
+#include <slurm/spank.h>
+
+SPANK_PLUGIN(singularity, 1);
+
+#ifndef SINGULARITY_BIN
+#define SINGULARITY_BIN "/usr/local/bin/singularity"
+#endif
+
+#define ENV_PREFIX "SINGULARITYENV_"
+
+static char *job_image = NULL;
+static char *job_bindpath = NULL;
+static char *singularity = NULL;
+
+static int set_image(int val, const char *optarg, int remote) {
+    free(job_image);
+    job_image = strdup(optarg);
+    return job_image == NULL ? -1 : 0;
+}
+
+static int set_bind(int val, const char *optarg, int remote) {
+    free(job_bindpath);
+    job_bindpath = strdup(optarg);
+    return job_bindpath == NULL ? -1 : 0;
+}
+
+struct spank_option spank_options[] = {
+    {
+        "singularity-image",
+        "[image]",
+        "Run job step tasks in the Singularity container image",
+        1, 0, (spank_opt_cb_f) set_image
+    },
+    {
+        "singularity-bind",
+        "[path || src:dest],...",
+        "Bind paths in the Singularity container",
+        1, 0, (spank_opt_cb_f) set_bind
+    },
+    SPANK_OPTIONS_TABLE_END
+};
+
+/*
+ * import_slurm_env exports Slurm environment variables of the job with the
+ * SINGULARITYENV_ prefix, so they are set in the container even with
+ * --cleanenv, variables already set by the user are not overridden.
+ */
+static int import_slurm_env(spank_t spank, char **env) {
+    char name[PATH_MAX];
+    int i;
+
+    for ( i = 0; env[i] != NULL; i++ ) {
+        char *value = strchr(env[i], '=');
+        size_t len;
+
+        if ( strncmp(env[i], "SLURM_", 6) != 0 || value == NULL ) {
+            continue;
+        }
+        len = value - env[i];
+        if ( len + sizeof(ENV_PREFIX) > sizeof(name) ) {
+            continue;
+        }
+        memcpy(name, ENV_PREFIX, sizeof(ENV_PREFIX) - 1);
+        memcpy(name + sizeof(ENV_PREFIX) - 1, env[i], len);
+        name[len + sizeof(ENV_PREFIX) - 1] = '\0';
+
+        if ( spank_setenv(spank, name, value + 1, 0) != ESPANK_SUCCESS && errno != EEXIST ) {
+            slurm_debug("spank/%s: failed to set %s", plugin_name, name);
+        }
+    }
+    return 0;
+}
+
+/*
+ * job_tmpdir returns the job temporary directory mapped on /tmp in the
+ * container, or NULL if the job doesn't have a dedicated one.
+ */
+static char *job_tmpdir(spank_t spank) {
+    static char tmpdir[PATH_MAX];
+    const char *names[] = { "SLURM_JOB_TMPDIR", "SLURM_TMPDIR", "TMPDIR", NULL };
+    int i;
+
+    for ( i = 0; names[i] != NULL; i++ ) {
+        if ( spank_getenv(spank, names[i], tmpdir, sizeof(tmpdir)) != ESPANK_SUCCESS ) {
+            continue;
+        }
+        if ( tmpdir[0] != '\0' && strcmp(tmpdir, "/tmp") != 0 && access(tmpdir, F_OK) == 0 ) {
+            return tmpdir;
+        }
+    }
+    return NULL;
+}
+
+int slurm_spank_init(spank_t spank, int ac, char **av) {
+    int i;
+
+    for ( i = 0; i < ac; i++ ) {
+        if ( strncmp("default_image=", av[i], 14) == 0 ) {
+            free(job_image);
+            job_image = strdup(av[i] + 14);
+        } else if ( strncmp("singularity=", av[i], 12) == 0 ) {
+            free(singularity);
+            singularity = strdup(av[i] + 12);
+        } else {
+            slurm_error("spank/%s: invalid option: %s", plugin_name, av[i]);
+        }
+    }
+    return 0;
+}
+
+int slurm_spank_task_init(spank_t spank, int ac, char **av) {
+    char bindpath[PATH_MAX * 2];
+    char **job_argv = NULL;
+    char **job_env = NULL;
+    char **argv = NULL;
+    char *tmpdir;
+    int job_argc = 0;
+    int argc = 0;
+    int i;
+
+    if ( job_image == NULL || spank_remote(spank) != 1 ) {
+        return 0;
+    }
+    if ( singularity == NULL ) {
+        singularity = SINGULARITY_BIN;
+    }
+
+    if ( spank_get_item(spank, S_JOB_ARGV, &job_argc, &job_argv) != ESPANK_SUCCESS ) {
+        slurm_error("spank/%s: failed to get job command line", plugin_name);
+        return -1;
+    }
+    if ( spank_get_item(spank, S_JOB_ENV, &job_env) != ESPANK_SUCCESS ) {
+        slurm_error("spank/%s: failed to get job environment", plugin_name);
+        return -1;
+    }
+
+    import_slurm_env(spank, job_env);
+
+    bindpath[0] = '\0';
+    if ( job_bindpath != NULL ) {
+        snprintf(bindpath, sizeof(bindpath), "%s", job_bindpath); // Flawfinder: ignore
+    }
+    if ( (tmpdir = job_tmpdir(spank)) != NULL ) {
+        size_t len = strlen(bindpath);
+        snprintf(bindpath + len, sizeof(bindpath) - len, "%s%s:/tmp", len ? "," : "", tmpdir); // Flawfinder: ignore
+    }
+    if ( bindpath[0] != '\0' && spank_setenv(spank, "SINGULARITY_BINDPATH", bindpath, 1) != ESPANK_SUCCESS ) {
+        slurm_error("spank/%s: failed to set SINGULARITY_BINDPATH", plugin_name);
+        return -1;
+    }
+
+    /* environment may have been reallocated by spank_setenv */
+    if ( spank_get_item(spank, S_JOB_ENV, &job_env) != ESPANK_SUCCESS ) {
+        slurm_error("spank/%s: failed to get job environment", plugin_name);
+        return -1;
+    }
+
+    argv = calloc(job_argc + 4, sizeof(char *));
+    if ( argv == NULL ) {
+        slurm_error("spank/%s: failed to allocate memory", plugin_name);
+        return -1;
+    }
+    argv[argc++] = singularity;
+    argv[argc++] = "exec";
+    argv[argc++] = job_image;
+    for ( i = 0; i < job_argc; i++ ) {
+        argv[argc++] = job_argv[i];
+    }
+    argv[argc] = NULL;
+
+    slurm_verbose("spank/%s: executing task in %s", plugin_name, job_image);
+
+    execve(singularity, argv, job_env);
+
+    slurm_error("spank/%s: failed to execute %s: %s", plugin_name, singularity, strerror(errno));
+    free(argv);
+    return -1;
+}
+
+int slurm_spank_exit(spank_t spank, int ac, char **av) {
+    free(job_image);
+    free(job_bindpath);
+    job_image = NULL;
+    job_bindpath = NULL;
+    return 0;
+}
@@ -40,6 +40,8 @@ Enterprise Performance Computing (EPC)`
 
       default:    The compressed Singularity read only image format (default)
       sandbox:    This is a read-write container within a directory structure
+      oci:        A single layer OCI image stored with a tag in an OCI image
+                  layout directory, the IMAGE PATH is oci:<directory>[:<tag>]
 
   note: It is a common workflow to use the "sandbox" mode for development of the
   container, and then build it as a default Singularity image for production 
@@ -127,6 +129,11 @@ Enterprise Performance Computing (EPC)`
       %startscript
           echo "Define actions for container to perform when started as an instance."
 
+      %healthcheck --interval=30s --timeout=30s --start-period=0s --retries=3
+          echo "Define a check periodically executed in instances, a non-zero exit"
+          echo "code marks the instance unhealthy after the given number of retries."
+          exit 0
+
       %labels
           HELLO MOTO
           KEY VALUE
@@ -155,7 +162,10 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ singularity build --sandbox /tmp/debian docker://debian:latest
           $ singularity exec --writable /tmp/debian apt-get install python
-          $ singularity build /tmp/debian2.sif /tmp/debian`
+          $ singularity build /tmp/debian2.sif /tmp/debian
+
+      Build an OCI image tagged v1 in an OCI image layout directory:
+          $ singularity build oci:/tmp/layout:v1 /path/to/debian.def`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -204,6 +214,100 @@ Enterprise Performance Computing (EPC)`
   $ singularity help cache list --type=library,oci
   $ singularity cache list --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache GC
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheGcUse   string = `gc [gc options...]`
+	CacheGcShort string = `Enforce the cache policy on your local Singularity cache`
+	CacheGcLong  string = `
+  This will remove the images and build stages of your local cache which exceed
+  the cache policy set by the 'cache max size', 'cache max age' and 'cache
+  library/oci/shub max size' directives of singularity.conf. The least recently
+  used entries are removed first. The policy is also enforced automatically
+  after each pull and build, the OCI blob cache is only cleaned by 'cache clean'.`
+	CacheGcExample string = `
+  $ singularity cache gc --dry-run
+  $ singularity cache gc`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageUse   string = `image`
+	ImageShort string = `Manage the overlay partition of SIF images`
+	ImageLong  string = `
+  Manage the writable ext3 overlay partition embedded in a SIF image. An overlay
+  partition can be added to an existing image, grown, shrunk or resized in place
+  and its utilization reported, without extracting and rebuilding the image.
+  The overlay partition must not be in use by a running container. The e2fsprogs
+  tools (mkfs.ext3, e2fsck and resize2fs) are required.`
+	ImageExample string = `
+  All group commands have their own help output:
+
+  $ singularity help image grow
+  $ singularity image grow --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image add-overlay
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageAddOverlayUse   string = `add-overlay [add-overlay options...] <sif path>`
+	ImageAddOverlayShort string = `Add an overlay partition to a SIF image`
+	ImageAddOverlayLong  string = `
+  The add-overlay command creates an ext3 overlay partition of the given size in
+  MiB and adds it to the SIF image, the overlay is then used by the --writable
+  option of the action commands. The overlay directories are owned by the user
+  running the command.`
+	ImageAddOverlayExample string = `
+  $ singularity image add-overlay --size 1024 image.sif
+  $ singularity shell --writable image.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image grow
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageGrowUse   string = `grow [grow options...] <sif path>`
+	ImageGrowShort string = `Grow the overlay partition of a SIF image`
+	ImageGrowLong  string = `
+  The grow command increases the size of the overlay partition of a SIF image
+  by the given size in MiB.`
+	ImageGrowExample string = `
+  $ singularity image grow --size 512 image.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image shrink
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageShrinkUse   string = `shrink [shrink options...] <sif path>`
+	ImageShrinkShort string = `Shrink the overlay partition of a SIF image`
+	ImageShrinkLong  string = `
+  The shrink command checks the overlay partition of a SIF image and decreases
+  its size by the given size in MiB, or to the smallest size holding its content
+  if no size is given.`
+	ImageShrinkExample string = `
+  $ singularity image shrink --size 256 image.sif
+  $ singularity image shrink image.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image resize
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageResizeUse   string = `resize [resize options...] <sif path>`
+	ImageResizeShort string = `Resize the overlay partition of a SIF image`
+	ImageResizeLong  string = `
+  The resize command sets the size of the overlay partition of a SIF image to
+  the given size in MiB, the overlay is grown or shrunk as needed.`
+	ImageResizeExample string = `
+  $ singularity image resize --size 2048 image.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image usage
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageUsageUse   string = `usage [usage options...] <sif path>`
+	ImageUsageShort string = `Report the overlay partition utilization of a SIF image`
+	ImageUsageLong  string = `
+  The usage command reports the space and inodes used in the overlay partition
+  of a SIF image. The figures are the ones recorded by the filesystem when it
+  was last synced, they may be behind while a container is writing to it.`
+	ImageUsageExample string = `
+  $ singularity image usage image.sif
+  $ singularity image usage --json image.sif`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -246,7 +350,33 @@ Enterprise Performance Computing (EPC)`
 
   Exporting a public key:
   
-  $ singularity key export ./public.asc`
+  $ singularity key export ./public.asc
+
+  Exporting the public key of a key provider:
+
+  $ singularity key export --armor --key-uri kms:gcp/projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1 ./kms.asc`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key export-bundle
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyExportBundleUse   string = `export-bundle [export-bundle options...] <output-file>`
+	KeyExportBundleShort string = `Export trusted public keys into a signed key bundle`
+	KeyExportBundleLong  string = `
+  The 'key export-bundle' command exports the public keys of your local keyring
+  (or those selected with '--fingerprint') into a versioned key bundle, signed
+  with one of your private keys. The bundle can be distributed out-of-band to
+  air-gapped systems where images are verified with 'verify --key-bundle'
+  without any keyserver access. The public key of the bundle signer must be
+  imported on those systems with 'key import', and its fingerprint set by the
+  administrator with the "key bundle signer" directive of singularity.conf.
+  Increase the bundle version with each new bundle: bundles older than the
+  last one accepted from the same signer are refused.`
+	KeyExportBundleExample string = `
+  $ singularity key export-bundle --bundle-version 2 ./site-keys.bundle
+
+  Exporting two keys identified by their key ID:
+
+  $ singularity key export-bundle --fingerprint 8883491F4268F173 --fingerprint 2B6E3E3F1A6B1F0C ./site-keys.bundle`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key newpair
@@ -303,6 +433,52 @@ Enterprise Performance Computing (EPC)`
 	KeyPullExample string = `
   $ singularity key pull 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key subscribe
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeySubscribeUse   string = `subscribe [subscribe options...] <group>`
+	KeySubscribeShort string = `Subscribe your local keyring to a key group of a key server`
+	KeySubscribeLong  string = `
+  The 'key subscribe' command adds the public keys of a named group of a key
+  server to your local keyring. Group members are the keys having a user ID
+  with the group name as comment (e.g. "Jane Doe (bio-apps-maintainers)
+  <jane@example.com>") certified by the signer key. The signer key must
+  already be in your local keyring, imported or pulled by yourself, and is
+  given by its fingerprint with the required --signer option. Keys with the
+  group name as comment but without a valid certification of the signer key
+  are ignored. The group is refreshed by 'key sync' and, when the --refresh
+  interval is set, by 'verify' once the interval elapsed since the last
+  update. Keys dropped from the group are then removed from your local
+  keyring. Keys you imported or pulled yourself are never removed.`
+	KeySubscribeExample string = `
+  $ singularity key subscribe --signer 8883491F4268F173C6E5DC49EDECE4F3F38D871E bio-apps-maintainers
+  $ singularity key subscribe --refresh 24h --signer 8883491F4268F173C6E5DC49EDECE4F3F38D871E bio-apps-maintainers`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key unsubscribe
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyUnsubscribeUse   string = `unsubscribe <group>`
+	KeyUnsubscribeShort string = `Unsubscribe your local keyring from a key group`
+	KeyUnsubscribeLong  string = `
+  The 'key unsubscribe' command removes a key group subscription and the
+  public keys added by this group from your local keyring.`
+	KeyUnsubscribeExample string = `
+  $ singularity key unsubscribe bio-apps-maintainers`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key sync
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeySyncUse   string = `sync`
+	KeySyncShort string = `Refresh the key groups your local keyring is subscribed to`
+	KeySyncLong  string = `
+  The 'key sync' command fetches the members of all key groups your local
+  keyring is subscribed to, adds new members and removes keys dropped from
+  the groups. Only the groups subscribed with a --refresh interval are
+  refreshed by 'verify', once the interval elapsed, run this command to get
+  the updates of the other groups.`
+	KeySyncExample string = `
+  $ singularity key sync`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key push
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -459,6 +635,8 @@ Enterprise Performance Computing (EPC)`
   $ cat hello_world.py | singularity exec /tmp/debian.sif python
   $ sudo singularity exec --writable /tmp/debian.sif apt-get update
   $ singularity exec instance://my_instance ps -ef
+  $ singularity exec --join my_instance --join-ns net,pid /tmp/tools.sif tcpdump -i eth0
+  $ singularity exec --mount type=image,src=data.sif,dst=/data --mount type=tmpfs,dst=/scratch,tmpfs-size=1g /tmp/debian.sif ls /data
   $ singularity exec library://centos cat /etc/os-release`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -512,6 +690,27 @@ Enterprise Performance Computing (EPC)`
   will be executed with the instance start command as well. You can optionally
   pass arguments to startscript
 
+  With --boot, /sbin/init of the container is executed as the instance init
+  process. If the container doesn't provide /sbin/init, the built-in init runs
+  the startscript instead, it reaps zombie processes, forwards shutdown signals
+  to all processes of the instance and exits with the startscript exit status
+  once they are all gone.
+
+  With --restore, the instance process tree is restored from a directory
+  created by singularity instance checkpoint instead of running the
+  startscript, the container image must be the one the instance was
+  checkpointed from.
+
+  If the container defines a healthcheck, it's periodically executed in the
+  instance and its status is reported by instance list --json. With
+  --health-on-failure, the instance is restarted or signaled once unhealthy,
+  and --no-healthcheck disables the healthcheck.
+
+  With --log-format, the instance output and error streams are written as
+  timestamped lines to a structured log read by singularity instance logs.
+  The log is rotated once it reaches --log-max-size MiB, and --log-max-files
+  rotated files are kept.
+
   singularity instance start accepts the following container formats` + formats
 	InstanceStartExample string = `
   $ singularity instance start /tmp/my-sql.sif mysql
@@ -536,7 +735,10 @@ Enterprise Performance Computing (EPC)`
 	InstanceStopShort string = `Stop a named instance of a given container image`
 	InstanceStopLong  string = `
   The command singularity instance stop allows you to stop and clean up a named,
-  running instance of a given container image.`
+  running instance of a given container image.
+
+  By default SIGINT is sent to the instance, or SIGRTMIN+3 for instances booted
+  with systemd as init process.`
 	InstanceStopExample string = `
   $ singularity instance start my-sql.sif mysql1
   $ singularity instance start my-sql.sif mysql2
@@ -554,6 +756,88 @@ Enterprise Performance Computing (EPC)`
   $ singularity instance stop -s TERM mysql1
   $ singularity instance stop -s 15 mysql1`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance checkpoint
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceCheckpointUse   string = `checkpoint [checkpoint options...] <instance name> <checkpoint directory>`
+	InstanceCheckpointShort string = `Checkpoint a named instance to a directory`
+	InstanceCheckpointLong  string = `
+  The instance checkpoint command uses CRIU to dump the process tree,
+  namespaces and mount state of a running instance to a directory. The
+  instance is stopped once checkpointed unless --leave-running is set.
+
+  A checkpointed instance is restored from the same container image with
+  instance start --restore, possibly on another node providing the same
+  host paths bound into the instance. Checkpoint and restore require root
+  privileges and the criu program.`
+	InstanceCheckpointExample string = `
+  $ sudo singularity instance start my-sql.sif mysql
+  $ sudo singularity instance checkpoint mysql /var/tmp/mysql-checkpoint
+  $ sudo singularity instance start --restore /var/tmp/mysql-checkpoint my-sql.sif mysql
+
+  Checkpoint the instance and keep it running
+  $ sudo singularity instance checkpoint --leave-running mysql /var/tmp/mysql-checkpoint`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance ctl
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceCtlUse   string = `ctl [ctl options...] <instance name> <command> [args...]`
+	InstanceCtlShort string = `Control a named instance through its control socket`
+	InstanceCtlLong  string = `
+  The instance ctl command talks to the control socket served by the master
+  process of a running instance. Available commands are:
+
+  stats:  print memory and CPU usage and the number of processes, the
+          instance must have been started by root with --apply-cgroups
+  pause:  suspend all instance processes
+  resume: resume all instance processes
+  logs:   print the instance output log, or the error log with --stderr,
+          and keep reading it until the instance exits with --follow
+  exec:   execute a command in the instance and print its output`
+	InstanceCtlExample string = `
+  $ singularity instance start my-sql.sif mysql
+  $ singularity instance ctl mysql stats
+  $ singularity instance ctl mysql pause
+  $ singularity instance ctl mysql resume
+  $ singularity instance ctl --follow mysql logs
+  $ singularity instance ctl mysql exec ps -ef`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance logs
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceLogsUse   string = `logs [logs options...] <instance name>`
+	InstanceLogsShort string = `Print the structured log of a named instance`
+	InstanceLogsLong  string = `
+  The instance logs command prints the structured log written for instances
+  started with --log-format, including rotated log files. Output lines are
+  printed to standard output and error lines to standard error. With --follow,
+  the log is read until the instance exits.`
+	InstanceLogsExample string = `
+  $ singularity instance start --log-format json my-sql.sif mysql
+  $ singularity instance logs --tail 20 mysql
+  $ singularity instance logs --follow --timestamps mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance stats
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceStatsUse   string = `stats [stats options...] [<instance name glob>]`
+	InstanceStatsShort string = `Print the resource usage of running instances`
+	InstanceStatsLong  string = `
+  The instance stats command prints the CPU, memory, block I/O and process
+  accounting of the cgroup of instances started by root with --apply-cgroups,
+  and the network I/O of instances running in their own network namespace.
+  Unavailable statistics are printed as "-".
+
+  With --prometheus, statistics are printed in the Prometheus text format.
+  With --listen, they are served in the same format on /metrics of a unix
+  socket or a loopback host:port address so monitoring systems can scrape
+  them, instances started after the command are included.`
+	InstanceStatsExample string = `
+  $ sudo singularity instance start --apply-cgroups limits.toml --net my-sql.sif mysql
+  $ sudo singularity instance stats
+  $ sudo singularity instance stats --json mysql
+  $ sudo singularity instance stats --listen localhost:9323`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// pull
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -605,6 +889,14 @@ Enterprise Performance Computing (EPC)`
   oras:
       oras://registry/namespace/repo:tag
 
+  docker:
+      docker://registry/namespace/repo:tag
+
+  oci:
+      oci:/path/to/layout[:tag]
+
+  With docker and oci, the container root filesystem is pushed as a single
+  layer OCI image, the container runscript is the image command.
 
   NOTE: It's always good practice to sign your containers before
   pushing them to the library. An auth token is required to push to the library,
@@ -614,7 +906,11 @@ Enterprise Performance Computing (EPC)`
   $ singularity push /home/user/my.sif library://user/collection/my.sif:latest
 
   To supported OCI registry
-  $ singularity push /home/user/my.sif oras://registry/namespace/image:tag`
+  $ singularity push /home/user/my.sif oras://registry/namespace/image:tag
+
+  As an OCI image to a docker registry or an OCI image layout
+  $ singularity push /home/user/my.sif docker://registry/namespace/image:tag
+  $ singularity push /home/user/my.sif oci:/tmp/layout:tag`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// search
@@ -688,6 +984,46 @@ Enterprise Performance Computing (EPC)`
   ubuntu       2     0  0 20:01 pts/8    00:00:00 /bin/bash --norc
   ubuntu       3     2  0 20:02 pts/8    00:00:00 ps -ef`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// security
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SecurityUse   string = `security`
+	SecurityShort string = `Manage container security profiles`
+	SecurityLong  string = `
+  Security commands help to write the security profiles applied to containers
+  with the --security option.`
+	SecurityExample string = `
+  All group commands have their own help output:
+
+  $ singularity help security seccomp-gen
+  $ singularity security seccomp-gen --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// security seccomp-gen
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SecuritySeccompGenUse   string = `seccomp-gen [seccomp-gen options...] [<image path> <command> [args...]]`
+	SecuritySeccompGenShort string = `Generate an OCI seccomp profile`
+	SecuritySeccompGenLong  string = `
+  The security seccomp-gen command generates an OCI seccomp profile from a
+  template and lists of allowed and denied system calls. Without template, all
+  system calls not allowed return an error.
+
+  When a container image and a command are given, the command is executed in the
+  container with singularity exec and all system calls used by the container
+  processes are allowed. System calls are recorded by tracing the container
+  processes, unprivileged users must be able to run containers with --userns.
+  The command output is written to the standard error.
+
+  The generated profile is applied with --security seccomp:<profile>.`
+	SecuritySeccompGenExample string = `
+  Record system calls of a container command
+  $ singularity security seccomp-gen -o profile.json container.sif python3 app.py
+  $ singularity exec --security seccomp:profile.json container.sif python3 app.py
+
+  Allow all system calls except some from a template
+  $ echo '{"defaultAction": "SCMP_ACT_ALLOW"}' > allow.json
+  $ singularity security seccomp-gen --template allow.json --deny ptrace,mount`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// sign
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -699,9 +1035,23 @@ Enterprise Performance Computing (EPC)`
   default without parameters, the command searches for the primary partition and 
   creates a verification block that is then added to the SIF container file.
   
-  To generate a keypair, see 'singularity help key newpair'`
+  To generate a keypair, see 'singularity help key newpair'
+
+  With '--key-uri' the signature is made with a key that never leaves its key
+  provider instead of a key of the local keyring:
+
+    pkcs11:<attributes>?module-path=<lib>  key stored in a PKCS#11 token (HSM)
+    kms:<helper>/<key id>                  key held by a cloud KMS, through the
+                                           singularity-kms-<helper> program
+    agent:<socket path>[#<key id>]         key held by a signing agent
+
+  The key provider is recorded in the signature, without the PKCS#11 module path
+  and PIN. Its public key is exported with 'key export --key-uri' to verify the
+  signatures on systems without access to the key provider.`
 	SignExample string = `
-  $ singularity sign container.sif`
+  $ singularity sign container.sif
+  $ singularity sign --key-uri 'pkcs11:token=hsm;object=signing?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=file:/run/pin' container.sif
+  $ singularity sign --key-uri kms:gcp/projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1 container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// verify
@@ -714,9 +1064,22 @@ Enterprise Performance Computing (EPC)`
   multiple data objects signed. By default the command searches for the primary 
   partition signature. If found, a list of all verification blocks applied on 
   the primary partition is gathered so that data integrity (hashing) and 
-  signature verification is done for all those blocks.`
+  signature verification is done for all those blocks.
+
+  With '--key-bundle' signers are only looked up in a key bundle exported with
+  'key export-bundle', neither the local keyring nor a keyserver are used. The
+  bundle must be signed by a key of your local keyring listed by the "key
+  bundle signer" directive of singularity.conf, and must not be older than
+  the last bundle accepted from this signer.
+
+  With '--key-uri' signatures are only checked against the public key of a key
+  provider, see 'singularity help sign' for the supported key URIs. Without
+  access to the key provider, import its public key exported with
+  'key export --key-uri' and verify with your local keyring or a key bundle.`
 	VerifyExample string = `
-  $ singularity verify container.sif`
+  $ singularity verify container.sif
+  $ singularity verify --key-bundle ./site-keys.bundle container.sif
+  $ singularity verify --key-uri agent:/run/user/1000/sign-agent.sock container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Run-help
@@ -726,15 +1089,30 @@ Enterprise Performance Computing (EPC)`
 	RunHelpLong  string = `
   The help text is from the '%help' section of the definition file. If you are 
   using the '--apps' option, the help text is instead from that app's '%apphelp' 
-  section.`
+  section.
+
+  The help text may be written in markdown, headings, lists, code blocks, bold
+  and inline code are rendered when the output is a terminal. Arguments of the
+  runscript declared in the '%arguments' (or '%apparguments') section, one per
+  line with their name followed by a description, are listed after the help
+  text. Optional arguments are enclosed in brackets and arguments accepting
+  multiple values end with '...'.
+
+  With '--json' the raw help text, its sections and the declared arguments are
+  printed as JSON for use by other programs.`
 	RunHelpExample string = `
   $ cat my_container.def
   Bootstrap: docker
   From: busybox
 
   %help
+      # Usage
       Some help for this container
 
+  %arguments
+      input      input file
+      [output]   output file
+
   %apphelp foo
       Some help for application 'foo' in this container
 
@@ -745,11 +1123,18 @@ Enterprise Performance Computing (EPC)`
 
   $ singularity run-help my_container.sif
 
+    USAGE
     Some help for this container
 
+    Arguments
+        input     input file
+        [output]  output file
+
   $ singularity run-help --app foo my_container.sif
 
-    Some help for application in this container`
+    Some help for application in this container
+
+  $ singularity run-help --json my_container.sif`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Inspect
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -825,6 +1210,13 @@ Enterprise Performance Computing (EPC)`
       namespaces. This means that the --writable and --contain options will not 
       be honored as the namespaces have already been configured by the 
       'singularity start' command.
+
+  The --isolated option runs the test in new PID, IPC and network namespaces,
+  the network namespace only has a loopback interface. The --timeout option
+  terminates the test if it doesn't complete in time, the command then exits
+  with code 124. The --json option prints the test exit code, duration and
+  output as JSON for continuous integration pipelines, the command still exits
+  with the test exit code.
 `
 	RunTestExample string = `
   Set the '%test' section with a definition file like so:
@@ -834,6 +1226,8 @@ Enterprise Performance Computing (EPC)`
   $ singularity test /tmp/debian.sif command
       hello from test command
 
+  $ singularity test --isolated --timeout 300 --json /tmp/debian.sif
+
   For additional help, please visit our public documentation pages which are
   found at:
 
@@ -858,9 +1252,15 @@ Enterprise Performance Computing (EPC)`
 	OciCreateShort string = `Create a container from a bundle directory (root user only)`
 	OciCreateLong  string = `
   Create invoke create operation to create a container instance from an OCI 
-  bundle directory`
+  bundle directory.
+
+  Annotations passed with --annotation are added to the bundle configuration,
+  OCI hooks found in the directories set by the 'oci hooks dir' directive of
+  singularity.conf are injected when their conditions match the container.`
 	OciCreateExample string = `
-  $ singularity oci create -b ~/bundle mycontainer`
+  $ singularity oci create -b ~/bundle mycontainer
+
+  $ singularity oci create --annotation com.example.gpu=true -b ~/bundle mycontainer`
 
 	OciStartUse   string = `start <container_ID>`
 	OciStartShort string = `Start container process (root user only)`
@@ -929,13 +1329,31 @@ Enterprise Performance Computing (EPC)`
 	OciUpdateShort string = `Update container cgroups resources (root user only)`
 	OciUpdateLong  string = `
   Update will update cgroups resources for the specified container ID. Container 
-  must be in a RUNNING or CREATED state.`
+  must be in a RUNNING or CREATED state. Resources are read from an OCI JSON
+  cgroups resource file or set with resource options, options take precedence
+  over the file content.`
 	OciUpdateExample string = `
   $ singularity oci update --from-file /tmp/cgroups-update.json mycontainer
 
   or to update from stdin :
 
-  $ cat /tmp/cgroups-update.json | singularity oci update --from-file - mycontainer`
+  $ cat /tmp/cgroups-update.json | singularity oci update --from-file - mycontainer
+
+  or to update limits with options :
+
+  $ singularity oci update --memory 512m --cpu-quota 50000 --pids-limit 100 mycontainer`
+
+	OciEventsUse   string = `events [events options...] <container_ID>`
+	OciEventsShort string = `Display container statistics events (root user only)`
+	OciEventsLong  string = `
+  Events will display the cgroups statistics of the specified container ID as
+  JSON events every interval until the container stops.`
+	OciEventsExample string = `
+  $ singularity oci events --interval 10s mycontainer
+
+  or to display statistics once :
+
+  $ singularity oci events --stats mycontainer`
 
 	OciPauseUse   string = `pause <container_ID>`
 	OciPauseShort string = `Suspends all processes inside the container (root user only)`
@@ -995,4 +1413,40 @@ Enterprise Performance Computing (EPC)`
 
   To enable a fakeroot user mapping for vagrant user:
   $ singularity config fakeroot --enable vagrant`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// slurm
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SlurmUse   string = `slurm`
+	SlurmShort string = `Slurm integration helpers`
+	SlurmLong  string = `
+  The slurm command provides helpers to run Slurm job steps within containers.
+  Containers started from a Slurm job remain in the job cgroup, get the SLURM_*
+  environment variables and the job temporary directory mapped on /tmp.`
+	SlurmExample string = `
+  All slurm commands have their own help output:
+
+  $ singularity help slurm gen
+  $ singularity slurm gen --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// slurm gen
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SlurmGenUse   string = `gen [gen options...] <image> [command...]`
+	SlurmGenShort string = `Generate an srun wrapper running job step tasks in a container`
+	SlurmGenLong  string = `
+  The slurm gen command generates a shell script to use with srun, executing
+  each task of the job step within the container image. The script imports the
+  SLURM_* environment variables in the container and maps the job temporary
+  directory on /tmp. Without command, the container runscript is executed.
+
+  With the --plugstack option, the plugstack.conf line enabling the Singularity
+  SPANK plugin is printed instead. Once enabled, users select the container
+  image of their job steps with the --singularity-image option of srun/sbatch.`
+	SlurmGenExample string = `
+  $ singularity slurm gen -o step.sh /shared/images/tensorflow.sif python3 train.py
+  $ srun -n 4 ./step.sh --epochs 10
+
+  $ singularity slurm gen --plugstack >> /etc/slurm/plugstack.conf
+  $ srun --singularity-image=/shared/images/centos7.sif cat /etc/redhat-release`
 )
@@ -103,6 +103,7 @@ func Run(t *testing.T) {
 		sysconfdir("ecl.toml"),
 		sysconfdir("capability.json"),
 		sysconfdir("nvliblist.conf"),
+		sysconfdir("rocmliblist.conf"),
 	}
 
 	for _, cf := range configFiles {
@@ -51,6 +51,14 @@ func cleanOrasCache(imgCache *cache.Handle, op func(string) error) error {
 	return cleanCacheDir("oras", imgCache.Oras, op)
 }
 
+func cleanBuildCache(imgCache *cache.Handle, op func(string) error) error {
+	return cleanCacheDir("build", imgCache.Build, op)
+}
+
+func cleanLayerCache(imgCache *cache.Handle, op func(string) error) error {
+	return cleanCacheDir("layer", imgCache.Layers, op)
+}
+
 // cleanCache cleans the given type of cache cacheType. It will return a
 // error if one occurs.
 func cleanCache(imgCache *cache.Handle, cacheType string, op func(string) error) error {
@@ -71,6 +79,10 @@ func cleanCache(imgCache *cache.Handle, cacheType string, op func(string) error)
 		return cleanNetCache(imgCache, op)
 	case "oras":
 		return cleanOrasCache(imgCache, op)
+	case "build":
+		return cleanBuildCache(imgCache, op)
+	case "layer":
+		return cleanLayerCache(imgCache, op)
 	default:
 		// The caller checks the returned error and will exit as required
 		return fmt.Errorf("not a valid type: %s", cacheType)
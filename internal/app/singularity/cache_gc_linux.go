@@ -0,0 +1,54 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+)
+
+// GCSingularityCache removes the cache entries exceeding the limits of
+// the cache policy set in the singularity.conf file. If dryRun is true,
+// the entries are only reported.
+func GCSingularityCache(imgCache *cache.Handle, dryRun bool) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	policy, err := CachePolicy()
+	if err != nil {
+		return err
+	}
+	if policy.IsZero() {
+		fmt.Println("No cache policy set in singularity.conf, nothing to remove")
+		return nil
+	}
+
+	entries, err := imgCache.GC(policy, dryRun)
+	if err != nil {
+		return err
+	}
+
+	action := "Removed"
+	if dryRun {
+		action = "Would remove"
+	}
+
+	var total int64
+	for _, e := range entries {
+		fmt.Printf("%s %s (%s, %s, last used %s)\n",
+			action,
+			e.Path,
+			e.Type,
+			findSize(e.Size),
+			e.LastUsed.Format("2006-01-02 15:04:05"))
+		total += e.Size
+	}
+	fmt.Printf("%s %d cache entries using %s\n", action, len(entries), findSize(total))
+
+	return nil
+}
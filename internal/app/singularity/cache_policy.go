@@ -0,0 +1,66 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	singularityconfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// cachePolicy returns the cache policy defined by the cache directives
+// of the singularity.conf file, sizes are set in MB and ages in days.
+func cachePolicy(c *singularityconfig.FileConfig) cache.Policy {
+	const mb = 1024 * 1024
+
+	return cache.Policy{
+		MaxSize: int64(c.CacheMaxSize) * mb,
+		MaxAge:  time.Duration(c.CacheMaxAge) * 24 * time.Hour,
+		MaxTypeSize: map[string]int64{
+			"library": int64(c.CacheLibraryMaxSize) * mb,
+			"oci":     int64(c.CacheOciMaxSize) * mb,
+			"shub":    int64(c.CacheShubMaxSize) * mb,
+		},
+	}
+}
+
+// CachePolicy reads the cache policy from the singularity.conf file.
+func CachePolicy() (cache.Policy, error) {
+	c := &singularityconfig.FileConfig{}
+	if err := config.Parser(buildcfg.SINGULARITY_CONF_FILE, c); err != nil {
+		return cache.Policy{}, fmt.Errorf("unable to parse singularity.conf file: %s", err)
+	}
+	return cachePolicy(c), nil
+}
+
+// EnforceCachePolicy evicts the cache entries exceeding the limits set
+// in the singularity.conf file, it is called once an image was pulled or
+// built. Errors are only reported as the image is already in place.
+func EnforceCachePolicy(imgCache *cache.Handle) {
+	if imgCache == nil || imgCache.IsDisabled() {
+		return
+	}
+
+	policy, err := CachePolicy()
+	if err != nil {
+		sylog.Warningf("Cache policy not enforced: %s", err)
+		return
+	}
+
+	entries, err := imgCache.GC(policy, false)
+	if err != nil {
+		sylog.Warningf("While enforcing cache policy: %s", err)
+		return
+	}
+	for _, e := range entries {
+		sylog.Verbosef("Evicted %s cache entry %s", e.Type, e.Path)
+	}
+}
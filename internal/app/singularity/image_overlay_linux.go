@@ -0,0 +1,466 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	units "github.com/docker/go-units"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/util/fs/lock"
+)
+
+// mib is the unit of overlay sizes.
+const mib = 1024 * 1024
+
+// ImageOverlayUsage describes the utilization of the overlay partition
+// embedded in a SIF image.
+type ImageOverlayUsage struct {
+	ID         uint32 `json:"id"`
+	Size       int64  `json:"size"`
+	Used       uint64 `json:"used"`
+	Free       uint64 `json:"free"`
+	Inodes     uint64 `json:"inodes"`
+	FreeInodes uint64 `json:"freeInodes"`
+}
+
+// sifOverlay holds an opened SIF image and its overlay partition, the
+// overlay partition is locked for writing while opened.
+type sifOverlay struct {
+	file  *os.File
+	fimg  sif.FileImage
+	descr *sif.Descriptor
+}
+
+// openSifOverlay opens the SIF image at path and looks for the ext3
+// overlay partition associated to the primary system partition, as the
+// runtime does. A nil descriptor is set if the image has no overlay.
+func openSifOverlay(path string, writable bool) (*sifOverlay, error) {
+	flags := os.O_RDONLY
+	if writable {
+		flags = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %s", path, err)
+	}
+
+	fimg, err := sif.LoadContainerFp(f, !writable)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not load SIF image %s: %s", path, err)
+	}
+
+	o := &sifOverlay{file: f, fimg: fimg}
+
+	prim, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		o.close()
+		return nil, fmt.Errorf("could not find primary system partition in %s: %s", path, err)
+	}
+
+	for i, d := range fimg.DescrArr {
+		if !d.Used || d.Datatype != sif.DataPartition || d.Groupid != prim.Groupid {
+			continue
+		}
+		if ptype, err := d.GetPartType(); err != nil || ptype != sif.PartOverlay {
+			continue
+		}
+		if fstype, err := d.GetFsType(); err != nil || fstype != sif.FsExt3 {
+			continue
+		}
+		o.descr = &fimg.DescrArr[i]
+		break
+	}
+
+	if o.descr != nil && writable {
+		// running containers place a lock on writable overlay partitions
+		br := lock.NewByteRange(int(f.Fd()), o.descr.Fileoff, o.descr.Filelen)
+		if err := br.Lock(); err == lock.ErrByteRangeAcquired {
+			o.close()
+			return nil, fmt.Errorf("overlay partition of %s is currently in use by another process", path)
+		} else if err != nil && err != lock.ErrLockNotSupported {
+			o.close()
+			return nil, fmt.Errorf("could not lock overlay partition of %s: %s", path, err)
+		}
+	}
+
+	return o, nil
+}
+
+func (o *sifOverlay) close() error {
+	// closing the file also releases the byte-range lock
+	return o.fimg.UnloadContainer()
+}
+
+// replace replaces the overlay partition data by the content of the
+// ext3 image r of size bytes, the descriptor properties are preserved.
+func (o *sifOverlay) replace(r io.Reader, size int64) error {
+	input := sif.DescriptorInput{
+		Datatype: o.descr.Datatype,
+		Groupid:  o.descr.Groupid,
+		Link:     o.descr.Link,
+		Size:     size,
+		Fname:    o.descr.GetName(),
+		Fp:       r,
+	}
+	input.Extra.Write(o.descr.Extra[:])
+
+	_, idx, err := o.fimg.GetFromDescrID(o.descr.ID)
+	if err != nil {
+		return err
+	}
+
+	flag := sif.DelCompact
+	if o.fimg.Filesize != o.descr.Fileoff+o.descr.Filelen {
+		sylog.Warningf("Overlay partition is not the last data object, its previous space won't be reclaimed")
+		flag = sif.DelZero
+	}
+	if err := o.fimg.DeleteObject(o.descr.ID, flag); err != nil {
+		return fmt.Errorf("could not delete overlay partition: %s", err)
+	}
+	// DeleteObject only clears the descriptor stored in the image, the
+	// freed entry is reused by AddObject which keeps the partition ID
+	o.fimg.DescrArr[idx] = sif.Descriptor{}
+
+	if err := o.fimg.AddObject(input); err != nil {
+		return fmt.Errorf("could not add overlay partition: %s", err)
+	}
+	return nil
+}
+
+// add adds the ext3 image r of size bytes as the overlay partition
+// associated to the primary system partition.
+func (o *sifOverlay) add(r io.Reader, size int64) error {
+	prim, _, err := o.fimg.GetPartPrimSys()
+	if err != nil {
+		return fmt.Errorf("could not find primary system partition: %s", err)
+	}
+	arch, err := prim.GetArch()
+	if err != nil {
+		return fmt.Errorf("could not get primary system partition architecture: %s", err)
+	}
+
+	input := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  prim.Groupid,
+		Link:     sif.DescrUnusedLink,
+		Size:     size,
+		Fname:    "overlay",
+		Fp:       r,
+	}
+	if err := input.SetPartExtra(sif.FsExt3, sif.PartOverlay, string(arch[:sif.HdrArchLen-1])); err != nil {
+		return err
+	}
+	if err := o.fimg.AddObject(input); err != nil {
+		return fmt.Errorf("could not add overlay partition: %s", err)
+	}
+	return nil
+}
+
+// runE2fsprogs executes one of the e2fsprogs commands.
+func runE2fsprogs(name string, args ...string) error {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%s is required to manage overlay partitions: %s", name, err)
+	}
+
+	cmd := exec.Command(path, args...)
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// e2fsck exits with 1 when errors have been corrected
+		if exitErr, ok := err.(*exec.ExitError); ok && name == "e2fsck" && exitErr.Sys().(syscall.WaitStatus).ExitStatus() == 1 {
+			sylog.Infof("Filesystem errors were corrected in overlay partition")
+			return nil
+		}
+		return fmt.Errorf("%s failed: %s: %s", name, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// tempOverlayFile creates a temporary file next to the SIF image, overlay
+// partitions may be too large for the temporary directory.
+func tempOverlayFile(path string) (*os.File, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".overlay-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary overlay file: %s", err)
+	}
+	return f, nil
+}
+
+// storeOverlay writes the ext3 image tmp as the overlay partition. On
+// failure the temporary file is kept to not lose the overlay data.
+func storeOverlay(o *sifOverlay, tmp *os.File, replace bool) error {
+	fi, err := tmp.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat %s: %s", tmp.Name(), err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek %s: %s", tmp.Name(), err)
+	}
+
+	if replace {
+		err = o.replace(tmp, fi.Size())
+	} else {
+		err = o.add(tmp, fi.Size())
+	}
+	if err != nil {
+		if replace {
+			return fmt.Errorf("%s, overlay data was saved in %s", err, tmp.Name())
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateImageOverlay creates an ext3 overlay partition of sizeMiB MiB in
+// the SIF image at path. The overlay upper and work directories are owned
+// by the calling user.
+func CreateImageOverlay(path string, sizeMiB int64) error {
+	if sizeMiB <= 0 {
+		return fmt.Errorf("overlay size must be greater than zero")
+	}
+
+	o, err := openSifOverlay(path, true)
+	if err != nil {
+		return err
+	}
+	defer o.close()
+
+	if o.descr != nil {
+		return fmt.Errorf("%s already contains an overlay partition", path)
+	}
+
+	dir, err := ioutil.TempDir("", "overlay-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"upper", "work"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := tempOverlayFile(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := tmp.Truncate(sizeMiB * mib); err != nil {
+		return fmt.Errorf("could not allocate overlay of %d MiB: %s", sizeMiB, err)
+	}
+	if err := runE2fsprogs("mkfs.ext3", "-q", "-F", "-d", dir, tmp.Name()); err != nil {
+		return err
+	}
+
+	return storeOverlay(o, tmp, false)
+}
+
+// resizeImageOverlay resizes the overlay partition of the SIF image at
+// path, newSize returns the requested size in bytes from the current
+// partition size, zero means the smallest size possible.
+func resizeImageOverlay(path string, newSize func(size int64) (int64, error)) error {
+	o, err := openSifOverlay(path, true)
+	if err != nil {
+		return err
+	}
+	defer o.close()
+
+	if o.descr == nil {
+		return fmt.Errorf("no overlay partition found in %s", path)
+	}
+
+	oldSize := o.descr.Filelen
+	size, err := newSize(oldSize)
+	if err != nil {
+		return err
+	}
+	if size == oldSize {
+		sylog.Infof("Overlay partition is already %d MiB", size/mib)
+		return nil
+	}
+
+	tmp, err := tempOverlayFile(path)
+	if err != nil {
+		return err
+	}
+	keep := false
+	defer func() {
+		tmp.Close()
+		if !keep {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	sr := io.NewSectionReader(o.file, o.descr.Fileoff, o.descr.Filelen)
+	if _, err := io.Copy(tmp, sr); err != nil {
+		return fmt.Errorf("could not extract overlay partition: %s", err)
+	}
+
+	// resize2fs refuses to shrink filesystems not checked recently
+	if err := runE2fsprogs("e2fsck", "-f", "-p", tmp.Name()); err != nil {
+		return err
+	}
+
+	switch {
+	case size > oldSize:
+		if err := tmp.Truncate(size); err != nil {
+			return fmt.Errorf("could not grow overlay to %d MiB: %s", size/mib, err)
+		}
+		err = runE2fsprogs("resize2fs", tmp.Name())
+	case size == 0:
+		err = runE2fsprogs("resize2fs", "-M", tmp.Name())
+	default:
+		err = runE2fsprogs("resize2fs", tmp.Name(), strconv.FormatInt(size/1024, 10)+"K")
+	}
+	if err != nil {
+		return err
+	}
+
+	usage, err := image.ReadExt3Usage(tmp, 0)
+	if err != nil {
+		return fmt.Errorf("could not read resized overlay: %s", err)
+	}
+	if err := tmp.Truncate(int64(usage.Size())); err != nil {
+		return fmt.Errorf("could not truncate resized overlay: %s", err)
+	}
+
+	if err := storeOverlay(o, tmp, true); err != nil {
+		keep = true
+		return err
+	}
+
+	sylog.Infof("Overlay partition resized from %d MiB to %d MiB", oldSize/mib, int64(usage.Size())/mib)
+	return nil
+}
+
+// GrowImageOverlay grows the overlay partition of the SIF image at path
+// by sizeMiB MiB.
+func GrowImageOverlay(path string, sizeMiB int64) error {
+	if sizeMiB <= 0 {
+		return fmt.Errorf("size to grow must be greater than zero")
+	}
+	return resizeImageOverlay(path, func(size int64) (int64, error) {
+		return size + sizeMiB*mib, nil
+	})
+}
+
+// ShrinkImageOverlay shrinks the overlay partition of the SIF image at
+// path by sizeMiB MiB, or to its minimal size if sizeMiB is zero.
+func ShrinkImageOverlay(path string, sizeMiB int64) error {
+	if sizeMiB < 0 {
+		return fmt.Errorf("size to shrink must be positive")
+	}
+	return resizeImageOverlay(path, func(size int64) (int64, error) {
+		if sizeMiB == 0 {
+			return 0, nil
+		}
+		if sizeMiB*mib >= size {
+			return 0, fmt.Errorf("can't shrink overlay of %d MiB by %d MiB", size/mib, sizeMiB)
+		}
+		return size - sizeMiB*mib, nil
+	})
+}
+
+// ResizeImageOverlay sets the size of the overlay partition of the SIF
+// image at path to sizeMiB MiB.
+func ResizeImageOverlay(path string, sizeMiB int64) error {
+	if sizeMiB <= 0 {
+		return fmt.Errorf("overlay size must be greater than zero")
+	}
+	return resizeImageOverlay(path, func(size int64) (int64, error) {
+		return sizeMiB * mib, nil
+	})
+}
+
+// GetImageOverlayUsage returns the utilization of the overlay partition
+// of the SIF image at path.
+func GetImageOverlayUsage(path string) (*ImageOverlayUsage, error) {
+	o, err := openSifOverlay(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer o.close()
+
+	if o.descr == nil {
+		return nil, fmt.Errorf("no overlay partition found in %s", path)
+	}
+
+	usage, err := image.ReadExt3Usage(o.file, o.descr.Fileoff)
+	if err != nil {
+		return nil, fmt.Errorf("could not read overlay partition: %s", err)
+	}
+
+	return &ImageOverlayUsage{
+		ID:         o.descr.ID,
+		Size:       o.descr.Filelen,
+		Used:       usage.Used(),
+		Free:       usage.FreeBlocks * usage.BlockSize,
+		Inodes:     usage.Inodes,
+		FreeInodes: usage.FreeInodes,
+	}, nil
+}
+
+// PrintImageOverlayUsage prints the utilization of the overlay partition
+// of the SIF image at path to the passed writer.
+func PrintImageOverlayUsage(w io.Writer, path string, asJSON bool) error {
+	usage, err := GetImageOverlayUsage(path)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(usage); err != nil {
+			return fmt.Errorf("could not encode overlay usage: %v", err)
+		}
+		return nil
+	}
+
+	percent := func(used, total uint64) string {
+		if total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f%%", float64(used)*100/float64(total))
+	}
+
+	const format = "%-6s %-12s %-12s %-12s %-6s %-10s %s\n"
+
+	_, err = fmt.Fprintf(w, format, "ID", "SIZE", "USED", "AVAILABLE", "USE%", "INODES", "IUSE%")
+	if err != nil {
+		return fmt.Errorf("could not write overlay usage header: %v", err)
+	}
+	inodesUsed := usage.Inodes - usage.FreeInodes
+	_, err = fmt.Fprintf(w, format,
+		fmt.Sprintf("%d", usage.ID),
+		units.BytesSize(float64(usage.Size)),
+		units.BytesSize(float64(usage.Used)),
+		units.BytesSize(float64(usage.Free)),
+		percent(usage.Used, usage.Used+usage.Free),
+		fmt.Sprintf("%d", usage.Inodes),
+		percent(inodesUsed, usage.Inodes),
+	)
+	if err != nil {
+		return fmt.Errorf("could not write overlay usage: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// createTestSif creates a SIF image with a fake primary system partition.
+func createTestSif(t *testing.T, path string) {
+	input := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "rootfs",
+		Data:     make([]byte, 4096),
+		Size:     4096,
+	}
+	if err := input.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)); err != nil {
+		t.Fatalf("could not set partition extra: %s", err)
+	}
+
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{input},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("could not create SIF image: %s", err)
+	}
+}
+
+func TestImageOverlay(t *testing.T) {
+	for _, c := range []string{"mkfs.ext3", "e2fsck", "resize2fs"} {
+		if _, err := exec.LookPath(c); err != nil {
+			t.Skipf("%s not found", c)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "image-overlay-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	createTestSif(t, path)
+
+	if _, err := GetImageOverlayUsage(path); err == nil {
+		t.Fatalf("unexpected success without overlay partition")
+	}
+	if err := GrowImageOverlay(path, 8); err == nil {
+		t.Fatalf("unexpected success without overlay partition")
+	}
+
+	if err := CreateImageOverlay(path, 16); err != nil {
+		t.Fatalf("could not create overlay: %s", err)
+	}
+	if err := CreateImageOverlay(path, 16); err == nil {
+		t.Fatalf("unexpected success while creating a second overlay")
+	}
+
+	usage, err := GetImageOverlayUsage(path)
+	if err != nil {
+		t.Fatalf("could not get overlay usage: %s", err)
+	}
+	if usage.Size != 16*mib {
+		t.Errorf("got overlay size %d, expected %d", usage.Size, 16*mib)
+	}
+	if usage.Used == 0 || usage.Free == 0 {
+		t.Errorf("unexpected overlay usage %+v", usage)
+	}
+	id := usage.ID
+
+	tests := []struct {
+		name   string
+		resize func() error
+		size   int64
+	}{
+		{
+			name:   "grow",
+			resize: func() error { return GrowImageOverlay(path, 8) },
+			size:   24 * mib,
+		},
+		{
+			name:   "shrink",
+			resize: func() error { return ShrinkImageOverlay(path, 4) },
+			size:   20 * mib,
+		},
+		{
+			name:   "resize",
+			resize: func() error { return ResizeImageOverlay(path, 32) },
+			size:   32 * mib,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.resize(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			usage, err := GetImageOverlayUsage(path)
+			if err != nil {
+				t.Fatalf("could not get overlay usage: %s", err)
+			}
+			if usage.Size != tt.size {
+				t.Errorf("got overlay size %d, expected %d", usage.Size, tt.size)
+			}
+			if usage.ID != id {
+				t.Errorf("got overlay ID %d, expected %d", usage.ID, id)
+			}
+		})
+	}
+
+	if err := ShrinkImageOverlay(path, 0); err != nil {
+		t.Fatalf("could not shrink overlay to its minimal size: %s", err)
+	}
+	usage, err = GetImageOverlayUsage(path)
+	if err != nil {
+		t.Fatalf("could not get overlay usage: %s", err)
+	}
+	if usage.Size >= 32*mib {
+		t.Errorf("overlay size %d not shrunk", usage.Size)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("could not stat %s: %s", path, err)
+	}
+	if fi.Size() > sif.DataStartOffset+64*1024+usage.Size {
+		t.Errorf("image size %d not compacted for overlay of %d bytes", fi.Size(), usage.Size)
+	}
+
+	if err := ShrinkImageOverlay(path, usage.Size/mib+1); err == nil {
+		t.Errorf("unexpected success while shrinking more than the overlay size")
+	}
+}
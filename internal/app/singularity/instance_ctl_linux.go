@@ -0,0 +1,146 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"net/rpc"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/pkg/instancectl"
+)
+
+// logsPollInterval is the interval between log reads when following
+// instance logs
+const logsPollInterval = 500 * time.Millisecond
+
+// dialInstance connects to the control socket of the named instance.
+func dialInstance(name string) (*instancectl.Client, error) {
+	i, err := instance.Get(name, instance.SingSubDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve instance %s: %v", name, err)
+	}
+	if i.ControlSocket == "" {
+		return nil, fmt.Errorf("instance %s has no control socket", name)
+	}
+	return instancectl.Dial(i.ControlSocket)
+}
+
+// PrintInstanceStats prints the resource usage of the named instance
+// to the passed writer.
+func PrintInstanceStats(w io.Writer, name string) error {
+	c, err := dialInstance(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stats, err := c.Stats()
+	if err != nil {
+		return fmt.Errorf("could not get instance %s statistics: %v", name, err)
+	}
+
+	limit := "unlimited"
+	if stats.MemoryLimit != 0 {
+		limit = fmt.Sprintf("%d", stats.MemoryLimit)
+	}
+	_, err = fmt.Fprintf(w, "%-16s %d\n%-16s %s\n%-16s %.3fs\n%-16s %d\n",
+		"MEMORY USAGE", stats.MemoryUsage,
+		"MEMORY LIMIT", limit,
+		"CPU TIME", float64(stats.CPUUsage)/float64(time.Second),
+		"PROCESSES", stats.Pids,
+	)
+	return err
+}
+
+// PauseInstance suspends all processes of the named instance, resume
+// them with ResumeInstance.
+func PauseInstance(name string) error {
+	c, err := dialInstance(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Pause(); err != nil {
+		return fmt.Errorf("could not pause instance %s: %v", name, err)
+	}
+	return nil
+}
+
+// ResumeInstance resumes all processes of the named instance.
+func ResumeInstance(name string) error {
+	c, err := dialInstance(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Resume(); err != nil {
+		return fmt.Errorf("could not resume instance %s: %v", name, err)
+	}
+	return nil
+}
+
+// ExecInstance executes the command args in the named instance through
+// its master process, the command output is written to the passed writer
+// and its exit code is returned.
+func ExecInstance(w io.Writer, name string, args []string) (int, error) {
+	c, err := dialInstance(name)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	res, err := c.Exec(args)
+	if err != nil {
+		return 0, fmt.Errorf("could not execute command in instance %s: %v", name, err)
+	}
+	if _, err := w.Write(res.Output); err != nil {
+		return 0, err
+	}
+	return res.ExitCode, nil
+}
+
+// PrintInstanceLogs writes the output log, or the error log if stderr is
+// true, of the named instance to the passed writer. With follow, the log
+// is read until the instance exits.
+func PrintInstanceLogs(w io.Writer, name string, stderr, follow bool) error {
+	c, err := dialInstance(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stream := instancectl.Stdout
+	if stderr {
+		stream = instancectl.Stderr
+	}
+
+	offset := int64(0)
+	for {
+		res, err := c.Logs(stream, offset, 0)
+		if follow && (err == rpc.ErrShutdown || err == io.ErrUnexpectedEOF) {
+			// the master process exited with the instance
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not read instance %s logs: %v", name, err)
+		}
+		if _, err := w.Write(res.Data); err != nil {
+			return err
+		}
+		offset = res.Offset
+
+		if len(res.Data) == 0 {
+			if !follow {
+				return nil
+			}
+			time.Sleep(logsPollInterval)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,9 +16,10 @@ import (
 )
 
 type instanceInfo struct {
-	Instance string `json:"instance"`
-	Pid      int    `json:"pid"`
-	Image    string `json:"img"`
+	Instance string           `json:"instance"`
+	Pid      int              `json:"pid"`
+	Image    string           `json:"img"`
+	Health   *instance.Health `json:"health,omitempty"`
 }
 
 // PrintInstanceList fetches instance list, applying name and
@@ -47,6 +50,7 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool) error {
 		instances[i].Image = ii[i].Image
 		instances[i].Pid = ii[i].Pid
 		instances[i].Instance = ii[i].Name
+		instances[i].Health = ii[i].Health
 	}
 
 	enc := json.NewEncoder(w)
@@ -87,10 +91,23 @@ func WriteInstancePidFile(name, pidFile string) error {
 	return nil
 }
 
+// defaultStopSignal returns the signal requesting the shutdown of the
+// instance init process: SIGRTMIN+3 for systemd booted instances,
+// SIGINT otherwise.
+func defaultStopSignal(i *instance.File) syscall.Signal {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", i.Pid))
+	if err == nil && strings.HasPrefix(filepath.Base(exe), "systemd") {
+		sylog.Debugf("Instance %s is booted with systemd, using SIGRTMIN+3 to stop it", i.Name)
+		return syscall.Signal(instance.SigRTMin + 3)
+	}
+	return syscall.SIGINT
+}
+
 // StopInstance fetches instance list, applying name and
-// user filters, and stops them by sending a signal sig. If an instance
-// is still running after a grace period defined by timeout is expired,
-// it will be forcibly killed.
+// user filters, and stops them by sending a signal sig. If sig is
+// zero, the signal is chosen for each instance according to its init
+// process. If an instance is still running after a grace period defined
+// by timeout is expired, it will be forcibly killed.
 func StopInstance(name, user string, sig syscall.Signal, timeout time.Duration) error {
 	ii, err := instance.List(user, name, instance.SingSubDir)
 	if err != nil {
@@ -132,6 +149,9 @@ func StopInstance(name, user string, sig syscall.Signal, timeout time.Duration)
 }
 
 func killInstance(i *instance.File, sig syscall.Signal, stoppedPID chan<- int) {
+	if sig == 0 {
+		sig = defaultStopSignal(i)
+	}
 	sylog.Infof("Stopping %s instance of %s (PID=%d)\n", i.Name, i.Image, i.Pid)
 	syscall.Kill(i.Pid, sig)
 
@@ -148,3 +168,61 @@ func killInstance(i *instance.File, sig syscall.Signal, stoppedPID chan<- int) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+// CheckpointInstance checkpoints the named instance into dir by sending
+// a checkpoint request to the instance master process and waits for its
+// completion for at most timeout, or indefinitely if timeout is zero. The
+// instance is stopped once checkpointed unless leaveRunning is true.
+func CheckpointInstance(name, dir string, leaveRunning bool, timeout time.Duration) error {
+	i, err := instance.Get(name, instance.SingSubDir)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance %s: %v", name, err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("could not create checkpoint directory %s: %v", dir, err)
+	}
+	if err := instance.DeleteCheckpointResult(dir); err != nil {
+		return fmt.Errorf("could not remove previous checkpoint result: %v", err)
+	}
+
+	req := &instance.CheckpointRequest{Dir: dir, LeaveRunning: leaveRunning}
+	if err := i.WriteCheckpointRequest(req); err != nil {
+		return fmt.Errorf("could not write checkpoint request: %v", err)
+	}
+
+	sylog.Infof("Checkpointing %s instance of %s (PID=%d) to %s\n", i.Name, i.Image, i.Pid, dir)
+	if err := syscall.Kill(i.PPid, instance.CheckpointSignal); err != nil {
+		return fmt.Errorf("could not signal instance %s: %v", name, err)
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+
+	for {
+		// the master process may have exited after the checkpoint, so
+		// check its state before reading the checkpoint result
+		exited := syscall.Kill(i.PPid, 0) == syscall.ESRCH
+
+		req, err := instance.ReadCheckpointResult(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		} else if err == nil {
+			if req.Error != "" {
+				return fmt.Errorf("checkpoint of instance %s failed: %s", name, req.Error)
+			}
+			return nil
+		} else if exited {
+			i.DeleteCheckpointRequest()
+			return fmt.Errorf("instance %s exited during checkpoint", name)
+		}
+
+		select {
+		case <-deadline:
+			return fmt.Errorf("checkpoint of instance %s not completed after %s", name, timeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+)
+
+// InstanceLogsOptions holds the options of PrintInstanceStructuredLogs.
+type InstanceLogsOptions struct {
+	// Follow keeps reading the log until the instance exits
+	Follow bool
+	// Tail is the number of last log lines printed, all lines
+	// are printed if negative
+	Tail int
+	// Timestamps prefixes log lines with their timestamp
+	Timestamps bool
+}
+
+// logPrinter writes structured log lines to the writer of their stream.
+type logPrinter struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	timestamps bool
+}
+
+func (p *logPrinter) print(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+
+	entry, err := instance.ParseLogEntry(line)
+	if err != nil {
+		// not written with the JSON log format, print it as is
+		_, err := fmt.Fprintf(p.stdout, "%s\n", line)
+		return err
+	}
+
+	w := p.stdout
+	if entry.Stream == "stderr" {
+		w = p.stderr
+	}
+	if p.timestamps {
+		_, err = fmt.Fprintf(w, "%s %s\n", entry.Time.Format(time.RFC3339Nano), entry.Log)
+	} else {
+		_, err = fmt.Fprintf(w, "%s\n", entry.Log)
+	}
+	return err
+}
+
+// readLogLines returns the complete lines of the log files, the last N
+// lines only if tail isn't negative.
+func readLogLines(files []string, tail int) ([][]byte, error) {
+	var lines [][]byte
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			// rotated meanwhile
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				f.Close()
+				return nil, err
+			}
+			lines = append(lines, line)
+			if tail >= 0 && len(lines) > tail {
+				lines = lines[1:]
+			}
+		}
+		f.Close()
+	}
+	return lines, nil
+}
+
+// PrintInstanceStructuredLogs writes the structured log of the named
+// instance, output lines are written to stdout and error lines to stderr.
+// The instance must have been started with a log format.
+func PrintInstanceStructuredLogs(stdout, stderr io.Writer, name string, opts InstanceLogsOptions) error {
+	if err := instance.CheckName(name); err != nil {
+		return err
+	}
+	path, err := instance.GetLogPath(name, instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("could not determine instance %s log path: %v", name, err)
+	}
+
+	files := instance.LogFiles(path)
+	if len(files) == 0 {
+		return fmt.Errorf("no structured log found for instance %s, it must be started with --log-format", name)
+	}
+
+	p := &logPrinter{stdout: stdout, stderr: stderr, timestamps: opts.Timestamps}
+
+	if !opts.Follow {
+		lines, err := readLogLines(files, opts.Tail)
+		if err != nil {
+			return fmt.Errorf("could not read instance %s log: %v", name, err)
+		}
+		for _, line := range lines {
+			if err := p.print(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// open the current log file first to not miss lines written
+	// while printing the previous ones
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open instance %s log: %v", name, err)
+	}
+
+	lines, err := readLogLines(files[:len(files)-1], opts.Tail)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not read instance %s log: %v", name, err)
+	}
+
+	return followLog(p, name, path, f, lines, opts.Tail)
+}
+
+// followLog prints the lines of the current instance log file after the
+// previous lines, only the last tail lines if tail isn't negative, then
+// the lines appended to the log until the instance exits. The log file
+// is re-opened when rotated.
+func followLog(p *logPrinter, name, path string, f *os.File, lines [][]byte, tail int) error {
+	defer func() { f.Close() }()
+
+	r := bufio.NewReader(f)
+
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			partial = line
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not read instance %s log: %v", name, err)
+		}
+		lines = append(lines, line)
+		if tail >= 0 && len(lines) > tail {
+			lines = lines[1:]
+		}
+	}
+	for _, line := range lines {
+		if err := p.print(line); err != nil {
+			return err
+		}
+	}
+
+	rotated := false
+	exited := false
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("could not read instance %s log: %v", name, err)
+		}
+		partial = append(partial, line...)
+		if err == nil {
+			if err := p.print(partial); err != nil {
+				return err
+			}
+			partial = nil
+			continue
+		}
+
+		switch {
+		case rotated:
+			// the rotated file has been read entirely
+			f.Close()
+			f, err = os.Open(path)
+			if err != nil {
+				return fmt.Errorf("could not open instance %s log: %v", name, err)
+			}
+			r.Reset(f)
+			rotated = false
+		case exited:
+			if len(partial) > 0 {
+				return p.print(partial)
+			}
+			return nil
+		default:
+			if fi, err := os.Stat(path); err == nil {
+				if cur, err := f.Stat(); err == nil && !os.SameFile(fi, cur) {
+					rotated = true
+					continue
+				}
+			}
+			if _, err := instance.Get(name, instance.SingSubDir); err != nil {
+				// read lines written before the instance exited
+				exited = true
+				continue
+			}
+			time.Sleep(logsPollInterval)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadLogLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instance-logs-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rotated := filepath.Join(dir, "test.log.1")
+	current := filepath.Join(dir, "test.log")
+
+	ioutil.WriteFile(rotated, []byte(
+		`{"time":"2019-10-01T10:00:00Z","stream":"stdout","log":"first"}`+"\n"+
+			`{"time":"2019-10-01T10:00:01Z","stream":"stderr","log":"second"}`+"\n"), 0644)
+	ioutil.WriteFile(current, []byte(
+		`{"time":"2019-10-01T10:00:02Z","stream":"stdout","log":"third"}`+"\n"+
+			"not structured\n"+
+			`{"time":"2019-10-01T10:00:03Z","stream":"stdout","log":"partial"`), 0644)
+
+	tests := []struct {
+		name       string
+		tail       int
+		timestamps bool
+		stdout     string
+		stderr     string
+	}{
+		{
+			name:   "all",
+			tail:   -1,
+			stdout: "first\nthird\nnot structured\n",
+			stderr: "second\n",
+		},
+		{
+			name:   "tail",
+			tail:   2,
+			stdout: "third\nnot structured\n",
+		},
+		{
+			name:       "timestamps",
+			tail:       3,
+			timestamps: true,
+			stdout:     "2019-10-01T10:00:02Z third\nnot structured\n",
+			stderr:     "2019-10-01T10:00:01Z second\n",
+		},
+		{
+			name: "none",
+			tail: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := readLogLines([]string{rotated, current}, tt.tail)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			p := &logPrinter{stdout: &stdout, stderr: &stderr, timestamps: tt.timestamps}
+			for _, line := range lines {
+				if err := p.print(line); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("got stdout %q, expected %q", stdout.String(), tt.stdout)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("got stderr %q, expected %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/metrics"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// InstanceStatsOptions holds the options of PrintInstanceMetrics.
+type InstanceStatsOptions struct {
+	// User is the owner of the instances, the current user if empty
+	User string
+	// JSON prints metrics as JSON
+	JSON bool
+	// Prometheus prints metrics in the Prometheus text format
+	Prometheus bool
+}
+
+// collectInstanceMetrics returns the metrics of the instances owned by
+// user matching the name pattern, instances exiting while collecting are
+// skipped.
+func collectInstanceMetrics(name, user string) ([]*metrics.Metrics, error) {
+	ii, err := instance.List(user, name, instance.SingSubDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve instance list: %v", err)
+	}
+
+	list := make([]*metrics.Metrics, 0, len(ii))
+	for _, i := range ii {
+		m, err := metrics.Collect(i)
+		if err != nil {
+			if _, statErr := os.Stat(fmt.Sprintf("/proc/%d", i.Pid)); os.IsNotExist(statErr) {
+				continue
+			}
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+// PrintInstanceMetrics prints the resource usage of the instances matching
+// the name pattern to the passed writer.
+func PrintInstanceMetrics(w io.Writer, name string, opts InstanceStatsOptions) error {
+	list, err := collectInstanceMetrics(name, opts.User)
+	if err != nil {
+		return err
+	}
+
+	if opts.Prometheus {
+		return metrics.WritePrometheus(w, list)
+	}
+
+	if opts.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(map[string][]*metrics.Metrics{"instances": list}); err != nil {
+			return fmt.Errorf("could not encode instance statistics: %v", err)
+		}
+		return nil
+	}
+
+	const format = "%-16s %-10s %-22s %-22s %-22s %s\n"
+
+	_, err = fmt.Fprintf(w, format, "INSTANCE NAME", "CPU TIME", "MEM USAGE / LIMIT", "BLOCK I/O", "NET I/O", "PIDS")
+	if err != nil {
+		return fmt.Errorf("could not write statistics header: %v", err)
+	}
+	for _, m := range list {
+		cpu, mem, blkio, pids, netio := "-", "-", "-", "-", "-"
+		if m.Cgroup {
+			limit := "unlimited"
+			if m.MemoryLimit != 0 {
+				limit = units.BytesSize(float64(m.MemoryLimit))
+			}
+			cpu = fmt.Sprintf("%.2fs", float64(m.CPUUsage)/float64(time.Second))
+			mem = units.BytesSize(float64(m.MemoryUsage)) + " / " + limit
+			blkio = units.BytesSize(float64(m.BlkioRead)) + " / " + units.BytesSize(float64(m.BlkioWrite))
+			pids = fmt.Sprintf("%d", m.Pids)
+		}
+		if m.Network {
+			netio = units.BytesSize(float64(m.NetRxBytes)) + " / " + units.BytesSize(float64(m.NetTxBytes))
+		}
+		if _, err := fmt.Fprintf(w, format, m.Instance, cpu, mem, blkio, netio, pids); err != nil {
+			return fmt.Errorf("could not write instance statistics: %v", err)
+		}
+	}
+	return nil
+}
+
+// metricsNetwork returns the network of the metrics address, either a
+// unix socket path or a TCP host:port address. Metrics are served without
+// authentication so TCP addresses are restricted to the loopback interface.
+func metricsNetwork(address string) (string, error) {
+	if strings.Contains(address, "/") {
+		return "unix", nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("bad listen address %s: %v", address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("%s is not a loopback address, metrics can only be served on a unix socket or a loopback address", address)
+	}
+	return "tcp", nil
+}
+
+// removeStaleSocket removes the unix socket path left by a previous
+// process if no process accepts connections on it anymore.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+
+	c, err := net.Dial("unix", path)
+	if err == nil {
+		c.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+	sylog.Debugf("Removing stale socket %s", path)
+	return os.Remove(path)
+}
+
+// ServeInstanceMetrics serves the resource usage of the instances matching
+// the name pattern in the Prometheus text format until interrupted. The
+// address is either a unix socket path or a loopback host:port address,
+// instances are listed again for each scrape.
+func ServeInstanceMetrics(address, name, user string) error {
+	network, err := metricsNetwork(address)
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return fmt.Errorf("could not listen on %s: %v", address, err)
+		}
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %v", address, err)
+	}
+
+	// closing the listener removes the unix socket
+	sig := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		close(stopped)
+		l.Close()
+	}()
+
+	sylog.Infof("Serving instance metrics on %s://%s/metrics", network, address)
+
+	err = metrics.ServePrometheus(l, func() ([]*metrics.Metrics, error) {
+		return collectInstanceMetrics(name, user)
+	})
+	select {
+	case <-stopped:
+		return nil
+	default:
+	}
+	if err != nil {
+		return fmt.Errorf("while serving instance metrics: %v", err)
+	}
+	return nil
+}
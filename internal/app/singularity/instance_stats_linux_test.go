@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetricsNetwork(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+	}{
+		{address: "/run/stats.sock", network: "unix"},
+		{address: "localhost:9323", network: "tcp"},
+		{address: "127.0.0.1:9323", network: "tcp"},
+		{address: "[::1]:9323", network: "tcp"},
+		{address: ":9323"},
+		{address: "0.0.0.0:9323"},
+		{address: "192.168.1.10:9323"},
+		{address: "example.com:9323"},
+		{address: "9323"},
+	}
+
+	for _, tt := range tests {
+		network, err := metricsNetwork(tt.address)
+		if tt.network == "" {
+			if err == nil {
+				t.Errorf("unexpected success for %s", tt.address)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("unexpected error for %s: %s", tt.address, err)
+		} else if network != tt.network {
+			t.Errorf("got network %s for %s, expected %s", network, tt.address, tt.network)
+		}
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instance-stats-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stats.sock")
+	if err := removeStaleSocket(path); err != nil {
+		t.Errorf("unexpected error without socket: %s", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("could not listen on %s: %s", path, err)
+	}
+	if err := removeStaleSocket(path); err == nil {
+		t.Errorf("unexpected success with a socket in use")
+	}
+
+	// leave the socket file behind like a killed process
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if err := removeStaleSocket(path); err != nil {
+		t.Errorf("unexpected error with a stale socket: %s", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("stale socket %s not removed", path)
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(path); err == nil {
+		t.Errorf("unexpected success with a regular file")
+	}
+}
@@ -11,13 +11,16 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/ocihooks"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
 
 // OciCreate creates a container from an OCI bundle
@@ -65,6 +68,23 @@ func OciCreate(containerID string, args *OciArgs) error {
 		return fmt.Errorf("failed to parse OCI specification file %s: %s", configJSON, err)
 	}
 
+	for _, a := range args.Annotations {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("bad annotation format %q, expected key=value", a)
+		}
+		generator.AddAnnotation(kv[0], kv[1])
+	}
+
+	// inject hooks from directories configured by administrator
+	fileConfig := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SINGULARITY_CONF_FILE, fileConfig); err != nil {
+		return fmt.Errorf("unable to parse singularity.conf file: %s", err)
+	}
+	if err := ocihooks.Apply(generator.Config, fileConfig.OciHooksDir); err != nil {
+		return fmt.Errorf("while injecting OCI hooks: %s", err)
+	}
+
 	Env := []string{sylog.GetEnvVar()}
 
 	engineConfig.EmptyProcess = args.EmptyProcess
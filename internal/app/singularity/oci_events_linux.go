@@ -0,0 +1,118 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// OciEvent is a container event, its format is the runc one
+// so that containerd shims can decode it.
+type OciEvent struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// OciStats holds the cgroups statistics of a container event.
+type OciStats struct {
+	CPU    OciCPUStats    `json:"cpu"`
+	Memory OciMemoryStats `json:"memory"`
+	Pids   OciPidsStats   `json:"pids"`
+}
+
+// OciCPUStats holds the CPU usage of a container.
+type OciCPUStats struct {
+	Usage struct {
+		// Total is the CPU time consumed in nanoseconds
+		Total uint64 `json:"total"`
+	} `json:"usage"`
+}
+
+// OciMemoryStats holds the memory usage of a container.
+type OciMemoryStats struct {
+	Usage struct {
+		Usage uint64 `json:"usage"`
+		Limit uint64 `json:"limit"`
+	} `json:"usage"`
+}
+
+// OciPidsStats holds the number of processes of a container.
+type OciPidsStats struct {
+	Current uint64 `json:"current"`
+}
+
+// newOciStats converts cgroups statistics to their event format.
+func newOciStats(s *cgroups.Stats) *OciStats {
+	stats := &OciStats{}
+	stats.CPU.Usage.Total = s.CPUUsage
+	stats.Memory.Usage.Usage = s.MemoryUsage
+	stats.Memory.Usage.Limit = s.MemoryLimit
+	stats.Pids.Current = s.Pids
+	return stats
+}
+
+// OciEvents writes the cgroups statistics of a container as JSON
+// events every interval until the container stops, or once with
+// --stats.
+func OciEvents(containerID string, args *OciArgs) error {
+	interval, err := time.ParseDuration(args.EventsInterval)
+	if err != nil {
+		return fmt.Errorf("invalid interval %q: %s", args.EventsInterval, err)
+	} else if interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+
+	state, err := getState(containerID)
+	if err != nil {
+		return err
+	}
+	if state.State.Status == ociruntime.Stopped {
+		return fmt.Errorf("container %s is not running", containerID)
+	}
+
+	manager := &cgroups.Manager{Pid: state.State.Pid}
+	enc := json.NewEncoder(os.Stdout)
+
+	if args.EventsStats {
+		return writeStatsEvent(enc, containerID, manager)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := writeStatsEvent(enc, containerID, manager); err != nil {
+			return err
+		}
+		<-ticker.C
+
+		// stop streaming once the container is gone
+		state, err := getState(containerID)
+		if err != nil || state.State.Status == ociruntime.Stopped {
+			return nil
+		}
+	}
+}
+
+func writeStatsEvent(w *json.Encoder, containerID string, manager *cgroups.Manager) error {
+	s, err := manager.Stats()
+	if err != nil {
+		return fmt.Errorf("could not get container %s statistics: %s", containerID, err)
+	}
+	event := OciEvent{
+		Type: "stats",
+		ID:   containerID,
+		Data: newOciStats(s),
+	}
+	return w.Encode(event)
+}
@@ -25,10 +25,28 @@ type OciArgs struct {
 	SyncSocketPath string
 	PidFile        string
 	FromFile       string
+	Annotations    []string
 	KillSignal     string
 	KillTimeout    uint32
+	EventsInterval string
+	Resources      OciResourceArgs
 	EmptyProcess   bool
 	ForceKill      bool
+	EventsStats    bool
+}
+
+// OciResourceArgs holds the cgroups resources limits set by
+// oci update, empty values are left unchanged.
+type OciResourceArgs struct {
+	CPUShares         string
+	CPUPeriod         string
+	CPUQuota          string
+	CpusetCpus        string
+	CpusetMems        string
+	Memory            string
+	MemoryReservation string
+	MemorySwap        string
+	PidsLimit         string
 }
 
 func getCommonConfig(containerID string) (*config.Common, error) {
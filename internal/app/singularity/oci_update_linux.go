@@ -11,7 +11,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 
+	units "github.com/docker/go-units"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/cgroups"
 	"github.com/sylabs/singularity/pkg/ociruntime"
@@ -30,31 +32,125 @@ func OciUpdate(containerID string, args *OciArgs) error {
 		return fmt.Errorf("container %s is neither running nor created", containerID)
 	}
 
-	if args.FromFile == "" {
-		return fmt.Errorf("you must specify --from-file")
-	}
-
 	resources := &specs.LinuxResources{}
 	manager := &cgroups.Manager{Pid: state.State.Pid}
 
-	if args.FromFile == "-" {
-		reader = os.Stdin
-	} else {
-		f, err := os.Open(args.FromFile)
+	if args.FromFile != "" {
+		if args.FromFile == "-" {
+			reader = os.Stdin
+		} else {
+			f, err := os.Open(args.FromFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			reader = f
+		}
+
+		data, err := ioutil.ReadAll(reader)
 		if err != nil {
+			return fmt.Errorf("failed to read cgroups config file: %s", err)
+		}
+
+		if err := json.Unmarshal(data, resources); err != nil {
 			return err
 		}
-		reader = f
 	}
 
-	data, err := ioutil.ReadAll(reader)
+	// resource options take precedence over the file content
+	set, err := updateResources(resources, &args.Resources)
 	if err != nil {
-		return fmt.Errorf("failed to read cgroups config file: %s", err)
-	}
-
-	if err := json.Unmarshal(data, resources); err != nil {
 		return err
 	}
+	if args.FromFile == "" && !set {
+		return fmt.Errorf("you must specify --from-file or at least one resource option")
+	}
 
 	return manager.UpdateFromSpec(resources)
 }
+
+// updateResources sets the resources limits provided on the command line,
+// it returns false if no limit was provided.
+func updateResources(resources *specs.LinuxResources, args *OciResourceArgs) (bool, error) {
+	set := false
+
+	setUint := func(dst **uint64, name, value string) error {
+		if value == "" {
+			return nil
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --%s: %s", value, name, err)
+		}
+		*dst = &v
+		set = true
+		return nil
+	}
+	setInt := func(dst **int64, name, value string) error {
+		if value == "" {
+			return nil
+		}
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --%s: %s", value, name, err)
+		}
+		*dst = &v
+		set = true
+		return nil
+	}
+	// memory limits accept units like 512m and -1 for unlimited
+	setMemory := func(dst **int64, name, value string) error {
+		if value == "" {
+			return nil
+		}
+		v := int64(-1)
+		if value != "-1" {
+			var err error
+			if v, err = units.RAMInBytes(value); err != nil {
+				return fmt.Errorf("invalid value %q for --%s: %s", value, name, err)
+			}
+		}
+		*dst = &v
+		set = true
+		return nil
+	}
+
+	if resources.CPU == nil {
+		resources.CPU = &specs.LinuxCPU{}
+	}
+	if resources.Memory == nil {
+		resources.Memory = &specs.LinuxMemory{}
+	}
+	cpu := resources.CPU
+	memory := resources.Memory
+
+	var pids *int64
+
+	for _, err := range []error{
+		setUint(&cpu.Shares, "cpu-share", args.CPUShares),
+		setUint(&cpu.Period, "cpu-period", args.CPUPeriod),
+		setInt(&cpu.Quota, "cpu-quota", args.CPUQuota),
+		setMemory(&memory.Limit, "memory", args.Memory),
+		setMemory(&memory.Reservation, "memory-reservation", args.MemoryReservation),
+		setMemory(&memory.Swap, "memory-swap", args.MemorySwap),
+		setInt(&pids, "pids-limit", args.PidsLimit),
+	} {
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if args.CpusetCpus != "" {
+		cpu.Cpus = args.CpusetCpus
+		set = true
+	}
+	if args.CpusetMems != "" {
+		cpu.Mems = args.CpusetMems
+		set = true
+	}
+	if pids != nil {
+		resources.Pids = &specs.LinuxPids{Limit: *pids}
+	}
+
+	return set, nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestUpdateResources(t *testing.T) {
+	quota := int64(10000)
+	resources := &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{Quota: &quota},
+	}
+
+	set, err := updateResources(resources, &OciResourceArgs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if set {
+		t.Errorf("unexpected resources set without options")
+	}
+
+	args := &OciResourceArgs{
+		CPUShares:  "512",
+		CPUQuota:   "50000",
+		CpusetCpus: "0-1",
+		Memory:     "512m",
+		MemorySwap: "-1",
+		PidsLimit:  "100",
+	}
+	set, err = updateResources(resources, args)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !set {
+		t.Errorf("resources not set with options")
+	}
+
+	switch {
+	case *resources.CPU.Shares != 512:
+		t.Errorf("got %d CPU shares instead of 512", *resources.CPU.Shares)
+	case *resources.CPU.Quota != 50000:
+		t.Errorf("got %d CPU quota instead of 50000", *resources.CPU.Quota)
+	case resources.CPU.Cpus != "0-1":
+		t.Errorf("got CPUs %s instead of 0-1", resources.CPU.Cpus)
+	case *resources.Memory.Limit != 512<<20:
+		t.Errorf("got memory limit %d instead of %d", *resources.Memory.Limit, 512<<20)
+	case *resources.Memory.Swap != -1:
+		t.Errorf("got memory swap %d instead of -1", *resources.Memory.Swap)
+	case resources.Memory.Reservation != nil:
+		t.Errorf("unexpected memory reservation set")
+	case resources.Pids.Limit != 100:
+		t.Errorf("got pids limit %d instead of 100", resources.Pids.Limit)
+	}
+
+	for _, args := range []*OciResourceArgs{
+		{CPUShares: "-1"},
+		{CPUQuota: "foo"},
+		{Memory: "12x"},
+		{PidsLimit: "1.5"},
+	} {
+		if _, err := updateResources(&specs.LinuxResources{}, args); err == nil {
+			t.Errorf("unexpected success with %+v", args)
+		}
+	}
+}
@@ -114,7 +114,7 @@ func printProgress(totalSize int64, r io.Reader, w io.Writer) error {
 // OrasPull will download the image specified by the provided oci reference and store
 // it at the location specified by file, it will use credentials if supplied
 func OrasPull(imgCache *cache.Handle, name, ref string, force bool, ociAuth *ocitypes.DockerAuthConfig) error {
-	sum, err := oras.ImageSHA(ref, ociAuth)
+	sum, err := oras.ImageSHA(ref, ociAuth, nil)
 	if err != nil {
 		return fmt.Errorf("failed to get checksum for %s: %s", ref, err)
 	}
@@ -137,7 +137,7 @@ func OrasPull(imgCache *cache.Handle, name, ref string, force bool, ociAuth *oci
 		sylog.Infof("Downloading image with ORAS")
 		go interruptCleanup(cacheImagePath)
 
-		if err := oras.DownloadImage(cacheImagePath, ref, ociAuth); err != nil {
+		if err := oras.DownloadImage(cacheImagePath, ref, ociAuth, &oras.Options{Progress: &oras.ProgressBar{}}); err != nil {
 			return fmt.Errorf("unable to Download Image: %v", err)
 		}
 
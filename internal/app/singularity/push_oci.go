@@ -0,0 +1,89 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ocitypes "github.com/containers/image/types"
+	ociclient "github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/image/unpacker"
+)
+
+// OCIPush pushes the root filesystem of the SIF image file as a single
+// layer OCI image to dest, an OCI image layout (oci:directory[:tag]) is
+// written directly while other destinations like docker registries are
+// populated from a temporary OCI image layout.
+func OCIPush(file, dest, tmpDir string, sysCtx *ocitypes.SystemContext) error {
+	img, err := image.Init(file, false)
+	if err != nil {
+		return fmt.Errorf("could not open image %s: %s", file, err)
+	}
+	defer img.File.Close()
+
+	if !img.HasRootFs() {
+		return fmt.Errorf("no root filesystem found in %s", file)
+	} else if img.Type != image.SIF || img.Partitions[0].Type != image.SQUASHFS {
+		return fmt.Errorf("only SIF images with a squashfs root filesystem can be pushed as OCI images")
+	}
+
+	tmp, err := ioutil.TempDir(tmpDir, "oci-push-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %s", err)
+	}
+	defer removeTree(tmp)
+
+	rootfs := filepath.Join(tmp, "rootfs")
+	if err := os.Mkdir(rootfs, 0700); err != nil {
+		return fmt.Errorf("could not create root filesystem directory: %s", err)
+	}
+
+	reader, err := image.NewPartitionReader(img, "", 0)
+	if err != nil {
+		return fmt.Errorf("could not extract root filesystem: %s", err)
+	}
+	sylog.Infof("Extracting root filesystem of %s", file)
+	if err := unpacker.NewSquashfs().ExtractAll(reader, rootfs); err != nil {
+		return fmt.Errorf("root filesystem extraction failed: %s", err)
+	}
+
+	layoutImg := &ociclient.LayoutImage{
+		Rootfs: rootfs,
+		Config: ociclient.RootfsConfig(rootfs),
+		// files extracted by unprivileged users are owned by them
+		RootOwned: os.Getuid() != 0,
+	}
+
+	if transport, ref := uri.Split(dest); transport == "oci" {
+		dir, tag := ociclient.SplitLayoutRef(ref)
+		sylog.Infof("Writing OCI image %s to layout %s", tag, dir)
+		return ociclient.WriteLayout(dir, tag, layoutImg)
+	}
+
+	layout := filepath.Join(tmp, "layout")
+	if err := ociclient.WriteLayout(layout, ociclient.DefaultLayoutTag, layoutImg); err != nil {
+		return err
+	}
+	return ociclient.CopyLayout(layout, ociclient.DefaultLayoutTag, dest, sysCtx)
+}
+
+// removeTree removes path and its content, read-only directories are made
+// writable first so unprivileged users can remove extracted filesystems.
+func removeTree(path string) error {
+	filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chmod(p, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/sif"
+)
+
+func sifArch(filename string) (string, error) {
+	fimg, err := sif.LoadContainer(filename, true)
+	if err != nil {
+		return "", fmt.Errorf("unable to open: %v: %v", filename, err)
+	}
+	arch := sif.GetGoArch(string(fimg.Header.Arch[:sif.HdrArchLen-1]))
+	if arch == "unknown" {
+		return arch, fmt.Errorf("unknown architecture in SIF file")
+	}
+	return arch, nil
+}
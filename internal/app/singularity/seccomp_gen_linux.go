@@ -0,0 +1,117 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// SeccompGenConfig defines how a seccomp profile is generated
+type SeccompGenConfig struct {
+	// Template is the path of the OCI seccomp profile used as template,
+	// all system calls return an error by default if empty
+	Template string
+	// Allow lists the system calls allowed in addition to recorded ones
+	Allow []string
+	// Deny lists the system calls returning an error
+	Deny []string
+	// Image is the container image to record system calls from, no
+	// system calls are recorded if empty
+	Image string
+	// Args are the command and arguments executed in the container
+	Args []string
+}
+
+// GenerateSeccompProfile writes the seccomp profile generated from config
+// to w. When a container image is provided, the command is executed in the
+// container with singularity exec and the system calls of the container
+// processes are allowed, the command exit code is returned.
+func GenerateSeccompProfile(w io.Writer, config SeccompGenConfig) (int, error) {
+	template := seccomp.DefaultTemplate()
+	if config.Template != "" {
+		var err error
+		if template, err = seccomp.LoadTemplate(config.Template); err != nil {
+			return 0, err
+		}
+	}
+
+	exitCode := 0
+	allow := config.Allow
+
+	if config.Image != "" {
+		recorded, code, err := recordContainerSyscalls(config.Image, config.Args)
+		if err != nil {
+			return 0, err
+		}
+		exitCode = code
+		allow = append(allow, recorded...)
+	}
+
+	profile := seccomp.GenerateProfile(template, allow, config.Deny)
+	if err := seccomp.WriteProfile(w, profile); err != nil {
+		return 0, fmt.Errorf("could not write seccomp profile: %s", err)
+	}
+	return exitCode, nil
+}
+
+// recordContainerSyscalls executes args in the container image and returns
+// the names of the system calls used by the container processes, system
+// calls of Singularity itself are not recorded.
+func recordContainerSyscalls(image string, args []string) ([]string, int, error) {
+	singularity := filepath.Join(buildcfg.BINDIR, "singularity")
+	starterDir := filepath.Join(buildcfg.LIBEXECDIR, "singularity", "bin") + string(os.PathSeparator)
+
+	execArgs := []string{"exec"}
+	// setuid programs can't be traced, unprivileged
+	// users must rely on user namespaces
+	if os.Geteuid() != 0 {
+		execArgs = append(execArgs, "--userns")
+	}
+	execArgs = append(execArgs, image)
+
+	cmd := exec.Command(singularity, append(execArgs, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	sylog.Infof("Recording system calls of %s", strings.Join(args, " "))
+	numbers, status, err := seccomp.RecordSyscalls(cmd, func(exe string) bool {
+		return exe == singularity || strings.HasPrefix(exe, starterDir)
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not record system calls: %s", err)
+	}
+
+	names := make([]string, 0, len(numbers))
+	for nr := range numbers {
+		name, err := seccomp.SyscallName(nr)
+		if err != nil {
+			return nil, 0, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sylog.Verbosef("Recorded system calls: %s", strings.Join(names, " "))
+
+	code := status.ExitStatus()
+	if status.Signaled() {
+		code = 128 + int(status.Signal())
+	}
+	if code != 0 {
+		sylog.Warningf("Command exited with code %d, recorded system calls may be incomplete", code)
+	}
+	return names, code, nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// TestTimeoutExitCode is the exit code reported when a test didn't
+// complete in time, as timeout(1) does.
+const TestTimeoutExitCode = 124
+
+// testKillDelay is the time given to a test to terminate after the
+// timeout before being killed.
+var testKillDelay = 5 * time.Second
+
+// TestOptions holds the options of RunTest.
+type TestOptions struct {
+	// Timeout is the time after which the test is terminated, zero
+	// means no timeout
+	Timeout time.Duration
+	// Capture stores the test output in the result instead of
+	// streaming it
+	Capture bool
+}
+
+// TestResult describes the outcome of a container test.
+type TestResult struct {
+	Image    string  `json:"image"`
+	ExitCode int     `json:"exitCode"`
+	Signal   string  `json:"signal,omitempty"`
+	TimedOut bool    `json:"timedOut"`
+	Duration float64 `json:"duration"`
+	Stdout   string  `json:"stdout,omitempty"`
+	Stderr   string  `json:"stderr,omitempty"`
+}
+
+// RunTest runs cmd, the starter command executing the test script of
+// image, and returns its result. The test is sent SIGTERM once the
+// timeout expired and killed if it's still running a few seconds later.
+func RunTest(cmd *exec.Cmd, image string, opts TestOptions) (*TestResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	if opts.Capture {
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		// processes left behind would keep the output pipes open, a
+		// process group allows to kill them all
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	} else {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start test: %s", err)
+	}
+
+	timedOut := make(chan struct{})
+	if opts.Timeout > 0 {
+		// the starter forwards SIGTERM to the container process
+		timer := time.AfterFunc(opts.Timeout, func() {
+			close(timedOut)
+			sylog.Verbosef("Test didn't complete within %s, terminating it", opts.Timeout)
+			cmd.Process.Signal(syscall.SIGTERM)
+			time.AfterFunc(testKillDelay, func() {
+				if opts.Capture {
+					syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				} else {
+					cmd.Process.Kill()
+				}
+			})
+		})
+		defer timer.Stop()
+	}
+
+	err := cmd.Wait()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, fmt.Errorf("while waiting test: %s", err)
+	}
+
+	result := &TestResult{
+		Image:    image,
+		Duration: time.Since(start).Seconds(),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		result.Signal = status.Signal().String()
+		result.ExitCode = 128 + int(status.Signal())
+	} else {
+		result.ExitCode = status.ExitStatus()
+	}
+
+	select {
+	case <-timedOut:
+		result.TimedOut = true
+		result.ExitCode = TestTimeoutExitCode
+	default:
+	}
+
+	return result, nil
+}
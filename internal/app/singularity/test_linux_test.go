@@ -0,0 +1,69 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunTest(t *testing.T) {
+	defer func(d time.Duration) { testKillDelay = d }(testKillDelay)
+	testKillDelay = 100 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		exitCode int
+		timedOut bool
+		stdout   string
+		stderr   string
+	}{
+		{
+			name:     "success",
+			script:   "echo out; echo err >&2",
+			exitCode: 0,
+			stdout:   "out\n",
+			stderr:   "err\n",
+		},
+		{
+			name:     "failure",
+			script:   "exit 3",
+			exitCode: 3,
+		},
+		{
+			name:     "timeout",
+			script:   "sleep 10",
+			timeout:  100 * time.Millisecond,
+			exitCode: TestTimeoutExitCode,
+			timedOut: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("/bin/sh", "-c", tt.script)
+			result, err := RunTest(cmd, "test.sif", TestOptions{Timeout: tt.timeout, Capture: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result.ExitCode != tt.exitCode {
+				t.Errorf("got exit code %d, expected %d", result.ExitCode, tt.exitCode)
+			}
+			if result.TimedOut != tt.timedOut {
+				t.Errorf("got timed out %v, expected %v", result.TimedOut, tt.timedOut)
+			}
+			if result.Stdout != tt.stdout || result.Stderr != tt.stderr {
+				t.Errorf("got output %q/%q, expected %q/%q", result.Stdout, result.Stderr, tt.stdout, tt.stderr)
+			}
+			if result.Image != "test.sif" {
+				t.Errorf("got image %q, expected test.sif", result.Image)
+			}
+		})
+	}
+}
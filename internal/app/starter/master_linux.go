@@ -14,8 +14,10 @@ import (
 	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine"
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 func createContainer(rpcSocket int, containerPid int, e *engine.Engine, fatalChan chan error) {
@@ -33,7 +35,7 @@ func createContainer(rpcSocket int, containerPid int, e *engine.Engine, fatalCha
 
 	err = e.CreateContainer(containerPid, rpcConn)
 	if err != nil {
-		fatalChan <- fmt.Errorf("container creation failed: %s", err)
+		fatalChan <- errcode.Wrap(errcode.Unknown, err, "container creation failed")
 		return
 	}
 
@@ -87,8 +89,23 @@ func startContainer(masterSocket int, containerPid int, e *engine.Engine, fatalC
 	// wait container process execution, EOF means container process
 	// was executed and master socket was closed by stage 2. If data
 	// byte sent is equal to 'f', it means an error occurred in
-	// StartProcess, just return by waiting error and process status
-	_, err = conn.Read(data)
+	// StartProcess, just return by waiting error and process status.
+	// A 'n' data byte comes with the seccomp notification listener
+	// serviced by the master process and a 'a' data byte with the
+	// socket relaying instance exec agent connections
+	for {
+		var fd int
+
+		data[0], fd, err = readMasterSocket(conn)
+		if err == nil && data[0] == 'n' {
+			go serveSeccompNotify(fd, e)
+			continue
+		} else if err == nil && data[0] == 'a' {
+			setExecAgentRelay(fd, e)
+			continue
+		}
+		break
+	}
 	if (err != nil && err != io.EOF) || data[0] == 'f' {
 		sylog.Debugf("stage 2 process reported an error, waiting status")
 		return
@@ -101,6 +118,77 @@ func startContainer(masterSocket int, containerPid int, e *engine.Engine, fatalC
 	}
 }
 
+// readMasterSocket reads a data byte sent by stage 2 on the master socket
+// along with the file descriptor passed with it if any.
+func readMasterSocket(conn net.Conn) (byte, int, error) {
+	data := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		_, err := conn.Read(data)
+		return data[0], -1, err
+	}
+
+	n, oobn, _, _, err := uc.ReadMsgUnix(data, oob)
+	if err != nil {
+		return 0, -1, err
+	} else if n == 0 {
+		return 0, -1, io.EOF
+	}
+
+	fd := -1
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			return data[0], -1, fmt.Errorf("bad control message received from stage 2")
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			return data[0], -1, fmt.Errorf("bad file descriptor received from stage 2")
+		}
+		fd = fds[0]
+	}
+	if data[0] == 'n' && fd < 0 {
+		return data[0], -1, fmt.Errorf("no seccomp notification listener received from stage 2")
+	}
+	if data[0] == 'a' && fd < 0 {
+		return data[0], -1, fmt.Errorf("no exec agent relay received from stage 2")
+	}
+	return data[0], fd, nil
+}
+
+// serveSeccompNotify executes the syscalls notified by the container
+// process until the listener is closed, engines may provide their own
+// handlers.
+func serveSeccompNotify(fd int, e *engine.Engine) {
+	var err error
+
+	if obj, ok := e.Operations.(interface {
+		NotifyHandlers() map[int32]seccomp.NotifyHandler
+	}); ok {
+		err = seccomp.ServeNotifyHandlers(fd, obj.NotifyHandlers())
+	} else {
+		err = seccomp.ServeNotify(fd)
+	}
+	if err != nil {
+		sylog.Warningf("Seccomp notification handling stopped: %s", err)
+	}
+}
+
+// setExecAgentRelay passes the socket relaying exec agent connections
+// to the container process to the engine, the socket is closed if the
+// engine doesn't provide an exec agent.
+func setExecAgentRelay(fd int, e *engine.Engine) {
+	if obj, ok := e.Operations.(interface {
+		SetExecAgentRelay(int)
+	}); ok {
+		obj.SetExecAgentRelay(fd)
+		return
+	}
+	syscall.Close(fd)
+}
+
 // Master initializes a runtime engine and runs it.
 //
 // Saved uid 0 is preserved when run with suid flow, so that
@@ -133,7 +221,7 @@ func Master(rpcSocket, masterSocket int, containerPid int, e *engine.Engine) {
 	}
 
 	if fatal != nil {
-		sylog.Fatalf("%s", fatal)
+		errcode.Fatal(fatal)
 	}
 
 	// reset signal handlers
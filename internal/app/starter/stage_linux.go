@@ -12,6 +12,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine"
 	starterConfig "github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 // StageOne validates and prepares container configuration which is
@@ -25,7 +26,7 @@ func StageOne(sconfig *starterConfig.Config, e *engine.Engine) {
 	sylog.Debugf("Entering stage 1\n")
 
 	if err := e.PrepareConfig(sconfig); err != nil {
-		sylog.Fatalf("%s\n", err)
+		errcode.Fatal(err)
 	}
 
 	if err := sconfig.Write(e.Common); err != nil {
@@ -31,6 +31,7 @@ const (
 	sectionEnv     = "appenv"
 	sectionTest    = "apptest"
 	sectionHelp    = "apphelp"
+	sectionArgs    = "apparguments"
 	sectionRun     = "apprun"
 	sectionLabels  = "applabels"
 )
@@ -42,6 +43,7 @@ var (
 		sectionEnv:     true,
 		sectionTest:    true,
 		sectionHelp:    true,
+		sectionArgs:    true,
 		sectionRun:     true,
 		sectionLabels:  true,
 	}
@@ -106,6 +108,7 @@ type App struct {
 	Env     string
 	Test    string
 	Help    string
+	Args    string
 	Run     string
 	Labels  string
 }
@@ -150,6 +153,8 @@ func (pl *BuildApp) HandleSection(ident, section string) {
 		app.Test = section
 	case sectionHelp:
 		app.Help = section
+	case sectionArgs:
+		app.Args = section
 	case sectionRun:
 		app.Run = section
 	case sectionLabels:
@@ -172,6 +177,7 @@ func (pl *BuildApp) initApp(name string) {
 			Env:     "",
 			Test:    "",
 			Help:    "",
+			Args:    "",
 			Run:     "",
 		}
 	}
@@ -225,6 +231,10 @@ func (pl *BuildApp) createAllApps(b *types.Bundle) error {
 			return err
 		}
 
+		if err := writeArgsFile(b, app); err != nil {
+			return err
+		}
+
 		if err := copyFiles(b, app); err != nil {
 			return err
 		}
@@ -332,6 +342,15 @@ func writeHelpFile(b *types.Bundle, a *App) error {
 	return ioutil.WriteFile(filepath.Join(appMeta(b, a), "/runscript.help"), []byte(a.Help), 0644)
 }
 
+// %apparguments
+func writeArgsFile(b *types.Bundle, a *App) error {
+	if a.Args == "" {
+		return nil
+	}
+
+	return ioutil.WriteFile(filepath.Join(appMeta(b, a), "/runscript.args"), []byte(a.Args), 0644)
+}
+
 // %appfile
 func copyFiles(b *types.Bundle, a *App) error {
 	if a.Files == "" {
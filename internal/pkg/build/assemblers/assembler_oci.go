@@ -0,0 +1,37 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"fmt"
+
+	ociclient "github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// OCIAssembler stores data required to assemble the image.
+type OCIAssembler struct {
+	// Nothing yet
+}
+
+// Assemble creates a single layer OCI image from a Bundle in the OCI image
+// layout referenced by path, in the form directory[:tag]
+func (a *OCIAssembler) Assemble(b *types.Bundle, path string) error {
+	dir, tag := ociclient.SplitLayoutRef(path)
+
+	sylog.Infof("Creating OCI image %s in layout %s...", tag, dir)
+
+	img := &ociclient.LayoutImage{
+		Rootfs: b.Rootfs(),
+		Config: ociclient.RootfsConfig(b.Rootfs()),
+	}
+	if err := ociclient.WriteLayout(dir, tag, img); err != nil {
+		return fmt.Errorf("OCI image assemble failed: %v", err)
+	}
+
+	return nil
+}
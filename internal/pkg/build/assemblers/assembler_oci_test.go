@@ -0,0 +1,68 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/oci/layout"
+	"github.com/sylabs/singularity/internal/pkg/build/assemblers"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// TestOCIAssembler sees if we can build a tagged OCI image in an OCI image layout
+func TestOCIAssembler(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	b, err := types.NewBundle("", "sbuild-ociAssembler")
+	if err != nil {
+		t.Fatalf("unable to make bundle: %v", err)
+	}
+	defer os.RemoveAll(b.Path)
+
+	runscript := filepath.Join(b.Rootfs(), ".singularity.d", "runscript")
+	if err := os.MkdirAll(filepath.Dir(runscript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(runscript, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "oci-assemble-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := &assemblers.OCIAssembler{}
+	if err := a.Assemble(b, dir+":v1"); err != nil {
+		t.Fatalf("failed to assemble OCI image: %v", err)
+	}
+
+	ref, err := layout.NewReference(dir, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	img, err := ref.NewImage(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to open assembled image: %v", err)
+	}
+	defer img.Close()
+
+	config, err := img.OCIConfig(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(config.Config.Cmd) != 1 || config.Config.Cmd[0] != "/.singularity.d/runscript" {
+		t.Errorf("unexpected image command %v", config.Config.Cmd)
+	}
+}
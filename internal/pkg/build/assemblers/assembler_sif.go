@@ -3,10 +3,13 @@
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
 
+// +build !windows
+
 package assemblers
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -19,13 +22,17 @@ import (
 	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/image/packer"
 	"github.com/sylabs/singularity/pkg/util/crypt"
+	"github.com/sylabs/singularity/pkg/util/verity"
 )
 
 // SIFAssembler doesnt store anything
 type SIFAssembler struct {
-	GzipFlag       bool
+	// MksquashfsArgs are the compression and user options
+	// passed to mksquashfs
+	MksquashfsArgs []string
 	MksquashfsPath string
 }
 
@@ -34,7 +41,12 @@ type encryptionOptions struct {
 	plaintext []byte
 }
 
-func createSIF(path string, definition, ociConf []byte, squashfile string, encOpts *encryptionOptions) (err error) {
+type verityOptions struct {
+	hashFile string
+	rootHash string
+}
+
+func createSIF(path string, definition, ociConf []byte, squashfile string, encOpts *encryptionOptions, verOpts *verityOptions) (err error) {
 	// general info for the new SIF file creation
 	cinfo := sif.CreateInfo{
 		Pathname:   path,
@@ -133,6 +145,46 @@ func createSIF(path string, definition, ociConf []byte, squashfile string, encOp
 		}
 	}
 
+	if verOpts != nil {
+		syspartID := uint32(len(cinfo.InputDescr))
+
+		hfp, err := os.Open(verOpts.hashFile)
+		if err != nil {
+			return fmt.Errorf("while opening hash tree file: %s", err)
+		}
+		defer hfp.Close()
+
+		hfi, err := hfp.Stat()
+		if err != nil {
+			return fmt.Errorf("while calling stat on hash tree file: %s", err)
+		}
+
+		// the hash tree and the root hash are linked to the system partition
+		hashInput := sif.DescriptorInput{
+			Datatype: sif.DataGeneric,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     syspartID,
+			Fname:    image.VerityHashName,
+			Fp:       hfp,
+			Size:     hfi.Size(),
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, hashInput)
+
+		config, err := json.Marshal(image.VerityConfig{RootHash: verOpts.rootHash})
+		if err != nil {
+			return fmt.Errorf("while encoding dm-verity parameters: %s", err)
+		}
+		configInput := sif.DescriptorInput{
+			Datatype: sif.DataGenericJSON,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     syspartID,
+			Fname:    image.VerityConfigName,
+			Data:     config,
+			Size:     int64(len(config)),
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, configInput)
+	}
+
 	// remove anything that may exist at the build destination at last moment
 	os.RemoveAll(path)
 
@@ -172,10 +224,7 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	if syscall.Getuid() != 0 {
 		flags = append(flags, "-all-root")
 	}
-	// specify compression if needed
-	if a.GzipFlag {
-		flags = append(flags, "-comp", "gzip")
-	}
+	flags = append(flags, a.MksquashfsArgs...)
 
 	if err := s.Create([]string{b.Rootfs()}, fsPath, flags); err != nil {
 		return fmt.Errorf("while creating squashfs: %v", err)
@@ -211,7 +260,34 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 
 	}
 
-	err = createSIF(path, b.Recipe.Raw, b.JSONObjects["oci-config"], fsPath, encOpts)
+	var verOpts *verityOptions
+
+	if b.Opts.Verity {
+		if encOpts != nil {
+			return fmt.Errorf("dm-verity can't be used with an encrypted filesystem")
+		}
+
+		h, err := ioutil.TempFile(b.Path, "verity-")
+		if err != nil {
+			return fmt.Errorf("while creating temporary file for hash tree: %v", err)
+		}
+		hashPath := h.Name()
+		h.Close()
+		defer os.Remove(hashPath)
+
+		sylog.Infof("Computing dm-verity hash tree...")
+		rootHash, err := verity.Format(fsPath, hashPath)
+		if err != nil {
+			return fmt.Errorf("while computing hash tree: %v", err)
+		}
+
+		verOpts = &verityOptions{
+			hashFile: hashPath,
+			rootHash: rootHash,
+		}
+	}
+
+	err = createSIF(path, b.Recipe.Raw, b.JSONObjects["oci-config"], fsPath, encOpts, verOpts)
 	if err != nil {
 		return fmt.Errorf("while creating SIF: %v", err)
 	}
@@ -3,6 +3,8 @@
 // LICENSE.md file distributed with the URIs of this project regarding your
 // rights to use or distribute this software.
 
+// +build !windows
+
 package assemblers_test
 
 import (
@@ -0,0 +1,26 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// SIFAssembler doesnt store anything
+type SIFAssembler struct {
+	// MksquashfsArgs are the compression and user options
+	// passed to mksquashfs
+	MksquashfsArgs []string
+	MksquashfsPath string
+}
+
+// Assemble is not supported on this platform, the SIF library
+// relies on mmap to create images.
+func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
+	return fmt.Errorf("unsupported on this platform")
+}
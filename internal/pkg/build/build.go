@@ -9,7 +9,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -27,12 +26,12 @@ import (
 	imgbuildConfig "github.com/sylabs/singularity/internal/pkg/runtime/engine/imgbuild/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	syexec "github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/squashfs"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/build/types/parser"
 	"github.com/sylabs/singularity/pkg/image"
-	"github.com/sylabs/singularity/pkg/image/packer"
 )
 
 // Build is an abstracted way to look at the entire build process.
@@ -89,7 +88,7 @@ func New(defs []types.Definition, conf Config) (*Build, error) {
 func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	var err error
 
-	syscall.Umask(0002)
+	fs.Umask(0002)
 
 	// always build a sandbox if updating an existing sandbox
 	if conf.Opts.Update {
@@ -137,18 +136,20 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	switch conf.Format {
 	case "sandbox":
 		b.stages[lastStageIndex].a = &assemblers.SandboxAssembler{}
+	case "oci":
+		b.stages[lastStageIndex].a = &assemblers.OCIAssembler{}
 	case "sif":
 		mksquashfsPath, err := squashfs.GetPath()
 		if err != nil {
 			return nil, fmt.Errorf("while searching for mksquashfs: %v", err)
 		}
 
-		flag, err := ensureGzipComp(b.stages[lastStageIndex].b.Path, mksquashfsPath)
+		args, err := squashfs.GetOptions(mksquashfsPath, conf.Opts.MksquashfsArgs)
 		if err != nil {
-			return nil, fmt.Errorf("while ensuring correct compression algorithm: %v", err)
+			return nil, fmt.Errorf("while setting mksquashfs options: %v", err)
 		}
 		b.stages[lastStageIndex].a = &assemblers.SIFAssembler{
-			GzipFlag:       flag,
+			MksquashfsArgs: args,
 			MksquashfsPath: mksquashfsPath,
 		}
 	default:
@@ -158,74 +159,6 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	return b, nil
 }
 
-// ensureGzipComp builds dummy squashfs images and checks the type of compression used
-// to deduce if we can successfully build with gzip compression. It returns an error
-// if we cannot and a boolean to indicate if the `-comp` flag is needed to specify
-// gzip compression when the final squashfs is built
-func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
-	sylog.Debugf("Ensuring gzip compression for mksquashfs")
-
-	var err error
-	s := packer.NewSquashfs()
-	s.MksquashfsPath = mksquashfsPath
-
-	srcf, err := ioutil.TempFile(tmpdir, "squashfs-gzip-comp-test-src")
-	if err != nil {
-		return false, fmt.Errorf("while creating temporary file for squashfs source: %v", err)
-	}
-
-	srcf.Write([]byte("Test File Content"))
-	srcf.Close()
-
-	f, err := ioutil.TempFile(tmpdir, "squashfs-gzip-comp-test-")
-	if err != nil {
-		return false, fmt.Errorf("while creating temporary file for squashfs: %v", err)
-	}
-	f.Close()
-
-	flags := []string{"-noappend"}
-	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("while creating squashfs: %v", err)
-	}
-
-	content, err := ioutil.ReadFile(f.Name())
-	if err != nil {
-		return false, fmt.Errorf("while reading test squashfs: %v", err)
-	}
-
-	comp, err := image.GetSquashfsComp(content)
-	if err != nil {
-		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
-	}
-
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression by default ensured")
-		return false, nil
-	}
-
-	flags = []string{"-noappend", "-comp", "gzip"}
-	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("could not build squashfs with required gzip compression")
-	}
-
-	content, err = ioutil.ReadFile(f.Name())
-	if err != nil {
-		return false, fmt.Errorf("while reading test squashfs: %v", err)
-	}
-
-	comp, err = image.GetSquashfsComp(content)
-	if err != nil {
-		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
-	}
-
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression with -comp flag ensured")
-		return true, nil
-	}
-
-	return false, fmt.Errorf("could not build squashfs with required gzip compression")
-}
-
 // cleanUp removes remnants of build from file system unless NoCleanUp is specified
 func (b Build) cleanUp() {
 	var bundlePaths []string
@@ -260,14 +193,36 @@ func (b *Build) Full() error {
 	// clean up build normally
 	defer b.cleanUp()
 
+	// build cache keys of the stages, empty when a stage is not cached
+	keys := make([]string, len(b.stages))
+
 	// build each stage one after the other
 	for i, stage := range b.stages {
+		// only update last stage if specified
+		update := stage.b.Opts.Update && !stage.b.Opts.Force && i == len(b.stages)-1
+
+		// an updated container is never reused from the build cache
+		if !update && b.stageCacheEnabled() {
+			key, err := b.stageKey(i, keys)
+			if err != nil {
+				return fmt.Errorf("while computing build cache key: %v", err)
+			}
+			keys[i] = key
+
+			cached, err := b.restoreStage(&stage, key)
+			if err != nil {
+				return fmt.Errorf("while restoring stage from build cache: %v", err)
+			}
+			if cached {
+				sylog.Infof("Using cached build stage %s", key[:12])
+				continue
+			}
+		}
+
 		if err := stage.runPreScript(); err != nil {
 			return err
 		}
 
-		// only update last stage if specified
-		update := stage.b.Opts.Update && !stage.b.Opts.Force && i == len(b.stages)-1
 		if update {
 			// updating, extract dest container to bundle
 			sylog.Infof("Building into existing container: %s", b.Conf.Dest)
@@ -320,6 +275,18 @@ func (b *Build) Full() error {
 		if err := stage.insertMetadata(); err != nil {
 			return fmt.Errorf("while inserting metadata to bundle: %v", err)
 		}
+
+		if isolatedTestRequired(stage.b) {
+			if err := runIsolatedTest(stage.b); err != nil {
+				return err
+			}
+		}
+
+		if keys[i] != "" {
+			if err := b.storeStage(&stage, keys[i]); err != nil {
+				sylog.Warningf("Unable to store stage in build cache: %v", err)
+			}
+		}
 	}
 
 	sylog.Debugf("Calling assembler")
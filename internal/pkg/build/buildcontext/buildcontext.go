@@ -0,0 +1,338 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package buildcontext streams the host files referenced by the %files
+// sections of a definition to a remote builder. The context is a tar
+// archive generated on the fly while it's read, it never hits the disk
+// and is generated identically on each pass so an interrupted upload can
+// be resumed by skipping the bytes already received.
+package buildcontext
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/build/files"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// BuildContext holds the host files copied by the %files sections of a
+// definition.
+type BuildContext struct {
+	paths []string
+	// sources maps the %files sources to the host paths they expand to
+	sources map[string][]string
+}
+
+// New returns the build context of the definition d, only %files sections
+// without arguments reference host files, other sections copy files from
+// previous build stages.
+func New(d types.Definition) (*BuildContext, error) {
+	bc := &BuildContext{sources: make(map[string][]string)}
+
+	for _, f := range d.BuildData.Files {
+		if f.Args != "" {
+			continue
+		}
+		for _, transfer := range f.Files {
+			if transfer.Src == "" {
+				continue
+			}
+			paths, err := files.ExpandPath(transfer.Src)
+			if err != nil {
+				return nil, fmt.Errorf("while expanding source path %s: %s", transfer.Src, err)
+			}
+			for _, p := range paths {
+				if _, err := os.Stat(p); err != nil {
+					return nil, fmt.Errorf("while adding %s to build context: %s", p, err)
+				}
+				bc.paths = append(bc.paths, p)
+			}
+			bc.sources[transfer.Src] = paths
+		}
+	}
+
+	return bc, nil
+}
+
+// Empty returns true if the build context doesn't contain any file.
+func (bc *BuildContext) Empty() bool {
+	return len(bc.paths) == 0
+}
+
+// ExpandSources returns the definition raw with the sources of the %files
+// sections without arguments replaced by the host paths they expand to, a
+// remote builder doesn't know the client home directory and environment
+// and resolves the expanded paths in the build context.
+func (bc *BuildContext) ExpandSources(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	files := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "%") {
+			section := strings.SplitN(strings.TrimLeft(line, "%"), " ", 2)
+			files = strings.ToLower(section[0]) == "files" && (len(section) == 1 || strings.TrimSpace(section[1]) == "")
+			fmt.Fprintln(&buf, line)
+			continue
+		}
+
+		// sources are split from destinations like the definition
+		// parser does it
+		trimmed := strings.TrimSpace(line)
+		if !files || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			fmt.Fprintln(&buf, line)
+			continue
+		}
+		split := strings.SplitN(trimmed, " ", 2)
+		paths, ok := bc.sources[strings.TrimSpace(split[0])]
+		if !ok {
+			fmt.Fprintln(&buf, line)
+			continue
+		}
+		for _, p := range paths {
+			if strings.ContainsAny(p, " \t\n") {
+				return nil, fmt.Errorf("source %s expands to %q containing white spaces", split[0], p)
+			}
+			if len(split) == 2 {
+				p += " " + strings.TrimSpace(split[1])
+			}
+			fmt.Fprintln(&buf, "\t"+p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Size returns the size of the build context archive.
+func (bc *BuildContext) Size() (int64, error) {
+	cw := &countWriter{w: ioutil.Discard}
+	content := int64(0)
+
+	err := bc.walk(func(path, name string, fi os.FileInfo) error {
+		hdr := header(name, fi)
+		if hdr == nil {
+			return nil
+		}
+		// headers are written immediately, a writer per entry avoids
+		// writing the file content
+		if err := tar.NewWriter(cw).WriteHeader(hdr); err != nil {
+			return err
+		}
+		// file content is padded to the block size
+		content += (hdr.Size + blockSize - 1) / blockSize * blockSize
+		return nil
+	})
+	// the archive ends with two zero blocks
+	return cw.n + content + 2*blockSize, err
+}
+
+// blockSize is the size of tar archive blocks.
+const blockSize = 512
+
+// header returns the archive header of the file fi, or nil if the file
+// can't be part of the build context.
+func header(name string, fi os.FileInfo) *tar.Header {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(fi.Mode().Perm()),
+		ModTime: fi.ModTime().Truncate(time.Second),
+	}
+	if fi.IsDir() {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		return hdr
+	} else if !fi.Mode().IsRegular() {
+		// devices, sockets and pipes can't be transferred
+		return nil
+	}
+	hdr.Typeflag = tar.TypeReg
+	hdr.Size = fi.Size()
+	return hdr
+}
+
+// WriteTo writes the build context tar archive to w, symbolic links are
+// followed like the copy of %files sections does.
+func (bc *BuildContext) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	tw := tar.NewWriter(cw)
+
+	err := bc.walk(func(path, name string, fi os.FileInfo) error {
+		hdr := header(name, fi)
+		if hdr == nil {
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// the file size is part of the header, a file modified while
+		// the context is written would corrupt the archive
+		if _, err := io.CopyN(tw, f, fi.Size()); err != nil {
+			return fmt.Errorf("while writing %s to build context: %s", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return cw.n, err
+	}
+	err = tw.Close()
+	return cw.n, err
+}
+
+// walk calls fn for each file of the build context in a deterministic
+// order, name is the archive entry name of the file.
+func (bc *BuildContext) walk(fn func(path, name string, fi os.FileInfo) error) error {
+	written := make(map[string]bool)
+
+	var walkPath func(path, name string, parents []os.FileInfo) error
+	walkPath = func(path, name string, parents []os.FileInfo) error {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !written[name] {
+			written[name] = true
+			if err := fn(path, name, fi); err != nil {
+				return err
+			}
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		for _, p := range parents {
+			if os.SameFile(p, fi) {
+				return fmt.Errorf("symbolic link loop detected at %s", path)
+			}
+		}
+
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, e := range entries {
+			child := e.Name()
+			if err := walkPath(filepath.Join(path, child), name+"/"+child, append(parents, fi)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, p := range bc.paths {
+		name := entryName(p)
+		if name == "" {
+			return fmt.Errorf("can't add the root directory to build context")
+		}
+		if err := walkPath(p, name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extract extracts a build context archive read from r into dir.
+func Extract(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("while reading build context: %s", err)
+		}
+
+		name := entryName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		target := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			// keep directories writable to extract their content
+			if err := os.Chmod(target, os.FileMode(hdr.Mode).Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			// parent directories of sources are not part of the
+			// archive, they are created with default permissions
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("while extracting %s: %s", hdr.Name, err)
+			}
+		default:
+			// build contexts only contain directories and regular
+			// files, never create links pointing outside of dir
+			continue
+		}
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+}
+
+// Resolve returns the path of the %files source src in the extracted
+// build context directory dir, absolute and relative sources are both
+// relative to dir.
+func Resolve(dir, src string) string {
+	path := filepath.Join(dir, entryName(src))
+	// a trailing slash is meaningful for the copy of %files sources
+	if strings.HasSuffix(src, "/") && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path
+}
+
+// entryName returns the archive entry name of path, absolute and
+// relative paths are both relative to the archive root and can't
+// reference a parent of the root.
+func entryName(path string) string {
+	return strings.TrimPrefix(filepath.Clean("/"+path), "/")
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package buildcontext
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func definition(args string, sources ...string) types.Definition {
+	f := types.Files{Args: args}
+	for _, src := range sources {
+		f.Files = append(f.Files, types.FileTransport{Src: src})
+	}
+	d := types.Definition{}
+	d.BuildData.Files = []types.Files{f}
+	return d
+}
+
+func TestBuildContext(t *testing.T) {
+	src, err := ioutil.TempDir("", "buildcontext-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	for path, content := range map[string]string{
+		"file.txt":          "file",
+		"dir/a.txt":         "a",
+		"dir/sub/b.txt":     "b",
+		"other/ignored.txt": "ignored",
+		// names longer than 100 characters require extended headers
+		"dir/sub/" + strings.Repeat("c", 120): "c",
+	} {
+		path = filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a.txt", filepath.Join(src, "dir", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// %files from stage sections don't reference host files
+	bc, err := New(definition("from stage", filepath.Join(src, "other")))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !bc.Empty() {
+		t.Errorf("unexpected build context for %%files from stage")
+	}
+
+	if _, err := New(definition("", filepath.Join(src, "missing"))); err == nil {
+		t.Errorf("unexpected success with missing source")
+	}
+
+	bc, err = New(definition("", filepath.Join(src, "*.txt"), filepath.Join(src, "dir"), filepath.Join(src, "dir", "a.txt")))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var first, second bytes.Buffer
+	if _, err := bc.WriteTo(&first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n, err := bc.WriteTo(&second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != int64(second.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, second.Len())
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Errorf("build context archive is not reproducible")
+	}
+	size, err := bc.Size()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if size != int64(first.Len()) {
+		t.Errorf("got build context size %d, expected %d", size, first.Len())
+	}
+
+	dst, err := ioutil.TempDir("", "buildcontext-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := Extract(&first, dst); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for path, content := range map[string]string{
+		filepath.Join(src, "file.txt"):                          "file",
+		filepath.Join(src, "dir/a.txt"):                         "a",
+		filepath.Join(src, "dir/link"):                          "a",
+		filepath.Join(src, "dir/sub/b.txt"):                     "b",
+		filepath.Join(src, "dir/sub/"+strings.Repeat("c", 120)): "c",
+	} {
+		b, err := ioutil.ReadFile(Resolve(dst, path))
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if string(b) != content {
+			t.Errorf("got %q for %s, expected %q", b, path, content)
+		}
+	}
+	if _, err := os.Stat(Resolve(dst, filepath.Join(src, "other"))); !os.IsNotExist(err) {
+		t.Errorf("unexpected file extracted: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"/data/file", "/ctx/data/file"},
+		{"data/file", "/ctx/data/file"},
+		{"/data/dir/", "/ctx/data/dir/"},
+		{"../../etc/passwd", "/ctx/etc/passwd"},
+		{"/data/*.txt", "/ctx/data/*.txt"},
+	}
+
+	for _, tt := range tests {
+		if path := Resolve("/ctx", tt.src); path != tt.expected {
+			t.Errorf("got %s for %s, expected %s", path, tt.src, tt.expected)
+		}
+	}
+}
+
+func TestExpandSources(t *testing.T) {
+	src, err := ioutil.TempDir("", "buildcontext-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("BUILDCONTEXT_SRC", src)
+	defer os.Unsetenv("BUILDCONTEXT_SRC")
+
+	d := definition("", "$BUILDCONTEXT_SRC/*.txt", "$BUILDCONTEXT_SRC/a.txt")
+	d.BuildData.Files = append(d.BuildData.Files, types.Files{
+		Args:  "from stage",
+		Files: []types.FileTransport{{Src: "$BUILDCONTEXT_SRC/a.txt"}},
+	})
+	bc, err := New(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	raw := `Bootstrap: docker
+From: alpine
+
+%files
+	# comment
+	$BUILDCONTEXT_SRC/*.txt /opt
+	$BUILDCONTEXT_SRC/a.txt
+
+%files from stage
+	$BUILDCONTEXT_SRC/a.txt /opt
+
+%post
+	echo $BUILDCONTEXT_SRC/a.txt
+`
+	expected := `Bootstrap: docker
+From: alpine
+
+%files
+	# comment
+	` + src + `/a.txt /opt
+	` + src + `/b.txt /opt
+	` + src + `/a.txt
+
+%files from stage
+	$BUILDCONTEXT_SRC/a.txt /opt
+
+%post
+	echo $BUILDCONTEXT_SRC/a.txt
+`
+	b, err := bc.ExpandSources([]byte(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != expected {
+		t.Errorf("got definition:\n%s\nexpected:\n%s", b, expected)
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	ocitypes "github.com/containers/image/types"
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/build/buildcontext"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	ociclient "github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/library"
+	"github.com/sylabs/singularity/internal/pkg/oras"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	shub "github.com/sylabs/singularity/pkg/client/shub"
+)
+
+const (
+	// stageRootfs is the directory holding the root filesystem of a
+	// cached build stage
+	stageRootfs = "rootfs"
+	// stageOCIConfig is the file holding the OCI image configuration
+	// of a cached build stage
+	stageOCIConfig = "oci-config.json"
+)
+
+// stageCacheEnabled returns true if build stages are reused from and
+// stored into the build cache.
+func (b *Build) stageCacheEnabled() bool {
+	opts := b.Conf.Opts
+	return opts.ImgCache != nil && !opts.ImgCache.IsDisabled() && !opts.NoCache && !opts.NoBuildCache
+}
+
+// stageKey returns the build cache key of the stage i. The key is the
+// digest of the stage definition, of its base image, of the host files
+// copied by its %files sections and of the keys of the stages it copies
+// files from, keys holds the keys of the previous stages.
+func (b *Build) stageKey(i int, keys []string) (string, error) {
+	s := b.stages[i]
+	h := sha256.New()
+
+	fmt.Fprintf(h, "singularity %s\n", buildcfg.PACKAGE_VERSION)
+
+	// scripts are part of the definition, the sections to run and
+	// the test flag change the scripts executed during the build
+	def, err := json.Marshal(struct {
+		Recipe   types.Definition
+		Sections []string
+		NoTest   bool
+	}{s.b.Recipe, s.b.Opts.Sections, s.b.Opts.NoTest})
+	if err != nil {
+		return "", fmt.Errorf("while encoding stage definition: %s", err)
+	}
+	h.Write(def)
+
+	// a local image can be modified without changing the definition
+	if s.b.Recipe.Header["bootstrap"] == "localimage" {
+		if err := digestFiles(h, "", s.b.Recipe.Header["from"]); err != nil {
+			return "", err
+		}
+	}
+
+	// as well as the image referenced by a remote tag
+	digest, err := baseDigest(s.b)
+	if err != nil {
+		return "", fmt.Errorf("while resolving base image digest: %s", err)
+	}
+	if digest != "" {
+		fmt.Fprintf(h, "base %s\n", digest)
+	}
+
+	if !s.b.RunSection("files") {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	for _, f := range s.b.Recipe.BuildData.Files {
+		if f.Args == "" {
+			var sources []string
+			for _, transfer := range f.Files {
+				if transfer.Src != "" {
+					sources = append(sources, transfer.Src)
+				}
+			}
+			if err := digestFiles(h, s.b.Opts.ContextDir, sources...); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		args := strings.Fields(f.Args)
+		if len(args) != 2 {
+			continue
+		}
+		stageIndex, err := b.findStageIndex(args[1])
+		if err != nil {
+			return "", err
+		}
+		if stageIndex >= i {
+			return "", fmt.Errorf("stage %s copies files from subsequent stage %s", s.name, args[1])
+		}
+		fmt.Fprintf(h, "stage %s\n", keys[stageIndex])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// baseDigest returns the digest of the image currently referenced by the
+// remote base image of the stage bundle b, or an empty string if the base
+// image is not remote.
+func baseDigest(b *types.Bundle) (string, error) {
+	from := b.Recipe.Header["from"]
+
+	switch b.Recipe.Header["bootstrap"] {
+	case "docker":
+		if b.Recipe.Header["namespace"] != "" {
+			from = b.Recipe.Header["namespace"] + "/" + from
+		}
+		if b.Recipe.Header["registry"] != "" {
+			from = b.Recipe.Header["registry"] + "/" + from
+		}
+		sysCtx := &ocitypes.SystemContext{
+			OCIInsecureSkipTLSVerify:    b.Opts.NoHTTPS,
+			DockerInsecureSkipTLSVerify: b.Opts.NoHTTPS,
+			DockerAuthConfig:            b.Opts.DockerAuthConfig,
+			OSChoice:                    "linux",
+		}
+		return ociclient.ImageSHA("docker://"+from, sysCtx)
+	case "library":
+		libraryURL := b.Opts.LibraryURL
+		if customLib, ok := b.Recipe.Header["library"]; ok {
+			libraryURL = customLib
+		}
+		libraryClient, err := client.NewClient(&client.Config{
+			BaseURL:   libraryURL,
+			AuthToken: b.Opts.LibraryAuthToken,
+		})
+		if err != nil {
+			return "", err
+		}
+		img, err := libraryClient.GetImage(context.TODO(), runtime.GOARCH, library.NormalizeLibraryRef(from))
+		if err != nil {
+			return "", err
+		}
+		return img.Hash, nil
+	case "oras":
+		return oras.ImageSHA("//"+from, b.Opts.DockerAuthConfig, nil)
+	case "shub":
+		ref, err := shub.ShubParseReference("shub://" + from)
+		if err != nil {
+			return "", err
+		}
+		manifest, err := shub.GetManifest(ref, b.Opts.NoHTTPS)
+		if err != nil {
+			return "", err
+		}
+		return manifest.Version, nil
+	}
+	return "", nil
+}
+
+// digestFiles writes the content of the sources to h, sources are read from
+// the build context directory contextDir if not empty.
+func digestFiles(h io.Writer, contextDir string, sources ...string) error {
+	f := types.Files{}
+	for _, src := range sources {
+		if contextDir != "" {
+			src = buildcontext.Resolve(contextDir, src)
+		}
+		f.Files = append(f.Files, types.FileTransport{Src: src})
+	}
+
+	d := types.Definition{}
+	d.BuildData.Files = []types.Files{f}
+
+	// the build context archive holds the content, permissions and
+	// modification times of the files in a deterministic order
+	bc, err := buildcontext.New(d)
+	if err != nil {
+		return err
+	}
+	if _, err := bc.WriteTo(h); err != nil {
+		return fmt.Errorf("while computing digest of %v: %s", sources, err)
+	}
+	return nil
+}
+
+// restoreStage populates the bundle of the stage s with the cached build
+// stage key, it returns false if the stage is not cached.
+func (b *Build) restoreStage(s *stage, key string) (bool, error) {
+	imgCache := b.Conf.Opts.ImgCache
+
+	exists, err := imgCache.BuildStageExists(key)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	dir := imgCache.BuildStage(key)
+	sylog.Debugf("Restoring build stage from %s", dir)
+
+	if err := copyTree(filepath.Join(dir, stageRootfs)+"/.", s.b.Rootfs()); err != nil {
+		return false, err
+	}
+
+	conf, err := ioutil.ReadFile(filepath.Join(dir, stageOCIConfig))
+	if err == nil {
+		s.b.JSONObjects["oci-config"] = conf
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("while reading cached OCI configuration: %s", err)
+	}
+
+	return true, nil
+}
+
+// storeStage stores the bundle of the stage s in the build cache with key.
+func (b *Build) storeStage(s *stage, key string) error {
+	imgCache := b.Conf.Opts.ImgCache
+
+	dir, err := imgCache.NewBuildStage(key)
+	if err != nil {
+		return fmt.Errorf("while creating build cache entry: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := copyTree(s.b.Rootfs(), filepath.Join(dir, stageRootfs)); err != nil {
+		return err
+	}
+	if conf, ok := s.b.JSONObjects["oci-config"]; ok {
+		if err := ioutil.WriteFile(filepath.Join(dir, stageOCIConfig), conf, 0644); err != nil {
+			return fmt.Errorf("while writing OCI configuration: %s", err)
+		}
+	}
+
+	sylog.Debugf("Storing build stage in %s", imgCache.BuildStage(key))
+	return imgCache.CommitBuildStage(key, dir)
+}
+
+// copyTree copies src to dst preserving ownership, permissions, links and
+// special files of the root filesystem.
+func copyTree(src, dst string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("/bin/cp", "-a", src, dst)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("while copying %s to %s: %s: %s", src, dst, err, stderr.String())
+	}
+	return nil
+}
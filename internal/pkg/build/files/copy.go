@@ -44,7 +44,7 @@ func makeParentDir(path string, numSrcPaths int) error {
 // before calling cp
 func Copy(src, dst string) error {
 	// resolve any bash globbing in filepath
-	paths, err := expandPath(src)
+	paths, err := ExpandPath(src)
 	if err != nil {
 		return fmt.Errorf("while expanding source path with bash: %s: %s", src, err)
 	}
@@ -18,7 +18,8 @@ const filenameExpansionScript = `for n in %[1]s ; do
 done
 `
 
-func expandPath(path string) ([]string, error) {
+// ExpandPath returns the paths matching path after shell filename expansion
+func ExpandPath(path string) ([]string, error) {
 	var output, stderr bytes.Buffer
 	cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf(filenameExpansionScript, path))
 	cmd.Stdout = &output
@@ -0,0 +1,312 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package layer extracts OCI image layers in their own directories, so
+// the layers of an image can be extracted concurrently, and merges the
+// extracted layers into a root filesystem following the image layer order.
+package layer
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	umocilayer "github.com/openSUSE/umoci/oci/layer"
+	"github.com/openSUSE/umoci/pkg/fseval"
+	"github.com/openSUSE/umoci/pkg/unpriv"
+	"github.com/pkg/errors"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	whPrefix = ".wh."
+	whOpaque = whPrefix + whPrefix + ".opq"
+)
+
+// Layer is an image layer extracted in its own directory, the whiteouts of
+// the layer are recorded to be applied to the lower layers by Merge.
+type Layer struct {
+	// Dir is the directory where the layer is extracted.
+	Dir string `json:"-"`
+	// Whiteouts are the paths removed from the lower layers.
+	Whiteouts []string `json:"whiteouts,omitempty"`
+	// Opaques are the directories whose content from the lower
+	// layers is removed.
+	Opaques []string `json:"opaques,omitempty"`
+	// Dirs are the directories with an entry in the layer, the other
+	// directories of Dir were only created to hold layer entries.
+	Dirs []string `json:"dirs,omitempty"`
+}
+
+// Extract extracts the layer tar archive read from r into the existing
+// directory dir with the ownership mapping opt. Whiteout entries are not
+// extracted but recorded in the returned layer.
+func Extract(dir string, r io.Reader, opt *umocilayer.MapOptions) (*Layer, error) {
+	l := &Layer{Dir: dir}
+
+	te := umocilayer.NewTarExtractor(*opt)
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading layer entry: %s", err)
+		}
+
+		name := filepath.Join("/", hdr.Name)
+		base := filepath.Base(name)
+
+		switch {
+		case base == whOpaque:
+			l.Opaques = append(l.Opaques, filepath.Dir(name))
+			continue
+		case strings.HasPrefix(base, whPrefix):
+			l.Whiteouts = append(l.Whiteouts, filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, whPrefix)))
+			continue
+		case hdr.Typeflag == tar.TypeDir:
+			l.Dirs = append(l.Dirs, name)
+		}
+
+		if err := te.UnpackEntry(dir, hdr, tr); err != nil {
+			return nil, fmt.Errorf("while extracting %s: %s", hdr.Name, err)
+		}
+	}
+
+	return l, nil
+}
+
+// merger moves the entries of an extracted layer into a root filesystem.
+type merger struct {
+	rootfs   string
+	layer    *Layer
+	dirs     map[string]bool
+	rootless bool
+	fsEval   fseval.FsEval
+}
+
+// Merge merges the extracted layer l into the root filesystem rootfs which
+// holds the lower layers, the layer entries are moved from the layer
+// directory. Unprivileged users extracting layers with a rootless mapping
+// set rootless to modify the directories they don't have access to.
+func Merge(rootfs string, l *Layer, rootless bool) error {
+	m := &merger{
+		rootfs:   rootfs,
+		layer:    l,
+		dirs:     make(map[string]bool, len(l.Dirs)),
+		rootless: rootless,
+		fsEval:   fseval.DefaultFsEval,
+	}
+	if rootless {
+		m.fsEval = fseval.RootlessFsEval
+	}
+	for _, d := range l.Dirs {
+		m.dirs[d] = true
+	}
+
+	// whiteouts only apply to the lower layers, they are processed
+	// before moving the layer entries
+	for _, path := range l.Opaques {
+		if err := m.clear(path); err != nil {
+			return fmt.Errorf("while applying opaque whiteout %s: %s", path, err)
+		}
+	}
+	for _, path := range l.Whiteouts {
+		if err := m.remove(path); err != nil {
+			return fmt.Errorf("while applying whiteout %s: %s", path, err)
+		}
+	}
+
+	return m.mergeDir("/", "/")
+}
+
+// resolve returns the absolute path of path in the root filesystem, the
+// symbolic links of its parent directories are evaluated within rootfs.
+func (m *merger) resolve(path string) string {
+	parent := fs.EvalRelative(filepath.Dir(path), m.rootfs)
+	return filepath.Join(m.rootfs, parent, filepath.Base(path))
+}
+
+// clear removes the content of the directory path.
+func (m *merger) clear(path string) error {
+	dir := filepath.Join(m.rootfs, fs.EvalRelative(path, m.rootfs))
+
+	fi, err := m.fsEval.Lstat(dir)
+	if isNotExist(err) || err == nil && !fi.IsDir() {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	entries, err := m.fsEval.Readdir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := m.fsEval.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNotExist returns whether err, which may be wrapped by the
+// rootless filesystem functions, reports a missing file.
+func isNotExist(err error) bool {
+	return os.IsNotExist(errors.Cause(err))
+}
+
+// remove removes path and its content.
+func (m *merger) remove(path string) error {
+	if filepath.Clean(path) == "/" {
+		return nil
+	}
+	return m.fsEval.RemoveAll(m.resolve(path))
+}
+
+// mergeDir merges the layer directory lpath into the root filesystem
+// directory rpath, both paths are relative to the layer and root
+// filesystem directories.
+func (m *merger) mergeDir(lpath, rpath string) error {
+	src := filepath.Join(m.layer.Dir, lpath)
+	dst := filepath.Join(m.rootfs, rpath)
+
+	// moving entries changes directory times, the metadata of a
+	// directory entry of the layer or the times of a directory only
+	// holding layer entries are set once its entries are moved
+	meta := dst
+	if m.dirs[lpath] {
+		meta = src
+	}
+	st, err := m.fsEval.Lstatx(meta)
+	if err != nil {
+		return err
+	}
+
+	entries, err := m.fsEval.Readdir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		lp := filepath.Join(lpath, e.Name())
+		rp := filepath.Join(rpath, e.Name())
+		target := filepath.Join(dst, e.Name())
+
+		fi, err := m.fsEval.Lstat(target)
+		if err != nil && !isNotExist(err) {
+			return err
+		}
+
+		if err == nil && e.IsDir() {
+			if fi.IsDir() {
+				if err := m.mergeDir(lp, rp); err != nil {
+					return err
+				}
+				continue
+			}
+			// a directory created to hold layer entries is merged in
+			// the directory pointed by a symbolic link at the same
+			// place, like it would be when extracted in the root
+			// filesystem, while a directory entry replaces the link
+			if fi.Mode()&os.ModeSymlink != 0 && !m.dirs[lp] {
+				resolved := fs.EvalRelative(rp, m.rootfs)
+				if rfi, err := m.fsEval.Lstat(filepath.Join(m.rootfs, resolved)); err == nil && rfi.IsDir() {
+					if err := m.mergeDir(lp, resolved); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+		}
+
+		if err == nil {
+			if err := m.fsEval.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+		if err := m.rename(filepath.Join(src, e.Name()), target, e); err != nil {
+			return err
+		}
+	}
+
+	if m.dirs[lpath] {
+		return m.applyMetadata(src, dst, &st)
+	}
+	ts := []unix.Timespec{st.Atim, st.Mtim}
+	return m.wrap(dst, func(path string) error {
+		return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+	})
+}
+
+// rename moves the layer entry src described by fi to dst.
+func (m *merger) rename(src, dst string, fi os.FileInfo) error {
+	if !m.rootless {
+		return os.Rename(src, dst)
+	}
+
+	// moving a directory to another parent directory updates
+	// its parent directory entry and requires write access
+	if fi.IsDir() && fi.Mode()&0200 == 0 {
+		if err := unpriv.Chmod(src, fi.Mode()|0200); err != nil {
+			return err
+		}
+		defer unpriv.Chmod(dst, fi.Mode())
+	}
+	return unpriv.Wrap(src, func(string) error {
+		return unpriv.Wrap(dst, func(string) error {
+			return os.Rename(src, dst)
+		})
+	})
+}
+
+// wrap calls fn with path, parent directories are made accessible
+// for unprivileged users when required.
+func (m *merger) wrap(path string, fn unpriv.WrapFunc) error {
+	if !m.rootless {
+		return fn(path)
+	}
+	return unpriv.Wrap(path, fn)
+}
+
+// applyMetadata sets the ownership, permissions and times st and the
+// extended attributes of the layer directory src to the root filesystem
+// directory dst.
+func (m *merger) applyMetadata(src, dst string, st *unix.Stat_t) error {
+	if !m.rootless {
+		if err := os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil {
+			return fmt.Errorf("while changing owner of %s: %s", dst, err)
+		}
+	}
+
+	names, err := m.fsEval.Llistxattr(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := m.fsEval.Lgetxattr(src, name)
+		if err == nil {
+			err = m.fsEval.Lsetxattr(dst, name, value, 0)
+		}
+		if err != nil {
+			sylog.Debugf("Could not set extended attribute %s of %s: %s", name, dst, err)
+		}
+	}
+
+	// chmod must occur after chown which clears setuid/setgid bits
+	return m.wrap(dst, func(path string) error {
+		if err := unix.Chmod(path, st.Mode&^unix.S_IFMT); err != nil {
+			return fmt.Errorf("while changing mode of %s: %s", path, err)
+		}
+		ts := []unix.Timespec{st.Atim, st.Mtim}
+		return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+	})
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package layer
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	umocilayer "github.com/openSUSE/umoci/oci/layer"
+	"github.com/openSUSE/umoci/pkg/idtools"
+	"github.com/openSUSE/umoci/pkg/unpriv"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+type entry struct {
+	name     string
+	typeflag byte
+	mode     int64
+	content  string
+}
+
+func archive(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Mode:     e.mode,
+			ModTime:  time.Unix(1000, 0),
+		}
+		switch e.typeflag {
+		case tar.TypeReg:
+			hdr.Size = int64(len(e.content))
+		case tar.TypeSymlink:
+			hdr.Linkname = e.content
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func mapOptions(t *testing.T) *umocilayer.MapOptions {
+	opt := new(umocilayer.MapOptions)
+	if os.Geteuid() == 0 {
+		return opt
+	}
+	opt.Rootless = true
+
+	uidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Geteuid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gidMap, err := idtools.ParseMapping(fmt.Sprintf("0:%d:1", os.Getegid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt.UIDMappings = append(opt.UIDMappings, uidMap)
+	opt.GIDMappings = append(opt.GIDMappings, gidMap)
+	return opt
+}
+
+func TestExtractMerge(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "layer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unpriv.RemoveAll(dir)
+
+	layers := [][]entry{
+		{
+			{"./", tar.TypeDir, 0755, ""},
+			{"etc/", tar.TypeDir, 0755, ""},
+			{"etc/a", tar.TypeReg, 0644, "a"},
+			{"etc/b", tar.TypeReg, 0644, "b"},
+			{"usr/", tar.TypeDir, 0755, ""},
+			{"usr/lib/", tar.TypeDir, 0755, ""},
+			{"usr/lib/x", tar.TypeReg, 0644, "x"},
+			{"lib", tar.TypeSymlink, 0777, "usr/lib"},
+			{"opt/", tar.TypeDir, 0755, ""},
+			{"opt/y", tar.TypeReg, 0644, "y"},
+			{"ro/", tar.TypeDir, 0555, ""},
+			{"ro/file", tar.TypeReg, 0644, "ro"},
+			{"keep", tar.TypeReg, 0644, "1"},
+		},
+		{
+			{"etc/.wh.a", tar.TypeReg, 0644, ""},
+			{"opt/", tar.TypeDir, 0700, ""},
+			{"opt/.wh..wh..opq", tar.TypeReg, 0644, ""},
+			{"opt/z", tar.TypeReg, 0644, "z"},
+			{"lib/libfoo", tar.TypeReg, 0644, "foo"},
+			{"ro/new", tar.TypeReg, 0644, "new"},
+			{"ro2/", tar.TypeDir, 0555, ""},
+			{"ro2/file", tar.TypeReg, 0644, "ro2"},
+			{"keep", tar.TypeReg, 0644, "2"},
+		},
+		{
+			{"etc/", tar.TypeDir, 0750, ""},
+			{"etc/c", tar.TypeReg, 0644, "c"},
+			{"etc/.wh.c", tar.TypeReg, 0644, ""},
+		},
+	}
+
+	extracted := make([]*Layer, len(layers))
+	for i, entries := range layers {
+		ldir := filepath.Join(dir, fmt.Sprintf("layer%d", i))
+		if err := os.Mkdir(ldir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		extracted[i], err = Extract(ldir, archive(t, entries), mapOptions(t))
+		if err != nil {
+			t.Fatalf("unexpected error while extracting layer %d: %s", i, err)
+		}
+	}
+
+	if l := extracted[1]; !reflect.DeepEqual(l.Whiteouts, []string{"/etc/a"}) || !reflect.DeepEqual(l.Opaques, []string{"/opt"}) {
+		t.Errorf("unexpected whiteouts %v and opaque whiteouts %v", l.Whiteouts, l.Opaques)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "layer1", "etc", ".wh.a")); !os.IsNotExist(err) {
+		t.Errorf("whiteout extracted in layer directory")
+	}
+
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range extracted {
+		if err := Merge(rootfs, l, os.Geteuid() != 0); err != nil {
+			t.Fatalf("unexpected error while merging layer %d: %s", i, err)
+		}
+	}
+
+	files := map[string]string{
+		"etc/b":          "b",
+		"etc/c":          "c",
+		"usr/lib/x":      "x",
+		"usr/lib/libfoo": "foo",
+		"opt/z":          "z",
+		"ro/file":        "ro",
+		"ro/new":         "new",
+		"ro2/file":       "ro2",
+		"keep":           "2",
+	}
+	for name, content := range files {
+		b, err := ioutil.ReadFile(filepath.Join(rootfs, name))
+		if err != nil {
+			t.Errorf("unexpected error while reading %s: %s", name, err)
+		} else if string(b) != content {
+			t.Errorf("unexpected %s content %q instead of %q", name, b, content)
+		}
+	}
+
+	for _, name := range []string{"etc/a", "opt/y"} {
+		if _, err := os.Lstat(filepath.Join(rootfs, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed by whiteout", name)
+		}
+	}
+
+	if fi, err := os.Lstat(filepath.Join(rootfs, "lib")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("lib symbolic link replaced")
+	}
+
+	modes := map[string]os.FileMode{
+		"etc": 0750,
+		"opt": 0700,
+		"ro":  0555,
+		"ro2": 0555,
+	}
+	for name, mode := range modes {
+		fi, err := os.Lstat(filepath.Join(rootfs, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != mode {
+			t.Errorf("%s has mode %o instead of %o", name, fi.Mode().Perm(), mode)
+		}
+		if !fi.ModTime().Equal(time.Unix(1000, 0)) {
+			t.Errorf("%s has modification time %s", name, fi.ModTime())
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
 )
@@ -26,6 +27,11 @@ func (s *stage) insertMetadata() error {
 		return fmt.Errorf("while inserting help script: %v", err)
 	}
 
+	// insert runscript arguments
+	if err := insertArguments(s.b); err != nil {
+		return fmt.Errorf("while inserting runscript arguments: %v", err)
+	}
+
 	// insert labels
 	if err := insertLabelsJSON(s.b); err != nil {
 		return fmt.Errorf("while inserting labels json: %v", err)
@@ -46,6 +52,11 @@ func (s *stage) insertMetadata() error {
 		return fmt.Errorf("while inserting startscript: %v", err)
 	}
 
+	// insert healthcheck
+	if err := insertHealthcheck(s.b); err != nil {
+		return fmt.Errorf("while inserting healthcheck: %v", err)
+	}
+
 	// insert runscript
 	if err := insertRunScript(s.b); err != nil {
 		return fmt.Errorf("while inserting runscript: %v", err)
@@ -132,6 +143,30 @@ func insertStartScript(b *types.Bundle) error {
 	return nil
 }
 
+// insertHealthcheck writes the healthcheck script, the section arguments
+// are the healthcheck parameters and not interpreter arguments
+func insertHealthcheck(b *types.Bundle) error {
+	if !b.RunSection("healthcheck") || b.Recipe.ImageData.Healthcheck.Script == "" {
+		return nil
+	}
+	sylog.Infof("Adding healthcheck")
+
+	config, err := instance.ParseHealthArgs(b.Recipe.ImageData.Healthcheck.Args)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(b.Rootfs(), instance.HealthcheckConfig), data, 0644); err != nil {
+		return err
+	}
+
+	shebang, script := handleShebangScript(types.Script{Script: b.Recipe.ImageData.Healthcheck.Script})
+	return ioutil.WriteFile(filepath.Join(b.Rootfs(), instance.HealthcheckScript), []byte(shebang+"\n\n"+script+"\n"), 0755)
+}
+
 func insertTestScript(b *types.Bundle) error {
 	if b.RunSection("test") && b.Recipe.ImageData.Test.Script != "" {
 		sylog.Infof("Adding testscript")
@@ -159,6 +194,17 @@ func insertHelpScript(b *types.Bundle) error {
 	return nil
 }
 
+func insertArguments(b *types.Bundle) error {
+	if b.RunSection("arguments") && b.Recipe.ImageData.Arguments.Script != "" {
+		sylog.Infof("Adding runscript arguments")
+		err := ioutil.WriteFile(filepath.Join(b.Rootfs(), "/.singularity.d/runscript.args"), []byte(b.Recipe.ImageData.Arguments.Script+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func insertDefinition(b *types.Bundle) error {
 	// if update, check for existing definition and move it to bootstrap history
 	if b.Opts.Update {
@@ -0,0 +1,246 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remotebuilder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/build/buildcontext"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+const (
+	// contextPath is the builder endpoint receiving build contexts
+	contextPath = "/v1/build-context"
+	// contextRequirement is the builder requirement referencing the
+	// uploaded build context of a build request
+	contextRequirement = "buildContext"
+	// defaultChunkSize is the size of the build context chunks when
+	// the builder doesn't impose one
+	defaultChunkSize = 16 << 20
+	// maxChunkRetries is the number of times a chunk upload is resumed
+	maxChunkRetries = 5
+)
+
+// errContextUnsupported is returned when the builder doesn't provide the
+// build context endpoint.
+var errContextUnsupported = errors.New("builder doesn't support build contexts")
+
+// contextUpload is the state of a build context upload returned by the
+// builder.
+type contextUpload struct {
+	ID        string `json:"id"`
+	ChunkSize int64  `json:"chunkSize,omitempty"`
+	Size      int64  `json:"size"`
+}
+
+// contextUploader uploads a build context by chunks, each chunk is
+// sent with a Content-Range header and can be resumed from the offset
+// reported by the builder when a request fails.
+type contextUploader struct {
+	rb         *RemoteBuilder
+	httpClient *http.Client
+	id         string
+	chunkSize  int64
+	// progress is called with the number of bytes sent
+	progress func(int64)
+	// retryDelay is the base delay between chunk upload attempts
+	retryDelay time.Duration
+}
+
+// uploadContext streams the build context bc to the builder and returns
+// the build context ID to reference in the build request.
+func (rb *RemoteBuilder) uploadContext(ctx context.Context, bc *buildcontext.BuildContext) (string, error) {
+	size, err := bc.Size()
+	if err != nil {
+		return "", fmt.Errorf("while computing build context size: %s", err)
+	}
+
+	bar := pb.New64(size).SetUnits(pb.U_BYTES)
+	bar.ShowTimeLeft = true
+	bar.ShowSpeed = true
+	bar.Start()
+	defer bar.Finish()
+
+	u := &contextUploader{
+		rb: rb,
+		// the build client timeout is too short to upload large chunks,
+		// the default transport keeps the connection alive between chunks
+		httpClient: &http.Client{},
+		progress:   func(n int64) { bar.Add64(n) },
+		retryDelay: time.Second,
+	}
+
+	sylog.Infof("Uploading build context (%d bytes)", size)
+	if err := u.create(ctx); err != nil {
+		return "", err
+	}
+	if err := u.upload(ctx, bc); err != nil {
+		return "", err
+	}
+	return u.id, nil
+}
+
+// create requests a new build context upload to the builder.
+func (u *contextUploader) create(ctx context.Context) error {
+	var up contextUpload
+	if err := u.do(ctx, http.MethodPost, "", nil, nil, &up); err == errContextUnsupported {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("while creating build context upload: %s", err)
+	}
+	if up.ID == "" {
+		return fmt.Errorf("builder returned an empty build context ID")
+	}
+	u.id = up.ID
+	u.chunkSize = up.ChunkSize
+	if u.chunkSize <= 0 {
+		u.chunkSize = defaultChunkSize
+	}
+	return nil
+}
+
+// upload generates the build context archive and sends it chunk by
+// chunk, only one chunk is held in memory.
+func (u *contextUploader) upload(ctx context.Context, bc *buildcontext.BuildContext) error {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := bc.WriteTo(pw)
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	chunk := make([]byte, u.chunkSize)
+	offset := int64(0)
+	for {
+		n, err := io.ReadFull(pr, chunk)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return fmt.Errorf("while generating build context: %s", err)
+		}
+		total := int64(-1)
+		if last {
+			total = offset + int64(n)
+		}
+		if err := u.sendChunk(ctx, chunk[:n], offset, total); err != nil {
+			return err
+		}
+		offset += int64(n)
+		if last {
+			return nil
+		}
+	}
+}
+
+// sendChunk sends data located at offset of the build context archive,
+// total is the archive size for the last chunk and -1 otherwise. On
+// failure the upload is resumed from the offset acknowledged by the
+// builder.
+func (u *contextUploader) sendChunk(ctx context.Context, data []byte, offset, total int64) error {
+	start := offset
+	var err error
+
+	for attempt := 0; attempt <= maxChunkRetries; attempt++ {
+		if attempt > 0 {
+			sylog.Debugf("Resuming build context upload at offset %d: %s", start, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * u.retryDelay):
+			}
+
+			var up contextUpload
+			if statusErr := u.do(ctx, http.MethodGet, u.id, nil, nil, &up); statusErr != nil {
+				err = statusErr
+				continue
+			}
+			if up.Size < offset || up.Size > offset+int64(len(data)) {
+				return fmt.Errorf("can't resume build context upload at offset %d: builder received %d bytes", start, up.Size)
+			}
+			if up.Size > start {
+				u.progress(up.Size - start)
+			}
+			start = up.Size
+		}
+
+		remaining := data[start-offset:]
+		if len(remaining) == 0 && total < 0 {
+			return nil
+		}
+
+		header := http.Header{}
+		if len(remaining) > 0 {
+			end := start + int64(len(remaining)) - 1
+			if total >= 0 {
+				header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+			} else {
+				header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, end))
+			}
+		} else {
+			// completes an archive whose size is a multiple of the chunk size
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+		}
+
+		err = u.do(ctx, http.MethodPut, u.id, header, bytes.NewReader(remaining), nil)
+		if err == nil {
+			u.progress(int64(len(remaining)))
+			return nil
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return fmt.Errorf("while uploading build context: %s", err)
+}
+
+// do sends a request to the build context endpoint and decodes the JSON
+// response into v if not nil.
+func (u *contextUploader) do(ctx context.Context, method, id string, header http.Header, body io.Reader, v interface{}) error {
+	bc := u.rb.BuildClient
+	ref := &url.URL{Path: path.Join(contextPath, id)}
+	req, err := http.NewRequest(method, bc.BaseURL.ResolveReference(ref).String(), body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	if bc.AuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("BEARER %s", bc.AuthToken))
+	}
+	if bc.UserAgent != "" {
+		req.Header.Set("User-Agent", bc.UserAgent)
+	}
+
+	res, err := u.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if method == http.MethodPost && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed) {
+		return errContextUnsupported
+	} else if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("builder returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	if v != nil {
+		return json.NewDecoder(res.Body).Decode(v)
+	}
+	return nil
+}
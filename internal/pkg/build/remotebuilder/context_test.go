@@ -0,0 +1,152 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remotebuilder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/build/buildcontext"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// contextServer is a builder receiving build contexts, one chunk
+// request out of two stores half of the data and fails.
+type contextServer struct {
+	sync.Mutex
+	data      bytes.Buffer
+	chunkSize int64
+	puts      int
+	complete  bool
+}
+
+func (s *contextServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		json.NewEncoder(w).Encode(contextUpload{ID: "ctx", ChunkSize: s.chunkSize})
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(contextUpload{ID: "ctx", Size: int64(s.data.Len())})
+	case http.MethodPut:
+		var start, end, total int64
+		cr := r.Header.Get("Content-Range")
+		if strings.HasPrefix(cr, "bytes */") {
+			fmt.Sscanf(cr, "bytes */%d", &total)
+			start, end = total, total-1
+		} else if strings.HasSuffix(cr, "/*") {
+			fmt.Sscanf(cr, "bytes %d-%d/*", &start, &end)
+			total = -1
+		} else {
+			fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &total)
+		}
+		if start != int64(s.data.Len()) {
+			http.Error(w, "bad offset", http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if int64(len(b)) != end-start+1 {
+			http.Error(w, "bad chunk size", http.StatusBadRequest)
+			return
+		}
+		s.puts++
+		if s.puts%2 == 1 && len(b) > 1 {
+			s.data.Write(b[:len(b)/2])
+			http.Error(w, "connection lost", http.StatusServiceUnavailable)
+			return
+		}
+		s.data.Write(b)
+		s.complete = total == int64(s.data.Len())
+	}
+}
+
+func TestUploadContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotebuilder-context-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 4; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i)}, 1000*(i+1))
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := types.Definition{}
+	d.BuildData.Files = []types.Files{{Files: []types.FileTransport{{Src: dir}}}}
+	bc, err := buildcontext.New(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var expected bytes.Buffer
+	if _, err := bc.WriteTo(&expected); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the archive size is a multiple of 512, 1024 bytes chunks test
+	// the empty final chunk
+	for _, chunkSize := range []int64{1024, 1000, 1 << 20} {
+		s := &contextServer{chunkSize: chunkSize}
+		srv := httptest.NewServer(s)
+
+		rb, err := New("", "", d, false, false, srv.URL, "token", runtime.GOARCH)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		sent := int64(0)
+		u := &contextUploader{
+			rb:         rb,
+			httpClient: srv.Client(),
+			progress:   func(n int64) { sent += n },
+		}
+		if err := u.create(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := u.upload(context.Background(), bc); err != nil {
+			t.Fatalf("unexpected error with %d bytes chunks: %s", chunkSize, err)
+		}
+		srv.Close()
+
+		if !s.complete {
+			t.Errorf("upload with %d bytes chunks not completed", chunkSize)
+		}
+		if !bytes.Equal(s.data.Bytes(), expected.Bytes()) {
+			t.Errorf("uploaded build context differs with %d bytes chunks", chunkSize)
+		}
+		if sent != int64(expected.Len()) {
+			t.Errorf("progress reported %d bytes, expected %d", sent, expected.Len())
+		}
+	}
+}
+
+func TestUploadContextUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	rb, err := New("", "", types.Definition{}, false, false, srv.URL, "", runtime.GOARCH)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	u := &contextUploader{rb: rb, httpClient: srv.Client()}
+	if err := u.create(context.Background()); err != errContextUnsupported {
+		t.Errorf("got error %v, expected %v", err, errContextUnsupported)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/pkg/errors"
 	buildclient "github.com/sylabs/scs-build-client/client"
 	client "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/build/buildcontext"
 	"github.com/sylabs/singularity/internal/pkg/library"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
@@ -88,11 +89,16 @@ func (rb *RemoteBuilder) Build(ctx context.Context) (err error) {
 		return fmt.Errorf("invalid library reference: %s", rb.ImagePath)
 	}
 
+	requirements, raw, err := rb.streamContext(ctx)
+	if err != nil {
+		return err
+	}
+
 	br := buildclient.BuildRequest{
 		LibraryRef:          libraryRef,
 		LibraryURL:          rb.LibraryURL,
-		DefinitionRaw:       rb.Definition.Raw,
-		BuilderRequirements: rb.BuilderRequirements,
+		DefinitionRaw:       raw,
+		BuilderRequirements: requirements,
 	}
 
 	bi, err := rb.BuildClient.Submit(ctx, br)
@@ -157,6 +163,39 @@ func (rb *RemoteBuilder) Build(ctx context.Context) (err error) {
 	return nil
 }
 
+// streamContext uploads the host files copied by the definition %files
+// sections and returns the builder requirements referencing them along
+// with the definition to submit, its sources are expanded on the host.
+func (rb *RemoteBuilder) streamContext(ctx context.Context) (map[string]string, []byte, error) {
+	bc, err := buildcontext.New(rb.Definition)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to collect build context")
+	}
+	if bc.Empty() {
+		return rb.BuilderRequirements, rb.Definition.Raw, nil
+	}
+	raw, err := bc.ExpandSources(rb.Definition.Raw)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to expand %files sources")
+	}
+
+	id, err := rb.uploadContext(ctx, bc)
+	if err == errContextUnsupported {
+		sylog.Warningf("Remote builder doesn't support build contexts, %%files sources won't be available")
+		return rb.BuilderRequirements, rb.Definition.Raw, nil
+	} else if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to upload build context")
+	}
+	sylog.Debugf("Build context uploaded with ID %s", id)
+
+	requirements := make(map[string]string, len(rb.BuilderRequirements)+1)
+	for k, v := range rb.BuilderRequirements {
+		requirements[k] = v
+	}
+	requirements[contextRequirement] = id
+	return requirements, raw, nil
+}
+
 // stdoutLogger implements the buildclient.OutputReader interface and writes
 // messages to stdout
 type stdoutLogger struct{}
@@ -18,6 +18,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/containers/image/copy"
 	"github.com/containers/image/docker"
@@ -29,11 +30,21 @@ import (
 	"github.com/containers/image/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	ociclient "github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/shell"
 	sytypes "github.com/sylabs/singularity/pkg/build/types"
 )
 
+// dockerHealthConfig is the healthcheck of a Docker image configuration
+type dockerHealthConfig struct {
+	Test        []string      `json:",omitempty"`
+	Interval    time.Duration `json:",omitempty"`
+	Timeout     time.Duration `json:",omitempty"`
+	StartPeriod time.Duration `json:",omitempty"`
+	Retries     int           `json:",omitempty"`
+}
+
 // OCIConveyorPacker holds stuff that needs to be packed into the bundle
 type OCIConveyorPacker struct {
 	srcRef    types.ImageReference
@@ -41,6 +52,7 @@ type OCIConveyorPacker struct {
 	tmpfsRef  types.ImageReference
 	policyCtx *signature.PolicyContext
 	imgConfig imgspecv1.ImageConfig
+	health    *dockerHealthConfig
 	sysCtx    *types.SystemContext
 }
 
@@ -141,6 +153,11 @@ func (cp *OCIConveyorPacker) Get(b *sytypes.Bundle) (err error) {
 		return err
 	}
 
+	cp.health, err = cp.getHealthcheck()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -166,6 +183,11 @@ func (cp *OCIConveyorPacker) Pack() (*sytypes.Bundle, error) {
 		return nil, fmt.Errorf("while inserting docker specific environment: %v", err)
 	}
 
+	err = cp.insertHealthcheck()
+	if err != nil {
+		return nil, fmt.Errorf("while inserting healthcheck: %v", err)
+	}
+
 	err = cp.insertOCIConfig()
 	if err != nil {
 		return nil, fmt.Errorf("while inserting oci config: %v", err)
@@ -175,7 +197,11 @@ func (cp *OCIConveyorPacker) Pack() (*sytypes.Bundle, error) {
 }
 
 func (cp *OCIConveyorPacker) fetch() (err error) {
-	// cp.srcRef contains the cache source reference
+	// cp.srcRef contains the cache source reference, when the cache is
+	// disabled layers are downloaded concurrently before the copy
+	if err := ociclient.PrefetchLayers(context.Background(), cp.tmpfsRef, cp.srcRef, cp.sysCtx); err != nil {
+		sylog.Debugf("Could not prefetch image layers: %s", err)
+	}
 	err = copy.Image(context.Background(), cp.policyCtx, cp.tmpfsRef, cp.srcRef, &copy.Options{
 		ReportWriter: ioutil.Discard,
 		SourceCtx:    cp.sysCtx,
@@ -202,6 +228,73 @@ func (cp *OCIConveyorPacker) getConfig() (imgspecv1.ImageConfig, error) {
 	return imgSpec.Config, nil
 }
 
+// getHealthcheck returns the healthcheck of Docker images, the OCI image
+// configuration has no healthcheck so it's read from the raw configuration
+func (cp *OCIConveyorPacker) getHealthcheck() (*dockerHealthConfig, error) {
+	img, err := cp.srcRef.NewImage(context.Background(), cp.sysCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	blob, err := img.ConfigBlob(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Config struct {
+			Healthcheck *dockerHealthConfig `json:",omitempty"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(blob, &config); err != nil {
+		sylog.Debugf("Could not decode image configuration: %s", err)
+		return nil, nil
+	}
+	return config.Config.Healthcheck, nil
+}
+
+// insertHealthcheck converts the image healthcheck into a healthcheck
+// script and its parameters
+func (cp *OCIConveyorPacker) insertHealthcheck() error {
+	if cp.health == nil || len(cp.health.Test) == 0 {
+		return nil
+	}
+
+	var script string
+	switch cp.health.Test[0] {
+	case "NONE":
+		return nil
+	case "CMD":
+		if len(cp.health.Test) < 2 {
+			return fmt.Errorf("no healthcheck command")
+		}
+		script = "exec " + shell.ArgsQuoted(cp.health.Test[1:])
+	case "CMD-SHELL":
+		if len(cp.health.Test) != 2 {
+			return fmt.Errorf("bad healthcheck shell command")
+		}
+		script = cp.health.Test[1]
+	default:
+		return fmt.Errorf("unknown healthcheck type %s", cp.health.Test[0])
+	}
+	sylog.Debugf("Adding image healthcheck %q", script)
+
+	data, err := json.Marshal(&instance.HealthConfig{
+		Interval:    cp.health.Interval,
+		Timeout:     cp.health.Timeout,
+		StartPeriod: cp.health.StartPeriod,
+		Retries:     cp.health.Retries,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(cp.b.Rootfs(), instance.HealthcheckConfig), data, 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cp.b.Rootfs(), instance.HealthcheckScript), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+}
+
 func (cp *OCIConveyorPacker) insertOCIConfig() error {
 	conf, err := json.Marshal(cp.imgConfig)
 	if err != nil {
@@ -29,7 +29,7 @@ func (cp *OrasConveyorPacker) Get(b *types.Bundle) (err error) {
 	// full uri for name determination and output
 	fullRef := "oras:" + ref
 
-	sum, err := oras.ImageSHA(ref, b.Opts.DockerAuthConfig)
+	sum, err := oras.ImageSHA(ref, b.Opts.DockerAuthConfig, nil)
 	if err != nil {
 		return fmt.Errorf("failed to get SHA of %v: %v", fullRef, err)
 	}
@@ -41,7 +41,7 @@ func (cp *OrasConveyorPacker) Get(b *types.Bundle) (err error) {
 	} else if !exists {
 		sylog.Infof("Downloading image with ORAS")
 
-		if err := oras.DownloadImage(cacheImagePath, ref, b.Opts.DockerAuthConfig); err != nil {
+		if err := oras.DownloadImage(cacheImagePath, ref, b.Opts.DockerAuthConfig, &oras.Options{Progress: &oras.ProgressBar{}}); err != nil {
 			return fmt.Errorf("unable to Download Image: %v", err)
 		}
 
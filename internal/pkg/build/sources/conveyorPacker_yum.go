@@ -329,7 +329,7 @@ func (c *YumConveyor) makePseudoDevices() (err error) {
 		d := int((dev.major << 8) | (dev.minor & 0xff) | ((dev.minor & 0xfff00) << 12))
 		path := filepath.Join(c.b.Rootfs(), dev.path)
 
-		if err := syscall.Mknod(path, dev.mode, d); err != nil {
+		if err := mknod(path, dev.mode, d); err != nil {
 			return fmt.Errorf("while creating %s: %s", path, err)
 		}
 	}
@@ -0,0 +1,17 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package sources
+
+import (
+	"fmt"
+)
+
+// mknod is not supported on this platform.
+func mknod(path string, mode uint32, dev int) error {
+	return fmt.Errorf("device nodes are not supported on this platform")
+}
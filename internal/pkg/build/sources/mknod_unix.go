@@ -0,0 +1,17 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package sources
+
+import (
+	"syscall"
+)
+
+// mknod creates a device node in the container root filesystem.
+func mknod(path string, mode uint32, dev int) error {
+	return syscall.Mknod(path, mode, dev)
+}
@@ -13,17 +13,58 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/apex/log"
 	"github.com/containers/image/types"
+	gzip "github.com/klauspost/pgzip"
 	"github.com/openSUSE/umoci"
+	"github.com/openSUSE/umoci/oci/casext"
 	umocilayer "github.com/openSUSE/umoci/oci/layer"
+	"github.com/openSUSE/umoci/pkg/fseval"
 	"github.com/openSUSE/umoci/pkg/idtools"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/build/layer"
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
 	sytypes "github.com/sylabs/singularity/pkg/build/types"
 )
 
-// unpackRootfs extracts all of the layers of the given image reference into the rootfs of the provided bundle
+// umociXattrRegexp matches the umoci warnings reporting the extended
+// attributes it couldn't restore while extracting a layer.
+var umociXattrRegexp = regexp.MustCompile(`^(?:rootless|xatt)\{(.+)\} ignoring .*xattr:? ("(?:[^"\\]|\\.)*")$`)
+
+// umociLogHandler records the extended attributes dropped by umoci and
+// forwards the other umoci messages to the debug output, layers being
+// extracted concurrently dropped is only accessed with mu held.
+func umociLogHandler(dropped xattr.Dropped, mu *sync.Mutex) log.Handler {
+	return log.HandlerFunc(func(e *log.Entry) error {
+		if m := umociXattrRegexp.FindStringSubmatch(e.Message); m != nil {
+			if name, err := strconv.Unquote(m[2]); err == nil {
+				mu.Lock()
+				dropped.Add(name, filepath.Join("/", m[1]))
+				mu.Unlock()
+				return nil
+			}
+		}
+		sylog.Debugf("umoci: %s", e.Message)
+		return nil
+	})
+}
+
+// unpackRootfs extracts all of the layers of the given image reference into the rootfs of the provided bundle,
+// layers are extracted concurrently in their own directory and merged into the rootfs in the image layer order
 func unpackRootfs(b *sytypes.Bundle, tmpfsRef types.ImageReference, sysCtx *types.SystemContext) (err error) {
 	var mapOptions umocilayer.MapOptions
 
@@ -64,9 +105,338 @@ func unpackRootfs(b *sytypes.Bundle, tmpfsRef types.ImageReference, sysCtx *type
 	var manifest imgspecv1.Manifest
 	json.Unmarshal(manifestData, &manifest)
 
-	// UnpackRootfs from umoci v0.4.2 expects a path to a non-existing directory
-	os.RemoveAll(b.Rootfs())
+	// Obtain the layer digests of the uncompressed layers
+	configBlob, err := engineExt.FromDescriptor(context.Background(), manifest.Config)
+	if err != nil {
+		return fmt.Errorf("error obtaining image config: %s", err)
+	}
+	config, ok := configBlob.Data.(imgspecv1.Image)
+	configBlob.Close()
+	if !ok {
+		return fmt.Errorf("error verifying image config media type: %s", configBlob.MediaType)
+	}
+	if config.RootFS.Type != "layers" {
+		return fmt.Errorf("unsupported image rootfs type: %s", config.RootFS.Type)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return fmt.Errorf("image config has %d layer digests for %d layers", len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	fsEval := fseval.DefaultFsEval
+	if mapOptions.Rootless {
+		fsEval = fseval.RootlessFsEval
+	}
+
+	// Start from an empty root filesystem with the same times as the
+	// one created by umoci, layers may not have a root directory entry
+	if err := fsEval.RemoveAll(b.Rootfs()); err != nil {
+		return fmt.Errorf("while removing %s: %s", b.Rootfs(), err)
+	}
+	if err := os.Mkdir(b.Rootfs(), 0755); err != nil {
+		return fmt.Errorf("while creating %s: %s", b.Rootfs(), err)
+	}
+	epoch := time.Unix(0, 0)
+	if err := os.Chtimes(b.Rootfs(), epoch, epoch); err != nil {
+		return fmt.Errorf("while setting %s times: %s", b.Rootfs(), err)
+	}
+	defer func() {
+		if err != nil {
+			fsEval.RemoveAll(b.Rootfs())
+		}
+	}()
+
+	staging, err := ioutil.TempDir(b.Path, "layers-")
+	if err != nil {
+		return fmt.Errorf("while creating layers directory: %s", err)
+	}
+	defer fsEval.RemoveAll(staging)
+
+	u := &layerUnpacker{
+		engine:     engineExt,
+		manifest:   manifest,
+		diffIDs:    config.RootFS.DiffIDs,
+		mapOptions: &mapOptions,
+		staging:    staging,
+		dropped:    make(xattr.Dropped),
+	}
+	if !b.Opts.NoCache && b.Opts.ImgCache != nil && b.Opts.ImgCache.Layers != "" {
+		// copying cached layers is only faster than extracting them
+		// when files share their content with the cached files
+		if err := checkReflink(b.Opts.ImgCache.Layers, staging); err != nil {
+			sylog.Debugf("Not using the layer cache: %s", err)
+		} else {
+			u.imgCache = b.Opts.ImgCache
+		}
+	}
+
+	log.SetHandler(umociLogHandler(u.dropped, &u.mu))
+	defer log.SetHandler(umociLogHandler(make(xattr.Dropped), new(sync.Mutex)))
+
+	if err := u.unpack(b.Rootfs()); err != nil {
+		return err
+	}
+	u.dropped.Warn()
+
+	return nil
+}
+
+// checkReflink returns an error if files of the directory src can't be
+// cloned into the directory dst, the probe files are removed.
+func checkReflink(src, dst string) error {
+	f, err := ioutil.TempFile(src, ".reflink-")
+	if err != nil {
+		return err
+	}
+	probe := f.Name()
+	defer os.Remove(probe)
+
+	_, err = f.WriteString("reflink")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	clone := filepath.Join(dst, filepath.Base(probe))
+	defer os.Remove(clone)
+
+	return fs.Reflink(probe, clone)
+}
+
+// layerUnpacker extracts image layers concurrently in their own directory
+// and merges the extracted layers into a root filesystem.
+type layerUnpacker struct {
+	engine     casext.Engine
+	manifest   imgspecv1.Manifest
+	diffIDs    []digest.Digest
+	mapOptions *umocilayer.MapOptions
+	staging    string
+	// imgCache holds the cached layers, it's nil when the layer
+	// cache is not used
+	imgCache *cache.Handle
+
+	mu      sync.Mutex
+	dropped xattr.Dropped
+}
 
-	// Unpack root filesystem
-	return umocilayer.UnpackRootfs(context.Background(), engineExt, b.Rootfs(), manifest, &mapOptions)
+// unpack extracts the image layers with a bounded number of workers and
+// merges each layer into rootfs as soon as it and the layers below it
+// are extracted.
+func (u *layerUnpacker) unpack(rootfs string) error {
+	n := len(u.manifest.Layers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		l   *layer.Layer
+		err error
+	}
+	results := make([]chan result, n)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	jobs := make(chan int)
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var r result
+				if r.err = ctx.Err(); r.err == nil {
+					r.l, r.err = u.extract(ctx, i)
+				}
+				results[i] <- r
+			}
+		}()
+	}
+	// layers are handed to workers in order, so the lowest layers
+	// which are merged first are extracted first
+	go func() {
+		for i := 0; i < n; i++ {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+	// workers must be done with the layer directories before they
+	// are removed
+	defer wg.Wait()
+
+	for i := 0; i < n; i++ {
+		r := <-results[i]
+		if r.err != nil {
+			cancel()
+			return fmt.Errorf("while extracting layer %s: %s", u.manifest.Layers[i].Digest, r.err)
+		}
+		sylog.Debugf("Merging layer %s", u.manifest.Layers[i].Digest)
+		if err := layer.Merge(rootfs, r.l, u.mapOptions.Rootless); err != nil {
+			cancel()
+			return fmt.Errorf("while merging layer %s: %s", u.manifest.Layers[i].Digest, err)
+		}
+	}
+	return nil
+}
+
+// extract extracts the i-th image layer in its own directory, from the
+// layer cache when the layer is cached.
+func (u *layerUnpacker) extract(ctx context.Context, i int) (*layer.Layer, error) {
+	desc := u.manifest.Layers[i]
+	dir := filepath.Join(u.staging, strconv.Itoa(i))
+
+	key := desc.Digest.Encoded()
+	if u.mapOptions.Rootless {
+		key += "-rootless"
+	}
+
+	if u.imgCache != nil {
+		if exists, err := u.imgCache.LayerExists(key); err == nil && exists {
+			l, err := u.fromCache(u.imgCache.Layer(key), dir)
+			if err == nil {
+				sylog.Debugf("Using cached layer %s", desc.Digest)
+				return l, nil
+			}
+			sylog.Debugf("Could not use cached layer %s: %s", desc.Digest, err)
+			if err := u.removeAll(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	l, err := u.fromBlob(ctx, desc, u.diffIDs[i], dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.imgCache != nil {
+		if err := u.toCache(key, l); err != nil {
+			sylog.Debugf("Could not cache layer %s: %s", desc.Digest, err)
+		}
+	}
+	return l, nil
+}
+
+// fromBlob extracts the layer blob desc into dir and verifies that the
+// uncompressed layer digest is diffID.
+func (u *layerUnpacker) fromBlob(ctx context.Context, desc imgspecv1.Descriptor, diffID digest.Digest, dir string) (*layer.Layer, error) {
+	sylog.Debugf("Extracting layer %s", desc.Digest)
+
+	blob, err := u.engine.FromDescriptor(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	var compressed bool
+	switch blob.MediaType {
+	case imgspecv1.MediaTypeImageLayer, imgspecv1.MediaTypeImageLayerNonDistributable:
+	case imgspecv1.MediaTypeImageLayerGzip, imgspecv1.MediaTypeImageLayerNonDistributableGzip:
+		compressed = true
+	default:
+		return nil, fmt.Errorf("unsupported layer media type %s", blob.MediaType)
+	}
+	data, ok := blob.Data.(io.ReadCloser)
+	if !ok {
+		return nil, fmt.Errorf("unexpected layer data type %T", blob.Data)
+	}
+
+	var r io.Reader = data
+	if compressed {
+		gz, err := gzip.NewReader(data)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	digester := digest.SHA256.Digester()
+	r = io.TeeReader(r, digester.Hash())
+
+	l, err := layer.Extract(dir, r, u.mapOptions)
+	if err != nil {
+		return nil, err
+	}
+	// the tar reader may not consume the archive padding
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return nil, err
+	}
+	if digester.Digest() != diffID {
+		return nil, fmt.Errorf("layer digest mismatch: got %s expected %s", digester.Digest(), diffID)
+	}
+	return l, nil
+}
+
+// layerMetadata is the file of a cached layer directory holding
+// the layer whiteouts.
+const layerMetadata = "layer.json"
+
+// fromCache copies the cached layer directory cached into dir.
+func (u *layerUnpacker) fromCache(cached, dir string) (*layer.Layer, error) {
+	b, err := ioutil.ReadFile(filepath.Join(cached, layerMetadata))
+	if err != nil {
+		return nil, err
+	}
+	l := &layer.Layer{Dir: dir}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	dropped, err := fs.CopyTree(filepath.Join(cached, "rootfs"), dir)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	u.dropped.Merge(dropped)
+	u.mu.Unlock()
+
+	return l, nil
+}
+
+// toCache copies the extracted layer l into the layer cache with key.
+func (u *layerUnpacker) toCache(key string, l *layer.Layer) error {
+	dir, err := u.imgCache.NewLayer(key)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(l)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, layerMetadata), b, 0644)
+	}
+	if err == nil {
+		err = os.Mkdir(filepath.Join(dir, "rootfs"), 0755)
+	}
+	if err == nil {
+		// attributes dropped here were already dropped
+		// when the layer was extracted
+		_, err = fs.CopyTree(l.Dir, filepath.Join(dir, "rootfs"))
+	}
+	if err != nil {
+		u.removeAll(dir)
+		return err
+	}
+	return u.imgCache.CommitLayer(key, dir)
+}
+
+// removeAll removes path, including directories without write
+// permission for unprivileged users.
+func (u *layerUnpacker) removeAll(path string) error {
+	if u.mapOptions.Rootless {
+		return fseval.RootlessFsEval.RemoveAll(path)
+	}
+	return os.RemoveAll(path)
 }
@@ -0,0 +1,194 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	oci "github.com/containers/image/oci/layout"
+	"github.com/containers/image/types"
+	"github.com/openSUSE/umoci/pkg/unpriv"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	sytypes "github.com/sylabs/singularity/pkg/build/types"
+)
+
+// writeBlob writes content in the blobs directory of the OCI layout dir
+// and returns its descriptor.
+func writeBlob(t *testing.T, dir, mediaType string, content []byte) imgspecv1.Descriptor {
+	d := digest.FromBytes(content)
+	blobs := filepath.Join(dir, "blobs", string(d.Algorithm()))
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blobs, d.Encoded()), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(content))}
+}
+
+func writeJSON(t *testing.T, dir, mediaType string, v interface{}) imgspecv1.Descriptor {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeBlob(t, dir, mediaType, b)
+}
+
+// writeImage writes an image with the given layers, mapping file paths to
+// their content, in the OCI layout dir with the tag "tmp".
+func writeImage(t *testing.T, dir string, layers []map[string]string) {
+	config := imgspecv1.Image{
+		OS:     "linux",
+		RootFS: imgspecv1.RootFS{Type: "layers"},
+	}
+	manifest := imgspecv1.Manifest{Versioned: specs.Versioned{SchemaVersion: 2}}
+
+	for _, files := range layers {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		for name, content := range files {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, digest.FromBytes(buf.Bytes()))
+
+		gz := new(bytes.Buffer)
+		zw := gzip.NewWriter(gz)
+		if _, err := zw.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		manifest.Layers = append(manifest.Layers, writeBlob(t, dir, imgspecv1.MediaTypeImageLayerGzip, gz.Bytes()))
+	}
+
+	manifest.Config = writeJSON(t, dir, imgspecv1.MediaTypeImageConfig, config)
+	desc := writeJSON(t, dir, imgspecv1.MediaTypeImageManifest, manifest)
+	desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: "tmp"}
+
+	index := imgspecv1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []imgspecv1.Descriptor{desc},
+	}
+	b, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err = json.Marshal(imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, imgspecv1.ImageLayoutFile), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpackRootfs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	b, err := sytypes.NewBundle("", "oci-unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unpriv.RemoveAll(b.Path)
+
+	writeImage(t, b.Path, []map[string]string{
+		{"etc/a": "a", "etc/b": "b", "bin/sh": "sh"},
+		{"etc/.wh.a": "", "etc/c": "c"},
+		{"etc/b": "b2", "usr/bin/tool": "tool"},
+		{"bin/.wh.sh": ""},
+	})
+
+	ref, err := oci.ParseReference(b.Path + ":tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unpackRootfs(b, ref, &types.SystemContext{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	files := map[string]string{
+		"etc/b":        "b2",
+		"etc/c":        "c",
+		"usr/bin/tool": "tool",
+	}
+	for name, content := range files {
+		b, err := ioutil.ReadFile(filepath.Join(b.Rootfs(), name))
+		if err != nil {
+			t.Errorf("unexpected error while reading %s: %s", name, err)
+		} else if string(b) != content {
+			t.Errorf("unexpected %s content %q instead of %q", name, b, content)
+		}
+	}
+	for _, name := range []string{"etc/a", "bin/sh"} {
+		if _, err := os.Lstat(filepath.Join(b.Rootfs(), name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed by whiteout", name)
+		}
+	}
+
+	// the layer directories are removed
+	matches, err := filepath.Glob(filepath.Join(b.Path, "layers-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("layer directories %v not removed", matches)
+	}
+}
+
+func TestCheckReflink(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	src, err := ioutil.TempDir("", "reflink-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "reflink-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	// the result depends on the filesystem, only probe files matter
+	if err := checkReflink(src, dst); err != nil {
+		t.Logf("reflinks not supported: %s", err)
+	}
+
+	for _, dir := range []string{src, dst} {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			t.Errorf("probe file %s left in %s", e.Name(), dir)
+		}
+	}
+}
@@ -7,6 +7,8 @@
 // its own separate package. With that change, this file should be grouped with the
 // OCIConveyorPacker code
 
+// +build !linux
+
 package sources
 
 import (
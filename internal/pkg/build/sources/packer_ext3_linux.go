@@ -67,7 +67,7 @@ func (p *Ext3Packer) unpackExt3(b *types.Bundle, info *loop.Info64, rootfs strin
 		return fmt.Errorf("while copying files: %v: %v", err, stderr.String())
 	}
 
-	return err
+	return preserveXattrs(tmpmnt, b.Rootfs())
 }
 
 // getLoopDevice attaches a loop device with the specified arguments
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
 	"github.com/sylabs/singularity/pkg/build/types"
 )
 
@@ -34,5 +35,21 @@ func (p *SandboxPacker) Pack() (*types.Bundle, error) {
 		return nil, fmt.Errorf("cp Failed: %v: %v", err, stderr.String())
 	}
 
+	if err := preserveXattrs(rootfs, p.b.Rootfs()); err != nil {
+		return nil, err
+	}
+
 	return p.b, nil
 }
+
+// preserveXattrs copies the extended attributes of the files of src to
+// the files copied by cp in dst, attributes which can't be set by the
+// current user are reported in a warning.
+func preserveXattrs(src, dst string) error {
+	dropped, err := xattr.CopyTree(src, dst)
+	if err != nil {
+		return fmt.Errorf("while copying extended attributes: %v", err)
+	}
+	dropped.Warn()
+	return nil
+}
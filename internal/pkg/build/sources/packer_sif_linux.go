@@ -11,8 +11,10 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"syscall"
 
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/image"
@@ -79,16 +81,27 @@ func (p *SIFPacker) unpackSIF(b *types.Bundle, srcfile string) (err error) {
 	return nil
 }
 
+// loopStateDir records the loop devices attached to unpack image partitions,
+// devices leaked by an interrupted build are detached by the next one.
+var loopStateDir = filepath.Join(buildcfg.RUNSTATEDIR, "singularity", "loop")
+
 // unpackImagePartition temporarily mounts an image parition using a loop device and then copies its contents to the destination directory
 func unpackImagePartition(src *os.File, dest, mountType string, info *loop.Info64) (err error) {
-	number := 0
-	loopdev := new(loop.Device)
-	loopdev.MaxLoopDevices = 256
-	loopdev.Info = info
+	manager, err := loop.NewManager(&loop.Device{Info: info}, loopStateDir)
+	if err != nil {
+		return err
+	}
+	if detached, err := manager.GC(); err != nil {
+		sylog.Warningf("Could not detach leaked loop devices: %s", err)
+	} else if len(detached) > 0 {
+		sylog.Debugf("Detached leaked loop devices %v", detached)
+	}
 
-	if err := loopdev.AttachFromFile(src, os.O_RDONLY, &number); err != nil {
+	number, err := manager.Attach(src, os.O_RDONLY)
+	if err != nil {
 		return err
 	}
+	defer manager.Detach(number)
 
 	tmpmnt, err := ioutil.TempDir("", "tmpmnt-")
 	if err != nil {
@@ -114,5 +127,5 @@ func unpackImagePartition(src *os.File, dest, mountType string, info *loop.Info6
 		return fmt.Errorf("cp failed: %v: %v", err, stderr.String())
 	}
 
-	return nil
+	return preserveXattrs(tmpmnt, dest)
 }
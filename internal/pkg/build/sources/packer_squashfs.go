@@ -13,6 +13,7 @@ import (
 	"strconv"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/util/loop"
 )
@@ -62,6 +63,7 @@ func (p *SquashfsPacker) unpackSquashfs(b *types.Bundle, info *loop.Info64, root
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("unsquashfs Failed: %v: %v", err, stderr.String())
 	}
+	xattr.ParseSquashfsOutput(stderr.Bytes(), b.Rootfs()).Warn()
 
 	return err
 }
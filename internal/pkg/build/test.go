@@ -0,0 +1,74 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/util/namespaces"
+)
+
+// testTimeoutExitCode is the exit code of the test command when the
+// test didn't complete in time.
+const testTimeoutExitCode = 124
+
+// isolatedTestRequired returns true if the %test section of the bundle
+// must be run in an isolated container.
+func isolatedTestRequired(b *types.Bundle) bool {
+	return b.Opts.TestIsolated && !b.Opts.NoTest && b.RunSection("test") && b.Recipe.BuildData.Test.Script != ""
+}
+
+// isolatedTestArgs returns the arguments of the test command running
+// the test script of rootfs in a contained environment with new PID,
+// IPC and network namespaces, like the test command with --contain and
+// --isolated options. A user namespace is requested when the build runs
+// in a user namespace, with --fakeroot.
+func isolatedTestArgs(rootfs string, timeout int, userns bool) []string {
+	args := []string{"test", "--contain", "--isolated"}
+	if userns {
+		args = append(args, "--userns")
+	}
+	if timeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(timeout))
+	}
+	return append(args, rootfs)
+}
+
+// runIsolatedTest runs the %test section of the bundle with the test
+// command, the test script is executed by the starter like for the
+// built image.
+func runIsolatedTest(b *types.Bundle) error {
+	sylog.Infof("Running isolated test scriptlet")
+
+	userns, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+
+	singularity := filepath.Join(buildcfg.BINDIR, "singularity")
+	cmd := exec.Command(singularity, isolatedTestArgs(b.Rootfs(), b.Opts.TestTimeout, userns)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		status := exitErr.Sys().(syscall.WaitStatus)
+		if b.Opts.TestTimeout > 0 && status.ExitStatus() == testTimeoutExitCode {
+			return fmt.Errorf("%%test proc didn't complete within %d seconds", b.Opts.TestTimeout)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute %%test proc: %v", err)
+	}
+	return nil
+}
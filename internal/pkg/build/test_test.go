@@ -0,0 +1,64 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestIsolatedTestRequired(t *testing.T) {
+	test := types.Script{Script: "true"}
+	all := []string{"all"}
+
+	tests := []struct {
+		name     string
+		opts     types.Options
+		test     types.Script
+		required bool
+	}{
+		{"NotIsolated", types.Options{Sections: all}, test, false},
+		{"Isolated", types.Options{TestIsolated: true, Sections: all}, test, true},
+		{"NoTest", types.Options{TestIsolated: true, NoTest: true, Sections: all}, test, false},
+		{"NoTestSection", types.Options{TestIsolated: true, Sections: all}, types.Script{}, false},
+		{"OtherSection", types.Options{TestIsolated: true, Sections: []string{"post"}}, test, false},
+		{"TestSection", types.Options{TestIsolated: true, Sections: []string{"test"}}, test, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &types.Bundle{Opts: tt.opts}
+			b.Recipe.BuildData.Test = tt.test
+			if required := isolatedTestRequired(b); required != tt.required {
+				t.Errorf("got %t, expected %t", required, tt.required)
+			}
+		})
+	}
+}
+
+func TestIsolatedTestArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  int
+		userns   bool
+		expected string
+	}{
+		{"Default", 0, false, "test --contain --isolated /rootfs"},
+		{"Timeout", 30, false, "test --contain --isolated --timeout 30 /rootfs"},
+		{"UserNamespace", 0, true, "test --contain --isolated --userns /rootfs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := strings.Join(isolatedTestArgs("/rootfs", tt.timeout, tt.userns), " ")
+			if args != tt.expected {
+				t.Errorf("got %q, expected %q", args, tt.expected)
+			}
+		})
+	}
+}
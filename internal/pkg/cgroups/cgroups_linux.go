@@ -8,6 +8,8 @@ package cgroups
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -15,11 +17,13 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
-// Manager manage container cgroup resources restriction
+// Manager manage container cgroup resources restriction, the cgroups v2
+// unified hierarchy is used when available instead of the v1 hierarchies
 type Manager struct {
-	Path   string
-	Pid    int
-	cgroup cgroups.Cgroup
+	Path    string
+	Pid     int
+	cgroup  cgroups.Cgroup
+	unified *unifiedCgroup
 }
 
 func readSpecFromFile(path string) (spec specs.LinuxResources, err error) {
@@ -43,6 +47,9 @@ func readSpecFromFile(path string) (spec specs.LinuxResources, err error) {
 
 // GetCgroupRootPath returns cgroup root path
 func (m *Manager) GetCgroupRootPath() string {
+	if m.unified != nil {
+		return unifiedMountPoint
+	}
 	if m.cgroup == nil {
 		return ""
 	}
@@ -75,6 +82,13 @@ func (m *Manager) ApplyFromSpec(spec *specs.LinuxResources) (err error) {
 		s = &specs.LinuxResources{}
 	}
 
+	if IsUnified() {
+		if m.unified, err = newUnified(m.Path, s); err != nil {
+			return err
+		}
+		return m.unified.add(m.Pid)
+	}
+
 	// creates cgroup
 	m.cgroup, err = cgroups.New(cgroups.V1, path, s)
 	if err != nil {
@@ -102,18 +116,29 @@ func (m *Manager) loadFromPid() (err error) {
 	if m.Pid == 0 {
 		return fmt.Errorf("no process ID specified")
 	}
+	if IsUnified() {
+		m.unified, err = loadUnified(m.Pid)
+		return
+	}
 	path := cgroups.PidPath(m.Pid)
 	m.cgroup, err = cgroups.Load(cgroups.V1, path)
 	return
 }
 
+func (m *Manager) loaded() bool {
+	return m.cgroup != nil || m.unified != nil
+}
+
 // UpdateFromSpec updates cgroups resources restriction from OCI specification
 func (m *Manager) UpdateFromSpec(spec *specs.LinuxResources) (err error) {
-	if m.cgroup == nil {
+	if !m.loaded() {
 		if err = m.loadFromPid(); err != nil {
 			return
 		}
 	}
+	if m.unified != nil {
+		return m.unified.update(spec)
+	}
 	err = m.cgroup.Update(spec)
 	return
 }
@@ -130,25 +155,94 @@ func (m *Manager) UpdateFromFile(path string) error {
 // Remove removes resources restriction for current managed process
 func (m *Manager) Remove() error {
 	// deletes subgroup
+	if m.unified != nil {
+		return m.unified.delete()
+	}
 	return m.cgroup.Delete()
 }
 
 // Pause suspends all processes inside the container
 func (m *Manager) Pause() error {
-	if m.cgroup == nil {
+	if !m.loaded() {
 		if err := m.loadFromPid(); err != nil {
 			return err
 		}
 	}
+	if m.unified != nil {
+		return m.unified.freeze(true)
+	}
 	return m.cgroup.Freeze()
 }
 
 // Resume resumes all processes that have been previously paused
 func (m *Manager) Resume() error {
-	if m.cgroup == nil {
+	if !m.loaded() {
 		if err := m.loadFromPid(); err != nil {
 			return err
 		}
 	}
+	if m.unified != nil {
+		return m.unified.freeze(false)
+	}
 	return m.cgroup.Thaw()
 }
+
+// Stats holds the resource usage of the processes of a cgroup
+type Stats struct {
+	// MemoryUsage is the memory usage in bytes
+	MemoryUsage uint64
+	// MemoryLimit is the memory limit in bytes, 0 means no limit
+	MemoryLimit uint64
+	// CPUUsage is the CPU time consumed in nanoseconds
+	CPUUsage uint64
+	// Pids is the number of processes
+	Pids uint64
+	// BlkioRead is the number of bytes read from block devices
+	BlkioRead uint64
+	// BlkioWrite is the number of bytes written to block devices
+	BlkioWrite uint64
+}
+
+// Stats returns the resource usage of all processes inside the container
+func (m *Manager) Stats() (*Stats, error) {
+	if !m.loaded() {
+		if err := m.loadFromPid(); err != nil {
+			return nil, err
+		}
+	}
+	if m.unified != nil {
+		return m.unified.stats()
+	}
+
+	metrics, err := m.cgroup.Stat(cgroups.IgnoreNotExist)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	if metrics.Memory != nil && metrics.Memory.Usage != nil {
+		stats.MemoryUsage = metrics.Memory.Usage.Usage
+		// no limit is reported as the maximum page counter value
+		unlimited := uint64(math.MaxInt64) &^ uint64(os.Getpagesize()-1)
+		if l := metrics.Memory.Usage.Limit; l < unlimited {
+			stats.MemoryLimit = l
+		}
+	}
+	if metrics.CPU != nil && metrics.CPU.Usage != nil {
+		stats.CPUUsage = metrics.CPU.Usage.Total
+	}
+	if metrics.Pids != nil {
+		stats.Pids = metrics.Pids.Current
+	}
+	if metrics.Blkio != nil {
+		for _, e := range metrics.Blkio.IoServiceBytesRecursive {
+			switch e.Op {
+			case "Read":
+				stats.BlkioRead += e.Value
+			case "Write":
+				stats.BlkioWrite += e.Value
+			}
+		}
+	}
+	return stats, nil
+}
@@ -62,14 +62,20 @@ func TestCgroups(t *testing.T) {
 		t.Fatalf("can't determine cgroups root path, is cgroups enabled ?")
 	}
 
+	// CPU shares are converted to a CPU weight with the unified hierarchy
 	cpuShares := filepath.Join(rootPath, "cpu", path, "cpu.shares")
+	shares := func(v uint64) int64 { return int64(v) }
+	if IsUnified() {
+		cpuShares = filepath.Join(rootPath, path, "cpu.weight")
+		shares = func(v uint64) int64 { return int64(cpuWeight(v)) }
+	}
 
 	i, err := readIntFromFile(cpuShares)
 	if err != nil {
 		t.Errorf("failed to read %s: %s", cpuShares, err)
 	}
-	if i != 1024 {
-		t.Errorf("cpu shares should be equal to 1024")
+	if i != shares(1024) {
+		t.Errorf("cpu shares should be equal to %d", shares(1024))
 	}
 
 	content := []byte("[cpu]\nshares = 512")
@@ -97,8 +103,8 @@ func TestCgroups(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to read %s: %s", cpuShares, err)
 	}
-	if i != 512 {
-		t.Errorf("cpu shares should be equal to 512")
+	if i != shares(512) {
+		t.Errorf("cpu shares should be equal to %d", shares(512))
 	}
 
 	pipe.Close()
@@ -142,11 +148,17 @@ func TestPauseResume(t *testing.T) {
 		t.Error(err)
 	}
 
+	// frozen processes are sleeping with the unified hierarchy
+	frozenState := "State:\tD"
+	if IsUnified() {
+		frozenState = "State:\tS"
+	}
+
 	scanner := bufio.NewScanner(file)
 	stateOk := false
 
 	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), "State:\tD") {
+		if strings.HasPrefix(scanner.Text(), frozenState) {
 			stateOk = true
 			break
 		}
@@ -0,0 +1,324 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"unsafe"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// eBPF instruction codes used by device filter programs
+const (
+	bpfLdxMemW  = unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W
+	bpfAnd32K   = unix.BPF_ALU | unix.BPF_AND | unix.BPF_K
+	bpfRsh32K   = unix.BPF_ALU | unix.BPF_RSH | unix.BPF_K
+	bpfMov32X   = unix.BPF_ALU | unix.BPF_MOV | unix.BPF_X
+	bpfMov64K   = unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K
+	bpfJneK     = unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K
+	bpfJneX     = unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X
+	bpfExit     = unix.BPF_JMP | unix.BPF_EXIT
+	bpfInsnSize = 8
+	bpfMaxInsns = 4096
+)
+
+const (
+	bpfLogSize = 1 << 16
+	bpfLicense = "BSD\x00"
+)
+
+// bpfInsn is an eBPF instruction.
+type bpfInsn struct {
+	code uint8
+	dst  uint8
+	src  uint8
+	off  int16
+	imm  int32
+}
+
+// bpfProgLoadAttr is the bpf_attr structure of BPF_PROG_LOAD.
+type bpfProgLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+}
+
+// bpfProgAttachAttr is the bpf_attr structure of BPF_PROG_ATTACH
+// and BPF_PROG_DETACH.
+type bpfProgAttachAttr struct {
+	targetFd    uint32
+	attachBpfFd uint32
+	attachType  uint32
+	attachFlags uint32
+}
+
+// bpfProgQueryAttr is the bpf_attr structure of BPF_PROG_QUERY.
+type bpfProgQueryAttr struct {
+	targetFd    uint32
+	attachType  uint32
+	queryFlags  uint32
+	attachFlags uint32
+	progIds     uint64
+	progCnt     uint32
+}
+
+// bpfGetFdByIDAttr is the bpf_attr structure of BPF_PROG_GET_FD_BY_ID.
+type bpfGetFdByIDAttr struct {
+	id        uint32
+	nextID    uint32
+	openFlags uint32
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(r), nil
+}
+
+// deviceFilter returns the eBPF program enforcing the device access
+// rules. Like with the cgroups v1 devices controller, the last rule
+// matching a device decides whether the access is allowed and access
+// to devices matching no rule is denied.
+//
+// The program context is the bpf_cgroup_dev_ctx structure holding the
+// device type and the requested access, followed by the device major
+// and minor numbers.
+func deviceFilter(devices []specs.LinuxDeviceCgroup) ([]bpfInsn, error) {
+	insns := []bpfInsn{
+		// r2 = device type
+		{code: bpfLdxMemW, dst: 2, src: 1, off: 0},
+		{code: bpfAnd32K, dst: 2, imm: 0xffff},
+		// r3 = requested access
+		{code: bpfLdxMemW, dst: 3, src: 1, off: 0},
+		{code: bpfRsh32K, dst: 3, imm: 16},
+		// r4 = major, r5 = minor
+		{code: bpfLdxMemW, dst: 4, src: 1, off: 4},
+		{code: bpfLdxMemW, dst: 5, src: 1, off: 8},
+	}
+
+	for i := len(devices) - 1; i >= 0; i-- {
+		block, matchAll, err := deviceRule(devices[i])
+		if err != nil {
+			return nil, err
+		}
+		insns = append(insns, block...)
+		// the verifier rejects unreachable instructions
+		if matchAll {
+			return checkInsns(insns)
+		}
+	}
+
+	// deny access to devices matching no rule
+	insns = append(insns,
+		bpfInsn{code: bpfMov64K, dst: 0, imm: 0},
+		bpfInsn{code: bpfExit},
+	)
+	return checkInsns(insns)
+}
+
+func checkInsns(insns []bpfInsn) ([]bpfInsn, error) {
+	if len(insns) > bpfMaxInsns {
+		return nil, fmt.Errorf("too many device rules")
+	}
+	return insns, nil
+}
+
+// deviceRule returns the instructions returning whether the access is
+// allowed if the device matches rule, or skipping to the next rule, and
+// whether the rule matches all devices and accesses.
+func deviceRule(rule specs.LinuxDeviceCgroup) ([]bpfInsn, bool, error) {
+	var checks []bpfInsn
+
+	switch rule.Type {
+	case "", "a":
+	case "c":
+		checks = append(checks, bpfInsn{code: bpfJneK, dst: 2, imm: unix.BPF_DEVCG_DEV_CHAR})
+	case "b":
+		checks = append(checks, bpfInsn{code: bpfJneK, dst: 2, imm: unix.BPF_DEVCG_DEV_BLOCK})
+	default:
+		return nil, false, fmt.Errorf("unknown device type %q", rule.Type)
+	}
+
+	access := int32(0)
+	for _, a := range rule.Access {
+		switch a {
+		case 'r':
+			access |= unix.BPF_DEVCG_ACC_READ
+		case 'w':
+			access |= unix.BPF_DEVCG_ACC_WRITE
+		case 'm':
+			access |= unix.BPF_DEVCG_ACC_MKNOD
+		default:
+			return nil, false, fmt.Errorf("unknown device access %q", rule.Access)
+		}
+	}
+	all := int32(unix.BPF_DEVCG_ACC_READ | unix.BPF_DEVCG_ACC_WRITE | unix.BPF_DEVCG_ACC_MKNOD)
+	if access != 0 && access != all {
+		// the requested access must be a subset of the rule access
+		checks = append(checks,
+			bpfInsn{code: bpfMov32X, dst: 1, src: 3},
+			bpfInsn{code: bpfAnd32K, dst: 1, imm: access},
+			bpfInsn{code: bpfJneX, dst: 1, src: 3},
+		)
+	}
+
+	for _, n := range []struct {
+		reg uint8
+		num *int64
+	}{{4, rule.Major}, {5, rule.Minor}} {
+		if n.num == nil || *n.num < 0 {
+			continue
+		}
+		if *n.num > math.MaxInt32 {
+			return nil, false, fmt.Errorf("bad device number %d", *n.num)
+		}
+		checks = append(checks, bpfInsn{code: bpfJneK, dst: n.reg, imm: int32(*n.num)})
+	}
+
+	allow := int32(0)
+	if rule.Allow {
+		allow = 1
+	}
+	block := append(checks,
+		bpfInsn{code: bpfMov64K, dst: 0, imm: allow},
+		bpfInsn{code: bpfExit},
+	)
+
+	// jumps skip the remaining instructions of the block
+	for i := range block {
+		if block[i].code == bpfJneK || block[i].code == bpfJneX {
+			block[i].off = int16(len(block) - i - 1)
+		}
+	}
+	return block, len(checks) == 0, nil
+}
+
+// encodeInsns returns the kernel encoding of the instructions.
+func encodeInsns(insns []bpfInsn) []byte {
+	var probe uint16 = 1
+	littleEndian := *(*byte)(unsafe.Pointer(&probe)) == 1
+
+	var order binary.ByteOrder = binary.BigEndian
+	if littleEndian {
+		order = binary.LittleEndian
+	}
+
+	b := make([]byte, len(insns)*bpfInsnSize)
+	for i, insn := range insns {
+		p := b[i*bpfInsnSize:]
+		p[0] = insn.code
+		// register fields are bitfields following the byte order
+		if littleEndian {
+			p[1] = insn.src<<4 | insn.dst
+		} else {
+			p[1] = insn.dst<<4 | insn.src
+		}
+		order.PutUint16(p[2:], uint16(insn.off))
+		order.PutUint32(p[4:], uint32(insn.imm))
+	}
+	return b
+}
+
+// setDevices replaces the device filter program attached to the cgroup
+// by a program enforcing the device access rules.
+func (c *unifiedCgroup) setDevices(devices []specs.LinuxDeviceCgroup) error {
+	insns, err := deviceFilter(devices)
+	if err != nil {
+		return fmt.Errorf("while generating device filter: %s", err)
+	}
+	code := encodeInsns(insns)
+	license := []byte(bpfLicense)
+	logBuf := make([]byte, bpfLogSize)
+
+	load := bpfProgLoadAttr{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel: 1,
+		logSize:  uint32(len(logBuf)),
+		logBuf:   uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+	}
+	prog, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&load), unsafe.Sizeof(load))
+	if err != nil {
+		return fmt.Errorf("while loading device filter: %s: %s", err, bytes.TrimRight(logBuf, "\x00"))
+	}
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(license)
+	defer unix.Close(prog)
+
+	dir, err := unix.Open(c.path, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("while opening cgroup %s: %s", c.path, err)
+	}
+	defer unix.Close(dir)
+
+	// programs previously attached are detached once the new
+	// program is enforced
+	previous, err := attachedPrograms(dir)
+	if err != nil {
+		return err
+	}
+
+	attach := bpfProgAttachAttr{
+		targetFd:    uint32(dir),
+		attachBpfFd: uint32(prog),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+		attachFlags: unix.BPF_F_ALLOW_MULTI,
+	}
+	if _, err := bpf(unix.BPF_PROG_ATTACH, unsafe.Pointer(&attach), unsafe.Sizeof(attach)); err != nil {
+		return fmt.Errorf("while attaching device filter to cgroup %s: %s", c.path, err)
+	}
+
+	for _, id := range previous {
+		get := bpfGetFdByIDAttr{id: id}
+		fd, err := bpf(unix.BPF_PROG_GET_FD_BY_ID, unsafe.Pointer(&get), unsafe.Sizeof(get))
+		if err != nil {
+			return fmt.Errorf("while getting device filter %d: %s", id, err)
+		}
+		detach := bpfProgAttachAttr{
+			targetFd:    uint32(dir),
+			attachBpfFd: uint32(fd),
+			attachType:  unix.BPF_CGROUP_DEVICE,
+		}
+		_, err = bpf(unix.BPF_PROG_DETACH, unsafe.Pointer(&detach), unsafe.Sizeof(detach))
+		unix.Close(fd)
+		if err != nil {
+			return fmt.Errorf("while detaching device filter %d: %s", id, err)
+		}
+	}
+	return nil
+}
+
+// attachedPrograms returns the IDs of the device filter programs
+// attached to the cgroup directory dir.
+func attachedPrograms(dir int) ([]uint32, error) {
+	ids := make([]uint32, 64)
+	query := bpfProgQueryAttr{
+		targetFd:   uint32(dir),
+		attachType: unix.BPF_CGROUP_DEVICE,
+		progIds:    uint64(uintptr(unsafe.Pointer(&ids[0]))),
+		progCnt:    uint32(len(ids)),
+	}
+	if _, err := bpf(unix.BPF_PROG_QUERY, unsafe.Pointer(&query), unsafe.Sizeof(query)); err != nil {
+		return nil, fmt.Errorf("while querying device filters: %s", err)
+	}
+	return ids[:query.progCnt], nil
+}
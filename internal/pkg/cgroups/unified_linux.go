@@ -0,0 +1,344 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// unifiedMountPoint is the mount point of the cgroups v2 unified hierarchy
+const unifiedMountPoint = "/sys/fs/cgroup"
+
+// unifiedControllers are the controllers enabled for container cgroups
+var unifiedControllers = []string{"cpu", "cpuset", "memory", "io", "pids", "hugetlb"}
+
+var (
+	unifiedOnce sync.Once
+	unified     bool
+)
+
+// IsUnified returns true if /sys/fs/cgroup is a cgroups v2 unified
+// hierarchy mount point.
+func IsUnified() bool {
+	unifiedOnce.Do(func() {
+		var st unix.Statfs_t
+		if err := unix.Statfs(unifiedMountPoint, &st); err == nil {
+			unified = st.Type == unix.CGROUP2_SUPER_MAGIC
+		}
+	})
+	return unified
+}
+
+// unifiedCgroup is a cgroup of the cgroups v2 unified hierarchy
+type unifiedCgroup struct {
+	path string
+}
+
+// newUnified creates the cgroup path relative to the unified hierarchy
+// mount point and applies resources restriction.
+func newUnified(path string, resources *specs.LinuxResources) (*unifiedCgroup, error) {
+	c := &unifiedCgroup{path: filepath.Join(unifiedMountPoint, path)}
+
+	if err := os.MkdirAll(c.path, 0755); err != nil {
+		return nil, fmt.Errorf("while creating cgroup %s: %s", c.path, err)
+	}
+
+	// controllers must be enabled in all ancestors to be available
+	// in the container cgroup
+	rel, err := filepath.Rel(unifiedMountPoint, c.path)
+	if err != nil {
+		return nil, err
+	}
+	dir := unifiedMountPoint
+	for _, elem := range strings.Split(rel, string(os.PathSeparator)) {
+		c.enableControllers(dir)
+		dir = filepath.Join(dir, elem)
+	}
+
+	return c, c.update(resources)
+}
+
+// loadUnified returns the unified hierarchy cgroup of process pid.
+func loadUnified(pid int) (*unifiedCgroup, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			return &unifiedCgroup{path: filepath.Join(unifiedMountPoint, path)}, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no unified hierarchy cgroup found for process %d", pid)
+}
+
+// enableControllers enables the available container controllers for
+// the children of the cgroup directory dir.
+func (c *unifiedCgroup) enableControllers(dir string) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		sylog.Debugf("Could not read %s controllers: %s", dir, err)
+		return
+	}
+	available := strings.Fields(string(b))
+
+	for _, ctrl := range unifiedControllers {
+		for _, a := range available {
+			if a != ctrl {
+				continue
+			}
+			// a cgroup with processes can't delegate some controllers,
+			// resources using them are reported when applied
+			if err := writeCgroupFile(dir, "cgroup.subtree_control", "+"+ctrl); err != nil {
+				sylog.Debugf("Could not enable %s controller: %s", ctrl, err)
+			}
+		}
+	}
+}
+
+// update applies resources restriction to the cgroup.
+func (c *unifiedCgroup) update(r *specs.LinuxResources) error {
+	if r == nil {
+		return nil
+	}
+
+	var files [][2]string
+	set := func(name, value string) {
+		files = append(files, [2]string{name, value})
+	}
+
+	if cpu := r.CPU; cpu != nil {
+		if cpu.Shares != nil && *cpu.Shares > 0 {
+			set("cpu.weight", strconv.FormatUint(cpuWeight(*cpu.Shares), 10))
+		}
+		if cpu.Quota != nil || cpu.Period != nil {
+			quota := "max"
+			if cpu.Quota != nil && *cpu.Quota > 0 {
+				quota = strconv.FormatInt(*cpu.Quota, 10)
+			}
+			period := uint64(100000)
+			if cpu.Period != nil && *cpu.Period > 0 {
+				period = *cpu.Period
+			}
+			set("cpu.max", fmt.Sprintf("%s %d", quota, period))
+		}
+		if cpu.Cpus != "" {
+			set("cpuset.cpus", cpu.Cpus)
+		}
+		if cpu.Mems != "" {
+			set("cpuset.mems", cpu.Mems)
+		}
+	}
+
+	if mem := r.Memory; mem != nil {
+		if mem.Limit != nil && *mem.Limit != 0 {
+			set("memory.max", limit(*mem.Limit))
+		}
+		// the soft limit is enforced by throttling memory usage above it
+		if mem.Reservation != nil && *mem.Reservation != 0 {
+			set("memory.high", limit(*mem.Reservation))
+		}
+		// swap limit includes memory with cgroups v1, not with v2
+		if mem.Swap != nil && *mem.Swap != 0 {
+			swap := *mem.Swap
+			if swap > 0 && mem.Limit != nil && *mem.Limit > 0 {
+				if swap < *mem.Limit {
+					return fmt.Errorf("memory and swap limit %d is lower than memory limit %d", swap, *mem.Limit)
+				}
+				swap -= *mem.Limit
+			}
+			set("memory.swap.max", limit(swap))
+		}
+	}
+
+	if r.Pids != nil {
+		if r.Pids.Limit > 0 {
+			set("pids.max", strconv.FormatInt(r.Pids.Limit, 10))
+		} else {
+			set("pids.max", "max")
+		}
+	}
+
+	if bio := r.BlockIO; bio != nil {
+		if bio.Weight != nil && *bio.Weight > 0 {
+			set("io.weight", fmt.Sprintf("default %d", ioWeight(*bio.Weight)))
+		}
+		for _, wd := range bio.WeightDevice {
+			if wd.Weight != nil && *wd.Weight > 0 {
+				set("io.weight", fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, ioWeight(*wd.Weight)))
+			}
+		}
+		throttles := []struct {
+			key     string
+			devices []specs.LinuxThrottleDevice
+		}{
+			{"rbps", bio.ThrottleReadBpsDevice},
+			{"wbps", bio.ThrottleWriteBpsDevice},
+			{"riops", bio.ThrottleReadIOPSDevice},
+			{"wiops", bio.ThrottleWriteIOPSDevice},
+		}
+		for _, t := range throttles {
+			for _, d := range t.devices {
+				set("io.max", fmt.Sprintf("%d:%d %s=%d", d.Major, d.Minor, t.key, d.Rate))
+			}
+		}
+	}
+
+	for _, h := range r.HugepageLimits {
+		set(fmt.Sprintf("hugetlb.%s.max", h.Pagesize), strconv.FormatUint(h.Limit, 10))
+	}
+
+	for _, f := range files {
+		if err := writeCgroupFile(c.path, f[0], f[1]); err != nil {
+			return err
+		}
+	}
+
+	// device access is controlled by eBPF programs with cgroups v2
+	if len(r.Devices) > 0 {
+		return c.setDevices(r.Devices)
+	}
+	return nil
+}
+
+// add moves process pid into the cgroup.
+func (c *unifiedCgroup) add(pid int) error {
+	return writeCgroupFile(c.path, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// freeze freezes or thaws all processes of the cgroup.
+func (c *unifiedCgroup) freeze(frozen bool) error {
+	value := "0"
+	if frozen {
+		value = "1"
+	}
+	return writeCgroupFile(c.path, "cgroup.freeze", value)
+}
+
+// stats returns the resource usage of the cgroup processes, statistics
+// of controllers not enabled for the cgroup are left to zero.
+func (c *unifiedCgroup) stats() (*Stats, error) {
+	stats := &Stats{}
+
+	readUint := func(name string) (uint64, bool) {
+		b, err := ioutil.ReadFile(filepath.Join(c.path, name))
+		if err != nil {
+			return 0, false
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		return v, err == nil
+	}
+
+	stats.MemoryUsage, _ = readUint("memory.current")
+	stats.MemoryLimit, _ = readUint("memory.max")
+	stats.Pids, _ = readUint("pids.current")
+
+	// io.stat has one line of key=value statistics per device
+	if b, err := ioutil.ReadFile(filepath.Join(c.path, "io.stat")); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			for _, field := range strings.Fields(line) {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				switch kv[0] {
+				case "rbytes":
+					stats.BlkioRead += v
+				case "wbytes":
+					stats.BlkioWrite += v
+				}
+			}
+		}
+	}
+
+	// cpu.stat is always available and reports usage in microseconds
+	f, err := os.Open(filepath.Join(c.path, "cpu.stat"))
+	if err != nil {
+		return nil, fmt.Errorf("while reading cgroup statistics: %s", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			usec, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad CPU usage %q: %s", fields[1], err)
+			}
+			stats.CPUUsage = usec * 1000
+		}
+	}
+	return stats, scanner.Err()
+}
+
+// delete removes the cgroup, it must not contain processes.
+func (c *unifiedCgroup) delete() error {
+	if err := unix.Rmdir(c.path); err != nil && err != unix.ENOENT {
+		return fmt.Errorf("while removing cgroup %s: %s", c.path, err)
+	}
+	return nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+		return fmt.Errorf("while setting %s to %q: %s", path, value, err)
+	}
+	return nil
+}
+
+// limit formats a cgroups v1 limit, negative values mean no limit.
+func limit(v int64) string {
+	if v < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// cpuWeight converts cgroups v1 CPU shares [2-262144] to a cgroups v2
+// CPU weight [1-10000].
+func cpuWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	} else if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// ioWeight converts a cgroups v1 block IO weight [10-1000] to a cgroups
+// v2 IO weight [1-10000].
+func ioWeight(weight uint16) uint64 {
+	w := uint64(weight)
+	if w < 10 {
+		w = 10
+	} else if w > 1000 {
+		w = 1000
+	}
+	return 1 + ((w-10)*9999)/990
+}
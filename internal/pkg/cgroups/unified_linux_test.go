@@ -0,0 +1,206 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestWeightConversion(t *testing.T) {
+	tests := []struct {
+		name     string
+		convert  func() uint64
+		expected uint64
+	}{
+		{"minimum shares", func() uint64 { return cpuWeight(2) }, 1},
+		{"default shares", func() uint64 { return cpuWeight(1024) }, 39},
+		{"maximum shares", func() uint64 { return cpuWeight(262144) }, 10000},
+		{"out of range shares", func() uint64 { return cpuWeight(1 << 20) }, 10000},
+		{"minimum block IO weight", func() uint64 { return ioWeight(10) }, 1},
+		{"default block IO weight", func() uint64 { return ioWeight(500) }, 4950},
+		{"maximum block IO weight", func() uint64 { return ioWeight(1000) }, 10000},
+	}
+	for _, tt := range tests {
+		if w := tt.convert(); w != tt.expected {
+			t.Errorf("%s: got weight %d, expected %d", tt.name, w, tt.expected)
+		}
+	}
+}
+
+func TestUnifiedUpdate(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "cgroup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shares := uint64(1024)
+	quota := int64(50000)
+	memLimit := int64(512 << 20)
+	memSwap := int64(1 << 30)
+	reservation := int64(-1)
+	weight := uint16(1000)
+
+	resources := &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{
+			Shares: &shares,
+			Quota:  &quota,
+			Cpus:   "0-1",
+		},
+		Memory: &specs.LinuxMemory{
+			Limit:       &memLimit,
+			Reservation: &reservation,
+			Swap:        &memSwap,
+		},
+		Pids: &specs.LinuxPids{Limit: 0},
+		BlockIO: &specs.LinuxBlockIO{
+			Weight: &weight,
+			ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+				{Rate: 1048576},
+			},
+		},
+	}
+	// device numbers are fields of an unexported embedded structure
+	resources.BlockIO.ThrottleReadBpsDevice[0].Major = 8
+
+	c := &unifiedCgroup{path: dir}
+	if err := c.update(resources); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"cpu.weight":      "39",
+		"cpu.max":         "50000 100000",
+		"cpuset.cpus":     "0-1",
+		"memory.max":      "536870912",
+		"memory.high":     "max",
+		"memory.swap.max": "536870912",
+		"pids.max":        "max",
+		"io.weight":       "default 10000",
+		"io.max":          "8:0 rbps=1048576",
+	}
+	for name, value := range expected {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if string(b) != value {
+			t.Errorf("%s: got %q, expected %q", name, b, value)
+		}
+	}
+
+	memSwap = memLimit / 2
+	if err := c.update(resources); err == nil {
+		t.Errorf("unexpected success with a swap limit lower than memory limit")
+	}
+}
+
+func TestUnifiedStats(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "cgroup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &unifiedCgroup{path: dir}
+	if _, err := c.stats(); err == nil {
+		t.Errorf("unexpected success without cpu.stat")
+	}
+
+	files := map[string]string{
+		"cpu.stat":       "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n",
+		"memory.current": "4096\n",
+		"memory.max":     "max\n",
+		"pids.current":   "2\n",
+		"io.stat":        "8:0 rbytes=1024 wbytes=512 rios=2 wios=1\n8:16 rbytes=1024 wbytes=0\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := c.stats()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Stats{MemoryUsage: 4096, CPUUsage: 1500000, Pids: 2, BlkioRead: 2048, BlkioWrite: 512}
+	if *stats != expected {
+		t.Errorf("got stats %+v, expected %+v", *stats, expected)
+	}
+}
+
+func TestUnifiedDevices(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	if !IsUnified() {
+		t.Skip("cgroups v2 unified hierarchy not mounted")
+	}
+
+	major := int64(1)
+	zero := int64(5)
+	resources := &specs.LinuxResources{
+		Devices: []specs.LinuxDeviceCgroup{
+			{Allow: false, Access: "rwm"},
+			{Allow: true, Type: "c", Major: &major, Minor: &zero, Access: "r"},
+		},
+	}
+
+	path := filepath.Join("singularity-test", strconv.Itoa(os.Getpid()))
+	c, err := newUnified(path, resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.Remove(filepath.Dir(c.path))
+	defer c.delete()
+
+	tests := []struct {
+		name    string
+		device  string
+		success bool
+	}{
+		{"allowed device", "/dev/zero", true},
+		{"denied device", "/dev/full", false},
+	}
+	for _, tt := range tests {
+		// the shell moves itself into the cgroup before opening the device
+		script := fmt.Sprintf("echo $$ > %s/cgroup.procs && exec head -c 1 %s", c.path, tt.device)
+		out, err := exec.Command("/bin/sh", "-c", script).CombinedOutput()
+		if tt.success && err != nil {
+			t.Errorf("%s: unexpected error: %s: %s", tt.name, err, out)
+		} else if !tt.success && err == nil {
+			t.Errorf("%s: unexpected success opening %s", tt.name, tt.device)
+		}
+	}
+
+	resources.Devices[1].Access = "m"
+	if err := c.update(resources); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	script := fmt.Sprintf("echo $$ > %s/cgroup.procs && exec head -c 1 /dev/zero", c.path)
+	if err := exec.Command("/bin/sh", "-c", script).Run(); err == nil {
+		t.Errorf("unexpected success reading /dev/zero without read access")
+	}
+
+	resources.Devices[1].Type = "x"
+	if err := c.update(resources); err == nil {
+		t.Errorf("unexpected success with an unknown device type")
+	}
+}
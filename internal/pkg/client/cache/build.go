@@ -0,0 +1,87 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// BuildDir is the directory inside the cache.Dir where build stages are cached
+	BuildDir = "build"
+)
+
+// getBuildCachePath returns the directory inside the cache.Dir() where build
+// stages are cached
+func getBuildCachePath(c *Handle) (string, error) {
+	// This function may act on an cache object that is not fully initialized
+	// so it is not a method on a Handle but rather an independent
+	// function
+
+	// updateCacheSubdir checks if the cache is valid, no need to check here
+	return updateCacheSubdir(c, BuildDir)
+}
+
+// BuildStage returns the directory inside cache.Dir() holding the build
+// stage with the given key, the directory is not created
+func (c *Handle) BuildStage(key string) string {
+	if c.disabled {
+		return ""
+	}
+
+	return filepath.Join(c.Build, key)
+}
+
+// BuildStageExists returns whether the build stage with the given key
+// exists in the build cache
+func (c *Handle) BuildStageExists(key string) (bool, error) {
+	if c.disabled {
+		return false, nil
+	}
+
+	stage := c.BuildStage(key)
+	_, err := os.Stat(stage)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	touchEntry(stage)
+
+	return true, nil
+}
+
+// NewBuildStage creates a temporary directory inside the build cache where
+// a build stage is written before being committed with CommitBuildStage, so
+// a partially written stage is never reused
+func (c *Handle) NewBuildStage(key string) (string, error) {
+	if c.disabled {
+		return "", nil
+	}
+
+	return ioutil.TempDir(c.Build, "."+key+"-")
+}
+
+// CommitBuildStage moves the build stage written in the directory dir
+// returned by NewBuildStage to its final location in the build cache. If
+// another build committed the same stage in the meantime, dir is removed
+func (c *Handle) CommitBuildStage(key, dir string) error {
+	if c.disabled {
+		return nil
+	}
+
+	if err := os.Rename(dir, c.BuildStage(key)); err != nil {
+		os.RemoveAll(dir)
+		if exists, _ := c.BuildStageExists(key); exists {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestBuildStage(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tempImageCache, err := ioutil.TempDir("", "image-cache-")
+	if err != nil {
+		t.Fatal("failed to create temporary image cache directory:", err)
+	}
+	defer os.RemoveAll(tempImageCache)
+
+	c, err := NewHandle(Config{BaseDir: tempImageCache})
+	if err != nil {
+		t.Fatalf("failed to create new image cache handle: %s", err)
+	}
+
+	// Before running the test we make sure that the test environment
+	// did not implicitly disable the cache.
+	c.checkIfCacheDisabled(t)
+
+	if expected := filepath.Join(tempImageCache, CacheDir, BuildDir); c.Build != expected {
+		t.Errorf("Unexpected result: %s (expected %s)", c.Build, expected)
+	}
+
+	key := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if exists, err := c.BuildStageExists(key); err != nil {
+		t.Fatalf("BuildStageExists() failed: %s", err)
+	} else if exists {
+		t.Fatalf("BuildStageExists() returned true for an empty cache")
+	}
+
+	// an uncommitted stage is not reused
+	dir, err := c.NewBuildStage(key)
+	if err != nil {
+		t.Fatalf("NewBuildStage() failed: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("stage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := c.BuildStageExists(key); exists {
+		t.Fatalf("BuildStageExists() returned true for an uncommitted stage")
+	}
+
+	if err := c.CommitBuildStage(key, dir); err != nil {
+		t.Fatalf("CommitBuildStage() failed: %s", err)
+	}
+	if exists, err := c.BuildStageExists(key); err != nil || !exists {
+		t.Fatalf("BuildStageExists() failed for a committed stage: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.BuildStage(key), "file")); err != nil {
+		t.Errorf("committed stage content not found: %s", err)
+	}
+
+	// committing a stage already cached by a concurrent build succeeds
+	dir, err = c.NewBuildStage(key)
+	if err != nil {
+		t.Fatalf("NewBuildStage() failed: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("stage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CommitBuildStage(key, dir); err != nil {
+		t.Fatalf("CommitBuildStage() failed for an existing stage: %s", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temporary stage directory %s not removed", dir)
+	}
+}
@@ -87,6 +87,12 @@ type Handle struct {
 	// Oras provides the location of the ORAS cache
 	Oras string
 
+	// Build provides the location of the build stage cache
+	Build string
+
+	// Layers provides the location of the extracted OCI layer cache
+	Layers string
+
 	// disabled specifies if the test is disabled
 	disabled bool
 }
@@ -179,6 +185,14 @@ func NewHandle(cfg Config) (*Handle, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed getting the path to the ORAS cache")
 	}
+	newCache.Build, err = getBuildCachePath(newCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the path to the build cache")
+	}
+	newCache.Layers, err = getLayerCachePath(newCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the path to the layer cache")
+	}
 
 	return newCache, nil
 }
@@ -284,6 +298,8 @@ func (c *Handle) cleanAllCaches() {
 		"shub":    c.Shub,
 		"oras":    c.Oras,
 		"net":     c.Net,
+		"build":   c.Build,
+		"layer":   c.Layers,
 	}
 
 	for name, dir := range cacheDirs {
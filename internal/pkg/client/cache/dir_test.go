@@ -81,6 +81,8 @@ func TestCleanAllCaches(t *testing.T) {
 		"shub":    c.Shub,
 		"oras":    c.Oras,
 		"net":     c.Net,
+		"build":   c.Build,
+		"layer":   c.Layers,
 	}
 
 	testfile := "test"
@@ -0,0 +1,212 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// Policy describes the limits enforced on the cache by the garbage
+// collector, zero values mean no limit.
+type Policy struct {
+	// MaxSize is the maximum size in bytes of the whole cache
+	MaxSize int64
+	// MaxAge is the time after which an unused entry is removed
+	MaxAge time.Duration
+	// MaxTypeSize is the maximum size in bytes of a cache type,
+	// indexed by the type names used by Entry
+	MaxTypeSize map[string]int64
+}
+
+// IsZero returns true if the policy doesn't set any limit.
+func (p Policy) IsZero() bool {
+	if p.MaxSize > 0 || p.MaxAge > 0 {
+		return false
+	}
+	for _, size := range p.MaxTypeSize {
+		if size > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Entry is an image or a build stage stored in the cache.
+type Entry struct {
+	// Type is the cache type of the entry: library, oci, shub,
+	// net, oras, build or layer
+	Type string
+	// Path is the directory holding the entry
+	Path string
+	// Size is the size in bytes of the entry
+	Size int64
+	// LastUsed is the last time the entry was stored or found
+	// in the cache
+	LastUsed time.Time
+}
+
+// gcTypes returns the cache directories whose entries are collected,
+// the OCI blob cache is left out as its blobs are shared between images
+// of the same layout.
+func (c *Handle) gcTypes() map[string]string {
+	return map[string]string{
+		"library": c.Library,
+		"oci":     c.OciTemp,
+		"shub":    c.Shub,
+		"net":     c.Net,
+		"oras":    c.Oras,
+		"build":   c.Build,
+		"layer":   c.Layers,
+	}
+}
+
+// touchEntry records that the cache entry dir was just used
+// by updating the modification time of its directory.
+func touchEntry(dir string) {
+	now := time.Now()
+	if err := os.Chtimes(dir, now, now); err != nil {
+		sylog.Debugf("Could not update cache entry %s last use time: %s", dir, err)
+	}
+}
+
+// entrySize returns the size in bytes of all files in dir.
+func entrySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Entries returns all entries of the collected cache types.
+func (c *Handle) Entries() ([]Entry, error) {
+	if c.disabled {
+		return nil, nil
+	}
+
+	var entries []Entry
+
+	for cacheType, dir := range c.gcTypes() {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read %s cache directory %s: %s", cacheType, dir, err)
+		}
+
+		for _, fi := range files {
+			// build stages in progress are hidden directories
+			if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, fi.Name())
+			size, err := entrySize(path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get size of cache entry %s: %s", path, err)
+			}
+			entries = append(entries, Entry{
+				Type:     cacheType,
+				Path:     path,
+				Size:     size,
+				LastUsed: fi.ModTime(),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// selectEntries returns the entries to remove to enforce policy p, the
+// least recently used entries are evicted first.
+func selectEntries(entries []Entry, p Policy, now time.Time) []Entry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	evicted := make([]bool, len(entries))
+	typeSize := make(map[string]int64)
+	var totalSize int64
+
+	for i, e := range entries {
+		if p.MaxAge > 0 && now.Sub(e.LastUsed) > p.MaxAge {
+			evicted[i] = true
+			continue
+		}
+		typeSize[e.Type] += e.Size
+		totalSize += e.Size
+	}
+
+	for i, e := range entries {
+		if evicted[i] {
+			continue
+		}
+		max := p.MaxTypeSize[e.Type]
+		if max > 0 && typeSize[e.Type] > max {
+			evicted[i] = true
+			typeSize[e.Type] -= e.Size
+			totalSize -= e.Size
+		}
+	}
+
+	for i, e := range entries {
+		if p.MaxSize <= 0 || totalSize <= p.MaxSize {
+			break
+		}
+		if evicted[i] {
+			continue
+		}
+		evicted[i] = true
+		totalSize -= e.Size
+	}
+
+	var selected []Entry
+	for i, e := range entries {
+		if evicted[i] {
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
+
+// GC removes the cache entries exceeding the limits of policy p and
+// returns them, the entries are only reported if dryRun is true.
+func (c *Handle) GC(p Policy, dryRun bool) ([]Entry, error) {
+	if c.disabled || p.IsZero() {
+		return nil, nil
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := selectEntries(entries, p, time.Now())
+	if dryRun {
+		return selected, nil
+	}
+
+	for _, e := range selected {
+		sylog.Debugf("Removing %s cache entry %s", e.Type, e.Path)
+		if err := os.RemoveAll(e.Path); err != nil {
+			return nil, fmt.Errorf("unable to remove cache entry %s: %s", e.Path, err)
+		}
+	}
+	return selected, nil
+}
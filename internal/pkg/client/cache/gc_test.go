@@ -0,0 +1,139 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestSelectEntries(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	entries := []Entry{
+		{Type: "library", Path: "lib-new", Size: 100, LastUsed: now.Add(-1 * time.Hour)},
+		{Type: "library", Path: "lib-old", Size: 100, LastUsed: now.Add(-2 * day)},
+		{Type: "oci", Path: "oci-new", Size: 50, LastUsed: now.Add(-2 * time.Hour)},
+		{Type: "oci", Path: "oci-old", Size: 50, LastUsed: now.Add(-10 * day)},
+		{Type: "shub", Path: "shub", Size: 30, LastUsed: now.Add(-3 * day)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		expected []string
+	}{
+		{
+			name:     "no limit",
+			policy:   Policy{},
+			expected: nil,
+		},
+		{
+			name:     "max age",
+			policy:   Policy{MaxAge: 5 * day},
+			expected: []string{"oci-old"},
+		},
+		{
+			name:     "max size",
+			policy:   Policy{MaxSize: 200},
+			expected: []string{"oci-old", "shub", "lib-old"},
+		},
+		{
+			name:     "max size large enough",
+			policy:   Policy{MaxSize: 330},
+			expected: nil,
+		},
+		{
+			name:     "type quota",
+			policy:   Policy{MaxTypeSize: map[string]int64{"library": 150}},
+			expected: []string{"lib-old"},
+		},
+		{
+			name: "all limits",
+			policy: Policy{
+				MaxAge:      5 * day,
+				MaxSize:     160,
+				MaxTypeSize: map[string]int64{"library": 150},
+			},
+			expected: []string{"oci-old", "shub", "lib-old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, e := range selectEntries(entries, tt.policy, now) {
+				paths = append(paths, e.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("unexpected entries %v (expected %v)", paths, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGC(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tempImageCache, err := ioutil.TempDir("", "image-cache-")
+	if err != nil {
+		t.Fatal("failed to create temporary image cache directory:", err)
+	}
+	defer os.RemoveAll(tempImageCache)
+
+	c, err := NewHandle(Config{BaseDir: tempImageCache})
+	if err != nil {
+		t.Fatalf("failed to create new image cache handle: %s", err)
+	}
+	c.checkIfCacheDisabled(t)
+
+	// the oldest image is used again and becomes the most recent one
+	old := time.Now().Add(-time.Hour)
+	for _, sum := range []string{"used", "unused"} {
+		path := c.ShubImage(sum, "image.sif")
+		if err := ioutil.WriteFile(path, make([]byte, 64), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Dir(path), old, old); err != nil {
+			t.Fatal(err)
+		}
+		old = old.Add(time.Minute)
+	}
+	if exists, err := c.ShubImageExists("used", "image.sif"); err != nil || !exists {
+		t.Fatalf("ShubImageExists() failed: %v", err)
+	}
+
+	policy := Policy{MaxTypeSize: map[string]int64{"shub": 100}}
+
+	removed, err := c.GC(policy, true)
+	if err != nil {
+		t.Fatalf("GC() failed: %s", err)
+	}
+	if len(removed) != 1 || removed[0].Path != filepath.Join(c.Shub, "unused") {
+		t.Fatalf("unexpected entries selected: %v", removed)
+	}
+	if _, err := os.Stat(removed[0].Path); err != nil {
+		t.Fatalf("entry removed in dry run mode: %s", err)
+	}
+
+	if _, err := c.GC(policy, false); err != nil {
+		t.Fatalf("GC() failed: %s", err)
+	}
+	if _, err := os.Stat(removed[0].Path); !os.IsNotExist(err) {
+		t.Errorf("entry %s not removed", removed[0].Path)
+	}
+	if exists, _ := c.ShubImageExists("used", "image.sif"); !exists {
+		t.Errorf("recently used entry removed")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// LayerDir is the directory inside the cache.Dir where extracted OCI
+	// image layers are cached
+	LayerDir = "layer"
+)
+
+// getLayerCachePath returns the directory inside the cache.Dir() where
+// extracted OCI image layers are cached
+func getLayerCachePath(c *Handle) (string, error) {
+	// This function may act on an cache object that is not fully initialized
+	// so it is not a method on a Handle but rather an independent
+	// function
+
+	// updateCacheSubdir checks if the cache is valid, no need to check here
+	return updateCacheSubdir(c, LayerDir)
+}
+
+// Layer returns the directory inside cache.Dir() holding the extracted
+// layer with the given key, the directory is not created
+func (c *Handle) Layer(key string) string {
+	if c.disabled {
+		return ""
+	}
+
+	return filepath.Join(c.Layers, key)
+}
+
+// LayerExists returns whether the extracted layer with the given key
+// exists in the layer cache
+func (c *Handle) LayerExists(key string) (bool, error) {
+	if c.disabled {
+		return false, nil
+	}
+
+	layer := c.Layer(key)
+	_, err := os.Stat(layer)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	touchEntry(layer)
+
+	return true, nil
+}
+
+// NewLayer creates a temporary directory inside the layer cache where
+// a layer is extracted before being committed with CommitLayer, so a
+// partially extracted layer is never reused
+func (c *Handle) NewLayer(key string) (string, error) {
+	if c.disabled {
+		return "", nil
+	}
+
+	return ioutil.TempDir(c.Layers, "."+key+"-")
+}
+
+// CommitLayer moves the layer extracted in the directory dir returned by
+// NewLayer to its final location in the layer cache. If another build
+// committed the same layer in the meantime, dir is removed
+func (c *Handle) CommitLayer(key, dir string) error {
+	if c.disabled {
+		return nil
+	}
+
+	if err := os.Rename(dir, c.Layer(key)); err != nil {
+		os.RemoveAll(dir)
+		if exists, _ := c.LayerExists(key); exists {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
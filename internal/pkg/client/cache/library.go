@@ -62,6 +62,7 @@ func (c *Handle) LibraryImageExists(sum, name string) (bool, error) {
 	if cacheSum != sum {
 		return false, ErrBadChecksum
 	}
+	touchEntry(filepath.Dir(imagePath))
 
 	return true, nil
 }
@@ -56,12 +56,14 @@ func (c *Handle) NetImageExists(sum, name string) (bool, error) {
 		return false, nil
 	}
 
-	_, err := os.Stat(c.NetImage(sum, name))
+	imagePath := c.NetImage(sum, name)
+	_, err := os.Stat(imagePath)
 	if os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
 		return false, err
 	}
+	touchEntry(filepath.Dir(imagePath))
 
 	return true, nil
 }
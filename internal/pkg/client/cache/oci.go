@@ -56,12 +56,14 @@ func (c *Handle) OciTempExists(sum, name string) (bool, error) {
 		return false, nil
 	}
 
-	_, err := os.Stat(c.OciTempImage(sum, name))
+	imagePath := c.OciTempImage(sum, name)
+	_, err := os.Stat(imagePath)
 	if os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
 		return false, err
 	}
+	touchEntry(filepath.Dir(imagePath))
 
 	return true, nil
 }
@@ -45,12 +45,14 @@ func (c *Handle) ShubImageExists(sum, name string) (bool, error) {
 		return false, nil
 	}
 
-	_, err := os.Stat(c.ShubImage(sum, name))
+	imagePath := c.ShubImage(sum, name)
+	_, err := os.Stat(imagePath)
 	if os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
 		return false, err
 	}
+	touchEntry(filepath.Dir(imagePath))
 
 	return true, nil
 }
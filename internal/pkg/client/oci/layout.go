@@ -0,0 +1,335 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/containers/image/copy"
+	// register the docker transport to push images to registries
+	_ "github.com/containers/image/docker"
+	"github.com/containers/image/oci/layout"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// DefaultLayoutTag is the tag used when an OCI layout reference
+// doesn't specify one.
+const DefaultLayoutTag = "latest"
+
+// LayoutImage describes a single layer OCI image created from a
+// root filesystem directory.
+type LayoutImage struct {
+	// Rootfs is the root filesystem directory packed as image layer.
+	Rootfs string
+	// Config is the execution configuration of the image.
+	Config imgspecv1.ImageConfig
+	// RootOwned sets the ownership of all layer entries to root, it's
+	// used for root filesystems extracted by unprivileged users.
+	RootOwned bool
+}
+
+// defaultPath is the PATH of images created from Singularity root
+// filesystems, the container environment scripts aren't sourced by
+// OCI runtimes.
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// RootfsConfig returns the image configuration of the Singularity root
+// filesystem rootfs, the container runscript is used as image command.
+func RootfsConfig(rootfs string) imgspecv1.ImageConfig {
+	config := imgspecv1.ImageConfig{
+		Env:        []string{defaultPath},
+		WorkingDir: "/",
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, ".singularity.d", "runscript")); err == nil {
+		config.Cmd = []string{"/.singularity.d/runscript"}
+	}
+	return config
+}
+
+// SplitLayoutRef splits an OCI layout reference of the form
+// directory[:tag] into its directory and tag.
+func SplitLayoutRef(ref string) (string, string) {
+	split := strings.SplitN(ref, ":", 2)
+	if len(split) == 1 || split[1] == "" {
+		return split[0], DefaultLayoutTag
+	}
+	return split[0], split[1]
+}
+
+// WriteLayout writes img as a single layer OCI image tagged tag in the OCI
+// image layout directory dir. The directory is created if necessary, an
+// image previously stored with the same tag is untagged.
+func WriteLayout(dir, tag string, img *LayoutImage) error {
+	blobs := filepath.Join(dir, "blobs", string(digest.Canonical))
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return fmt.Errorf("while creating OCI layout %s: %s", dir, err)
+	}
+
+	sylog.Debugf("Packing %s as OCI image layer", img.Rootfs)
+	layerDesc, diffID, err := writeLayer(blobs, img.Rootfs, img.RootOwned)
+	if err != nil {
+		return fmt.Errorf("while creating image layer: %s", err)
+	}
+
+	created := time.Now().UTC()
+	config := imgspecv1.Image{
+		Created:      &created,
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Config:       img.Config,
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{diffID},
+		},
+		History: []imgspecv1.History{
+			{Created: &created, CreatedBy: "singularity"},
+		},
+	}
+	configDesc, err := writeJSONBlob(blobs, imgspecv1.MediaTypeImageConfig, config)
+	if err != nil {
+		return fmt.Errorf("while writing image config: %s", err)
+	}
+
+	manifest := imgspecv1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []imgspecv1.Descriptor{layerDesc},
+	}
+	manifestDesc, err := writeJSONBlob(blobs, imgspecv1.MediaTypeImageManifest, manifest)
+	if err != nil {
+		return fmt.Errorf("while writing image manifest: %s", err)
+	}
+	manifestDesc.Platform = &imgspecv1.Platform{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+	}
+	manifestDesc.Annotations = map[string]string{
+		imgspecv1.AnnotationRefName: tag,
+	}
+
+	if err := updateIndex(dir, manifestDesc); err != nil {
+		return fmt.Errorf("while updating OCI layout index: %s", err)
+	}
+
+	b, err := json.Marshal(imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, imgspecv1.ImageLayoutFile), b, 0644)
+}
+
+// CopyLayout copies the image tagged tag in the OCI image layout directory
+// dir to the destination transport:reference dest, like a registry with the
+// docker transport.
+func CopyLayout(dir, tag, dest string, sys *types.SystemContext) error {
+	src, err := layout.NewReference(dir, tag)
+	if err != nil {
+		return fmt.Errorf("unable to parse OCI layout reference: %s", err)
+	}
+	dst, err := parseURI(dest)
+	if err != nil {
+		return fmt.Errorf("unable to parse image name %v: %v", dest, err)
+	}
+
+	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	policyCtx, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer policyCtx.Destroy()
+
+	return copy.Image(context.Background(), policyCtx, dst, src, &copy.Options{
+		ReportWriter:   sylog.Writer(),
+		DestinationCtx: sys,
+	})
+}
+
+// writeLayer writes the gzip compressed tar archive of rootfs in the blobs
+// directory, it returns the layer descriptor and the digest of the
+// uncompressed archive.
+func writeLayer(blobs, rootfs string, rootOwned bool) (imgspecv1.Descriptor, digest.Digest, error) {
+	var desc imgspecv1.Descriptor
+
+	f, err := ioutil.TempFile(blobs, "layer-")
+	if err != nil {
+		return desc, "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	compressed := digest.Canonical.Digester()
+	uncompressed := digest.Canonical.Digester()
+	counter := &countWriter{w: io.MultiWriter(f, compressed.Hash())}
+
+	gz := gzip.NewWriter(counter)
+	tw := tar.NewWriter(io.MultiWriter(gz, uncompressed.Hash()))
+
+	if err := tarTree(tw, rootfs, rootOwned); err != nil {
+		return desc, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return desc, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return desc, "", err
+	}
+	if err := f.Close(); err != nil {
+		return desc, "", err
+	}
+
+	dgst := compressed.Digest()
+	if err := os.Rename(f.Name(), filepath.Join(blobs, dgst.Hex())); err != nil {
+		return desc, "", err
+	}
+
+	desc = imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageLayerGzip,
+		Digest:    dgst,
+		Size:      counter.n,
+	}
+	return desc, uncompressed.Digest(), nil
+}
+
+// tarTree writes the content of rootfs in the tar archive, hard links
+// are preserved and sockets are skipped.
+func tarTree(tw *tar.Writer, rootfs string, rootOwned bool) error {
+	links := make(map[inode]string)
+
+	return filepath.Walk(rootfs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootfs, path)
+		if err != nil {
+			return err
+		} else if rel == "." || fi.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return fmt.Errorf("while archiving %s: %s", path, err)
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if rootOwned {
+			hdr.Uid, hdr.Gid = 0, 0
+			hdr.Uname, hdr.Gname = "root", "root"
+		}
+
+		if id, ok := hardLink(fi); ok && fi.Mode().IsRegular() {
+			if first, ok := links[id]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				links[id] = hdr.Name
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("while archiving %s: %s", path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(tw, file); err != nil {
+			return fmt.Errorf("while archiving %s: %s", path, err)
+		}
+		return nil
+	})
+}
+
+// writeJSONBlob writes the JSON encoding of v in the blobs directory and
+// returns its descriptor.
+func writeJSONBlob(blobs, mediaType string, v interface{}) (imgspecv1.Descriptor, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	dgst := digest.FromBytes(b)
+	if err := ioutil.WriteFile(filepath.Join(blobs, dgst.Hex()), b, 0644); err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return imgspecv1.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(b)),
+	}, nil
+}
+
+// updateIndex adds the manifest descriptor to the index of the OCI layout
+// directory, replacing any manifest with the same reference name.
+func updateIndex(dir string, desc imgspecv1.Descriptor) error {
+	path := filepath.Join(dir, "index.json")
+	index := imgspecv1.Index{Versioned: specs.Versioned{SchemaVersion: 2}}
+
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(b, &index); err != nil {
+			return fmt.Errorf("while decoding %s: %s", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	name := desc.Annotations[imgspecv1.AnnotationRefName]
+	manifests := make([]imgspecv1.Descriptor, 0, len(index.Manifests)+1)
+	for _, m := range index.Manifests {
+		if m.Annotations[imgspecv1.AnnotationRefName] != name {
+			manifests = append(manifests, m)
+		}
+	}
+	index.Manifests = append(manifests, desc)
+
+	b, err = json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/containers/image/oci/layout"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestSplitLayoutRef(t *testing.T) {
+	tests := []struct {
+		ref string
+		dir string
+		tag string
+	}{
+		{"/tmp/layout", "/tmp/layout", DefaultLayoutTag},
+		{"/tmp/layout:", "/tmp/layout", DefaultLayoutTag},
+		{"/tmp/layout:v1", "/tmp/layout", "v1"},
+		{"layout:v1:rc", "layout", "v1:rc"},
+	}
+	for _, tt := range tests {
+		dir, tag := SplitLayoutRef(tt.ref)
+		if dir != tt.dir || tag != tt.tag {
+			t.Errorf("%s: got %s and %s, expected %s and %s", tt.ref, dir, tag, tt.dir, tt.tag)
+		}
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	rootfs, err := ioutil.TempDir("", "layout-rootfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	dir, err := ioutil.TempDir("", "layout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "bin", "sh"), []byte("shell"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(rootfs, "bin", "sh"), filepath.Join(rootfs, "bin", "ash")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sh", filepath.Join(rootfs, "bin", "bash")); err != nil {
+		t.Fatal(err)
+	}
+
+	img := &LayoutImage{
+		Rootfs: rootfs,
+		Config: imgspecv1.ImageConfig{
+			Env: []string{"PATH=/bin"},
+			Cmd: []string{"/bin/sh"},
+		},
+		RootOwned: true,
+	}
+
+	// writing the same tag twice must leave a single tagged image
+	for i := 0; i < 2; i++ {
+		if err := WriteLayout(dir, "v1", img); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := WriteLayout(dir, "v2", img); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 2 {
+		t.Fatalf("got %d manifests, expected 2", len(index.Manifests))
+	}
+
+	ref, err := layout.NewReference(dir, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	image, err := ref.NewImage(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer image.Close()
+
+	if n := len(image.LayerInfos()); n != 1 {
+		t.Errorf("got %d layers, expected 1", n)
+	}
+	config, err := image.OCIConfig(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(config.Config, img.Config) {
+		t.Errorf("got config %+v, expected %+v", config.Config, img.Config)
+	}
+}
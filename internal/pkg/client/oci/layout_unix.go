@@ -0,0 +1,28 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package oci
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode identifies a file linked several times in an archived tree.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLink returns the inode of fi if the file has several links.
+func hardLink(fi os.FileInfo) (inode, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"os"
+)
+
+type inode struct{}
+
+// hardLink never reports hard links, archived files are all stored
+// as regular files.
+func hardLink(fi os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
@@ -66,7 +66,11 @@ func (t *ImageReference) newImageSource(ctx context.Context, sys *types.SystemCo
 		return nil, err
 	}
 
-	// First we are fetching into the cache
+	// First we are fetching into the cache, layers are downloaded
+	// concurrently before copy.Image copies the remaining blobs
+	if err := PrefetchLayers(ctx, t.ImageReference, t.source, sys); err != nil {
+		sylog.Debugf("Could not prefetch image layers: %s", err)
+	}
 	err = copy.Image(context.Background(), policyCtx, t.ImageReference, t.source, &copy.Options{
 		ReportWriter: w,
 		SourceCtx:    sys,
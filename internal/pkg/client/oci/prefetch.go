@@ -0,0 +1,125 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containers/image/types"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// prefetchWorkers is the number of layers downloaded concurrently.
+const prefetchWorkers = 3
+
+// PrefetchLayers downloads concurrently the layers of the registry image
+// src missing from the OCI layout dest, copy.Image then finds the layers
+// in the layout and only has to copy the image manifest and configuration.
+// Images from other sources than registries are left to copy.Image.
+func PrefetchLayers(ctx context.Context, dest, src types.ImageReference, sys *types.SystemContext) error {
+	if src.Transport().Name() != "docker" {
+		return nil
+	}
+
+	img, err := src.NewImage(ctx, sys)
+	if err != nil {
+		return err
+	}
+	layers := img.LayerInfos()
+	img.Close()
+
+	d, err := dest.NewImageDestination(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	var missing []types.BlobInfo
+	for _, l := range layers {
+		if len(l.URLs) != 0 {
+			// foreign layers are not copied
+			continue
+		}
+		if ok, _, err := d.HasBlob(ctx, l); err != nil {
+			return err
+		} else if !ok {
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) < 2 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blobs := make(chan types.BlobInfo)
+	errs := make(chan error, prefetchWorkers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < prefetchWorkers && i < len(missing); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := prefetchWorker(ctx, d, src, sys, blobs); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+send:
+	for _, l := range missing {
+		select {
+		case blobs <- l:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(blobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// prefetchWorker copies the blobs received from the blobs channel from
+// src to dest, each worker has its own image source as registry clients
+// are not safe for concurrent use.
+func prefetchWorker(ctx context.Context, dest types.ImageDestination, src types.ImageReference, sys *types.SystemContext, blobs <-chan types.BlobInfo) error {
+	is, err := src.NewImageSource(ctx, sys)
+	if err != nil {
+		return err
+	}
+	defer is.Close()
+
+	for l := range blobs {
+		if ctx.Err() != nil {
+			continue
+		}
+		sylog.Debugf("Prefetching layer %s", l.Digest)
+
+		r, _, err := is.GetBlob(ctx, l)
+		if err != nil {
+			return fmt.Errorf("while fetching layer %s: %s", l.Digest, err)
+		}
+		info, err := dest.PutBlob(ctx, r, l, false)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("while storing layer %s: %s", l.Digest, err)
+		}
+		if info.Digest != l.Digest {
+			return fmt.Errorf("layer %s digest mismatch: got %s", l.Digest, info.Digest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// SigRTMin is the first real-time signal number as seen by
+// programs linked against glibc.
+const SigRTMin = 34
+
+// CheckpointSignal is the signal sent to the instance master process
+// to process a pending checkpoint request.
+const CheckpointSignal = syscall.Signal(SigRTMin + 6)
+
+const checkpointFile = "checkpoint.json"
+
+// CheckpointRequest represents a checkpoint request processed by the
+// instance master process, the master process sets Done and Error and
+// stores the request in the checkpoint directory once the checkpoint
+// is finished.
+type CheckpointRequest struct {
+	Dir          string `json:"dir"`
+	LeaveRunning bool   `json:"leaveRunning"`
+	Done         bool   `json:"done"`
+	Error        string `json:"error,omitempty"`
+}
+
+// WriteCheckpointRequest stores the checkpoint request in the instance
+// directory.
+func (i *File) WriteCheckpointRequest(req *CheckpointRequest) error {
+	return writeCheckpoint(filepath.Join(filepath.Dir(i.Path), checkpointFile), req)
+}
+
+// ReadCheckpointRequest reads the checkpoint request stored in the
+// instance directory.
+func (i *File) ReadCheckpointRequest() (*CheckpointRequest, error) {
+	return readCheckpoint(filepath.Join(filepath.Dir(i.Path), checkpointFile))
+}
+
+// DeleteCheckpointRequest removes the checkpoint request stored in the
+// instance directory.
+func (i *File) DeleteCheckpointRequest() error {
+	return deleteCheckpoint(filepath.Join(filepath.Dir(i.Path), checkpointFile))
+}
+
+// WriteCheckpointResult stores the finished checkpoint request in the
+// checkpoint directory, it remains readable after the instance exits.
+func WriteCheckpointResult(req *CheckpointRequest) error {
+	return writeCheckpoint(filepath.Join(req.Dir, checkpointFile), req)
+}
+
+// ReadCheckpointResult reads the finished checkpoint request stored in
+// the checkpoint directory dir.
+func ReadCheckpointResult(dir string) (*CheckpointRequest, error) {
+	return readCheckpoint(filepath.Join(dir, checkpointFile))
+}
+
+// DeleteCheckpointResult removes the checkpoint request stored in the
+// checkpoint directory dir.
+func DeleteCheckpointResult(dir string) error {
+	return deleteCheckpoint(filepath.Join(dir, checkpointFile))
+}
+
+func writeCheckpoint(path string, req *CheckpointRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(b); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write checkpoint request %s: %s", tmp, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// rename so readers never see a partially written request
+	return os.Rename(tmp, path)
+}
+
+func readCheckpoint(path string) (*CheckpointRequest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	req := new(CheckpointRequest)
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint request: %s", err)
+	}
+	return req, nil
+}
+
+func deleteCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestCheckpointRequest(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := &File{Path: filepath.Join(dir, "test.json")}
+
+	if _, err := file.ReadCheckpointRequest(); !os.IsNotExist(err) {
+		t.Errorf("unexpected error for missing request: %v", err)
+	}
+
+	req := &CheckpointRequest{Dir: "/tmp/checkpoint", LeaveRunning: true}
+	if err := file.WriteCheckpointRequest(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	r, err := file.ReadCheckpointRequest()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *r != *req {
+		t.Errorf("got request %+v, expected %+v", r, req)
+	}
+
+	if err := file.DeleteCheckpointRequest(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := file.DeleteCheckpointRequest(); err != nil {
+		t.Errorf("unexpected error for deleted request: %s", err)
+	}
+
+	req = &CheckpointRequest{Dir: dir, Done: true, Error: "dump failed"}
+	if err := WriteCheckpointResult(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r, err = ReadCheckpointResult(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *r != *req {
+		t.Errorf("got result %+v, expected %+v", r, req)
+	}
+	if err := DeleteCheckpointResult(dir); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HealthcheckScript is the path of the healthcheck script in images
+	HealthcheckScript = "/.singularity.d/healthcheck"
+	// HealthcheckConfig is the path of the healthcheck parameters in images
+	HealthcheckConfig = "/.singularity.d/healthcheck.json"
+)
+
+const (
+	// HealthStarting is the health status of an instance until its
+	// healthcheck succeeds or its start period is over
+	HealthStarting = "starting"
+	// Healthy is the health status of an instance whose last
+	// healthcheck succeeded
+	Healthy = "healthy"
+	// Unhealthy is the health status of an instance whose healthcheck
+	// failed the configured number of consecutive retries
+	Unhealthy = "unhealthy"
+)
+
+// default healthcheck parameters, identical to Docker ones
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 30 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+// HealthConfig holds the healthcheck parameters, zero values mean the
+// default ones.
+type HealthConfig struct {
+	// Interval is the time between two checks
+	Interval time.Duration `json:"interval,omitempty"`
+	// Timeout is the time after which a check is considered failed
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// StartPeriod is the initialization time during which failed
+	// checks are not counted
+	StartPeriod time.Duration `json:"startPeriod,omitempty"`
+	// Retries is the number of consecutive failures needed to
+	// consider the instance unhealthy
+	Retries int `json:"retries,omitempty"`
+}
+
+// Health holds the healthcheck status of an instance.
+type Health struct {
+	Status        string    `json:"status"`
+	FailingStreak int       `json:"failingStreak"`
+	LastCheck     time.Time `json:"lastCheck,omitempty"`
+	LastExitCode  int       `json:"lastExitCode"`
+	LastOutput    string    `json:"lastOutput,omitempty"`
+}
+
+// ParseHealthArgs parses the arguments of a %healthcheck section of the
+// form --interval=30s --timeout=30s --start-period=0s --retries=3.
+func ParseHealthArgs(args string) (*HealthConfig, error) {
+	config := &HealthConfig{}
+
+	// trim comments like for other sections arguments
+	fields := strings.Fields(strings.Split(args, "#")[0])
+	for i := 0; i < len(fields); i++ {
+		opt := fields[i]
+		if !strings.HasPrefix(opt, "--") {
+			return nil, fmt.Errorf("unexpected healthcheck argument %q", opt)
+		}
+		opt = strings.TrimPrefix(opt, "--")
+
+		value := ""
+		if kv := strings.SplitN(opt, "=", 2); len(kv) == 2 {
+			opt, value = kv[0], kv[1]
+		} else if i+1 < len(fields) {
+			i++
+			value = fields[i]
+		} else {
+			return nil, fmt.Errorf("missing value for healthcheck option --%s", opt)
+		}
+
+		var err error
+		switch opt {
+		case "interval":
+			config.Interval, err = parseHealthDuration(value)
+		case "timeout":
+			config.Timeout, err = parseHealthDuration(value)
+		case "start-period":
+			config.StartPeriod, err = parseHealthDuration(value)
+		case "retries":
+			config.Retries, err = strconv.Atoi(value)
+			if err == nil && config.Retries < 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		default:
+			return nil, fmt.Errorf("unknown healthcheck option --%s", opt)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad value %q for healthcheck option --%s: %s", value, opt, err)
+		}
+	}
+	return config, nil
+}
+
+func parseHealthDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	} else if d < 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// ReadHealthConfig decodes healthcheck parameters and applies the default
+// values to unset parameters.
+func ReadHealthConfig(data []byte) (*HealthConfig, error) {
+	config := &HealthConfig{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("while decoding healthcheck parameters: %s", err)
+		}
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultHealthInterval
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultHealthTimeout
+	}
+	if config.Retries == 0 {
+		config.Retries = DefaultHealthRetries
+	}
+	return config, nil
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/util/signal"
+)
+
+// HealthAction describes the action taken when an instance becomes
+// unhealthy.
+type HealthAction struct {
+	// Restart stops the instance and starts it again
+	Restart bool
+	// Signal is sent to the instance process if not zero
+	Signal syscall.Signal
+}
+
+// ParseHealthAction parses an action taken when an instance becomes
+// unhealthy: none, restart or signal:<signal>. It returns nil for none.
+func ParseHealthAction(action string) (*HealthAction, error) {
+	switch {
+	case action == "" || action == "none":
+		return nil, nil
+	case action == "restart":
+		return &HealthAction{Restart: true}, nil
+	case strings.HasPrefix(action, "signal:"):
+		sig, err := signal.Convert(strings.TrimPrefix(action, "signal:"))
+		if err != nil {
+			return nil, err
+		}
+		return &HealthAction{Signal: sig}, nil
+	}
+	return nil, fmt.Errorf("unknown healthcheck failure action %q, must be none, restart or signal:<signal>", action)
+}
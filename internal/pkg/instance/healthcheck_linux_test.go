@@ -0,0 +1,39 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParseHealthAction(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected *HealthAction
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"none", nil, false},
+		{"restart", &HealthAction{Restart: true}, false},
+		{"signal:SIGTERM", &HealthAction{Signal: syscall.SIGTERM}, false},
+		{"signal:HUP", &HealthAction{Signal: syscall.SIGHUP}, false},
+		{"signal:BAD", nil, true},
+		{"reboot", nil, true},
+	}
+
+	for _, tt := range tests {
+		action, err := ParseHealthAction(tt.action)
+		if tt.wantErr && err == nil {
+			t.Errorf("unexpected success for %q", tt.action)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.action, err)
+		} else if !reflect.DeepEqual(action, tt.expected) {
+			t.Errorf("got %+v for %q, expected %+v", action, tt.action, tt.expected)
+		}
+	}
+}
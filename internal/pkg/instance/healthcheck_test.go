@@ -0,0 +1,68 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHealthArgs(t *testing.T) {
+	tests := []struct {
+		args     string
+		expected *HealthConfig
+	}{
+		{"", &HealthConfig{}},
+		{"--interval=10s --timeout 2s", &HealthConfig{Interval: 10 * time.Second, Timeout: 2 * time.Second}},
+		{"--start-period=1m --retries=5 # comment", &HealthConfig{StartPeriod: time.Minute, Retries: 5}},
+		{"--interval", nil},
+		{"--interval=-1s", nil},
+		{"--retries=abc", nil},
+		{"--unknown=1", nil},
+		{"interval=10s", nil},
+	}
+
+	for _, tt := range tests {
+		config, err := ParseHealthArgs(tt.args)
+		if err != nil && tt.expected != nil {
+			t.Errorf("unexpected error for %q: %s", tt.args, err)
+		} else if err == nil && tt.expected == nil {
+			t.Errorf("unexpected success for %q", tt.args)
+		} else if !reflect.DeepEqual(config, tt.expected) {
+			t.Errorf("got %+v for %q, expected %+v", config, tt.args, tt.expected)
+		}
+	}
+}
+
+func TestReadHealthConfig(t *testing.T) {
+	config, err := ReadHealthConfig(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := &HealthConfig{
+		Interval: DefaultHealthInterval,
+		Timeout:  DefaultHealthTimeout,
+		Retries:  DefaultHealthRetries,
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("got %+v, expected %+v", config, expected)
+	}
+
+	config, err = ReadHealthConfig([]byte(`{"interval":1000000000,"retries":1}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected.Interval = time.Second
+	expected.Retries = 1
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("got %+v, expected %+v", config, expected)
+	}
+
+	if _, err := ReadHealthConfig([]byte("{")); err == nil {
+		t.Errorf("unexpected success with bad JSON")
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/syfs"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 const (
@@ -43,6 +44,18 @@ type File struct {
 	Image  string `json:"image"`
 	Config []byte `json:"config"`
 	UserNs bool   `json:"userns"`
+	// ControlSocket is the path of the control socket served
+	// by the instance master process
+	ControlSocket string `json:"controlSocket,omitempty"`
+	// ExecAgentSocket is the path of the exec agent socket of
+	// instances started with --exec-agent
+	ExecAgentSocket string `json:"execAgentSocket,omitempty"`
+	// Health is the healthcheck status of instances started
+	// from an image with a healthcheck
+	Health *Health `json:"health,omitempty"`
+	// Cgroup is the cgroup path of instances started with
+	// --apply-cgroups
+	Cgroup string `json:"cgroup,omitempty"`
 }
 
 // ProcName returns processus name based on instance name
@@ -119,7 +132,7 @@ func Get(name string, subDir string) (*File, error) {
 		return nil, err
 	}
 	if len(list) != 1 {
-		return nil, fmt.Errorf("no instance found with name %s", name)
+		return nil, errcode.New(errcode.InstanceNotFound, "no instance found with name %s", name)
 	}
 	return list[0], nil
 }
@@ -210,15 +223,33 @@ func (i *File) Update() error {
 	return file.Sync()
 }
 
+// GetLogFilePaths returns the paths of the stdout and stderr log files
+// of the named instance
+func GetLogFilePaths(name string, subDir string) (string, string, error) {
+	path, err := getPath("", subDir)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(path, name+".out"), filepath.Join(path, name+".err"), nil
+}
+
+// GetLogPath returns the path of the structured log file of the
+// named instance
+func GetLogPath(name string, subDir string) (string, error) {
+	path, err := getPath("", subDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, name+".log"), nil
+}
+
 // SetLogFile replaces stdout/stderr streams and redirect content
 // to log file
 func SetLogFile(name string, uid int, subDir string) (*os.File, *os.File, error) {
-	path, err := getPath("", subDir)
+	stdoutPath, stderrPath, err := GetLogFilePaths(name, subDir)
 	if err != nil {
 		return nil, nil, err
 	}
-	stderrPath := filepath.Join(path, name+".err")
-	stdoutPath := filepath.Join(path, name+".out")
 
 	oldumask := syscall.Umask(0)
 	defer syscall.Umask(oldumask)
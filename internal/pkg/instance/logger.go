@@ -8,13 +8,16 @@ package instance
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 )
 
 const (
@@ -33,8 +36,28 @@ func kubernetesLogFormatter(stream, data string) string {
 	return fmt.Sprintf("%s %s F %s\n", time.Now().Format(time.RFC3339Nano), stream, data)
 }
 
+// LogEntry represents a log line written with the JSON log format.
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Log    string    `json:"log"`
+}
+
 func jsonLogFormatter(stream, data string) string {
-	return fmt.Sprintf("{\"time\":\"%s\",\"stream\":\"%s\",\"log\":\"%s\"}\n", time.Now().Format(time.RFC3339Nano), stream, data)
+	b, err := json.Marshal(&LogEntry{Time: time.Now(), Stream: stream, Log: data})
+	if err != nil {
+		return ""
+	}
+	return string(b) + "\n"
+}
+
+// ParseLogEntry decodes a log line written with the JSON log format.
+func ParseLogEntry(line []byte) (*LogEntry, error) {
+	entry := &LogEntry{}
+	if err := json.Unmarshal(line, entry); err != nil {
+		return nil, fmt.Errorf("while decoding log entry: %s", err)
+	}
+	return entry, nil
 }
 
 func basicLogFormatter(stream, data string) string {
@@ -57,6 +80,9 @@ var LogFormats = map[string]LogFormatter{
 type Logger struct {
 	fm        sync.Mutex // protect file
 	file      *os.File
+	size      int64
+	maxSize   int64
+	maxFiles  int
 	formatter LogFormatter
 	cm        sync.Mutex // protect closers array
 	closers   []closer
@@ -81,13 +107,80 @@ func NewLogger(logPath string, formatter LogFormatter) (*Logger, error) {
 }
 
 func (l *Logger) openFile(path string) (err error) {
-	oldmask := syscall.Umask(0)
-	defer syscall.Umask(oldmask)
+	oldmask := fs.Umask(0)
+	defer fs.Umask(oldmask)
 
 	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	fi, err := l.file.Stat()
+	if err != nil {
+		l.file.Close()
+		l.file = nil
+		return err
+	}
+	l.size = fi.Size()
+	return nil
+}
+
+// SetRotation enables size based rotation of the log file, once the log
+// file reaches maxSize bytes it's renamed with a .1 suffix, and previously
+// rotated files are shifted up to maxFiles rotated files.
+func (l *Logger) SetRotation(maxSize int64, maxFiles int) {
+	l.fm.Lock()
+	defer l.fm.Unlock()
+
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+	l.maxSize = maxSize
+	l.maxFiles = maxFiles
+}
+
+// rotate shifts rotated log files and re-opens an empty log file, it
+// must be called with the file lock held. If the log files can't be
+// shifted, the current log file is re-opened and keeps growing.
+func (l *Logger) rotate() error {
+	filename := l.file.Name()
+	l.file.Sync()
+	l.file.Close()
+	l.file = nil
+
+	var err error
+	for i := l.maxFiles - 1; i > 0 && err == nil; i-- {
+		src := fmt.Sprintf("%s.%d", filename, i)
+		if err = os.Rename(src, fmt.Sprintf("%s.%d", filename, i+1)); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(filename, filename+".1")
+	}
+	if openErr := l.openFile(filename); openErr != nil {
+		return openErr
+	}
 	return err
 }
 
+// LogFiles returns the paths of the existing log files for the log
+// path, rotated files first from the oldest to the current log file.
+func LogFiles(path string) []string {
+	var files []string
+
+	for i := 1; ; i++ {
+		rotated := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		files = append([]string{rotated}, files...)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
 func (l *Logger) scanOutput(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -135,15 +228,23 @@ func (l *Logger) scan(stream string, pr *io.PipeReader, pw *io.PipeWriter, dropC
 			// this section is locked to ensure that log file is
 			// not being written while ReOpenFile is called
 			l.fm.Lock()
-			// means ReOpenFile has failed proceed with cleanup
+			// means ReOpenFile or rotate has failed, the output is
+			// drained until cleanup to not block the writer
 			if l.file == nil {
 				l.fm.Unlock()
-				break
+				continue
 			}
+			var n int
 			if !dropCRNL {
-				fmt.Fprint(l.file, l.formatter(stream, r.Replace(scanner.Text())))
+				n, _ = fmt.Fprint(l.file, l.formatter(stream, r.Replace(scanner.Text())))
 			} else {
-				fmt.Fprint(l.file, l.formatter(stream, scanner.Text()))
+				n, _ = fmt.Fprint(l.file, l.formatter(stream, scanner.Text()))
+			}
+			l.size += int64(n)
+			if l.maxSize > 0 && l.size >= l.maxSize {
+				if err := l.rotate(); err != nil {
+					sylog.Warningf("While rotating log file: %s", err)
+				}
 			}
 			l.fm.Unlock()
 		}
@@ -9,6 +9,8 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/sylabs/singularity/internal/pkg/test"
@@ -119,3 +121,130 @@ func TestLogger(t *testing.T) {
 		}
 	}
 }
+
+func TestLoggerRotation(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "log-rotation-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "instance.log")
+
+	logger, err := NewLogger(filename, LogFormats[JSONLogFormat])
+	if err != nil {
+		t.Fatalf("failed to create new logger: %s", err)
+	}
+	// rotate after each entry
+	logger.SetRotation(1, 2)
+
+	writer, err := logger.NewWriter("stdout", true)
+	if err != nil {
+		t.Fatalf("failed to add new writer: %s", err)
+	}
+	for _, line := range []string{"first", "second", "third"} {
+		writer.Write([]byte(line + "\n"))
+	}
+	logger.Close()
+
+	files := LogFiles(filename)
+	expected := []string{filename + ".2", filename + ".1", filename}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("got log files %v, expected %v", files, expected)
+	}
+
+	// the first entry has been dropped with the oldest rotated file
+	for i, line := range []string{"second", "third", ""} {
+		d, err := ioutil.ReadFile(files[i])
+		if err != nil {
+			t.Fatalf("failed to read log data: %s", err)
+		}
+		if line == "" {
+			if len(d) != 0 {
+				t.Errorf("unexpected data in %s: %s", files[i], d)
+			}
+			continue
+		}
+		entry, err := ParseLogEntry(bytes.TrimSpace(d))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if entry.Stream != "stdout" || entry.Log != line {
+			t.Errorf("got entry %+v in %s, expected %q", entry, files[i], line)
+		}
+	}
+}
+
+func TestLoggerRotationFailure(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "log-rotation-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "instance.log")
+
+	// a non empty directory can't be replaced by the rotated file
+	if err := os.MkdirAll(filepath.Join(filename+".1", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := NewLogger(filename, LogFormats[JSONLogFormat])
+	if err != nil {
+		t.Fatalf("failed to create new logger: %s", err)
+	}
+	logger.SetRotation(1, 1)
+
+	writer, err := logger.NewWriter("stdout", true)
+	if err != nil {
+		t.Fatalf("failed to add new writer: %s", err)
+	}
+	lines := []string{"first", "second", "third"}
+	for _, line := range lines {
+		if _, err := writer.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("unexpected error while writing %s: %s", line, err)
+		}
+	}
+	logger.Close()
+
+	// entries are still written to the log file
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read log data: %s", err)
+	}
+	entries := bytes.Split(bytes.TrimSpace(d), []byte("\n"))
+	if len(entries) != len(lines) {
+		t.Fatalf("got %d log entries, expected %d", len(entries), len(lines))
+	}
+	for i, e := range entries {
+		entry, err := ParseLogEntry(e)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if entry.Log != lines[i] {
+			t.Errorf("got entry %+v, expected %q", entry, lines[i])
+		}
+	}
+}
+
+func TestParseLogEntry(t *testing.T) {
+	line := LogFormats[JSONLogFormat]("stderr", "a \"quoted\"\tvalue")
+
+	entry, err := ParseLogEntry([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if entry.Stream != "stderr" || entry.Log != "a \"quoted\"\tvalue" || entry.Time.IsZero() {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	if _, err := ParseLogEntry([]byte("2019-10-01T00:00:00Z stdout F test")); err == nil {
+		t.Errorf("unexpected success with a non JSON log line")
+	}
+}
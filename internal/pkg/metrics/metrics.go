@@ -0,0 +1,47 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package metrics collects the resource usage of Singularity instances
+// from their cgroup accounting and /proc, and exposes it in the Prometheus
+// text format.
+package metrics
+
+import "time"
+
+// Metrics holds the resource usage of an instance.
+type Metrics struct {
+	// Instance is the instance name
+	Instance string `json:"instance"`
+	// User is the instance owner
+	User string `json:"user"`
+	// Pid is the instance process ID
+	Pid int `json:"pid"`
+	// Time is the time the metrics were collected at
+	Time time.Time `json:"time"`
+	// Cgroup reports if cgroup accounting is available, CPU, memory,
+	// block I/O and processes statistics are zero otherwise
+	Cgroup bool `json:"cgroup"`
+	// CPUUsage is the total CPU time consumed in nanoseconds
+	CPUUsage uint64 `json:"cpuUsage"`
+	// MemoryUsage is the memory usage in bytes
+	MemoryUsage uint64 `json:"memoryUsage"`
+	// MemoryLimit is the memory limit in bytes, 0 means no limit
+	MemoryLimit uint64 `json:"memoryLimit"`
+	// BlkioRead is the number of bytes read from block devices
+	BlkioRead uint64 `json:"blkioRead"`
+	// BlkioWrite is the number of bytes written to block devices
+	BlkioWrite uint64 `json:"blkioWrite"`
+	// Pids is the number of processes
+	Pids uint64 `json:"pids"`
+	// Network reports if the instance has its own network namespace,
+	// network statistics are zero otherwise
+	Network bool `json:"network"`
+	// NetRxBytes is the number of bytes received by the network
+	// interfaces other than loopback
+	NetRxBytes uint64 `json:"netRxBytes"`
+	// NetTxBytes is the number of bytes sent by the network
+	// interfaces other than loopback
+	NetTxBytes uint64 `json:"netTxBytes"`
+}
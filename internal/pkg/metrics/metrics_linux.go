@@ -0,0 +1,108 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+)
+
+// Collect returns the resource usage of the instance i. Cgroup statistics
+// require the instance to be started with --apply-cgroups and network
+// statistics an instance network namespace, the corresponding metrics
+// are reported as unavailable otherwise.
+func Collect(i *instance.File) (*Metrics, error) {
+	m := &Metrics{
+		Instance: i.Name,
+		User:     i.User,
+		Pid:      i.Pid,
+		Time:     time.Now(),
+	}
+
+	if i.Cgroup != "" {
+		manager := &cgroups.Manager{Pid: i.Pid}
+		stats, err := manager.Stats()
+		if err != nil {
+			return nil, fmt.Errorf("while reading instance %s cgroup statistics: %s", i.Name, err)
+		}
+		m.Cgroup = true
+		m.CPUUsage = stats.CPUUsage
+		m.MemoryUsage = stats.MemoryUsage
+		m.MemoryLimit = stats.MemoryLimit
+		m.BlkioRead = stats.BlkioRead
+		m.BlkioWrite = stats.BlkioWrite
+		m.Pids = stats.Pids
+	}
+
+	netns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/net", i.Pid))
+	if err != nil {
+		return nil, fmt.Errorf("while reading instance %s network namespace: %s", i.Name, err)
+	}
+	selfns, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return nil, fmt.Errorf("while reading network namespace: %s", err)
+	}
+
+	// counters of the host network namespace are not instance ones
+	if netns != selfns {
+		f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", i.Pid))
+		if err != nil {
+			return nil, fmt.Errorf("while reading instance %s network statistics: %s", i.Name, err)
+		}
+		defer f.Close()
+
+		if m.NetRxBytes, m.NetTxBytes, err = parseNetDev(f); err != nil {
+			return nil, fmt.Errorf("while parsing instance %s network statistics: %s", i.Name, err)
+		}
+		m.Network = true
+	}
+
+	return m, nil
+}
+
+// parseNetDev returns the number of bytes received and sent by the
+// network interfaces listed in the /proc/net/dev format, the loopback
+// interface is ignored.
+func parseNetDev(r io.Reader) (uint64, uint64, error) {
+	var rx, tx uint64
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// the first two lines are headers without interface name
+		splitted := strings.SplitN(scanner.Text(), ":", 2)
+		if len(splitted) != 2 {
+			continue
+		}
+		if strings.TrimSpace(splitted[0]) == "lo" {
+			continue
+		}
+
+		// receive and transmit bytes are the 1st and 9th fields
+		fields := strings.Fields(splitted[1])
+		if len(fields) < 16 {
+			return 0, 0, fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		r, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		t, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		rx += r
+		tx += t
+	}
+	return rx, tx, scanner.Err()
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package metrics
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+)
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    5000      50    0    0    0     0          0         0     5000      50    0    0    0     0       0          0
+  eth0:    1000      10    0    0    0     0          0         0      300       3    0    0    0     0       0          0
+  eth1:      24       1    0    0    0     0          0         0       12       1    0    0    0     0       0          0
+`
+
+func TestParseNetDev(t *testing.T) {
+	rx, tx, err := parseNetDev(strings.NewReader(testNetDev))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rx != 1024 || tx != 312 {
+		t.Errorf("got rx=%d tx=%d, expected rx=1024 tx=312", rx, tx)
+	}
+
+	if _, _, err := parseNetDev(strings.NewReader("eth0: 1 2 3\n")); err == nil {
+		t.Errorf("unexpected success with a truncated line")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	m, err := Collect(&instance.File{Name: "test", User: "user", Pid: os.Getpid()})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Cgroup || m.Network {
+		t.Errorf("unexpected cgroup or network statistics for the current process: %+v", m)
+	}
+	if m.Instance != "test" || m.Pid != os.Getpid() {
+		t.Errorf("unexpected instance information: %+v", m)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// PrometheusContentType is the content type of the Prometheus text format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family describes a Prometheus metric family and how to get its value
+// from instance metrics, available returns false when the instance
+// doesn't provide the metric.
+type family struct {
+	name      string
+	help      string
+	kind      string
+	value     func(m *Metrics) float64
+	available func(m *Metrics) bool
+}
+
+func cgroupAvailable(m *Metrics) bool {
+	return m.Cgroup
+}
+
+func networkAvailable(m *Metrics) bool {
+	return m.Network
+}
+
+var families = []family{
+	{
+		name:      "singularity_instance_cpu_seconds_total",
+		help:      "Total CPU time consumed by the instance processes in seconds.",
+		kind:      "counter",
+		value:     func(m *Metrics) float64 { return float64(m.CPUUsage) / float64(time.Second) },
+		available: cgroupAvailable,
+	},
+	{
+		name:      "singularity_instance_memory_usage_bytes",
+		help:      "Memory used by the instance processes in bytes.",
+		kind:      "gauge",
+		value:     func(m *Metrics) float64 { return float64(m.MemoryUsage) },
+		available: cgroupAvailable,
+	},
+	{
+		name:  "singularity_instance_memory_limit_bytes",
+		help:  "Memory limit of the instance in bytes.",
+		kind:  "gauge",
+		value: func(m *Metrics) float64 { return float64(m.MemoryLimit) },
+		available: func(m *Metrics) bool {
+			return m.Cgroup && m.MemoryLimit != 0
+		},
+	},
+	{
+		name:      "singularity_instance_blkio_read_bytes_total",
+		help:      "Bytes read from block devices by the instance processes.",
+		kind:      "counter",
+		value:     func(m *Metrics) float64 { return float64(m.BlkioRead) },
+		available: cgroupAvailable,
+	},
+	{
+		name:      "singularity_instance_blkio_write_bytes_total",
+		help:      "Bytes written to block devices by the instance processes.",
+		kind:      "counter",
+		value:     func(m *Metrics) float64 { return float64(m.BlkioWrite) },
+		available: cgroupAvailable,
+	},
+	{
+		name:      "singularity_instance_processes",
+		help:      "Number of instance processes.",
+		kind:      "gauge",
+		value:     func(m *Metrics) float64 { return float64(m.Pids) },
+		available: cgroupAvailable,
+	},
+	{
+		name:      "singularity_instance_network_receive_bytes_total",
+		help:      "Bytes received by the instance network interfaces.",
+		kind:      "counter",
+		value:     func(m *Metrics) float64 { return float64(m.NetRxBytes) },
+		available: networkAvailable,
+	},
+	{
+		name:      "singularity_instance_network_transmit_bytes_total",
+		help:      "Bytes sent by the instance network interfaces.",
+		kind:      "counter",
+		value:     func(m *Metrics) float64 { return float64(m.NetTxBytes) },
+		available: networkAvailable,
+	},
+}
+
+// escapeLabel escapes a label value as required by the text format.
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+// WritePrometheus writes the metrics of the instances in list to w
+// in the Prometheus text format, families without any available
+// metric are omitted.
+func WritePrometheus(w io.Writer, list []*Metrics) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		header := false
+		for _, m := range list {
+			if !f.available(m) {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+				header = true
+			}
+			fmt.Fprintf(bw, "%s{instance=\"%s\",user=\"%s\"} %g\n", f.name, escapeLabel(m.Instance), escapeLabel(m.User), f.value(m))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ServePrometheus serves the metrics returned by collect in the Prometheus
+// text format on /metrics to the connections accepted by l, collect is
+// called for each scrape. It returns when l is closed.
+func ServePrometheus(l net.Listener, collect func() ([]*Metrics, error)) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		list, err := collect()
+		if err != nil {
+			sylog.Warningf("Could not collect instance metrics: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", PrometheusContentType)
+		if err := WritePrometheus(w, list); err != nil {
+			sylog.Debugf("Could not write instance metrics: %s", err)
+		}
+	})
+
+	return http.Serve(l, mux)
+}
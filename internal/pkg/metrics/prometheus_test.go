@@ -0,0 +1,105 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+var testMetrics = []*Metrics{
+	{
+		Instance:    "db",
+		User:        "root",
+		Cgroup:      true,
+		CPUUsage:    1500000000,
+		MemoryUsage: 4096,
+		BlkioRead:   1024,
+		BlkioWrite:  512,
+		Pids:        3,
+	},
+	{
+		Instance:   `web"1`,
+		User:       "root",
+		Network:    true,
+		NetRxBytes: 100,
+		NetTxBytes: 200,
+	},
+}
+
+const expectedPrometheus = `# HELP singularity_instance_cpu_seconds_total Total CPU time consumed by the instance processes in seconds.
+# TYPE singularity_instance_cpu_seconds_total counter
+singularity_instance_cpu_seconds_total{instance="db",user="root"} 1.5
+# HELP singularity_instance_memory_usage_bytes Memory used by the instance processes in bytes.
+# TYPE singularity_instance_memory_usage_bytes gauge
+singularity_instance_memory_usage_bytes{instance="db",user="root"} 4096
+# HELP singularity_instance_blkio_read_bytes_total Bytes read from block devices by the instance processes.
+# TYPE singularity_instance_blkio_read_bytes_total counter
+singularity_instance_blkio_read_bytes_total{instance="db",user="root"} 1024
+# HELP singularity_instance_blkio_write_bytes_total Bytes written to block devices by the instance processes.
+# TYPE singularity_instance_blkio_write_bytes_total counter
+singularity_instance_blkio_write_bytes_total{instance="db",user="root"} 512
+# HELP singularity_instance_processes Number of instance processes.
+# TYPE singularity_instance_processes gauge
+singularity_instance_processes{instance="db",user="root"} 3
+# HELP singularity_instance_network_receive_bytes_total Bytes received by the instance network interfaces.
+# TYPE singularity_instance_network_receive_bytes_total counter
+singularity_instance_network_receive_bytes_total{instance="web\"1",user="root"} 100
+# HELP singularity_instance_network_transmit_bytes_total Bytes sent by the instance network interfaces.
+# TYPE singularity_instance_network_transmit_bytes_total counter
+singularity_instance_network_transmit_bytes_total{instance="web\"1",user="root"} 200
+`
+
+func TestWritePrometheus(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := WritePrometheus(&b, testMetrics); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != expectedPrometheus {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", b.String(), expectedPrometheus)
+	}
+
+	b.Reset()
+	if err := WritePrometheus(&b, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("unexpected output without metrics: %s", b.String())
+	}
+}
+
+func TestServePrometheus(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go ServePrometheus(l, func() ([]*Metrics, error) {
+		return testMetrics, nil
+	})
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("could not scrape metrics: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != PrometheusContentType {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != expectedPrometheus {
+		t.Errorf("unexpected metrics:\n%s", body)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package mounthook runs the executables configured by the administrator
+// with the "pre mount hook" and "post mount hook" directives, right before
+// and after the container mount points are assembled.
+package mounthook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	// PreMount is the stage executed before the container mount
+	// points are assembled, hooks can print additional bind mounts
+	// on their standard output.
+	PreMount = "pre-mount"
+	// PostMount is the stage executed once the container mount
+	// points are assembled.
+	PostMount = "post-mount"
+)
+
+// defaultPath is the PATH environment variable set for hooks.
+const defaultPath = "/bin:/sbin:/usr/bin:/usr/sbin"
+
+// Hook describes a mount hook execution.
+type Hook struct {
+	// Path is the absolute path of the hook executable.
+	Path string
+	// Stage is the stage the hook is executed for.
+	Stage string
+	// Pid is the PID of the container process.
+	Pid int
+	// Rootfs is the container root filesystem path in the container
+	// process mount namespace.
+	Rootfs string
+	// Root runs the hook as root, otherwise the hook is run with the
+	// current user identity.
+	Root bool
+}
+
+// Run executes the hook with config written on its standard input and
+// returns the mounts printed as an OCI mounts JSON array on its standard
+// output. A hook exiting with a non-zero status aborts the container
+// creation with its standard error as error message.
+func (h *Hook) Run(config []byte) ([]specs.Mount, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(h.Path)
+	cmd.Stdin = bytes.NewReader(config)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Dir = "/"
+	cmd.Env = []string{
+		"PATH=" + defaultPath,
+		"SINGULARITY_MOUNT_HOOK_STAGE=" + h.Stage,
+		"SINGULARITY_CONTAINER_PID=" + strconv.Itoa(h.Pid),
+		"SINGULARITY_CONTAINER_ROOTFS=" + h.Rootfs,
+	}
+	if h.Root {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: 0, Gid: 0},
+		}
+	}
+
+	sylog.Debugf("Running %s mount hook %s", h.Stage, h.Path)
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s mount hook %s failed: %s", h.Stage, h.Path, msg)
+	}
+
+	if stderr.Len() > 0 {
+		sylog.Debugf("%s mount hook %s: %s", h.Stage, h.Path, strings.TrimSpace(stderr.String()))
+	}
+
+	return h.parseMounts(stdout.Bytes())
+}
+
+// check verifies the hook executable, a hook run as root must be
+// owned by root and not writable by group and others.
+func (h *Hook) check() error {
+	if !filepath.IsAbs(h.Path) {
+		return fmt.Errorf("mount hook %s is not an absolute path", h.Path)
+	}
+
+	fi, err := os.Stat(h.Path)
+	if err != nil {
+		return fmt.Errorf("mount hook %s: %s", h.Path, err)
+	}
+	if !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+		return fmt.Errorf("mount hook %s is not an executable file", h.Path)
+	}
+
+	if h.Root {
+		st := fi.Sys().(*syscall.Stat_t)
+		if st.Uid != 0 {
+			return fmt.Errorf("mount hook %s is not owned by root", h.Path)
+		}
+		if fi.Mode()&022 != 0 {
+			return fmt.Errorf("mount hook %s is writable by group or others", h.Path)
+		}
+	}
+	return nil
+}
+
+// parseMounts returns the bind mounts printed by a pre-mount hook, output
+// of post-mount hooks is ignored.
+func (h *Hook) parseMounts(output []byte) ([]specs.Mount, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil, nil
+	}
+	if h.Stage != PreMount {
+		sylog.Debugf("%s mount hook %s output: %s", h.Stage, h.Path, output)
+		return nil, nil
+	}
+
+	var mounts []specs.Mount
+
+	if err := json.Unmarshal(output, &mounts); err != nil {
+		return nil, fmt.Errorf("while parsing %s mount hook %s output: %s", h.Stage, h.Path, err)
+	}
+	for _, m := range mounts {
+		if m.Type != "" && m.Type != "bind" {
+			return nil, fmt.Errorf("%s mount hook %s: only bind mounts are supported, got %s mount for %s", h.Stage, h.Path, m.Type, m.Destination)
+		}
+		if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Destination) {
+			return nil, fmt.Errorf("%s mount hook %s: source and destination must be absolute paths", h.Stage, h.Path)
+		}
+	}
+	return mounts, nil
+}
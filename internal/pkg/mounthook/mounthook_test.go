@@ -0,0 +1,111 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mounthook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHook(t *testing.T, dir, name, script string, mode os.FileMode) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mounthook-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		script string
+		mode   os.FileMode
+		stage  string
+		mounts int
+		fail   bool
+	}{
+		{
+			name:   "bind mounts",
+			script: `cat >/dev/null; echo '[{"source": "/opt/site", "destination": "/site", "options": ["ro"]}]'`,
+			mode:   0755,
+			stage:  PreMount,
+			mounts: 1,
+		},
+		{
+			name:   "environment",
+			script: `test "$SINGULARITY_MOUNT_HOOK_STAGE" = "post-mount" -a "$SINGULARITY_CONTAINER_PID" = "42"`,
+			mode:   0755,
+			stage:  PostMount,
+		},
+		{
+			name:   "post-mount output ignored",
+			script: `echo '[{"source": "/opt/site", "destination": "/site"}]'`,
+			mode:   0755,
+			stage:  PostMount,
+		},
+		{
+			name:   "config on stdin",
+			script: `grep -q '"image"'`,
+			mode:   0755,
+			stage:  PreMount,
+		},
+		{
+			name:   "rejected",
+			script: `echo "/site is not allowed" >&2; exit 1`,
+			mode:   0755,
+			stage:  PreMount,
+			fail:   true,
+		},
+		{
+			name:  "not executable",
+			mode:  0644,
+			stage: PreMount,
+			fail:  true,
+		},
+		{
+			name:   "relative source",
+			script: `echo '[{"source": "site", "destination": "/site"}]'`,
+			mode:   0755,
+			stage:  PreMount,
+			fail:   true,
+		},
+		{
+			name:   "not a bind mount",
+			script: `echo '[{"source": "tmpfs", "destination": "/site", "type": "tmpfs"}]'`,
+			mode:   0755,
+			stage:  PreMount,
+			fail:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &Hook{
+				Path:  writeHook(t, dir, fmt.Sprintf("hook%d", i), tt.script, tt.mode),
+				Stage: tt.stage,
+				Pid:   42,
+			}
+			mounts, err := hook.Run([]byte(`{"jsonConfig": {"image": "/tmp/image.sif"}}`))
+			if err != nil && !tt.fail {
+				t.Errorf("unexpected error: %s", err)
+			} else if err == nil && tt.fail {
+				t.Errorf("unexpected success")
+			}
+			if len(mounts) != tt.mounts {
+				t.Errorf("got %d mounts, expected %d", len(mounts), tt.mounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package ocihooks loads OCI hooks from hooks.d directories configured by
+// the administrator and injects those matching a container configuration.
+// Hook files follow the format used by other OCI runtimes and container
+// engines (https://github.com/containers/libpod/blob/master/pkg/hooks/docs/oci-hooks.5.md).
+package ocihooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// Version is the supported hook file format version.
+const Version = "1.0.0"
+
+const (
+	// Prestart stage.
+	Prestart = "prestart"
+	// Poststart stage.
+	Poststart = "poststart"
+	// Poststop stage.
+	Poststop = "poststop"
+)
+
+// When holds the conditions for which a hook is injected, a hook is
+// injected if all the conditions set match, or if any of them matches
+// when Or is true.
+type When struct {
+	// Always matches when true and never matches when false.
+	Always *bool `json:"always,omitempty"`
+	// Annotations maps regular expressions matching annotation keys
+	// to regular expressions matching their values.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Commands are regular expressions matching the container
+	// process executable.
+	Commands []string `json:"commands,omitempty"`
+	// HasBindMounts matches when true and the container has bind mounts.
+	HasBindMounts *bool `json:"hasBindMounts,omitempty"`
+	// Or injects the hook if any of the conditions matches.
+	Or bool `json:"or"`
+}
+
+// annotation holds the compiled regular expressions of an
+// annotation condition.
+type annotation struct {
+	key   *regexp.Regexp
+	value *regexp.Regexp
+}
+
+// Hook describes a hook file.
+type Hook struct {
+	Version string     `json:"version"`
+	Hook    specs.Hook `json:"hook"`
+	When    When       `json:"when"`
+	Stages  []string   `json:"stages"`
+
+	annotations []annotation
+	commands    []*regexp.Regexp
+}
+
+// Read reads and validates the hook file path.
+func Read(path string) (*Hook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := new(Hook)
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("while parsing hook %s: %s", path, err)
+	}
+	if err := h.validate(); err != nil {
+		return nil, fmt.Errorf("invalid hook %s: %s", path, err)
+	}
+	return h, nil
+}
+
+func (h *Hook) validate() error {
+	if h.Version != Version {
+		return fmt.Errorf("unsupported version %q, expected %q", h.Version, Version)
+	}
+	if !filepath.IsAbs(h.Hook.Path) {
+		return fmt.Errorf("hook path %q is not an absolute path", h.Hook.Path)
+	}
+	if len(h.Stages) == 0 {
+		return fmt.Errorf("no stages specified")
+	}
+	for _, s := range h.Stages {
+		switch s {
+		case Prestart, Poststart, Poststop:
+		default:
+			return fmt.Errorf("unknown stage %q", s)
+		}
+	}
+	h.annotations = make([]annotation, 0, len(h.When.Annotations))
+	for k, v := range h.When.Annotations {
+		kr, err := regexp.Compile(k)
+		if err != nil {
+			return fmt.Errorf("bad annotation key regexp %q: %s", k, err)
+		}
+		vr, err := regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("bad annotation value regexp %q: %s", v, err)
+		}
+		h.annotations = append(h.annotations, annotation{key: kr, value: vr})
+	}
+	h.commands = make([]*regexp.Regexp, 0, len(h.When.Commands))
+	for _, c := range h.When.Commands {
+		cr, err := regexp.Compile(c)
+		if err != nil {
+			return fmt.Errorf("bad command regexp %q: %s", c, err)
+		}
+		h.commands = append(h.commands, cr)
+	}
+	return nil
+}
+
+// Match returns if the hook must be injected for the container
+// configuration spec. A hook without any condition never matches.
+func (h *Hook) Match(spec *specs.Spec) bool {
+	w := h.When
+	conditions := 0
+	matches := 0
+
+	check := func(match bool) {
+		conditions++
+		if match {
+			matches++
+		}
+	}
+
+	if w.Always != nil {
+		check(*w.Always)
+	}
+
+	if w.HasBindMounts != nil {
+		check(*w.HasBindMounts && hasBindMounts(spec))
+	}
+
+	for _, a := range h.annotations {
+		match := false
+		for key, value := range spec.Annotations {
+			if a.key.MatchString(key) && a.value.MatchString(value) {
+				match = true
+				break
+			}
+		}
+		check(match)
+	}
+
+	if len(h.commands) > 0 {
+		match := false
+		if spec.Process != nil && len(spec.Process.Args) > 0 {
+			for _, c := range h.commands {
+				if c.MatchString(spec.Process.Args[0]) {
+					match = true
+					break
+				}
+			}
+		}
+		check(match)
+	}
+
+	if w.Or {
+		return matches > 0
+	}
+	return conditions > 0 && matches == conditions
+}
+
+// hasBindMounts returns if the container configuration spec has
+// bind mounts.
+func hasBindMounts(spec *specs.Spec) bool {
+	for _, m := range spec.Mounts {
+		for _, o := range m.Options {
+			if o == "bind" || o == "rbind" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadDirs reads hook files with a .json extension from dirs, a hook
+// file takes precedence over files with the same name found in the
+// preceding directories. Hooks are returned sorted by file name and
+// missing directories are ignored.
+func ReadDirs(dirs []string) ([]*Hook, error) {
+	files := make(map[string]string)
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			sylog.Debugf("Ignoring missing hooks directory %s", dir)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading hooks directory %s: %s", dir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+				continue
+			}
+			files[e.Name()] = filepath.Join(dir, e.Name())
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	hooks := make([]*Hook, 0, len(names))
+	for _, n := range names {
+		h, err := Read(files[n])
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// Apply injects hooks found in dirs matching the container configuration
+// spec, injected hooks are appended after hooks already present in spec.
+func Apply(spec *specs.Spec, dirs []string) error {
+	hooks, err := ReadDirs(dirs)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hooks {
+		if !h.Match(spec) {
+			continue
+		}
+		sylog.Debugf("Injecting OCI hook %s for stages %s", h.Hook.Path, strings.Join(h.Stages, ", "))
+		if spec.Hooks == nil {
+			spec.Hooks = &specs.Hooks{}
+		}
+		for _, s := range h.Stages {
+			switch s {
+			case Prestart:
+				spec.Hooks.Prestart = append(spec.Hooks.Prestart, h.Hook)
+			case Poststart:
+				spec.Hooks.Poststart = append(spec.Hooks.Poststart, h.Hook)
+			case Poststop:
+				spec.Hooks.Poststop = append(spec.Hooks.Poststop, h.Hook)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ocihooks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func writeHook(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks.d-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		fail    bool
+	}{
+		{
+			name:    "valid",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}, "stages": ["prestart"]}`,
+		},
+		{
+			name:    "bad version",
+			content: `{"version": "2.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}, "stages": ["prestart"]}`,
+			fail:    true,
+		},
+		{
+			name:    "relative path",
+			content: `{"version": "1.0.0", "hook": {"path": "true"}, "when": {"always": true}, "stages": ["prestart"]}`,
+			fail:    true,
+		},
+		{
+			name:    "unknown stage",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}, "stages": ["prerun"]}`,
+			fail:    true,
+		},
+		{
+			name:    "bad regexp",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"commands": ["("]}, "stages": ["prestart"]}`,
+			fail:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeHook(t, dir, "hook.json", tt.content)
+			_, err := Read(filepath.Join(dir, "hook.json"))
+			if err != nil && !tt.fail {
+				t.Errorf("unexpected error: %s", err)
+			} else if err == nil && tt.fail {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	siteDir, err := ioutil.TempDir("", "hooks.d-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(siteDir)
+
+	localDir, err := ioutil.TempDir("", "hooks.d-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	writeHook(t, siteDir, "10-gpu.json", `{
+		"version": "1.0.0",
+		"hook": {"path": "/usr/libexec/gpu-hook", "args": ["gpu-hook", "prestart"]},
+		"when": {"annotations": {"^com\\.example\\.gpu$": "^true$"}},
+		"stages": ["prestart", "poststop"]
+	}`)
+	writeHook(t, siteDir, "20-monitor.json", `{
+		"version": "1.0.0",
+		"hook": {"path": "/usr/libexec/monitor-hook"},
+		"when": {"commands": ["/httpd$"]},
+		"stages": ["poststart"]
+	}`)
+	// overrides the site hook with the same name
+	writeHook(t, localDir, "20-monitor.json", `{
+		"version": "1.0.0",
+		"hook": {"path": "/usr/local/libexec/monitor-hook"},
+		"when": {"commands": ["/httpd$"]},
+		"stages": ["poststart"]
+	}`)
+
+	spec := &specs.Spec{
+		Process:     &specs.Process{Args: []string{"/usr/sbin/httpd"}},
+		Annotations: map[string]string{"com.example.gpu": "false"},
+	}
+	if err := Apply(spec, []string{siteDir, localDir, "/non/existent"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 0 || len(spec.Hooks.Poststop) != 0 {
+		t.Errorf("unexpected gpu hook injection: %+v", spec.Hooks)
+	}
+	if len(spec.Hooks.Poststart) != 1 || spec.Hooks.Poststart[0].Path != "/usr/local/libexec/monitor-hook" {
+		t.Errorf("unexpected poststart hooks: %+v", spec.Hooks.Poststart)
+	}
+
+	spec = &specs.Spec{
+		Process:     &specs.Process{Args: []string{"/bin/sh"}},
+		Annotations: map[string]string{"com.example.gpu": "true"},
+	}
+	if err := Apply(spec, []string{siteDir, localDir}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 1 || len(spec.Hooks.Poststop) != 1 || len(spec.Hooks.Poststart) != 0 {
+		t.Errorf("unexpected hooks: %+v", spec.Hooks)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	yes, no := true, false
+
+	spec := &specs.Spec{
+		Process:     &specs.Process{Args: []string{"/usr/sbin/httpd"}},
+		Annotations: map[string]string{"com.example.gpu": "true"},
+		Mounts: []specs.Mount{
+			{Destination: "/data", Source: "/srv/data", Options: []string{"rbind", "ro"}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		when  When
+		match bool
+	}{
+		{
+			name:  "no condition",
+			when:  When{},
+			match: false,
+		},
+		{
+			name:  "always true",
+			when:  When{Always: &yes},
+			match: true,
+		},
+		{
+			name:  "always false",
+			when:  When{Always: &no},
+			match: false,
+		},
+		{
+			name:  "always false with matching command",
+			when:  When{Always: &no, Commands: []string{"/httpd$"}},
+			match: false,
+		},
+		{
+			name:  "always false or matching command",
+			when:  When{Always: &no, Commands: []string{"/httpd$"}, Or: true},
+			match: true,
+		},
+		{
+			name:  "and all matching",
+			when:  When{Annotations: map[string]string{`^com\.example\.gpu$`: "^true$"}, Commands: []string{"/httpd$"}, HasBindMounts: &yes},
+			match: true,
+		},
+		{
+			name:  "and with command mismatch",
+			when:  When{Annotations: map[string]string{`^com\.example\.gpu$`: "^true$"}, Commands: []string{"/nginx$"}},
+			match: false,
+		},
+		{
+			name:  "and with annotation mismatch",
+			when:  When{Annotations: map[string]string{`^com\.example\.gpu$`: "^true$", `^com\.example\.mpi$`: ".*"}, Commands: []string{"/httpd$"}},
+			match: false,
+		},
+		{
+			name:  "or with command mismatch",
+			when:  When{Annotations: map[string]string{`^com\.example\.gpu$`: "^true$"}, Commands: []string{"/nginx$"}, Or: true},
+			match: true,
+		},
+		{
+			name:  "or all mismatching",
+			when:  When{Annotations: map[string]string{`^com\.example\.gpu$`: "^false$"}, Commands: []string{"/nginx$"}, Or: true},
+			match: false,
+		},
+		{
+			name:  "any command",
+			when:  When{Commands: []string{"/nginx$", "/httpd$"}},
+			match: true,
+		},
+		{
+			name:  "has bind mounts false",
+			when:  When{HasBindMounts: &no, Commands: []string{"/httpd$"}},
+			match: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Hook{
+				Version: Version,
+				Hook:    specs.Hook{Path: "/bin/true"},
+				When:    tt.when,
+				Stages:  []string{Prestart},
+			}
+			if err := h.validate(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if m := h.Match(spec); m != tt.match {
+				t.Errorf("got match %v, expected %v", m, tt.match)
+			}
+		})
+	}
+}
@@ -17,8 +17,8 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	ocitypes "github.com/containers/image/types"
 	"github.com/deislabs/oras/pkg/content"
@@ -39,10 +39,16 @@ const (
 
 	// SifLayerMediaType is the mediaType for the "layer" which contains the actual SIF file
 	SifLayerMediaType = "appliciation/vnd.sylabs.sif.layer.tar"
+
+	// SifLayerMediaTypeV1 is the registered mediaType of SIF file layers
+	SifLayerMediaTypeV1 = "application/vnd.sylabs.sif.layer.v1.sif"
 )
 
-// DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials
-func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) error {
+// DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials,
+// an interrupted download is resumed by the next download of the same image to the same file
+func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig, opts *Options) error {
+	o := opts.withDefaults()
+
 	ref = strings.TrimPrefix(ref, "//")
 
 	spec, err := reference.Parse(ref)
@@ -58,34 +64,29 @@ func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) er
 
 	resolver := docker.NewResolver(docker.ResolverOptions{Credentials: genCredfn(ociAuth)})
 
-	wd, err := os.Getwd()
+	ctx := orasctx.Background()
+
+	man, err := fetchManifest(ctx, resolver, spec.String())
 	if err != nil {
-		return fmt.Errorf("failed to get working directory: %s", err)
+		return err
 	}
 
-	store := content.NewFileStore(wd)
-	defer store.Close()
-
-	store.AllowPathTraversalOnWrite = true
-	store.DisableOverwrite = true
-
-	allowedMediaTypes := oras.WithAllowedMediaTypes([]string{SifLayerMediaType})
-	handlerFunc := func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
-		if desc.MediaType == SifLayerMediaType {
-			// Ensure descriptor is of a single file
-			// AnnotationUnpack indicates that the descriptor is of a directory
-			if desc.Annotations[content.AnnotationUnpack] == "true" {
-				return nil, fmt.Errorf("descriptor is of a bundled directory, not a SIF image")
-			}
-			nameOld, _ := content.ResolveName(desc)
-			_ = store.MapPath(nameOld, imagePath)
-		}
-		return nil, nil
+	desc, err := selectLayer(man, o.MediaTypes)
+	if err != nil {
+		return err
+	}
+	// Ensure descriptor is of a single file
+	// AnnotationUnpack indicates that the descriptor is of a directory
+	if desc.Annotations[content.AnnotationUnpack] == "true" {
+		return fmt.Errorf("descriptor is of a bundled directory, not a SIF image")
 	}
-	pullHandler := oras.WithPullBaseHandler(images.HandlerFunc(handlerFunc))
 
-	_, _, err = oras.Pull(orasctx.Background(), resolver, spec.String(), store, allowedMediaTypes, pullHandler)
+	fetcher, err := resolver.Fetcher(ctx, spec.String())
 	if err != nil {
+		return fmt.Errorf("while creating fetcher for reference: %v", err)
+	}
+
+	if err := fetchBlob(ctx, fetcher, desc, imagePath, o); err != nil {
 		return fmt.Errorf("unable to pull from registry: %s", err)
 	}
 
@@ -105,8 +106,10 @@ func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) er
 }
 
 // UploadImage uploads the image specified by path and pushes it to the provided oci reference,
-// it will use credentials if supplied
-func UploadImage(path, ref string, ociAuth *ocitypes.DockerAuthConfig) error {
+// it will use credentials if supplied. The SIF layer is uploaded by chunks
+func UploadImage(path, ref string, ociAuth *ocitypes.DockerAuthConfig, opts *Options) error {
+	o := opts.withDefaults()
+
 	// ensure that are uploading a SIF
 	if err := ensureSIF(path); err != nil {
 		return err
@@ -146,14 +149,22 @@ func UploadImage(path, ref string, ociAuth *ocitypes.DockerAuthConfig) error {
 	// Get the filename from path and use it as the name in the file store
 	name := filepath.Base(path)
 
-	desc, err := store.Add(name, SifLayerMediaType, path)
+	desc, err := store.Add(name, o.MediaTypes[0], path)
 	if err != nil {
 		return fmt.Errorf("unable to add SIF file to FileStore: %s", err)
 	}
 
+	ctx := orasctx.Background()
+
+	if err := pushBlob(ctx, newRegistry(spec, ociAuth), desc, path, o); err != nil {
+		return fmt.Errorf("unable to push SIF layer: %s", err)
+	}
+
+	// the SIF layer is now in the registry and skipped by the push
+	// of the manifest and its config
 	descriptors := []ocispec.Descriptor{desc}
 
-	if _, err := oras.Push(orasctx.Background(), resolver, spec.String(), store, descriptors, oras.WithConfig(conf)); err != nil {
+	if _, err := oras.Push(ctx, resolver, spec.String(), store, descriptors, oras.WithConfig(conf)); err != nil {
 		return fmt.Errorf("unable to push: %s", err)
 	}
 
@@ -175,59 +186,69 @@ func ensureSIF(filepath string) error {
 	return nil
 }
 
-// ImageSHA returns the sha256 digest of the SIF layer of the OCI manifest
-// oci spec dictates only sha256 and sha512 are supported at time creation for this function
-// sha512 is currently optional for implementations, this function will return an error when
-// encountering such digests.
-// https://github.com/opencontainers/image-spec/blob/master/descriptor.md#registered-algorithms
-func ImageSHA(uri string, ociAuth *ocitypes.DockerAuthConfig) (string, error) {
-	ref := strings.TrimPrefix(uri, "//")
-
-	resolver := docker.NewResolver(docker.ResolverOptions{Credentials: genCredfn(ociAuth)})
-
-	_, desc, err := resolver.Resolve(context.Background(), ref)
+// fetchManifest returns the image manifest of the oci reference.
+func fetchManifest(ctx context.Context, resolver remotes.Resolver, ref string) (*ocispec.Manifest, error) {
+	_, desc, err := resolver.Resolve(ctx, ref)
 	if err != nil {
-		return "", fmt.Errorf("while resolving reference: %v", err)
+		return nil, fmt.Errorf("while resolving reference: %v", err)
 	}
 
 	// ensure that we received an image manifest descriptor
 	if desc.MediaType != ocispec.MediaTypeImageManifest {
-		return "", fmt.Errorf("could not get image manifest, received mediaType: %s", desc.MediaType)
+		return nil, fmt.Errorf("could not get image manifest, received mediaType: %s", desc.MediaType)
 	}
 
-	fetcher, err := resolver.Fetcher(context.Background(), ref)
+	fetcher, err := resolver.Fetcher(ctx, ref)
 	if err != nil {
-		return "", fmt.Errorf("while creating fetcher for reference: %v", err)
+		return nil, fmt.Errorf("while creating fetcher for reference: %v", err)
 	}
 
-	rc, err := fetcher.Fetch(context.Background(), desc)
+	rc, err := fetcher.Fetch(ctx, desc)
 	if err != nil {
-		return "", fmt.Errorf("while fetching manifest: %v", err)
+		return nil, fmt.Errorf("while fetching manifest: %v", err)
 	}
 	defer rc.Close()
 
 	b, err := ioutil.ReadAll(rc)
 	if err != nil {
-		return "", fmt.Errorf("while reading manifest: %v", err)
+		return nil, fmt.Errorf("while reading manifest: %v", err)
 	}
 
 	var man ocispec.Manifest
 	if err := json.Unmarshal(b, &man); err != nil {
-		return "", fmt.Errorf("while unmarshalling manifest: %v", err)
+		return nil, fmt.Errorf("while unmarshalling manifest: %v", err)
 	}
 
-	// search image layers for sif image and return sha
-	for _, l := range man.Layers {
-		if l.MediaType == SifLayerMediaType {
-			// only allow sha256 digests
-			if l.Digest.Algorithm() != digest.SHA256 {
-				return "", fmt.Errorf("SIF layer found with incorrect digest algorithm: %s", l.Digest.Algorithm())
-			}
-			return l.Digest.String(), nil
-		}
+	return &man, nil
+}
+
+// ImageSHA returns the sha256 digest of the SIF layer of the OCI manifest
+// oci spec dictates only sha256 and sha512 are supported at time creation for this function
+// sha512 is currently optional for implementations, this function will return an error when
+// encountering such digests.
+// https://github.com/opencontainers/image-spec/blob/master/descriptor.md#registered-algorithms
+func ImageSHA(uri string, ociAuth *ocitypes.DockerAuthConfig, opts *Options) (string, error) {
+	o := opts.withDefaults()
+
+	ref := strings.TrimPrefix(uri, "//")
+
+	resolver := docker.NewResolver(docker.ResolverOptions{Credentials: genCredfn(ociAuth)})
+
+	man, err := fetchManifest(context.Background(), resolver, ref)
+	if err != nil {
+		return "", err
 	}
 
-	return "", fmt.Errorf("no layer found corresponding to SIF image")
+	// search image layers for sif image and return sha
+	l, err := selectLayer(man, o.MediaTypes)
+	if err != nil {
+		return "", err
+	}
+	// only allow sha256 digests
+	if l.Digest.Algorithm() != digest.SHA256 {
+		return "", fmt.Errorf("SIF layer found with incorrect digest algorithm: %s", l.Digest.Algorithm())
+	}
+	return l.Digest.String(), nil
 }
 
 // ImageHash returns the appropriate hash for a provided image file
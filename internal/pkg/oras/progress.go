@@ -0,0 +1,34 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oras
+
+import (
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+// ProgressBar displays the progress of a transfer on the terminal.
+type ProgressBar struct {
+	bar *pb.ProgressBar
+}
+
+// Start creates and starts the progress bar.
+func (p *ProgressBar) Start(total, done int64) {
+	p.bar = pb.New64(total).SetUnits(pb.U_BYTES)
+	p.bar.ShowTimeLeft = true
+	p.bar.ShowSpeed = true
+	p.bar.Set64(done)
+	p.bar.Start()
+}
+
+// Add adds n bytes to the progress bar.
+func (p *ProgressBar) Add(n int64) {
+	p.bar.Add64(n)
+}
+
+// Finish stops the progress bar.
+func (p *ProgressBar) Finish() {
+	p.bar.Finish()
+}
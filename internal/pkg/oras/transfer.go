@@ -0,0 +1,556 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oras
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	ocitypes "github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	// DefaultChunkSize is the default size of upload chunks and
+	// download ranges
+	DefaultChunkSize = 32 * 1024 * 1024
+	// DefaultConcurrency is the default number of ranges downloaded
+	// concurrently
+	DefaultConcurrency = 4
+	// DefaultRetries is the default number of times a failed chunk or
+	// range transfer is retried
+	DefaultRetries = 3
+)
+
+// DefaultMediaTypes are the SIF layer media types accepted by default, by
+// order of preference. The legacy media type comes first so that pushed
+// images can still be pulled by older clients.
+var DefaultMediaTypes = []string{SifLayerMediaType, SifLayerMediaTypeV1}
+
+// Progress receives the progress of a SIF layer transfer.
+type Progress interface {
+	// Start is called once the size of the transfer is known, done is
+	// the size already transferred by a previous attempt
+	Start(total, done int64)
+	// Add is called with the number of bytes transferred, it may be
+	// called concurrently
+	Add(n int64)
+	// Finish is called once the transfer is complete
+	Finish()
+}
+
+type noProgress struct{}
+
+func (noProgress) Start(int64, int64) {}
+func (noProgress) Add(int64)          {}
+func (noProgress) Finish()            {}
+
+// Options holds the parameters of image transfers, zero values mean
+// the default ones.
+type Options struct {
+	// ChunkSize is the size of upload chunks and download ranges
+	ChunkSize int64
+	// Concurrency is the number of ranges downloaded concurrently
+	Concurrency int
+	// Retries is the number of times a failed chunk or range
+	// transfer is retried
+	Retries int
+	// Progress receives the transfer progress if set
+	Progress Progress
+	// MediaTypes are the SIF layer media types by order of preference,
+	// pulls select the first one found in the image manifest and pushes
+	// use the first one
+	MediaTypes []string
+}
+
+func (o *Options) withDefaults() Options {
+	opts := Options{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Retries <= 0 {
+		opts.Retries = DefaultRetries
+	}
+	if opts.Progress == nil {
+		opts.Progress = noProgress{}
+	}
+	if len(opts.MediaTypes) == 0 {
+		opts.MediaTypes = DefaultMediaTypes
+	}
+	return opts
+}
+
+// selectLayer returns the SIF layer of the manifest with the preferred
+// media type.
+func selectLayer(man *ocispec.Manifest, mediaTypes []string) (ocispec.Descriptor, error) {
+	for _, mt := range mediaTypes {
+		for _, l := range man.Layers {
+			if l.MediaType == mt {
+				return l, nil
+			}
+		}
+	}
+	return ocispec.Descriptor{}, fmt.Errorf("no layer found corresponding to SIF image")
+}
+
+// downloadState records the ranges of a blob already downloaded to resume
+// an interrupted download.
+type downloadState struct {
+	Digest    digest.Digest `json:"digest"`
+	ChunkSize int64         `json:"chunkSize"`
+	Done      []bool        `json:"done"`
+}
+
+// readDownloadState returns the state of a previous download of the blob
+// or an empty state if there is none or it doesn't match.
+func readDownloadState(path string, desc ocispec.Descriptor, chunkSize int64, chunks int) *downloadState {
+	state := &downloadState{
+		Digest:    desc.Digest,
+		ChunkSize: chunkSize,
+		Done:      make([]bool, chunks),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	prev := &downloadState{}
+	if err := json.Unmarshal(data, prev); err != nil {
+		return state
+	}
+	if prev.Digest != desc.Digest || prev.ChunkSize != chunkSize || len(prev.Done) != chunks {
+		return state
+	}
+	return prev
+}
+
+func writeDownloadState(path string, state *downloadState) {
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = ioutil.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		sylog.Debugf("Could not save download state, download won't be resumed: %s", err)
+	}
+}
+
+// rangeWriter writes sequentially to w from offset and reports the
+// written bytes.
+type rangeWriter struct {
+	w        io.WriterAt
+	offset   int64
+	progress Progress
+}
+
+func (r *rangeWriter) Write(p []byte) (int, error) {
+	n, err := r.w.WriteAt(p, r.offset)
+	r.offset += int64(n)
+	r.progress.Add(int64(n))
+	return n, err
+}
+
+// copyRange copies length bytes of the blob from offset to w and returns
+// the number of bytes copied.
+func copyRange(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, w io.WriterAt, offset, length int64, progress Progress) (int64, error) {
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	if rs, ok := rc.(io.Seeker); ok {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	} else if _, err := io.CopyN(ioutil.Discard, rc, offset); err != nil {
+		return 0, err
+	}
+
+	return io.CopyN(&rangeWriter{w: w, offset: offset, progress: progress}, rc, length)
+}
+
+// fetchRange downloads a range of the blob, the download is retried from
+// where it stopped on failure.
+func fetchRange(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, w io.WriterAt, offset, length int64, opts Options) error {
+	var err error
+
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			sylog.Debugf("Retrying download of %s from offset %d: %s", desc.Digest, offset, err)
+		}
+
+		var n int64
+		n, err = copyRange(ctx, fetcher, desc, w, offset, length, opts.Progress)
+		offset += n
+		length -= n
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return err
+}
+
+// fetchBlob downloads the blob to path by ranges downloaded concurrently.
+// The blob is downloaded to a partial file kept with its download state
+// on failure, so that a later download of the same blob resumes from the
+// ranges already downloaded.
+func fetchBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, path string, opts Options) error {
+	partial := path + ".partial"
+	statePath := partial + ".json"
+
+	chunks := int((desc.Size + opts.ChunkSize - 1) / opts.ChunkSize)
+	chunkRange := func(i int) (int64, int64) {
+		offset := int64(i) * opts.ChunkSize
+		if offset+opts.ChunkSize > desc.Size {
+			return offset, desc.Size - offset
+		}
+		return offset, opts.ChunkSize
+	}
+
+	state := readDownloadState(statePath, desc, opts.ChunkSize, chunks)
+	if _, err := os.Stat(partial); err != nil {
+		state.Done = make([]bool, chunks)
+	}
+
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %s", partial, err)
+	}
+	defer f.Close()
+
+	if err := f.Truncate(desc.Size); err != nil {
+		return fmt.Errorf("unable to allocate %s: %s", partial, err)
+	}
+
+	var (
+		done    int64
+		pending []int
+	)
+	for i, ok := range state.Done {
+		if ok {
+			_, length := chunkRange(i)
+			done += length
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	if done > 0 {
+		sylog.Infof("Resuming download of %s", desc.Digest)
+	}
+	opts.Progress.Start(desc.Size, done)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		fetchErr error
+	)
+
+	work := make(chan int)
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				offset, length := chunkRange(i)
+				err := fetchRange(ctx, fetcher, desc, f, offset, length, opts)
+
+				mu.Lock()
+				if err != nil && fetchErr == nil {
+					fetchErr = err
+				} else if err == nil {
+					state.Done[i] = true
+					writeDownloadState(statePath, state)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, i := range pending {
+		mu.Lock()
+		failed := fetchErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if fetchErr != nil {
+		return fetchErr
+	}
+	opts.Progress.Finish()
+
+	// the registry may have served a corrupted blob or the partial file
+	// may have been modified since the download was interrupted
+	sum, err := ImageHash(partial)
+	if err != nil {
+		return fmt.Errorf("unable to compute checksum of %s: %s", partial, err)
+	}
+	if sum != desc.Digest.String() {
+		os.Remove(partial)
+		os.Remove(statePath)
+		return fmt.Errorf("checksum of downloaded blob %s doesn't match %s", sum, desc.Digest)
+	}
+
+	if err := os.Rename(partial, path); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+
+	return nil
+}
+
+// registry sends blob requests to the registry holding an image, the
+// upload API of the containerd resolver only supports monolithic uploads.
+type registry struct {
+	base   url.URL
+	client *http.Client
+	auth   docker.Authorizer
+}
+
+func newRegistry(spec reference.Spec, ociAuth *ocitypes.DockerAuthConfig) *registry {
+	host := spec.Hostname()
+
+	base := url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   path.Join("/v2", strings.TrimPrefix(spec.Locator, host+"/")),
+	}
+	// same rules as the containerd resolver used for manifests
+	if h, err := docker.DefaultHost(host); err == nil {
+		base.Host = h
+	}
+	if strings.HasPrefix(base.Host, "localhost:") {
+		base.Scheme = "http"
+	}
+
+	return &registry{
+		base:   base,
+		client: http.DefaultClient,
+		auth:   docker.NewAuthorizer(http.DefaultClient, genCredfn(ociAuth)),
+	}
+}
+
+func (r *registry) url(ps ...string) string {
+	u := r.base
+	u.Path = path.Join(u.Path, path.Join(ps...))
+	return u.String()
+}
+
+func (r *registry) send(ctx context.Context, method, u string, body *io.SectionReader, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if body != nil {
+		req.Body = ioutil.NopCloser(io.NewSectionReader(body, 0, body.Size()))
+		req.ContentLength = body.Size()
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if err := r.auth.Authorize(ctx, req); err != nil {
+		return nil, err
+	}
+
+	return r.client.Do(req)
+}
+
+// do sends a request to the registry and authenticates on demand.
+func (r *registry) do(ctx context.Context, method, u string, body *io.SectionReader, header map[string]string) (*http.Response, error) {
+	resp, err := r.send(ctx, method, u, body, header)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err := r.auth.AddResponses(ctx, []*http.Response{resp}); err != nil {
+		return nil, fmt.Errorf("while authenticating to registry: %s", err)
+	}
+	return r.send(ctx, method, u, body, header)
+}
+
+func unexpectedStatus(resp *http.Response) error {
+	return fmt.Errorf("unexpected status from %s %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status)
+}
+
+// uploadLocation returns the absolute URL of the upload session returned
+// by the registry.
+func uploadLocation(resp *http.Response) (string, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("no upload location returned by registry")
+	}
+	u, err := resp.Request.URL.Parse(loc)
+	if err != nil {
+		return "", fmt.Errorf("bad upload location %q: %s", loc, err)
+	}
+	return u.String(), nil
+}
+
+// uploadStatus returns the location and the offset from which an upload
+// session continues.
+func uploadStatus(ctx context.Context, r *registry, location string) (string, int64, error) {
+	resp, err := r.do(ctx, http.MethodGet, location, nil, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return "", 0, unexpectedStatus(resp)
+	}
+	location, err = uploadLocation(resp)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// no range is returned when no bytes were received, otherwise the
+	// range is inclusive: 0-0 means the first byte was received
+	rng := strings.TrimPrefix(resp.Header.Get("Range"), "bytes=")
+	if rng == "" {
+		return location, 0, nil
+	}
+	bounds := strings.SplitN(rng, "-", 2)
+	if len(bounds) != 2 || bounds[0] != "0" {
+		return "", 0, fmt.Errorf("bad upload range %q", rng)
+	}
+	end, err := strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil || end < -1 {
+		return "", 0, fmt.Errorf("bad upload range %q", rng)
+	}
+	// 0--1 is returned for an empty upload by some registries
+	return location, end + 1, nil
+}
+
+// pushBlob uploads the blob stored at path by chunks, a failed chunk is
+// sent again from the offset reported by the registry.
+func pushBlob(ctx context.Context, r *registry, desc ocispec.Descriptor, path string, opts Options) error {
+	resp, err := r.do(ctx, http.MethodHead, r.url("blobs", desc.Digest.String()), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		sylog.Infof("Image layer %s already exists in registry", desc.Digest)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	resp, err = r.do(ctx, http.MethodPost, r.url("blobs", "uploads")+"/", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return unexpectedStatus(resp)
+	}
+	location, err := uploadLocation(resp)
+	if err != nil {
+		return err
+	}
+
+	opts.Progress.Start(desc.Size, 0)
+
+	var offset int64
+	retries := opts.Retries
+
+	for offset < desc.Size {
+		n := opts.ChunkSize
+		if offset+n > desc.Size {
+			n = desc.Size - offset
+		}
+		header := map[string]string{
+			"Content-Type":  "application/octet-stream",
+			"Content-Range": fmt.Sprintf("%d-%d", offset, offset+n-1),
+		}
+
+		resp, err := r.do(ctx, http.MethodPatch, location, io.NewSectionReader(f, offset, n), header)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusAccepted {
+				location, err = uploadLocation(resp)
+				if err != nil {
+					return err
+				}
+				offset += n
+				retries = opts.Retries
+				opts.Progress.Add(n)
+				continue
+			}
+			err = unexpectedStatus(resp)
+		}
+
+		if retries == 0 || ctx.Err() != nil {
+			return fmt.Errorf("while uploading chunk at offset %d: %s", offset, err)
+		}
+		retries--
+		sylog.Debugf("Retrying upload of %s from offset %d: %s", desc.Digest, offset, err)
+
+		// the registry may have stored a part of the failed chunk
+		var next int64
+		location, next, err = uploadStatus(ctx, r, location)
+		if err != nil {
+			return fmt.Errorf("while getting upload status: %s", err)
+		}
+		if next > offset {
+			opts.Progress.Add(next - offset)
+		}
+		offset = next
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("digest", desc.Digest.String())
+	u.RawQuery = q.Encode()
+
+	resp, err = r.do(ctx, http.MethodPut, u.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return unexpectedStatus(resp)
+	}
+	opts.Progress.Finish()
+
+	return nil
+}
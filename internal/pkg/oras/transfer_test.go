@@ -0,0 +1,349 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oras
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testFetcher serves a blob and fails reads crossing failAt while
+// failures remain.
+type testFetcher struct {
+	sync.Mutex
+
+	data     []byte
+	failAt   int64
+	failures int
+	served   int64
+}
+
+func (f *testFetcher) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	return &testReader{f: f}, nil
+}
+
+type testReader struct {
+	f      *testFetcher
+	offset int64
+}
+
+func (r *testReader) Seek(offset int64, whence int) (int64, error) {
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *testReader) Read(p []byte) (int, error) {
+	r.f.Lock()
+	defer r.f.Unlock()
+
+	if r.offset >= int64(len(r.f.data)) {
+		return 0, io.EOF
+	}
+	end := r.offset + int64(len(p))
+	if end > int64(len(r.f.data)) {
+		end = int64(len(r.f.data))
+	}
+
+	var err error
+	if r.f.failures > 0 && r.offset <= r.f.failAt && r.f.failAt < end {
+		r.f.failures--
+		end = r.f.failAt
+		err = fmt.Errorf("connection reset")
+	}
+
+	n := copy(p, r.f.data[r.offset:end])
+	r.offset += int64(n)
+	r.f.served += int64(n)
+	return n, err
+}
+
+func (r *testReader) Close() error {
+	return nil
+}
+
+func testBlob(size int) ([]byte, ocispec.Descriptor) {
+	data := make([]byte, size)
+	rand.Read(data)
+	return data, ocispec.Descriptor{
+		MediaType: SifLayerMediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(size),
+	}
+}
+
+func TestFetchBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oras-fetch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const chunkSize = 1024
+	data, desc := testBlob(10*chunkSize + 100)
+	path := filepath.Join(dir, "image.sif")
+
+	// a transient failure is retried from where the range stopped
+	fetcher := &testFetcher{data: data, failAt: 3*chunkSize + 10, failures: 1}
+	opts := (&Options{ChunkSize: chunkSize, Concurrency: 3}).withDefaults()
+	if err := fetchBlob(context.Background(), fetcher, desc, path, opts); err != nil {
+		t.Fatalf("fetchBlob() failed: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(path); !bytes.Equal(b, data) {
+		t.Fatalf("downloaded blob doesn't match")
+	}
+	if fetcher.served != desc.Size {
+		t.Errorf("%d bytes served instead of %d", fetcher.served, desc.Size)
+	}
+	os.Remove(path)
+
+	// a persistent failure leaves a partial download which is resumed
+	fetcher = &testFetcher{data: data, failAt: 2*chunkSize + 10, failures: DefaultRetries + 1}
+	opts = (&Options{ChunkSize: chunkSize, Concurrency: 1}).withDefaults()
+	if err := fetchBlob(context.Background(), fetcher, desc, path, opts); err == nil {
+		t.Fatalf("fetchBlob() succeeded with persistent failure")
+	}
+	if _, err := os.Stat(path + ".partial.json"); err != nil {
+		t.Fatalf("download state not saved: %s", err)
+	}
+
+	fetcher = &testFetcher{data: data}
+	if err := fetchBlob(context.Background(), fetcher, desc, path, opts); err != nil {
+		t.Fatalf("fetchBlob() failed to resume download: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(path); !bytes.Equal(b, data) {
+		t.Fatalf("resumed blob doesn't match")
+	}
+	if expected := desc.Size - 2*chunkSize; fetcher.served != expected {
+		t.Errorf("%d bytes served to resume instead of %d", fetcher.served, expected)
+	}
+	for _, p := range []string{path + ".partial", path + ".partial.json"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", p)
+		}
+	}
+
+	// a corrupted blob is rejected
+	os.Remove(path)
+	corrupted := append([]byte{}, data...)
+	corrupted[0]++
+	fetcher = &testFetcher{data: corrupted}
+	if err := fetchBlob(context.Background(), fetcher, desc, path, opts); err == nil {
+		t.Errorf("fetchBlob() succeeded with corrupted blob")
+	}
+}
+
+// testRegistry implements the blob upload API of a registry, the first
+// chunk sent at failAt is partially stored and rejected.
+type testRegistry struct {
+	sync.Mutex
+
+	blob    []byte
+	upload  bytes.Buffer
+	failAt  int
+	patches int
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	const uploads = "/v2/test/image/blobs/uploads/"
+	const location = uploads + "session"
+
+	switch {
+	case req.Method == http.MethodHead:
+		if r.blob == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodPost && req.URL.Path == uploads:
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPatch && req.URL.Path == location:
+		r.patches++
+		start, err := strconv.Atoi(strings.Split(req.Header.Get("Content-Range"), "-")[0])
+		if err != nil || start != r.upload.Len() {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		if r.failAt >= 0 && start == r.failAt {
+			r.failAt = -1
+			r.upload.Write(b[:len(b)/2])
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.upload.Write(b)
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodGet && req.URL.Path == location:
+		w.Header().Set("Location", location)
+		if r.upload.Len() > 0 {
+			w.Header().Set("Range", fmt.Sprintf("0-%d", r.upload.Len()-1))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodPut && req.URL.Path == location:
+		if digest.FromBytes(r.upload.Bytes()).String() != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blob = r.upload.Bytes()
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPushBlob(t *testing.T) {
+	const chunkSize = 1000
+	data, desc := testBlob(5*chunkSize + 10)
+
+	f, err := ioutil.TempFile("", "oras-push-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(data)
+	f.Close()
+
+	reg := &testRegistry{failAt: 2 * chunkSize}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	r := &registry{
+		base:   url.URL{Scheme: "http", Host: u.Host, Path: "/v2/test/image"},
+		client: srv.Client(),
+		auth:   docker.NewAuthorizer(srv.Client(), genCredfn(nil)),
+	}
+
+	opts := (&Options{ChunkSize: chunkSize}).withDefaults()
+	if err := pushBlob(context.Background(), r, desc, f.Name(), opts); err != nil {
+		t.Fatalf("pushBlob() failed: %s", err)
+	}
+	if !bytes.Equal(reg.blob, data) {
+		t.Fatalf("uploaded blob doesn't match")
+	}
+	// the upload continues from the part of the failed chunk stored
+	// by the registry: 0, 1000, 2000 (failed), 2500, 3500 and 4500
+	if expected := 6; reg.patches != expected {
+		t.Errorf("%d chunks sent instead of %d", reg.patches, expected)
+	}
+
+	// an existing blob is not uploaded again
+	reg.patches = 0
+	if err := pushBlob(context.Background(), r, desc, f.Name(), opts); err != nil {
+		t.Fatalf("pushBlob() failed for existing blob: %s", err)
+	}
+	if reg.patches != 0 {
+		t.Errorf("existing blob uploaded again")
+	}
+}
+
+func TestUploadStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		rng     string
+		offset  int64
+		wantErr bool
+	}{
+		{name: "NoBytes", status: http.StatusNoContent, offset: 0},
+		{name: "EmptyRange", status: http.StatusNoContent, rng: "0--1", offset: 0},
+		{name: "FirstByte", status: http.StatusNoContent, rng: "0-0", offset: 1},
+		{name: "Bytes", status: http.StatusNoContent, rng: "0-1499", offset: 1500},
+		{name: "BytesPrefix", status: http.StatusNoContent, rng: "bytes=0-1499", offset: 1500},
+		{name: "BadStart", status: http.StatusNoContent, rng: "10-1499", wantErr: true},
+		{name: "BadEnd", status: http.StatusNoContent, rng: "0-end", wantErr: true},
+		{name: "BadStatus", status: http.StatusNotFound, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Location", req.URL.Path)
+				if tt.rng != "" {
+					w.Header().Set("Range", tt.rng)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			u, _ := url.Parse(srv.URL)
+			r := &registry{
+				base:   url.URL{Scheme: "http", Host: u.Host, Path: "/v2/test/image"},
+				client: srv.Client(),
+				auth:   docker.NewAuthorizer(srv.Client(), genCredfn(nil)),
+			}
+
+			_, offset, err := uploadStatus(context.Background(), r, r.url("blobs", "uploads", "session"))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success with range %q", tt.rng)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if offset != tt.offset {
+				t.Errorf("got offset %d, expected %d", offset, tt.offset)
+			}
+		})
+	}
+}
+
+func TestSelectLayer(t *testing.T) {
+	man := &ocispec.Manifest{
+		Layers: []ocispec.Descriptor{
+			{MediaType: "application/octet-stream", Digest: "sha256:0"},
+			{MediaType: SifLayerMediaTypeV1, Digest: "sha256:1"},
+			{MediaType: SifLayerMediaType, Digest: "sha256:2"},
+		},
+	}
+
+	tests := []struct {
+		mediaTypes []string
+		expected   digest.Digest
+		fail       bool
+	}{
+		{mediaTypes: DefaultMediaTypes, expected: "sha256:2"},
+		{mediaTypes: []string{SifLayerMediaTypeV1, SifLayerMediaType}, expected: "sha256:1"},
+		{mediaTypes: []string{"application/unknown"}, fail: true},
+	}
+
+	for _, tt := range tests {
+		l, err := selectLayer(man, tt.mediaTypes)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("unexpected success with media types %v", tt.mediaTypes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error with media types %v: %s", tt.mediaTypes, err)
+		} else if l.Digest != tt.expected {
+			t.Errorf("layer %s selected instead of %s with media types %v", l.Digest, tt.expected, tt.mediaTypes)
+		}
+	}
+}
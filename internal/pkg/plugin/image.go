@@ -0,0 +1,19 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"github.com/sylabs/singularity/pkg/image"
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+type imageDriverRegistry struct{}
+
+// RegisterImageDriver registers an ImageDriverHook providing an image
+// driver to the runtime engine
+func (r *imageDriverRegistry) RegisterImageDriver(hook pluginapi.ImageDriverHook) error {
+	return image.RegisterDriver(hook.Name, hook.Driver)
+}
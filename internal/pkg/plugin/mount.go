@@ -0,0 +1,68 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"fmt"
+
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+type mountHookRegistry struct {
+	Hooks []pluginapi.MountHook
+}
+
+// RegisterMountHook registers a MountHook called by the runtime engine
+// before and after each container mount
+func (r *mountHookRegistry) RegisterMountHook(hook pluginapi.MountHook) error {
+	if hook.Name == "" {
+		return fmt.Errorf("mount hook without name")
+	}
+	if hook.PreMount == nil && hook.PostMount == nil {
+		return fmt.Errorf("mount hook %q without callback", hook.Name)
+	}
+	r.Hooks = append(r.Hooks, hook)
+	return nil
+}
+
+// HasMountHooks returns true if plugins registered mount hooks
+func HasMountHooks() bool {
+	assertInitialized()
+
+	return len(reg.mountHookRegistry.Hooks) > 0
+}
+
+// PreMountHooks runs the pre-mount callbacks of all registered mount
+// hooks, the first error returned by a callback vetoes the mount
+func PreMountHooks(spec *pluginapi.MountSpec) error {
+	assertInitialized()
+
+	return reg.mountHookRegistry.run(spec, true)
+}
+
+// PostMountHooks runs the post-mount callbacks of all registered
+// mount hooks
+func PostMountHooks(spec *pluginapi.MountSpec) error {
+	assertInitialized()
+
+	return reg.mountHookRegistry.run(spec, false)
+}
+
+func (r *mountHookRegistry) run(spec *pluginapi.MountSpec, pre bool) error {
+	for _, hook := range r.Hooks {
+		callback := hook.PostMount
+		if pre {
+			callback = hook.PreMount
+		}
+		if callback == nil {
+			continue
+		}
+		if err := callback(spec); err != nil {
+			return fmt.Errorf("mount hook %s: %s", hook.Name, err)
+		}
+	}
+	return nil
+}
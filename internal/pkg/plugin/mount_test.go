@@ -0,0 +1,82 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+func TestMountHookRegistry(t *testing.T) {
+	r := &mountHookRegistry{}
+
+	if err := r.RegisterMountHook(pluginapi.MountHook{PreMount: func(*pluginapi.MountSpec) error { return nil }}); err == nil {
+		t.Errorf("unexpected success with a hook without name")
+	}
+	if err := r.RegisterMountHook(pluginapi.MountHook{Name: "none"}); err == nil {
+		t.Errorf("unexpected success with a hook without callback")
+	}
+
+	var called []string
+
+	policy := pluginapi.MountHook{
+		Name: "policy",
+		PreMount: func(spec *pluginapi.MountSpec) error {
+			called = append(called, "policy-pre")
+			if strings.HasPrefix(spec.Source, "/scratch") {
+				return fmt.Errorf("bind mounts from /scratch are not allowed")
+			}
+			return nil
+		},
+	}
+	rewrite := pluginapi.MountHook{
+		Name: "rewrite",
+		PreMount: func(spec *pluginapi.MountSpec) error {
+			called = append(called, "rewrite-pre")
+			spec.Source = strings.Replace(spec.Source, "/data", "/site/data", 1)
+			return nil
+		},
+		PostMount: func(spec *pluginapi.MountSpec) error {
+			called = append(called, "rewrite-post")
+			return nil
+		},
+	}
+	for _, h := range []pluginapi.MountHook{policy, rewrite} {
+		if err := r.RegisterMountHook(h); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	spec := &pluginapi.MountSpec{Source: "/data/set", Destination: "/data/set", Options: []string{"bind"}}
+	if err := r.run(spec, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if spec.Source != "/site/data/set" {
+		t.Errorf("got source %s, expected /site/data/set", spec.Source)
+	}
+	if err := r.run(spec, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"policy-pre", "rewrite-pre", "rewrite-post"}
+	if !reflect.DeepEqual(called, expected) {
+		t.Errorf("got calls %v, expected %v", called, expected)
+	}
+
+	// the first veto stops the following hooks
+	called = nil
+	spec = &pluginapi.MountSpec{Source: "/scratch/user", Destination: "/scratch", Options: []string{"bind"}}
+	err := r.run(spec, true)
+	if err == nil || !strings.Contains(err.Error(), "mount hook policy") {
+		t.Errorf("got error %v, expected veto from policy hook", err)
+	}
+	if !reflect.DeepEqual(called, []string{"policy-pre"}) {
+		t.Errorf("got calls %v after veto", called)
+	}
+}
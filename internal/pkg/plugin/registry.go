@@ -13,6 +13,8 @@ import (
 type registry struct {
 	*flagRegistry
 	*commandRegistry
+	*imageDriverRegistry
+	*mountHookRegistry
 }
 
 var reg registry
@@ -26,5 +28,7 @@ func init() {
 		commandRegistry: &commandRegistry{
 			Commands: []*cobra.Command{},
 		},
+		imageDriverRegistry: &imageDriverRegistry{},
+		mountHookRegistry:   &mountHookRegistry{},
 	}
 }
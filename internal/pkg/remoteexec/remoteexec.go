@@ -0,0 +1,164 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package remoteexec proxies action commands to a Linux host reachable
+// over SSH, allowing to run containers from platforms without the
+// Singularity runtime.
+package remoteexec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/shell"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+)
+
+const (
+	// DefaultDir is the directory, relative to the remote user home
+	// directory, where local images are synced.
+	DefaultDir = ".singularity/remote-exec"
+	// DefaultBinary is the singularity binary invoked on the remote host.
+	DefaultBinary = "singularity"
+)
+
+// Host describes a remote Linux host running Singularity.
+type Host struct {
+	// Host is the SSH destination, as accepted by ssh(1), options
+	// like port or identity file are expected to be set in the
+	// user ssh configuration.
+	Host string
+	// Dir is the remote directory where local images are synced.
+	Dir string
+	// Binary is the path of the singularity binary on the remote host.
+	Binary string
+	// TTY requests a pseudo terminal for interactive commands.
+	TTY bool
+}
+
+// NewHost returns a remote host with default directory and binary.
+func NewHost(host string) (*Host, error) {
+	if host == "" {
+		return nil, fmt.Errorf("no remote host specified")
+	}
+	if strings.HasPrefix(host, "-") {
+		return nil, fmt.Errorf("invalid remote host %q", host)
+	}
+	return &Host{
+		Host:   host,
+		Dir:    DefaultDir,
+		Binary: DefaultBinary,
+	}, nil
+}
+
+// IsLocalImage returns true if image references a local image file or
+// sandbox directory which must be synced to the remote host before
+// execution. URIs like library:// or docker:// are resolved by the remote
+// host and paths not found locally are considered as remote paths.
+func IsLocalImage(image string) bool {
+	if t, _ := uri.Split(image); t != "" {
+		return false
+	}
+	fi, err := os.Stat(image)
+	if err != nil {
+		return false
+	}
+	return fi.Mode().IsRegular() || fi.IsDir()
+}
+
+// RemotePath returns the path where the local image is synced on the
+// remote host. Images are synced in a directory named after the hash of
+// their absolute local path, so images sharing the same name in different
+// local directories don't overwrite each other.
+func (h *Host) RemotePath(image string) string {
+	abs, err := filepath.Abs(image)
+	if err != nil {
+		abs = image
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return path.Join(h.Dir, hex.EncodeToString(sum[:8]), filepath.Base(abs))
+}
+
+// Sync copies a local image to the remote host and returns its remote
+// path, rsync is used when available so unchanged images and sandbox
+// files are not copied again, scp otherwise.
+func (h *Host) Sync(image string) (string, error) {
+	fi, err := os.Stat(image)
+	if err != nil {
+		return "", err
+	}
+	remote := h.RemotePath(image)
+	dir := path.Dir(remote)
+
+	prepare := []string{"mkdir", "-p", dir}
+	if fi.IsDir() {
+		if _, err := exec.LookPath("rsync"); err != nil {
+			// scp copies a directory into an existing destination
+			// directory instead of replacing its content
+			prepare = []string{"sh", "-c", `rm -rf -- "$1" && mkdir -p -- "$2"`, "sh", remote, dir}
+		}
+	}
+	mkdir := h.sshCommand(false, prepare...)
+	if out, err := mkdir.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("while creating %s on %s: %s: %s", dir, h.Host, err, out)
+	}
+
+	var cmd *exec.Cmd
+	dest := h.Host + ":" + remote
+
+	if rsync, err := exec.LookPath("rsync"); err == nil {
+		if fi.IsDir() {
+			// trailing slashes sync the directory content, files
+			// removed locally are removed from the remote copy
+			cmd = exec.Command(rsync, "--archive", "--delete", "--partial", "--", image+"/", dest+"/")
+		} else {
+			cmd = exec.Command(rsync, "--times", "--partial", "--", image, dest)
+		}
+	} else if fi.IsDir() {
+		cmd = exec.Command("scp", "-r", "-p", "-q", "--", image, dest)
+	} else {
+		cmd = exec.Command("scp", "-p", "-q", "--", image, dest)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	sylog.Debugf("Syncing %s to %s with: %s", image, dest, strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("while syncing %s to %s: %s", image, dest, err)
+	}
+	return remote, nil
+}
+
+// Command returns the command executing singularity with args on the
+// remote host.
+func (h *Host) Command(args []string) *exec.Cmd {
+	cmd := h.sshCommand(h.TTY, append([]string{h.Binary}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// sshCommand returns an ssh command running the quoted args through
+// the remote user shell.
+func (h *Host) sshCommand(tty bool, args ...string) *exec.Cmd {
+	sshArgs := []string{"-q"}
+	if tty {
+		sshArgs = append(sshArgs, "-t")
+	} else {
+		sshArgs = append(sshArgs, "-T")
+	}
+	sshArgs = append(sshArgs, "--", h.Host, shell.ArgsQuoted(args))
+
+	sylog.Debugf("Running ssh %s", strings.Join(sshArgs, " "))
+	return exec.Command("ssh", sshArgs...)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remoteexec
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		shouldErr bool
+	}{
+		{"empty host", "", true},
+		{"option injection", "-oProxyCommand=evil", true},
+		{"host", "linux-vm", false},
+		{"user and host", "user@linux-vm", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHost(tt.host)
+			if tt.shouldErr && err == nil {
+				t.Fatalf("unexpected success for host %q", tt.host)
+			} else if !tt.shouldErr && err != nil {
+				t.Fatalf("unexpected error for host %q: %s", tt.host, err)
+			}
+			if err == nil && (h.Dir != DefaultDir || h.Binary != DefaultBinary) {
+				t.Errorf("unexpected defaults: %+v", h)
+			}
+		})
+	}
+}
+
+func TestIsLocalImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remoteexec-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte("sif"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		image string
+		local bool
+	}{
+		{"library URI", "library://alpine", false},
+		{"docker URI", "docker://alpine:latest", false},
+		{"local image", image, true},
+		{"sandbox directory", dir, true},
+		{"remote path", "/scratch/images/image.sif", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if local := IsLocalImage(tt.image); local != tt.local {
+				t.Errorf("got %v for %s, expected %v", local, tt.image, tt.local)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	h, err := NewHost("user@linux-vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := h.RemotePath("/Users/me/images/alpine.sif")
+	if path.Dir(path.Dir(p)) != DefaultDir || path.Base(p) != "alpine.sif" {
+		t.Errorf("unexpected remote path: %s", p)
+	}
+	if h.RemotePath("/Users/me/images/alpine.sif") != p {
+		t.Errorf("remote path is not stable")
+	}
+	if h.RemotePath("/Users/me/other/alpine.sif") == p {
+		t.Errorf("images with the same name share the remote path %s", p)
+	}
+
+	cmd := h.Command([]string{"exec", "alpine.sif", "echo", "$HOME"})
+	expected := []string{"ssh", "-q", "-T", "--", "user@linux-vm", `"singularity" "exec" "alpine.sif" "echo" "\$HOME"`}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Errorf("got %q, expected %q", cmd.Args, expected)
+	}
+
+	h.TTY = true
+	cmd = h.Command([]string{"shell", "alpine.sif"})
+	if cmd.Args[2] != "-t" {
+		t.Errorf("pseudo terminal not requested: %q", cmd.Args)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package runhelp parses and renders the container help declared with
+// the %help and %arguments sections of a definition file.
+package runhelp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// Argument describes a runscript argument declared in %arguments.
+type Argument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+	Variadic    bool   `json:"variadic,omitempty"`
+}
+
+// Section is a markdown section of the help text.
+type Section struct {
+	Title string `json:"title"`
+	Level int    `json:"level"`
+	Body  string `json:"body"`
+}
+
+// Help holds the help of a container or of a container app.
+type Help struct {
+	App       string     `json:"app,omitempty"`
+	Text      string     `json:"text"`
+	Sections  []Section  `json:"sections"`
+	Arguments []Argument `json:"arguments"`
+}
+
+const (
+	bold      = "\x1b[1m"
+	underline = "\x1b[4m"
+	cyan      = "\x1b[36m"
+	reset     = "\x1b[0m"
+)
+
+var (
+	headingRegexp = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletRegexp  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	boldRegexp    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	codeRegexp    = regexp.MustCompile("`([^`]+)`")
+)
+
+// New returns the help built from the raw %help text and the
+// %arguments declarations.
+func New(text, arguments string) *Help {
+	return &Help{
+		Text:      text,
+		Sections:  ParseSections(text),
+		Arguments: ParseArguments(arguments),
+	}
+}
+
+// ParseArguments parses %arguments declarations, one argument per line
+// with its name followed by its description. Names enclosed in brackets
+// are optional and names ending with "..." accept multiple values:
+//
+//	input      input file
+//	[output]   output file, defaults to standard output
+//	options... extra options passed to the tool
+func ParseArguments(arguments string) []Argument {
+	args := make([]Argument, 0)
+
+	for _, line := range strings.Split(arguments, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var a Argument
+
+		a.Name = strings.Fields(line)[0]
+		a.Description = strings.TrimSpace(strings.TrimPrefix(line, a.Name))
+
+		if strings.HasPrefix(a.Name, "[") && strings.HasSuffix(a.Name, "]") {
+			a.Optional = true
+			a.Name = strings.TrimSuffix(strings.TrimPrefix(a.Name, "["), "]")
+		}
+		if strings.HasSuffix(a.Name, "...") {
+			a.Variadic = true
+			a.Name = strings.TrimSuffix(a.Name, "...")
+		}
+		if a.Name == "" {
+			continue
+		}
+		args = append(args, a)
+	}
+
+	return args
+}
+
+// ParseSections splits the help text into sections delimited by
+// markdown headings, text preceding the first heading is returned
+// as a section without title.
+func ParseSections(text string) []Section {
+	sections := make([]Section, 0)
+	text = dedent(text)
+
+	var cur *Section
+	var body []string
+	fenced := false
+
+	flush := func() {
+		b := strings.Trim(strings.Join(body, "\n"), "\n")
+		if cur != nil || b != "" {
+			if cur == nil {
+				cur = &Section{}
+			}
+			cur.Body = b
+			sections = append(sections, *cur)
+		}
+		body = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+		if m := headingRegexp.FindStringSubmatch(line); m != nil && !fenced {
+			flush()
+			cur = &Section{Title: m[2], Level: len(m[1])}
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return sections
+}
+
+// Write writes the raw help text to w followed by the declared arguments.
+func (h *Help) Write(w io.Writer) error {
+	return h.render(w, false)
+}
+
+// Render writes the help text rendered for a terminal to w.
+func (h *Help) Render(w io.Writer) error {
+	return h.render(w, true)
+}
+
+func (h *Help) render(w io.Writer, color bool) error {
+	bw := bufio.NewWriter(w)
+
+	text := strings.TrimRight(h.Text, "\n")
+	if text != "" {
+		if color {
+			renderMarkdown(bw, dedent(text))
+		} else {
+			fmt.Fprintln(bw, text)
+		}
+	}
+
+	if len(h.Arguments) > 0 && !h.hasSection("arguments") {
+		if text != "" {
+			fmt.Fprintln(bw)
+		}
+		if color {
+			fmt.Fprintln(bw, bold+underline+"Arguments"+reset)
+		} else {
+			fmt.Fprintln(bw, "Arguments:")
+		}
+
+		tw := tabwriter.NewWriter(bw, 0, 4, 2, ' ', 0)
+		for _, a := range h.Arguments {
+			fmt.Fprintf(tw, "    %s\t%s\n", a.usage(), a.Description)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func (h *Help) hasSection(title string) bool {
+	for _, s := range h.Sections {
+		if strings.EqualFold(s.Title, title) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Argument) usage() string {
+	name := a.Name
+	if a.Variadic {
+		name += "..."
+	}
+	if a.Optional {
+		name = "[" + name + "]"
+	}
+	return name
+}
+
+// renderMarkdown renders the subset of markdown commonly used in help
+// texts: headings, bullet lists, code blocks, bold and inline code.
+func renderMarkdown(w io.Writer, text string) {
+	fenced := false
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			fmt.Fprintln(w, "    "+cyan+line+reset)
+			continue
+		}
+		if m := headingRegexp.FindStringSubmatch(line); m != nil {
+			if len(m[1]) == 1 {
+				fmt.Fprintln(w, bold+underline+strings.ToUpper(m[2])+reset)
+			} else {
+				fmt.Fprintln(w, bold+m[2]+reset)
+			}
+			continue
+		}
+		if m := bulletRegexp.FindStringSubmatch(line); m != nil {
+			line = m[1] + "  • " + m[2]
+		}
+		fmt.Fprintln(w, renderInline(line))
+	}
+}
+
+// dedent removes the indentation common to all lines of text, as
+// definition file sections are usually indented.
+func dedent(text string) string {
+	lines := strings.Split(text, "\n")
+
+	prefix := ""
+	first := true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			prefix = indent
+			first = false
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if prefix == "" {
+		return text
+	}
+
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, prefix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderInline(line string) string {
+	line = boldRegexp.ReplaceAllString(line, bold+"$1"+reset)
+	return codeRegexp.ReplaceAllString(line, cyan+"$1"+reset)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package runhelp
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const helpText = `Preamble text.
+
+# Usage
+Run the tool:
+
+` + "```" + `
+# not a heading
+singularity run tool.sif input
+` + "```" + `
+
+## Options
+- **--fast** go faster
+`
+
+func TestParseSections(t *testing.T) {
+	sections := ParseSections(helpText)
+
+	expected := []Section{
+		{Title: "", Level: 0, Body: "Preamble text."},
+		{Title: "Usage", Level: 1, Body: "Run the tool:\n\n```\n# not a heading\nsingularity run tool.sif input\n```"},
+		{Title: "Options", Level: 2, Body: "- **--fast** go faster"},
+	}
+	if !reflect.DeepEqual(sections, expected) {
+		t.Errorf("got %+v, expected %+v", sections, expected)
+	}
+
+	// definition file sections are usually indented
+	indented := "    " + strings.Replace(helpText, "\n", "\n    ", -1)
+	if sections := ParseSections(indented); !reflect.DeepEqual(sections, expected) {
+		t.Errorf("got %+v, expected %+v", sections, expected)
+	}
+}
+
+func TestParseArguments(t *testing.T) {
+	args := ParseArguments(`
+# comment
+input	input file
+[output]   output file
+options... extra options
+flag
+`)
+
+	expected := []Argument{
+		{Name: "input", Description: "input file"},
+		{Name: "output", Description: "output file", Optional: true},
+		{Name: "options", Description: "extra options", Variadic: true},
+		{Name: "flag"},
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("got %+v, expected %+v", args, expected)
+	}
+}
+
+func TestRender(t *testing.T) {
+	h := New(helpText, "input input file\n[output] output file")
+
+	var buf bytes.Buffer
+	if err := h.Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, helpText) {
+		t.Errorf("raw help text not found in:\n%s", out)
+	}
+	if !strings.Contains(out, "Arguments:\n    input     input file\n    [output]  output file\n") {
+		t.Errorf("arguments not found in:\n%s", out)
+	}
+
+	buf.Reset()
+	if err := h.Render(&buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out = buf.String()
+	for _, s := range []string{
+		bold + underline + "USAGE" + reset,
+		"    " + cyan + "# not a heading" + reset,
+		"  • " + bold + "--fast" + reset + " go faster",
+		bold + underline + "Arguments" + reset,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q not found in:\n%s", s, out)
+		}
+	}
+}
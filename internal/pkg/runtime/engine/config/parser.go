@@ -15,6 +15,8 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 // Parser parses configuration found in the file with the specified path.
@@ -27,11 +29,11 @@ func Parser(filepath string, f interface{}) error {
 	if filepath != "" {
 		c, err = os.Open(filepath)
 		if err != nil {
-			return err
+			return errcode.Wrap(errcode.Configuration, err, "")
 		}
 		b, err = ioutil.ReadAll(c)
 		if err != nil {
-			return err
+			return errcode.Wrap(errcode.Configuration, err, "")
 		}
 
 		c.Close()
@@ -76,7 +78,7 @@ func Parser(filepath string, f interface{}) error {
 					}
 				}
 				if !found {
-					return fmt.Errorf("value authorized for directive '%s' are %s", dir, authorized)
+					return errcode.New(errcode.Configuration, "value authorized for directive '%s' are %s", dir, authorized)
 				}
 			} else {
 				if def == "yes" {
@@ -95,7 +97,7 @@ func Parser(filepath string, f interface{}) error {
 				n, err = strconv.ParseInt(def, 0, 64)
 			}
 			if err != nil {
-				return err
+				return errcode.Wrap(errcode.Configuration, err, "bad value for directive '%s'", dir)
 			}
 			valueField.SetInt(n)
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -108,7 +110,7 @@ func Parser(filepath string, f interface{}) error {
 				n, err = strconv.ParseUint(def, 0, 64)
 			}
 			if err != nil {
-				return err
+				return errcode.Wrap(errcode.Configuration, err, "bad value for directive '%s'", dir)
 			}
 			valueField.SetUint(n)
 		case reflect.String:
@@ -129,7 +131,7 @@ func Parser(filepath string, f interface{}) error {
 					}
 				}
 				if !found {
-					return fmt.Errorf("value authorized for directive '%s' are %s", dir, authorized)
+					return errcode.New(errcode.Configuration, "value authorized for directive '%s' are %s", dir, authorized)
 				}
 			} else {
 				valueField.SetString(def)
@@ -10,6 +10,8 @@ import (
 	"os"
 	"reflect"
 	"testing"
+
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 type testConfig struct {
@@ -41,6 +43,8 @@ func TestParser(t *testing.T) {
 
 	if err := Parser("test_samples/no.conf", &def); err == nil {
 		t.Errorf("unexpected success while opening non existent configuration file")
+	} else if code := errcode.CodeOf(err); code != errcode.Configuration {
+		t.Errorf("got error code %s, expected %s", code, errcode.Configuration)
 	}
 
 	if err := Parser("", &def); err != nil {
@@ -134,6 +138,8 @@ func TestParser(t *testing.T) {
 
 		if err := Parser(path, &valid); err == nil {
 			t.Errorf("unexpected success while parsing %s", s)
+		} else if code := errcode.CodeOf(err); code != errcode.Configuration {
+			t.Errorf("got error code %s while parsing %s, expected %s", code, s, errcode.Configuration)
 		}
 
 		os.Remove(path)
@@ -14,4 +14,10 @@ type EngineConfig struct {
 	Args []string `json:"args"`
 	Envs []string `json:"envs"`
 	Home string   `json:"home"`
+	// IgnoreSubuid maps only the user to root, without subordinate
+	// ID ranges, and emulates ownership and credentials changes
+	IgnoreSubuid bool `json:"ignoreSubuid"`
+	// AptConfig is the path of the APT configuration file preventing
+	// APT from dropping privileges to its sandbox user with IgnoreSubuid
+	AptConfig string `json:"aptConfig,omitempty"`
 }
@@ -7,8 +7,10 @@ package fakeroot
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 	"syscall"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
@@ -63,6 +65,8 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		if !fileConfig.AllowSetuid {
 			return fmt.Errorf("fakeroot requires to set 'allow setuid = yes' in %s", configurationFile)
 		}
+	} else if e.EngineConfig.IgnoreSubuid {
+		sylog.Verbosef("Fakeroot requested with unprivileged workflow, mapping only the current user")
 	} else {
 		sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
 		sylog.Debugf("Search for newuidmap binary")
@@ -75,6 +79,17 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		}
 	}
 
+	if e.EngineConfig.IgnoreSubuid {
+		if !seccomp.Enabled() {
+			return fmt.Errorf("fakeroot without subordinate IDs requires seccomp support")
+		}
+		path, err := aptConfig(e.EngineConfig.Envs)
+		if err != nil {
+			return fmt.Errorf("while creating APT configuration: %s", err)
+		}
+		e.EngineConfig.AptConfig = path
+	}
+
 	g.AddOrReplaceLinuxNamespace(specs.UserNamespace, "")
 	g.AddOrReplaceLinuxNamespace(specs.MountNamespace, "")
 	g.AddOrReplaceLinuxNamespace(string(specs.PIDNamespace), "")
@@ -83,23 +98,33 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	gid := uint32(os.Getgid())
 
 	g.AddLinuxUIDMapping(uid, 0, 1)
-	idRange, err := fakerootutil.GetIDRange(fakerootutil.SubUIDFile, uid)
-	if err != nil {
-		return fmt.Errorf("could not use fakeroot: %s", err)
-	}
-	g.AddLinuxUIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
-	starterConfig.AddUIDMappings(g.Config.Linux.UIDMappings)
-
 	g.AddLinuxGIDMapping(gid, 0, 1)
-	idRange, err = fakerootutil.GetIDRange(fakerootutil.SubGIDFile, uid)
-	if err != nil {
-		return fmt.Errorf("could not use fakeroot: %s", err)
+
+	if e.EngineConfig.IgnoreSubuid {
+		// without setuid, the user namespace is created and its mappings
+		// written by the master process, setgroups must be denied for an
+		// unprivileged user to write the GID mapping
+		starterConfig.SetHybridWorkflow(starterConfig.GetIsSUID())
+		starterConfig.SetAllowSetgroups(starterConfig.GetIsSUID())
+	} else {
+		idRange, err := fakerootutil.GetIDRange(fakerootutil.SubUIDFile, uid)
+		if err != nil {
+			return fmt.Errorf("could not use fakeroot: %s, --ignore-subuid allows to use it without subordinate IDs", err)
+		}
+		g.AddLinuxUIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
+
+		idRange, err = fakerootutil.GetIDRange(fakerootutil.SubGIDFile, uid)
+		if err != nil {
+			return fmt.Errorf("could not use fakeroot: %s, --ignore-subuid allows to use it without subordinate IDs", err)
+		}
+		g.AddLinuxGIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
+
+		starterConfig.SetHybridWorkflow(true)
+		starterConfig.SetAllowSetgroups(true)
 	}
-	g.AddLinuxGIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
-	starterConfig.AddGIDMappings(g.Config.Linux.GIDMappings)
 
-	starterConfig.SetHybridWorkflow(true)
-	starterConfig.SetAllowSetgroups(true)
+	starterConfig.AddUIDMappings(g.Config.Linux.UIDMappings)
+	starterConfig.AddGIDMappings(g.Config.Linux.GIDMappings)
 
 	starterConfig.SetTargetUID(0)
 	starterConfig.SetTargetGID([]int{0})
@@ -140,6 +165,65 @@ func fakerootSeccompProfile() *specs.LinuxSeccomp {
 	}
 }
 
+// aptSandboxConfig prevents APT from switching to its sandbox user,
+// credentials changes are faked and APT would fail as it checks that
+// it's not running as root anymore.
+const aptSandboxConfig = "APT::Sandbox::User \"root\";\n"
+
+// aptConfig creates the APT configuration file passed with APT_CONFIG
+// to build processes unless already set in env. The file is created in
+// /tmp which is shared with the build container.
+func aptConfig(env []string) (string, error) {
+	for _, e := range env {
+		if strings.HasPrefix(e, "APT_CONFIG=") {
+			return "", nil
+		}
+	}
+
+	f, err := ioutil.TempFile("/tmp", "singularity-apt-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0644); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if _, err := f.WriteString(aptSandboxConfig); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// loadFakerootNotify loads the seccomp filter reporting ownership,
+// credentials and device nodes related syscalls and sends the notification
+// listener to the master process which emulates them, there is no other
+// user or group than root in the user namespace.
+func loadFakerootNotify(masterConn net.Conn) error {
+	fd, err := seccomp.LoadNotifyFilter(seccomp.FakerootProfile(), false)
+	if err != nil {
+		return fmt.Errorf("fakeroot without subordinate IDs requires seccomp notification support: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	conn, ok := masterConn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("master connection is not a unix socket")
+	}
+	if _, _, err := conn.WriteMsgUnix([]byte{'n'}, syscall.UnixRights(fd), nil); err != nil {
+		return fmt.Errorf("failed to send seccomp notification listener to master: %s", err)
+	}
+	return nil
+}
+
+// NotifyHandlers returns the handlers used by the master process to
+// emulate the syscalls notified by the fakeroot process.
+func (e *EngineOperations) NotifyHandlers() map[int32]seccomp.NotifyHandler {
+	return seccomp.FakerootNotifyHandlers()
+}
+
 // StartProcess will execute command in the fakeroot context
 func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	const (
@@ -185,7 +269,14 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		return fmt.Errorf("no command to execute provided")
 	}
 	env := e.EngineConfig.Envs
-	if seccomp.Enabled() {
+	if e.EngineConfig.AptConfig != "" {
+		env = append(env, "APT_CONFIG="+e.EngineConfig.AptConfig)
+	}
+	if e.EngineConfig.IgnoreSubuid {
+		if err := loadFakerootNotify(masterConn); err != nil {
+			return err
+		}
+	} else if seccomp.Enabled() {
 		if err := seccomp.LoadSeccompConfig(fakerootSeccompProfile(), false, 0); err != nil {
 			sylog.Warningf("could not apply seccomp filter, some bootstrap may not work correctly")
 		}
@@ -215,8 +306,12 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 	}
 }
 
-// CleanupContainer actually does nothing for the fakeroot engine
+// CleanupContainer removes the APT configuration file created with
+// fakeroot without subordinate IDs.
 func (e *EngineOperations) CleanupContainer(fatal error, status syscall.WaitStatus) error {
+	if e.EngineConfig.AptConfig != "" {
+		os.Remove(e.EngineConfig.AptConfig)
+	}
 	return nil
 }
 
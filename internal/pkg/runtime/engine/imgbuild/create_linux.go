@@ -16,6 +16,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/sylabs/singularity/internal/pkg/build/buildcontext"
 	"github.com/sylabs/singularity/internal/pkg/build/files"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	imgbuildConfig "github.com/sylabs/singularity/internal/pkg/runtime/engine/imgbuild/config"
@@ -200,6 +201,10 @@ func (e *EngineOperations) copyFiles() error {
 		if transfer.Dst == "" {
 			transfer.Dst = transfer.Src
 		}
+		// sources were uploaded by a remote build client
+		if dir := e.EngineConfig.Opts.ContextDir; dir != "" {
+			transfer.Src = buildcontext.Resolve(dir, transfer.Src)
+		}
 		// copy each file into bundle rootfs
 		transfer.Dst = files.AddPrefix(e.EngineConfig.Rootfs(), transfer.Dst)
 		sylog.Infof("Copying %v to %v", transfer.Src, transfer.Dst)
@@ -211,9 +216,9 @@ func (e *EngineOperations) copyFiles() error {
 	return nil
 }
 
-// runScriptSection executes the provided script by piping the
-// script to /bin/sh command.
-func (e *EngineOperations) runScriptSection(name string, s types.Script, setEnv bool) {
+// scriptCommand returns the command executing the provided script
+// by piping the script to /bin/sh command.
+func (e *EngineOperations) scriptCommand(s types.Script, setEnv bool) *exec.Cmd {
 	args := []string{"-ex"}
 	// trim potential trailing comment from args and append to args list
 	args = append(args, strings.Fields(strings.Split(s.Args, "#")[0])...)
@@ -223,8 +228,6 @@ func (e *EngineOperations) runScriptSection(name string, s types.Script, setEnv
 		envs = e.EngineConfig.OciConfig.Process.Env
 	}
 
-	sylog.Infof("Running %s scriptlet\n", name)
-
 	var b bytes.Buffer
 	b.WriteString(s.Script)
 
@@ -234,7 +237,15 @@ func (e *EngineOperations) runScriptSection(name string, s types.Script, setEnv
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = &b
 
-	if err := cmd.Run(); err != nil {
+	return cmd
+}
+
+// runScriptSection executes the provided script by piping the
+// script to /bin/sh command.
+func (e *EngineOperations) runScriptSection(name string, s types.Script, setEnv bool) {
+	sylog.Infof("Running %s scriptlet\n", name)
+
+	if err := e.scriptCommand(s, setEnv).Run(); err != nil {
 		sylog.Fatalf("failed to execute %%%s proc: %v\n", name, err)
 	}
 }
@@ -11,9 +11,12 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/pkg/build/types"
 )
 
 // StartProcess runs the %post script
@@ -28,9 +31,11 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	}
 
 	if e.EngineConfig.RunSection("test") {
-		if !e.EngineConfig.Opts.NoTest && e.EngineConfig.Recipe.BuildData.Test.Script != "" {
+		// isolated tests are run with the test action once the
+		// image metadata are inserted
+		if !e.EngineConfig.Opts.NoTest && !e.EngineConfig.Opts.TestIsolated && e.EngineConfig.Recipe.BuildData.Test.Script != "" {
 			// Run %test script
-			e.runScriptSection("test", e.EngineConfig.Recipe.BuildData.Test, false)
+			e.runTestSection(e.EngineConfig.Recipe.BuildData.Test)
 		}
 	}
 
@@ -38,6 +43,45 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	return nil
 }
 
+// runTestSection executes the %test script and kills it when the test
+// timeout expires.
+func (e *EngineOperations) runTestSection(s types.Script) {
+	sylog.Infof("Running test scriptlet\n")
+
+	cmd := e.scriptCommand(s, false)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	timeout := e.EngineConfig.Opts.TestTimeout
+	if timeout > 0 {
+		// put the test processes in their own group to kill them all
+		cmd.SysProcAttr.Setpgid = true
+	}
+
+	if err := cmd.Start(); err != nil {
+		sylog.Fatalf("failed to execute %%test proc: %v\n", err)
+	}
+
+	timedOut := make(chan struct{})
+	if timeout > 0 {
+		timer := time.AfterFunc(time.Duration(timeout)*time.Second, func() {
+			close(timedOut)
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+
+	err := cmd.Wait()
+
+	select {
+	case <-timedOut:
+		sylog.Fatalf("%%test proc didn't complete within %d seconds\n", timeout)
+	default:
+	}
+	if err != nil {
+		sylog.Fatalf("failed to execute %%test proc: %v\n", err)
+	}
+}
+
 // MonitorContainer is responsible for waiting on container process
 func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (syscall.WaitStatus, error) {
 	var status syscall.WaitStatus
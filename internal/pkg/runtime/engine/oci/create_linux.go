@@ -490,6 +490,8 @@ func (c *container) addCgroups(pid int, system *mount.System) error {
 		return fmt.Errorf("failed to apply cgroups resources restriction: %s", err)
 	}
 
+	c.engine.EngineConfig.Cgroups = manager
+
 	if c.cgroupIndex >= 0 {
 		m := c.engine.EngineConfig.OciConfig.Config.Mounts[c.cgroupIndex]
 		c.engine.EngineConfig.OciConfig.Config.Mounts = append(
@@ -511,6 +513,20 @@ func (c *container) addCgroups(pid int, system *mount.System) error {
 			flags &^= uintptr(syscall.MS_RDONLY)
 		}
 
+		// the unified hierarchy is a single tree, the container cgroup
+		// is bound at the mount destination
+		if cgroups.IsUnified() {
+			flags |= uintptr(syscall.MS_BIND)
+			source := filepath.Join(cgroupRootPath, cgroupsPath)
+			if err := system.Points.AddBind(mount.OtherTag, source, m.Destination, flags); err != nil {
+				return err
+			}
+			if readOnly {
+				return system.Points.AddRemount(mount.FinalTag, m.Destination, flags|syscall.MS_RDONLY)
+			}
+			return nil
+		}
+
 		hasMode := false
 		for _, o := range opt {
 			if strings.HasPrefix(o, "mode=") {
@@ -590,8 +606,6 @@ func (c *container) addCgroups(pid int, system *mount.System) error {
 		}
 	}
 
-	c.engine.EngineConfig.Cgroups = manager
-
 	return nil
 }
 
@@ -0,0 +1,148 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	criuDumpLog    = "dump.log"
+	criuRestoreLog = "restore.log"
+	criuPidFile    = "restore.pid"
+)
+
+// criuArgs are the options shared by dump and restore, external
+// mounts like bind mounts from the host are mapped automatically
+// and must be present on the node where the instance is restored.
+var criuArgs = []string{
+	"--file-locks",
+	"--tcp-established",
+	"--ext-unix-sk",
+	"--manage-cgroups",
+	"--ext-mount-map", "auto",
+	"--enable-external-sharing",
+	"--enable-external-masters",
+}
+
+// runCriu executes criu with the images directory dir, the criu log
+// file is reported on failure.
+func runCriu(action, dir, log string, args ...string) error {
+	criu, err := exec.LookPath("criu")
+	if err != nil {
+		return fmt.Errorf("criu is required to %s instances: %s", action, err)
+	}
+
+	a := append([]string{action, "--images-dir", dir, "--log-file", log}, criuArgs...)
+	cmd := exec.Command(criu, append(a, args...)...)
+
+	sylog.Debugf("Running %s", strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("criu %s failed: %s: %s, see %s for details", action, strings.TrimSpace(string(out)), err, filepath.Join(dir, log))
+	}
+	return nil
+}
+
+// Checkpoint dumps the process tree, namespaces and mount state of the
+// container process pid into dir, the process tree is killed once dumped
+// unless leaveRunning is true.
+func (e *EngineOperations) Checkpoint(pid int, dir string, leaveRunning bool) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory %s: %s", dir, err)
+	}
+
+	args := []string{"--tree", strconv.Itoa(pid)}
+	if leaveRunning {
+		args = append(args, "--leave-running")
+	}
+
+	sylog.Debugf("Checkpointing process %d to %s", pid, dir)
+	return runCriu("dump", dir, criuDumpLog, args...)
+}
+
+// Restore restores the process tree checkpointed in dir on top of the
+// root filesystem root and returns the PID of the restored process, the
+// restored process tree is a child of the calling process.
+func (e *EngineOperations) Restore(dir string, root string) (int, error) {
+	pidFile := filepath.Join(dir, criuPidFile)
+	os.Remove(pidFile)
+
+	args := []string{
+		"--restore-sibling",
+		"--restore-detached",
+		"--pidfile", pidFile,
+		"--root", root,
+	}
+
+	sylog.Debugf("Restoring checkpoint %s", dir)
+	if err := runCriu("restore", dir, criuRestoreLog, args...); err != nil {
+		return 0, err
+	}
+
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read restored process PID: %s", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("bad restored process PID: %s", err)
+	}
+	return pid, nil
+}
+
+// restoreInstance restores the instance process tree in place of the
+// placeholder container process pid, the placeholder is killed once the
+// restored process is recorded for MonitorContainer.
+func (e *EngineOperations) restoreInstance(pid int) (int, error) {
+	root := fmt.Sprintf("/proc/%d/root", pid)
+
+	rpid, err := e.Restore(e.EngineConfig.GetRestoreDir(), root)
+	if err != nil {
+		return 0, err
+	}
+	atomic.StoreInt32(&e.restoredPid, int32(rpid))
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		return 0, fmt.Errorf("failed to kill container placeholder process: %s", err)
+	}
+	return rpid, nil
+}
+
+// checkpointInstance processes the checkpoint request of the instance
+// running the container process pid.
+func (e *EngineOperations) checkpointInstance(pid int) {
+	file, err := instance.Get(e.CommonConfig.ContainerID, instance.SingSubDir)
+	if err != nil {
+		sylog.Warningf("Checkpoint request ignored: %s", err)
+		return
+	}
+	req, err := file.ReadCheckpointRequest()
+	if err != nil {
+		sylog.Warningf("Checkpoint request ignored: %s", err)
+		return
+	}
+	file.DeleteCheckpointRequest()
+
+	if err := e.Checkpoint(pid, req.Dir, req.LeaveRunning); err != nil {
+		req.Error = err.Error()
+	}
+	req.Done = true
+
+	if err := instance.WriteCheckpointResult(req); err != nil {
+		sylog.Warningf("Failed to report checkpoint status: %s", err)
+	}
+}
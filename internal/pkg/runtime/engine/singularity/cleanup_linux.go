@@ -7,6 +7,7 @@ package singularity
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,6 +18,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/priv"
 	"github.com/sylabs/singularity/pkg/util/crypt"
+	"golang.org/x/sys/unix"
 )
 
 /*
@@ -54,12 +56,43 @@ func (e *EngineOperations) CleanupContainer(fatal error, status syscall.WaitStat
 		}
 	}
 
+	if len(e.EngineConfig.FuseConnections) > 0 {
+		if err := cleanupFuse(e.EngineConfig.FuseConnections, e.EngineConfig.FusePids); err != nil {
+			sylog.Errorf("%s", err)
+		}
+	}
+
+	if len(e.EngineConfig.ImageDriverMounts) > 0 {
+		if err := cleanupImageDriver(e.EngineConfig.File.ImageDriver, e.EngineConfig.ImageDriverMounts); err != nil {
+			sylog.Errorf("%s", err)
+		}
+	}
+
+	if e.EngineConfig.SessionDir != "" {
+		if err := cleanupSessionDir(e.EngineConfig.SessionDir); err != nil {
+			sylog.Errorf("failed to remove session directory %s: %s", e.EngineConfig.SessionDir, err)
+		}
+	}
+
 	if e.EngineConfig.GetInstance() {
+		// stop the healthcheck first to not write the instance file back
+		restart := e.healthcheck != nil && e.healthcheck.stop()
+
+		if e.logger != nil {
+			e.logger.Close()
+		}
+
 		file, err := instance.Get(e.CommonConfig.ContainerID, instance.SingSubDir)
 		if err != nil {
 			return err
 		}
-		return file.Delete()
+		if err := file.Delete(); err != nil {
+			return err
+		}
+		if restart {
+			return e.restartInstance()
+		}
+		return nil
 	}
 
 	if e.EngineConfig.CryptDev != "" {
@@ -103,3 +136,59 @@ func cleanupCrypt(path string) error {
 
 	return nil
 }
+
+// cleanupFuse aborts the FUSE connections of the filesystems mounted by
+// FUSE helpers and terminates the helpers still running, a helper keeps
+// the container mount namespace alive until it exits.
+func cleanupFuse(connections []uint32, pids []int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if os.Geteuid() != 0 {
+		uid := os.Getuid()
+		if err := syscall.Setresuid(uid, 0, uid); err == nil {
+			defer syscall.Setresuid(uid, uid, 0)
+		}
+	}
+
+	for _, conn := range connections {
+		abort := fmt.Sprintf("/sys/fs/fuse/connections/%d/abort", conn)
+		if err := ioutil.WriteFile(abort, []byte("1"), 0); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("while aborting FUSE connection %d: %s", conn, err)
+		}
+	}
+
+	for _, pid := range pids {
+		// helpers are session leaders, don't signal a reused PID
+		if sid, err := unix.Getsid(pid); err != nil || sid != pid {
+			continue
+		}
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("while terminating FUSE helper %d: %s", pid, err)
+		}
+	}
+
+	return nil
+}
+
+// cleanupSessionDir removes the disk directory backing the session
+// directory, the overlay work directory content is owned by root so
+// privileges are elevated if the removal fails with a setuid workflow.
+func cleanupSessionDir(path string) error {
+	err := os.RemoveAll(path)
+	if err == nil || os.Geteuid() == 0 {
+		return err
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	uid := os.Getuid()
+	if syscall.Setresuid(uid, 0, uid) != nil {
+		// unprivileged workflow, report the removal error
+		return err
+	}
+	defer syscall.Setresuid(uid, uid, 0)
+
+	return os.RemoveAll(path)
+}
@@ -6,9 +6,11 @@
 package singularity
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,7 +19,10 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/internal/pkg/mounthook"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc/client"
+	"github.com/sylabs/singularity/internal/pkg/security/selinux"
+	"github.com/sylabs/singularity/internal/pkg/slurm"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
@@ -25,17 +30,22 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/util/fs/layout/layer/overlay"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/layout/layer/underlay"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
-	fsoverlay "github.com/sylabs/singularity/internal/pkg/util/fs/overlay"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
 	"github.com/sylabs/singularity/internal/pkg/util/priv"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/network"
 	singularity "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/bind"
+	"github.com/sylabs/singularity/pkg/util/crypt"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
+	"github.com/sylabs/singularity/pkg/util/idmap"
 	"github.com/sylabs/singularity/pkg/util/loop"
+	"github.com/sylabs/singularity/pkg/util/mpi"
 	"github.com/sylabs/singularity/pkg/util/namespaces"
 	"github.com/sylabs/singularity/pkg/util/nvidia"
+	"github.com/sylabs/singularity/pkg/util/rocm"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -45,11 +55,28 @@ var defaultCNIConfPath = filepath.Join(buildcfg.SYSCONFDIR, "singularity", "netw
 // defaultCNIPluginPath is the default directory to CNI plugins executables
 var defaultCNIPluginPath = filepath.Join(buildcfg.LIBEXECDIR, "singularity", "cni")
 
+const (
+	// sessionBlockSize is the space accounted for a session directory entry
+	sessionBlockSize = 4096
+	// sessionStagedFileSize is the space reserved for a file staged in
+	// the session directory once the container image is mounted
+	sessionStagedFileSize = 256 * 1024
+	// sessionUnderlaySize is the space reserved for the image root
+	// directory entries duplicated by underlay
+	sessionUnderlaySize = 1024 * sessionBlockSize
+)
+
 type container struct {
 	engine           *EngineOperations
 	rpcOps           *client.RPC
 	session          *layout.Session
 	sessionLayerType string
+	overlayDriver    overlayDriver
+	imageDriver      image.Driver
+	mountHooks       bool
+	idmapBinds       map[string]bool
+	idmapUserNS      *idmap.UserNamespace
+	idmapStaged      int
 	sessionFsType    string
 	sessionSize      int
 	userNS           bool
@@ -91,15 +118,32 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 			case specs.PIDNamespace:
 				c.pidNS = true
 			case specs.UTSNamespace:
-				c.utsNS = true
+				// a joined namespace keeps its hostname and network
+				c.utsNS = namespace.Path == ""
 			case specs.NetworkNamespace:
-				c.netNS = true
+				c.netNS = namespace.Path == ""
 			case specs.IPCNamespace:
 				c.ipcNS = true
 			}
 		}
 	}
 
+	if name := engine.EngineConfig.File.ImageDriver; name != "" {
+		if c.imageDriver, err = loadImageDriver(name); err != nil {
+			return err
+		}
+	}
+
+	c.mountHooks = loadMountHooks(engine.EngineConfig.File.PluginMountHooks)
+
+	// idmapped mounts may be attached in the master mount namespace
+	// and propagate to the container mount namespace only if it's
+	// a slave mount namespace
+	if c.userNS && engine.EngineConfig.File.MountSlave && idmap.Supported() {
+		c.idmapBinds = make(map[string]bool)
+		defer c.closeIdmapUserNS()
+	}
+
 	if os.Geteuid() != 0 {
 		c.sessionSize = int(engine.EngineConfig.File.SessiondirMaxSize)
 	} else if engine.EngineConfig.GetAllowSUID() && !c.userNS {
@@ -124,6 +168,9 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 	if err := system.RunAfterTag(mount.SharedTag, c.addIdentityMount); err != nil {
 		return err
 	}
+	if err := system.RunAfterTag(mount.SharedTag, c.addHostsMount); err != nil {
+		return err
+	}
 	// this call must occur just after all container layers are mounted
 	// to prevent user binds to screw up session final directory and
 	// consequently chroot
@@ -133,10 +180,18 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 	if err := system.RunAfterTag(mount.RootfsTag, c.addActionsMount); err != nil {
 		return err
 	}
+	if c.engine.EngineConfig.GetMPIABI() != "" {
+		if err := system.RunAfterTag(mount.RootfsTag, c.checkMPIABI); err != nil {
+			return err
+		}
+	}
 
 	if err := c.addRootfsMount(system); err != nil {
 		return err
 	}
+	if err := c.addRootfsInRAM(system); err != nil {
+		return err
+	}
 	if err := c.addKernelMount(system); err != nil {
 		return err
 	}
@@ -155,6 +210,9 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 	if err := c.addUserbindsMount(system); err != nil {
 		return err
 	}
+	if err := c.addMountsMount(system); err != nil {
+		return err
+	}
 	if err := c.addTmpMount(system); err != nil {
 		return err
 	}
@@ -182,11 +240,23 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 		return err
 	}
 
+	if err := c.runMountHooks(system, mounthook.PreMount, pid); err != nil {
+		return err
+	}
+
+	if err := c.resizeSession(system); err != nil {
+		return err
+	}
+
 	sylog.Debugf("Mount all")
 	if err := system.MountAll(); err != nil {
 		return err
 	}
 
+	if err := c.runMountHooks(system, mounthook.PostMount, pid); err != nil {
+		return err
+	}
+
 	// chroot from RPC server current working directory since
 	// it's already in final directory after chdirFinal call
 	sylog.Debugf("Chroot into %s\n", c.session.FinalPath())
@@ -209,6 +279,16 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 		path := engine.EngineConfig.GetCgroupsPath()
 		if path != "" {
 			cgroupPath := filepath.Join("/singularity", strconv.Itoa(pid))
+			// keep container processes accounted to the Slurm job,
+			// Slurm enforces the job memory limit with cgroups v1
+			controller := "memory"
+			if cgroups.IsUnified() {
+				controller = ""
+			}
+			if job := slurm.SelfJobCgroup(controller); job != "" {
+				sylog.Debugf("Nesting container cgroup under Slurm job cgroup %s", job)
+				cgroupPath = filepath.Join(job, cgroupPath)
+			}
 			manager := &cgroups.Manager{Pid: pid, Path: cgroupPath}
 			if err := manager.ApplyFromFile(path); err != nil {
 				return fmt.Errorf("failed to apply cgroups resources restriction: %s", err)
@@ -253,43 +333,13 @@ func (c *container) setupSIFOverlay(img *image.Image, writable bool) error {
 	return nil
 }
 
-// checkOverlay will test if overlay is supported/allowed.
-func (c *container) checkOverlay() bool {
-	// NEED FIX: on ubuntu until 4.15 kernel it was possible to mount overlay
-	// with the current workflow, since 4.18 we get an operation not permitted
-	if c.userNS {
-		return false
-	}
-
-	// this mount always returns an error
-	if err := c.rpcOps.Mount("none", "/", "overlay", syscall.MS_SILENT, ""); err != syscall.EINVAL {
-		// if an invalid argument error is returned, overlay is supported and is allowed
-		sylog.Debugf("Overlay seems not supported and/or not allowed by kernel")
-		return false
-	}
-
-	// previous mount forced overlay module to be loaded, check if we find
-	// it in /proc/filesystems
-	if has, _ := proc.HasFilesystem("overlay"); has {
-		sylog.Debugf("Overlay seems supported and allowed by kernel")
-		switch c.engine.EngineConfig.File.EnableOverlay {
-		case "yes", "try":
-			return true
-		default:
-			sylog.Debugf("Could not use overlay, disabled by configuration")
-		}
-	}
-
-	return false
-}
-
 // setupSessionLayout will create the session layout according to the capabilities of Singularity
-// on the system. It will first attempt to use "overlay", followed by "underlay", and if neither
+// on the system. It will first attempt to use "overlay" with the kernel overlay filesystem or
+// fuse-overlayfs when running with user namespace, followed by "underlay", and if neither
 // are available it will not use either. If neither are used, we will not be able to bind mount
 // to non-existent paths within the container
 func (c *container) setupSessionLayout(system *mount.System) error {
 	writableTmpfs := c.engine.EngineConfig.GetWritableTmpfs()
-	overlayEnabled := c.checkOverlay()
 
 	sessionPath, err := filepath.EvalSymlinks(buildcfg.SESSIONDIR)
 	if err != nil {
@@ -313,41 +363,21 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 		return c.setupDefaultLayout(system, sessionPath)
 	}
 
-	if overlayEnabled {
-		skipOverlay := false
-
-		// before using overlay we check if the sandbox image is
-		// compatible as an overlay lower directory and skip using
-		// overlay to fallback to underlay if not filesystem is not
-		// compatible
-		rootfs := c.engine.EngineConfig.GetImage()
-		img, err := c.loadImage(rootfs, true)
-		if err != nil {
-			return err
-		}
-
-		if img.Type == image.SANDBOX {
-			if err := fsoverlay.CheckLower(img.Path); fsoverlay.IsIncompatible(err) {
-				// a warning message would be better but on some systems it
-				// could annoy users, make it verbose instead
-				sylog.Verbosef("Fallback to underlay: %s", err)
-				skipOverlay = true
-			} else if err != nil {
-				return fmt.Errorf("while checking image compatibility with overlay: %s", err)
-			}
-		}
+	c.overlayDriver, err = c.probeOverlayDriver(imgObject)
+	if err != nil {
+		return err
+	}
 
-		if !skipOverlay {
-			sylog.Debugf("Attempting to use overlayfs (enable overlay = %v)\n", c.engine.EngineConfig.File.EnableOverlay)
-			if imgObject.Type == image.SIF {
-				err = c.setupSIFOverlay(imgObject, c.engine.EngineConfig.GetWritableImage())
-				if err == nil {
-					return c.setupOverlayLayout(system, sessionPath)
-				}
-				sylog.Warningf("While attempting to set up SIFOverlay: %s", err)
+	if c.overlayDriver != noOverlay {
+		sylog.Debugf("Attempting to use %s (enable overlay = %v)\n", c.overlayDriver, c.engine.EngineConfig.File.EnableOverlay)
+		if imgObject.Type == image.SIF {
+			err = c.setupSIFOverlay(imgObject, c.engine.EngineConfig.GetWritableImage())
+			if err == nil {
+				return c.setupOverlayLayout(system, sessionPath)
 			}
-			return c.setupOverlayLayout(system, sessionPath)
+			sylog.Warningf("While attempting to set up SIFOverlay: %s", err)
 		}
+		return c.setupOverlayLayout(system, sessionPath)
 	}
 
 	if writableTmpfs {
@@ -366,7 +396,7 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 // setupOverlayLayout sets up the session with overlay filesystem
 func (c *container) setupOverlayLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating overlay SESSIONDIR layout\n")
-	if c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, overlay.New()); err != nil {
+	if c.session, err = c.newSession(system, sessionPath, overlay.New()); err != nil {
 		return err
 	}
 
@@ -381,7 +411,7 @@ func (c *container) setupOverlayLayout(system *mount.System, sessionPath string)
 // setupUnderlayLayout sets up the session with underlay "filesystem"
 func (c *container) setupUnderlayLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating underlay SESSIONDIR layout\n")
-	if c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, underlay.New()); err != nil {
+	if c.session, err = c.newSession(system, sessionPath, underlay.New()); err != nil {
 		return err
 	}
 
@@ -392,7 +422,7 @@ func (c *container) setupUnderlayLayout(system *mount.System, sessionPath string
 // setupDefaultLayout sets up the session without overlay or underlay
 func (c *container) setupDefaultLayout(system *mount.System, sessionPath string) (err error) {
 	sylog.Debugf("Creating default SESSIONDIR layout\n")
-	if c.session, err = layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, nil); err != nil {
+	if c.session, err = c.newSession(system, sessionPath, nil); err != nil {
 		return err
 	}
 
@@ -400,6 +430,113 @@ func (c *container) setupDefaultLayout(system *mount.System, sessionPath string)
 	return system.RunAfterTag(mount.SharedTag, c.setPropagationMount)
 }
 
+// newSession creates the session directory layout backed by a memory
+// filesystem or by a disk directory when "sessiondir path" is set
+func (c *container) newSession(system *mount.System, sessionPath string, layer layout.Layer) (*layout.Session, error) {
+	diskPath := c.engine.EngineConfig.File.SessiondirPath
+	if diskPath == "" {
+		return layout.NewSession(sessionPath, c.sessionFsType, c.sessionSize, system, layer)
+	}
+
+	dir, err := ioutil.TempDir(diskPath, "session-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session directory in %s: %s", diskPath, err)
+	}
+	c.engine.EngineConfig.SessionDir = dir
+
+	sylog.Debugf("Using disk backed session directory %s", dir)
+	return layout.NewDiskSession(sessionPath, dir, system, layer)
+}
+
+// resizeSession adds the space required by the requested features
+// to the session memory filesystem size when "sessiondir auto size"
+// is enabled, so the configured size remains available for user data
+// like --writable-tmpfs
+func (c *container) resizeSession(system *mount.System) error {
+	size := c.session.Size()
+	if size == 0 || !c.engine.EngineConfig.File.SessiondirAutoSize {
+		return nil
+	}
+
+	// files, directories and FUSE mount points already registered
+	extra := c.session.Usage()
+
+	// passwd and group are staged once the image is mounted
+	if c.engine.EngineConfig.File.ConfigPasswd {
+		extra += sessionStagedFileSize
+	}
+	if c.engine.EngineConfig.File.ConfigGroup {
+		extra += sessionStagedFileSize
+	}
+
+	// underlay duplicates the image root directory entries and
+	// the parent directories of mount points destination
+	if c.sessionLayerType == "underlay" {
+		extra += sessionUnderlaySize
+		for _, points := range system.Points.GetAll() {
+			for _, point := range points {
+				extra += uint64(strings.Count(point.Destination, "/")) * sessionBlockSize
+			}
+		}
+	}
+
+	extraMB := int((extra + 1<<20 - 1) >> 20)
+	sylog.Debugf("Session directory size set to %dMB (%dMB required by features)", size+extraMB, extraMB)
+
+	return c.session.Resize(system, size+extraMB)
+}
+
+// runMountHooks runs the mount hooks configured by the administrator
+// for stage, hooks are run as root with the setuid workflow and as the
+// user otherwise. Bind mounts returned by pre-mount hooks are added to
+// the mount list.
+func (c *container) runMountHooks(system *mount.System, stage string, pid int) error {
+	paths := c.engine.EngineConfig.File.PreMountHook
+	if stage == mounthook.PostMount {
+		paths = c.engine.EngineConfig.File.PostMountHook
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	config, err := json.Marshal(c.engine.EngineConfig)
+	if err != nil {
+		return fmt.Errorf("while marshaling engine configuration: %s", err)
+	}
+
+	root := os.Geteuid() == 0
+	if !root {
+		// escalation fails with the unprivileged workflow
+		root = priv.Escalate() == nil
+		defer priv.Drop()
+	}
+
+	for _, path := range paths {
+		hook := &mounthook.Hook{
+			Path:   path,
+			Stage:  stage,
+			Pid:    pid,
+			Rootfs: c.session.FinalPath(),
+			Root:   root,
+		}
+		mounts, err := hook.Run(config)
+		if err != nil {
+			return err
+		}
+		for _, m := range mounts {
+			flags, _ := mount.ConvertOptions(m.Options)
+			flags |= syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV
+
+			sylog.Debugf("Adding %s to mount list from mount hook %s", m.Source, path)
+			if err := system.Points.AddBind(mount.OtherTag, m.Source, m.Destination, flags); err != nil {
+				return fmt.Errorf("unable to add %s to mount list: %s", m.Source, err)
+			}
+			system.Points.AddRemount(mount.OtherTag, m.Destination, flags)
+		}
+	}
+	return nil
+}
+
 // isLayerEnabled returns whether or not overlay or underlay system
 // is enabled
 func (c *container) isLayerEnabled() bool {
@@ -408,9 +545,16 @@ func (c *container) isLayerEnabled() bool {
 }
 
 func (c *container) mount(point *mount.Point) error {
+	if c.mountHooks {
+		return c.mountWithHooks(point)
+	}
+	return c.mountPoint(point)
+}
+
+func (c *container) mountPoint(point *mount.Point) error {
 	if _, err := mount.GetOffset(point.InternalOptions); err == nil {
 		if err := c.mountImage(point); err != nil {
-			return fmt.Errorf("can't mount image %s: %s", point.Source, err)
+			return errcode.Wrap(errcode.Unknown, err, "can't mount image %s", point.Source)
 		}
 	} else {
 		if err := c.mountGeneric(point); err != nil {
@@ -549,11 +693,29 @@ func (c *container) mountGeneric(mnt *mount.Point) (err error) {
 			source = "."
 		}
 
+		if mnt.Type == "overlay" && c.overlayDriver == fuseOverlay && !c.useImageDriver(mnt.Type) {
+			return c.mountFuseOverlay(dest, flags, optsString)
+		}
+
 		// overlay requires root filesystem UID/GID since upper/work
 		// directories are owned by root
 		if mnt.Type == "overlay" {
 			c.rpcOps.SetFsID(0, 0)
 			defer c.rpcOps.SetFsID(os.Getuid(), os.Getgid())
+
+			if c.useImageDriver(mnt.Type) {
+				return c.mountImageDriver(&image.MountParams{
+					Source:     source,
+					Target:     dest,
+					Filesystem: mnt.Type,
+					Flags:      flags,
+					Options:    opts,
+				})
+			}
+		}
+
+		if c.idmapBinds[mnt.Destination] && c.idmapMount(source, dest, flags) {
+			return nil
 		}
 	}
 	err = c.rpcOps.Mount(source, dest, mnt.Type, flags, optsString)
@@ -585,6 +747,10 @@ func (c *container) mountImage(mnt *mount.Point) error {
 	flags, opts := mount.ConvertOptions(mnt.Options)
 	optsString := strings.Join(opts, ",")
 
+	if mnt.Type == "luks" {
+		return c.mountEncryptedOverlay(mnt, flags, optsString)
+	}
+
 	offset, err := mount.GetOffset(mnt.InternalOptions)
 	if err != nil {
 		return err
@@ -595,6 +761,18 @@ func (c *container) mountImage(mnt *mount.Point) error {
 		return err
 	}
 
+	if c.useImageDriver(mnt.Type) {
+		return c.mountImageDriver(&image.MountParams{
+			Source:     mnt.Source,
+			Target:     mnt.Destination,
+			Filesystem: mnt.Type,
+			Flags:      flags,
+			Offset:     offset,
+			Size:       sizelimit,
+			Options:    opts,
+		})
+	}
+
 	attachFlag := os.O_RDWR
 	loopFlags := uint32(loop.FlagsAutoClear)
 
@@ -612,7 +790,14 @@ func (c *container) mountImage(mnt *mount.Point) error {
 	shared := c.engine.EngineConfig.File.SharedLoopDevices
 	number, err := c.rpcOps.LoopDevice(mnt.Source, attachFlag, *info, maxDevices, shared)
 	if err != nil {
-		return fmt.Errorf("failed to find loop device: %s", err)
+		if mnt.Type == "squashfs" && c.engine.EngineConfig.File.EnableFusemount {
+			fuseErr := c.mountSquashfuse(mnt, offset, flags)
+			if fuseErr == nil {
+				return nil
+			}
+			sylog.Debugf("Could not mount %s with squashfuse: %s", mnt.Source, fuseErr)
+		}
+		return errcode.Wrap(errcode.Unknown, err, "failed to find loop device")
 	}
 
 	path := fmt.Sprintf("/dev/loop%d", number)
@@ -635,8 +820,15 @@ func (c *container) mountImage(mnt *mount.Point) error {
 			masterPid = os.Getpid()
 		}
 
-		cryptDev, err := c.rpcOps.Decrypt(offset, path, key, masterPid)
+		var cryptDev string
 
+		// without key, the key is retrieved by the RPC server
+		// from the key material provided by the user
+		if keyInfo := c.engine.EngineConfig.GetEncryptionKeyInfo(); len(key) == 0 && keyInfo != nil {
+			cryptDev, err = c.rpcOps.DecryptWithKeyInfo(offset, path, *keyInfo, mnt.Source, masterPid)
+		} else {
+			cryptDev, err = c.rpcOps.Decrypt(offset, path, key, masterPid)
+		}
 		if err != nil {
 			return fmt.Errorf("unable to decrypt the file system: %s", err)
 		}
@@ -671,6 +863,80 @@ func (c *container) mountImage(mnt *mount.Point) error {
 	return nil
 }
 
+// mountEncryptedOverlay opens the encrypted overlay image, formatted
+// first if blank, and mounts the ext3 filesystem it contains. The crypt
+// device is removed once the filesystem is unmounted.
+func (c *container) mountEncryptedOverlay(mnt *mount.Point, flags uintptr, opts string) error {
+	var keyInfo crypt.KeyInfo
+
+	key := c.engine.EngineConfig.GetEncryptionKey()
+	if info := c.engine.EngineConfig.GetEncryptionKeyInfo(); info != nil {
+		keyInfo = *info
+	}
+	if len(key) == 0 && keyInfo.Format == crypt.Unknown {
+		return fmt.Errorf("no encryption material provided for encrypted overlay %s", mnt.Source)
+	}
+
+	// see mountImage for the master processus ID requirement
+	masterPid := 0
+	if c.ipcNS {
+		masterPid = os.Getpid()
+	}
+
+	maxDevices := int(c.engine.EngineConfig.File.MaxLoopDevices)
+	readonly := flags&syscall.MS_RDONLY != 0
+
+	cryptDev, err := c.rpcOps.EncryptedOverlay(mnt.Source, key, keyInfo, maxDevices, os.Getuid(), os.Getgid(), masterPid, readonly)
+	if err != nil {
+		return fmt.Errorf("unable to open encrypted overlay: %s", err)
+	}
+
+	sylog.Debugf("Mounting crypt device %s to %s of type ext3\n", cryptDev, mnt.Destination)
+
+	mountErr := c.rpcOps.Mount(cryptDev, mnt.Destination, "ext3", flags, opts)
+	if err := c.rpcOps.CryptClose(cryptDev); err != nil {
+		sylog.Warningf("Crypt device %s won't be removed: %s", cryptDev, err)
+	}
+	if mountErr != nil {
+		return fmt.Errorf("failed to mount encrypted overlay: %s", mountErr)
+	}
+
+	return nil
+}
+
+// mountSquashfuse mounts the squashfs image partition with squashfuse
+// when no loop device is available, the squashfuse helper is terminated
+// during container cleanup.
+func (c *container) mountSquashfuse(mnt *mount.Point, offset uint64, flags uintptr) error {
+	squashfuse, err := exec.LookPath("squashfuse")
+	if err != nil {
+		return err
+	}
+
+	// the image file descriptor is not inherited by the helper
+	source := mnt.Source
+	if strings.HasPrefix(source, "/proc/self/fd/") {
+		source, err = os.Readlink(source)
+		if err != nil {
+			return fmt.Errorf("while resolving image path %s: %s", mnt.Source, err)
+		}
+	}
+
+	program := []string{squashfuse, "-o", fmt.Sprintf("offset=%d", offset), source}
+	flags |= syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_RDONLY
+
+	sylog.Debugf("Mounting %s to %s with squashfuse", source, mnt.Destination)
+
+	conn, pid, err := c.rpcOps.MountFuse(program, mnt.Destination, flags, "", os.Getuid(), os.Getgid())
+	if err != nil {
+		return err
+	}
+	c.engine.EngineConfig.FuseConnections = append(c.engine.EngineConfig.FuseConnections, conn)
+	c.engine.EngineConfig.FusePids = append(c.engine.EngineConfig.FusePids, pid)
+
+	return nil
+}
+
 func (c *container) loadImage(path string, rootfs bool) (*image.Image, error) {
 	list := c.engine.EngineConfig.GetImageList()
 
@@ -735,8 +1001,18 @@ func (c *container) addRootfsMount(system *mount.System) error {
 	switch imageObject.Partitions[0].Type {
 	case image.SQUASHFS:
 		mountType = "squashfs"
+		if v, err := c.rootfsVerity(imageObject); err != nil {
+			return err
+		} else if v != nil {
+			return c.addVerityMount(system, imageObject, v, flags)
+		}
 	case image.EXT3:
 		mountType = "ext3"
+	case image.EROFS:
+		if c.engine.EngineConfig.File.ComposefsStore != "" {
+			return c.addComposefsMount(system, imageObject, flags)
+		}
+		mountType = "erofs"
 	case image.ENCRYPTSQUASHFS:
 		mountType = "encryptfs"
 		key = c.engine.EngineConfig.GetEncryptionKey()
@@ -773,6 +1049,242 @@ func (c *container) addRootfsMount(system *mount.System) error {
 	return nil
 }
 
+// addRootfsInRAM registers the copy of the container root filesystem
+// into a memory filesystem once the image is mounted when --rootfs-in-ram
+// is requested, the image is released afterward so the container doesn't
+// access the image storage during execution
+func (c *container) addRootfsInRAM(system *mount.System) error {
+	if !c.engine.EngineConfig.GetRootfsInRAM() {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.AllowRootfsInRAM {
+		return fmt.Errorf("--rootfs-in-ram is disabled by configuration, see 'allow rootfs in ram' in singularity.conf")
+	}
+	if c.engine.EngineConfig.GetWritableImage() {
+		return fmt.Errorf("--rootfs-in-ram can't be used with a writable image")
+	}
+	if err := c.session.AddDir(rootfsInRAMDir); err != nil {
+		return err
+	}
+	return system.RunAfterTag(mount.RootfsTag, c.copyRootfsInRAM)
+}
+
+const rootfsInRAMDir = "/rootfs-ram"
+
+// copyRootfsInRAM copies the mounted container root filesystem into
+// a memory filesystem and replaces the root filesystem mount with it
+func (c *container) copyRootfsInRAM(system *mount.System) error {
+	rootfs := c.session.RootFsPath()
+	ramPath, err := c.session.GetPath(rootfsInRAMDir)
+	if err != nil {
+		return err
+	}
+
+	flags := c.suidFlag | syscall.MS_NODEV
+	opts := "mode=0755"
+	if max := c.engine.EngineConfig.File.RootfsInRAMMaxSize; max > 0 {
+		opts += fmt.Sprintf(",size=%dm", max)
+	}
+
+	sylog.Debugf("Mounting memory filesystem for root filesystem at %s", ramPath)
+	if err := c.rpcOps.Mount("tmpfs", ramPath, "tmpfs", flags, opts); err != nil {
+		return fmt.Errorf("failed to mount memory filesystem for root filesystem: %s", err)
+	}
+
+	sylog.Verbosef("Copying container root filesystem in memory")
+
+	// files are copied with their original ownership
+	c.rpcOps.SetFsID(0, 0)
+	dropped, err := c.rpcOps.CopyTree(rootfs, ramPath)
+	c.rpcOps.SetFsID(os.Getuid(), os.Getgid())
+
+	var st syscall.Statfs_t
+	if serr := syscall.Statfs(ramPath, &st); serr != nil {
+		return fmt.Errorf("failed to get root filesystem memory usage: %s", serr)
+	}
+	if err != nil {
+		if st.Bavail == 0 {
+			return errcode.New(errcode.NoSpace, "root filesystem doesn't fit in memory, consider increasing 'rootfs in ram max size' in singularity.conf")
+		}
+		return fmt.Errorf("failed to copy root filesystem in memory: %s", err)
+	}
+	dropped.Warn()
+
+	used := (st.Blocks - st.Bfree) * uint64(st.Bsize)
+	sylog.Verbosef("Root filesystem uses %d MB of memory", used>>20)
+	if err := c.checkRootfsInRAMLimit(used); err != nil {
+		return err
+	}
+
+	// release the image and its loop device
+	if err := c.rpcOps.Unmount(rootfs, 0); err != nil {
+		return fmt.Errorf("failed to unmount root filesystem image: %s", err)
+	}
+
+	// shrink the filesystem to the space used by the root filesystem
+	// and make it read-only, overlay uses it as lower directory
+	size := used
+	if size < uint64(st.Bsize) {
+		size = uint64(st.Bsize)
+	}
+	opts = fmt.Sprintf("size=%d", size)
+	if err := c.rpcOps.Mount("", ramPath, "", syscall.MS_REMOUNT|syscall.MS_RDONLY|flags, opts); err != nil {
+		return fmt.Errorf("failed to remount memory root filesystem: %s", err)
+	}
+
+	if err := c.rpcOps.Mount(ramPath, rootfs, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount memory root filesystem: %s", err)
+	}
+	if !c.userNS {
+		if err := c.rpcOps.Mount("", rootfs, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|flags, ""); err != nil {
+			return fmt.Errorf("failed to remount memory root filesystem: %s", err)
+		}
+	}
+
+	return c.rpcOps.Unmount(ramPath, syscall.MNT_DETACH)
+}
+
+// checkRootfsInRAMLimit checks that the memory used by the root filesystem
+// fits in the memory limit requested with --apply-cgroups. Memory
+// filesystem pages stay charged to the cgroup of the process which
+// copied the files, the user launching the container, so the container
+// memory limit wouldn't account for them
+func (c *container) checkRootfsInRAMLimit(used uint64) error {
+	path := c.engine.EngineConfig.GetCgroupsPath()
+	if path == "" {
+		return nil
+	}
+
+	config, err := cgroups.LoadConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load cgroups configuration %s: %s", path, err)
+	}
+	if config.Memory == nil || config.Memory.Limit == nil || *config.Memory.Limit <= 0 {
+		return nil
+	}
+
+	limit := uint64(*config.Memory.Limit)
+	if used >= limit {
+		return fmt.Errorf("root filesystem requires %d MB of memory, exceeding the %d MB cgroups memory limit", used>>20, limit>>20)
+	}
+	sylog.Verbosef("Root filesystem memory is charged to the calling process cgroup, not to the container cgroup")
+
+	return nil
+}
+
+// composefsFsType maps the composefs store image types to their
+// filesystem type
+var composefsFsType = map[int]string{
+	image.SQUASHFS: "squashfs",
+	image.EXT3:     "ext3",
+	image.EROFS:    "erofs",
+}
+
+const (
+	composefsMetaDir  = "/composefs/meta"
+	composefsStoreDir = "/composefs/store"
+)
+
+// addComposefsMount registers the assembly of the container root filesystem
+// from the composefs metadata image img and the object store configured by
+// "composefs store"
+func (c *container) addComposefsMount(system *mount.System, img *image.Image, flags uintptr) error {
+	if c.userNS {
+		return fmt.Errorf("composefs images can't be used with user namespace")
+	}
+	for _, dir := range []string{composefsMetaDir, composefsStoreDir} {
+		if err := c.session.AddDir(dir); err != nil {
+			return err
+		}
+	}
+	return system.RunBeforeTag(mount.RootfsTag, func(system *mount.System) error {
+		return c.mountComposefs(img, flags|syscall.MS_RDONLY)
+	})
+}
+
+// mountComposefs mounts the composefs metadata image and the object store
+// and assembles them with an overlay mount using the store as data-only
+// lower layer, file content is read from the store objects referenced by
+// the metadata image redirections
+func (c *container) mountComposefs(img *image.Image, flags uintptr) error {
+	cfg := c.engine.EngineConfig.File
+
+	metaPath, err := c.session.GetPath(composefsMetaDir)
+	if err != nil {
+		return err
+	}
+	storePath, err := c.session.GetPath(composefsStoreDir)
+	if err != nil {
+		return err
+	}
+
+	points := &mount.Points{}
+	part := img.Partitions[0]
+	if err := points.AddImage(mount.RootfsTag, img.Source, metaPath, "erofs", flags, part.Offset, part.Size, nil); err != nil {
+		return err
+	}
+
+	store, err := image.Init(cfg.ComposefsStore, false)
+	if err != nil {
+		return fmt.Errorf("while loading composefs store %s: %s", cfg.ComposefsStore, err)
+	}
+	defer store.File.Close()
+
+	storeType, ok := composefsFsType[store.Type]
+	if !ok {
+		return fmt.Errorf("composefs store %s is not a squashfs, EROFS or ext3 image", cfg.ComposefsStore)
+	}
+
+	if cfg.ComposefsStoreRootHash == "" {
+		part := store.Partitions[0]
+		if err := points.AddImage(mount.SessionTag, store.Path, storePath, storeType, flags, part.Offset, part.Size, nil); err != nil {
+			return err
+		}
+	} else if cfg.ComposefsStoreHash == "" {
+		return fmt.Errorf("'composefs store hash' is required with 'composefs store root hash'")
+	} else if store.Partitions[0].Offset != 0 {
+		return fmt.Errorf("composefs store %s with a dm-verity root hash can't have a launch script header", cfg.ComposefsStore)
+	}
+
+	sylog.Debugf("Mounting composefs metadata image %s to %s", img.Path, metaPath)
+	meta := points.GetByTag(mount.RootfsTag)
+	if err := c.mountImage(&meta[0]); err != nil {
+		return fmt.Errorf("while mounting composefs metadata image: %s", err)
+	}
+
+	if cfg.ComposefsStoreRootHash != "" {
+		dev, err := c.rpcOps.VerityOpen(store.Path, cfg.ComposefsStoreHash, cfg.ComposefsStoreRootHash)
+		if err != nil {
+			return fmt.Errorf("while mapping composefs store: %s", err)
+		}
+		sylog.Debugf("Mounting composefs store %s verified by %s to %s", store.Path, dev, storePath)
+		if err := c.rpcOps.Mount(dev, storePath, storeType, flags, ""); err != nil {
+			return fmt.Errorf("while mounting composefs store: %s", err)
+		}
+	} else {
+		sylog.Debugf("Mounting composefs store %s to %s", store.Path, storePath)
+		st := points.GetByTag(mount.SessionTag)
+		if err := c.mountImage(&st[0]); err != nil {
+			return fmt.Errorf("while mounting composefs store: %s", err)
+		}
+	}
+
+	opts := fmt.Sprintf("lowerdir=%s::%s,metacopy=on,redirect_dir=follow", metaPath, storePath)
+	if cfg.ComposefsVerity != "off" {
+		opts += ",verity=" + cfg.ComposefsVerity
+	}
+
+	sylog.Debugf("Assembling composefs root filesystem with overlay options %s", opts)
+	err = c.rpcOps.Mount("overlay", c.session.RootFsPath(), "overlay", flags, opts)
+	if err == syscall.EINVAL {
+		return fmt.Errorf("overlay data-only lower layers are not supported by the kernel (Linux 6.5 or later required, 6.6 for 'composefs verity')")
+	} else if err != nil {
+		return fmt.Errorf("while mounting composefs root filesystem: %s", err)
+	}
+
+	return nil
+}
+
 func (c *container) overlayUpperWork(system *mount.System) error {
 	ov := c.session.Layer.(*overlay.Overlay)
 
@@ -863,7 +1375,7 @@ func (c *container) addOverlayMount(system *mount.System) error {
 		size := imageObject.Partitions[0].Size
 
 		switch imageObject.Type {
-		case image.EXT3:
+		case image.EXT3, image.LUKS:
 			flags := uintptr(c.suidFlag | syscall.MS_NODEV)
 
 			if !imageObject.Writable {
@@ -871,9 +1383,15 @@ func (c *container) addOverlayMount(system *mount.System) error {
 				ov.AddLowerDir(filepath.Join(dst, "upper"))
 			}
 
-			err = system.Points.AddImage(mount.PreLayerTag, src, dst, "ext3", flags, offset, size, nil)
+			// LUKS images contain an encrypted ext3 filesystem
+			fstype := "ext3"
+			if imageObject.Type == image.LUKS {
+				fstype = "luks"
+			}
+
+			err = system.Points.AddImage(mount.PreLayerTag, src, dst, fstype, flags, offset, size, nil)
 			if err != nil {
-				return fmt.Errorf("while adding ext3 image: %s", err)
+				return fmt.Errorf("while adding %s image: %s", fstype, err)
 			}
 		case image.SQUASHFS:
 			flags := uintptr(c.suidFlag | syscall.MS_NODEV | syscall.MS_RDONLY)
@@ -897,7 +1415,7 @@ func (c *container) addOverlayMount(system *mount.System) error {
 			if !imageObject.Writable {
 				// check if the sandbox directory is located on a compatible
 				// filesystem usable overlay lower directory
-				if err := fsoverlay.CheckLower(imageObject.Path); err != nil {
+				if err := c.checkOverlayLower(imageObject.Path); err != nil {
 					return err
 				}
 				if fs.IsDir(filepath.Join(imageObject.Path, "upper")) {
@@ -908,7 +1426,7 @@ func (c *container) addOverlayMount(system *mount.System) error {
 			} else {
 				// check if the sandbox directory is located on a compatible
 				// filesystem usable with overlay upper directory
-				if err := fsoverlay.CheckUpper(imageObject.Path); err != nil {
+				if err := c.checkOverlayUpper(imageObject.Path); err != nil {
 					return err
 				}
 			}
@@ -1173,9 +1691,28 @@ func (c *container) addDevMount(system *mount.System) error {
 			return err
 		}
 		if c.engine.EngineConfig.GetNv() {
-			devs, err := nvidia.Devices(true)
+			devs := c.engine.EngineConfig.GetNvDevices()
+			if len(devs) == 0 {
+				var err error
+				devs, err = nvidia.Devices(true)
+				if err != nil {
+					return fmt.Errorf("failed to get nvidia devices: %v", err)
+				}
+			}
+			for _, dev := range devs {
+				// devices are set by the user, never expose other devices
+				if !nvidia.IsDevice(dev) {
+					return fmt.Errorf("%s is not an NVIDIA device", dev)
+				}
+				if err := c.addSessionDev(dev, system); err != nil {
+					return err
+				}
+			}
+		}
+		if c.engine.EngineConfig.GetRocm() {
+			devs, err := rocm.Devices()
 			if err != nil {
-				return fmt.Errorf("failed to get nvidia devices: %v", err)
+				return fmt.Errorf("failed to get ROCm devices: %v", err)
 			}
 			for _, dev := range devs {
 				if err := c.addSessionDev(dev, system); err != nil {
@@ -1408,55 +1945,56 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 		return nil
 	}
 
+	mountLabel := ""
+	if c.engine.EngineConfig.OciConfig.Linux != nil {
+		mountLabel = c.engine.EngineConfig.OciConfig.Linux.MountLabel
+	}
+
 	for _, b := range c.engine.EngineConfig.GetBindPath() {
 		flags := defaultFlags
-		splitted := strings.Split(b, ":")
+		relabel, shared := false, false
+		source, dst, opts := splitBindPath(b)
 
-		src, err := filepath.Abs(splitted[0])
+		src, err := filepath.Abs(source)
 		if err != nil {
-			sylog.Warningf("Can't determine absolute path of %s bind point", splitted[0])
+			sylog.Warningf("Can't determine absolute path of %s bind point", source)
 			continue
 		}
-		dst := src
-		if len(splitted) > 1 {
-			dst = splitted[1]
+		if dst == "" {
+			dst = src
 		}
-		if len(splitted) > 2 {
-			if splitted[2] == "ro" {
+		for _, o := range opts {
+			switch o {
+			case "ro":
 				flags |= syscall.MS_RDONLY
-			} else if splitted[2] != "rw" {
-				sylog.Warningf("Not mounting requested %s bind point, invalid mount option %s", src, splitted[2])
+			case "rw":
+			case "z":
+				relabel, shared = true, true
+			case "Z":
+				relabel = true
+			default:
+				sylog.Warningf("Not mounting requested %s bind point, invalid mount option %s", src, o)
 			}
 		}
 
 		// special case for /dev mount to override default mount behavior
 		// with --contain option or 'mount dev = minimal'
 		if strings.HasPrefix(src, devPrefix) {
-			if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
-				if strings.HasPrefix(src, "/dev/shm/") || strings.HasPrefix(src, "/dev/mqueue/") {
-					sylog.Warningf("Skipping %s bind mount: not allowed", src)
-				} else {
-					if src != devPrefix {
-						if err := c.addSessionDev(src, system); err != nil {
-							sylog.Warningf("Skipping %s bind mount: %s", src, err)
-						}
-					} else {
-						system.Points.RemoveByTag(mount.DevTag)
-						c.devSourcePath = devPrefix
-					}
-					sylog.Debugf("Adding device %s to mount list\n", src)
-				}
+			if c.addDevBind(src, system) {
 				devicesMounted++
-			} else if c.engine.EngineConfig.File.MountDev == "yes" {
-				sylog.Warningf("Skipping %s bind mount: /dev is already mounted", src)
-			} else {
-				sylog.Warningf("Skipping %s bind mount: disallowed by configuration", src)
 			}
 			continue
 		} else if !userBindControl {
 			continue
 		}
 
+		if relabel && mountLabel != "" {
+			sylog.Debugf("Relabeling %s with SELinux label %s", src, mountLabel)
+			if err := selinux.Relabel(src, mountLabel, shared); err != nil {
+				return fmt.Errorf("unable to relabel %s: %s", src, err)
+			}
+		}
+
 		sylog.Debugf("Adding %s to mount list\n", src)
 
 		if err := system.Points.AddBind(mount.UserbindsTag, src, dst, flags); err == mount.ErrMountExists {
@@ -1466,6 +2004,9 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 		} else {
 			c.session.OverrideDir(dst, src)
 			system.Points.AddRemount(mount.UserbindsTag, dst, flags)
+			if c.idmapBinds != nil {
+				c.idmapBinds[dst] = true
+			}
 		}
 	}
 
@@ -1477,6 +2018,225 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 	return nil
 }
 
+// addDevBind adds the bind of src located in /dev, it overrides the
+// default /dev mount behavior with --contain option or 'mount dev = minimal'
+// and is skipped otherwise. It returns true if the device bind is handled
+// with the minimal /dev.
+func (c *container) addDevBind(src string, system *mount.System) bool {
+	const devPrefix = "/dev"
+
+	if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
+		if strings.HasPrefix(src, "/dev/shm/") || strings.HasPrefix(src, "/dev/mqueue/") {
+			sylog.Warningf("Skipping %s bind mount: not allowed", src)
+		} else {
+			if src != devPrefix {
+				if err := c.addSessionDev(src, system); err != nil {
+					sylog.Warningf("Skipping %s bind mount: %s", src, err)
+				}
+			} else {
+				system.Points.RemoveByTag(mount.DevTag)
+				c.devSourcePath = devPrefix
+			}
+			sylog.Debugf("Adding device %s to mount list\n", src)
+		}
+		return true
+	} else if c.engine.EngineConfig.File.MountDev == "yes" {
+		sylog.Warningf("Skipping %s bind mount: /dev is already mounted", src)
+	} else {
+		sylog.Warningf("Skipping %s bind mount: disallowed by configuration", src)
+	}
+	return false
+}
+
+// mountPropagations maps the bind-propagation values of --mount to
+// their mount flags.
+var mountPropagations = map[string]uintptr{
+	"private":  syscall.MS_PRIVATE,
+	"rprivate": syscall.MS_PRIVATE | syscall.MS_REC,
+	"shared":   syscall.MS_SHARED,
+	"rshared":  syscall.MS_SHARED | syscall.MS_REC,
+	"slave":    syscall.MS_SLAVE,
+	"rslave":   syscall.MS_SLAVE | syscall.MS_REC,
+}
+
+// addMountsMount adds the bind, image and tmpfs mounts requested with
+// --mount, image and tmpfs filesystems are mounted in a session directory
+// and then bound to their destination.
+func (c *container) addMountsMount(system *mount.System) error {
+	mounts := c.engine.EngineConfig.GetMounts()
+	if len(mounts) == 0 {
+		return nil
+	}
+
+	devicesMounted := 0
+	userBindControl := c.engine.EngineConfig.File.UserBindControl
+
+	for i, m := range mounts {
+		// /dev binds follow the same rules as --bind
+		if m.Type == bind.BindType {
+			src, err := filepath.Abs(m.Source)
+			if err != nil {
+				sylog.Warningf("Can't determine absolute path of %s mount source", m.Source)
+				continue
+			}
+			if strings.HasPrefix(src, "/dev") {
+				if m.Destination != src {
+					sylog.Warningf("Skipping %s bind mount: /dev paths can only be mounted at the same destination", src)
+				} else if c.addDevBind(src, system) {
+					devicesMounted++
+				}
+				continue
+			}
+		}
+		if !userBindControl {
+			continue
+		}
+
+		flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+		if m.ReadOnly {
+			flags |= syscall.MS_RDONLY
+		}
+
+		src := m.Source
+		sessionDir := fmt.Sprintf("/mounts/%d", i)
+
+		switch m.Type {
+		case bind.BindType:
+		case bind.ImageType:
+			if err := c.session.AddDir(sessionDir); err != nil {
+				return fmt.Errorf("failed to create session directory for %s: %s", m.Destination, err)
+			}
+			src, _ = c.session.GetPath(sessionDir)
+			if err := c.addImageMount(system, m, src); err != nil {
+				return err
+			}
+		case bind.TmpfsType:
+			if err := c.session.AddDir(sessionDir); err != nil {
+				return fmt.Errorf("failed to create session directory for %s: %s", m.Destination, err)
+			}
+			src, _ = c.session.GetPath(sessionDir)
+
+			// like the session directory, tmpfs mounts of users are
+			// limited to 'sessiondir max size'
+			size := m.TmpfsSize
+			if maxSize := int64(c.sessionSize) << 20; maxSize > 0 && (size <= 0 || size > maxSize) {
+				if size > maxSize {
+					sylog.Warningf("Limiting tmpfs %s size to %d MB: sessiondir max size", m.Destination, c.sessionSize)
+				}
+				size = maxSize
+			}
+
+			options := ""
+			if size > 0 {
+				options = fmt.Sprintf("size=%d", size)
+			}
+			if m.TmpfsMode > 0 {
+				if options != "" {
+					options += ","
+				}
+				options += fmt.Sprintf("mode=%o", m.TmpfsMode)
+			}
+			fsFlags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+			if err := system.Points.AddFS(mount.UserbindsTag, src, "tmpfs", fsFlags, options); err != nil {
+				return fmt.Errorf("unable to add tmpfs %s to mount list: %s", m.Destination, err)
+			}
+		default:
+			return fmt.Errorf("unsupported mount type %s", m.Type)
+		}
+
+		sylog.Debugf("Adding %s mount %s to mount list\n", m.Type, m.Destination)
+
+		if err := system.Points.AddBind(mount.UserbindsTag, src, m.Destination, flags); err == mount.ErrMountExists {
+			sylog.Warningf("destination %s already in mount list: %s", m.Destination, err)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", m.Destination, err)
+		}
+		c.session.OverrideDir(m.Destination, src)
+		system.Points.AddRemount(mount.UserbindsTag, m.Destination, flags)
+		if m.Type == bind.BindType && c.idmapBinds != nil {
+			c.idmapBinds[m.Destination] = true
+		}
+
+		if m.Propagation != "" {
+			propagation := mountPropagations[m.Propagation]
+			// shared mounts would propagate container mounts to the host
+			if propagation&syscall.MS_SHARED != 0 && os.Geteuid() != 0 {
+				return fmt.Errorf("only root user can use %s bind propagation", m.Propagation)
+			}
+			if err := system.Points.AddPropagation(mount.UserbindsTag, m.Destination, propagation); err != nil {
+				return fmt.Errorf("unable to set %s propagation: %s", m.Destination, err)
+			}
+		}
+	}
+
+	sylog.Debugf("Checking for 'user bind control' in configuration file")
+	if !userBindControl && devicesMounted == 0 {
+		sylog.Warningf("Ignoring --mount request: user bind control disabled by system administrator")
+	}
+
+	return nil
+}
+
+// addImageMount adds the mount of the image partition requested by the
+// --mount specification m into the session directory dst.
+func (c *container) addImageMount(system *mount.System, m bind.Mount, dst string) error {
+	img, err := c.loadImage(m.Source, false)
+	if err != nil {
+		return fmt.Errorf("failed to open image %s: %s", m.Source, err)
+	}
+
+	var part *image.Section
+	for i := range img.Partitions {
+		if m.PartitionID == 0 || img.Partitions[i].ID == m.PartitionID {
+			part = &img.Partitions[i]
+			break
+		}
+	}
+	if part == nil {
+		return fmt.Errorf("no partition with ID %d found in image %s", m.PartitionID, m.Source)
+	}
+
+	flags := uintptr(c.suidFlag | syscall.MS_NODEV)
+	if m.ReadOnly || !img.Writable {
+		flags |= syscall.MS_RDONLY
+	}
+
+	fstype := ""
+	switch part.Type {
+	case image.EXT3:
+		fstype = "ext3"
+	case image.SQUASHFS:
+		fstype = "squashfs"
+		flags |= syscall.MS_RDONLY
+	case image.EROFS:
+		fstype = "erofs"
+		flags |= syscall.MS_RDONLY
+	default:
+		return fmt.Errorf("partition %s of image %s can't be mounted: unsupported filesystem", part.Name, m.Source)
+	}
+
+	sylog.Debugf("Adding %s partition %s of %s to mount list", fstype, part.Name, m.Source)
+	if err := system.Points.AddImage(mount.UserbindsTag, img.Source, dst, fstype, flags, part.Offset, part.Size, nil); err != nil {
+		return fmt.Errorf("while adding %s image mount: %s", fstype, err)
+	}
+	return nil
+}
+
+// splitBindPath splits a bind path specification src[:dst[:opts...]]
+// into its source, destination and mount options, destination is empty
+// when not specified.
+func splitBindPath(bind string) (string, string, []string) {
+	splitted := strings.Split(bind, ":")
+	switch len(splitted) {
+	case 1:
+		return splitted[0], "", nil
+	case 2:
+		return splitted[0], splitted[1], nil
+	}
+	return splitted[0], splitted[1], splitted[2:]
+}
+
 func (c *container) addTmpMount(system *mount.System) error {
 	const (
 		tmpPath    = "/tmp"
@@ -1771,8 +2531,20 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 		var content []byte
 
 		dns := c.engine.EngineConfig.GetDNS()
+		template := c.engine.EngineConfig.GetResolvConf()
+
+		dns = strings.Replace(dns, " ", "", -1)
 
-		if dns == "" {
+		if template != "" {
+			// name servers given with --dns replace those of the template
+			content = []byte(template)
+			if dns != "" {
+				content, err = files.ResolvConfNameservers(content, strings.Split(dns, ","))
+				if err != nil {
+					return err
+				}
+			}
+		} else if dns == "" {
 			r, err := os.Open(resolvConf)
 			if err != nil {
 				return err
@@ -1783,12 +2555,19 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 				return err
 			}
 		} else {
-			dns = strings.Replace(dns, " ", "", -1)
 			content, err = files.ResolvConf(strings.Split(dns, ","))
 			if err != nil {
 				return err
 			}
 		}
+
+		if search := c.engine.EngineConfig.GetDNSSearch(); search != "" {
+			search = strings.Replace(search, " ", "", -1)
+			content, err = files.ResolvConfSearch(content, strings.Split(search, ","))
+			if err != nil {
+				return err
+			}
+		}
 		if err := c.session.AddFile(resolvConf, content); err != nil {
 			sylog.Warningf("failed to add resolv.conf session file: %s", err)
 		}
@@ -1801,11 +2580,65 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 		}
 		sylog.Verbosef("Default mount: /etc/resolv.conf:/etc/resolv.conf")
 	} else {
+		if c.engine.EngineConfig.GetDNS() != "" || c.engine.EngineConfig.GetDNSSearch() != "" || c.engine.EngineConfig.GetResolvConf() != "" {
+			sylog.Warningf("Ignoring DNS options as 'config resolv_conf' is disabled by configuration")
+		}
 		sylog.Verbosef("Skipping bind of the host's %s", resolvConf)
 	}
 	return nil
 }
 
+// addHostsMount adds the requested host entries to the container /etc/hosts,
+// the file is built on top of the host /etc/hosts when it's bound by a 'bind
+// path' directive, otherwise on top of the container image one.
+func (c *container) addHostsMount(system *mount.System) error {
+	hostsFile := "/etc/hosts"
+
+	entries := c.engine.EngineConfig.GetAddHosts()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	rootfs := c.session.RootFsPath()
+	defer c.session.Update()
+
+	base := filepath.Join(rootfs, fs.EvalRelative(hostsFile, rootfs))
+	if !c.engine.EngineConfig.GetContain() {
+		for _, bindpath := range c.engine.EngineConfig.File.BindPath {
+			splitted := strings.Split(bindpath, ":")
+			if splitted[len(splitted)-1] == hostsFile {
+				base = splitted[0]
+			}
+		}
+	}
+
+	var content []byte
+	if fs.IsFile(base) {
+		b, err := ioutil.ReadFile(base)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", base, err)
+		}
+		content = b
+	}
+
+	content, err := files.Hosts(content, entries)
+	if err != nil {
+		return fmt.Errorf("unable to add host entries: %s", err)
+	}
+	if err := c.session.AddFile(hostsFile, content); err != nil {
+		return fmt.Errorf("failed to add hosts session file: %s", err)
+	}
+	sessionFile, _ := c.session.GetPath(hostsFile)
+
+	sylog.Debugf("Adding %s to mount list\n", hostsFile)
+	err = system.Points.AddBind(mount.FilesTag, sessionFile, hostsFile, syscall.MS_BIND)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", hostsFile, err)
+	}
+	sylog.Verbosef("Default mount: /etc/hosts:/etc/hosts")
+	return nil
+}
+
 func (c *container) addHostnameMount(system *mount.System) error {
 	hostnameFile := "/etc/hostname"
 
@@ -1814,21 +2647,9 @@ func (c *container) addHostnameMount(system *mount.System) error {
 		if hostname != "" {
 			sylog.Debugf("Set container hostname %s", hostname)
 
-			content, err := files.Hostname(hostname)
-			if err != nil {
-				return fmt.Errorf("unable to add %s to hostname file: %s", hostname, err)
-			}
-			if err := c.session.AddFile(hostnameFile, content); err != nil {
-				return fmt.Errorf("failed to add hostname session file: %s", err)
-			}
-			sessionFile, _ := c.session.GetPath(hostnameFile)
-
-			sylog.Debugf("Adding %s to mount list\n", hostnameFile)
-			err = system.Points.AddBind(mount.FilesTag, sessionFile, hostnameFile, syscall.MS_BIND)
-			if err != nil {
-				return fmt.Errorf("unable to add %s to mount list: %s", hostnameFile, err)
+			if err := c.addHostnameFile(system, hostnameFile, hostname); err != nil {
+				return err
 			}
-			sylog.Verbosef("Default mount: /etc/hostname:/etc/hostname")
 			if _, err := c.rpcOps.SetHostname(hostname); err != nil {
 				return fmt.Errorf("failed to set container hostname: %s", err)
 			}
@@ -1839,6 +2660,31 @@ func (c *container) addHostnameMount(system *mount.System) error {
 	return nil
 }
 
+// addHostnameFile binds a hostname file holding hostname on the container
+// hostnameFile, unless disabled with --no-hostname-file.
+func (c *container) addHostnameFile(system *mount.System, hostnameFile, hostname string) error {
+	content, err := files.Hostname(hostname)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to hostname file: %s", hostname, err)
+	}
+	if c.engine.EngineConfig.GetNoHostnameFile() {
+		sylog.Debugf("Skipping hostname mount on user request")
+		return nil
+	}
+	if err := c.session.AddFile(hostnameFile, content); err != nil {
+		return fmt.Errorf("failed to add hostname session file: %s", err)
+	}
+	sessionFile, _ := c.session.GetPath(hostnameFile)
+
+	sylog.Debugf("Adding %s to mount list\n", hostnameFile)
+	err = system.Points.AddBind(mount.FilesTag, sessionFile, hostnameFile, syscall.MS_BIND)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", hostnameFile, err)
+	}
+	sylog.Verbosef("Default mount: /etc/hostname:/etc/hostname")
+	return nil
+}
+
 func (c *container) addActionsMount(system *mount.System) error {
 	hostDir := filepath.Join(buildcfg.SYSCONFDIR, "/singularity/actions")
 	containerDir := "/.singularity.d/actions"
@@ -1858,6 +2704,12 @@ func (c *container) addActionsMount(system *mount.System) error {
 	return system.Points.AddRemount(mount.BindsTag, containerDir, flags)
 }
 
+// checkMPIABI checks that the container MPI library is ABI compatible
+// with the host MPI library used to launch the container
+func (c *container) checkMPIABI(system *mount.System) error {
+	return mpi.CheckABI(c.engine.EngineConfig.GetMPIABI(), c.session.RootFsPath())
+}
+
 func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func() error, error) {
 	const (
 		fakerootNet  = "fakeroot"
@@ -1871,6 +2723,9 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func() e
 	euid := os.Geteuid()
 
 	if !c.netNS || net == noneNet {
+		if len(c.engine.EngineConfig.GetPublish()) > 0 {
+			sylog.Warningf("Ignoring published ports without a configured network")
+		}
 		return nil, nil
 	} else if (c.userNS || euid != 0) && !fakeroot {
 		return nil, fmt.Errorf("network requires root or --fakeroot, users need to specify --network=%s with --net", noneNet)
@@ -1913,6 +2768,16 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func() e
 	if err := setup.SetArgs(netargs); err != nil {
 		return nil, fmt.Errorf("error while setting network arguments: %s", err)
 	}
+	for _, publish := range c.engine.EngineConfig.GetPublish() {
+		pm, err := network.ParsePortMap(publish)
+		if err != nil {
+			return nil, fmt.Errorf("bad published port %s: %s", publish, err)
+		}
+		// ports are published through the first network
+		if err := setup.SetCapability(networks[0], "portMappings", *pm); err != nil {
+			return nil, fmt.Errorf("could not publish port %s: %s", publish, err)
+		}
+	}
 
 	return func() error {
 		if fakeroot {
@@ -0,0 +1,178 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs/layout"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// testContainer returns a container with a session directory created in
+// dir, the container image root filesystem is the session rootfs directory.
+func testContainer(t *testing.T, dir string) *container {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	session := &layout.Session{Manager: &layout.Manager{}}
+	if err := session.SetRootPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.AddDir("/rootfs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &container{
+		engine:  &EngineOperations{EngineConfig: singularityConfig.NewConfig()},
+		session: session,
+	}
+}
+
+// sessionFile returns the content of the session file bound on dest, or
+// false if nothing is bound on dest.
+func sessionFile(t *testing.T, system *mount.System, dest string) (string, bool) {
+	points := system.Points.GetByDest(dest)
+	if len(points) == 0 {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(points[0].Source)
+	if err != nil {
+		t.Fatalf("could not read %s: %s", points[0].Source, err)
+	}
+	return string(b), true
+}
+
+func TestAddHostsMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosts-mount-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostHosts := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hostHosts, []byte("127.0.0.1\thost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		entries  []string
+		bindPath []string
+		contain  bool
+		mounted  bool
+		expected string
+	}{
+		{
+			name: "NoEntries",
+		},
+		{
+			name:     "ImageHosts",
+			entries:  []string{"db:10.0.0.2"},
+			mounted:  true,
+			expected: "127.0.0.1\timage\n10.0.0.2\tdb\n",
+		},
+		{
+			name:     "BoundHostHosts",
+			entries:  []string{"db:10.0.0.2"},
+			bindPath: []string{hostHosts + ":/etc/hosts"},
+			mounted:  true,
+			expected: "127.0.0.1\thost\n10.0.0.2\tdb\n",
+		},
+		{
+			name:     "ContainedImageHosts",
+			entries:  []string{"db:10.0.0.2", "web:10.0.0.3"},
+			bindPath: []string{hostHosts + ":/etc/hosts"},
+			contain:  true,
+			mounted:  true,
+			expected: "127.0.0.1\timage\n10.0.0.2\tdb\n10.0.0.3\tweb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionDir := filepath.Join(dir, tt.name)
+			c := testContainer(t, sessionDir)
+
+			etc := filepath.Join(c.session.RootFsPath(), "etc")
+			if err := os.MkdirAll(etc, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(etc, "hosts"), []byte("127.0.0.1\timage"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			c.engine.EngineConfig.SetAddHosts(tt.entries)
+			c.engine.EngineConfig.SetContain(tt.contain)
+			c.engine.EngineConfig.File.BindPath = tt.bindPath
+
+			system := &mount.System{Points: &mount.Points{}}
+			if err := c.addHostsMount(system); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			content, mounted := sessionFile(t, system, "/etc/hosts")
+			if mounted != tt.mounted {
+				t.Fatalf("got /etc/hosts mounted %v, expected %v", mounted, tt.mounted)
+			}
+			if content != tt.expected {
+				t.Errorf("got /etc/hosts content %q, expected %q", content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAddHostnameFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostname-file-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name           string
+		noHostnameFile bool
+		mounted        bool
+	}{
+		{name: "HostnameFile", mounted: true},
+		{name: "NoHostnameFile", noHostnameFile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testContainer(t, filepath.Join(dir, tt.name))
+			c.engine.EngineConfig.SetNoHostnameFile(tt.noHostnameFile)
+
+			system := &mount.System{Points: &mount.Points{}}
+			if err := c.addHostnameFile(system, "/etc/hostname", "container"); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := c.session.Update(); err != nil {
+				t.Fatal(err)
+			}
+
+			content, mounted := sessionFile(t, system, "/etc/hostname")
+			if mounted != tt.mounted {
+				t.Fatalf("got /etc/hostname mounted %v, expected %v", mounted, tt.mounted)
+			}
+			if mounted && content != "container\n" {
+				t.Errorf("got /etc/hostname content %q", content)
+			}
+		})
+	}
+
+	c := testContainer(t, filepath.Join(dir, "BadHostname"))
+	if err := c.addHostnameFile(&mount.System{Points: &mount.Points{}}, "/etc/hostname", "bad host"); err == nil {
+		t.Errorf("unexpected success with a bad hostname")
+	}
+}
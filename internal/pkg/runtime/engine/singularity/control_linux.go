@@ -0,0 +1,250 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/instancectl"
+)
+
+const (
+	controlDir    = "control"
+	controlSocket = "control.sock"
+	// maxLogsSize is the maximum size of log data returned at once
+	maxLogsSize = 1 << 20
+	// controlExecTimeout is the maximum duration of commands executed
+	// through the control socket, the command is killed once elapsed
+	controlExecTimeout = 10 * time.Minute
+)
+
+// controlHandler implements the instance control operations
+// from the master process.
+type controlHandler struct {
+	engine *EngineOperations
+	name   string
+	pid    int
+	pw     *user.User
+}
+
+// startControlServer creates the control socket in a directory of the
+// instance directory only accessible by the instance owner and serves it
+// for the instance lifetime.
+func (e *EngineOperations) startControlServer(file *instance.File, pid int, pw *user.User) error {
+	dir := filepath.Join(filepath.Dir(file.Path), controlDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+	if os.Geteuid() == 0 && pw.UID != 0 {
+		if err := os.Chown(dir, int(pw.UID), int(pw.GID)); err != nil {
+			return fmt.Errorf("while changing control directory owner: %s", err)
+		}
+	}
+	path := filepath.Join(dir, controlSocket)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("while creating control socket: %s", err)
+	}
+
+	h := &controlHandler{
+		engine: e,
+		name:   file.Name,
+		pid:    pid,
+		pw:     pw,
+	}
+	go func() {
+		cl := &ownerListener{UnixListener: l.(*net.UnixListener), allowed: ownerUIDs(pw)}
+		if err := instancectl.Serve(cl, h); err != nil {
+			sylog.Debugf("Instance control server stopped: %s", err)
+		}
+	}()
+
+	file.ControlSocket = path
+	return nil
+}
+
+// ownerListener accepts only the connections of clients whose user ID
+// is allowed, other connections are closed.
+type ownerListener struct {
+	*net.UnixListener
+	allowed map[uint32]bool
+}
+
+// Accept waits for and returns the next connection of an allowed client.
+func (l *ownerListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.UnixListener.AcceptUnix()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPeerUID(c, l.allowed); err != nil {
+			sylog.Debugf("Control connection refused: %s", err)
+			c.Close()
+			continue
+		}
+		return c, nil
+	}
+}
+
+// Stats returns the instance resource usage, it requires the instance
+// to be started with a cgroups profile.
+func (h *controlHandler) Stats() (*instancectl.Stats, error) {
+	manager := h.engine.EngineConfig.Cgroups
+	if manager == nil {
+		return nil, fmt.Errorf("instance statistics require an instance started by root with --apply-cgroups")
+	}
+	stats, err := manager.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("while reading instance cgroup statistics: %s", err)
+	}
+	return &instancectl.Stats{
+		MemoryUsage: stats.MemoryUsage,
+		MemoryLimit: stats.MemoryLimit,
+		CPUUsage:    stats.CPUUsage,
+		Pids:        stats.Pids,
+	}, nil
+}
+
+// Exec executes a command in the instance with singularity exec as
+// the instance owner and returns its combined output, the command is
+// killed after controlExecTimeout.
+func (h *controlHandler) Exec(args []string) (*instancectl.ExecResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), controlExecTimeout)
+	defer cancel()
+
+	res, err := execInstance(ctx, h.name, h.pw, args)
+	if err == nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("command killed after %s", controlExecTimeout)
+	}
+	return res, err
+}
+
+// execInstance executes a command in the named instance with singularity
+// exec as the user pw and returns its combined output, the command is
+// killed when ctx is done.
+func execInstance(ctx context.Context, name string, pw *user.User, args []string) (*instancectl.ExecResult, error) {
+	singularity := filepath.Join(buildcfg.BINDIR, "singularity")
+	cmd := exec.CommandContext(ctx, singularity, append([]string{"exec", "instance://" + name}, args...)...)
+	cmd.Dir = "/"
+	cmd.Env = []string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOME=" + pw.Dir,
+		"USER=" + pw.Name,
+	}
+	// never execute commands with the master process privileges
+	if os.Geteuid() == 0 && pw.UID != 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: pw.UID, Gid: pw.GID},
+		}
+	}
+
+	res := &instancectl.ExecResult{}
+	out, err := cmd.CombinedOutput()
+	res.Output = out
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("while executing command: %s", err)
+		}
+		res.ExitCode = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+	}
+	return res, nil
+}
+
+// Pause freezes the instance cgroup or stops instance processes when
+// the instance has no cgroup.
+func (h *controlHandler) Pause() error {
+	if manager := h.engine.EngineConfig.Cgroups; manager != nil {
+		return manager.Pause()
+	}
+	return h.signalProcesses(syscall.SIGSTOP)
+}
+
+// Resume thaws the instance cgroup or continues instance processes when
+// the instance has no cgroup.
+func (h *controlHandler) Resume() error {
+	if manager := h.engine.EngineConfig.Cgroups; manager != nil {
+		return manager.Resume()
+	}
+	return h.signalProcesses(syscall.SIGCONT)
+}
+
+// signalProcesses sends sig to all processes of the instance PID
+// namespace, it's not possible to identify instance processes without
+// a dedicated PID namespace.
+func (h *controlHandler) signalProcesses(sig syscall.Signal) error {
+	nsPath := func(pid string) string {
+		p, _ := os.Readlink(filepath.Join("/proc", pid, "ns", "pid"))
+		return p
+	}
+	ns := nsPath(strconv.Itoa(h.pid))
+	if ns == "" {
+		return fmt.Errorf("could not determine instance PID namespace")
+	} else if ns == nsPath("self") {
+		return fmt.Errorf("pause and resume require an instance started with a cgroups profile or a PID namespace")
+	}
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || nsPath(e.Name()) != ns {
+			continue
+		}
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("while sending %s to process %d: %s", sig, pid, err)
+		}
+	}
+	return nil
+}
+
+// Logs reads instance output or error log file from offset.
+func (h *controlHandler) Logs(stream string, offset int64, size int) (*instancectl.LogsResult, error) {
+	stdout, stderr, err := instance.GetLogFilePaths(h.name, instance.SingSubDir)
+	if err != nil {
+		return nil, err
+	}
+	path := stdout
+	if stream == instancectl.Stderr {
+		path = stderr
+	}
+	if size <= 0 || size > maxLogsSize {
+		size = maxLogsSize
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening log file: %s", err)
+	}
+	defer f.Close()
+
+	data := make([]byte, size)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("while reading log file: %s", err)
+	}
+	return &instancectl.LogsResult{Data: data[:n], Offset: offset + int64(n)}, nil
+}
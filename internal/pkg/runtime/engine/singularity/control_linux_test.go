@@ -0,0 +1,90 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOwnerListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	uid := uint32(os.Getuid())
+
+	tests := []struct {
+		name     string
+		allowed  map[uint32]bool
+		accepted bool
+	}{
+		{
+			name:     "Allowed",
+			allowed:  map[uint32]bool{uid: true},
+			accepted: true,
+		},
+		{
+			name:    "NotAllowed",
+			allowed: map[uint32]bool{uid + 1: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".sock")
+			l, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ol := &ownerListener{UnixListener: l.(*net.UnixListener), allowed: tt.allowed}
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				c, err := ol.Accept()
+				if err != nil {
+					close(accepted)
+					return
+				}
+				accepted <- c
+			}()
+
+			client, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			if tt.accepted {
+				c := <-accepted
+				if c == nil {
+					t.Errorf("connection of an allowed client refused")
+				} else {
+					c.Close()
+				}
+				ol.Close()
+				return
+			}
+
+			// refused connections are closed by the listener
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := client.Read(make([]byte, 1)); err == nil {
+				t.Errorf("connection of a refused client not closed")
+			}
+			ol.Close()
+			if c := <-accepted; c != nil {
+				c.Close()
+				t.Errorf("connection of a refused client accepted")
+			}
+		})
+	}
+}
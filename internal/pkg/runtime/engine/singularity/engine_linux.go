@@ -6,6 +6,9 @@
 package singularity
 
 import (
+	"net"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc/server"
@@ -16,6 +19,20 @@ import (
 type EngineOperations struct {
 	CommonConfig *config.Common                  `json:"-"`
 	EngineConfig *singularityConfig.EngineConfig `json:"engineConfig"`
+
+	// restoredPid is the PID of the process tree restored from
+	// a checkpoint, accessed atomically by the master process.
+	restoredPid int32
+
+	// healthcheck runs the instance healthcheck in the master process.
+	healthcheck *healthcheck
+
+	// logger writes the instance structured log in the master process.
+	logger *instance.Logger
+
+	// execAgentRelay relays the exec agent connections from the
+	// master process to the container process.
+	execAgentRelay *net.UnixConn
 }
 
 // InitConfig stores the pointer to config.Common.
@@ -0,0 +1,286 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/execagent"
+)
+
+const execAgentSocket = "exec-agent.sock"
+
+// execAgent spawns the processes requested to the instance exec agent
+// from the container process, processes share the container namespaces
+// and security context and are reaped by the container process loop.
+//
+// The exec agent socket is served by the master process which checks
+// the client credentials and relays the accepted connections to the
+// container process.
+type execAgent struct {
+	env   []string
+	cwd   string
+	mu    sync.Mutex
+	procs map[int]chan syscall.WaitStatus
+}
+
+// newExecAgent sends the relay socket of the exec agent to the master
+// process through masterConn and serves the relayed connections.
+func newExecAgent(masterConn net.Conn, env []string, cwd string) (*execAgent, error) {
+	conn, ok := masterConn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("master connection is not a unix socket")
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec agent relay: %s", err)
+	}
+	_, _, err = conn.WriteMsgUnix([]byte{'a'}, syscall.UnixRights(fds[1]), nil)
+	syscall.Close(fds[1])
+	if err != nil {
+		syscall.Close(fds[0])
+		return nil, fmt.Errorf("failed to send exec agent relay to master: %s", err)
+	}
+
+	relay, err := fdConn(fds[0], "exec-agent-relay")
+	if err != nil {
+		return nil, err
+	}
+
+	a := &execAgent{
+		env:   env,
+		cwd:   cwd,
+		procs: make(map[int]chan syscall.WaitStatus),
+	}
+	go a.serve(relay)
+
+	return a, nil
+}
+
+// fdConn returns the unix socket connection of the file descriptor fd.
+func fdConn(fd int, name string) (*net.UnixConn, error) {
+	f := os.NewFile(uintptr(fd), name)
+	c, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s connection: %s", name, err)
+	}
+	return c.(*net.UnixConn), nil
+}
+
+// serve serves the client connections received from relay.
+func (a *execAgent) serve(relay *net.UnixConn) {
+	defer relay.Close()
+
+	data := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	for {
+		_, oobn, _, _, err := relay.ReadMsgUnix(data, oob)
+		if err != nil || oobn == 0 {
+			sylog.Debugf("Exec agent relay closed: %v", err)
+			return
+		}
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			continue
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			continue
+		}
+		conn, err := fdConn(fds[0], "exec-agent-client")
+		if err != nil {
+			sylog.Debugf("%s", err)
+			continue
+		}
+		go func() {
+			if err := execagent.ServeConn(conn, a.start); err != nil {
+				sylog.Debugf("Exec agent request failed: %s", err)
+			}
+		}()
+	}
+}
+
+// start starts the process described by req, the process is registered
+// before the container process loop can reap it.
+func (a *execAgent) start(req *execagent.Request, files []*os.File) (int, <-chan syscall.WaitStatus, error) {
+	cwd := req.Cwd
+	if cwd == "" {
+		cwd = a.cwd
+	}
+	attr := &os.ProcAttr{
+		Dir:   cwd,
+		Env:   mergeEnv(a.env, req.Env),
+		Files: files,
+		Sys: &syscall.SysProcAttr{
+			Setpgid: true,
+		},
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, err := os.StartProcess(req.Args[0], req.Args, attr)
+	if err != nil {
+		return 0, nil, err
+	}
+	// the process is waited by the container process loop,
+	// Release resets the process PID
+	pid := p.Pid
+	p.Release()
+
+	wait := make(chan syscall.WaitStatus, 1)
+	a.procs[pid] = wait
+
+	return pid, wait, nil
+}
+
+// reaped reports the wait status of the process pid reaped by the
+// container process loop and returns whether it was spawned by the agent.
+func (a *execAgent) reaped(pid int, status syscall.WaitStatus) bool {
+	if a == nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wait, ok := a.procs[pid]
+	if ok {
+		wait <- status
+		delete(a.procs, pid)
+	}
+	return ok
+}
+
+// signal sends sig to the process groups of the processes spawned by
+// the agent, they don't share the process group of the container process.
+func (a *execAgent) signal(sig syscall.Signal) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for pid := range a.procs {
+		if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+			sylog.Debugf("Failed to signal process group %d: %s", pid, err)
+		}
+	}
+}
+
+// mergeEnv returns the environment env with the variables of extra
+// added or replaced.
+func mergeEnv(env, extra []string) []string {
+	merged := make([]string, 0, len(env)+len(extra))
+	index := make(map[string]int, len(env)+len(extra))
+
+	for _, list := range [][]string{env, extra} {
+		for _, e := range list {
+			key := strings.SplitN(e, "=", 2)[0]
+			if i, ok := index[key]; ok {
+				merged[i] = e
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// SetExecAgentRelay is called by the master process with the socket
+// relaying the exec agent connections to the container process.
+func (e *EngineOperations) SetExecAgentRelay(fd int) {
+	relay, err := fdConn(fd, "exec-agent-relay")
+	if err != nil {
+		sylog.Warningf("Instance exec agent not available: %s", err)
+		return
+	}
+	e.execAgentRelay = relay
+}
+
+// startExecAgent creates the exec agent socket in the instance directory
+// and relays the connections of the instance owner and of the users
+// allowed by the exec agent users directive to the container process.
+func (e *EngineOperations) startExecAgent(file *instance.File, pw *user.User) error {
+	relay := e.execAgentRelay
+	if relay == nil {
+		return fmt.Errorf("exec agent not started by the container process")
+	}
+
+	dir := filepath.Dir(file.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, execAgentSocket)
+
+	// the socket is reachable by all users, access
+	// is checked with the client credentials
+	oldmask := syscall.Umask(0111)
+	l, err := net.Listen(execagent.Network, path)
+	syscall.Umask(oldmask)
+	if err != nil {
+		return fmt.Errorf("while creating exec agent socket: %s", err)
+	}
+
+	allowed := ownerUIDs(pw)
+	for _, name := range e.EngineConfig.File.ExecAgentUsers {
+		u, err := user.GetPwNam(name)
+		if err != nil {
+			sylog.Warningf("Ignoring exec agent user %s: %s", name, err)
+			continue
+		}
+		allowed[u.UID] = true
+	}
+
+	go func() {
+		defer relay.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				sylog.Debugf("Instance exec agent stopped: %s", err)
+				return
+			}
+			if err := relayExecAgentConn(relay, c.(*net.UnixConn), allowed); err != nil {
+				sylog.Debugf("Exec agent connection refused: %s", err)
+			}
+			c.Close()
+		}
+	}()
+
+	file.ExecAgentSocket = path
+	return nil
+}
+
+// relayExecAgentConn sends the client connection conn to the container
+// process through relay if the client user ID is allowed.
+func relayExecAgentConn(relay, conn *net.UnixConn, allowed map[uint32]bool) error {
+	if err := checkPeerUID(conn, allowed); err != nil {
+		return err
+	}
+
+	f, err := conn.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, err = relay.WriteMsgUnix([]byte{'c'}, syscall.UnixRights(int(f.Fd())), nil)
+	return err
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/execagent"
+)
+
+func TestMergeEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		extra    []string
+		expected []string
+	}{
+		{
+			name:     "NoExtra",
+			env:      []string{"HOME=/home/tester", "PATH=/bin"},
+			expected: []string{"HOME=/home/tester", "PATH=/bin"},
+		},
+		{
+			name:     "AddAndReplace",
+			env:      []string{"HOME=/home/tester", "PATH=/bin"},
+			extra:    []string{"PATH=/usr/bin:/bin", "FOO=bar"},
+			expected: []string{"HOME=/home/tester", "PATH=/usr/bin:/bin", "FOO=bar"},
+		},
+		{
+			name:     "LastWins",
+			extra:    []string{"FOO=bar", "FOO=baz", "EMPTY="},
+			expected: []string{"FOO=baz", "EMPTY="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeEnv(tt.env, tt.extra)
+			if strings.Join(merged, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("got %v, expected %v", merged, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExecAgentReaped(t *testing.T) {
+	var nilAgent *execAgent
+	if nilAgent.reaped(1, 0) {
+		t.Errorf("process reported as spawned without agent")
+	}
+
+	a := &execAgent{procs: make(map[int]chan syscall.WaitStatus)}
+	wait := make(chan syscall.WaitStatus, 1)
+	a.procs[42] = wait
+
+	if a.reaped(43, 0) {
+		t.Errorf("unknown process reported as spawned by the agent")
+	}
+	if !a.reaped(42, syscall.WaitStatus(1<<8)) {
+		t.Fatalf("process not reported as spawned by the agent")
+	}
+	if status := <-wait; status.ExitStatus() != 1 {
+		t.Errorf("got exit status %d, expected 1", status.ExitStatus())
+	}
+	if a.reaped(42, 0) {
+		t.Errorf("process reported twice")
+	}
+}
+
+func TestExecAgentSignal(t *testing.T) {
+	var nilAgent *execAgent
+	nilAgent.signal(syscall.SIGTERM)
+
+	cmd := exec.Command("/bin/sleep", "60")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &execAgent{procs: make(map[int]chan syscall.WaitStatus)}
+	a.procs[cmd.Process.Pid] = make(chan syscall.WaitStatus, 1)
+	a.signal(syscall.SIGTERM)
+
+	err := cmd.Wait()
+	if err == nil {
+		t.Fatalf("process exited without signal")
+	}
+	status, ok := err.(*exec.ExitError).Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || status.Signal() != syscall.SIGTERM {
+		t.Errorf("process not terminated by %s: %s", syscall.SIGTERM, err)
+	}
+}
+
+func TestRelayExecAgentConn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec-agent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen(execagent.Network, filepath.Join(dir, execAgentSocket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay, err := fdConn(fds[0], "relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	container, err := fdConn(fds[1], "container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Close()
+
+	uid := uint32(os.Getuid())
+
+	tests := []struct {
+		name     string
+		allowed  map[uint32]bool
+		overflow uint32
+		relayed  bool
+	}{
+		{
+			name:     "Allowed",
+			allowed:  map[uint32]bool{uid: true},
+			overflow: uid + 1,
+			relayed:  true,
+		},
+		{
+			name:     "NotAllowed",
+			allowed:  map[uint32]bool{uid + 1: true},
+			overflow: uid + 2,
+		},
+		{
+			name:     "OverflowUID",
+			allowed:  map[uint32]bool{uid: true},
+			overflow: uid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overflow := filepath.Join(dir, "overflowuid")
+			if err := ioutil.WriteFile(overflow, []byte(fmt.Sprintf("%d\n", tt.overflow)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			defer func(f string) { overflowUIDFile = f }(overflowUIDFile)
+			overflowUIDFile = overflow
+
+			client, err := net.Dial(execagent.Network, filepath.Join(dir, execAgentSocket))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			conn, err := l.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			err = relayExecAgentConn(relay, conn.(*net.UnixConn), tt.allowed)
+			if tt.relayed && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			} else if !tt.relayed && err == nil {
+				t.Fatalf("unexpected success")
+			}
+
+			// the container process receives the client connection
+			// only when the client is allowed
+			container.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			oob := make([]byte, syscall.CmsgSpace(4))
+			_, oobn, _, _, err := container.ReadMsgUnix(make([]byte, 1), oob)
+			if !tt.relayed {
+				if err == nil {
+					t.Errorf("connection of a refused client relayed")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("connection not relayed: %s", err)
+			}
+
+			msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err != nil || len(msgs) != 1 {
+				t.Fatalf("no file descriptor relayed: %v", err)
+			}
+			rfds, err := syscall.ParseUnixRights(&msgs[0])
+			if err != nil || len(rfds) != 1 {
+				t.Fatalf("no file descriptor relayed: %v", err)
+			}
+			relayed, err := fdConn(rfds[0], "relayed")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer relayed.Close()
+
+			// the relayed connection is the client connection
+			if _, err := client.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 4)
+			relayed.SetReadDeadline(time.Now().Add(time.Second))
+			if n, err := relayed.Read(b); err != nil || string(b[:n]) != "ping" {
+				t.Errorf("unexpected data from relayed connection: %q %v", b[:n], err)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+)
+
+const (
+	// maxHealthOutput is the maximum size of the healthcheck
+	// output kept in the instance file
+	maxHealthOutput = 4096
+	// restartGracePeriod is the time given to an unhealthy instance
+	// to stop before being killed when restarted
+	restartGracePeriod = 10 * time.Second
+)
+
+// healthcheck periodically runs the image healthcheck of an instance
+// from the master process and records its status in the instance file.
+type healthcheck struct {
+	sync.Mutex
+
+	file    *instance.File
+	pid     int
+	pw      *user.User
+	config  *instance.HealthConfig
+	action  *instance.HealthAction
+	stopped bool
+	restart bool
+}
+
+// readContainerFile reads a file of the container filesystem through
+// the container process root directory. The file is read with the
+// credentials of the master process and never with escalated privileges:
+// absolute symbolic links of the container resolve against the host root.
+func readContainerFile(pid int, path string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "root", path))
+}
+
+// startHealthcheck sets up the healthcheck of the instance if its image
+// provides one, the check starts once the instance file is written.
+func (e *EngineOperations) startHealthcheck(file *instance.File, pid int, pw *user.User) error {
+	if e.EngineConfig.GetNoHealthcheck() {
+		return nil
+	}
+
+	if _, err := readContainerFile(pid, instance.HealthcheckScript); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("while reading healthcheck script: %s", err)
+	}
+
+	data, err := readContainerFile(pid, instance.HealthcheckConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("while reading healthcheck parameters: %s", err)
+	}
+	config, err := instance.ReadHealthConfig(data)
+	if err != nil {
+		return err
+	}
+	action, err := instance.ParseHealthAction(e.EngineConfig.GetHealthOnFailure())
+	if err != nil {
+		return err
+	}
+
+	file.Health = &instance.Health{Status: instance.HealthStarting}
+	e.healthcheck = &healthcheck{
+		file:   file,
+		pid:    pid,
+		pw:     pw,
+		config: config,
+		action: action,
+	}
+	sylog.Debugf("Instance healthcheck every %s with %d retries", config.Interval, config.Retries)
+
+	return nil
+}
+
+// run executes the healthcheck every interval until stop is called.
+func (h *healthcheck) run() {
+	start := time.Now()
+
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !h.check(time.Since(start) < h.config.StartPeriod) {
+			return
+		}
+	}
+}
+
+// check executes the healthcheck once and updates the instance health,
+// failures don't count during the start period. It returns false once
+// the healthcheck is stopped.
+func (h *healthcheck) check(starting bool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	res, err := execInstance(ctx, h.file.Name, h.pw, []string{instance.HealthcheckScript})
+	timeout := ctx.Err() == context.DeadlineExceeded
+	cancel()
+
+	h.Lock()
+	defer h.Unlock()
+
+	if h.stopped {
+		return false
+	}
+
+	health := h.file.Health
+	health.LastCheck = time.Now()
+
+	switch {
+	case timeout:
+		health.LastExitCode = -1
+		health.LastOutput = fmt.Sprintf("healthcheck timed out after %s", h.config.Timeout)
+	case err != nil:
+		health.LastExitCode = -1
+		health.LastOutput = err.Error()
+	default:
+		health.LastExitCode = res.ExitCode
+		if len(res.Output) > maxHealthOutput {
+			res.Output = res.Output[:maxHealthOutput]
+		}
+		health.LastOutput = string(res.Output)
+	}
+
+	unhealthy := false
+	if health.LastExitCode == 0 {
+		health.Status = instance.Healthy
+		health.FailingStreak = 0
+	} else if !starting || health.Status != instance.HealthStarting {
+		health.FailingStreak++
+		if health.FailingStreak >= h.config.Retries && health.Status != instance.Unhealthy {
+			sylog.Warningf("Instance is unhealthy after %d failed healthchecks: %s", health.FailingStreak, health.LastOutput)
+			health.Status = instance.Unhealthy
+			unhealthy = true
+		}
+	}
+
+	if err := h.file.Update(); err != nil {
+		sylog.Warningf("Could not update instance health: %s", err)
+	}
+
+	if unhealthy && h.action != nil {
+		return h.onFailure()
+	}
+	return true
+}
+
+// onFailure signals or stops the unhealthy instance to restart it. It
+// returns false if the healthcheck doesn't continue.
+func (h *healthcheck) onFailure() bool {
+	if h.action.Signal != 0 {
+		sylog.Infof("Sending %s to unhealthy instance", h.action.Signal)
+		if err := syscall.Kill(h.pid, h.action.Signal); err != nil {
+			sylog.Warningf("Could not signal instance process: %s", err)
+		}
+		return true
+	}
+
+	sylog.Infof("Restarting unhealthy instance")
+	h.restart = true
+	h.stopped = true
+
+	pid := h.pid
+	go func() {
+		syscall.Kill(pid, syscall.SIGTERM)
+		time.Sleep(restartGracePeriod)
+		// the master process exits with the instance
+		syscall.Kill(pid, syscall.SIGKILL)
+	}()
+	return false
+}
+
+// stop stops the healthcheck and returns true if the instance
+// must be restarted.
+func (h *healthcheck) stop() bool {
+	h.Lock()
+	defer h.Unlock()
+
+	h.stopped = true
+	return h.restart
+}
+
+// restartInstance starts the instance again with the command line and
+// the environment of the command which started it.
+func (e *EngineOperations) restartInstance() error {
+	args, env := e.EngineConfig.GetStartCommand()
+	if len(args) < 2 {
+		return fmt.Errorf("could not restart instance: unknown start command")
+	}
+
+	pw, err := user.CurrentOriginal()
+	if err != nil {
+		return err
+	}
+
+	singularity := filepath.Join(buildcfg.BINDIR, "singularity")
+	cmd := exec.Command(singularity, args[1:]...)
+	cmd.Dir = e.EngineConfig.GetCwd()
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// never start the instance with the master process privileges
+	if os.Geteuid() == 0 && pw.UID != 0 {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: pw.UID, Gid: pw.GID}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not restart instance: %s", err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/priv"
+	"github.com/sylabs/singularity/pkg/util/idmap"
+	"golang.org/x/sys/unix"
+)
+
+// idmapMount bind mounts source on dest with the ownership of files
+// mapped through a user namespace dedicated to idmapped mounts. It
+// returns false if the bind mount must be done the usual way.
+//
+// The container user namespace is never used for the mappings, with
+// fakeroot it maps the container root user to the user, files owned
+// by root would then appear owned by the user and files created by the
+// user would be owned by root on the host. The dedicated user namespace
+// only maps the user and group IDs to themselves.
+func (c *container) idmapMount(source, dest string, flags uintptr) bool {
+	if c.idmapUserNS == nil {
+		ns, err := idmap.NewUserNamespace(os.Getuid(), os.Getgid())
+		if err != nil {
+			sylog.Verbosef("Not using idmapped mounts: %s", err)
+			c.idmapBinds = nil
+			return false
+		}
+		c.idmapUserNS = ns
+	}
+
+	err := c.rpcOps.IdmapMount(source, dest, flags, c.idmapUserNS.Path)
+	if err == syscall.EPERM || err == syscall.EACCES {
+		// the RPC server doesn't have privileges in the user
+		// namespace owning the source filesystem when it runs
+		// in the container user namespace
+		err = c.stagedIdmapMount(source, dest, flags)
+	}
+	if err == nil {
+		sylog.Debugf("Mounted %s to %s with idmapped mount", source, dest)
+		return true
+	}
+
+	sylog.Verbosef("Could not use idmapped mount for %s, fallback to bind mount: %s", source, err)
+
+	// without privileges or kernel support no other idmapped
+	// mount will succeed, other errors are often due to the
+	// source filesystem not supporting them
+	if err == syscall.EPERM || err == syscall.ENOSYS {
+		c.idmapBinds = nil
+	}
+	return false
+}
+
+// closeIdmapUserNS releases the user namespace dedicated to idmapped
+// mounts once all mounts are done.
+func (c *container) closeIdmapUserNS() {
+	if c.idmapUserNS == nil {
+		return
+	}
+	if err := c.idmapUserNS.Close(); err != nil {
+		sylog.Debugf("While releasing idmapped mounts user namespace: %s", err)
+	}
+	c.idmapUserNS = nil
+}
+
+// stagedIdmapMount creates the idmapped mount from the master process,
+// with the setuid workflow it escalates privileges to create it in the
+// host user namespace. The mount is attached to a staging directory of
+// the session directory, it propagates to the container mount namespace,
+// a slave of the master mount namespace, where the RPC server bind mounts
+// it on dest.
+func (c *container) stagedIdmapMount(source, dest string, flags uintptr) error {
+	c.idmapStaged++
+	staging := filepath.Join(c.session.Path(), fmt.Sprintf("idmap-%d", c.idmapStaged))
+	if _, err := c.rpcOps.Mkdir(staging, 0700); err != nil {
+		return fmt.Errorf("while creating staging directory: %s", err)
+	}
+
+	if err := masterIdmapMount(source, staging, c.idmapUserNS.Path, flags&syscall.MS_REC != 0); err != nil {
+		return err
+	}
+	// the staged mount is not needed anymore once bind mounted,
+	// its removal from the master mount namespace propagates to
+	// the container mount namespace
+	defer masterUnmount(staging)
+
+	// a bind mount of an idmapped mount keeps its ID mappings
+	return c.rpcOps.Mount(staging, dest, "", syscall.MS_BIND|flags&syscall.MS_REC, "")
+}
+
+// masterIdmapMount attaches an idmapped bind mount of source to target
+// in the master mount namespace.
+func masterIdmapMount(source, target, userns string, recursive bool) error {
+	// escalation fails with the unprivileged workflow, the
+	// privileges are kept for root
+	if os.Geteuid() != 0 {
+		err := priv.Escalate()
+		defer priv.Drop()
+		if err != nil {
+			return syscall.EPERM
+		}
+	}
+
+	// source is looked up with the user filesystem credentials
+	// as any other user bind mount, privileges are only required
+	// to create the mount
+	unix.Setfsuid(os.Getuid())
+	unix.Setfsgid(os.Getgid())
+
+	tree, err := idmap.OpenTree(source, userns, recursive)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(tree)
+
+	return idmap.MoveMount(tree, target)
+}
+
+// masterUnmount detaches the mount target from the master mount namespace.
+func masterUnmount(target string) {
+	if os.Geteuid() != 0 {
+		err := priv.Escalate()
+		defer priv.Drop()
+		if err != nil {
+			return
+		}
+	}
+	if err := syscall.Unmount(target, syscall.MNT_DETACH); err != nil {
+		sylog.Debugf("Could not unmount %s: %s", target, err)
+	}
+}
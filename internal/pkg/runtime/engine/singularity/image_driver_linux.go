@@ -0,0 +1,69 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/plugin"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+// loadImageDriver loads the installed plugins and returns the image
+// driver registered with name.
+func loadImageDriver(name string) (image.Driver, error) {
+	if err := plugin.InitializeAll(buildcfg.LIBEXECDIR); err != nil {
+		return nil, fmt.Errorf("while loading plugins: %s", err)
+	}
+	driver := image.GetDriver(name)
+	if driver == nil {
+		return nil, fmt.Errorf("image driver %q not found, is the plugin providing it installed and enabled?", name)
+	}
+	sylog.Debugf("Using image driver %s", name)
+	return driver, nil
+}
+
+// useImageDriver returns true if the configured image driver mounts
+// the filesystem fstype.
+func (c *container) useImageDriver(fstype string) bool {
+	if c.imageDriver == nil {
+		return false
+	}
+	feature := image.FilesystemFeature(fstype)
+	return feature != 0 && c.imageDriver.Features()&feature != 0
+}
+
+// mountImageDriver mounts a filesystem with the configured image driver,
+// mounted targets are passed to the driver Unmount during container
+// cleanup. The image is passed with its file descriptor path, the image
+// path could have been replaced since it was opened and checked.
+func (c *container) mountImageDriver(params *image.MountParams) error {
+	sylog.Debugf("Mounting %s image %s to %s with image driver %s", params.Filesystem, params.Source, params.Target, c.engine.EngineConfig.File.ImageDriver)
+
+	if err := c.imageDriver.Mount(params, c.rpcOps.Mount); err != nil {
+		return fmt.Errorf("image driver %s failed to mount %s: %s", c.engine.EngineConfig.File.ImageDriver, params.Target, err)
+	}
+	c.engine.EngineConfig.ImageDriverMounts = append(c.engine.EngineConfig.ImageDriverMounts, params.Target)
+
+	return nil
+}
+
+// cleanupImageDriver notifies the image driver that its mounts are gone,
+// the driver was loaded in this process by CreateContainer.
+func cleanupImageDriver(name string, targets []string) error {
+	driver := image.GetDriver(name)
+	if driver == nil {
+		return fmt.Errorf("image driver %q not found", name)
+	}
+	for _, target := range targets {
+		if err := driver.Unmount(target); err != nil {
+			return fmt.Errorf("image driver %s failed to unmount %s: %s", name, target, err)
+		}
+	}
+	return nil
+}
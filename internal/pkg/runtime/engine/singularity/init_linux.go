@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// setChildSubreaper marks the current process as a child subreaper,
+// so it becomes the parent of orphaned descendant processes and is
+// able to reap them like the init process of a PID namespace does.
+func setChildSubreaper() error {
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set child subreaper: %s", err)
+	}
+	return nil
+}
+
+// isShutdownSignal returns if signal requests the shutdown of an instance.
+func isShutdownSignal(signal syscall.Signal) bool {
+	switch signal {
+	case syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGPWR:
+		return true
+	}
+	return false
+}
+
+// exitStatus returns the shell-like exit code corresponding to status.
+func exitStatus(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
+
+// exitInstance is called by sinit once all instance processes exited after
+// a shutdown request, it exits with the exit code of the instance main
+// process and reports how many other processes were reaped.
+func exitInstance(statusChan <-chan syscall.WaitStatus, errChan <-chan error, reaped int) {
+	code := 0
+
+	select {
+	case status := <-statusChan:
+		code = exitStatus(status)
+	case err := <-errChan:
+		// main process was waited by the command goroutine
+		if e, ok := err.(*exec.ExitError); ok {
+			if status, ok := e.Sys().(syscall.WaitStatus); ok {
+				code = exitStatus(status)
+			}
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sylog.Infof("Instance shutdown complete, main process exited with status %d, %d other process(es) reaped", code, reaped)
+	os.Exit(code)
+}
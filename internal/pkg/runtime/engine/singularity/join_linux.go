@@ -0,0 +1,193 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// joinNamespaceType maps the namespaces accepted by --join-ns
+// to their OCI type.
+var joinNamespaceType = map[string]specs.LinuxNamespaceType{
+	"net":   specs.NetworkNamespace,
+	"ipc":   specs.IPCNamespace,
+	"uts":   specs.UTSNamespace,
+	"mount": specs.MountNamespace,
+	"pid":   specs.PIDNamespace,
+}
+
+// joinMountNamespace returns if the container joins the mount namespace
+// of another process. The command then runs in the filesystem of that
+// process and no container is created from the image.
+func (e *EngineOperations) joinMountNamespace() bool {
+	join := e.EngineConfig.GetJoin()
+	if join == nil {
+		return false
+	}
+	for _, ns := range join.Namespaces {
+		if ns == "mount" {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareJoinConfig is responsible for checking the process whose
+// namespaces are joined and passing those namespaces to the starter.
+func (e *EngineOperations) prepareJoinConfig(starterConfig *starter.Config) error {
+	join := e.EngineConfig.GetJoin()
+
+	uid := os.Getuid()
+
+	// like for instances, namespaces are opened relative to
+	// the /proc/<pid> directory to not be tricked by a process
+	// exiting and its PID being reused during checks
+	if join.Pid <= 1 {
+		return fmt.Errorf("bad process ID %d to join", join.Pid)
+	}
+	path := filepath.Join("/proc", strconv.Itoa(join.Pid))
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return fmt.Errorf("could not open proc directory %s: %s", path, err)
+	}
+	if err := mainthread.Fchdir(fd); err != nil {
+		return err
+	}
+	starterConfig.SetWorkingDirectoryFd(fd)
+
+	// with the setuid workflow, users can only join the namespaces
+	// of their instances, processes are checked like when joining
+	// an instance
+	if uid != 0 && starterConfig.GetIsSUID() {
+		if err := checkInstanceProcess(uid, os.Getgid(), 0); err != nil {
+			return err
+		}
+		if err := checkSinitProcess(); err != nil {
+			return err
+		}
+	}
+
+	// users can only join namespaces of their own processes
+	if uid != 0 {
+		fi, err := os.Stat("task")
+		if err != nil {
+			return fmt.Errorf("error while getting information for process %d: %s", join.Pid, err)
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		if st.Uid != uint32(uid) {
+			return fmt.Errorf("process %d owned by %d instead of %d", join.Pid, st.Uid, uid)
+		}
+	}
+
+	// a process running in a user namespace can only be joined
+	// from the same user namespace
+	self, err := os.Stat("/proc/self/ns/user")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not read user namespace: %s", err)
+	} else if err == nil {
+		target, err := os.Stat("ns/user")
+		if err != nil {
+			return fmt.Errorf("could not read user namespace of process %d: %s", join.Pid, err)
+		}
+		if !os.SameFile(self, target) {
+			if starterConfig.GetIsSUID() {
+				return fmt.Errorf("process %d runs in a user namespace, joining it requires --userns", join.Pid)
+			}
+			e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(specs.UserNamespace, "ns/user")
+			if err := starterConfig.SetNsPath(specs.UserNamespace, "ns/user"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// only namespaces set here are joined, namespace paths found
+	// in the engine configuration are never passed to the starter
+	for _, ns := range join.Namespaces {
+		t, ok := joinNamespaceType[ns]
+		if !ok {
+			return fmt.Errorf("unknown namespace %s to join", ns)
+		}
+		nspath := filepath.Join("ns", nsProcName[t])
+		sylog.Debugf("Joining %s namespace of process %d", ns, join.Pid)
+		e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(string(t), nspath)
+		if err := starterConfig.SetNsPath(t, nspath); err != nil {
+			return err
+		}
+	}
+
+	if !e.joinMountNamespace() {
+		return nil
+	}
+
+	// the command is executed from the instance image filesystem
+	// instead of the container image
+	if err := e.checkJoinImage(join, starterConfig.GetIsSUID()); err != nil {
+		return err
+	}
+
+	// without container creation, the starter only enters the
+	// namespaces and executes the command in the process filesystem
+	starterConfig.SetNamespaceJoinOnly(true)
+
+	if uid == 0 {
+		if err := e.prepareRootCaps(); err != nil {
+			return err
+		}
+	} else {
+		if err := e.prepareUserCaps(starterConfig.GetIsSUID()); err != nil {
+			return err
+		}
+		e.EngineConfig.OciConfig.Process.NoNewPrivileges = true
+	}
+
+	return nil
+}
+
+// checkJoinImage checks the image of the instance whose mount namespace
+// is joined against the execution control list. When the list is
+// activated, only the mount namespace of instances can be joined.
+func (e *EngineOperations) checkJoinImage(join *singularityConfig.JoinConfig, suid bool) error {
+	ecl, err := loadExecutionControl(suid)
+	if err != nil {
+		return err
+	}
+	if !ecl.Activated {
+		return nil
+	}
+	if join.Instance == "" {
+		return fmt.Errorf("joining the mount namespace of process %d not allowed by the execution control list, join its instance instead", join.Pid)
+	}
+
+	file, err := instance.Get(join.Instance, instance.SingSubDir)
+	if err != nil {
+		return err
+	}
+	if file.Pid != join.Pid {
+		return fmt.Errorf("process %d is not the process of instance %s", join.Pid, join.Instance)
+	}
+
+	instanceEngineConfig := singularityConfig.NewConfig()
+	instanceConfig := &config.Common{
+		EngineConfig: instanceEngineConfig,
+	}
+	if err := json.Unmarshal(file.Config, instanceConfig); err != nil {
+		return err
+	}
+	return e.checkInstanceImage(instanceEngineConfig.GetImage(), suid)
+}
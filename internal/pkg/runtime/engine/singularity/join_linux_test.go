@@ -0,0 +1,108 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+)
+
+func init() {
+	// serve functions executed in main thread by checks
+	go func() {
+		for f := range mainthread.FuncChannel {
+			f()
+		}
+	}()
+}
+
+// startProcess starts a process named name and changes the current
+// working directory to its /proc directory, the returned function
+// restores the working directory and kills the process.
+func startProcess(t *testing.T, name string) func() {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("sleep not found: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "join-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the process name is the base name of its executable
+	b, err := ioutil.ReadFile(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(bin, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bin, "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(fmt.Sprintf("/proc/%d", cmd.Process.Pid)); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(cwd)
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCheckSinitProcess(t *testing.T) {
+	tests := []struct {
+		name    string
+		process string
+		wantErr bool
+	}{
+		{name: "Sinit", process: "sinit"},
+		{name: "OtherProcess", process: "sleep", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer startProcess(t, tt.process)()
+
+			err := checkSinitProcess()
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success for process %s", tt.process)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error for process %s: %s", tt.process, err)
+			}
+		})
+	}
+}
+
+func TestCheckInstanceProcess(t *testing.T) {
+	defer startProcess(t, "sinit")()
+
+	uid, gid := os.Getuid(), os.Getgid()
+
+	// the root link of instance processes started with the setuid
+	// workflow is not readable by their owner, a process started by
+	// the user is not an instance process
+	if err := checkInstanceProcess(uid, gid, 0); err == nil {
+		t.Errorf("unexpected success with a process started by the user")
+	}
+	// processes of other users are never joined
+	if err := checkInstanceProcess(uid+1, gid+1, 0); err == nil {
+		t.Errorf("unexpected success with a process of another user")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// structuredLog returns if the instance output is written to a
+// structured log by the master process.
+func (e *EngineOperations) structuredLog() bool {
+	return e.EngineConfig.GetInstance() && e.EngineConfig.GetLogFormat() != ""
+}
+
+// prepareLogStreams creates the pipes carrying the output and error
+// streams of the instance process to the master process logger.
+func (e *EngineOperations) prepareLogStreams(starterConfig *starter.Config) error {
+	e.EngineConfig.SetLogStreams([2]int{-1, -1}, [2]int{-1, -1})
+
+	if !e.structuredLog() {
+		return nil
+	}
+
+	format := e.EngineConfig.GetLogFormat()
+	if _, ok := instance.LogFormats[format]; !ok {
+		return fmt.Errorf("log format %s is not supported", format)
+	}
+
+	var streams [2][2]int
+
+	for i := range streams {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("could not create log pipe: %s", err)
+		}
+		streams[i] = [2]int{int(r.Fd()), int(w.Fd())}
+		for _, fd := range streams[i] {
+			if err := starterConfig.KeepFileDescriptor(fd); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.EngineConfig.SetLogStreams(streams[0], streams[1])
+	return nil
+}
+
+// redirectLogStreams replaces the output and error streams of the
+// instance process by the pipes read by the master process logger.
+func (e *EngineOperations) redirectLogStreams() error {
+	if !e.structuredLog() {
+		return nil
+	}
+
+	stdout, stderr := e.EngineConfig.GetLogStreams()
+
+	for _, s := range []struct {
+		fds [2]int
+		std int
+	}{
+		{stdout, int(os.Stdout.Fd())},
+		{stderr, int(os.Stderr.Fd())},
+	} {
+		if err := syscall.Dup3(s.fds[1], s.std, 0); err != nil {
+			return fmt.Errorf("could not redirect instance stream: %s", err)
+		}
+		if err := syscall.Close(s.fds[1]); err != nil {
+			return err
+		}
+		if err := syscall.Close(s.fds[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startLogger writes the output and error streams of the instance
+// process to the instance structured log from the master process.
+func (e *EngineOperations) startLogger(name string) error {
+	if !e.structuredLog() {
+		return nil
+	}
+
+	stdout, stderr := e.EngineConfig.GetLogStreams()
+
+	// only the instance process writes to the pipes
+	for _, fd := range []int{stdout[1], stderr[1]} {
+		if err := syscall.Close(fd); err != nil {
+			return fmt.Errorf("could not close log pipe: %s", err)
+		}
+	}
+
+	path, err := instance.GetLogPath(name, instance.LogSubDir)
+	if err != nil {
+		return err
+	}
+	logger, err := instance.NewLogger(path, instance.LogFormats[e.EngineConfig.GetLogFormat()])
+	if err != nil {
+		return fmt.Errorf("could not open instance log: %s", err)
+	}
+	if maxSize, maxFiles := e.EngineConfig.GetLogRotation(); maxSize > 0 {
+		logger.SetRotation(maxSize, maxFiles)
+	}
+
+	for _, s := range []struct {
+		stream string
+		fd     int
+	}{
+		{"stdout", stdout[0]},
+		{"stderr", stderr[0]},
+	} {
+		w, err := logger.NewWriter(s.stream, true)
+		if err != nil {
+			logger.Close()
+			return err
+		}
+		r := os.NewFile(uintptr(s.fd), s.stream+"-stream")
+		go func() {
+			if _, err := io.Copy(w, r); err != nil && err != io.ErrClosedPipe {
+				sylog.Debugf("While copying instance stream to log: %s", err)
+			}
+			w.Close()
+			r.Close()
+		}()
+	}
+
+	e.logger = logger
+	return nil
+}
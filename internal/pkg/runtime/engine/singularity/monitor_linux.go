@@ -8,7 +8,10 @@ package singularity
 import (
 	"fmt"
 	"os"
+	"sync/atomic"
 	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
 )
 
 // MonitorContainer monitors a container.
@@ -17,14 +20,28 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 
 	for {
 		s := <-signals
-		switch s {
-		case syscall.SIGCHLD:
+		switch {
+		case s == syscall.SIGCHLD:
 			if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err != nil {
 				return status, fmt.Errorf("error while waiting child: %s", err)
 			} else if wpid != pid {
 				continue
 			}
+			// the placeholder process of a restored instance exited,
+			// monitor the restored process tree instead
+			if rpid := int(atomic.LoadInt32(&e.restoredPid)); rpid != 0 && rpid != pid {
+				pid = rpid
+				if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err != nil || wpid != pid {
+					continue
+				}
+			}
 			return status, nil
+		case s == instance.CheckpointSignal && e.EngineConfig.GetInstance():
+			e.checkpointInstance(pid)
+			// SIGCHLD may have been dropped during the checkpoint
+			if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err == nil && wpid == pid {
+				return status, nil
+			}
 		default:
 			if e.EngineConfig.GetSignalPropagation() {
 				if err := syscall.Kill(pid, s.(syscall.Signal)); err != nil {
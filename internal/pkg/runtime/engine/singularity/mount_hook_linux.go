@@ -0,0 +1,62 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/plugin"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+// loadMountHooks loads the installed plugins if plugin mount hooks are
+// enabled in singularity.conf and returns true if some of them registered
+// mount hooks.
+func loadMountHooks(enabled bool) bool {
+	if !enabled {
+		return false
+	}
+	if err := plugin.InitializeAll(buildcfg.LIBEXECDIR); err != nil {
+		sylog.Warningf("Plugin mount hooks disabled, while loading plugins: %s", err)
+		return false
+	}
+	hooks := plugin.HasMountHooks()
+	if hooks {
+		sylog.Debugf("Calling plugin mount hooks for container mounts")
+	}
+	return hooks
+}
+
+// mountWithHooks mounts point once accepted by the plugin pre-mount
+// hooks, which may have rewritten it, and calls the plugin post-mount
+// hooks once mounted.
+func (c *container) mountWithHooks(point *mount.Point) error {
+	spec := &pluginapi.MountSpec{
+		Source:      point.Source,
+		Destination: point.Destination,
+		Type:        point.Type,
+		Options:     append([]string{}, point.Options...),
+	}
+	if err := plugin.PreMountHooks(spec); err != nil {
+		return fmt.Errorf("mount of %s to %s denied: %s", point.Source, point.Destination, err)
+	}
+
+	if spec.Source != point.Source || spec.Destination != point.Destination {
+		sylog.Debugf("Mount of %s to %s rewritten by plugin to %s to %s", point.Source, point.Destination, spec.Source, spec.Destination)
+	}
+	point.Source = spec.Source
+	point.Destination = spec.Destination
+	point.Type = spec.Type
+	point.Options = spec.Options
+
+	if err := c.mountPoint(point); err != nil {
+		return err
+	}
+	return plugin.PostMountHooks(spec)
+}
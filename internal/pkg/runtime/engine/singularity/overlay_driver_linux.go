@@ -0,0 +1,228 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	fsoverlay "github.com/sylabs/singularity/internal/pkg/util/fs/overlay"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/util/fs/proc"
+	"golang.org/x/sys/unix"
+)
+
+// overlayDriver identifies the filesystem implementation used to mount
+// the overlay session layer and the overlay images.
+type overlayDriver string
+
+const (
+	// noOverlay means overlay is not available, the session layout
+	// falls back to underlay or to the default layout
+	noOverlay overlayDriver = ""
+	// kernelOverlay mounts overlay with the kernel overlay filesystem
+	kernelOverlay overlayDriver = "overlay"
+	// fuseOverlay mounts overlay with the fuse-overlayfs helper, it's
+	// only used with user namespace when kernel overlay can't be mounted
+	fuseOverlay overlayDriver = "fuse-overlayfs"
+)
+
+// userNSOverlayKernel is the first kernel release allowing unprivileged
+// overlay mounts from a user namespace.
+var userNSOverlayKernel = [2]int{5, 11}
+
+// probeOverlayDriver returns the overlay driver usable to mount img as
+// an overlay lower directory, kernel overlay is preferred over
+// fuse-overlayfs, noOverlay is returned if none are available.
+func (c *container) probeOverlayDriver(img *image.Image) (overlayDriver, error) {
+	switch c.engine.EngineConfig.File.EnableOverlay {
+	case "yes", "try":
+	default:
+		sylog.Debugf("Could not use overlay, disabled by configuration")
+		return noOverlay, nil
+	}
+
+	err := c.probeKernelOverlay(img)
+	if err == nil {
+		sylog.Debugf("Overlay seems supported and allowed by kernel")
+		return kernelOverlay, nil
+	} else if !fsoverlay.IsIncompatible(err) && !isOverlayUnsupported(err) {
+		return noOverlay, err
+	}
+	sylog.Debugf("Could not use kernel overlay: %s", err)
+
+	fuseErr := c.probeFuseOverlay()
+	if fuseErr == nil {
+		sylog.Verbosef("Kernel overlay not available, using fuse-overlayfs")
+		return fuseOverlay, nil
+	}
+	sylog.Debugf("Could not use fuse-overlayfs: %s", fuseErr)
+
+	if fsoverlay.IsIncompatible(err) {
+		// a warning message would be better but on some systems it
+		// could annoy users, make it verbose instead
+		sylog.Verbosef("Fallback to underlay: %s", err)
+	}
+	return noOverlay, nil
+}
+
+// overlayUnsupportedError is returned by probeKernelOverlay when the
+// kernel doesn't allow to mount overlay.
+type overlayUnsupportedError struct {
+	reason string
+}
+
+func (e *overlayUnsupportedError) Error() string {
+	return e.reason
+}
+
+func isOverlayUnsupported(err error) bool {
+	_, ok := err.(*overlayUnsupportedError)
+	return ok
+}
+
+// probeKernelOverlay checks if the kernel overlay filesystem can be
+// mounted with img as lower directory.
+func (c *container) probeKernelOverlay(img *image.Image) error {
+	// on ubuntu until 4.15 kernel it was possible to mount overlay
+	// with the current workflow, since 4.18 we get an operation not
+	// permitted, overlay is officially allowed in user namespace
+	// since 5.11
+	if c.userNS && !kernelAtLeast(userNSOverlayKernel[0], userNSOverlayKernel[1]) {
+		return &overlayUnsupportedError{
+			fmt.Sprintf("overlay in user namespace requires a kernel >= %d.%d", userNSOverlayKernel[0], userNSOverlayKernel[1]),
+		}
+	}
+
+	// this mount always returns an error, if an invalid argument error
+	// is returned, overlay is supported and is allowed
+	if err := c.rpcOps.Mount("none", "/", "overlay", syscall.MS_SILENT, ""); err != syscall.EINVAL {
+		return &overlayUnsupportedError{"overlay seems not supported and/or not allowed by kernel"}
+	}
+
+	// previous mount forced overlay module to be loaded, check if we find
+	// it in /proc/filesystems
+	if has, _ := proc.HasFilesystem("overlay"); !has {
+		return &overlayUnsupportedError{"overlay filesystem not found in /proc/filesystems"}
+	}
+
+	// before using overlay we check if the sandbox image is
+	// compatible as an overlay lower directory
+	if img.Type == image.SANDBOX {
+		if err := fsoverlay.CheckLower(img.Path); err != nil {
+			if fsoverlay.IsIncompatible(err) {
+				return err
+			}
+			return fmt.Errorf("while checking image compatibility with overlay: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// probeFuseOverlay checks if fuse-overlayfs can be used, the helper is
+// only executed with user namespace to never run a program found in the
+// user PATH with privileges.
+func (c *container) probeFuseOverlay() error {
+	if !c.userNS {
+		return fmt.Errorf("fuse-overlayfs is only used with user namespace")
+	}
+	if !c.engine.EngineConfig.File.EnableFusemount {
+		return fmt.Errorf("FUSE mounts are disabled by configuration")
+	}
+	if err := unix.Access("/dev/fuse", unix.R_OK|unix.W_OK); err != nil {
+		return fmt.Errorf("/dev/fuse is not accessible: %s", err)
+	}
+	if _, err := exec.LookPath("fuse-overlayfs"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// mountFuseOverlay mounts an overlay point at dest with fuse-overlayfs,
+// the helper is terminated during container cleanup.
+func (c *container) mountFuseOverlay(dest string, flags uintptr, opts string) error {
+	fuseOverlayfs, err := exec.LookPath("fuse-overlayfs")
+	if err != nil {
+		return err
+	}
+
+	program := []string{fuseOverlayfs, "-o", opts}
+
+	sylog.Debugf("Mounting overlay to %s with fuse-overlayfs", dest)
+
+	conn, pid, err := c.rpcOps.MountFuse(program, dest, flags, "", os.Getuid(), os.Getgid())
+	if err != nil {
+		return fmt.Errorf("while mounting overlay with fuse-overlayfs: %s", err)
+	}
+	c.engine.EngineConfig.FuseConnections = append(c.engine.EngineConfig.FuseConnections, conn)
+	c.engine.EngineConfig.FusePids = append(c.engine.EngineConfig.FusePids, pid)
+
+	return nil
+}
+
+// checkOverlayLower checks if the directory dir is usable as an overlay
+// lower directory, fuse-overlayfs doesn't have kernel overlay filesystem
+// restrictions.
+func (c *container) checkOverlayLower(dir string) error {
+	if c.overlayDriver == fuseOverlay {
+		return nil
+	}
+	return fsoverlay.CheckLower(dir)
+}
+
+// checkOverlayUpper checks if the directory dir is usable as an overlay
+// upper directory, fuse-overlayfs doesn't have kernel overlay filesystem
+// restrictions.
+func (c *container) checkOverlayUpper(dir string) error {
+	if c.overlayDriver == fuseOverlay {
+		return nil
+	}
+	return fsoverlay.CheckUpper(dir)
+}
+
+// kernelAtLeast returns true if the running kernel release is greater
+// or equal to major.minor.
+func kernelAtLeast(major, minor int) bool {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return false
+	}
+	release := uts.Release[:]
+	if i := bytes.IndexByte(release, 0); i >= 0 {
+		release = release[:i]
+	}
+	return releaseAtLeast(string(release), major, minor)
+}
+
+// releaseAtLeast returns true if the kernel release string is greater or
+// equal to major.minor.
+func releaseAtLeast(release string, major, minor int) bool {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return false
+	}
+	kmajor, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	// strip suffix of releases like 5.11-rc1
+	digits := fields[1]
+	if i := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		digits = digits[:i]
+	}
+	kminor, err := strconv.Atoi(digits)
+	if err != nil {
+		return false
+	}
+	return kmajor > major || (kmajor == major && kminor >= minor)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"golang.org/x/sys/unix"
+)
+
+// overflowUIDFile holds the user ID reported for users not mapped in
+// the user namespace of the process reading the client credentials.
+var overflowUIDFile = "/proc/sys/kernel/overflowuid"
+
+// checkPeerUID checks that the user ID of the client connected with
+// conn is allowed. Users not mapped in the user namespace of the master
+// process are all reported with the overflow user ID and are never
+// allowed.
+func checkPeerUID(conn *net.UnixConn, allowed map[uint32]bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+
+	err = rc.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return fmt.Errorf("while getting client credentials: %s", err)
+	}
+
+	if cred.Uid == overflowUID() {
+		return fmt.Errorf("user not mapped in the instance user namespace")
+	}
+	if !allowed[cred.Uid] {
+		return fmt.Errorf("user %d not allowed", cred.Uid)
+	}
+	return nil
+}
+
+// ownerUIDs returns the user IDs of the instance owner pw allowed to
+// connect to the instance sockets, the master process runs with the owner
+// credentials, or the owner is known by its original user ID.
+func ownerUIDs(pw *user.User) map[uint32]bool {
+	return map[uint32]bool{
+		pw.UID:              true,
+		uint32(os.Getuid()): true,
+	}
+}
+
+// overflowUID returns the overflow user ID.
+func overflowUID() uint32 {
+	b, err := ioutil.ReadFile(overflowUIDFile)
+	if err != nil {
+		return 65534
+	}
+	uid, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return 65534
+	}
+	return uint32(uid)
+}
@@ -18,12 +18,14 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
 	fakerootutil "github.com/sylabs/singularity/internal/pkg/fakeroot"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/starter"
 	"github.com/sylabs/singularity/internal/pkg/security"
 	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
+	"github.com/sylabs/singularity/internal/pkg/security/selinux"
 	"github.com/sylabs/singularity/internal/pkg/syecl"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
@@ -31,11 +33,18 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/image"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/syfs"
+	"github.com/sylabs/singularity/pkg/util/bind"
 	"github.com/sylabs/singularity/pkg/util/capabilities"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 	"golang.org/x/sys/unix"
 )
 
+// selinuxContainerContext is the --security selinux parameter requesting
+// the default container context of the SELinux policy
+const selinuxContainerContext = "container"
+
 var nsProcName = map[specs.LinuxNamespaceType]string{
 	specs.PIDNamespace:     "pid",
 	specs.UTSNamespace:     "uts",
@@ -278,6 +287,19 @@ func (e *EngineOperations) prepareFd(starterConfig *starter.Config) error {
 			}
 			fds = append(fds, int(f.Fd()))
 		}
+
+		for _, m := range e.EngineConfig.GetMounts() {
+			if m.Type != bind.BindType || !fs.IsDir(m.Source) {
+				continue
+			}
+
+			sylog.Debugf("Open file descriptor for %s", m.Source)
+			f, err := os.Open(m.Source)
+			if err != nil {
+				continue
+			}
+			fds = append(fds, int(f.Fd()))
+		}
 	}
 
 	if !e.EngineConfig.GetContain() {
@@ -332,7 +354,7 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 	if !e.EngineConfig.File.AllowPidNs && e.EngineConfig.OciConfig.Linux != nil {
 		namespaces := e.EngineConfig.OciConfig.Linux.Namespaces
 		for i, ns := range namespaces {
-			if ns.Type == specs.PIDNamespace {
+			if ns.Type == specs.PIDNamespace && ns.Path == "" {
 				sylog.Debugf("Not virtualizing PID namespace by configuration")
 				e.EngineConfig.OciConfig.Linux.Namespaces = append(namespaces[:i], namespaces[i+1:]...)
 				break
@@ -418,9 +440,8 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 	}
 
 	param := security.GetParam(e.EngineConfig.GetSecurity(), "selinux")
-	if param != "" {
-		sylog.Debugf("Applying SELinux context %s", param)
-		e.EngineConfig.OciConfig.SetProcessSelinuxLabel(param)
+	if err := e.prepareSelinux(param); err != nil {
+		return err
 	}
 	param = security.GetParam(e.EngineConfig.GetSecurity(), "apparmor")
 	if param != "" {
@@ -440,6 +461,66 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 	return e.prepareFd(starterConfig)
 }
 
+// prepareSelinux sets the SELinux context of the container process and
+// the file label of bind paths relabeled with the z/Z options. The context
+// "container" allocates the default container context with a unique MCS
+// level, other contexts are used as is once validated.
+func (e *EngineOperations) prepareSelinux(context string) error {
+	relabel := false
+	for _, b := range e.EngineConfig.GetBindPath() {
+		_, _, opts := splitBindPath(b)
+		for _, o := range opts {
+			relabel = relabel || o == "z" || o == "Z"
+		}
+	}
+	if context == "" && !relabel {
+		return nil
+	}
+
+	if !selinux.Enabled() {
+		if context != "" {
+			// a warning is reported when applying the context
+			e.EngineConfig.OciConfig.SetProcessSelinuxLabel(context)
+		}
+		if relabel {
+			sylog.Warningf("SELinux is not enabled, bind paths won't be relabeled")
+		}
+		return nil
+	}
+
+	processLabel, fileLabel, err := selinux.ContainerLabels()
+	if err != nil && (context == selinuxContainerContext || relabel) {
+		return err
+	}
+
+	switch context {
+	case "":
+		processLabel = ""
+	case selinuxContainerContext:
+		sylog.Debugf("Allocated SELinux container context %s", processLabel)
+	default:
+		if err := selinux.CheckContext(context); err != nil {
+			return err
+		}
+		processLabel = context
+		if relabel {
+			if fileLabel, err = selinux.FileLabelFor(context); err != nil {
+				return fmt.Errorf("could not determine file label for context %s: %s", context, err)
+			}
+		}
+	}
+
+	if processLabel != "" {
+		sylog.Debugf("Applying SELinux context %s", processLabel)
+		e.EngineConfig.OciConfig.SetProcessSelinuxLabel(processLabel)
+	}
+	if relabel {
+		sylog.Debugf("Using SELinux file label %s for relabeled bind paths", fileLabel)
+		e.EngineConfig.OciConfig.SetLinuxMountLabel(fileLabel)
+	}
+	return nil
+}
+
 // prepareInstanceJoinConfig is responsible for getting and applying configuration
 // to join a running instance
 func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Config) error {
@@ -516,98 +597,19 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 	// since instance file is stored in user home directory, we can't trust
 	// its content when using SUID workflow
 	if suidRequired {
-		// check if instance is running with user namespace enabled
-		// by reading /proc/pid/uid_map
-		_, hid, err := proc.ReadIDMap("uid_map")
-
-		// if the error returned is "no such file or directory" it means
-		// that user namespaces are not supported, just skip this check
-		if err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to read user namespace mapping: %s", err)
-		} else if err == nil && hid > 0 {
-			// a host uid greater than 0 means user namespace is in use for this process
-			return fmt.Errorf("trying to join an instance running with user namespace enabled")
-		}
-
-		// read "/proc/pid/root" link of instance process must return
-		// a permission denied error.
-		// This is the "sinit" process (PID 1 in container) and it inherited
-		// setuid bit, so most of "/proc/pid" entries are owned by root:root
-		// like "/proc/pid/root" link even if the process has dropped all
-		// privileges and run with user UID/GID. So we expect a "permission denied"
-		// error when reading link.
-		if _, err := mainthread.Readlink("root"); !os.IsPermission(err) {
-			return fmt.Errorf("trying to join a wrong instance process")
-		}
-		// Since we could be tricked to join namespaces of a root owned process,
-		// we will get UID/GID information of task directory to be sure it belongs
-		// to the user currently joining the instance. Also ensure that a user won't
-		// be able to join other user's instances.
-		fi, err := os.Stat("task")
-		if err != nil {
-			return fmt.Errorf("error while getting information for instance task directory: %s", err)
-		}
-		st := fi.Sys().(*syscall.Stat_t)
-		if st.Uid != uint32(uid) || st.Gid != uint32(gid) {
-			return fmt.Errorf("instance process owned by %d:%d instead of %d:%d", st.Uid, st.Gid, uid, gid)
-		}
-
-		ppid := -1
-
-		// read "/proc/pid/status" to check if instance process
-		// is neither orphaned or faked
-		f, err := os.Open("status")
-		if err != nil {
-			return fmt.Errorf("could not open status: %s", err)
-		}
-
-		for s := bufio.NewScanner(f); s.Scan(); {
-			if n, _ := fmt.Sscanf(s.Text(), "PPid:\t%d", &ppid); n == 1 {
-				break
-			}
-		}
-		f.Close()
-
-		// check that Ppid/Pid read from instance file are "somewhat" valid
-		// processes
-		if ppid <= 1 || ppid != file.PPid {
-			return fmt.Errorf("orphaned (or faked) instance process")
-		}
-
-		// read "/proc/ppid/root" link of parent instance process must return
-		// a permission denied error (same logic than "sinit" process).
-		// Also we don't use absolute path because we want to return an error
-		// if current working directory is deleted meaning that instance process
-		// exited.
-		path := filepath.Join("..", strconv.Itoa(file.PPid), "root")
-		if _, err := mainthread.Readlink(path); !os.IsPermission(err) {
-			return fmt.Errorf("trying to join a wrong instance process")
-		}
-		// "/proc/ppid/task" directory must be owned by user UID/GID
-		path = filepath.Join("..", strconv.Itoa(file.PPid), "task")
-		fi, err = os.Stat(path)
-		if err != nil {
-			return fmt.Errorf("error while getting information for parent task directory: %s", err)
-		}
-		st = fi.Sys().(*syscall.Stat_t)
-		if st.Uid != uint32(uid) || st.Gid != uint32(gid) {
-			return fmt.Errorf("parent instance process owned by %d:%d instead of %d:%d", st.Uid, st.Gid, uid, gid)
+		if err := checkInstanceProcess(uid, gid, file.PPid); err != nil {
+			return err
 		}
 	}
 
-	path, err = filepath.Abs("comm")
-	if err != nil {
-		return fmt.Errorf("failed to determine absolute path for comm: %s", err)
+	if err := checkSinitProcess(); err != nil {
+		return err
 	}
 
-	// we must read "sinit\n"
-	b, err := ioutil.ReadFile("comm")
-	if err != nil {
-		return fmt.Errorf("failed to read %s: %s", path, err)
-	}
-	// check that we are currently joining sinit process
-	if "sinit" != strings.Trim(string(b), "\n") {
-		return fmt.Errorf("sinit not found in %s, wrong instance process", path)
+	// the instance images were checked at instance start, the
+	// execution control list may have changed since then
+	if err := e.checkInstanceImage(instanceEngineConfig.GetImage(), starterConfig.GetIsSUID()); err != nil {
+		return err
 	}
 
 	// tell starter that we are joining an instance
@@ -709,6 +711,131 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 	return nil
 }
 
+// checkInstanceProcess checks that the process whose /proc directory is
+// the current working directory is the sinit process of an instance of
+// the user uid/gid started with the setuid workflow and without user
+// namespace. When ppid is positive, the process parent must be ppid.
+func checkInstanceProcess(uid, gid, ppid int) error {
+	// check if instance is running with user namespace enabled
+	// by reading /proc/pid/uid_map
+	_, hid, err := proc.ReadIDMap("uid_map")
+
+	// if the error returned is "no such file or directory" it means
+	// that user namespaces are not supported, just skip this check
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read user namespace mapping: %s", err)
+	} else if err == nil && hid > 0 {
+		// a host uid greater than 0 means user namespace is in use for this process
+		return fmt.Errorf("trying to join an instance running with user namespace enabled")
+	}
+
+	// read "/proc/pid/root" link of instance process must return
+	// a permission denied error.
+	// This is the "sinit" process (PID 1 in container) and it inherited
+	// setuid bit, so most of "/proc/pid" entries are owned by root:root
+	// like "/proc/pid/root" link even if the process has dropped all
+	// privileges and run with user UID/GID. So we expect a "permission denied"
+	// error when reading link.
+	if _, err := mainthread.Readlink("root"); !os.IsPermission(err) {
+		return fmt.Errorf("trying to join a wrong instance process")
+	}
+	// Since we could be tricked to join namespaces of a root owned process,
+	// we will get UID/GID information of task directory to be sure it belongs
+	// to the user currently joining the instance. Also ensure that a user won't
+	// be able to join other user's instances.
+	fi, err := os.Stat("task")
+	if err != nil {
+		return fmt.Errorf("error while getting information for instance task directory: %s", err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if st.Uid != uint32(uid) || st.Gid != uint32(gid) {
+		return fmt.Errorf("instance process owned by %d:%d instead of %d:%d", st.Uid, st.Gid, uid, gid)
+	}
+
+	parent := -1
+
+	// read "/proc/pid/status" to check if instance process
+	// is neither orphaned or faked
+	f, err := os.Open("status")
+	if err != nil {
+		return fmt.Errorf("could not open status: %s", err)
+	}
+
+	for s := bufio.NewScanner(f); s.Scan(); {
+		if n, _ := fmt.Sscanf(s.Text(), "PPid:\t%d", &parent); n == 1 {
+			break
+		}
+	}
+	f.Close()
+
+	// check that Ppid/Pid read from instance file are "somewhat" valid
+	// processes
+	if parent <= 1 || (ppid > 0 && parent != ppid) {
+		return fmt.Errorf("orphaned (or faked) instance process")
+	}
+
+	// read "/proc/ppid/root" link of parent instance process must return
+	// a permission denied error (same logic than "sinit" process).
+	// Also we don't use absolute path because we want to return an error
+	// if current working directory is deleted meaning that instance process
+	// exited.
+	path := filepath.Join("..", strconv.Itoa(parent), "root")
+	if _, err := mainthread.Readlink(path); !os.IsPermission(err) {
+		return fmt.Errorf("trying to join a wrong instance process")
+	}
+	// "/proc/ppid/task" directory must be owned by user UID/GID
+	path = filepath.Join("..", strconv.Itoa(parent), "task")
+	fi, err = os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error while getting information for parent task directory: %s", err)
+	}
+	st = fi.Sys().(*syscall.Stat_t)
+	if st.Uid != uint32(uid) || st.Gid != uint32(gid) {
+		return fmt.Errorf("parent instance process owned by %d:%d instead of %d:%d", st.Uid, st.Gid, uid, gid)
+	}
+	return nil
+}
+
+// checkSinitProcess checks that the process whose /proc directory is
+// the current working directory is an instance sinit process.
+func checkSinitProcess() error {
+	path, err := filepath.Abs("comm")
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path for comm: %s", err)
+	}
+
+	// we must read "sinit\n"
+	b, err := ioutil.ReadFile("comm")
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	// check that we are currently joining sinit process
+	if "sinit" != strings.Trim(string(b), "\n") {
+		return fmt.Errorf("sinit not found in %s, wrong instance process", path)
+	}
+	return nil
+}
+
+// checkInstanceImage checks the instance image path against the
+// execution control list.
+func (e *EngineOperations) checkInstanceImage(path string, suid bool) error {
+	ecl, err := loadExecutionControl(suid)
+	if err != nil {
+		return err
+	}
+	if !ecl.Activated {
+		return nil
+	}
+	img, err := e.loadImage(path, false)
+	if err != nil {
+		return fmt.Errorf("while checking instance image: %s", err)
+	}
+	defer img.File.Close()
+
+	_, err = ecl.ShouldRunImage(img)
+	return err
+}
+
 // PrepareConfig checks and prepares the runtime engine config.
 // It is responsible for singularity configuration file parsing,
 // handling user input, reading capabilities, and checking what
@@ -724,7 +851,7 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 
 	configurationFile := buildcfg.SINGULARITY_CONF_FILE
 	if err := config.Parser(configurationFile, e.EngineConfig.File); err != nil {
-		return fmt.Errorf("Unable to parse singularity.conf file: %s", err)
+		return errcode.Wrap(errcode.Unknown, err, "Unable to parse singularity.conf file")
 	}
 
 	if !e.EngineConfig.File.AllowSetuid && starterConfig.GetIsSUID() {
@@ -778,13 +905,25 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		if err := e.prepareInstanceJoinConfig(starterConfig); err != nil {
 			return err
 		}
+	} else if e.joinMountNamespace() {
+		if err := e.prepareJoinConfig(starterConfig); err != nil {
+			return err
+		}
 	} else {
+		if e.EngineConfig.GetJoin() != nil {
+			if err := e.prepareJoinConfig(starterConfig); err != nil {
+				return err
+			}
+		}
 		if err := e.prepareContainerConfig(starterConfig); err != nil {
 			return err
 		}
 		if err := e.loadImages(starterConfig); err != nil {
 			return err
 		}
+		if err := e.prepareLogStreams(starterConfig); err != nil {
+			return err
+		}
 	}
 
 	starterConfig.SetMasterPropagateMount(true)
@@ -874,7 +1013,7 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 		return err
 	}
 
-	if !img.HasRootFs() {
+	if !img.HasRootFs() || img.Type == image.LUKS {
 		return fmt.Errorf("no root filesystem partition found in image %s", e.EngineConfig.GetImage())
 	}
 
@@ -900,18 +1039,21 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 		}
 		// C starter code will position current working directory
 		starterConfig.SetWorkingDirectoryFd(int(img.Fd))
-	} else if img.Type == image.SIF {
-		// query the ECL module, proceed if an ecl config file is found
-		ecl, err := syecl.LoadConfig(buildcfg.ECL_FILE)
-		if err == nil {
-			if err = ecl.ValidateConfig(); err != nil {
-				return err
-			}
-			_, err := ecl.ShouldRunFp(img.File)
-			if err != nil {
-				return err
-			}
-		}
+	}
+
+	// query the ECL module for all mounted images
+	ecl, err := loadExecutionControl(starterConfig.GetIsSUID())
+	if err != nil {
+		return err
+	}
+	if _, err := ecl.ShouldRunImage(img); err != nil {
+		return err
+	}
+
+	// the dm-verity root hash stored in the image is only trusted
+	// once covered by a signature verified with the ECL keyring
+	if err := e.setVerityRootHash(ecl, img); err != nil {
+		return err
 	}
 
 	// lock all ext3 partitions if any to prevent concurrent writes
@@ -945,10 +1087,13 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 		if err != nil {
 			return fmt.Errorf("failed to open overlay image %s: %s", splitted[0], err)
 		}
+		if _, err := ecl.ShouldRunImage(img); err != nil {
+			return fmt.Errorf("overlay image %s: %s", splitted[0], err)
+		}
 
 		// lock all ext3 partitions if any to prevent concurrent writes
 		for _, part := range img.Partitions {
-			if part.Type == image.EXT3 {
+			if part.Type == image.EXT3 || part.Type == image.LUKS {
 				if err := img.LockSection(part); err != nil {
 					return fmt.Errorf("error while locking ext3 overlay partition from %s: %s", img.Path, err)
 				}
@@ -961,11 +1106,102 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 		images = append(images, *img)
 	}
 
+	// load images mounted with --mount type=image
+	for _, m := range e.EngineConfig.GetMounts() {
+		if m.Type != bind.ImageType || !e.EngineConfig.File.UserBindControl {
+			continue
+		}
+
+		img, err := e.loadImage(m.Source, !m.ReadOnly)
+		if err != nil {
+			return fmt.Errorf("failed to open image %s: %s", m.Source, err)
+		}
+		if img.Type == image.SANDBOX {
+			return fmt.Errorf("%s is a directory, use a bind mount instead", m.Source)
+		}
+		if _, err := ecl.ShouldRunImage(img); err != nil {
+			return fmt.Errorf("image %s: %s", m.Source, err)
+		}
+
+		// lock all ext3 partitions if any to prevent concurrent writes
+		if img.Writable {
+			for _, part := range img.Partitions {
+				if part.Type == image.EXT3 {
+					if err := img.LockSection(part); err != nil {
+						return fmt.Errorf("error while locking ext3 partition from %s: %s", img.Path, err)
+					}
+				}
+			}
+		}
+
+		if err := starterConfig.KeepFileDescriptor(int(img.Fd)); err != nil {
+			return err
+		}
+		images = append(images, *img)
+	}
+
 	e.EngineConfig.SetImageList(images)
 
 	return nil
 }
 
+// setVerityRootHash records the dm-verity root hash of the root filesystem
+// image img if a key of the execution control list keyring has a valid
+// signature for its primary partition, the signature covering the root hash.
+func (e *EngineOperations) setVerityRootHash(ecl *syecl.EclConfig, img *image.Image) error {
+	e.EngineConfig.SetVerityRootHash("")
+
+	if e.EngineConfig.File.SifVerity == "no" || !ecl.Activated || !ecl.Verify {
+		return nil
+	}
+	v, err := image.GetVerity(img)
+	if err != nil || v == nil {
+		// reported while mounting the image
+		return nil
+	}
+
+	signers, err := ecl.VerifiedSigners(img.File)
+	if err != nil {
+		return fmt.Errorf("while verifying dm-verity root hash of %s: %s", img.Path, err)
+	}
+	if len(signers) > 0 {
+		e.EngineConfig.SetVerityRootHash(v.RootHash)
+	}
+	return nil
+}
+
+// loadExecutionControl loads the execution control list configuration,
+// an inactive configuration is returned if no configuration file is found.
+// In setuid mode the keyring must be owned by root. The image cache of the
+// user is located from the user database, the cache directory set in the
+// environment isn't trusted and images it holds are local images.
+func loadExecutionControl(suid bool) (*syecl.EclConfig, error) {
+	ecl, err := syecl.LoadConfig(buildcfg.ECL_FILE)
+	if err != nil {
+		return &syecl.EclConfig{}, nil
+	}
+	if err := ecl.ValidateConfig(); err != nil {
+		return nil, err
+	}
+	if ecl.Activated && (len(ecl.Sources) > 0 || len(ecl.LocalRoots) > 0) {
+		pw, err := user.GetPwUID(uint32(os.Getuid()))
+		if err != nil {
+			return nil, fmt.Errorf("while retrieving user information: %s", err)
+		}
+		dir, err := syfs.ConfigDirForUsername(pw.Name)
+		if err != nil {
+			return nil, fmt.Errorf("while retrieving singularity directory of %s: %s", pw.Name, err)
+		}
+		ecl.SetCacheRoot(filepath.Join(dir, cache.CacheDir))
+	}
+	if ecl.Activated && ecl.Verify {
+		if err := ecl.LoadKeyring(suid); err != nil {
+			return nil, err
+		}
+	}
+	return &ecl, nil
+}
+
 func (e *EngineOperations) loadImage(path string, writable bool) (*image.Image, error) {
 	imgObject, err := image.Init(path, writable)
 	if err != nil {
@@ -1008,7 +1244,7 @@ func (e *EngineOperations) loadImage(path string, writable bool) (*image.Image,
 		if !e.EngineConfig.File.AllowContainerDir {
 			return nil, fmt.Errorf("configuration disallows users from running sandbox based containers")
 		}
-	case image.EXT3:
+	case image.EXT3, image.LUKS:
 		if !e.EngineConfig.File.AllowContainerExtfs {
 			return nil, fmt.Errorf("configuration disallows users from running extFS based containers")
 		}
@@ -1016,6 +1252,10 @@ func (e *EngineOperations) loadImage(path string, writable bool) (*image.Image,
 		if !e.EngineConfig.File.AllowContainerSquashfs {
 			return nil, fmt.Errorf("configuration disallows users from running squashFS based containers")
 		}
+	case image.EROFS:
+		if !e.EngineConfig.File.AllowContainerErofs {
+			return nil, fmt.Errorf("configuration disallows users from running EROFS based containers")
+		}
 	}
 	return imgObject, nil
 }
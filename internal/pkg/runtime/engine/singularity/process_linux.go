@@ -26,6 +26,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/security"
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	singularity "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
@@ -147,6 +148,20 @@ func (e *EngineOperations) checkExec() error {
 			return nil
 		}
 		return fmt.Errorf("no test driver found inside container")
+	case "/sbin/init":
+		if !e.EngineConfig.GetBootInstance() {
+			break
+		}
+		// use sinit as init process to run the instance start
+		// script, it reaps zombies and forwards shutdown signals
+		sylog.Warningf("container does not have /sbin/init, using built-in init")
+		e.EngineConfig.SetBootInstance(false)
+		args = []string{"/.singularity.d/actions/start"}
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return nil
+		}
+		args = []string{shell, "-c", `echo "instance start script not found"`}
+		return nil
 	}
 
 	return fmt.Errorf("no %s found inside container", args[0])
@@ -250,6 +265,32 @@ func preStartProcess(e *EngineOperations) error {
 	return nil
 }
 
+// loadSeccompNotify loads the seccomp filter reporting the syscalls with
+// the SCMP_ACT_NOTIFY action and sends the notification listener to the
+// master process which executes those syscalls on behalf of the container.
+func loadSeccompNotify(spec *specs.Spec, masterConn net.Conn) error {
+	if spec.Linux == nil || spec.Linux.Seccomp == nil || !seccomp.Enabled() {
+		return nil
+	}
+
+	fd, err := seccomp.LoadNotifyFilter(spec.Linux.Seccomp, spec.Process.NoNewPrivileges)
+	if err != nil {
+		return err
+	} else if fd < 0 {
+		return nil
+	}
+	defer syscall.Close(fd)
+
+	conn, ok := masterConn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("master connection is not a unix socket")
+	}
+	if _, _, err := conn.WriteMsgUnix([]byte{'n'}, syscall.UnixRights(fd), nil); err != nil {
+		return fmt.Errorf("failed to send seccomp notification listener to master: %s", err)
+	}
+	return nil
+}
+
 // StartProcess starts the process
 func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	// Manage all signals.
@@ -262,9 +303,18 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	}
 
 	isInstance := e.EngineConfig.GetInstance()
-	bootInstance := isInstance && e.EngineConfig.GetBootInstance()
 	shimProcess := false
 
+	// a restored instance runs the checkpointed process tree restored by
+	// the master process, this process only holds the container root
+	// filesystem until the master process kills it
+	if isInstance && e.EngineConfig.GetRestoreDir() != "" {
+		masterConn.Close()
+		for {
+			<-signals
+		}
+	}
+
 	if err := os.Chdir(e.EngineConfig.OciConfig.Process.Cwd); err != nil {
 		if err := os.Chdir(e.EngineConfig.GetHomeDest()); err != nil {
 			os.Chdir("/")
@@ -275,6 +325,9 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		return err
 	}
 
+	// checkExec may fallback to the built-in init for boot instances
+	bootInstance := isInstance && e.EngineConfig.GetBootInstance()
+
 	if e.EngineConfig.File.MountDev == "minimal" || e.EngineConfig.GetContain() {
 		// If on a terminal, reopen /dev/console so /proc/self/fd/[0-2
 		//   will point to /dev/console.  This is needed so that tty and
@@ -313,7 +366,8 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 	if e.EngineConfig.OciConfig.Linux != nil {
 		namespaces := e.EngineConfig.OciConfig.Linux.Namespaces
 		for _, ns := range namespaces {
-			if ns.Type == specs.PIDNamespace {
+			// the command doesn't run as PID 1 in a joined PID namespace
+			if ns.Type == specs.PIDNamespace && ns.Path == "" {
 				if !e.EngineConfig.GetNoInit() {
 					shimProcess = true
 				}
@@ -322,6 +376,19 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		}
 	}
 
+	// --init interposes sinit between the container process and
+	// the caller even without PID namespace
+	if !isInstance && e.EngineConfig.GetInit() {
+		shimProcess = true
+		if os.Getpid() != 1 {
+			// without PID namespace orphaned processes are re-parented
+			// to sinit instead of the host init process
+			if err := setChildSubreaper(); err != nil {
+				return err
+			}
+		}
+	}
+
 	for _, img := range e.EngineConfig.GetImageList() {
 		if err := syscall.Close(int(img.Fd)); err != nil {
 			return fmt.Errorf("failed to close file descriptor for %s", img.Path)
@@ -334,11 +401,19 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		}
 	}
 
+	if err := e.redirectLogStreams(); err != nil {
+		return err
+	}
+
+	if err := loadSeccompNotify(&e.EngineConfig.OciConfig.Spec, masterConn); err != nil {
+		return fmt.Errorf("failed to apply security configuration: %s", err)
+	}
+
 	if err := security.Configure(&e.EngineConfig.OciConfig.Spec); err != nil {
 		return fmt.Errorf("failed to apply security configuration: %s", err)
 	}
 
-	if (!isInstance && !shimProcess) || bootInstance || e.EngineConfig.GetInstanceJoin() {
+	if (!isInstance && !shimProcess) || bootInstance || e.EngineConfig.GetInstanceJoin() || e.joinMountNamespace() {
 		err := syscall.Exec(args[0], args, env)
 		if err != nil {
 			// We know the shell exists at this point, so let's inspect its architecture
@@ -403,8 +478,27 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		return syscall.Errno(err)
 	}
 
+	// the exec agent spawns processes from this process, they
+	// share the container namespaces and environment
+	var agent *execAgent
+	if isInstance && e.EngineConfig.GetExecAgent() {
+		cwd, _ := os.Getwd()
+		a, err := newExecAgent(masterConn, env, cwd)
+		if err != nil {
+			sylog.Warningf("Instance exec agent not available: %s", err)
+		}
+		agent = a
+	}
+
 	masterConn.Close()
 
+	// sinit is the init process of the container PID namespace
+	// for instances, shutdown signals are forwarded to all processes
+	// and sinit exits once they are all gone
+	initProcess := isInstance && shimProcess
+	shutdown := false
+	reaped := 0
+
 	for {
 		select {
 		case s := <-signals:
@@ -415,6 +509,9 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 					var status syscall.WaitStatus
 
 					wpid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+					if err == syscall.ECHILD && shutdown {
+						exitInstance(statusChan, errChan, reaped)
+					}
 					if wpid <= 0 || err != nil {
 						// We break the loop since an error occurred
 						break
@@ -422,6 +519,8 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 
 					if wpid == cmd.Process.Pid {
 						statusChan <- status
+					} else if !agent.reaped(wpid, status) {
+						reaped++
 					}
 				}
 			default:
@@ -432,8 +531,22 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 				// mean to update the Go runtime or the kernel to something more
 				// stable :)
 				if isInstance {
-					if err := syscall.Kill(-cmd.Process.Pid, signal); err == syscall.ESRCH {
+					pid := -cmd.Process.Pid
+					if initProcess && isShutdownSignal(signal) {
+						// daemons may run in their own process group
+						// or session, signal all processes
+						shutdown = true
+						pid = -1
+					} else if isShutdownSignal(signal) {
+						// without sinit, processes spawned by the exec
+						// agent run in their own process group
+						agent.signal(signal)
+					}
+					if err := syscall.Kill(pid, signal); err == syscall.ESRCH {
 						sylog.Debugf("No child process, exiting ...")
+						if shutdown {
+							exitInstance(statusChan, errChan, reaped)
+						}
 						os.Exit(128 + int(signal))
 					}
 				} else if e.EngineConfig.GetSignalPropagation() {
@@ -494,6 +607,13 @@ func (e *EngineOperations) PostStartProcess(pid int) error {
 		if err != nil {
 			return err
 		}
+		if e.EngineConfig.GetRestoreDir() != "" {
+			pid, err = e.restoreInstance(pid)
+			if err != nil {
+				return fmt.Errorf("failed to restore instance: %s", err)
+			}
+		}
+
 		file.User = pw.Name
 		file.Pid = pid
 		file.PPid = os.Getpid()
@@ -528,6 +648,30 @@ func (e *EngineOperations) PostStartProcess(pid int) error {
 			}
 		}
 
+		if e.EngineConfig.Cgroups != nil {
+			file.Cgroup = e.EngineConfig.Cgroups.Path
+		}
+
+		// the control socket is a convenience, the instance
+		// is started without it on failure
+		if err := e.startControlServer(file, pid, pw); err != nil {
+			sylog.Warningf("Instance control socket not available: %s", err)
+		}
+
+		if err := e.startLogger(name); err != nil {
+			sylog.Warningf("Instance structured log not available: %s", err)
+		}
+
+		if e.EngineConfig.GetExecAgent() {
+			if err := e.startExecAgent(file, pw); err != nil {
+				sylog.Warningf("Instance exec agent not available: %s", err)
+			}
+		}
+
+		if err := e.startHealthcheck(file, pid, pw); err != nil {
+			sylog.Warningf("Instance healthcheck disabled: %s", err)
+		}
+
 		// grab configuration to store in instance file
 		file.Config, err = json.Marshal(e.CommonConfig)
 		if err != nil {
@@ -536,6 +680,10 @@ func (e *EngineOperations) PostStartProcess(pid int) error {
 
 		err = file.Update()
 
+		if e.healthcheck != nil && err == nil {
+			go e.healthcheck.run()
+		}
+
 		// send SIGUSR1 to the parent process in order to tell it
 		// to detach container process and run as instance.
 		// Sleep a bit in case child would exit
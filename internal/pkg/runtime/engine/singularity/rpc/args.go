@@ -8,6 +8,7 @@ package rpc
 import (
 	"os"
 
+	"github.com/sylabs/singularity/pkg/util/crypt"
 	"github.com/sylabs/singularity/pkg/util/loop"
 )
 
@@ -35,14 +36,96 @@ type MountArgs struct {
 	Data       string
 }
 
-// CryptArgs defines the arguments to mount.
+// IdmapMountArgs defines the arguments to bind mount a path with the
+// ownership of files mapped through a user namespace.
+type IdmapMountArgs struct {
+	Source     string
+	Target     string
+	Mountflags uintptr
+	Userns     string
+}
+
+// MountFuseArgs defines the arguments to mount a FUSE filesystem.
+type MountFuseArgs struct {
+	Program    []string
+	Target     string
+	Mountflags uintptr
+	Options    string
+	UID        int
+	GID        int
+}
+
+// MountFuseReply defines the reply of a FUSE filesystem mount.
+type MountFuseReply struct {
+	Status     int
+	Output     string
+	Connection uint32
+	Pid        int
+}
+
+// UnmountArgs defines the arguments to unmount.
+type UnmountArgs struct {
+	Target       string
+	Unmountflags int
+}
+
+// CopyTreeArgs defines the arguments to copy a directory tree.
+type CopyTreeArgs struct {
+	Source string
+	Target string
+}
+
+// CryptArgs defines the arguments to mount. When Key is empty, the key
+// is retrieved by the server from the KeyInfo material and the Image.
 type CryptArgs struct {
 	Offset    uint64
 	Loopdev   string
 	Key       []byte
+	KeyInfo   crypt.KeyInfo
+	Image     string
 	MasterPid int
 }
 
+// EncryptedOverlayArgs defines the arguments to open, and format if
+// blank, an encrypted overlay image.
+type EncryptedOverlayArgs struct {
+	Image      string
+	Key        []byte
+	KeyInfo    crypt.KeyInfo
+	MaxDevices int
+	UID        int
+	GID        int
+	MasterPid  int
+	ReadOnly   bool
+}
+
+// CryptCloseArgs defines the arguments to close a crypt device.
+type CryptCloseArgs struct {
+	Device string
+}
+
+// VerityArgs defines the arguments to open a dm-verity device.
+type VerityArgs struct {
+	Data     string
+	Hash     string
+	RootHash string
+}
+
+// VerityMountArgs defines the arguments to mount an image partition
+// verified by dm-verity.
+type VerityMountArgs struct {
+	Image      string
+	Offset     uint64
+	Size       uint64
+	HashOffset uint64
+	HashSize   uint64
+	RootHash   string
+	Target     string
+	Filesystem string
+	Mountflags uintptr
+	MaxDevices int
+}
+
 // ChrootArgs defines the arguments to chroot.
 type ChrootArgs struct {
 	Root   string
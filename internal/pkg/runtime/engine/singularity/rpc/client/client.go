@@ -7,11 +7,16 @@ package client
 
 import (
 	"encoding/gob"
+	"fmt"
 	"net/rpc"
 	"os"
+	"strings"
 	"syscall"
 
 	args "github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
+	"github.com/sylabs/singularity/pkg/util/crypt"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 	"github.com/sylabs/singularity/pkg/util/loop"
 )
 
@@ -42,6 +47,71 @@ func (t *RPC) Mount(source string, target string, filesystem string, flags uintp
 	return err
 }
 
+// IdmapMount calls the idmapped bind mount RPC using the supplied
+// arguments, the ownership of files is mapped through the user
+// namespace userns.
+func (t *RPC) IdmapMount(source string, target string, flags uintptr, userns string) error {
+	arguments := &args.IdmapMountArgs{
+		Source:     source,
+		Target:     target,
+		Mountflags: flags,
+		Userns:     userns,
+	}
+
+	var mountErr error
+
+	err := t.Client.Call(t.Name+".IdmapMount", arguments, &mountErr)
+	// RPC communication will take precedence over mount error
+	if err == nil {
+		err = mountErr
+	}
+
+	return err
+}
+
+// MountFuse calls the FUSE mount RPC using the supplied arguments and
+// returns the FUSE connection number of the mounted filesystem and the
+// PID of the FUSE helper serving it.
+func (t *RPC) MountFuse(program []string, target string, flags uintptr, options string, uid int, gid int) (uint32, int, error) {
+	arguments := &args.MountFuseArgs{
+		Program:    program,
+		Target:     target,
+		Mountflags: flags,
+		Options:    options,
+		UID:        uid,
+		GID:        gid,
+	}
+	var reply args.MountFuseReply
+	if err := t.Client.Call(t.Name+".MountFuse", arguments, &reply); err != nil {
+		return 0, 0, err
+	}
+	if reply.Status != 0 {
+		return 0, 0, fmt.Errorf("FUSE helper %s exited with status %d: %s", program[0], reply.Status, strings.TrimSpace(reply.Output))
+	}
+	return reply.Connection, reply.Pid, nil
+}
+
+// Unmount calls the unmount RPC using the supplied arguments.
+func (t *RPC) Unmount(target string, flags int) error {
+	arguments := &args.UnmountArgs{
+		Target:       target,
+		Unmountflags: flags,
+	}
+	var reply int
+	return t.Client.Call(t.Name+".Unmount", arguments, &reply)
+}
+
+// CopyTree calls the copy tree RPC using the supplied arguments.
+func (t *RPC) CopyTree(source string, target string) (xattr.Dropped, error) {
+	arguments := &args.CopyTreeArgs{
+		Source: source,
+		Target: target,
+	}
+	var reply xattr.Dropped
+	err := t.Client.Call(t.Name+".CopyTree", arguments, &reply)
+	return reply, err
+}
+
 // Decrypt calls the DeCrypt RPC using the supplied arguments.
 func (t *RPC) Decrypt(offset uint64, path string, key []byte, masterPid int) (string, error) {
 	arguments := &args.CryptArgs{
@@ -57,6 +127,73 @@ func (t *RPC) Decrypt(offset uint64, path string, key []byte, masterPid int) (st
 	return reply, err
 }
 
+// DecryptWithKeyInfo calls the Decrypt RPC with the key material used
+// by the server to retrieve the key of the image.
+func (t *RPC) DecryptWithKeyInfo(offset uint64, path string, keyInfo crypt.KeyInfo, image string, masterPid int) (string, error) {
+	arguments := &args.CryptArgs{
+		Offset:    offset,
+		Loopdev:   path,
+		KeyInfo:   keyInfo,
+		Image:     image,
+		MasterPid: masterPid,
+	}
+
+	var reply string
+	err := t.Client.Call(t.Name+".Decrypt", arguments, &reply)
+
+	return reply, err
+}
+
+// EncryptedOverlay calls the encrypted overlay RPC using the supplied
+// arguments and returns the crypt device path.
+func (t *RPC) EncryptedOverlay(image string, key []byte, keyInfo crypt.KeyInfo, maxDevices int, uid int, gid int, masterPid int, readonly bool) (string, error) {
+	arguments := &args.EncryptedOverlayArgs{
+		Image:      image,
+		Key:        key,
+		KeyInfo:    keyInfo,
+		MaxDevices: maxDevices,
+		UID:        uid,
+		GID:        gid,
+		MasterPid:  masterPid,
+		ReadOnly:   readonly,
+	}
+
+	var reply string
+	err := t.Client.Call(t.Name+".EncryptedOverlay", arguments, &reply)
+
+	return reply, err
+}
+
+// CryptClose calls the crypt close RPC, the crypt device is
+// removed once it's not used anymore.
+func (t *RPC) CryptClose(device string) error {
+	arguments := &args.CryptCloseArgs{
+		Device: device,
+	}
+
+	var reply int
+	return t.Client.Call(t.Name+".CryptClose", arguments, &reply)
+}
+
+// VerityOpen calls the dm-verity open RPC using the supplied arguments.
+func (t *RPC) VerityOpen(data, hash, rootHash string) (string, error) {
+	arguments := &args.VerityArgs{
+		Data:     data,
+		Hash:     hash,
+		RootHash: rootHash,
+	}
+	var reply string
+	err := t.Client.Call(t.Name+".VerityOpen", arguments, &reply)
+	return reply, err
+}
+
+// VerityMount calls the dm-verity mount RPC using the supplied arguments.
+func (t *RPC) VerityMount(arguments *args.VerityMountArgs) (string, error) {
+	var reply string
+	err := t.Client.Call(t.Name+".VerityMount", arguments, &reply)
+	return reply, errcode.Decode(err)
+}
+
 // Mkdir calls the mkdir RPC using the supplied arguments.
 func (t *RPC) Mkdir(path string, perm os.FileMode) (int, error) {
 	arguments := &args.MkdirArgs{
@@ -90,7 +227,7 @@ func (t *RPC) LoopDevice(image string, mode int, info loop.Info64, maxDevices in
 	}
 	var reply int
 	err := t.Client.Call(t.Name+".LoopDevice", arguments, &reply)
-	return reply, err
+	return reply, errcode.Decode(err)
 }
 
 // SetHostname calls the sethostname RPC using the supplied arguments.
@@ -6,20 +6,32 @@
 package server
 
 import (
+	"bytes"
+	"debug/elf"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	args "github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/util/crypt"
+	"github.com/sylabs/singularity/pkg/util/errcode"
+	"github.com/sylabs/singularity/pkg/util/idmap"
 	"github.com/sylabs/singularity/pkg/util/loop"
 	"github.com/sylabs/singularity/pkg/util/namespaces"
+	"github.com/sylabs/singularity/pkg/util/verity"
+	"golang.org/x/sys/unix"
 )
 
 var diskGID = -1
@@ -35,34 +47,357 @@ func (t *Methods) Mount(arguments *args.MountArgs, mountErr *error) (err error)
 	return nil
 }
 
+// IdmapMount bind mounts a path with the ownership of files mapped
+// through a user namespace.
+func (t *Methods) IdmapMount(arguments *args.IdmapMountArgs, mountErr *error) (err error) {
+	recursive := arguments.Mountflags&syscall.MS_REC != 0
+	mainthread.Execute(func() {
+		*mountErr = idmap.BindMount(arguments.Source, arguments.Target, arguments.Userns, recursive)
+	})
+	return nil
+}
+
+// fuseHelperDelay is the time given to a FUSE helper to fail before
+// its filesystem is considered served.
+const fuseHelperDelay = 200 * time.Millisecond
+
+// MountFuse mounts a FUSE filesystem at the target and runs the FUSE
+// helper program serving it in the foreground with the specified user
+// and group IDs, the /dev/fuse file descriptor path is appended to the
+// helper arguments. The helper exit status is returned if it exits
+// right away, otherwise its PID and the FUSE connection number are
+// returned to terminate it on container teardown.
+func (t *Methods) MountFuse(arguments *args.MountFuseArgs, reply *args.MountFuseReply) (err error) {
+	if len(arguments.Program) == 0 {
+		return fmt.Errorf("no FUSE helper program specified")
+	}
+
+	mainthread.Execute(func() {
+		err = mountFuse(arguments, reply)
+	})
+	return err
+}
+
+// checkLibfuse3 returns an error if the FUSE helper program isn't linked
+// against libfuse3, older libfuse releases don't accept a /dev/fd/N
+// mountpoint and would try to mount the filesystem themselves.
+func checkLibfuse3(program string) error {
+	f, err := elf.Open(program)
+	if err != nil {
+		return fmt.Errorf("while reading FUSE helper %s: %s", program, err)
+	}
+	defer f.Close()
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return fmt.Errorf("while reading FUSE helper %s libraries: %s", program, err)
+	}
+	for _, lib := range libs {
+		if strings.HasPrefix(lib, "libfuse3.so") {
+			return nil
+		}
+	}
+	return fmt.Errorf("FUSE helper %s is not linked against libfuse3, required to mount /dev/fd/N", program)
+}
+
+func mountFuse(arguments *args.MountFuseArgs, reply *args.MountFuseReply) error {
+	var st syscall.Stat_t
+
+	if err := checkLibfuse3(arguments.Program[0]); err != nil {
+		return err
+	}
+
+	if err := syscall.Stat(arguments.Target, &st); err != nil {
+		return fmt.Errorf("while getting %s information: %s", arguments.Target, err)
+	}
+
+	fuse, err := os.OpenFile("/dev/fuse", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("while opening /dev/fuse: %s", err)
+	}
+	defer fuse.Close()
+
+	opts := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d",
+		fuse.Fd(),
+		st.Mode&syscall.S_IFMT,
+		arguments.UID,
+		arguments.GID)
+	if arguments.Options != "" {
+		opts += "," + arguments.Options
+	}
+
+	source := filepath.Base(arguments.Program[0])
+	if err := syscall.Mount(source, arguments.Target, "fuse", arguments.Mountflags, opts); err != nil {
+		return fmt.Errorf("while mounting FUSE filesystem at %s: %s", arguments.Target, err)
+	}
+	if err := syscall.Stat(arguments.Target, &st); err != nil {
+		syscall.Unmount(arguments.Target, syscall.MNT_DETACH)
+		return fmt.Errorf("while getting %s information: %s", arguments.Target, err)
+	}
+	reply.Connection = unix.Minor(st.Dev)
+
+	// the helper stays in the foreground so it can be waited for,
+	// the /dev/fuse file descriptor is the first extra file
+	program := append(arguments.Program, "-f", "/dev/fd/3")
+
+	var out bytes.Buffer
+
+	cmd := exec.Command(program[0], program[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.ExtraFiles = []*os.File{fuse}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:         uint32(arguments.UID),
+			Gid:         uint32(arguments.GID),
+			NoSetGroups: true,
+		},
+		Setsid: true,
+	}
+
+	sylog.Debugf("Running FUSE helper %v for %s", program, arguments.Target)
+	if err := cmd.Start(); err != nil {
+		syscall.Unmount(arguments.Target, syscall.MNT_DETACH)
+		return fmt.Errorf("while running FUSE helper %s: %s", program[0], err)
+	}
+
+	// the helper is reaped here as long as this process is alive,
+	// then by the process it's reparented to
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		syscall.Unmount(arguments.Target, syscall.MNT_DETACH)
+		reply.Output = out.String()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			reply.Status = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("while waiting FUSE helper %s: %s", program[0], err)
+		}
+		return fmt.Errorf("FUSE helper %s exited before serving %s: %s", program[0], arguments.Target, strings.TrimSpace(reply.Output))
+	case <-time.After(fuseHelperDelay):
+		reply.Pid = cmd.Process.Pid
+	}
+
+	return nil
+}
+
+// Unmount performs an unmount with the specified arguments.
+func (t *Methods) Unmount(arguments *args.UnmountArgs, reply *int) (err error) {
+	mainthread.Execute(func() {
+		err = syscall.Unmount(arguments.Target, arguments.Unmountflags)
+	})
+	return err
+}
+
+// CopyTree copies a directory tree with the specified arguments and
+// returns the extended attributes which couldn't be preserved.
+func (t *Methods) CopyTree(arguments *args.CopyTreeArgs, reply *xattr.Dropped) (err error) {
+	mainthread.Execute(func() {
+		oldmask := syscall.Umask(0)
+		*reply, err = fs.CopyTree(arguments.Source, arguments.Target)
+		syscall.Umask(oldmask)
+	})
+	return err
+}
+
 // Decrypt decrypts the loop device
 func (t *Methods) Decrypt(arguments *args.CryptArgs, reply *string) (err error) {
 	cryptDev := &crypt.Device{}
 
-	// cryptsetup requires to run in the host IPC namespace
-	// so we enter temporarily in the host IPC namespace
-	// via the master processus ID if its greater than zero
-	// which means that a container IPC namespace was requested
-	if arguments.MasterPid > 0 {
-		runtime.LockOSThread()
-		defer runtime.UnlockOSThread()
+	key, err := imageKey(arguments.Key, arguments.KeyInfo, arguments.Image)
+	if err != nil {
+		return err
+	}
+
+	var cryptName string
 
-		if err := namespaces.Enter(arguments.MasterPid, "ipc"); err != nil {
-			return fmt.Errorf("while joining host IPC namespace: %s", err)
-		}
+	err = inHostIPC(arguments.MasterPid, func() (err error) {
+		cryptName, err = cryptDev.Open(key, arguments.Loopdev)
+		return err
+	})
+
+	*reply = "/dev/mapper/" + cryptName
+
+	return err
+}
+
+// EncryptedOverlay attaches the overlay image to a loop device and opens
+// it as a crypt device, blank images are formatted first with LUKS and an
+// ext3 filesystem holding the overlay upper and work directories owned by
+// the specified user and group IDs. With PEM and PKCS#11 key material the
+// overlay key is a random key stored encrypted in the LUKS header. It
+// returns the crypt device path.
+func (t *Methods) EncryptedOverlay(arguments *args.EncryptedOverlayArgs, reply *string) error {
+	cryptDev := &crypt.Device{}
+
+	f, err := os.Open(arguments.Image)
+	if err != nil {
+		return fmt.Errorf("could not open image file: %s", err)
+	}
+	b := make([]byte, 2048)
+	_, err = f.ReadAt(b, 0)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("while reading image header: %s", err)
+	}
+	formatted, err := image.CheckLUKSHeader(b)
+	if err != nil {
+		return fmt.Errorf("%s is neither a LUKS image nor a blank file", arguments.Image)
+	}
+	if !formatted && arguments.ReadOnly {
+		return fmt.Errorf("blank encrypted overlay %s can't be used read-only", arguments.Image)
 	}
 
-	cryptName, err := cryptDev.Open(arguments.Key, arguments.Loopdev)
+	var number int
+
+	loopArgs := &args.LoopArgs{
+		Image:      arguments.Image,
+		Mode:       os.O_RDWR,
+		Info:       loop.Info64{Flags: loop.FlagsAutoClear},
+		MaxDevices: arguments.MaxDevices,
+	}
+	if arguments.ReadOnly {
+		loopArgs.Mode = os.O_RDONLY
+		loopArgs.Info.Flags |= loop.FlagsReadOnly
+	}
+	if err := t.LoopDevice(loopArgs, &number); err != nil {
+		return err
+	}
+	loopdev := fmt.Sprintf("/dev/loop%d", number)
+
+	var cryptName string
+
+	err = inHostIPC(arguments.MasterPid, func() error {
+		if !formatted {
+			key, encKey, err := newOverlayKey(arguments.Key, arguments.KeyInfo)
+			if err != nil {
+				return err
+			}
+			sylog.Infof("Formatting encrypted overlay %s", arguments.Image)
+			cryptName, err = cryptDev.FormatOverlay(key, encKey, loopdev, arguments.UID, arguments.GID)
+			return err
+		}
 
-	// return to the container IPC namespace if required
-	if arguments.MasterPid > 0 {
-		if err := namespaces.Enter(os.Getpid(), "ipc"); err != nil {
-			return fmt.Errorf("while joining container IPC namespace: %s", err)
+		key, err := overlayKey(cryptDev, arguments.Key, arguments.KeyInfo, loopdev)
+		if err != nil {
+			return err
+		}
+		if arguments.ReadOnly {
+			cryptName, err = cryptDev.OpenReadOnly(key, loopdev)
+		} else {
+			cryptName, err = cryptDev.Open(key, loopdev)
 		}
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	*reply = "/dev/mapper/" + cryptName
 
+	return nil
+}
+
+// newOverlayKey returns the key if set, otherwise a new overlay key and
+// its encrypted form are generated from the key material.
+func newOverlayKey(key []byte, keyInfo crypt.KeyInfo) (k, encKey []byte, err error) {
+	if len(key) > 0 {
+		return key, nil, nil
+	}
+	mainthread.Execute(func() {
+		k, encKey, err = crypt.NewOverlayKey(keyInfo)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("while generating overlay key: %s", err)
+	}
+	return k, encKey, nil
+}
+
+// overlayKey returns the key if set, otherwise the key is retrieved from
+// the key material and the encrypted key stored in the overlay header of
+// the device path.
+func overlayKey(cryptDev *crypt.Device, key []byte, keyInfo crypt.KeyInfo, path string) (k []byte, err error) {
+	if len(key) > 0 {
+		return key, nil
+	}
+	if keyInfo.Format != crypt.PEM && keyInfo.Format != crypt.PKCS11 {
+		return imageKey(key, keyInfo, "")
+	}
+
+	encKey, err := cryptDev.OverlayKeyToken(path)
+	if err != nil {
+		return nil, err
+	} else if encKey == nil {
+		return nil, fmt.Errorf("no encrypted key stored in overlay, it was not formatted with a PEM or PKCS#11 key")
+	}
+
+	mainthread.Execute(func() {
+		k, err = crypt.OverlayKey(keyInfo, encKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while retrieving overlay key: %s", err)
+	}
+	return k, nil
+}
+
+// imageKey returns the key if set, otherwise the key is retrieved
+// from the key material and the image.
+func imageKey(key []byte, keyInfo crypt.KeyInfo, image string) (k []byte, err error) {
+	if len(key) > 0 {
+		return key, nil
+	}
+	// key material is accessed with the filesystem user and
+	// group IDs of the main thread which are the user ones
+	mainthread.Execute(func() {
+		k, err = crypt.PlaintextKey(keyInfo, image)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while retrieving image key: %s", err)
+	}
+	return k, nil
+}
+
+// inHostIPC executes fn in the host IPC namespace required by
+// cryptsetup, we enter temporarily in the host IPC namespace
+// via the master processus ID if its greater than zero which
+// means that a container IPC namespace was requested
+func inHostIPC(masterPid int, fn func() error) error {
+	if masterPid <= 0 {
+		return fn()
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := namespaces.Enter(masterPid, "ipc"); err != nil {
+		return fmt.Errorf("while joining host IPC namespace: %s", err)
+	}
+
+	err := fn()
+
+	// return to the container IPC namespace
+	if err := namespaces.Enter(os.Getpid(), "ipc"); err != nil {
+		return fmt.Errorf("while joining container IPC namespace: %s", err)
+	}
+
+	return err
+}
+
+// CryptClose marks the crypt device for removal once it's not used anymore.
+func (t *Methods) CryptClose(arguments *args.CryptCloseArgs, reply *int) error {
+	cryptDev := &crypt.Device{}
+	return cryptDev.DeferredClose(filepath.Base(arguments.Device))
+}
+
+// VerityOpen maps an image through a dm-verity device and returns
+// the device path.
+func (t *Methods) VerityOpen(arguments *args.VerityArgs, reply *string) (err error) {
+	*reply, err = verity.Open(arguments.Data, arguments.Hash, arguments.RootHash)
 	return err
 }
 
@@ -150,28 +485,46 @@ func (t *Methods) Chroot(arguments *args.ChrootArgs, reply *int) error {
 
 // LoopDevice attaches a loop device with the specified arguments.
 func (t *Methods) LoopDevice(arguments *args.LoopArgs, reply *int) error {
-	var image *os.File
+	image, err := openImage(arguments.Image, arguments.Mode)
+	if err != nil {
+		return err
+	}
 
-	loopdev := &loop.Device{}
-	loopdev.MaxLoopDevices = arguments.MaxDevices
-	loopdev.Info = &arguments.Info
-	loopdev.Shared = arguments.Shared
+	*reply, err = attachLoop(image, arguments.Mode, &arguments.Info, arguments.MaxDevices, arguments.Shared)
+	if err != nil {
+		// encode error code, net/rpc only transmits error messages
+		return errcode.Encode(errcode.Wrap(errcode.Unknown, err, "could not attach image file to loop device"))
+	}
+	return nil
+}
 
-	if strings.HasPrefix(arguments.Image, "/proc/self/fd/") {
-		strFd := strings.TrimPrefix(arguments.Image, "/proc/self/fd/")
+// openImage returns the image file referenced by path, path may
+// reference a file descriptor of the engine with /proc/self/fd.
+func openImage(path string, mode int) (*os.File, error) {
+	if strings.HasPrefix(path, "/proc/self/fd/") {
+		strFd := strings.TrimPrefix(path, "/proc/self/fd/")
 		fd, err := strconv.ParseUint(strFd, 10, 32)
 		if err != nil {
-			return fmt.Errorf("failed to convert image file descriptor: %v", err)
-		}
-		image = os.NewFile(uintptr(fd), "")
-	} else {
-		var err error
-		image, err = os.OpenFile(arguments.Image, arguments.Mode, 0600)
-		if err != nil {
-			return fmt.Errorf("could not open image file: %v", err)
+			return nil, fmt.Errorf("failed to convert image file descriptor: %v", err)
 		}
+		return os.NewFile(uintptr(fd), ""), nil
 	}
 
+	image, err := os.OpenFile(path, mode, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open image file: %v", err)
+	}
+	return image, nil
+}
+
+// attachLoop attaches image to a loop device and returns the loop
+// device number.
+func attachLoop(image *os.File, mode int, info *loop.Info64, maxDevices int, shared bool) (int, error) {
+	loopdev := &loop.Device{}
+	loopdev.MaxLoopDevices = maxDevices
+	loopdev.Info = info
+	loopdev.Shared = shared
+
 	if diskGID == -1 {
 		if gr, err := user.GetGrNam("disk"); err == nil {
 			diskGID = int(gr.GID)
@@ -187,11 +540,60 @@ func (t *Methods) LoopDevice(arguments *args.LoopArgs, reply *int) error {
 	defer syscall.Setfsuid(os.Getuid())
 	defer syscall.Setfsgid(os.Getgid())
 
-	err := loopdev.AttachFromFile(image, arguments.Mode, reply)
+	var number int
+	err := loopdev.AttachFromFile(image, mode, &number)
+	return number, err
+}
+
+// VerityMount attaches the image partition and its dm-verity hash tree
+// to loop devices, maps them through a dm-verity device checking the
+// partition integrity against the root hash and mounts the device on
+// the target. It returns the dm-verity device path.
+func (t *Methods) VerityMount(arguments *args.VerityMountArgs, reply *string) error {
+	image, err := openImage(arguments.Image, os.O_RDONLY)
 	if err != nil {
-		return fmt.Errorf("could not attach image file to loop device: %v", err)
+		return err
 	}
-	return nil
+	// image is referenced by both loop devices
+	defer runtime.KeepAlive(image)
+
+	devices := make([]string, 2)
+	for i, section := range []struct {
+		offset uint64
+		size   uint64
+	}{
+		{arguments.Offset, arguments.Size},
+		{arguments.HashOffset, arguments.HashSize},
+	} {
+		info := &loop.Info64{
+			Offset:    section.offset,
+			SizeLimit: section.size,
+			Flags:     loop.FlagsAutoClear | loop.FlagsReadOnly,
+		}
+		number, err := attachLoop(image, os.O_RDONLY, info, arguments.MaxDevices, false)
+		if err != nil {
+			return errcode.Encode(errcode.Wrap(errcode.Unknown, err, "could not attach image file to loop device"))
+		}
+		devices[i] = fmt.Sprintf("/dev/loop%d", number)
+	}
+
+	*reply, err = verity.Open(devices[0], devices[1], arguments.RootHash)
+	if err != nil {
+		return err
+	}
+
+	mainthread.Execute(func() {
+		err = syscall.Mount(*reply, arguments.Target, arguments.Filesystem, arguments.Mountflags|syscall.MS_RDONLY, "")
+	})
+	if err != nil {
+		err = fmt.Errorf("could not mount %s: %s", *reply, err)
+	}
+
+	// the device is removed once unmounted by all containers using it
+	if cerr := verity.CloseDeferred(arguments.RootHash); cerr != nil {
+		sylog.Debugf("%s", cerr)
+	}
+	return err
 }
 
 // SetHostname sets hostname with the specified arguments.
@@ -0,0 +1,90 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/singularity/rpc"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/bin"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+// rootfsVerity returns the dm-verity hash tree of the root filesystem
+// image if it must be mounted through a dm-verity device according to
+// the "sif verity" directive. The root hash is stored unsigned in the
+// image, it's only trusted when covered by a signature verified with the
+// execution control list keyring. With "yes", images are mounted without
+// dm-verity when the root hash is not trusted or veritysetup is missing.
+func (c *container) rootfsVerity(img *image.Image) (*image.Verity, error) {
+	mode := c.engine.EngineConfig.File.SifVerity
+	if mode == "no" || img.Type != image.SIF {
+		return nil, nil
+	}
+
+	v, err := image.GetVerity(img)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v == nil && mode == "require":
+		return nil, fmt.Errorf("SIF image %s has no dm-verity hash tree, required by configuration", img.Path)
+	case v == nil:
+		return nil, nil
+	case img.Writable:
+		return nil, fmt.Errorf("SIF image %s with a dm-verity hash tree can't be writable", img.Path)
+	case c.userNS && mode == "require":
+		return nil, fmt.Errorf("dm-verity devices can't be set up in a user namespace")
+	case c.userNS:
+		sylog.Verbosef("Ignoring dm-verity hash tree of %s in a user namespace", img.Path)
+		return nil, nil
+	case v.RootHash != c.engine.EngineConfig.GetVerityRootHash() && mode == "require":
+		return nil, fmt.Errorf("dm-verity root hash of %s is not covered by a signature verified with the execution control list keyring", img.Path)
+	case v.RootHash != c.engine.EngineConfig.GetVerityRootHash():
+		sylog.Verbosef("Ignoring dm-verity hash tree of %s, its root hash is not covered by a verified signature", img.Path)
+		return nil, nil
+	}
+
+	if _, err := bin.Veritysetup(); err != nil {
+		if mode == "require" {
+			return nil, fmt.Errorf("dm-verity required by configuration: %s", err)
+		}
+		sylog.Warningf("Mounting %s without dm-verity: %s", img.Path, err)
+		return nil, nil
+	}
+	return v, nil
+}
+
+// addVerityMount registers the mount of the root filesystem partition of
+// img through a dm-verity device.
+func (c *container) addVerityMount(system *mount.System, img *image.Image, v *image.Verity, flags uintptr) error {
+	return system.RunBeforeTag(mount.RootfsTag, func(system *mount.System) error {
+		part := img.Partitions[0]
+		arguments := &rpc.VerityMountArgs{
+			Image:      img.Source,
+			Offset:     part.Offset,
+			Size:       part.Size,
+			HashOffset: v.HashOffset,
+			HashSize:   v.HashSize,
+			RootHash:   v.RootHash,
+			Target:     c.session.RootFsPath(),
+			Filesystem: "squashfs",
+			Mountflags: flags | syscall.MS_RDONLY,
+			MaxDevices: int(c.engine.EngineConfig.File.MaxLoopDevices),
+		}
+
+		dev, err := c.rpcOps.VerityMount(arguments)
+		if err != nil {
+			return fmt.Errorf("while mounting %s with dm-verity: %s", img.Path, err)
+		}
+		sylog.Debugf("Mounted root filesystem of %s verified by %s", img.Path, dev)
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package launch builds the singularity engine configuration of a container,
+// it's shared by the action commands and the launcher package so that both
+// start containers the same way.
+package launch
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// Namespaces selects the namespaces created for a container.
+type Namespaces struct {
+	User bool
+	PID  bool
+	IPC  bool
+	Net  bool
+	UTS  bool
+}
+
+// Config holds the singularity engine configuration of a container and
+// the generator of its OCI configuration.
+type Config struct {
+	Engine    *singularityConfig.EngineConfig
+	Generator *generate.Generator
+}
+
+// NewConfig returns an engine configuration for the singularity.conf
+// configuration fileConfig, the container process executes args.
+func NewConfig(fileConfig *singularityConfig.FileConfig, args []string) *Config {
+	engineConfig := singularityConfig.NewConfig()
+	engineConfig.File = fileConfig
+
+	ociConfig := &oci.Config{}
+	engineConfig.OciConfig = ociConfig
+
+	c := &Config{
+		Engine:    engineConfig,
+		Generator: &generate.Generator{Config: &ociConfig.Spec},
+	}
+	c.Generator.SetProcessArgs(args)
+
+	return c
+}
+
+// SetImage sets the container image from its path and the corresponding
+// container environment variables.
+func (c *Config) SetImage(image string) error {
+	abspath, err := filepath.Abs(image)
+	if err != nil {
+		return fmt.Errorf("failed to determine image absolute path for %s: %s", image, err)
+	}
+	c.Generator.AddProcessEnv("SINGULARITY_CONTAINER", abspath)
+	c.Generator.AddProcessEnv("SINGULARITY_NAME", filepath.Base(abspath))
+	c.Engine.SetImage(abspath)
+	return nil
+}
+
+// SetHome sets the home directory source and destination from the
+// specification src[:dest].
+func (c *Config) SetHome(spec string) error {
+	homeSlice := strings.Split(spec, ":")
+	if len(homeSlice) > 2 || len(homeSlice) == 0 {
+		return fmt.Errorf("home argument has incorrect number of elements: %v", len(homeSlice))
+	}
+	c.Engine.SetHomeSource(homeSlice[0])
+	c.Engine.SetHomeDest(homeSlice[len(homeSlice)-1])
+	return nil
+}
+
+// AddNamespaces adds the namespaces ns to the container, the user ID uid
+// and the group ID gid are mapped in the user namespace when mapIDs is set.
+// The network of the network namespace is set separately.
+func (c *Config) AddNamespaces(ns Namespaces, uid, gid uint32, mapIDs bool) {
+	if ns.Net {
+		c.Generator.AddOrReplaceLinuxNamespace("network", "")
+	}
+	if ns.UTS {
+		c.Generator.AddOrReplaceLinuxNamespace("uts", "")
+	}
+	if ns.PID {
+		c.Generator.AddOrReplaceLinuxNamespace("pid", "")
+	}
+	if ns.IPC {
+		c.Generator.AddOrReplaceLinuxNamespace("ipc", "")
+	}
+	if ns.User {
+		c.Generator.AddOrReplaceLinuxNamespace("user", "")
+		if mapIDs {
+			c.Generator.AddLinuxUIDMapping(uid, uid, 1)
+			c.Generator.AddLinuxGIDMapping(gid, gid, 1)
+		}
+	}
+}
+
+// SetEnv sets the container environment from the host environment
+// environ, only variables prefixed with SINGULARITYENV_ are kept when
+// cleanEnv is set. The home directory must be set before.
+func (c *Config) SetEnv(environ []string, cleanEnv bool) {
+	env.SetContainerEnv(c.Generator, environ, cleanEnv, c.Engine.GetHomeDest())
+}
+
+// SetCwd sets the container process working directory to cwd if not
+// empty, or to the home directory of contained containers, or to the
+// host working directory hostCwd.
+func (c *Config) SetCwd(cwd, hostCwd string) {
+	switch {
+	case cwd != "":
+		c.Generator.SetProcessCwd(cwd)
+	case c.Engine.GetContain():
+		c.Generator.SetProcessCwd(c.Engine.GetHomeDest())
+	default:
+		c.Generator.SetProcessCwd(hostCwd)
+	}
+}
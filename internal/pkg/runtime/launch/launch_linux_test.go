@@ -0,0 +1,91 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launch
+
+import (
+	"testing"
+
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+func TestSetHome(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		source  string
+		dest    string
+		wantErr bool
+	}{
+		{name: "Source", spec: "/home/tester", source: "/home/tester", dest: "/home/tester"},
+		{name: "SourceDest", spec: "/data/tester:/home/tester", source: "/data/tester", dest: "/home/tester"},
+		{name: "TooManyElements", spec: "/a:/b:/c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(&singularityConfig.FileConfig{}, nil)
+			err := c.SetHome(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if c.Engine.GetHomeSource() != tt.source || c.Engine.GetHomeDest() != tt.dest {
+				t.Errorf("got %s:%s, expected %s:%s", c.Engine.GetHomeSource(), c.Engine.GetHomeDest(), tt.source, tt.dest)
+			}
+		})
+	}
+}
+
+func TestSetCwd(t *testing.T) {
+	tests := []struct {
+		name     string
+		cwd      string
+		contain  bool
+		expected string
+	}{
+		{name: "Cwd", cwd: "/work", contain: true, expected: "/work"},
+		{name: "Contain", contain: true, expected: "/home/tester"},
+		{name: "Host", expected: "/host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig(&singularityConfig.FileConfig{}, nil)
+			c.Engine.SetHomeDest("/home/tester")
+			c.Engine.SetContain(tt.contain)
+			c.SetCwd(tt.cwd, "/host")
+			if cwd := c.Generator.Config.Process.Cwd; cwd != tt.expected {
+				t.Errorf("got working directory %s, expected %s", cwd, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAddNamespaces(t *testing.T) {
+	c := NewConfig(&singularityConfig.FileConfig{}, nil)
+	c.AddNamespaces(Namespaces{User: true, PID: true}, 1000, 1000, true)
+
+	types := make(map[string]bool)
+	for _, ns := range c.Generator.Config.Linux.Namespaces {
+		types[string(ns.Type)] = true
+	}
+	if len(types) != 2 || !types["user"] || !types["pid"] {
+		t.Errorf("unexpected namespaces: %v", c.Generator.Config.Linux.Namespaces)
+	}
+	if m := c.Generator.Config.Linux.UIDMappings; len(m) != 1 || m[0].HostID != 1000 || m[0].ContainerID != 1000 {
+		t.Errorf("unexpected UID mappings: %v", m)
+	}
+
+	c = NewConfig(&singularityConfig.FileConfig{}, nil)
+	c.AddNamespaces(Namespaces{User: true}, 1000, 1000, false)
+	if len(c.Generator.Config.Linux.UIDMappings) != 0 {
+		t.Errorf("IDs mapped in user namespace")
+	}
+}
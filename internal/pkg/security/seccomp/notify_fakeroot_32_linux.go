@@ -0,0 +1,23 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build 386 arm
+
+package seccomp
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	// 32-bit user and group IDs variants used by the C library
+	for _, nr := range []int32{
+		unix.SYS_CHOWN32, unix.SYS_FCHOWN32, unix.SYS_LCHOWN32,
+		unix.SYS_SETUID32, unix.SYS_SETGID32, unix.SYS_SETREUID32, unix.SYS_SETREGID32,
+		unix.SYS_SETRESUID32, unix.SYS_SETRESGID32, unix.SYS_SETGROUPS32,
+	} {
+		fakerootHandlers[nr] = fakeSuccess
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !arm64,!riscv64
+
+package seccomp
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	fakerootHandlers[unix.SYS_CHOWN] = fakeSuccess
+	fakerootHandlers[unix.SYS_LCHOWN] = fakeSuccess
+	fakerootHandlers[unix.SYS_MKNOD] = func(req *NotifyRequest) (int64, syscall.Errno) {
+		return fakeMknod(req, unix.AT_FDCWD, req.Args[0], uint32(req.Args[1]), req.Args[2])
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// fakerootSyscalls are the syscalls emulated for processes running as
+// root in a user namespace where only the user ID and group ID are mapped,
+// names unknown to the native architecture are ignored.
+var fakerootSyscalls = []string{
+	"chown", "fchown", "lchown", "fchownat",
+	"setuid", "setgid", "setreuid", "setregid", "setresuid", "setresgid", "setgroups",
+	"chown32", "fchown32", "lchown32",
+	"setuid32", "setgid32", "setreuid32", "setregid32", "setresuid32", "setresgid32", "setgroups32",
+	"mknod", "mknodat",
+}
+
+// deviceWarning is used to warn only once that device nodes are
+// created as empty regular files.
+var deviceWarning sync.Once
+
+// fakerootHandlers are the handlers of fakerootSyscalls.
+var fakerootHandlers = make(map[int32]NotifyHandler)
+
+func init() {
+	// no other user or group exists in the user namespace, ownership
+	// and credentials changes are reported as successful while files
+	// and processes keep the mapped user and group. Credentials are not
+	// emulated, the get*id syscalls still report root after a faked
+	// credentials change, programs dropping privileges and checking the
+	// result like APT must be configured to not drop them
+	for _, nr := range []int32{
+		unix.SYS_FCHOWN, unix.SYS_FCHOWNAT,
+		unix.SYS_SETUID, unix.SYS_SETGID, unix.SYS_SETREUID, unix.SYS_SETREGID,
+		unix.SYS_SETRESUID, unix.SYS_SETRESGID, unix.SYS_SETGROUPS,
+	} {
+		fakerootHandlers[nr] = fakeSuccess
+	}
+	fakerootHandlers[unix.SYS_MKNODAT] = func(req *NotifyRequest) (int64, syscall.Errno) {
+		return fakeMknod(req, int(int32(req.Args[0])), req.Args[1], uint32(req.Args[2]), req.Args[3])
+	}
+}
+
+// FakerootProfile returns a seccomp profile reporting the syscalls requiring
+// privileges over other users and groups to the notification listener, it's
+// used along with FakerootNotifyHandlers for processes running as root in a
+// user namespace mapping only the user ID and group ID.
+func FakerootProfile() *specs.LinuxSeccomp {
+	return &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names:  fakerootSyscalls,
+				Action: ActNotify,
+			},
+		},
+	}
+}
+
+// FakerootNotifyHandlers returns the handlers emulating the syscalls reported
+// by the FakerootProfile filter.
+func FakerootNotifyHandlers() map[int32]NotifyHandler {
+	return fakerootHandlers
+}
+
+func fakeSuccess(req *NotifyRequest) (int64, syscall.Errno) {
+	return 0, 0
+}
+
+// fakeMknod creates the node requested by the calling process, device nodes
+// are replaced by empty regular files as they can't be created without
+// privileges, which is enough for package managers extracting them but
+// they are not usable as devices in the resulting image.
+func fakeMknod(req *NotifyRequest, dirfd int, pathAddr uint64, mode uint32, dev uint64) (int64, syscall.Errno) {
+	path, err := req.ReadString(pathAddr, unix.PathMax)
+	if err != nil {
+		sylog.Debugf("mknod emulation: %s", err)
+		return -1, syscall.EFAULT
+	}
+
+	umask, err := req.umask()
+	if err != nil {
+		sylog.Debugf("mknod emulation: %s", err)
+		return -1, syscall.EPERM
+	}
+	perm := mode &^ unix.S_IFMT &^ umask
+
+	parent, base, errno := req.openParent(dirfd, path)
+	if errno != 0 {
+		return -1, errno
+	}
+	defer unix.Close(parent)
+
+	switch mode & unix.S_IFMT {
+	case unix.S_IFCHR, unix.S_IFBLK:
+		fd, err := unix.Openat(parent, base, unix.O_CREAT|unix.O_EXCL|unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, perm)
+		if err != nil {
+			return -1, toErrno(err)
+		}
+		unix.Close(fd)
+		deviceWarning.Do(func() {
+			sylog.Warningf("Device nodes can't be created with fakeroot without subordinate IDs, they are replaced by empty regular files")
+		})
+		sylog.Debugf("Created regular file %s in place of device %d:%d on behalf of process %d", path, unix.Major(dev), unix.Minor(dev), req.Pid)
+	case 0, unix.S_IFREG, unix.S_IFIFO, unix.S_IFSOCK:
+		if err := unix.Mknodat(parent, base, mode&unix.S_IFMT|perm, 0); err != nil {
+			return -1, toErrno(err)
+		}
+	default:
+		return -1, syscall.EINVAL
+	}
+
+	return 0, 0
+}
+
+// umask returns the file mode creation mask of the calling process.
+func (r *NotifyRequest) umask() (uint32, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", r.Pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "Umask:" {
+			continue
+		}
+		umask, err := strconv.ParseUint(fields[1], 8, 32)
+		if err != nil {
+			return 0, err
+		}
+		return uint32(umask), nil
+	}
+	return 0, fmt.Errorf("no umask found for process %d", r.Pid)
+}
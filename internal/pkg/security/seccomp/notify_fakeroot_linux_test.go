@@ -0,0 +1,122 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// fakerootNotifiedSyscalls runs the emulated syscalls with the notification filter
+// loaded on a dedicated thread, the thread is terminated with the goroutine.
+func fakerootNotifiedSyscalls(dir string, listener chan<- int) error {
+	nrs := []uint32{unix.SYS_FCHOWNAT, unix.SYS_SETRESUID, unix.SYS_SETGROUPS, unix.SYS_MKNODAT}
+
+	fd, err := loadNotifyFilter(nrs, true)
+	if err != nil {
+		close(listener)
+		return err
+	}
+	listener <- fd
+
+	if err := unix.Fchownat(unix.AT_FDCWD, dir, 4242, 4242, 0); err != nil {
+		return fmt.Errorf("unexpected chown error: %s", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SETRESUID, 4242, 4242, 4242); errno != 0 {
+		return fmt.Errorf("unexpected setresuid error: %s", errno)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SETGROUPS, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("unexpected setgroups error: %s", errno)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		mode  uint32
+		dev   uint64
+		errno syscall.Errno
+	}{
+		{"block device", "sda", unix.S_IFBLK | 0660, unix.Mkdev(8, 0), 0},
+		{"character device", "null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), 0},
+		{"fifo", "fifo", unix.S_IFIFO | 0600, 0, 0},
+		{"existing", "null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), syscall.EEXIST},
+		{"missing directory", "missing/null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), syscall.ENOENT},
+		{"bad type", "dir", unix.S_IFDIR | 0755, 0, syscall.EINVAL},
+	}
+
+	for _, tt := range tests {
+		err := unix.Mknodat(unix.AT_FDCWD, dir+"/"+tt.path, tt.mode, int(tt.dev))
+		if tt.errno == 0 && err != nil {
+			return fmt.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if tt.errno != 0 && err != tt.errno {
+			return fmt.Errorf("%s: got %v, expected %s", tt.name, err, tt.errno)
+		}
+	}
+	return nil
+}
+
+func TestFakerootNotifyHandlers(t *testing.T) {
+	if _, ok := auditArch[runtime.GOARCH]; !ok {
+		t.Skipf("seccomp notifications not supported on %s", runtime.GOARCH)
+	}
+
+	dir, err := ioutil.TempDir("", "notify-fakeroot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	errChan := make(chan error, 1)
+	listener := make(chan int, 1)
+
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		close(ready)
+		if fd, ok := <-listener; ok {
+			ServeNotifyHandlers(fd, FakerootNotifyHandlers())
+		}
+	}()
+	<-ready
+
+	go func() {
+		runtime.LockOSThread()
+		errChan <- fakerootNotifiedSyscalls(dir, listener)
+	}()
+
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+
+	oldMask := unix.Umask(0)
+	unix.Umask(oldMask)
+
+	nodes := []struct {
+		name string
+		mode uint32
+	}{
+		{"sda", unix.S_IFREG | 0660},
+		{"null", unix.S_IFREG | 0666},
+		{"fifo", unix.S_IFIFO | 0600},
+	}
+	for _, n := range nodes {
+		var st unix.Stat_t
+
+		if err := unix.Lstat(filepath.Join(dir, n.name), &st); err != nil {
+			t.Fatal(err)
+		}
+		if mode := n.mode &^ uint32(oldMask); st.Mode != mode {
+			t.Errorf("%s has mode %o, expected %o", n.name, st.Mode, mode)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// ActNotify is the seccomp action reporting a syscall to a notification
+// listener which executes it on behalf of the calling process, it's not
+// part of the OCI runtime specification yet.
+const ActNotify specs.LinuxSeccompAction = "SCMP_ACT_NOTIFY"
+
+const (
+	seccompSetModeFilter         = 1
+	seccompFilterFlagNewListener = 1 << 3
+	seccompRetUserNotif          = 0x7fc00000
+	seccompRetAllow              = 0x7fff0000
+	// maxNotifySyscalls keeps filter jumps within 8 bits offsets.
+	maxNotifySyscalls = 250
+)
+
+// auditArch is the native architecture as reported in seccomp data,
+// notifications are only supported on architectures using the generic
+// ioctl request encoding.
+var auditArch = map[string]uint32{
+	"386":   0x40000003,
+	"amd64": 0xc000003e,
+	"arm":   0x40000028,
+	"arm64": 0xc00000b7,
+	"s390x": 0x80000016,
+}
+
+// seccompData is the kernel struct seccomp_data.
+type seccompData struct {
+	Nr                 int32
+	Arch               uint32
+	InstructionPointer uint64
+	Args               [6]uint64
+}
+
+// seccompNotif is the kernel struct seccomp_notif.
+type seccompNotif struct {
+	ID    uint64
+	Pid   uint32
+	Flags uint32
+	Data  seccompData
+}
+
+// seccompNotifResp is the kernel struct seccomp_notif_resp.
+type seccompNotifResp struct {
+	ID    uint64
+	Val   int64
+	Error int32
+	Flags uint32
+}
+
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | '!'<<8 | nr
+}
+
+var (
+	ioctlNotifRecv = ioc(3, 0, unsafe.Sizeof(seccompNotif{}))
+	ioctlNotifSend = ioc(3, 1, unsafe.Sizeof(seccompNotifResp{}))
+	// first kernels with notification support only accept the
+	// original read direction, newer ones accept both
+	ioctlNotifIDValid = ioc(2, 2, 8)
+)
+
+// NotifyRequest is a syscall reported to the notification listener.
+type NotifyRequest struct {
+	// Pid is the PID of the calling process.
+	Pid int
+	// Nr is the syscall number.
+	Nr int32
+	// Args are the syscall arguments.
+	Args [6]uint64
+
+	id uint64
+	fd int
+}
+
+// NotifyHandler executes the syscall of a notification on behalf of the
+// calling process, it returns the syscall return value or the error number
+// reported to the calling process.
+type NotifyHandler func(req *NotifyRequest) (int64, syscall.Errno)
+
+var notifyHandlers = make(map[int32]NotifyHandler)
+
+// notifyLoaded is set once the notification filter is loaded in the
+// current process.
+var notifyLoaded bool
+
+// RegisterNotifyHandler registers the handler executing the syscall number
+// nr, notified syscalls without handler fail with EPERM.
+func RegisterNotifyHandler(nr int32, h NotifyHandler) error {
+	if _, ok := notifyHandlers[nr]; ok {
+		return fmt.Errorf("a notification handler is already registered for syscall %d", nr)
+	}
+	notifyHandlers[nr] = h
+	return nil
+}
+
+// Valid returns if the calling process is still waiting for the
+// notification response, it must be checked after any access to the
+// calling process resources to guard against PID reuse.
+func (r *NotifyRequest) Valid() bool {
+	id := r.id
+	_, _, err := unix.Syscall(unix.SYS_IOCTL, uintptr(r.fd), ioctlNotifIDValid, uintptr(unsafe.Pointer(&id)))
+	return err == 0
+}
+
+// ReadString reads a NUL terminated string of at most max bytes at the
+// address addr of the calling process memory.
+func (r *NotifyRequest) ReadString(addr uint64, max int) (string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/mem", r.Pid))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if !r.Valid() {
+		return "", fmt.Errorf("process %d is not waiting for notification anymore", r.Pid)
+	}
+
+	buf := make([]byte, max)
+	// reads stop at the first unmapped page
+	n, _ := f.ReadAt(buf, int64(addr))
+
+	i := bytes.IndexByte(buf[:n], 0)
+	if i < 0 {
+		return "", fmt.Errorf("no string found at address 0x%x", addr)
+	}
+	return string(buf[:i]), nil
+}
+
+// fsIDs returns the filesystem user and group IDs and the supplementary
+// groups of the calling process.
+func (r *NotifyRequest) fsIDs() (int, int, []int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", r.Pid))
+	if err != nil {
+		return -1, -1, nil, err
+	}
+	defer f.Close()
+
+	ids := make(map[string]int)
+	var groups []int
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == "Groups:" {
+			for _, g := range fields[1:] {
+				id, err := strconv.Atoi(g)
+				if err != nil {
+					return -1, -1, nil, err
+				}
+				groups = append(groups, id)
+			}
+			continue
+		}
+		if len(fields) != 5 || (fields[0] != "Uid:" && fields[0] != "Gid:") {
+			continue
+		}
+		// real, effective, saved set and filesystem IDs
+		id, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return -1, -1, nil, err
+		}
+		ids[fields[0]] = id
+	}
+	uid, okUID := ids["Uid:"]
+	gid, okGID := ids["Gid:"]
+	if !okUID || !okGID {
+		return -1, -1, nil, fmt.Errorf("no filesystem IDs found for process %d", r.Pid)
+	}
+	return uid, gid, groups, nil
+}
+
+// loadNotifyFilter loads a filter reporting the syscall numbers nrs of
+// the native architecture to a listener and returns the listener file
+// descriptor, other syscalls are left to the filters loaded afterward.
+func loadNotifyFilter(nrs []uint32, noNewPrivs bool) (int, error) {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return -1, fmt.Errorf("%s is not supported on %s", ActNotify, runtime.GOARCH)
+	}
+	if len(nrs) > maxNotifySyscalls {
+		return -1, fmt.Errorf("too many syscalls with %s action", ActNotify)
+	}
+
+	n := uint8(len(nrs))
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 4},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: n + 1, K: arch},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+	}
+	for i, nr := range nrs {
+		filter = append(filter, unix.SockFilter{
+			Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K,
+			Jt:   n - uint8(i),
+			K:    nr,
+		})
+	}
+	filter = append(filter,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetAllow},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetUserNotif},
+	)
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	if noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return -1, fmt.Errorf("failed to set no new privs flag: %s", err)
+		}
+	}
+
+	fd, _, err := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagNewListener, uintptr(unsafe.Pointer(&prog)))
+	if err != 0 {
+		return -1, fmt.Errorf("failed to load notification filter: %s", err)
+	}
+	notifyLoaded = true
+
+	return int(fd), nil
+}
+
+// ServeNotify services the syscall notifications received on the listener
+// file descriptor fd with the registered handlers until the listener is
+// closed or returns an error.
+func ServeNotify(fd int) error {
+	return ServeNotifyHandlers(fd, notifyHandlers)
+}
+
+// ServeNotifyHandlers services the syscall notifications received on the
+// listener file descriptor fd with handlers instead of the registered ones.
+func ServeNotifyHandlers(fd int, handlers map[int32]NotifyHandler) error {
+	defer unix.Close(fd)
+
+	arch := auditArch[runtime.GOARCH]
+
+	for {
+		var notif seccompNotif
+
+		_, _, err := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), ioctlNotifRecv, uintptr(unsafe.Pointer(&notif)))
+		if err == unix.EINTR || err == unix.ENOENT {
+			// interrupted or calling process killed in between
+			continue
+		} else if err != 0 {
+			return fmt.Errorf("while receiving seccomp notification: %s", err)
+		}
+
+		resp := seccompNotifResp{ID: notif.ID}
+
+		req := &NotifyRequest{
+			Pid:  int(notif.Pid),
+			Nr:   notif.Data.Nr,
+			Args: notif.Data.Args,
+			id:   notif.ID,
+			fd:   fd,
+		}
+
+		h, ok := handlers[req.Nr]
+		if !ok || notif.Data.Arch != arch {
+			sylog.Debugf("No handler for syscall %d notified by process %d", req.Nr, req.Pid)
+			resp.Error = -int32(syscall.EPERM)
+		} else {
+			val, errno := h(req)
+			if errno != 0 {
+				resp.Error = -int32(errno)
+			} else {
+				resp.Val = val
+			}
+		}
+
+		_, _, err = unix.Syscall(unix.SYS_IOCTL, uintptr(fd), ioctlNotifSend, uintptr(unsafe.Pointer(&resp)))
+		if err != 0 && err != unix.ENOENT {
+			return fmt.Errorf("while sending seccomp notification response: %s", err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// notifiedSyscalls runs the syscalls with the notification filter loaded
+// on a dedicated thread, the thread is terminated with the goroutine.
+func notifiedSyscalls(dir string, listener chan<- int) error {
+	const handled = 4242
+
+	fd, err := loadNotifyFilter([]uint32{unix.SYS_GETPGID, unix.SYS_MKNODAT}, true)
+	if err != nil {
+		close(listener)
+		return err
+	}
+	listener <- fd
+
+	if r, _, errno := unix.Syscall(unix.SYS_GETPGID, 0, 0, 0); errno != 0 || r != handled {
+		return fmt.Errorf("getpgid returned %d (%s), expected %d", r, errno, handled)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_GETPGID, 1, 0, 0); errno != syscall.ESRCH {
+		return fmt.Errorf("getpgid returned %s, expected %s", errno, syscall.ESRCH)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		mode  uint32
+		dev   uint64
+		errno syscall.Errno
+	}{
+		{"block device", "sda", unix.S_IFBLK | 0600, unix.Mkdev(8, 0), syscall.EPERM},
+		{"character device", "mem", unix.S_IFCHR | 0600, unix.Mkdev(1, 1), syscall.EPERM},
+		{"symlink", "link/null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), syscall.ENOTDIR},
+		{"parent reference", "dir/../null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), syscall.EPERM},
+		{"missing directory", "missing/null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), syscall.ENOENT},
+	}
+	if os.Getuid() == 0 {
+		tests = append(tests, struct {
+			name  string
+			path  string
+			mode  uint32
+			dev   uint64
+			errno syscall.Errno
+		}{"null device", "dir/null", unix.S_IFCHR | 0666, unix.Mkdev(1, 3), 0})
+	}
+
+	for _, tt := range tests {
+		err := unix.Mknodat(unix.AT_FDCWD, dir+"/"+tt.path, tt.mode, int(tt.dev))
+		if tt.errno == 0 && err != nil {
+			return fmt.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if tt.errno != 0 && err != tt.errno {
+			return fmt.Errorf("%s: got %v, expected %s", tt.name, err, tt.errno)
+		}
+	}
+	return nil
+}
+
+func TestServeNotify(t *testing.T) {
+	if _, ok := auditArch[runtime.GOARCH]; !ok {
+		t.Skipf("seccomp notifications not supported on %s", runtime.GOARCH)
+	}
+
+	if err := RegisterNotifyHandler(unix.SYS_GETPGID, func(req *NotifyRequest) (int64, syscall.Errno) {
+		if req.Args[0] != 0 {
+			return -1, syscall.ESRCH
+		}
+		return 4242, 0
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(notifyHandlers, unix.SYS_GETPGID)
+
+	if err := RegisterNotifyHandler(unix.SYS_GETPGID, nil); err == nil {
+		t.Errorf("unexpected success while registering a handler twice")
+	}
+
+	dir, err := ioutil.TempDir("", "notify-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	errChan := make(chan error, 1)
+	listener := make(chan int, 1)
+
+	// handlers run on a thread created before the filter is loaded,
+	// threads created afterward by the filtered thread inherit it
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		close(ready)
+		if fd, ok := <-listener; ok {
+			ServeNotify(fd)
+		}
+	}()
+	<-ready
+
+	go func() {
+		runtime.LockOSThread()
+		errChan <- notifiedSyscalls(dir, listener)
+	}()
+
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getuid() == 0 {
+		var st unix.Stat_t
+
+		if err := unix.Lstat(filepath.Join(dir, "dir", "null"), &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFCHR || st.Rdev != unix.Mkdev(1, 3) {
+			t.Errorf("dir/null is not the null character device")
+		}
+	}
+}
+
+func TestMayCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   uint32
+		uid    int
+		gid    int
+		groups []int
+		allow  bool
+	}{
+		{"root", 0555, 0, 0, nil, true},
+		{"owner", 0755, 1000, 1000, nil, true},
+		{"read-only owner", 0577, 1000, 1000, nil, false},
+		{"group", 0570, 1001, 100, nil, true},
+		{"supplementary group", 0570, 1001, 1001, []int{10, 100}, true},
+		{"read-only group", 0757, 1001, 100, nil, false},
+		{"other", 0773, 1001, 1001, nil, true},
+		{"read-only other", 0775, 1001, 1001, []int{10}, false},
+		{"not searchable", 0776, 1001, 1001, nil, false},
+	}
+
+	for _, tt := range tests {
+		st := unix.Stat_t{Mode: unix.S_IFDIR | tt.mode, Uid: 1000, Gid: 100}
+		if allow := mayCreate(&st, tt.uid, tt.gid, tt.groups); allow != tt.allow {
+			t.Errorf("%s: got %v, expected %v", tt.name, allow, tt.allow)
+		}
+	}
+}
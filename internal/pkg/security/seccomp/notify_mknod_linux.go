@@ -0,0 +1,188 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/priv"
+	"golang.org/x/sys/unix"
+)
+
+// mknodDevices are the character devices created on behalf of containers
+// calling mknod, they don't grant any access not already granted to users.
+var mknodDevices = map[uint64]string{
+	unix.Mkdev(0, 0): "whiteout",
+	unix.Mkdev(1, 3): "null",
+	unix.Mkdev(1, 5): "zero",
+	unix.Mkdev(1, 7): "full",
+	unix.Mkdev(1, 8): "random",
+	unix.Mkdev(1, 9): "urandom",
+	unix.Mkdev(5, 0): "tty",
+}
+
+func init() {
+	RegisterNotifyHandler(unix.SYS_MKNODAT, func(req *NotifyRequest) (int64, syscall.Errno) {
+		return emulateMknod(req, int(int32(req.Args[0])), req.Args[1], uint32(req.Args[2]), req.Args[3])
+	})
+}
+
+// emulateMknod creates the character device node requested by the calling
+// process if it's one of the allowed devices, the node is owned by the
+// calling process filesystem user and group.
+func emulateMknod(req *NotifyRequest, dirfd int, pathAddr uint64, mode uint32, dev uint64) (int64, syscall.Errno) {
+	name, ok := mknodDevices[dev]
+	if mode&unix.S_IFMT != unix.S_IFCHR || !ok {
+		return -1, syscall.EPERM
+	}
+
+	path, err := req.ReadString(pathAddr, unix.PathMax)
+	if err != nil {
+		sylog.Debugf("mknod emulation: %s", err)
+		return -1, syscall.EFAULT
+	}
+
+	uid, gid, groups, err := req.fsIDs()
+	if err != nil {
+		sylog.Debugf("mknod emulation: %s", err)
+		return -1, syscall.EPERM
+	}
+
+	parent, base, errno := req.openParent(dirfd, path)
+	if errno != 0 {
+		return -1, errno
+	}
+	defer unix.Close(parent)
+
+	// the calling process must be allowed to create the node, access
+	// is checked against its filesystem IDs, not the IDs of this process
+	var st unix.Stat_t
+	if err := unix.Fstat(parent, &st); err != nil {
+		return -1, toErrno(err)
+	}
+	if !mayCreate(&st, uid, gid, groups) {
+		return -1, syscall.EACCES
+	}
+
+	if os.Geteuid() != 0 {
+		if err := priv.Escalate(); err != nil {
+			priv.Drop()
+			return -1, syscall.EPERM
+		}
+		defer priv.Drop()
+	}
+
+	if err := unix.Mknodat(parent, base, mode, int(dev)); err != nil {
+		return -1, toErrno(err)
+	}
+
+	// the node is changed through a file descriptor referring to the node
+	// created above, the name could have been replaced in the meantime
+	fd, err := unix.Openat(parent, base, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, toErrno(err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Fstat(fd, &st); err != nil {
+		return -1, toErrno(err)
+	} else if st.Mode&unix.S_IFMT != unix.S_IFCHR || uint64(st.Rdev) != dev {
+		return -1, syscall.EEXIST
+	}
+	if err := unix.Fchownat(fd, "", uid, gid, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		unix.Unlinkat(parent, base, 0)
+		return -1, toErrno(err)
+	}
+
+	sylog.Debugf("Created %s device %s on behalf of process %d", name, path, req.Pid)
+
+	return 0, 0
+}
+
+// mayCreate returns whether a process with the filesystem user and group
+// IDs uid and gid and the supplementary groups is allowed to create an
+// entry in the directory described by st.
+func mayCreate(st *unix.Stat_t, uid, gid int, groups []int) bool {
+	const wx = unix.S_IWOTH | unix.S_IXOTH
+
+	if uid == 0 {
+		return true
+	}
+
+	perm := st.Mode & 0777
+	if int(st.Uid) == uid {
+		return (perm>>6)&wx == wx
+	}
+	inGroup := int(st.Gid) == gid
+	for _, g := range groups {
+		inGroup = inGroup || int(st.Gid) == g
+	}
+	if inGroup {
+		return (perm>>3)&wx == wx
+	}
+	return perm&wx == wx
+}
+
+// openParent opens the parent directory of path as resolved by the calling
+// process, symbolic links and parent references are rejected to keep the
+// resolution within the calling process root filesystem.
+func (r *NotifyRequest) openParent(dirfd int, path string) (int, string, syscall.Errno) {
+	if path == "" {
+		return -1, "", syscall.ENOENT
+	}
+
+	start := fmt.Sprintf("/proc/%d/root", r.Pid)
+	if !filepath.IsAbs(path) {
+		if dirfd == unix.AT_FDCWD {
+			start = fmt.Sprintf("/proc/%d/cwd", r.Pid)
+		} else {
+			start = fmt.Sprintf("/proc/%d/fd/%d", r.Pid, dirfd)
+		}
+	}
+
+	dir, base := filepath.Split(path)
+	if base == "" || base == "." || base == ".." {
+		return -1, "", syscall.EEXIST
+	}
+
+	fd, err := unix.Open(start, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, "", toErrno(err)
+	}
+	if !r.Valid() {
+		unix.Close(fd)
+		return -1, "", syscall.ESRCH
+	}
+
+	for _, c := range strings.Split(dir, "/") {
+		if c == "" || c == "." {
+			continue
+		} else if c == ".." {
+			unix.Close(fd)
+			return -1, "", syscall.EPERM
+		}
+		nfd, err := unix.Openat(fd, c, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		unix.Close(fd)
+		if err != nil {
+			return -1, "", toErrno(err)
+		}
+		fd = nfd
+	}
+
+	return fd, base, 0
+}
+
+func toErrno(err error) syscall.Errno {
+	if errno, ok := err.(syscall.Errno); ok {
+		return errno
+	}
+	return syscall.EPERM
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sort"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// nativeArches maps Go architectures to the seccomp architectures
+// of the programs they can execute
+var nativeArches = map[string][]specs.Arch{
+	"386":     {specs.ArchX86},
+	"amd64":   {specs.ArchX86_64, specs.ArchX86, specs.ArchX32},
+	"arm":     {specs.ArchARM},
+	"arm64":   {specs.ArchAARCH64, specs.ArchARM},
+	"ppc64":   {specs.ArchPPC64, specs.ArchPPC},
+	"ppc64le": {specs.ArchPPC64LE},
+	"s390x":   {specs.ArchS390X, specs.ArchS390},
+}
+
+// DefaultTemplate returns a seccomp profile template denying all system
+// calls with an error for the native architectures.
+func DefaultTemplate() *specs.LinuxSeccomp {
+	return &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: append([]specs.Arch{}, nativeArches[runtime.GOARCH]...),
+	}
+}
+
+// LoadTemplate reads an OCI seccomp profile used as template.
+func LoadTemplate(path string) (*specs.LinuxSeccomp, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading seccomp template: %s", err)
+	}
+	template := &specs.LinuxSeccomp{}
+	if err := json.Unmarshal(b, template); err != nil {
+		return nil, fmt.Errorf("while decoding seccomp template %s: %s", path, err)
+	}
+	if template.DefaultAction == "" {
+		return nil, fmt.Errorf("seccomp template %s has no default action", path)
+	}
+	return template, nil
+}
+
+// GenerateProfile returns a copy of the template profile where the system
+// calls of allow are permitted and the system calls of deny return an
+// error. Denied system calls are removed from template allow rules and
+// take precedence over allowed ones.
+func GenerateProfile(template *specs.LinuxSeccomp, allow, deny []string) *specs.LinuxSeccomp {
+	denied := make(map[string]bool)
+	for _, name := range deny {
+		denied[name] = true
+	}
+
+	profile := &specs.LinuxSeccomp{
+		DefaultAction: template.DefaultAction,
+		Architectures: append([]specs.Arch{}, template.Architectures...),
+	}
+
+	// unconditionally allowed system calls don't need another rule
+	allowed := make(map[string]bool)
+	for _, sc := range template.Syscalls {
+		names := sc.Names
+		if sc.Action == specs.ActAllow {
+			names = filterNames(sc.Names, func(name string) bool { return !denied[name] })
+			if len(names) == 0 {
+				continue
+			}
+			if len(sc.Args) == 0 {
+				for _, name := range names {
+					allowed[name] = true
+				}
+			}
+		}
+		profile.Syscalls = append(profile.Syscalls, specs.LinuxSyscall{
+			Names:  names,
+			Action: sc.Action,
+			Args:   append([]specs.LinuxSeccompArg{}, sc.Args...),
+		})
+	}
+
+	if names := uniqueNames(allow, func(name string) bool { return !denied[name] && !allowed[name] }); len(names) > 0 {
+		profile.Syscalls = append(profile.Syscalls, specs.LinuxSyscall{
+			Names:  names,
+			Action: specs.ActAllow,
+		})
+	}
+	if template.DefaultAction != specs.ActErrno {
+		if names := uniqueNames(deny, func(string) bool { return true }); len(names) > 0 {
+			profile.Syscalls = append(profile.Syscalls, specs.LinuxSyscall{
+				Names:  names,
+				Action: specs.ActErrno,
+			})
+		}
+	}
+
+	return profile
+}
+
+// WriteProfile writes the JSON encoding of the seccomp profile to w, the
+// profile can be loaded with --security seccomp:<file>.
+func WriteProfile(w io.Writer, profile *specs.LinuxSeccomp) error {
+	b, err := json.MarshalIndent(profile, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// filterNames returns the names for which keep returns true.
+func filterNames(names []string, keep func(string) bool) []string {
+	filtered := make([]string, 0, len(names))
+	for _, name := range names {
+		if keep(name) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// uniqueNames returns the sorted and deduplicated names for which keep
+// returns true.
+func uniqueNames(names []string, keep func(string) bool) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] && keep(name) {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestGenerateProfile(t *testing.T) {
+	template := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"read", "write", "mount"}, Action: specs.ActAllow},
+			{
+				Names:  []string{"personality"},
+				Action: specs.ActAllow,
+				Args:   []specs.LinuxSeccompArg{{Index: 0, Value: 0, Op: specs.OpEqualTo}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template *specs.LinuxSeccomp
+		allow    []string
+		deny     []string
+		expected []specs.LinuxSyscall
+	}{
+		{
+			name:     "template only",
+			template: template,
+			expected: template.Syscalls,
+		},
+		{
+			name:     "allow and deny lists",
+			template: template,
+			allow:    []string{"open", "write", "close", "open", "personality"},
+			deny:     []string{"mount", "close"},
+			expected: []specs.LinuxSyscall{
+				{Names: []string{"read", "write"}, Action: specs.ActAllow},
+				template.Syscalls[1],
+				{Names: []string{"open", "personality"}, Action: specs.ActAllow},
+			},
+		},
+		{
+			name:     "deny with allow default action",
+			template: &specs.LinuxSeccomp{DefaultAction: specs.ActAllow},
+			deny:     []string{"ptrace", "mount", "ptrace"},
+			expected: []specs.LinuxSyscall{
+				{Names: []string{"mount", "ptrace"}, Action: specs.ActErrno},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		profile := GenerateProfile(tt.template, tt.allow, tt.deny)
+		if profile.DefaultAction != tt.template.DefaultAction {
+			t.Errorf("%s: got default action %s, expected %s", tt.name, profile.DefaultAction, tt.template.DefaultAction)
+		}
+		// empty and nil argument lists are equivalent
+		for i := range profile.Syscalls {
+			if len(profile.Syscalls[i].Args) == 0 {
+				profile.Syscalls[i].Args = nil
+			}
+		}
+		if !reflect.DeepEqual(profile.Syscalls, tt.expected) {
+			t.Errorf("%s: got rules %+v, expected %+v", tt.name, profile.Syscalls, tt.expected)
+		}
+	}
+
+	if len(template.Syscalls[0].Names) != 3 {
+		t.Errorf("template was modified: %+v", template.Syscalls[0])
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	if tmpl := DefaultTemplate(); tmpl.DefaultAction != specs.ActErrno || len(tmpl.Syscalls) != 0 {
+		t.Errorf("unexpected default template %+v", tmpl)
+	}
+
+	dir, err := ioutil.TempDir("", "seccomp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	profile := GenerateProfile(DefaultTemplate(), []string{"read"}, nil)
+
+	var buf bytes.Buffer
+	if err := WriteProfile(&buf, profile); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	path := filepath.Join(dir, "profile.json")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadTemplate(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(loaded, profile) {
+		t.Errorf("got template %+v, expected %+v", loaded, profile)
+	}
+
+	b, _ := json.Marshal(&specs.LinuxSeccomp{})
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTemplate(path); err == nil {
+		t.Errorf("unexpected success with template without default action")
+	}
+}
@@ -131,8 +131,14 @@ func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool, errNo int16)
 			return fmt.Errorf("no syscall specified for the rule")
 		}
 
-		scmpAction, ok = scmpActionMap[syscall.Action]
-		if !ok {
+		if syscall.Action == ActNotify {
+			if !notifyLoaded {
+				return fmt.Errorf("%s action requires a notification listener", ActNotify)
+			}
+			// allowed here, the notification filter loaded
+			// previously reports them to the listener
+			scmpAction = lseccomp.ActAllow
+		} else if scmpAction, ok = scmpActionMap[syscall.Action]; !ok {
 			return fmt.Errorf("invalid action '%s' specified", syscall.Action)
 		}
 		if scmpAction == lseccomp.ActErrno {
@@ -168,6 +174,39 @@ func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool, errNo int16)
 	return nil
 }
 
+// LoadNotifyFilter loads a seccomp filter reporting the syscalls with the
+// SCMP_ACT_NOTIFY action to a notification listener and returns the listener
+// file descriptor, or -1 if there is no such syscall. It must be called before
+// LoadSeccompConfig.
+func LoadNotifyFilter(config *specs.LinuxSeccomp, noNewPrivs bool) (int, error) {
+	if config == nil {
+		return -1, nil
+	}
+
+	nrs := make([]uint32, 0)
+
+	for _, syscall := range config.Syscalls {
+		if syscall.Action != ActNotify {
+			continue
+		}
+		if len(syscall.Args) > 0 {
+			return -1, fmt.Errorf("rule conditions are not supported with %s action", ActNotify)
+		}
+		for _, sysName := range syscall.Names {
+			sysNr, err := lseccomp.GetSyscallFromName(sysName)
+			if err != nil {
+				continue
+			}
+			nrs = append(nrs, uint32(sysNr))
+		}
+	}
+
+	if len(nrs) == 0 {
+		return -1, nil
+	}
+	return loadNotifyFilter(nrs, noNewPrivs)
+}
+
 func addSyscallRuleContitions(args []specs.LinuxSeccompArg) ([]lseccomp.ScmpCondition, error) {
 	var maxIndex uint = 6
 	conditions := make([]lseccomp.ScmpCondition, 0)
@@ -221,3 +260,8 @@ func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 	}
 	return nil
 }
+
+// SyscallName returns the name of the native system call number nr
+func SyscallName(nr int) (string, error) {
+	return lseccomp.ScmpSyscall(nr).GetName()
+}
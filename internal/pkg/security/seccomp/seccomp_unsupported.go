@@ -28,6 +28,11 @@ func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool, errNo int16)
 	return fmt.Errorf("can't load seccomp filter: not supported by OS")
 }
 
+// LoadNotifyFilter returns an error for unsupported platforms or without seccomp support
+func LoadNotifyFilter(config *specs.LinuxSeccomp, noNewPrivs bool) (int, error) {
+	return -1, LoadSeccompConfig(config, noNewPrivs, 0)
+}
+
 // LoadProfileFromFile sets an empty seccomp configuration for unsupported platforms
 func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 	if generator.Config.Linux == nil {
@@ -38,3 +43,8 @@ func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 	}
 	return nil
 }
+
+// SyscallName returns an error for unsupported platforms or without seccomp support
+func SyscallName(nr int) (string, error) {
+	return "", fmt.Errorf("can't resolve system call %d: seccomp support not enabled", nr)
+}
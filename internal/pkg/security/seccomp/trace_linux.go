@@ -0,0 +1,151 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// tracee is a process traced while recording system calls.
+type tracee struct {
+	// record is true once the process executed a program
+	// whose system calls are recorded
+	record bool
+	// attached is false until the initial stop of processes
+	// automatically attached on fork was received
+	attached bool
+}
+
+// RecordSyscalls starts cmd with all its child processes traced and
+// returns the numbers of the system calls they executed along with cmd
+// exit status. The system calls of a process are recorded once it
+// executes a program for which ignore returns false, this state is
+// inherited by child processes. Standard streams of cmd must be files
+// as cmd is waited by RecordSyscalls.
+func RecordSyscalls(cmd *exec.Cmd, ignore func(exe string) bool) (map[int]bool, syscall.WaitStatus, error) {
+	var status syscall.WaitStatus
+
+	// ptrace requests must be issued by the thread which attached tracees
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	if err := cmd.Start(); err != nil {
+		return nil, status, err
+	}
+	pid := cmd.Process.Pid
+
+	var ws unix.WaitStatus
+	if _, err := unix.Wait4(pid, &ws, 0, nil); err != nil {
+		return nil, status, fmt.Errorf("while waiting traced process: %s", err)
+	}
+	if !ws.Stopped() {
+		return nil, status, fmt.Errorf("traced process %d exited before tracing", pid)
+	}
+
+	options := unix.PTRACE_O_TRACESYSGOOD | unix.PTRACE_O_TRACEEXEC | unix.PTRACE_O_EXITKILL |
+		unix.PTRACE_O_TRACEFORK | unix.PTRACE_O_TRACEVFORK | unix.PTRACE_O_TRACECLONE
+	if err := unix.PtraceSetOptions(pid, options); err != nil {
+		cmd.Process.Kill()
+		return nil, status, fmt.Errorf("while setting ptrace options: %s", err)
+	}
+
+	syscalls := make(map[int]bool)
+	tracees := map[int]*tracee{
+		pid: {record: !ignore(exePath(pid)), attached: true},
+	}
+	if err := unix.PtraceSyscall(pid, 0); err != nil {
+		cmd.Process.Kill()
+		return nil, status, err
+	}
+
+	for len(tracees) > 0 {
+		wpid, err := unix.Wait4(-1, &ws, unix.WALL, nil)
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return nil, status, fmt.Errorf("while waiting traced processes: %s", err)
+		}
+
+		t, ok := tracees[wpid]
+		if !ok {
+			// the child stop may be reported before the fork event
+			t = &tracee{}
+			tracees[wpid] = t
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			delete(tracees, wpid)
+			if wpid == pid {
+				status = syscall.WaitStatus(ws)
+			}
+			continue
+		} else if !ws.Stopped() {
+			continue
+		}
+
+		sig := 0
+
+		switch stop := ws.StopSignal(); stop {
+		case unix.SIGTRAP | 0x80:
+			// system call entry and exit stops, the system call
+			// number is preserved on exit
+			if t.record {
+				nr, err := syscallNumber(wpid)
+				if err != nil {
+					return nil, status, err
+				}
+				syscalls[nr] = true
+			}
+		case unix.SIGTRAP:
+			switch ws.TrapCause() {
+			case unix.PTRACE_EVENT_FORK, unix.PTRACE_EVENT_VFORK, unix.PTRACE_EVENT_CLONE:
+				msg, err := unix.PtraceGetEventMsg(wpid)
+				if err != nil {
+					return nil, status, err
+				}
+				child, ok := tracees[int(msg)]
+				if !ok {
+					child = &tracee{}
+					tracees[int(msg)] = child
+				}
+				child.record = t.record
+			case unix.PTRACE_EVENT_EXEC:
+				t.record = !ignore(exePath(wpid))
+			}
+		case unix.SIGSTOP:
+			// suppress the initial stop of attached children
+			if t.attached {
+				sig = int(stop)
+			}
+			t.attached = true
+		default:
+			sig = int(stop)
+		}
+
+		if err := unix.PtraceSyscall(wpid, sig); err != nil && err != unix.ESRCH {
+			return nil, status, fmt.Errorf("while resuming traced process %d: %s", wpid, err)
+		}
+	}
+
+	return syscalls, status, nil
+}
+
+// exePath returns the path of the program executed by process pid.
+func exePath(pid int) string {
+	path, _ := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	return path
+}
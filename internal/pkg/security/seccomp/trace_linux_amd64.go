@@ -0,0 +1,19 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// syscallNumber returns the system call number of the stopped process pid.
+func syscallNumber(pid int) (int, error) {
+	var regs unix.PtraceRegs
+	if err := unix.PtraceGetRegs(pid, &regs); err != nil {
+		return -1, err
+	}
+	return int(regs.Orig_rax), nil
+}
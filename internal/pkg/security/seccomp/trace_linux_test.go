@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestRecordSyscalls(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	if _, err := syscallNumber(0); err != nil && err != unix.ESRCH {
+		t.Skipf("system call recording not supported: %s", err)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("sh not found: %s", err)
+	}
+
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("sleep not found: %s", err)
+	}
+	sleep, err = filepath.EvalSymlinks(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the program executed by the shell is recorded
+	cmd := exec.Command(sh, "-c", "exec sleep 0")
+	syscalls, status, err := RecordSyscalls(cmd, func(exe string) bool {
+		return exe != sleep
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.ExitStatus() != 0 {
+		t.Errorf("unexpected exit status %d", status.ExitStatus())
+	}
+	for _, nr := range []int{unix.SYS_EXECVE, unix.SYS_EXIT_GROUP} {
+		if !syscalls[nr] {
+			t.Errorf("system call %d not recorded", nr)
+		}
+	}
+
+	cmd = exec.Command(sh, "-c", "exit 3")
+	syscalls, status, err = RecordSyscalls(cmd, func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.ExitStatus() != 3 {
+		t.Errorf("got exit status %d, expected 3", status.ExitStatus())
+	}
+	if len(syscalls) != 0 {
+		t.Errorf("unexpected recorded system calls %v", syscalls)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build linux,!amd64,!ppc64le
+
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// syscallNumber returns an error for unsupported architectures.
+func syscallNumber(pid int) (int, error) {
+	return -1, fmt.Errorf("system call recording is not supported on %s", runtime.GOARCH)
+}
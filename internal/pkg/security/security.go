@@ -24,6 +24,9 @@ func Configure(config *specs.Spec) error {
 		}
 		if config.Process.SelinuxLabel != "" {
 			if selinux.Enabled() {
+				if err := selinux.CheckContext(config.Process.SelinuxLabel); err != nil {
+					return err
+				}
 				if err := selinux.SetExecLabel(config.Process.SelinuxLabel); err != nil {
 					return err
 				}
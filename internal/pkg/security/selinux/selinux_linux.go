@@ -1,4 +1,4 @@
-// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,7 +8,10 @@
 package selinux
 
 import (
+	"fmt"
+
 	goselinux "github.com/opencontainers/selinux/go-selinux"
+	"github.com/opencontainers/selinux/go-selinux/label"
 )
 
 // Enabled checks if SELinux is enabled or not
@@ -20,3 +23,40 @@ func Enabled() bool {
 func SetExecLabel(label string) error {
 	return goselinux.SetExecLabel(label)
 }
+
+// CheckContext returns an error if the SELinux context is not
+// defined by the loaded policy
+func CheckContext(context string) error {
+	if err := goselinux.SecurityCheckContext(context); err != nil {
+		return fmt.Errorf("invalid SELinux context %s: %s", context, err)
+	}
+	return nil
+}
+
+// ContainerLabels returns the default process and file labels of
+// containers defined in the policy lxc_contexts file, both labels share
+// a unique MCS level like the one allocated by container-selinux
+func ContainerLabels() (processLabel string, fileLabel string, err error) {
+	processLabel, fileLabel = goselinux.ContainerLabels()
+	if processLabel == "" || fileLabel == "" {
+		return "", "", fmt.Errorf("no container labels found in SELinux policy")
+	}
+	return processLabel, fileLabel, nil
+}
+
+// FileLabelFor returns the default container file label with the MCS
+// level of processLabel
+func FileLabelFor(processLabel string) (string, error) {
+	_, fileLabel, err := ContainerLabels()
+	if err != nil {
+		return "", err
+	}
+	return goselinux.CopyLevel(processLabel, fileLabel)
+}
+
+// Relabel recursively sets the SELinux file label of path, if shared is
+// true the MCS level is cleared to give access to all containers. System
+// directories and the user home directory can't be relabeled
+func Relabel(path string, fileLabel string, shared bool) error {
+	return label.Relabel(path, fileLabel, shared)
+}
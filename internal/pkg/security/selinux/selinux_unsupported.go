@@ -1,4 +1,4 @@
-// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,6 +7,10 @@
 
 package selinux
 
+import (
+	"fmt"
+)
+
 // Enabled checks if SELinux is enabled or not
 func Enabled() bool {
 	return false
@@ -16,3 +20,23 @@ func Enabled() bool {
 func SetExecLabel(label string) error {
 	return nil
 }
+
+// CheckContext returns error for unsupported platform
+func CheckContext(context string) error {
+	return fmt.Errorf("selinux is not supported by OS")
+}
+
+// ContainerLabels returns error for unsupported platform
+func ContainerLabels() (processLabel string, fileLabel string, err error) {
+	return "", "", fmt.Errorf("selinux is not supported by OS")
+}
+
+// FileLabelFor returns error for unsupported platform
+func FileLabelFor(processLabel string) (string, error) {
+	return "", fmt.Errorf("selinux is not supported by OS")
+}
+
+// Relabel does nothing on unsupported platform
+func Relabel(path string, fileLabel string, shared bool) error {
+	return nil
+}
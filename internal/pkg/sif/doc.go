@@ -0,0 +1,16 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+/*
+Package sif gives access to SIF images on every platform supported by
+the client. It exposes the subset of the SIF library used to inspect,
+sign, verify and push images.
+
+The SIF library maps image files into memory with mmap, which doesn't
+exist on Windows and prevents the library from being built there. On
+Windows this package reads and writes images with regular file I/O
+instead, everywhere else it is a thin wrapper around the SIF library.
+*/
+package sif
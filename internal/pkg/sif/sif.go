@@ -0,0 +1,111 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package sif
+
+import (
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// Types of the SIF library.
+type (
+	// FileImage describes a loaded SIF image.
+	FileImage = sif.FileImage
+	// Header is the SIF global header.
+	Header = sif.Header
+	// Descriptor describes a data object of a SIF image.
+	Descriptor = sif.Descriptor
+	// DescriptorInput describes a data object to add to a SIF image.
+	DescriptorInput = sif.DescriptorInput
+	// ReadWriter is the interface used to access a SIF image file.
+	ReadWriter = sif.ReadWriter
+	// Datatype is the type of a data object.
+	Datatype = sif.Datatype
+	// Fstype is the file system type of a partition.
+	Fstype = sif.Fstype
+	// Parttype is the type of a partition.
+	Parttype = sif.Parttype
+	// Hashtype is the hash algorithm of a signature.
+	Hashtype = sif.Hashtype
+	// Formattype is the format of a cryptographic message.
+	Formattype = sif.Formattype
+	// Messagetype is the type of a cryptographic message.
+	Messagetype = sif.Messagetype
+)
+
+// Constants of the SIF library.
+const (
+	HdrMagic       = sif.HdrMagic
+	HdrVersion     = sif.HdrVersion
+	HdrArchUnknown = sif.HdrArchUnknown
+	HdrArchLen     = sif.HdrArchLen
+
+	DescrGroupMask   = sif.DescrGroupMask
+	DescrUnusedGroup = sif.DescrUnusedGroup
+	DescrUnusedLink  = sif.DescrUnusedLink
+	DescrEntityLen   = sif.DescrEntityLen
+	DescrNumEntries  = sif.DescrNumEntries
+	DescrStartOffset = sif.DescrStartOffset
+	DataStartOffset  = sif.DataStartOffset
+
+	DataDeffile       = sif.DataDeffile
+	DataEnvVar        = sif.DataEnvVar
+	DataLabels        = sif.DataLabels
+	DataPartition     = sif.DataPartition
+	DataSignature     = sif.DataSignature
+	DataGenericJSON   = sif.DataGenericJSON
+	DataGeneric       = sif.DataGeneric
+	DataCryptoMessage = sif.DataCryptoMessage
+
+	FsSquash            = sif.FsSquash
+	FsExt3              = sif.FsExt3
+	FsImmuObj           = sif.FsImmuObj
+	FsRaw               = sif.FsRaw
+	FsEncryptedSquashfs = sif.FsEncryptedSquashfs
+
+	PartSystem  = sif.PartSystem
+	PartPrimSys = sif.PartPrimSys
+	PartData    = sif.PartData
+	PartOverlay = sif.PartOverlay
+
+	HashSHA256 = sif.HashSHA256
+	HashSHA384 = sif.HashSHA384
+	HashSHA512 = sif.HashSHA512
+
+	FormatOpenPGP  = sif.FormatOpenPGP
+	FormatPEM      = sif.FormatPEM
+	MessageRSAOAEP = sif.MessageRSAOAEP
+)
+
+var (
+	// ErrNotFound is returned when no descriptor matches a lookup.
+	ErrNotFound = sif.ErrNotFound
+	// ErrMultValues is returned when more than one descriptor matches
+	// a lookup expecting a single one.
+	ErrMultValues = sif.ErrMultValues
+)
+
+// LoadContainer loads the SIF image filename, opened read-only if
+// rdonly is true.
+func LoadContainer(filename string, rdonly bool) (FileImage, error) {
+	return sif.LoadContainer(filename, rdonly)
+}
+
+// LoadContainerFp loads the SIF image from the opened file fp.
+func LoadContainerFp(fp ReadWriter, rdonly bool) (FileImage, error) {
+	return sif.LoadContainerFp(fp, rdonly)
+}
+
+// GetSIFArch returns the SIF architecture code of a Go architecture.
+func GetSIFArch(goarch string) string {
+	return sif.GetSIFArch(goarch)
+}
+
+// GetGoArch returns the Go architecture of a SIF architecture code.
+func GetGoArch(sifarch string) string {
+	return sif.GetGoArch(sifarch)
+}
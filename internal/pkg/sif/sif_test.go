@@ -0,0 +1,136 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// createEmptySIF writes a SIF image without any data object.
+func createEmptySIF(t *testing.T) string {
+	f, err := ioutil.TempFile("", "sif-")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %s", err)
+	}
+	defer f.Close()
+
+	var header Header
+	copy(header.Magic[:], HdrMagic)
+	copy(header.Version[:], HdrVersion)
+	copy(header.Arch[:], HdrArchUnknown)
+	header.Dfree = DescrNumEntries
+	header.Dtotal = DescrNumEntries
+	header.Descroff = DescrStartOffset
+	header.Dataoff = DataStartOffset
+
+	if err := binary.Write(f, binary.LittleEndian, header); err != nil {
+		t.Fatalf("failed to write header: %s", err)
+	}
+	if _, err := f.Seek(DescrStartOffset, 0); err != nil {
+		t.Fatalf("failed to seek to descriptors: %s", err)
+	}
+	if err := binary.Write(f, binary.LittleEndian, make([]Descriptor, DescrNumEntries)); err != nil {
+		t.Fatalf("failed to write descriptors: %s", err)
+	}
+	if err := f.Truncate(DataStartOffset); err != nil {
+		t.Fatalf("failed to truncate image: %s", err)
+	}
+
+	return f.Name()
+}
+
+func TestAddObject(t *testing.T) {
+	path := createEmptySIF(t)
+	defer os.Remove(path)
+
+	entity := bytes.Repeat([]byte{0xab}, 20)
+	data := []byte("signature data")
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("failed to load %s: %s", path, err)
+	}
+
+	input := DescriptorInput{
+		Datatype: DataSignature,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrGroupMask | 1,
+		Size:     int64(len(data)),
+		Fname:    "signature",
+		Data:     data,
+	}
+	if err := input.SetSignExtra(HashSHA384, hex.EncodeToString(entity)); err != nil {
+		t.Fatalf("failed to set signature info: %s", err)
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatalf("failed to add object: %s", err)
+	}
+	fimg.UnloadContainer()
+
+	fimg, err = LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("failed to load %s: %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, _, err := fimg.GetPartPrimSys(); err != ErrNotFound {
+		t.Errorf("unexpected primary partition lookup result: %v", err)
+	}
+
+	descrs, _, err := fimg.GetLinkedDescrsByType(DescrGroupMask|1, DataSignature)
+	if err != nil {
+		t.Fatalf("failed to find signature: %s", err)
+	}
+	if len(descrs) != 1 {
+		t.Fatalf("found %d signatures, expected 1", len(descrs))
+	}
+
+	d := descrs[0]
+	if name := d.GetName(); name != "signature" {
+		t.Errorf("got descriptor name %q, expected %q", name, "signature")
+	}
+	if got := d.GetData(&fimg); !bytes.Equal(got, data) {
+		t.Errorf("got data %q, expected %q", got, data)
+	}
+	if fp, err := d.GetEntityString(); err != nil {
+		t.Errorf("failed to get entity: %s", err)
+	} else if want := strings.ToUpper(hex.EncodeToString(entity)); fp != want {
+		t.Errorf("got entity %s, expected %s", fp, want)
+	}
+	if _, err := d.GetFsType(); err == nil {
+		t.Errorf("unexpected file system type for a signature")
+	}
+
+	if byID, _, err := fimg.GetFromDescrID(d.ID); err != nil || byID.ID != d.ID {
+		t.Errorf("failed to find descriptor %d: %v", d.ID, err)
+	}
+	if _, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataDeffile}); err != ErrNotFound {
+		t.Errorf("unexpected definition file lookup result: %v", err)
+	}
+}
+
+func TestLoadContainerInvalid(t *testing.T) {
+	f, err := ioutil.TempFile("", "sif-")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Truncate(DataStartOffset); err != nil {
+		t.Fatalf("failed to truncate file: %s", err)
+	}
+	f.Close()
+
+	if _, err := LoadContainer(f.Name(), true); err == nil {
+		t.Errorf("unexpected success while loading an image without SIF magic")
+	}
+}
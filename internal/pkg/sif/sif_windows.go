@@ -0,0 +1,673 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// SIF format constants, they must match those of the SIF library.
+const (
+	HdrMagic       = "SIF_MAGIC"
+	HdrVersion     = "01"
+	HdrArchUnknown = "00"
+
+	hdrLaunchLen  = 32
+	hdrMagicLen   = 10
+	hdrVersionLen = 3
+	HdrArchLen    = 3
+
+	DescrNumEntries   = 48
+	DescrGroupMask    = 0xf0000000
+	DescrUnusedGroup  = DescrGroupMask
+	DescrUnusedLink   = 0
+	DescrEntityLen    = 256
+	descrNameLen      = 128
+	descrMaxPrivLen   = 384
+	DescrStartOffset  = 4096
+	DataStartOffset   = 32768
+	fingerprintLength = 20
+)
+
+// Datatype is the type of a data object.
+type Datatype int32
+
+// Data object types.
+const (
+	DataDeffile Datatype = iota + 0x4001
+	DataEnvVar
+	DataLabels
+	DataPartition
+	DataSignature
+	DataGenericJSON
+	DataGeneric
+	DataCryptoMessage
+)
+
+// Fstype is the file system type of a partition.
+type Fstype int32
+
+// Partition file system types.
+const (
+	FsSquash Fstype = iota + 1
+	FsExt3
+	FsImmuObj
+	FsRaw
+	FsEncryptedSquashfs
+)
+
+// Parttype is the type of a partition.
+type Parttype int32
+
+// Partition types.
+const (
+	PartSystem Parttype = iota + 1
+	PartPrimSys
+	PartData
+	PartOverlay
+)
+
+// Hashtype is the hash algorithm of a signature.
+type Hashtype int32
+
+// Signature hash algorithms.
+const (
+	HashSHA256 Hashtype = iota + 1
+	HashSHA384
+	HashSHA512
+)
+
+// Formattype is the format of a cryptographic message.
+type Formattype int32
+
+// Cryptographic message formats.
+const (
+	FormatOpenPGP Formattype = iota + 1
+	FormatPEM
+)
+
+// Messagetype is the type of a cryptographic message.
+type Messagetype int32
+
+// Cryptographic message types.
+const (
+	MessageRSAOAEP Messagetype = 0x200
+)
+
+var (
+	// ErrNotFound is returned when no descriptor matches a lookup.
+	ErrNotFound = errors.New("no match found")
+	// ErrMultValues is returned when more than one descriptor matches
+	// a lookup expecting a single one.
+	ErrMultValues = errors.New("lookup would return more than one match")
+)
+
+var archMap = map[string]string{
+	"386":      "01",
+	"amd64":    "02",
+	"arm":      "03",
+	"arm64":    "04",
+	"ppc64":    "05",
+	"ppc64le":  "06",
+	"mips":     "07",
+	"mipsle":   "08",
+	"mips64":   "09",
+	"mips64le": "10",
+	"s390x":    "11",
+}
+
+// Header is the SIF global header.
+type Header struct {
+	Launch  [hdrLaunchLen]byte
+	Magic   [hdrMagicLen]byte
+	Version [hdrVersionLen]byte
+	Arch    [HdrArchLen]byte
+	ID      uuid.UUID
+
+	Ctime int64
+	Mtime int64
+
+	Dfree    int64
+	Dtotal   int64
+	Descroff int64
+	Descrlen int64
+	Dataoff  int64
+	Datalen  int64
+}
+
+// Descriptor describes a data object of a SIF image.
+type Descriptor struct {
+	Datatype Datatype
+	Used     bool
+	ID       uint32
+	Groupid  uint32
+	Link     uint32
+	Fileoff  int64
+	Filelen  int64
+	Storelen int64
+
+	Ctime int64
+	Mtime int64
+	UID   int64
+	Gid   int64
+	Name  [descrNameLen]byte
+	Extra [descrMaxPrivLen]byte
+}
+
+type partition struct {
+	Fstype   Fstype
+	Parttype Parttype
+	Arch     [HdrArchLen]byte
+}
+
+type signature struct {
+	Hashtype Hashtype
+	Entity   [DescrEntityLen]byte
+}
+
+type cryptoMessage struct {
+	Formattype  Formattype
+	Messagetype Messagetype
+}
+
+// ReadWriter is the interface used to access a SIF image file.
+type ReadWriter interface {
+	Name() string
+	Close() error
+	Fd() uintptr
+	Read(b []byte) (n int, err error)
+	Seek(offset int64, whence int) (ret int64, err error)
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+	Write(b []byte) (n int, err error)
+}
+
+// FileImage describes a loaded SIF image. Data objects are always read
+// from the file, Filedata only holds the header and the descriptors.
+type FileImage struct {
+	Header     Header
+	Fp         ReadWriter
+	Filesize   int64
+	Filedata   []byte
+	Amodebuf   bool
+	Reader     *bytes.Reader
+	DescrArr   []Descriptor
+	PrimPartID uint32
+}
+
+// DescriptorInput describes a data object to add to a SIF image.
+type DescriptorInput struct {
+	Datatype  Datatype
+	Groupid   uint32
+	Link      uint32
+	Size      int64
+	Alignment int
+
+	Fname string
+	Fp    io.Reader
+	Data  []byte
+
+	Image *FileImage
+	Descr *Descriptor
+
+	Extra bytes.Buffer
+}
+
+// LoadContainer loads the SIF image filename, opened read-only if
+// rdonly is true.
+func LoadContainer(filename string, rdonly bool) (FileImage, error) {
+	var fp *os.File
+	var err error
+
+	if rdonly {
+		fp, err = os.Open(filename)
+	} else {
+		fp, err = os.OpenFile(filename, os.O_RDWR, 0)
+	}
+	if err != nil {
+		return FileImage{}, fmt.Errorf("opening container file: %s", err)
+	}
+
+	fimg, err := LoadContainerFp(fp, rdonly)
+	if err != nil {
+		fp.Close()
+	}
+	return fimg, err
+}
+
+// LoadContainerFp loads the SIF image from the opened file fp.
+func LoadContainerFp(fp ReadWriter, rdonly bool) (FileImage, error) {
+	fimg := FileImage{Fp: fp, Amodebuf: true}
+
+	if fp == nil {
+		return fimg, fmt.Errorf("provided fp for file is invalid")
+	}
+
+	fi, err := fp.Stat()
+	if err != nil {
+		return fimg, fmt.Errorf("while getting SIF file size: %s", err)
+	}
+	fimg.Filesize = fi.Size()
+
+	if _, err := fp.Seek(0, io.SeekStart); err != nil {
+		return fimg, fmt.Errorf("seek() setting to start of file: %s", err)
+	}
+	fimg.Filedata = make([]byte, DataStartOffset)
+	if _, err := io.ReadFull(fp, fimg.Filedata); err != nil {
+		return fimg, fmt.Errorf("short read while reading top of file: %s", err)
+	}
+	fimg.Reader = bytes.NewReader(fimg.Filedata)
+
+	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.Header); err != nil {
+		return fimg, fmt.Errorf("reading global header from container file: %s", err)
+	}
+	if cstrToString(fimg.Header.Magic[:]) != HdrMagic {
+		return fimg, fmt.Errorf("invalid SIF file: Magic |%s| want |%s|", fimg.Header.Magic, HdrMagic)
+	}
+	if cstrToString(fimg.Header.Version[:]) > HdrVersion {
+		return fimg, fmt.Errorf("invalid SIF file: Version %s want <= %s", fimg.Header.Version, HdrVersion)
+	}
+
+	if _, err := fimg.Reader.Seek(fimg.Header.Descroff, io.SeekStart); err != nil {
+		return fimg, fmt.Errorf("seek() setting to descriptors start: %s", err)
+	}
+	fimg.DescrArr = make([]Descriptor, fimg.Header.Dtotal)
+	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.DescrArr); err != nil {
+		fimg.DescrArr = nil
+		return fimg, fmt.Errorf("reading descriptor array from container file: %s", err)
+	}
+
+	if descr, _, err := fimg.GetPartPrimSys(); err == nil {
+		fimg.PrimPartID = descr.ID
+	}
+
+	return fimg, nil
+}
+
+// UnloadContainer closes the SIF image file.
+func (fimg *FileImage) UnloadContainer() error {
+	if fimg.Fp == nil {
+		return nil
+	}
+	if err := fimg.Fp.Close(); err != nil {
+		return fmt.Errorf("closing SIF file failed, corrupted: don't use: %s", err)
+	}
+	return nil
+}
+
+// GetSIFArch returns the SIF architecture code of a Go architecture.
+func GetSIFArch(goarch string) string {
+	if sifarch, ok := archMap[goarch]; ok {
+		return sifarch
+	}
+	return HdrArchUnknown
+}
+
+// GetGoArch returns the Go architecture of a SIF architecture code.
+func GetGoArch(sifarch string) string {
+	for goarch, arch := range archMap {
+		if arch == sifarch {
+			return goarch
+		}
+	}
+	return "unknown"
+}
+
+// GetFromDescrID returns the descriptor with the given ID.
+func (fimg *FileImage) GetFromDescrID(id uint32) (*Descriptor, int, error) {
+	match := -1
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.ID != id {
+			continue
+		}
+		if match != -1 {
+			return nil, -1, ErrMultValues
+		}
+		match = i
+	}
+	if match == -1 {
+		return nil, -1, ErrNotFound
+	}
+
+	return &fimg.DescrArr[match], match, nil
+}
+
+// GetLinkedDescrsByType returns the descriptors of type dataType linked
+// to the ID or group ID.
+func (fimg *FileImage) GetLinkedDescrsByType(id uint32, dataType Datatype) ([]*Descriptor, []int, error) {
+	return fimg.lookup(func(v *Descriptor) bool {
+		return v.Datatype == dataType && v.Link == id
+	})
+}
+
+// GetFromDescr returns the descriptors matching all non-zero fields of descr.
+func (fimg *FileImage) GetFromDescr(descr Descriptor) ([]*Descriptor, []int, error) {
+	return fimg.lookup(func(v *Descriptor) bool {
+		switch {
+		case descr.Datatype != 0 && descr.Datatype != v.Datatype:
+		case descr.ID != 0 && descr.ID != v.ID:
+		case descr.Groupid != 0 && descr.Groupid != v.Groupid:
+		case descr.Link != 0 && descr.Link != v.Link:
+		case descr.Fileoff != 0 && descr.Fileoff != v.Fileoff:
+		case descr.Filelen != 0 && descr.Filelen != v.Filelen:
+		case descr.Storelen != 0 && descr.Storelen != v.Storelen:
+		case descr.Ctime != 0 && descr.Ctime != v.Ctime:
+		case descr.Mtime != 0 && descr.Mtime != v.Mtime:
+		case descr.UID != 0 && descr.UID != v.UID:
+		case descr.Gid != 0 && descr.Gid != v.Gid:
+		case descr.Name[0] != 0 && !bytes.Equal(descr.Name[:], v.Name[:]):
+		default:
+			return true
+		}
+		return false
+	})
+}
+
+// GetPartPrimSys returns the primary system partition descriptor.
+func (fimg *FileImage) GetPartPrimSys() (*Descriptor, int, error) {
+	descrs, indexes, err := fimg.lookup(func(v *Descriptor) bool {
+		ptype, err := v.GetPartType()
+		return err == nil && ptype == PartPrimSys
+	})
+	if err != nil {
+		return nil, -1, err
+	} else if len(descrs) > 1 {
+		return nil, -1, ErrMultValues
+	}
+	return descrs[0], indexes[0], nil
+}
+
+func (fimg *FileImage) lookup(match func(*Descriptor) bool) ([]*Descriptor, []int, error) {
+	var descrs []*Descriptor
+	var indexes []int
+
+	for i := range fimg.DescrArr {
+		if fimg.DescrArr[i].Used && match(&fimg.DescrArr[i]) {
+			indexes = append(indexes, i)
+			descrs = append(descrs, &fimg.DescrArr[i])
+		}
+	}
+	if len(descrs) == 0 {
+		return nil, nil, ErrNotFound
+	}
+
+	return descrs, indexes, nil
+}
+
+// AddObject appends a new data object and its descriptor to the SIF image.
+func (fimg *FileImage) AddObject(input DescriptorInput) error {
+	if fimg.Header.Dfree == 0 {
+		return fmt.Errorf("no descriptor table free entry")
+	}
+
+	idx := -1
+	for i, v := range fimg.DescrArr {
+		if !v.Used {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return fmt.Errorf("no descriptor table free entry, warning: header.Dfree was > 0")
+	}
+
+	end := fimg.Header.Dataoff + fimg.Header.Datalen
+	align := os.Getpagesize()
+	if input.Alignment != 0 {
+		align = input.Alignment
+	}
+	offset := nextAligned(end, align)
+
+	if _, err := fimg.Fp.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("setting file offset pointer to data object: %s", err)
+	}
+
+	var size int64
+	if input.Data != nil {
+		n, err := fimg.Fp.Write(input.Data)
+		if err != nil {
+			return fmt.Errorf("copying data object data to SIF file: %s", err)
+		}
+		size = int64(n)
+	} else {
+		n, err := io.Copy(fimg.Fp, input.Fp)
+		if err != nil {
+			return fmt.Errorf("copying data object file to SIF file: %s", err)
+		} else if n != input.Size && input.Size != 0 {
+			return fmt.Errorf("short write while copying to SIF file")
+		}
+		size = n
+	}
+
+	now := time.Now().Unix()
+	descr := &fimg.DescrArr[idx]
+	*descr = Descriptor{
+		Datatype: input.Datatype,
+		Used:     true,
+		ID:       uint32(idx) + 1,
+		Groupid:  input.Groupid,
+		Link:     input.Link,
+		Fileoff:  offset,
+		Filelen:  size,
+		Storelen: offset + size - end,
+		Ctime:    now,
+		Mtime:    now,
+	}
+	descr.SetName(path.Base(input.Fname))
+	descr.SetExtra(input.Extra.Bytes())
+
+	if ptype, err := descr.GetPartType(); err == nil && ptype == PartPrimSys {
+		if fimg.PrimPartID != 0 {
+			return fmt.Errorf("only 1 FS data object may be a primary partition")
+		}
+		fimg.PrimPartID = descr.ID
+		arch, _ := descr.GetArch()
+		copy(fimg.Header.Arch[:], arch[:])
+	}
+
+	fimg.Header.Dfree--
+	fimg.Header.Datalen += descr.Storelen
+	fimg.Header.Mtime = now
+	if offset+size > fimg.Filesize {
+		fimg.Filesize = offset + size
+	}
+
+	if _, err := fimg.Fp.Seek(DescrStartOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to descriptor start offset: %s", err)
+	}
+	if err := binary.Write(fimg.Fp, binary.LittleEndian, fimg.DescrArr); err != nil {
+		return fmt.Errorf("binary writing descrtable to buf: %s", err)
+	}
+	fimg.Header.Descrlen = int64(binary.Size(fimg.DescrArr))
+
+	if _, err := fimg.Fp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to beginning of the file: %s", err)
+	}
+	if err := binary.Write(fimg.Fp, binary.LittleEndian, fimg.Header); err != nil {
+		return fmt.Errorf("binary writing header to buf: %s", err)
+	}
+
+	if err := fimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing new data object to SIF file: %s", err)
+	}
+
+	return nil
+}
+
+// SetPartExtra serializes the partition information of the data object.
+func (di *DescriptorInput) SetPartExtra(fs Fstype, part Parttype, arch string) error {
+	if arch == HdrArchUnknown {
+		return fmt.Errorf("architecture not supported: %v", arch)
+	}
+	extra := partition{
+		Fstype:   fs,
+		Parttype: part,
+	}
+	copy(extra.Arch[:], arch)
+
+	return binary.Write(&di.Extra, binary.LittleEndian, extra)
+}
+
+// SetSignExtra serializes the hash type and the signing entity of the
+// data object.
+func (di *DescriptorInput) SetSignExtra(hash Hashtype, entity string) error {
+	extra := signature{
+		Hashtype: hash,
+	}
+	h, err := hex.DecodeString(entity)
+	if err != nil {
+		return err
+	}
+	copy(extra.Entity[:], h)
+
+	return binary.Write(&di.Extra, binary.LittleEndian, extra)
+}
+
+// SetName sets the name of the descriptor.
+func (descr *Descriptor) SetName(name string) {
+	n := copy(descr.Name[:], name)
+	for i := n; i < len(descr.Name); i++ {
+		descr.Name[i] = 0
+	}
+}
+
+// SetExtra sets the type specific information of the descriptor.
+func (descr *Descriptor) SetExtra(extra []byte) {
+	n := copy(descr.Extra[:], extra)
+	for i := n; i < len(descr.Extra); i++ {
+		descr.Extra[i] = 0
+	}
+}
+
+// GetData reads the data object of the descriptor from the SIF image
+// file, it returns nil if the data object can't be read entirely.
+func (descr *Descriptor) GetData(fimg *FileImage) []byte {
+	if _, err := fimg.Fp.Seek(descr.Fileoff, io.SeekStart); err != nil {
+		return nil
+	}
+	data := make([]byte, descr.Filelen)
+	if _, err := io.ReadFull(fimg.Fp, data); err != nil {
+		return nil
+	}
+	return data
+}
+
+// GetName returns the name of the descriptor.
+func (descr *Descriptor) GetName() string {
+	return strings.TrimRight(string(descr.Name[:]), "\000")
+}
+
+// GetFsType returns the file system type of a partition descriptor.
+func (descr *Descriptor) GetFsType() (Fstype, error) {
+	var p partition
+	if err := descr.readExtra(DataPartition, &p); err != nil {
+		return -1, err
+	}
+	return p.Fstype, nil
+}
+
+// GetPartType returns the partition type of a partition descriptor.
+func (descr *Descriptor) GetPartType() (Parttype, error) {
+	var p partition
+	if err := descr.readExtra(DataPartition, &p); err != nil {
+		return -1, err
+	}
+	return p.Parttype, nil
+}
+
+// GetArch returns the architecture of a partition descriptor.
+func (descr *Descriptor) GetArch() ([HdrArchLen]byte, error) {
+	var p partition
+	if err := descr.readExtra(DataPartition, &p); err != nil {
+		return [HdrArchLen]byte{}, err
+	}
+	return p.Arch, nil
+}
+
+// GetHashType returns the hash algorithm of a signature descriptor.
+func (descr *Descriptor) GetHashType() (Hashtype, error) {
+	var s signature
+	if err := descr.readExtra(DataSignature, &s); err != nil {
+		return -1, err
+	}
+	return s.Hashtype, nil
+}
+
+// GetEntity returns the signing entity of a signature descriptor.
+func (descr *Descriptor) GetEntity() ([]byte, error) {
+	var s signature
+	if err := descr.readExtra(DataSignature, &s); err != nil {
+		return nil, err
+	}
+	return s.Entity[:], nil
+}
+
+// GetEntityString returns the fingerprint of the signing entity of a
+// signature descriptor.
+func (descr *Descriptor) GetEntityString() (string, error) {
+	entity, err := descr.GetEntity()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0X", entity[:fingerprintLength]), nil
+}
+
+// GetFormatType returns the format of a cryptographic message descriptor.
+func (descr *Descriptor) GetFormatType() (Formattype, error) {
+	var c cryptoMessage
+	if err := descr.readExtra(DataCryptoMessage, &c); err != nil {
+		return -1, err
+	}
+	return c.Formattype, nil
+}
+
+// GetMessageType returns the type of a cryptographic message descriptor.
+func (descr *Descriptor) GetMessageType() (Messagetype, error) {
+	var c cryptoMessage
+	if err := descr.readExtra(DataCryptoMessage, &c); err != nil {
+		return -1, err
+	}
+	return c.Messagetype, nil
+}
+
+func (descr *Descriptor) readExtra(dataType Datatype, extra interface{}) error {
+	if descr.Datatype != dataType {
+		return fmt.Errorf("expected %v, got %v", dataType, descr.Datatype)
+	}
+	if err := binary.Read(bytes.NewReader(descr.Extra[:]), binary.LittleEndian, extra); err != nil {
+		return fmt.Errorf("while extracting descriptor extra info: %s", err)
+	}
+	return nil
+}
+
+func nextAligned(offset int64, align int) int64 {
+	a := int64(align)
+	if offset%a != 0 {
+		offset += a - offset%a
+	}
+	return offset
+}
+
+func cstrToString(str []byte) string {
+	n := len(str)
+	if m := n - 1; str[m] == 0 {
+		n = m
+	}
+	return string(str[:n])
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package slurm provides helpers to run containers as part of Slurm jobs.
+package slurm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var jobRegexp = regexp.MustCompile(`^job_[0-9]+$`)
+
+// JobCgroup returns the cgroup path of the Slurm job from the cgroup
+// membership in r, formatted like /proc/self/cgroup, in the hierarchy
+// of the cgroups v1 controller or in the cgroups v2 unified hierarchy
+// if controller is empty. An empty string is returned if the process
+// is not part of a job.
+func JobCgroup(r io.Reader, controller string) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if controller == "" {
+			if fields[0] != "0" || fields[1] != "" {
+				continue
+			}
+		} else if !hasController(fields[1], controller) {
+			continue
+		}
+		elems := strings.Split(fields[2], "/")
+		for i, e := range elems {
+			if jobRegexp.MatchString(e) {
+				return strings.Join(elems[:i+1], "/")
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// hasController returns if the comma separated controller list
+// contains controller.
+func hasController(list, controller string) bool {
+	for _, c := range strings.Split(list, ",") {
+		if c == controller {
+			return true
+		}
+	}
+	return false
+}
+
+// SelfJobCgroup returns the cgroup path of the Slurm job the current
+// process belongs to in the hierarchy of controller, if any.
+func SelfJobCgroup(controller string) string {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return JobCgroup(f, controller)
+}
+
+// WrapperOptions holds options for the generated srun wrapper script.
+type WrapperOptions struct {
+	// Singularity is the path of the singularity binary.
+	Singularity string
+	// Image is the container image the job step runs in.
+	Image string
+	// Command is the command executed in the container, the container
+	// runscript is used if empty.
+	Command []string
+	// Args are extra arguments passed to the action command.
+	Args []string
+}
+
+var wrapperTemplate = template.Must(template.New("wrapper").Funcs(template.FuncMap{
+	"quote": quote,
+}).Parse(`#!/bin/sh
+# Generated by singularity slurm gen, run it with srun to execute each
+# task of the job step in {{ quote .Image }}.
+
+if [ -z "${SLURM_JOB_ID:-}" ]; then
+	echo "$0 must be executed within a Slurm job" >&2
+	exit 1
+fi
+
+# import Slurm environment into the container
+for var in $(env | sed -n 's/^\(SLURM_[A-Za-z0-9_]*\)=.*/\1/p'); do
+	if [ -z "$(printenv "SINGULARITYENV_${var}")" ]; then
+		export "SINGULARITYENV_${var}=$(printenv "${var}")"
+	fi
+done
+
+# map the job temporary directory on /tmp
+for dir in "${SLURM_JOB_TMPDIR:-}" "${SLURM_TMPDIR:-}" "${TMPDIR:-}"; do
+	if [ -n "${dir}" ] && [ "${dir}" != "/tmp" ] && [ -d "${dir}" ]; then
+		SINGULARITY_BINDPATH="${SINGULARITY_BINDPATH:+${SINGULARITY_BINDPATH},}${dir}:/tmp"
+		export SINGULARITY_BINDPATH
+		break
+	fi
+done
+
+{{ if .Command -}}
+exec {{ quote .Singularity }} exec{{ range .Args }} {{ quote . }}{{ end }} {{ quote .Image }}{{ range .Command }} {{ quote . }}{{ end }} "$@"
+{{- else -}}
+exec {{ quote .Singularity }} run{{ range .Args }} {{ quote . }}{{ end }} {{ quote .Image }} "$@"
+{{- end }}
+`))
+
+// quote returns s single-quoted for a POSIX shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// WriteWrapper writes an srun wrapper script running the job step
+// tasks in a container to w.
+func WriteWrapper(w io.Writer, opts WrapperOptions) error {
+	if opts.Image == "" {
+		return fmt.Errorf("no container image specified")
+	}
+	if opts.Singularity == "" {
+		opts.Singularity = "singularity"
+	}
+	if err := wrapperTemplate.Execute(w, opts); err != nil {
+		return fmt.Errorf("while generating wrapper script: %s", err)
+	}
+	return nil
+}
+
+// PlugstackLine returns the plugstack.conf line enabling the Singularity
+// SPANK plugin installed at plugin.
+func PlugstackLine(plugin, singularity string) string {
+	return fmt.Sprintf("optional %s singularity=%s", plugin, singularity)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package slurm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJobCgroup(t *testing.T) {
+	tests := []struct {
+		name       string
+		cgroup     string
+		controller string
+		expected   string
+	}{
+		{
+			name:       "not in a job",
+			cgroup:     "12:memory:/user.slice\n1:name=systemd:/user.slice/user-1000.slice/session-2.scope\n",
+			controller: "memory",
+			expected:   "",
+		},
+		{
+			name:       "job step task",
+			cgroup:     "12:memory:/slurm/uid_1000/job_42/step_0/task_0\n4:cpuset:/slurm/uid_1000/job_42/step_0\n",
+			controller: "memory",
+			expected:   "/slurm/uid_1000/job_42",
+		},
+		{
+			name:       "controller not first",
+			cgroup:     "12:freezer:/slurm/uid_1000/job_7/step_0\n3:cpu,cpuacct:/user.slice\n2:memory:/slurm/uid_1000/job_42/step_0\n",
+			controller: "memory",
+			expected:   "/slurm/uid_1000/job_42",
+		},
+		{
+			name:       "controller not in job",
+			cgroup:     "12:freezer:/slurm/uid_1000/job_42/step_0\n2:memory:/user.slice\n",
+			controller: "memory",
+			expected:   "",
+		},
+		{
+			name:       "comounted controllers",
+			cgroup:     "5:cpu,cpuacct:/slurm/uid_1000/job_42/step_0\n",
+			controller: "cpuacct",
+			expected:   "/slurm/uid_1000/job_42",
+		},
+		{
+			name:     "unified hierarchy",
+			cgroup:   "0::/system.slice/slurmstepd.scope/job_1337/step_batch/user/task_0\n",
+			expected: "/system.slice/slurmstepd.scope/job_1337",
+		},
+		{
+			name:     "hybrid hierarchy",
+			cgroup:   "4:memory:/slurm/uid_1000/job_42/step_0\n1:name=systemd:/job_7\n0::/system.slice/slurmstepd.scope/job_1337\n",
+			expected: "/system.slice/slurmstepd.scope/job_1337",
+		},
+		{
+			name:       "malformed",
+			cgroup:     "job_42\n",
+			controller: "memory",
+			expected:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if path := JobCgroup(strings.NewReader(tt.cgroup), tt.controller); path != tt.expected {
+				t.Errorf("got %q, expected %q", path, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteWrapper(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteWrapper(&buf, WrapperOptions{}); err == nil {
+		t.Errorf("unexpected success without image")
+	}
+
+	buf.Reset()
+	opts := WrapperOptions{
+		Singularity: "/usr/local/bin/singularity",
+		Image:       "/shared/it's.sif",
+		Command:     []string{"python3", "train.py"},
+		Args:        []string{"--nv"},
+	}
+	if err := WriteWrapper(&buf, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `exec '/usr/local/bin/singularity' exec '--nv' '/shared/it'\''s.sif' 'python3' 'train.py' "$@"`
+	if !strings.Contains(buf.String(), expected+"\n") {
+		t.Errorf("exec line %q not found in:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	opts.Command = nil
+	opts.Args = nil
+	if err := WriteWrapper(&buf, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = `exec '/usr/local/bin/singularity' run '/shared/it'\''s.sif' "$@"`
+	if !strings.Contains(buf.String(), expected+"\n") {
+		t.Errorf("run line %q not found in:\n%s", expected, buf.String())
+	}
+}
@@ -15,15 +15,49 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	toml "github.com/pelletier/go-toml"
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/sypgp"
+	"golang.org/x/crypto/openpgp"
 )
 
+// Image sources of the sources rule, images found in the image cache come
+// from the source of their cache directory, other images are local.
+const (
+	SourceLocal   = "local"
+	SourceLibrary = "library"
+	SourceOras    = "oras"
+	SourceShub    = "shub"
+	SourceOCI     = "oci"
+	SourceNet     = "net"
+)
+
+// cacheSources maps image cache directories to the source of their images.
+var cacheSources = map[string]string{
+	cache.LibraryDir: SourceLibrary,
+	cache.OrasDir:    SourceOras,
+	cache.ShubDir:    SourceShub,
+	cache.OciTempDir: SourceOCI,
+	cache.NetDir:     SourceNet,
+}
+
 // EclConfig describes the structure of an execution control list configuration file
 type EclConfig struct {
-	Activated  bool        `toml:"activated"` // toggle the activation of the ECL rules
-	ExecGroups []execgroup `toml:"execgroup"` // Slice of all execution groups
+	Activated   bool        `toml:"activated"`   // toggle the activation of the ECL rules
+	Verify      bool        `toml:"verify"`      // only consider valid signatures made with keys of Keyring
+	Keyring     string      `toml:"keyring"`     // public keyring used to verify signatures
+	Sources     []string    `toml:"sources"`     // allowed image sources, all sources if empty
+	LocalRoots  []string    `toml:"localroots"`  // directories local images must be in, anywhere if empty
+	DenySandbox bool        `toml:"denysandbox"` // deny execution of sandbox images
+	ExecGroups  []execgroup `toml:"execgroup"`   // Slice of all execution groups
+
+	keyring   openpgp.EntityList
+	cacheRoot string
 }
 
 // execgroup describes an execution group, the main unit of configuration:
@@ -69,6 +103,23 @@ func PutConfig(ecl EclConfig, confPath string) (err error) {
 func (ecl *EclConfig) ValidateConfig() error {
 	m := map[string]bool{}
 
+	if ecl.Verify && ecl.Keyring == "" {
+		return fmt.Errorf("a keyring is required to verify signatures")
+	}
+	if ecl.Keyring != "" && !filepath.IsAbs(ecl.Keyring) {
+		return fmt.Errorf("keyring path must be absolute: %s", ecl.Keyring)
+	}
+	for _, src := range ecl.Sources {
+		if src != SourceLocal && !isCacheSource(src) {
+			return fmt.Errorf("unknown image source %q", src)
+		}
+	}
+	for _, root := range ecl.LocalRoots {
+		if err := checkResolvedPath(root); err != nil {
+			return fmt.Errorf("localroots: %s", err)
+		}
+	}
+
 	for _, v := range ecl.ExecGroups {
 		if m[v.DirPath] {
 			return fmt.Errorf("a specific dirpath can only appear in one execgroup: %s", v.DirPath)
@@ -77,16 +128,8 @@ func (ecl *EclConfig) ValidateConfig() error {
 
 		// if we allow containers everywhere, don't test dirpath constraint
 		if v.DirPath != "" {
-			path, err := filepath.EvalSymlinks(v.DirPath)
-			if err != nil {
-				return err
-			}
-			abs, err := filepath.Abs(path)
-			if err != nil {
-				return err
-			}
-			if v.DirPath != abs {
-				return fmt.Errorf("all execgroup dirpath`s should be fully cleaned with symlinks resolved")
+			if err := checkResolvedPath(v.DirPath); err != nil {
+				return fmt.Errorf("execgroup dirpath: %s", err)
 			}
 		}
 		if v.ListMode != "whitelist" && v.ListMode != "whitestrict" && v.ListMode != "blacklist" {
@@ -103,10 +146,142 @@ func (ecl *EclConfig) ValidateConfig() error {
 	return nil
 }
 
+// checkResolvedPath returns an error if path isn't an absolute path,
+// fully cleaned with symlinks resolved.
+func checkResolvedPath(path string) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return err
+	}
+	if path != abs {
+		return fmt.Errorf("%s should be fully cleaned with symlinks resolved", path)
+	}
+	return nil
+}
+
+func isCacheSource(source string) bool {
+	for _, s := range cacheSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCacheRoot sets the image cache directory of the user running images.
+// It must be determined by the caller, not reported by the user, as the
+// source of an image is deduced from its location.
+func (ecl *EclConfig) SetCacheRoot(dir string) {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	ecl.cacheRoot = dir
+}
+
+// imageSource returns the source of the image at the resolved path.
+func (ecl *EclConfig) imageSource(path string) string {
+	if ecl.cacheRoot == "" {
+		return SourceLocal
+	}
+	rel, err := filepath.Rel(ecl.cacheRoot, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return SourceLocal
+	}
+	if src, ok := cacheSources[strings.SplitN(rel, string(filepath.Separator), 2)[0]]; ok {
+		return src
+	}
+	return SourceLocal
+}
+
+// checkSource returns an error if the image at the resolved path comes
+// from a source not allowed by the sources rule, or if it's a local image
+// outside of the local roots.
+func (ecl *EclConfig) checkSource(path string) error {
+	source := ecl.imageSource(path)
+
+	if len(ecl.Sources) > 0 {
+		allowed := false
+		for _, s := range ecl.Sources {
+			allowed = allowed || s == source
+		}
+		if !allowed {
+			return fmt.Errorf("%s images are not allowed to run: %s", source, path)
+		}
+	}
+
+	if source == SourceLocal && len(ecl.LocalRoots) > 0 {
+		for _, root := range ecl.LocalRoots {
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is not in an allowed local image directory", path)
+	}
+
+	return nil
+}
+
+// LoadKeyring loads the public keyring used to verify signatures. The
+// keyring file is opened once and its owner is checked on the opened file,
+// with rootOwned the keyring must be owned by root and only writable by root.
+func (ecl *EclConfig) LoadKeyring(rootOwned bool) error {
+	f, err := os.Open(ecl.Keyring)
+	if err != nil {
+		return fmt.Errorf("could not open ECL keyring %s: %s", ecl.Keyring, err)
+	}
+	defer f.Close()
+
+	if rootOwned {
+		fi, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("could not stat ECL keyring %s: %s", ecl.Keyring, err)
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		if st.Uid != 0 || fi.Mode().Perm()&0022 != 0 {
+			return fmt.Errorf("%s must be owned by root and only writable by root", ecl.Keyring)
+		}
+	}
+
+	keyring, err := sypgp.ReadKeys(f)
+	if err != nil {
+		return fmt.Errorf("could not load ECL keyring %s: %s", ecl.Keyring, err)
+	}
+	ecl.keyring = keyring
+	return nil
+}
+
+// signers returns the fingerprints of the signing entities of the primary
+// partition, with verify only the entities having a valid signature made with
+// a key of the ECL keyring are returned.
+func (ecl *EclConfig) signers(fp *os.File, verify bool) ([]string, error) {
+	if !verify {
+		return signing.GetSignEntitiesFp(fp)
+	}
+
+	if ecl.keyring == nil {
+		if err := ecl.LoadKeyring(false); err != nil {
+			return nil, err
+		}
+	}
+
+	return signing.ValidSignersFp(fp, ecl.keyring)
+}
+
+// VerifiedSigners returns the fingerprints of the keys of the ECL keyring
+// having a valid signature for the primary partition of the SIF image
+// opened as fp, regardless of the execgroup rules.
+func (ecl *EclConfig) VerifiedSigners(fp *os.File) ([]string, error) {
+	return ecl.signers(fp, true)
+}
+
 // checkWhiteList evaluates authorization by requiring at least 1 entity
-func checkWhiteList(fp *os.File, egroup *execgroup) (ok bool, err error) {
+func checkWhiteList(ecl *EclConfig, fp *os.File, egroup *execgroup) (ok bool, err error) {
 	// get all signing entities fingerprints on the primary partition
-	keyfps, err := signing.GetSignEntitiesFp(fp)
+	keyfps, err := ecl.signers(fp, ecl.Verify)
 	if err != nil {
 		return
 	}
@@ -126,9 +301,9 @@ func checkWhiteList(fp *os.File, egroup *execgroup) (ok bool, err error) {
 }
 
 // checkWhiteStrict evaluates authorization by requiring all entities
-func checkWhiteStrict(fp *os.File, egroup *execgroup) (ok bool, err error) {
+func checkWhiteStrict(ecl *EclConfig, fp *os.File, egroup *execgroup) (ok bool, err error) {
 	// get all signing entities fingerprints on the primary partition
-	keyfps, err := signing.GetSignEntitiesFp(fp)
+	keyfps, err := ecl.signers(fp, ecl.Verify)
 	if err != nil {
 		return
 	}
@@ -152,10 +327,11 @@ func checkWhiteStrict(fp *os.File, egroup *execgroup) (ok bool, err error) {
 	return true, nil
 }
 
-// checkBlackList evaluates authorization by requiring all entities to be absent
-func checkBlackList(fp *os.File, egroup *execgroup) (ok bool, err error) {
+// checkBlackList evaluates authorization by requiring all entities to be absent,
+// signatures don't need to be valid to be forbidden
+func checkBlackList(ecl *EclConfig, fp *os.File, egroup *execgroup) (ok bool, err error) {
 	// get all signing entities fingerprints on the primary partition
-	keyfps, err := signing.GetSignEntitiesFp(fp)
+	keyfps, err := ecl.signers(fp, false)
 	if err != nil {
 		return
 	}
@@ -197,11 +373,11 @@ func shouldRun(ecl *EclConfig, fp *os.File) (ok bool, err error) {
 
 	switch egroup.ListMode {
 	case "whitelist":
-		return checkWhiteList(fp, egroup)
+		return checkWhiteList(ecl, fp, egroup)
 	case "whitestrict":
-		return checkWhiteStrict(fp, egroup)
+		return checkWhiteStrict(ecl, fp, egroup)
 	case "blacklist":
-		return checkBlackList(fp, egroup)
+		return checkBlackList(ecl, fp, egroup)
 	}
 
 	return false, fmt.Errorf("ecl config file invalid")
@@ -231,3 +407,32 @@ func (ecl *EclConfig) ShouldRunFp(fp *os.File) (ok bool, err error) {
 
 	return shouldRun(ecl, fp)
 }
+
+// ShouldRunImage determines if an opened image should run. Besides execgroup
+// rules applying to SIF images, image sources can be restricted and sandbox
+// images can be denied. With verify, images other than SIF are denied as their
+// signatures can't be checked. Signatures are read from the opened image file,
+// the file mounted for the container, not from its path. The image source is
+// deduced from the resolved image path, see SetCacheRoot.
+func (ecl *EclConfig) ShouldRunImage(img *image.Image) (ok bool, err error) {
+	// look if ECL rules are activated
+	if !ecl.Activated {
+		return true, nil
+	}
+
+	if err := ecl.checkSource(img.Path); err != nil {
+		return false, err
+	}
+
+	if img.Type == image.SANDBOX && ecl.DenySandbox {
+		return false, fmt.Errorf("sandbox images are not allowed to run")
+	}
+	if img.Type != image.SIF {
+		if ecl.Verify {
+			return false, fmt.Errorf("%s is not a SIF image, its signatures can't be verified", img.Path)
+		}
+		return true, nil
+	}
+
+	return shouldRun(ecl, img.File)
+}
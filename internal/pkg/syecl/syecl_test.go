@@ -6,11 +6,16 @@
 package syecl
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/signing"
+	"golang.org/x/crypto/openpgp"
 )
 
 const (
@@ -156,6 +161,285 @@ func TestShouldRun(t *testing.T) {
 	}
 }
 
+func TestShouldRunImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecl-image-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// sign a copy of container1 with a new key
+	entity, err := openpgp.NewEntity("ecl", "", "ecl@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyringDir := filepath.Join(dir, "sypgp")
+	if err := os.Mkdir(keyringDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(keyringDir, "pgp-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entity.SerializePrivate(f, nil)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := filepath.Join(dir, "keyring")
+	f, err = os.Create(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entity.Serialize(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := filepath.Join(dir, "signed.sif")
+	if err := copyFile(signed, srcContainer1); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SINGULARITY_SYPGPDIR", keyringDir)
+	defer os.Unsetenv("SINGULARITY_SYPGPDIR")
+	if err := signing.Sign(signed, 0, false, 0); err != nil {
+		t.Fatalf("could not sign %s: %s", signed, err)
+	}
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+
+	sandbox := filepath.Join(dir, "sandbox")
+	if err := os.Mkdir(sandbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ecl        EclConfig
+		path       string
+		shouldFail bool
+	}{
+		{
+			name: "deactivated",
+			ecl:  EclConfig{DenySandbox: true},
+			path: sandbox,
+		},
+		{
+			name: "entity without verify",
+			ecl: EclConfig{
+				Activated:  true,
+				ExecGroups: []execgroup{{"group", "whitelist", "", []string{KeyFP1}}},
+			},
+			path: srcContainer1,
+		},
+		{
+			name: "unverified entity",
+			ecl: EclConfig{
+				Activated:  true,
+				Verify:     true,
+				Keyring:    keyring,
+				ExecGroups: []execgroup{{"group", "whitelist", "", []string{KeyFP1, fingerprint}}},
+			},
+			path:       srcContainer1,
+			shouldFail: true,
+		},
+		{
+			name: "verified entity",
+			ecl: EclConfig{
+				Activated:  true,
+				Verify:     true,
+				Keyring:    keyring,
+				ExecGroups: []execgroup{{"group", "whitelist", "", []string{KeyFP1, fingerprint}}},
+			},
+			path: signed,
+		},
+		{
+			name: "sandbox allowed",
+			ecl:  EclConfig{Activated: true},
+			path: sandbox,
+		},
+		{
+			name:       "sandbox denied",
+			ecl:        EclConfig{Activated: true, DenySandbox: true},
+			path:       sandbox,
+			shouldFail: true,
+		},
+		{
+			name:       "sandbox unverified",
+			ecl:        EclConfig{Activated: true, Verify: true, Keyring: keyring},
+			path:       sandbox,
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ecl.ValidateConfig(); err != nil {
+				t.Fatalf("unexpected invalid config: %s", err)
+			}
+
+			img, err := image.Init(tt.path, false)
+			if err != nil {
+				t.Fatalf("could not open image %s: %s", tt.path, err)
+			}
+			defer img.File.Close()
+
+			run, err := tt.ecl.ShouldRunImage(img)
+			if tt.shouldFail && (err == nil || run) {
+				t.Errorf("%s should NOT be allowed to run", tt.path)
+			} else if !tt.shouldFail && (err != nil || !run) {
+				t.Errorf("%s should be allowed to run: %v", tt.path, err)
+			}
+		})
+	}
+
+	invalid := []EclConfig{
+		{Verify: true},
+		{Keyring: "keyring"},
+		{Sources: []string{"ftp"}},
+		{LocalRoots: []string{"images"}},
+	}
+	for _, ecl := range invalid {
+		if err := ecl.ValidateConfig(); err == nil {
+			t.Errorf("unexpected valid config: %+v", ecl)
+		}
+	}
+
+	// the keyring created by the test isn't owned by root
+	ecl := EclConfig{Keyring: keyring}
+	if os.Getuid() != 0 {
+		if err := ecl.LoadKeyring(true); err == nil {
+			t.Errorf("unexpected success loading a keyring not owned by root")
+		}
+	}
+	if err := ecl.LoadKeyring(false); err != nil {
+		t.Errorf("unexpected error loading keyring: %s", err)
+	}
+}
+
+func TestShouldRunImageSources(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ecl-sources-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// ValidateConfig requires resolved local roots
+	dir, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheRoot := filepath.Join(dir, "cache")
+	libraryDir := filepath.Join(cacheRoot, "library", "sha256.0123")
+	localDir := filepath.Join(dir, "images")
+	for _, d := range []string{libraryDir, localDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	library := filepath.Join(libraryDir, "container1.sif")
+	local := filepath.Join(localDir, "container1.sif")
+	for _, p := range []string{library, local} {
+		if err := copyFile(p, srcContainer1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a symlink in the local roots pointing to an image elsewhere
+	target, err := filepath.Abs(srcContainer1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(localDir, "link.sif")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	// container1 is allowed to run from anywhere
+	anywhere := []execgroup{{"group", "whitelist", "", []string{KeyFP1}}}
+
+	tests := []struct {
+		name       string
+		ecl        EclConfig
+		path       string
+		shouldFail bool
+	}{
+		{
+			name: "library allowed",
+			ecl:  EclConfig{Activated: true, Sources: []string{SourceLibrary}, ExecGroups: anywhere},
+			path: library,
+		},
+		{
+			name:       "local denied",
+			ecl:        EclConfig{Activated: true, Sources: []string{SourceLibrary}, ExecGroups: anywhere},
+			path:       local,
+			shouldFail: true,
+		},
+		{
+			name:       "library denied",
+			ecl:        EclConfig{Activated: true, Sources: []string{SourceLocal, SourceOras}, ExecGroups: anywhere},
+			path:       library,
+			shouldFail: true,
+		},
+		{
+			name: "local in local roots",
+			ecl:  EclConfig{Activated: true, Sources: []string{SourceLocal}, LocalRoots: []string{localDir}, ExecGroups: anywhere},
+			path: local,
+		},
+		{
+			name:       "local outside of local roots",
+			ecl:        EclConfig{Activated: true, LocalRoots: []string{localDir}, ExecGroups: anywhere},
+			path:       srcContainer1,
+			shouldFail: true,
+		},
+		{
+			name:       "symlink outside of local roots",
+			ecl:        EclConfig{Activated: true, LocalRoots: []string{localDir}, ExecGroups: anywhere},
+			path:       link,
+			shouldFail: true,
+		},
+		{
+			name: "cache image with local roots",
+			ecl:  EclConfig{Activated: true, LocalRoots: []string{localDir}, ExecGroups: anywhere},
+			path: library,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ecl.ValidateConfig(); err != nil {
+				t.Fatalf("unexpected invalid config: %s", err)
+			}
+			tt.ecl.SetCacheRoot(cacheRoot)
+
+			img, err := image.Init(tt.path, false)
+			if err != nil {
+				t.Fatalf("could not open image %s: %s", tt.path, err)
+			}
+			defer img.File.Close()
+
+			run, err := tt.ecl.ShouldRunImage(img)
+			if tt.shouldFail && (err == nil || run) {
+				t.Errorf("%s should NOT be allowed to run", tt.path)
+			} else if !tt.shouldFail && (err != nil || !run) {
+				t.Errorf("%s should be allowed to run: %v", tt.path, err)
+			}
+		})
+	}
+
+	// without cache root all images are local
+	ecl := EclConfig{Activated: true, Sources: []string{SourceLibrary}, ExecGroups: anywhere}
+	img, err := image.Init(library, false)
+	if err != nil {
+		t.Fatalf("could not open image %s: %s", library, err)
+	}
+	defer img.File.Close()
+	if run, err := ecl.ShouldRunImage(img); err == nil || run {
+		t.Errorf("%s should NOT be allowed to run without cache root", library)
+	}
+}
+
 func copyFile(dst, src string) error {
 	s, err := os.Open(src)
 	if err != nil {
@@ -127,6 +127,13 @@ func Fatalf(format string, a ...interface{}) {
 	os.Exit(255)
 }
 
+// FatalCodef is equivalent to Fatalf but exits with the provided exit code.
+// Code that may be imported by other projects should NOT use FatalCodef.
+func FatalCodef(code int, format string, a ...interface{}) {
+	writef(os.Stderr, fatal, format, a...)
+	os.Exit(code)
+}
+
 // Errorf writes an ERROR level message to the log but does not exit. This
 // should be called when an error is being returned to the calling thread
 func Errorf(format string, a ...interface{}) {
@@ -20,6 +20,12 @@ func Fatalf(format string, a ...interface{}) {
 	os.Exit(255)
 }
 
+// FatalCodef is a dummy function exiting with the provided code.
+// This function must not be used in public packages.
+func FatalCodef(code int, format string, a ...interface{}) {
+	os.Exit(code)
+}
+
 // Errorf is a dummy function doing nothing.
 func Errorf(format string, a ...interface{}) {}
 
@@ -16,9 +16,16 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
-	singularity "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
 
+// fileConfig holds the singularity.conf directives used by this
+// package, the singularity engine configuration depends on packages
+// using this package.
+type fileConfig struct {
+	CryptsetupPath  string `directive:"cryptsetup path"`
+	VeritysetupPath string `directive:"veritysetup path"`
+}
+
 var (
 	// errCryptsetupNotFound is returned when cryptsetup is not found
 	errCryptsetupNotFound = errors.New("cryptsetup not found")
@@ -28,6 +35,12 @@ var (
 		cryptsetup string
 		err        error
 	}
+
+	veritysetupCache struct {
+		sync.Once
+		veritysetup string
+		err         error
+	}
 )
 
 // Cryptsetup looks for the "cryptsetup" program returning the absolute
@@ -55,7 +68,7 @@ func cryptsetup(cfgpath string) (string, error) {
 		return "", errCryptsetupNotFound
 	}
 
-	cfg := singularity.FileConfig{}
+	cfg := fileConfig{}
 	if err := config.Parser(cfgpath, &cfg); err != nil {
 		return "", errors.Wrap(err, "unable to parse singularity configuration file")
 	}
@@ -84,3 +97,48 @@ func cryptsetup(cfgpath string) (string, error) {
 	// use exec.LookPath to verify it's an executable.
 	return exec.LookPath(path)
 }
+
+// Veritysetup looks for the "veritysetup" program returning the absolute
+// path to it. If the veritysetup program is not available, this function
+// returns a non-nil error.
+func Veritysetup() (string, error) {
+	veritysetupCache.Do(func() {
+		cfgpath := buildcfg.SINGULARITY_CONF_FILE
+		veritysetupCache.veritysetup, veritysetupCache.err = veritysetup(cfgpath)
+		sylog.Debugf("Using veritysetup at %q", veritysetupCache.veritysetup)
+	})
+
+	return veritysetupCache.veritysetup, veritysetupCache.err
+}
+
+// veritysetup checks that veritysetup is available in the location
+// specified in the configuration file, falling back to the directory
+// of cryptsetup as they are shipped together, and then to PATH.
+func veritysetup(cfgpath string) (string, error) {
+	cfg := fileConfig{}
+	if err := config.Parser(cfgpath, &cfg); err != nil {
+		return "", errors.Wrap(err, "unable to parse singularity configuration file")
+	}
+
+	path := cfg.VeritysetupPath
+
+	if path == "" {
+		if buildcfg.CRYPTSETUP_PATH != "" {
+			path = filepath.Join(filepath.Dir(buildcfg.CRYPTSETUP_PATH), "veritysetup")
+			if _, err := os.Stat(path); err == nil {
+				return exec.LookPath(path)
+			}
+		}
+		return exec.LookPath("veritysetup")
+	}
+
+	switch fi, err := os.Stat(path); {
+	case err != nil:
+		return "", errors.Wrapf(err, "unable to stat %s", path)
+
+	case fi.IsDir():
+		path = filepath.Join(path, "veritysetup")
+	}
+
+	return exec.LookPath(path)
+}
@@ -81,6 +81,37 @@ func SetContainerEnv(g *generate.Generator, env []string, cleanEnv bool, homeDes
 	}
 }
 
+// commandKeys are the variables read by the singularity command itself.
+var commandKeys = map[string]bool{
+	"HOME":            true,
+	"PATH":            true,
+	"USER":            true,
+	"LOGNAME":         true,
+	"LANG":            true,
+	"TMPDIR":          true,
+	"XDG_RUNTIME_DIR": true,
+}
+
+// CommandEnv returns the variables of env needed to run the singularity
+// command again: the variables setting command options or the container
+// environment with the SINGULARITY_ and SINGULARITYENV_ prefixes, and
+// the variables always passed to containers.
+func CommandEnv(env []string) []string {
+	var command []string
+
+	for _, env := range env {
+		e := strings.SplitN(env, "=", 2)
+		if len(e) != 2 {
+			continue
+		}
+		if strings.HasPrefix(e[0], "SINGULARITY_") || strings.HasPrefix(e[0], envPrefix) ||
+			commandKeys[e[0]] || alwaysPassKeys[e[0]] {
+			command = append(command, env)
+		}
+	}
+	return command
+}
+
 func addIfReq(key string, cleanEnv bool) (string, bool) {
 	if strings.HasPrefix(key, envPrefix) {
 		return strings.TrimPrefix(key, envPrefix), true
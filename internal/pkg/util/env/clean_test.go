@@ -89,3 +89,27 @@ func equal(a, b []string) bool {
 	}
 	return true
 }
+
+func TestCommandEnv(t *testing.T) {
+	env := []string{
+		"HOME=/home/tester",
+		"TERM=xterm-256color",
+		"SINGULARITY_CACHEDIR=/tmp/cache",
+		"SINGULARITYENV_FOO=VAR",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"https_proxy=https_proxy",
+		"INVALID",
+	}
+	expected := []string{
+		"HOME=/home/tester",
+		"TERM=xterm-256color",
+		"SINGULARITY_CACHEDIR=/tmp/cache",
+		"SINGULARITYENV_FOO=VAR",
+		"https_proxy=https_proxy",
+	}
+
+	command := CommandEnv(env)
+	if strings.Join(command, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected command environment %v instead of %v", command, expected)
+	}
+}
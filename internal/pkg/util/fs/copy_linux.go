@@ -0,0 +1,182 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
+	"golang.org/x/sys/unix"
+)
+
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// CopyTree copies the content of the src directory into the existing dst
+// directory, file types, ownership, permissions, modification times, hard
+// links and extended attributes are preserved when permitted. It returns
+// the extended attributes which had to be dropped. Regular files share
+// their content with the source files when the filesystem supports
+// reflinks.
+func CopyTree(src, dst string) (xattr.Dropped, error) {
+	links := make(map[inode]string)
+	var dirs []string
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		st := new(unix.Stat_t)
+		if err := unix.Lstat(path, st); err != nil {
+			return err
+		}
+
+		switch st.Mode & unix.S_IFMT {
+		case unix.S_IFDIR:
+			if rel != "." {
+				if err := unix.Mkdir(target, 0700); err != nil {
+					return fmt.Errorf("while creating directory %s: %s", target, err)
+				}
+			}
+			dirs = append(dirs, rel)
+		case unix.S_IFLNK:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("while reading symlink %s: %s", path, err)
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return fmt.Errorf("while creating symlink %s: %s", target, err)
+			}
+		default:
+			id := inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+			if st.Nlink > 1 {
+				if first, ok := links[id]; ok {
+					if err := os.Link(first, target); err != nil {
+						return fmt.Errorf("while creating hard link %s: %s", target, err)
+					}
+					return nil
+				}
+				links[id] = target
+			}
+			if st.Mode&unix.S_IFMT == unix.S_IFREG {
+				if err := copyContent(path, target); err != nil {
+					return err
+				}
+			} else if err := unix.Mknod(target, st.Mode&unix.S_IFMT|0600, int(st.Rdev)); err != nil {
+				return fmt.Errorf("while creating %s: %s", target, err)
+			}
+		}
+
+		if err := os.Lchown(target, int(st.Uid), int(st.Gid)); err != nil && !os.IsPermission(err) {
+			return fmt.Errorf("while changing owner of %s: %s", target, err)
+		}
+		if st.Mode&unix.S_IFMT == unix.S_IFLNK || st.Mode&unix.S_IFMT == unix.S_IFDIR {
+			return nil
+		}
+		// chmod must occur after chown which clears setuid/setgid bits
+		if err := unix.Chmod(target, st.Mode&^unix.S_IFMT); err != nil {
+			return fmt.Errorf("while changing mode of %s: %s", target, err)
+		}
+		return setTimes(target, st)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dropped, err := xattr.CopyTree(src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	// directory modes and times are set once their entries are
+	// created, starting with the deepest directories
+	for i := len(dirs) - 1; i >= 0; i-- {
+		var st unix.Stat_t
+		if err := unix.Lstat(filepath.Join(src, dirs[i]), &st); err != nil {
+			return nil, err
+		}
+		target := filepath.Join(dst, dirs[i])
+		if err := unix.Chmod(target, st.Mode&^unix.S_IFMT); err != nil {
+			return nil, fmt.Errorf("while changing mode of %s: %s", target, err)
+		}
+		if err := setTimes(target, &st); err != nil {
+			return nil, err
+		}
+	}
+
+	return dropped, nil
+}
+
+func copyContent(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("while opening %s: %s", from, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("while creating %s: %s", to, err)
+	}
+	if clone(out, in) == nil {
+		return out.Close()
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("while copying %s: %s", from, err)
+	}
+	return out.Close()
+}
+
+// Reflink creates the file to sharing the content of the file from with
+// mode 0600, both files must be on the same filesystem and the filesystem
+// must support reflinks, like btrfs or xfs. The content is copied on write
+// so changes made to one file are not seen in the other one.
+func Reflink(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := clone(out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return fmt.Errorf("while cloning %s: %s", from, err)
+	}
+	return out.Close()
+}
+
+// clone shares the content of the file in with the file out.
+func clone(out, in *os.File) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setTimes(path string, st *unix.Stat_t) error {
+	ts := []unix.Timespec{st.Atim, st.Mtim}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("while changing times of %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyTree(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	src, err := ioutil.TempDir("", "copytree-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "copytree-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := os.MkdirAll(filepath.Join(src, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "usr", "bin", "tool"), []byte("content"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "usr", "bin", "tool"), filepath.Join(src, "usr", "bin", "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(src, "bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mkfifo(filepath.Join(src, "fifo"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	// entries must be created before the directory becomes read-only
+	if err := os.Chmod(filepath.Join(src, "usr"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(src, "usr"), 0755)
+	defer os.Chmod(filepath.Join(dst, "usr"), 0755)
+
+	if _, err := CopyTree(src, dst); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "bin", "tool"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		mode os.FileMode
+	}{
+		{"directory", "usr", os.ModeDir | 0555},
+		{"file", "usr/bin/tool", 0700},
+		{"symlink", "bin", os.ModeSymlink | 0777},
+		{"fifo", "fifo", os.ModeNamedPipe | 0640},
+	}
+	for _, tt := range tests {
+		fi, err := os.Lstat(filepath.Join(dst, tt.path))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if fi.Mode() != tt.mode {
+			t.Errorf("%s: got mode %s, expected %s", tt.name, fi.Mode(), tt.mode)
+		}
+	}
+
+	tool, err := os.Stat(filepath.Join(dst, "usr", "bin", "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias, err := os.Stat(filepath.Join(dst, "usr", "bin", "alias"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(tool, alias) {
+		t.Errorf("hard link not preserved")
+	}
+}
+
+func TestReflink(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "reflink-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from := filepath.Join(dir, "from")
+	to := filepath.Join(dir, "to")
+	if err := ioutil.WriteFile(from, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reflink(filepath.Join(dir, "missing"), to); err == nil {
+		t.Fatalf("unexpected success with a missing source file")
+	}
+
+	if err := Reflink(from, to); err != nil {
+		// the temporary directory filesystem doesn't support
+		// reflinks, the destination file must not be left over
+		if _, err := os.Lstat(to); !os.IsNotExist(err) {
+			t.Fatalf("%s left after a failed reflink", to)
+		}
+		t.Skipf("reflinks not supported: %s", err)
+	}
+
+	if b, err := ioutil.ReadFile(to); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "content" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if err := Reflink(from, to); err == nil {
+		t.Errorf("unexpected success with an existing destination file")
+	}
+}
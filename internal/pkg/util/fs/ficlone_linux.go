@@ -0,0 +1,11 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !mips,!mipsle,!mips64,!mips64le,!ppc64,!ppc64le,!sparc64
+
+package fs
+
+// ficlone is the FICLONE ioctl request number, _IOW(0x94, 9, int).
+const ficlone = 0x40049409
@@ -114,3 +114,70 @@ func TestResolvConf(t *testing.T) {
 		t.Errorf("ResolvConf returns a bad content")
 	}
 }
+
+func TestResolvConfNameservers(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	_, err := ResolvConfNameservers([]byte("nameserver 8.8.8.8\n"), []string{})
+	if err == nil {
+		t.Errorf("should have failed with empty dns")
+	}
+	_, err = ResolvConfNameservers([]byte("nameserver 8.8.8.8\n"), []string{"test"})
+	if err == nil {
+		t.Errorf("should have failed with bad dns")
+	}
+	content, err := ResolvConfNameservers([]byte("nameserver 8.8.8.8\noptions ndots:2\nsearch example.org"), []string{"1.1.1.1"})
+	if err != nil {
+		t.Errorf("should have passed with valid dns")
+	}
+	if !bytes.Equal(content, []byte("nameserver 1.1.1.1\noptions ndots:2\nsearch example.org\n")) {
+		t.Errorf("ResolvConfNameservers returns a bad content: %q", content)
+	}
+}
+
+func TestResolvConfSearch(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	_, err := ResolvConfSearch(nil, []string{})
+	if err == nil {
+		t.Errorf("should have failed with empty search domains")
+	}
+	_, err = ResolvConfSearch(nil, []string{"bad domain"})
+	if err == nil {
+		t.Errorf("should have failed with bad search domain")
+	}
+	content, err := ResolvConfSearch([]byte("domain local\nnameserver 8.8.8.8\nsearch example.org"), []string{"sylabs.io", "example.com"})
+	if err != nil {
+		t.Errorf("should have passed with valid search domains")
+	}
+	if !bytes.Equal(content, []byte("nameserver 8.8.8.8\nsearch sylabs.io example.com\n")) {
+		t.Errorf("ResolvConfSearch returns a bad content: %q", content)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	_, err := Hosts(nil, []string{"myhost"})
+	if err == nil {
+		t.Errorf("should have failed without IP address")
+	}
+	_, err = Hosts(nil, []string{"bad|host:10.0.0.1"})
+	if err == nil {
+		t.Errorf("should have failed with non valid hostname")
+	}
+	_, err = Hosts(nil, []string{"myhost:10.0.0"})
+	if err == nil {
+		t.Errorf("should have failed with non valid IP address")
+	}
+	content, err := Hosts([]byte("127.0.0.1\tlocalhost"), []string{"myhost:10.0.0.1", "myhost6:fd00::1"})
+	if err != nil {
+		t.Errorf("should have passed with valid host entries")
+	}
+	if !bytes.Equal(content, []byte("127.0.0.1\tlocalhost\n10.0.0.1\tmyhost\nfd00::1\tmyhost6\n")) {
+		t.Errorf("Hosts returns a bad content: %q", content)
+	}
+}
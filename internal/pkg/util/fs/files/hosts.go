@@ -0,0 +1,52 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package files
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// ParseHost parses a host entry with the form name:ip and returns the
+// host name and its IP address
+func ParseHost(entry string) (string, net.IP, error) {
+	splitted := strings.SplitN(entry, ":", 2)
+	if len(splitted) != 2 {
+		return "", nil, fmt.Errorf("host entry %s is not of the form name:ip", entry)
+	}
+	name := splitted[0]
+	if !regexp.MustCompile(hostRegex).MatchString(name) {
+		return "", nil, fmt.Errorf("%s is not a valid hostname", name)
+	}
+	ip := net.ParseIP(splitted[1])
+	if ip == nil {
+		return "", nil, fmt.Errorf("%s is not a valid IP address", splitted[1])
+	}
+	return name, ip, nil
+}
+
+// Hosts appends the host entries with the form name:ip to the hosts file
+// content and returns it
+func Hosts(content []byte, entries []string) ([]byte, error) {
+	sylog.Verbosef("Adding host entries to hosts content\n")
+
+	newContent := append([]byte{}, content...)
+	if len(newContent) > 0 && newContent[len(newContent)-1] != '\n' {
+		newContent = append(newContent, '\n')
+	}
+	for _, entry := range entries {
+		name, ip, err := ParseHost(entry)
+		if err != nil {
+			return nil, err
+		}
+		newContent = append(newContent, fmt.Sprintf("%s\t%s\n", ip, name)...)
+	}
+	return newContent, nil
+}
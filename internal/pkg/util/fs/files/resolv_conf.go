@@ -8,6 +8,7 @@ package files
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 )
@@ -27,3 +28,54 @@ func ResolvConf(dns []string) (content []byte, err error) {
 	}
 	return content, nil
 }
+
+// ResolvConfNameservers replaces the name servers of the resolv.conf
+// content by the provided dns list and returns it, other options are kept
+func ResolvConfNameservers(content []byte, dns []string) ([]byte, error) {
+	sylog.Verbosef("Setting resolv.conf name servers\n")
+	newContent, err := ResolvConf(dns)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "nameserver" {
+			continue
+		}
+		newContent = append(newContent, line...)
+	}
+	if newContent[len(newContent)-1] != '\n' {
+		newContent = append(newContent, '\n')
+	}
+	return newContent, nil
+}
+
+// ResolvConfSearch replaces the search domains of the resolv.conf content
+// by the provided domain list and returns it
+func ResolvConfSearch(content []byte, domains []string) ([]byte, error) {
+	sylog.Verbosef("Setting resolv.conf search domains\n")
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no search domain provided")
+	}
+	for _, domain := range domains {
+		if domain == "" || strings.ContainsAny(domain, " \t\n#;") {
+			return nil, fmt.Errorf("search domain %q is not a valid domain name", domain)
+		}
+	}
+
+	var newContent []byte
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		// the last search or domain keyword wins, drop them all
+		fields := strings.Fields(line)
+		if len(fields) > 0 && (fields[0] == "search" || fields[0] == "domain") {
+			continue
+		}
+		newContent = append(newContent, line...)
+	}
+	if len(newContent) > 0 && newContent[len(newContent)-1] != '\n' {
+		newContent = append(newContent, '\n')
+	}
+	newContent = append(newContent, fmt.Sprintf("search %s\n", strings.Join(domains, " "))...)
+
+	return newContent, nil
+}
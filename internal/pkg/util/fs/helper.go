@@ -12,9 +12,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
-
-	"golang.org/x/sys/unix"
 )
 
 // IsFile check if name component is regular file
@@ -44,51 +41,6 @@ func IsLink(name string) bool {
 	return (info.Mode()&os.ModeSymlink != 0)
 }
 
-// IsOwner check if name component is owned by user identified with uid
-func IsOwner(name string, uid uint32) bool {
-	info, err := os.Stat(name)
-	if err != nil {
-		return false
-	}
-	return (info.Sys().(*syscall.Stat_t).Uid == uid)
-}
-
-// IsExec check if name component has executable bit permission set
-func IsExec(name string) bool {
-	info, err := os.Stat(name)
-	if err != nil {
-		return false
-	}
-	return (info.Sys().(*syscall.Stat_t).Mode&syscall.S_IXUSR != 0)
-}
-
-// IsSuid check if name component has setuid bit permission set
-func IsSuid(name string) bool {
-	info, err := os.Stat(name)
-	if err != nil {
-		return false
-	}
-	return (info.Sys().(*syscall.Stat_t).Mode&syscall.S_ISUID != 0)
-}
-
-// MkdirAll creates a directory and parents if it doesn't exist with
-// mode after umask reset
-func MkdirAll(path string, mode os.FileMode) error {
-	oldmask := syscall.Umask(0)
-	defer syscall.Umask(oldmask)
-
-	return os.MkdirAll(path, mode)
-}
-
-// Mkdir creates a directory if it doesn't exist with
-// mode after umask reset
-func Mkdir(path string, mode os.FileMode) error {
-	oldmask := syscall.Umask(0)
-	defer syscall.Umask(oldmask)
-
-	return os.Mkdir(path, mode)
-}
-
 // RootDir returns the root directory of path (rootdir of /my/path is /my).
 // Returns "." if path is empty
 func RootDir(path string) string {
@@ -223,9 +175,3 @@ func CopyFile(from, to string, mode os.FileMode) (err error) {
 
 	return nil
 }
-
-// IsWritable returns true of the directory that is passed in is writable by the
-// the current user.
-func IsWritable(dir string) bool {
-	return unix.Access(dir, unix.W_OK) == nil
-}
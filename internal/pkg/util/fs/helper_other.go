@@ -0,0 +1,59 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package fs
+
+import (
+	"os"
+)
+
+// IsOwner always returns false as file ownership is
+// not supported on this platform
+func IsOwner(name string, uid uint32) bool {
+	return false
+}
+
+// IsExec check if name component has executable bit permission set
+func IsExec(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&0100 != 0
+}
+
+// IsSuid always returns false as setuid bit is
+// not supported on this platform
+func IsSuid(name string) bool {
+	return false
+}
+
+// Umask does nothing and returns 0 as there is no file
+// mode creation mask on this platform
+func Umask(mask int) int {
+	return 0
+}
+
+// MkdirAll creates a directory and parents if it doesn't exist with mode
+func MkdirAll(path string, mode os.FileMode) error {
+	return os.MkdirAll(path, mode)
+}
+
+// Mkdir creates a directory if it doesn't exist with mode
+func Mkdir(path string, mode os.FileMode) error {
+	return os.Mkdir(path, mode)
+}
+
+// IsWritable returns true of the directory that is passed in is writable by the
+// the current user.
+func IsWritable(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&0200 != 0
+}
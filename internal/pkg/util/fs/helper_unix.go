@@ -0,0 +1,72 @@
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fs
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IsOwner check if name component is owned by user identified with uid
+func IsOwner(name string, uid uint32) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return (info.Sys().(*syscall.Stat_t).Uid == uid)
+}
+
+// IsExec check if name component has executable bit permission set
+func IsExec(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return (info.Sys().(*syscall.Stat_t).Mode&syscall.S_IXUSR != 0)
+}
+
+// IsSuid check if name component has setuid bit permission set
+func IsSuid(name string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	return (info.Sys().(*syscall.Stat_t).Mode&syscall.S_ISUID != 0)
+}
+
+// Umask sets the process file mode creation mask and returns
+// the previous mask
+func Umask(mask int) int {
+	return syscall.Umask(mask)
+}
+
+// MkdirAll creates a directory and parents if it doesn't exist with
+// mode after umask reset
+func MkdirAll(path string, mode os.FileMode) error {
+	oldmask := syscall.Umask(0)
+	defer syscall.Umask(oldmask)
+
+	return os.MkdirAll(path, mode)
+}
+
+// Mkdir creates a directory if it doesn't exist with
+// mode after umask reset
+func Mkdir(path string, mode os.FileMode) error {
+	oldmask := syscall.Umask(0)
+	defer syscall.Umask(oldmask)
+
+	return os.Mkdir(path, mode)
+}
+
+// IsWritable returns true of the directory that is passed in is writable by the
+// the current user.
+func IsWritable(dir string) bool {
+	return unix.Access(dir, unix.W_OK) == nil
+}
@@ -13,6 +13,7 @@ import (
 	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 const (
@@ -20,6 +21,9 @@ const (
 	fileMode             = 0644
 )
 
+// blockSize is the space accounted for each layout entry
+const blockSize = 4096
+
 type file struct {
 	created bool
 	mode    os.FileMode
@@ -217,6 +221,22 @@ func (m *Manager) Chown(path string, uid, gid int) error {
 	return nil
 }
 
+// Usage returns an estimation of the space in bytes used by the
+// filesystem layout once created, each directory, file and symlink
+// accounts for at least one block.
+func (m *Manager) Usage() uint64 {
+	var usage uint64
+
+	for _, e := range m.entries {
+		size := uint64(blockSize)
+		if f, ok := e.(*file); ok && len(f.content) > blockSize {
+			size = (uint64(len(f.content)) + blockSize - 1) / blockSize * blockSize
+		}
+		usage += size
+	}
+	return usage
+}
+
 // Create creates the filesystem layout
 func (m *Manager) Create() error {
 	return m.sync()
@@ -259,11 +279,11 @@ func (m *Manager) sync() error {
 		}
 		if d.mode != m.DirMode {
 			if err := os.Mkdir(path, d.mode); err != nil {
-				return fmt.Errorf("failed to create %s directory: %s", path, err)
+				return layoutError(err, "failed to create %s directory", path)
 			}
 		} else {
 			if err := os.Mkdir(path, m.DirMode); err != nil {
-				return fmt.Errorf("failed to create %s directory: %s", path, err)
+				return layoutError(err, "failed to create %s directory", path)
 			}
 		}
 		if d.uid != uid || d.gid != gid {
@@ -286,12 +306,13 @@ func (m *Manager) sync() error {
 			}
 			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, entry.mode)
 			if err != nil {
-				return fmt.Errorf("failed to create file %s: %s", path, err)
+				return layoutError(err, "failed to create file %s", path)
 			}
 			l := len(entry.content)
 			if l > 0 {
 				if n, err := f.Write(entry.content); err != nil || n != l {
-					return fmt.Errorf("failed to write file %s content: %s", path, err)
+					f.Close()
+					return layoutError(err, "failed to write file %s content", path)
 				}
 			}
 			if err := f.Close(); err != nil {
@@ -308,7 +329,7 @@ func (m *Manager) sync() error {
 				continue
 			}
 			if err := os.Symlink(entry.target, path); err != nil {
-				return fmt.Errorf("failed to create symlink %s: %s", path, err)
+				return layoutError(err, "failed to create symlink %s", path)
 			}
 			if entry.uid != uid || entry.gid != gid {
 				if err := os.Lchown(path, entry.uid, entry.gid); err != nil {
@@ -320,3 +341,22 @@ func (m *Manager) sync() error {
 	}
 	return nil
 }
+
+// layoutError returns an error for a failed layout operation, an error
+// carrying the NoSpace error code is returned when the layout filesystem
+// is full to point out the session directory size.
+func layoutError(err error, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+
+	errno := err
+	switch e := err.(type) {
+	case *os.PathError:
+		errno = e.Err
+	case *os.LinkError:
+		errno = e.Err
+	}
+	if errno == syscall.ENOSPC {
+		return errcode.New(errcode.NoSpace, "%s: no space left in session directory, consider increasing 'sessiondir max size' in singularity.conf", msg)
+	}
+	return fmt.Errorf("%s: %s", msg, err)
+}
@@ -147,3 +147,32 @@ func TestLayout(t *testing.T) {
 		}
 	}
 }
+
+func TestUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	session := &Manager{}
+	if err := session.SetRootPath(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// root directory
+	if usage := session.Usage(); usage != blockSize {
+		t.Errorf("unexpected usage %d for root directory", usage)
+	}
+
+	// /etc directory, symlink and a file spanning on three blocks
+	if err := session.AddFile("/etc/passwd", make([]byte, 2*blockSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.AddSymlink("/etc/symlink", "/etc/passwd"); err != nil {
+		t.Fatal(err)
+	}
+	if usage := session.Usage(); usage != 6*blockSize {
+		t.Errorf("unexpected usage %d, expected %d", usage, 6*blockSize)
+	}
+}
@@ -20,21 +20,37 @@ const finalDir = "/final"
 // Session directory layout manager
 type Session struct {
 	*Manager
-	Layer layer
+	Layer  Layer
+	path   string
+	source string
+	fstype string
+	size   int
 }
 
 // Layer describes a layer interface added on top of session layout
-type layer interface {
+type Layer interface {
 	Add(*Session, *mount.System) error
 	Dir() string
 }
 
 // NewSession creates and returns a session directory layout manager
-func NewSession(path string, fstype string, size int, system *mount.System, layer layer) (*Session, error) {
+// backed by a memory filesystem of type fstype, size is the maximum
+// filesystem size in megabytes or unlimited if zero.
+func NewSession(path string, fstype string, size int, system *mount.System, layer Layer) (*Session, error) {
+	return newSession(&Session{path: path, fstype: fstype, size: size}, system, layer)
+}
+
+// NewDiskSession creates and returns a session directory layout manager
+// backed by the disk directory source.
+func NewDiskSession(path string, source string, system *mount.System, layer Layer) (*Session, error) {
+	return newSession(&Session{path: path, source: source}, system, layer)
+}
+
+func newSession(session *Session, system *mount.System, layer Layer) (*Session, error) {
 	manager := &Manager{}
-	session := &Session{Manager: manager}
+	session.Manager = manager
 
-	if err := manager.SetRootPath(path); err != nil {
+	if err := manager.SetRootPath(session.path); err != nil {
 		return nil, err
 	}
 	if err := manager.AddDir(rootFsDir); err != nil {
@@ -43,12 +59,7 @@ func NewSession(path string, fstype string, size int, system *mount.System, laye
 	if err := manager.AddDir(finalDir); err != nil {
 		return nil, err
 	}
-	options := "mode=1777"
-	if size > 0 {
-		options = fmt.Sprintf("mode=1777,size=%dm", size)
-	}
-	err := system.Points.AddFS(mount.SessionTag, path, fstype, syscall.MS_NOSUID, options)
-	if err != nil {
+	if err := session.addMount(system); err != nil {
 		return nil, err
 	}
 	if err := system.RunAfterTag(mount.SessionTag, session.createLayout); err != nil {
@@ -63,6 +74,39 @@ func NewSession(path string, fstype string, size int, system *mount.System, laye
 	return session, nil
 }
 
+func (s *Session) addMount(system *mount.System) error {
+	if s.source != "" {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV)
+		if err := system.Points.AddBind(mount.SessionTag, s.source, s.path, flags); err != nil {
+			return err
+		}
+		return system.Points.AddRemount(mount.SessionTag, s.path, flags)
+	}
+	options := "mode=1777"
+	if s.size > 0 {
+		options = fmt.Sprintf("mode=1777,size=%dm", s.size)
+	}
+	return system.Points.AddFS(mount.SessionTag, s.path, s.fstype, syscall.MS_NOSUID, options)
+}
+
+// Size returns the maximum size in megabytes of the session memory
+// filesystem, zero means unlimited or a disk backed session.
+func (s *Session) Size() int {
+	return s.size
+}
+
+// Resize sets the maximum size in megabytes of the session memory
+// filesystem, it has no effect for disk backed sessions and must be
+// called before the session directory is mounted.
+func (s *Session) Resize(system *mount.System, size int) error {
+	if s.source != "" || s.size == size {
+		return nil
+	}
+	s.size = size
+	system.Points.RemoveByTag(mount.SessionTag)
+	return s.addMount(system)
+}
+
 // Path returns the full path of session directory
 func (s *Session) Path() string {
 	path, _ := s.GetPath("/")
@@ -143,7 +143,9 @@ var authorizedTags = map[AuthorizedTag]struct {
 
 var authorizedImage = map[string]fsContext{
 	"encryptfs": {true},
+	"erofs":     {true},
 	"ext3":      {true},
+	"luks":      {true},
 	"squashfs":  {true},
 }
 
@@ -7,6 +7,8 @@ package mount
 
 import (
 	"fmt"
+
+	"github.com/sylabs/singularity/pkg/util/errcode"
 )
 
 // hookFn describes function prototype for function
@@ -70,7 +72,7 @@ func (b *System) MountAll() error {
 		for _, point := range b.Points.GetByTag(tag) {
 			if b.Mount != nil {
 				if err := b.Mount(&point); err != nil {
-					return fmt.Errorf("mount %s->%s error: %s", point.Source, point.Destination, err)
+					return errcode.Wrap(errcode.Unknown, err, "mount %s->%s error", point.Source, point.Destination)
 				}
 			}
 		}
@@ -9,21 +9,32 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/image/packer"
 	singularityconfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
 
-// GetPath figures out where the mksquashfs binary is
-// and return an error is not available or not usable.
-func GetPath() (string, error) {
-	// Parse singularity configuration file
+// getConfig parses the singularity configuration file.
+func getConfig() (*singularityconfig.FileConfig, error) {
 	c := &singularityconfig.FileConfig{}
 	configFile := buildcfg.SINGULARITY_CONF_FILE
 	if err := config.Parser(configFile, c); err != nil {
-		return "", fmt.Errorf("unable to parse singularity.conf file: %s", err)
+		return nil, fmt.Errorf("unable to parse singularity.conf file: %s", err)
+	}
+	return c, nil
+}
+
+// GetPath figures out where the mksquashfs binary is
+// and return an error is not available or not usable.
+func GetPath() (string, error) {
+	c, err := getConfig()
+	if err != nil {
+		return "", err
 	}
 
 	// p is either "" or the string value in the conf file
@@ -37,3 +48,93 @@ func GetPath() (string, error) {
 	// exec.LookPath functions on absolute paths (ignoring $PATH) as well
 	return exec.LookPath(p)
 }
+
+// GetOptions returns the mksquashfs options selecting the compression
+// algorithm, the block size and the number of processors configured in
+// singularity.conf. Options also found in the user supplied arguments
+// userArgs are left to them, userArgs are appended last.
+func GetOptions(mksquashfsPath string, userArgs []string) ([]string, error) {
+	c, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	return options(c, mksquashfsPath, userArgs)
+}
+
+// checkBlockSize checks that the block size size, in bytes or with a K
+// or M suffix, is a power of two between 4K and 1M like mksquashfs expects.
+func checkBlockSize(size string) error {
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(size, "K"):
+		shift = 10
+	case strings.HasSuffix(size, "M"):
+		shift = 20
+	}
+	if shift > 0 {
+		size = size[:len(size)-1]
+	}
+
+	n, err := strconv.ParseUint(size, 10, 32)
+	if err != nil {
+		return fmt.Errorf("not a number of bytes")
+	}
+	n <<= shift
+	if n < 4<<10 || n > 1<<20 || n&(n-1) != 0 {
+		return fmt.Errorf("must be a power of two between 4K and 1M")
+	}
+	return nil
+}
+
+func options(c *singularityconfig.FileConfig, mksquashfsPath string, userArgs []string) ([]string, error) {
+	user := make(map[string]bool)
+	for _, a := range userArgs {
+		user[a] = true
+	}
+
+	s := packer.NewSquashfs()
+	s.MksquashfsPath = mksquashfsPath
+
+	features, err := s.Features()
+	if err != nil {
+		return nil, fmt.Errorf("while detecting mksquashfs features: %s", err)
+	}
+
+	opts := make([]string, 0)
+
+	if !user["-comp"] {
+		if len(features.Compressors) == 0 {
+			// mksquashfs releases without -comp only support gzip
+			if c.MksquashfsComp != "gzip" {
+				return nil, fmt.Errorf("%s doesn't support %s compression", mksquashfsPath, c.MksquashfsComp)
+			}
+		} else if !features.HasCompressor(c.MksquashfsComp) {
+			return nil, fmt.Errorf("%s doesn't support %s compression, available compressors: %s",
+				mksquashfsPath, c.MksquashfsComp, strings.Join(features.Compressors, ", "))
+		} else {
+			// always explicit as the default compressor can be changed
+			// when mksquashfs is compiled
+			opts = append(opts, "-comp", c.MksquashfsComp)
+		}
+		if c.MksquashfsComp != "gzip" {
+			sylog.Infof("Compressing image with %s, it requires %s support in the kernel or squashfuse of hosts running it", c.MksquashfsComp, c.MksquashfsComp)
+		}
+	}
+
+	if c.MksquashfsBlockSize != "" && !user["-b"] {
+		if err := checkBlockSize(c.MksquashfsBlockSize); err != nil {
+			return nil, fmt.Errorf("bad 'mksquashfs block size' %q: %s", c.MksquashfsBlockSize, err)
+		}
+		opts = append(opts, "-b", c.MksquashfsBlockSize)
+	}
+
+	if c.MksquashfsProcs > 0 && !user["-processors"] {
+		if features.Processors {
+			opts = append(opts, "-processors", strconv.FormatUint(uint64(c.MksquashfsProcs), 10))
+		} else {
+			sylog.Warningf("%s doesn't support -processors, ignoring 'mksquashfs procs'", mksquashfsPath)
+		}
+	}
+
+	return append(opts, userArgs...), nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	singularityconfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+const helpScript = `#!/bin/sh
+cat >&2 <<HELP
+SYNTAX:mksquashfs source1 source2 ...  dest [options]
+-processors <number>	Use <number> processors.
+
+Compressors available and compressor specific options:
+	gzip (default)
+	  -Xcompression-level <compression-level>
+	xz
+	zstd
+HELP
+exit 1
+`
+
+const oldHelpScript = `#!/bin/sh
+echo "SYNTAX:mksquashfs source1 source2 ...  dest [options]" >&2
+exit 1
+`
+
+func TestOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mksquashfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mksquashfs := filepath.Join(dir, "mksquashfs")
+	if err := ioutil.WriteFile(mksquashfs, []byte(helpScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldMksquashfs := filepath.Join(dir, "old-mksquashfs")
+	if err := ioutil.WriteFile(oldMksquashfs, []byte(oldHelpScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		config      singularityconfig.FileConfig
+		userArgs    []string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "default",
+			path:     mksquashfs,
+			config:   singularityconfig.FileConfig{MksquashfsComp: "gzip"},
+			expected: []string{"-comp", "gzip"},
+		},
+		{
+			name: "configured",
+			path: mksquashfs,
+			config: singularityconfig.FileConfig{
+				MksquashfsComp:      "zstd",
+				MksquashfsBlockSize: "1M",
+				MksquashfsProcs:     4,
+			},
+			expected: []string{"-comp", "zstd", "-b", "1M", "-processors", "4"},
+		},
+		{
+			name: "user arguments",
+			path: mksquashfs,
+			config: singularityconfig.FileConfig{
+				MksquashfsComp:      "zstd",
+				MksquashfsBlockSize: "1M",
+			},
+			userArgs: []string{"-comp", "xz", "-Xbcj", "x86"},
+			expected: []string{"-b", "1M", "-comp", "xz", "-Xbcj", "x86"},
+		},
+		{
+			name: "bad block size",
+			path: mksquashfs,
+			config: singularityconfig.FileConfig{
+				MksquashfsComp:      "gzip",
+				MksquashfsBlockSize: "3M",
+			},
+			expectError: true,
+		},
+		{
+			name:        "unsupported compressor",
+			path:        mksquashfs,
+			config:      singularityconfig.FileConfig{MksquashfsComp: "lz4"},
+			expectError: true,
+		},
+		{
+			name:     "old mksquashfs",
+			path:     oldMksquashfs,
+			config:   singularityconfig.FileConfig{MksquashfsComp: "gzip", MksquashfsProcs: 2},
+			expected: []string{},
+		},
+		{
+			name:        "old mksquashfs without gzip",
+			path:        oldMksquashfs,
+			config:      singularityconfig.FileConfig{MksquashfsComp: "xz"},
+			expectError: true,
+		},
+		{
+			name:        "no mksquashfs",
+			path:        filepath.Join(dir, "no-mksquashfs"),
+			config:      singularityconfig.FileConfig{MksquashfsComp: "gzip"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := options(&tt.config, tt.path, tt.userArgs)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(opts, tt.expected) {
+				t.Errorf("got options %v, expected %v", opts, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckBlockSize(t *testing.T) {
+	tests := []struct {
+		size  string
+		valid bool
+	}{
+		{"4096", true},
+		{"128K", true},
+		{"1M", true},
+		{"2048", false},
+		{"2M", false},
+		{"100K", false},
+		{"0", false},
+		{"1G", false},
+		{"K", false},
+		{"-4K", false},
+	}
+
+	for _, tt := range tests {
+		err := checkBlockSize(tt.size)
+		if tt.valid && err != nil {
+			t.Errorf("unexpected error for %s: %s", tt.size, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("unexpected success for %s", tt.size)
+		}
+	}
+}
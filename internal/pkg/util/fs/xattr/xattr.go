@@ -0,0 +1,105 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package xattr preserves the extended attributes of root filesystems,
+// like file capabilities and SELinux contexts, when they are copied,
+// extracted or converted, and reports those which had to be dropped.
+package xattr
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	// Capability is the extended attribute storing file capabilities.
+	Capability = "security.capability"
+	// SELinux is the extended attribute storing SELinux contexts.
+	SELinux = "security.selinux"
+)
+
+// Dropped records the extended attributes which couldn't be preserved,
+// it maps attribute names to the paths of the files they were dropped from.
+type Dropped map[string][]string
+
+// Add records that the attribute name was dropped from path, an empty
+// path means that the file is unknown.
+func (d Dropped) Add(name, path string) {
+	d[name] = append(d[name], path)
+}
+
+// Merge adds the attributes dropped recorded by o.
+func (d Dropped) Merge(o Dropped) {
+	for name, paths := range o {
+		d[name] = append(d[name], paths...)
+	}
+}
+
+// Warn prints a warning for each dropped attribute along with its
+// consequences for the container.
+func (d Dropped) Warn() {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		paths := d[name]
+		if paths[0] == "" {
+			// mksquashfs doesn't report file paths
+			sylog.Warningf("Extended attribute %s dropped", name)
+		} else {
+			example := paths[0]
+			if len(paths) > 1 {
+				example += ", ..."
+			}
+			sylog.Warningf("Extended attribute %s dropped from %d file(s) (%s)", name, len(paths), example)
+		}
+
+		switch name {
+		case Capability:
+			sylog.Warningf("Binaries relying on file capabilities won't work as expected, run the operation as root to preserve them")
+		case SELinux:
+			sylog.Warningf("Files will get the default SELinux context of their location")
+		}
+	}
+}
+
+var (
+	// unsquashfs fails to set an attribute or refuses to set
+	// non-user attributes when not run as root
+	unsquashfsRegexp = regexp.MustCompile(`^write_xattr: (?:failed to|could not) write xattr (\S+) for file (.+) because`)
+	// mksquashfs ignores the attributes it can't store
+	mksquashfsRegexp = regexp.MustCompile(`^Unrecognised xattr prefix (\S+)`)
+)
+
+// ParseSquashfsOutput returns the extended attributes reported as dropped
+// in the output of unsquashfs or mksquashfs, paths are made relative to
+// the root directory.
+func ParseSquashfsOutput(output []byte, root string) Dropped {
+	d := make(Dropped)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := unsquashfsRegexp.FindStringSubmatch(line); m != nil {
+			path := m[2]
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = filepath.Join("/", rel)
+			}
+			d.Add(m[1], path)
+		} else if m := mksquashfsRegexp.FindStringSubmatch(line); m != nil {
+			d.Add(m[1], "")
+		}
+	}
+	return d
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package xattr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// List returns the names of the extended attributes of path, symbolic
+// links are not followed.
+func List(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// Get returns the value of the extended attribute name of path, symbolic
+// links are not followed.
+func Get(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+// CopyTree copies the extended attributes of the files found in the
+// src directory to the files at the same location in the dst directory.
+// Attributes the current user is not permitted to set or not supported
+// by the dst filesystem are returned as dropped.
+func CopyTree(src, dst string) (Dropped, error) {
+	d := make(Dropped)
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			return nil
+		}
+
+		names, err := List(path)
+		if err == unix.ENOTSUP {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("while listing extended attributes of %s: %s", path, err)
+		}
+
+		for _, name := range names {
+			value, err := Get(path, name)
+			if err != nil {
+				return fmt.Errorf("while reading extended attribute %s of %s: %s", name, path, err)
+			}
+			if current, err := Get(target, name); err == nil && bytes.Equal(current, value) {
+				continue
+			}
+			switch err := unix.Lsetxattr(target, name, value, 0); err {
+			case nil:
+			case unix.EPERM, unix.EACCES, unix.ENOTSUP, unix.EINVAL:
+				d.Add(name, filepath.Join("/", rel))
+			default:
+				return fmt.Errorf("while setting extended attribute %s of %s: %s", name, target, err)
+			}
+		}
+		return nil
+	})
+
+	return d, err
+}
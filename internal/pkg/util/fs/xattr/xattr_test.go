@@ -0,0 +1,99 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package xattr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseSquashfsOutput(t *testing.T) {
+	output := []byte(`Parallel unsquashfs: Using 4 processors
+write_xattr: could not write xattr security.capability for file /tmp/rootfs/usr/bin/ping because you're not superuser!
+write_xattr: failed to write xattr security.selinux for file /tmp/rootfs/etc/passwd because Operation not supported
+write_xattr: could not write xattr security.capability for file /tmp/rootfs/usr/bin/arping because you're not superuser!
+Unrecognised xattr prefix trusted.overlay.opaque
+created 42 files
+`)
+
+	expected := Dropped{
+		Capability:               {"/usr/bin/ping", "/usr/bin/arping"},
+		SELinux:                  {"/etc/passwd"},
+		"trusted.overlay.opaque": {""},
+	}
+
+	if d := ParseSquashfsOutput(output, "/tmp/rootfs"); !reflect.DeepEqual(d, expected) {
+		t.Errorf("unexpected dropped attributes: got %v, expected %v", d, expected)
+	}
+	if d := ParseSquashfsOutput([]byte("created 42 files\n"), "/tmp/rootfs"); len(d) != 0 {
+		t.Errorf("unexpected dropped attributes: %v", d)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	src, err := ioutil.TempDir("", "xattr-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "xattr-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	for _, dir := range []string{src, dst} {
+		if err := os.Mkdir(filepath.Join(dir, "bin"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "bin", "tool"), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only present in the source directory
+	if err := ioutil.WriteFile(filepath.Join(src, "extra"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unix.Lsetxattr(filepath.Join(src, "bin", "tool"), "user.test", []byte("value"), 0); err == unix.ENOTSUP {
+		t.Skip("user extended attributes not supported by the temporary directory filesystem")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Lsetxattr(filepath.Join(src, "extra"), "user.test", []byte("extra"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := CopyTree(src, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(d) != 0 {
+		t.Errorf("unexpected dropped attributes: %v", d)
+	}
+
+	value, err := Get(filepath.Join(dst, "bin", "tool"), "user.test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(value) != "value" {
+		t.Errorf("unexpected attribute value: got %q, expected %q", value, "value")
+	}
+
+	names, err := List(filepath.Join(dst, "bin", "tool"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(names, []string{"user.test"}) {
+		t.Errorf("unexpected attributes: %v", names)
+	}
+}
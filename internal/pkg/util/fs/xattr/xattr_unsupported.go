@@ -0,0 +1,13 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package xattr
+
+// CopyTree doesn't copy anything on unsupported platforms.
+func CopyTree(src, dst string) (Dropped, error) {
+	return make(Dropped), nil
+}
@@ -0,0 +1,21 @@
+# This file contains rules for building the Slurm SPANK plugin executing
+#   job step tasks within a Singularity container
+
+spank_plugin_SOURCE := $(SOURCEDIR)/cmd/slurm/singularity.c
+spank_plugin := $(BUILDDIR)/cmd/slurm/singularity.so
+spank_plugin_INSTALL := $(DESTDIR)$(LIBDIR)/slurm/singularity.so
+
+$(spank_plugin): $(spank_plugin_SOURCE)
+	@echo " CC SPANK PLUGIN" $@
+	$(V)install -d $(@D)
+	$(V)$(CC) -Wall -O2 -fPIC -shared -DSINGULARITY_BIN=\"$(BINDIR)/singularity\" \
+		$(LDFLAGS) -o $@ $(spank_plugin_SOURCE)
+
+$(spank_plugin_INSTALL): $(spank_plugin)
+	@echo " INSTALL SPANK PLUGIN" $@
+	$(V)install -d $(@D)
+	$(V)install -m 0755 $(spank_plugin) $@
+
+CLEANFILES += $(spank_plugin)
+INSTALLFILES += $(spank_plugin_INSTALL)
+ALL += $(spank_plugin)
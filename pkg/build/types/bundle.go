@@ -47,6 +47,9 @@ type Options struct {
 	Sections []string `json:"sections"`
 	// TmpDir specifies a non-standard temporary location to perform a build
 	TmpDir string
+	// ContextDir is the directory of an extracted build context where
+	// %files sources are read instead of the host filesystem
+	ContextDir string `json:"contextDir"`
 	// LibraryURL contains URL to library where base images can be pulled
 	LibraryURL string `json:"libraryURL"`
 	// LibraryAuthToken contains authentication token to access specified library
@@ -57,8 +60,20 @@ type Options struct {
 	// encryption if applicable
 	// A nil value indicated encryption should not occur
 	EncryptionKeyInfo *crypt.KeyInfo
+	// Verity adds a dm-verity hash tree of the root filesystem to
+	// SIF images
+	Verity bool `json:"verity"`
+	// MksquashfsArgs are additional mksquashfs options used to
+	// create the root filesystem of SIF images
+	MksquashfsArgs []string `json:"mksquashfsArgs,omitempty"`
 	// noTest indicates if build should skip running the test script
 	NoTest bool `json:"noTest"`
+	// TestIsolated runs the test script in new PID, network and IPC
+	// namespaces
+	TestIsolated bool `json:"testIsolated,omitempty"`
+	// TestTimeout is the time in seconds after which the test script
+	// is killed, zero means no timeout
+	TestTimeout int `json:"testTimeout,omitempty"`
 	// force automatically deletes an existing container at build destination while performing build
 	Force bool `json:"force"`
 	// update detects and builds using an existing sandbox container at build destination
@@ -70,6 +85,9 @@ type Options struct {
 	NoCleanUp bool `json:"noCleanUp"`
 	// NoCache when true, will not use any cache, or make cache.
 	NoCache bool
+	// NoBuildCache when true, runs every build stage instead of reusing
+	// the stages found in the build cache.
+	NoBuildCache bool `json:"noBuildCache"`
 	// ImgCache stores a pointer to the image cache to use
 	ImgCache *cache.Handle
 }
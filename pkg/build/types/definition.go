@@ -33,10 +33,12 @@ type ImageData struct {
 // ImageScripts contains scripts that are used after build time.
 type ImageScripts struct {
 	Help        Script `json:"help"`
+	Arguments   Script `json:"arguments"`
 	Environment Script `json:"environment"`
 	Runscript   Script `json:"runScript"`
 	Test        Script `json:"test"`
 	Startscript Script `json:"startScript"`
+	Healthcheck Script `json:"healthCheck"`
 }
 
 // Data contains any scripts, metadata, etc... that the Builder may
@@ -188,10 +190,12 @@ func populateRaw(d *Definition, w io.Writer) {
 	writeFilesIfExists(w, d.BuildData.Files)
 
 	writeSectionIfExists(w, "help", d.ImageData.Help)
+	writeSectionIfExists(w, "arguments", d.ImageData.Arguments)
 	writeSectionIfExists(w, "environment", d.ImageData.Environment)
 	writeSectionIfExists(w, "runscript", d.ImageData.Runscript)
 	writeSectionIfExists(w, "test", d.ImageData.Test)
 	writeSectionIfExists(w, "startscript", d.ImageData.Startscript)
+	writeSectionIfExists(w, "healthcheck", d.ImageData.Healthcheck)
 	writeSectionIfExists(w, "pre", d.BuildData.Pre)
 	writeSectionIfExists(w, "setup", d.BuildData.Setup)
 	writeSectionIfExists(w, "post", d.BuildData.Post)
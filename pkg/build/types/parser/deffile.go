@@ -283,10 +283,12 @@ func populateDefinition(sections map[string]*types.Script, files *[]types.Files,
 	d.ImageData = types.ImageData{
 		ImageScripts: types.ImageScripts{
 			Help:        *sections["help"],
+			Arguments:   *sections["arguments"],
 			Environment: *sections["environment"],
 			Runscript:   *sections["runscript"],
 			Test:        *sections["test"],
 			Startscript: *sections["startscript"],
+			Healthcheck: *sections["healthcheck"],
 		},
 		Labels: labels,
 	}
@@ -516,6 +518,7 @@ func isEmpty(d types.Definition) bool {
 // could contain. If any others are found, an error will generate
 var validSections = map[string]bool{
 	"help":        true,
+	"arguments":   true,
 	"setup":       true,
 	"files":       true,
 	"labels":      true,
@@ -525,16 +528,18 @@ var validSections = map[string]bool{
 	"runscript":   true,
 	"test":        true,
 	"startscript": true,
+	"healthcheck": true,
 }
 
 var appSections = map[string]bool{
-	"appinstall": true,
-	"applabels":  true,
-	"appfiles":   true,
-	"appenv":     true,
-	"apptest":    true,
-	"apphelp":    true,
-	"apprun":     true,
+	"appinstall":   true,
+	"applabels":    true,
+	"appfiles":     true,
+	"appenv":       true,
+	"apptest":      true,
+	"apphelp":      true,
+	"apparguments": true,
+	"apprun":       true,
 }
 
 // validHeaders just contains a list of all the valid headers a definition file
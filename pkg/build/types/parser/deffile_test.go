@@ -184,6 +184,8 @@ func TestParseDefinitionFile(t *testing.T) {
 		{"SectionArgs", "testdata_good/sectionargs/sectionargs", "testdata_good/sectionargs/sectionargs.json"},
 		{"MultipleFiless", "testdata_good/multiplefiles/multiplefiles", "testdata_good/multiplefiles/multiplefiles.json"},
 		{"Shebang", "testdata_good/shebang/shebang", "testdata_good/shebang/shebang.json"},
+		{"HelpArguments", "testdata_good/helpargs/helpargs", "testdata_good/helpargs/helpargs.json"},
+		{"Healthcheck", "testdata_good/healthcheck/healthcheck", "testdata_good/healthcheck/healthcheck.json"},
 	}
 
 	for _, tt := range tests {
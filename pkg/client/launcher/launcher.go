@@ -0,0 +1,121 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package launcher starts Singularity containers from Go programs. It builds
+// the runtime configuration the same way the singularity action commands do
+// and runs the starter of the Singularity installation, there is no need to
+// execute the singularity command and parse its output.
+//
+// A container running a command with its output sent to the calling process
+// standard output and error streams is started with:
+//
+//	result, err := launcher.Launch(ctx, "/images/alpine.sif", launcher.LaunchOptions{
+//		Action: launcher.Exec,
+//		Args:   []string{"cat", "/etc/os-release"},
+//		Stdout: os.Stdout,
+//		Stderr: os.Stderr,
+//	})
+package launcher
+
+import (
+	"io"
+	"syscall"
+	"time"
+)
+
+// Action is the container action executed by Launch.
+type Action string
+
+const (
+	// Run executes the container runscript with Args as arguments.
+	Run Action = "run"
+	// Exec executes the command Args in the container.
+	Exec Action = "exec"
+	// Shell executes an interactive shell in the container.
+	Shell Action = "shell"
+	// Test executes the container test script.
+	Test Action = "test"
+)
+
+// DefaultKillDelay is the time given to a container to terminate once its
+// context is done before being killed.
+const DefaultKillDelay = 5 * time.Second
+
+// Namespaces selects the namespaces created for a container.
+type Namespaces struct {
+	User bool
+	PID  bool
+	IPC  bool
+	Net  bool
+	UTS  bool
+}
+
+// LaunchOptions describes how a container is launched, the zero value runs
+// the container runscript with the same defaults as singularity run.
+type LaunchOptions struct {
+	// Action is the container action, Run if empty.
+	Action Action
+	// Args are the command and its arguments for Exec, the arguments
+	// for Run and Test.
+	Args []string
+	// AppName is the SCIF application to run.
+	AppName string
+
+	// Env are KEY=VALUE environment variables set in the container.
+	Env []string
+	// CleanEnv doesn't forward the calling process environment to the
+	// container.
+	CleanEnv bool
+
+	// Binds are bind path specifications, as with --bind.
+	Binds []string
+	// Overlays are overlay images, as with --overlay.
+	Overlays []string
+	// Home is the home directory specification, as with --home, the
+	// calling user home directory if empty.
+	Home string
+	// NoHome doesn't mount the home directory.
+	NoHome bool
+	// Cwd is the container process working directory, the calling
+	// process working directory if empty.
+	Cwd string
+	// Contain uses minimal /dev and empty directories for /tmp and
+	// /var/tmp.
+	Contain bool
+	// ContainAll also contains PID and IPC namespaces and cleans the
+	// environment.
+	ContainAll bool
+	// Writable mounts the image read-write.
+	Writable bool
+	// WritableTmpfs adds a writable tmpfs overlay on top of the image.
+	WritableTmpfs bool
+	// Hostname sets the container hostname, it implies a UTS namespace.
+	Hostname string
+
+	// Namespaces are the namespaces created for the container.
+	Namespaces Namespaces
+	// Network is the comma separated list of network types used with a
+	// network namespace, bridge if empty.
+	Network string
+
+	// Stdin, Stdout and Stderr are the container standard streams,
+	// the null device is used for nil streams.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// KillDelay is the time given to the container to terminate once
+	// the context is done before being killed, DefaultKillDelay if zero.
+	KillDelay time.Duration
+}
+
+// Result is the exit status of a container.
+type Result struct {
+	// ExitCode is the container process exit code, or 128 plus the
+	// signal number when it was killed by a signal.
+	ExitCode int
+	// Signal is the signal which killed the container process, if any.
+	Signal syscall.Signal
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engine/config"
+	"github.com/sylabs/singularity/internal/pkg/runtime/launch"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	starterexec "github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/errcode"
+	"github.com/sylabs/singularity/pkg/util/namespaces"
+)
+
+// host holds the identity of the calling user.
+type host struct {
+	uid          uint32
+	gid          uint32
+	home         string
+	cwd          string
+	environ      []string
+	insideUserNs bool
+}
+
+// Launch starts the container image and waits until its process exits,
+// image is either a SIF or ext3 image file or a sandbox directory. A non
+// zero exit code is not an error, it's reported in the returned result.
+//
+// When ctx is done before the container exits, the container is sent
+// SIGTERM and killed if it's still running after opts.KillDelay, the
+// returned error is then the context error along with the result.
+func Launch(ctx context.Context, image string, opts LaunchOptions) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fileConfig := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SINGULARITY_CONF_FILE, fileConfig); err != nil {
+		return nil, fmt.Errorf("unable to parse singularity.conf file: %s", err)
+	}
+
+	pwd, err := user.CurrentOriginal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user information: %s", err)
+	}
+	// force to use getwd syscall
+	cwd, err := syscall.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("can't determine current working directory: %s", err)
+	}
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+
+	h := &host{
+		uid:          uint32(os.Getuid()),
+		gid:          uint32(os.Getgid()),
+		home:         pwd.Dir,
+		cwd:          cwd,
+		environ:      os.Environ(),
+		insideUserNs: insideUserNs,
+	}
+
+	engineConfig, err := newEngineConfig(image, &opts, fileConfig, h)
+	if err != nil {
+		return nil, err
+	}
+
+	starter := starterPath(engineConfig, h)
+	if _, err := os.Stat(starter); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s not found, please check your installation", starter)
+	}
+
+	cfg := &config.Common{
+		EngineName:   singularityConfig.Name,
+		EngineConfig: engineConfig,
+	}
+	configData, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal engine configuration: %s", err)
+	}
+
+	starterEnv := []string{sylog.GetEnvVar(), errcode.GetEnvVar()}
+
+	cmd, err := starterexec.PipeCommand(starter, []string{"Singularity runtime parent"}, starterEnv, configData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare starter command: %s", err)
+	}
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+
+	killDelay := opts.KillDelay
+	if killDelay <= 0 {
+		killDelay = DefaultKillDelay
+	}
+	return wait(ctx, cmd, killDelay)
+}
+
+// newEngineConfig returns the singularity engine configuration to launch
+// image with opts, as the singularity action commands set it.
+func newEngineConfig(image string, opts *LaunchOptions, fileConfig *singularityConfig.FileConfig, h *host) (*singularityConfig.EngineConfig, error) {
+	action := opts.Action
+	if action == "" {
+		action = Run
+	}
+	switch action {
+	case Run, Exec, Shell, Test:
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+	if action == Exec && len(opts.Args) == 0 {
+		return nil, fmt.Errorf("no command to execute provided")
+	}
+	if strings.HasPrefix(image, "instance://") {
+		return nil, fmt.Errorf("joining instances is not supported")
+	}
+
+	args := []string{"/.singularity.d/actions/" + string(action)}
+	if action != Shell {
+		args = append(args, opts.Args...)
+	}
+	c := launch.NewConfig(fileConfig, args)
+	engineConfig := c.Engine
+
+	if err := c.SetImage(image); err != nil {
+		return nil, err
+	}
+
+	ns := launch.Namespaces(opts.Namespaces)
+	cleanEnv := opts.CleanEnv
+
+	if buildcfg.SINGULARITY_SUID_INSTALL == 1 && !fileConfig.AllowSetuid {
+		sylog.Verbosef("'allow setuid' set to 'no' by configuration, fallback to user namespace")
+		ns.User = true
+	}
+	if (ns.User || h.insideUserNs) && fs.IsFile(engineConfig.GetImage()) {
+		return nil, fmt.Errorf("%s must be a sandbox directory to run within a user namespace", image)
+	}
+
+	engineConfig.SetBindPath(opts.Binds)
+	engineConfig.SetOverlayImage(opts.Overlays)
+	engineConfig.SetWritableImage(opts.Writable)
+	engineConfig.SetNoHome(opts.NoHome)
+	if opts.Writable && opts.WritableTmpfs {
+		return nil, fmt.Errorf("writable and writable tmpfs are mutually exclusive")
+	}
+	engineConfig.SetWritableTmpfs(opts.WritableTmpfs)
+
+	if opts.Hostname != "" {
+		ns.UTS = true
+		engineConfig.SetHostname(opts.Hostname)
+	}
+
+	if opts.Contain || opts.ContainAll {
+		engineConfig.SetContain(true)
+
+		if opts.ContainAll {
+			ns.PID = true
+			ns.IPC = true
+			cleanEnv = true
+		}
+	}
+
+	home := opts.Home
+	engineConfig.SetCustomHome(home != "")
+	if home == "" {
+		home = h.home
+	}
+	if err := c.SetHome(home); err != nil {
+		return nil, err
+	}
+
+	if ns.Net {
+		network := opts.Network
+		if network == "" {
+			network = "bridge"
+		}
+		engineConfig.SetNetwork(network)
+	}
+	c.AddNamespaces(ns, h.uid, h.gid, true)
+
+	c.SetEnv(h.environ, cleanEnv)
+	for _, e := range opts.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("environment variable %q is not of the form KEY=VALUE", e)
+		}
+		c.Generator.AddProcessEnv(kv[0], kv[1])
+	}
+	c.Generator.AddProcessEnv("SINGULARITY_APPNAME", opts.AppName)
+
+	c.SetCwd(opts.Cwd, h.cwd)
+
+	return engineConfig, nil
+}
+
+// starterPath returns the starter binary launching the container described
+// by engineConfig, the setuid starter is used unless a user namespace is
+// requested.
+func starterPath(engineConfig *singularityConfig.EngineConfig, h *host) string {
+	userNs := false
+	if linux := engineConfig.OciConfig.Linux; linux != nil {
+		for _, ns := range linux.Namespaces {
+			userNs = userNs || ns.Type == "user"
+		}
+	}
+	if buildcfg.SINGULARITY_SUID_INSTALL == 1 && h.uid != 0 && !h.insideUserNs && !userNs {
+		return filepath.Join(buildcfg.LIBEXECDIR, "singularity/bin/starter-suid")
+	}
+	return filepath.Join(buildcfg.LIBEXECDIR, "singularity/bin/starter")
+}
+
+// wait runs cmd until it exits, the command is terminated once ctx is done.
+func wait(ctx context.Context, cmd *exec.Cmd, killDelay time.Duration) (*Result, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start container: %s", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	terminated := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		close(terminated)
+		// the starter forwards SIGTERM to the container process
+		cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-time.After(killDelay):
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return nil, fmt.Errorf("while waiting container: %s", err)
+	}
+
+	result := &Result{}
+
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		result.Signal = status.Signal()
+		result.ExitCode = 128 + int(status.Signal())
+	} else {
+		result.ExitCode = status.ExitStatus()
+	}
+
+	select {
+	case <-terminated:
+		return result, ctx.Err()
+	default:
+		return result, nil
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+func TestNewEngineConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "launcher-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &host{
+		uid:     1000,
+		gid:     1000,
+		home:    "/home/user",
+		cwd:     "/home/user/work",
+		environ: []string{"FOO=bar", "SINGULARITY_FOO=bar", "SINGULARITYENV_BAR=foo"},
+	}
+
+	tests := []struct {
+		name        string
+		image       string
+		opts        LaunchOptions
+		args        []string
+		cwd         string
+		homeDest    string
+		namespaces  []string
+		env         map[string]string
+		noEnv       []string
+		expectError bool
+	}{
+		{
+			name:       "default",
+			image:      dir,
+			args:       []string{"/.singularity.d/actions/run"},
+			cwd:        "/home/user/work",
+			homeDest:   "/home/user",
+			namespaces: []string{},
+			env:        map[string]string{"FOO": "bar", "BAR": "foo", "SINGULARITY_NAME": filepath.Base(dir)},
+			noEnv:      []string{"SINGULARITY_FOO"},
+		},
+		{
+			name:  "exec",
+			image: dir,
+			opts: LaunchOptions{
+				Action: Exec,
+				Args:   []string{"echo", "hello"},
+				Env:    []string{"HELLO=world"},
+				Home:   "/tmp:/home/test",
+				Cwd:    "/opt",
+			},
+			args:       []string{"/.singularity.d/actions/exec", "echo", "hello"},
+			cwd:        "/opt",
+			homeDest:   "/home/test",
+			namespaces: []string{},
+			env:        map[string]string{"HELLO": "world", "HOME": "/home/test"},
+		},
+		{
+			name:  "contain all",
+			image: dir,
+			opts: LaunchOptions{
+				ContainAll: true,
+				Hostname:   "container",
+				Namespaces: Namespaces{Net: true},
+			},
+			args:       []string{"/.singularity.d/actions/run"},
+			cwd:        "/home/user",
+			homeDest:   "/home/user",
+			namespaces: []string{"network", "uts", "pid", "ipc"},
+			env:        map[string]string{"BAR": "foo"},
+			noEnv:      []string{"FOO"},
+		},
+		{
+			name:  "user namespace",
+			image: dir,
+			opts: LaunchOptions{
+				Action:     Shell,
+				Args:       []string{"ignored"},
+				Namespaces: Namespaces{User: true},
+			},
+			args:       []string{"/.singularity.d/actions/shell"},
+			cwd:        "/home/user/work",
+			homeDest:   "/home/user",
+			namespaces: []string{"user"},
+		},
+		{
+			name:        "user namespace with image file",
+			image:       image,
+			opts:        LaunchOptions{Namespaces: Namespaces{User: true}},
+			expectError: true,
+		},
+		{
+			name:        "exec without command",
+			image:       dir,
+			opts:        LaunchOptions{Action: Exec},
+			expectError: true,
+		},
+		{
+			name:        "unknown action",
+			image:       dir,
+			opts:        LaunchOptions{Action: "start"},
+			expectError: true,
+		},
+		{
+			name:        "instance",
+			image:       "instance://test",
+			expectError: true,
+		},
+		{
+			name:        "bad environment",
+			image:       dir,
+			opts:        LaunchOptions{Env: []string{"FOO"}},
+			expectError: true,
+		},
+		{
+			name:        "bad home",
+			image:       dir,
+			opts:        LaunchOptions{Home: "/a:/b:/c"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileConfig := &singularityConfig.FileConfig{AllowSetuid: true}
+
+			engineConfig, err := newEngineConfig(tt.image, &tt.opts, fileConfig, h)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			spec := engineConfig.OciConfig.Spec
+			if !reflect.DeepEqual(spec.Process.Args, tt.args) {
+				t.Errorf("got process args %v, expected %v", spec.Process.Args, tt.args)
+			}
+			if spec.Process.Cwd != tt.cwd {
+				t.Errorf("got process working directory %s, expected %s", spec.Process.Cwd, tt.cwd)
+			}
+			if engineConfig.GetHomeDest() != tt.homeDest {
+				t.Errorf("got home destination %s, expected %s", engineConfig.GetHomeDest(), tt.homeDest)
+			}
+
+			namespaces := []string{}
+			if spec.Linux != nil {
+				for _, ns := range spec.Linux.Namespaces {
+					namespaces = append(namespaces, string(ns.Type))
+				}
+			}
+			if !reflect.DeepEqual(namespaces, tt.namespaces) {
+				t.Errorf("got namespaces %v, expected %v", namespaces, tt.namespaces)
+			}
+
+			env := make(map[string]string)
+			for _, e := range spec.Process.Env {
+				kv := strings.SplitN(e, "=", 2)
+				env[kv[0]] = kv[1]
+			}
+			for k, v := range tt.env {
+				if env[k] != v {
+					t.Errorf("got %s=%s in environment, expected %s", k, env[k], v)
+				}
+			}
+			for _, k := range tt.noEnv {
+				if _, ok := env[k]; ok {
+					t.Errorf("unexpected %s in environment", k)
+				}
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		exitCode int
+		signal   syscall.Signal
+		ctxErr   bool
+	}{
+		{
+			name:     "success",
+			script:   "exit 0",
+			exitCode: 0,
+		},
+		{
+			name:     "failure",
+			script:   "exit 3",
+			exitCode: 3,
+		},
+		{
+			name:     "signaled",
+			script:   "kill -USR1 $$",
+			exitCode: 128 + int(syscall.SIGUSR1),
+			signal:   syscall.SIGUSR1,
+		},
+		{
+			name:     "terminated",
+			script:   "sleep 10",
+			timeout:  100 * time.Millisecond,
+			exitCode: 128 + int(syscall.SIGTERM),
+			signal:   syscall.SIGTERM,
+			ctxErr:   true,
+		},
+		{
+			name:     "killed",
+			script:   "trap '' TERM; sleep 10",
+			timeout:  100 * time.Millisecond,
+			exitCode: 128 + int(syscall.SIGKILL),
+			signal:   syscall.SIGKILL,
+			ctxErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			cmd := exec.Command("/bin/sh", "-c", tt.script)
+			result, err := wait(ctx, cmd, 100*time.Millisecond)
+			if tt.ctxErr && err != context.DeadlineExceeded {
+				t.Errorf("got error %v, expected %s", err, context.DeadlineExceeded)
+			} else if !tt.ctxErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result.ExitCode != tt.exitCode {
+				t.Errorf("got exit code %d, expected %d", result.ExitCode, tt.exitCode)
+			}
+			if result.Signal != tt.signal {
+				t.Errorf("got signal %s, expected %s", result.Signal, tt.signal)
+			}
+		})
+	}
+}
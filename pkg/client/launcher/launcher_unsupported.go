@@ -0,0 +1,18 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package launcher
+
+import (
+	"context"
+	"fmt"
+)
+
+// Launch starts the container image and waits until its process exits.
+func Launch(ctx context.Context, image string, opts LaunchOptions) (*Result, error) {
+	return nil, fmt.Errorf("unsupported on this platform")
+}
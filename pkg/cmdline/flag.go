@@ -37,6 +37,9 @@ type Flag struct {
 	EnvKeys      []string
 	EnvHandler   EnvHandler
 	ExcludedOS   []string
+	// StringArray registers a []string flag whose values are not
+	// split on commas, each occurrence of the flag is one value
+	StringArray bool
 }
 
 // flagManager manages cobra command flags and store them
@@ -119,7 +122,9 @@ func (m *flagManager) registerStringVar(flag *Flag, cmds []*cobra.Command) error
 
 func (m *flagManager) registerStringSliceVar(flag *Flag, cmds []*cobra.Command) error {
 	for _, c := range cmds {
-		if flag.ShortHand != "" {
+		if flag.StringArray {
+			c.Flags().StringArrayVarP(flag.Value.(*[]string), flag.Name, flag.ShortHand, flag.DefaultValue.([]string), flag.Usage)
+		} else if flag.ShortHand != "" {
 			c.Flags().StringSliceVarP(flag.Value.(*[]string), flag.Name, flag.ShortHand, flag.DefaultValue.([]string), flag.Usage)
 		} else {
 			c.Flags().StringSliceVar(flag.Value.(*[]string), flag.Name, flag.DefaultValue.([]string), flag.Usage)
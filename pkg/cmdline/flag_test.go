@@ -16,6 +16,7 @@ import (
 var testString string
 var testBool bool
 var testStringSlice []string
+var testStringArray []string
 var testInt int
 var testUint32 uint32
 
@@ -161,6 +162,21 @@ var ttData = []struct {
 		},
 		cmd: parentCmd,
 	},
+	{
+		desc: "string array flag",
+		flag: &Flag{
+			ID:           "testStringArrayFlag",
+			Value:        &testStringArray,
+			DefaultValue: testStringArray,
+			Name:         "string-array",
+			Usage:        "a string array flag",
+			EnvKeys:      []string{"STRING_ARRAY"},
+			StringArray:  true,
+		},
+		cmd:        parentCmd,
+		envValue:   "arg1,arg2",
+		matchValue: `["arg1,arg2"]`,
+	},
 	{
 		desc: "int flag",
 		flag: &Flag{
@@ -0,0 +1,254 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package execagent provides the protocol of the exec agent socket served
+// by instances started with --exec-agent. The agent spawns processes
+// directly in the namespaces and with the environment of the instance,
+// without starting a new container with the starter.
+//
+// A client sends a request along with the standard input, output and error
+// file descriptors of the process, the agent replies once the process is
+// started and once it exited. Meanwhile the client may send signals to the
+// process, the process receives SIGHUP when the client disconnects.
+package execagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// Network is the network of exec agent sockets, each message is
+// sent as a single packet.
+const Network = "unixpacket"
+
+// maxMessageSize is the maximum size of a message, requests embed
+// the process arguments and environment.
+const maxMessageSize = 1 << 20
+
+// Request describes the process spawned by the agent.
+type Request struct {
+	// Args are the process arguments, the first argument is the
+	// absolute path of the executed program in the container.
+	Args []string `json:"args"`
+	// Env are environment variables added to or replacing the
+	// variables of the instance environment.
+	Env []string `json:"env,omitempty"`
+	// Cwd is the process working directory, the instance working
+	// directory when empty.
+	Cwd string `json:"cwd,omitempty"`
+}
+
+// Reply is sent by the agent once the process is started, with either
+// its PID or the error preventing its execution, and once it exited.
+type Reply struct {
+	Pid    int    `json:"pid,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Exited bool   `json:"exited,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// signalMessage is sent by the client to signal the process.
+type signalMessage struct {
+	Signal int `json:"signal"`
+}
+
+// StartFunc starts the process described by req with the standard
+// file descriptors files, it returns the process PID and a channel
+// receiving the process wait status once it exited. The process must
+// lead its own process group, signals are sent to the process group.
+type StartFunc func(req *Request, files []*os.File) (int, <-chan syscall.WaitStatus, error)
+
+// Process is a process spawned by an exec agent.
+type Process struct {
+	Pid  int
+	conn *net.UnixConn
+}
+
+// Start connects to the exec agent socket path and starts the process
+// described by req with files as standard input, output and error.
+func Start(path string, req *Request, files []*os.File) (*Process, error) {
+	if len(req.Args) == 0 {
+		return nil, fmt.Errorf("no process arguments")
+	}
+	if len(files) != 3 {
+		return nil, fmt.Errorf("standard input, output and error required")
+	}
+
+	c, err := net.Dial(Network, path)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.(*net.UnixConn)
+
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+	if err := writeMessage(conn, req, syscall.UnixRights(fds...)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("while sending request: %s", err)
+	}
+
+	reply := new(Reply)
+	if err := readMessage(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("while reading reply: %s", err)
+	} else if reply.Error != "" {
+		conn.Close()
+		return nil, fmt.Errorf("%s", reply.Error)
+	}
+	return &Process{Pid: reply.Pid, conn: conn}, nil
+}
+
+// Signal sends sig to the process.
+func (p *Process) Signal(sig syscall.Signal) error {
+	return writeMessage(p.conn, &signalMessage{Signal: int(sig)}, nil)
+}
+
+// Wait waits for the process to exit and returns its wait status.
+func (p *Process) Wait() (syscall.WaitStatus, error) {
+	defer p.conn.Close()
+
+	reply := new(Reply)
+	if err := readMessage(p.conn, reply); err != nil {
+		return 0, fmt.Errorf("while waiting process: %s", err)
+	} else if !reply.Exited {
+		return 0, fmt.Errorf("unexpected reply from exec agent")
+	}
+	return syscall.WaitStatus(reply.Status), nil
+}
+
+// ServeConn serves the request of the client connection conn, the
+// process is started with start. The connection is closed once the
+// process exited.
+func ServeConn(conn *net.UnixConn, start StartFunc) error {
+	defer conn.Close()
+
+	req := new(Request)
+	files, err := readRequest(conn, req)
+	if err != nil {
+		return fmt.Errorf("while reading request: %s", err)
+	}
+
+	var pid int
+	var wait <-chan syscall.WaitStatus
+
+	if len(files) != 3 || len(req.Args) == 0 {
+		err = fmt.Errorf("bad request")
+	} else {
+		pid, wait, err = start(req, files)
+	}
+	for _, f := range files {
+		f.Close()
+	}
+	if err != nil {
+		return writeMessage(conn, &Reply{Error: err.Error()}, nil)
+	}
+
+	var mu sync.Mutex
+	exited := false
+
+	// signals are not sent once the process exited and
+	// its process group ID may be reused
+	kill := func(sig syscall.Signal) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !exited {
+			syscall.Kill(-pid, sig)
+		}
+	}
+
+	if err := writeMessage(conn, &Reply{Pid: pid}, nil); err != nil {
+		kill(syscall.SIGHUP)
+		<-wait
+		return err
+	}
+
+	// forward client signals until the client disconnects
+	go func() {
+		for {
+			msg := new(signalMessage)
+			if err := readMessage(conn, msg); err != nil {
+				kill(syscall.SIGHUP)
+				return
+			}
+			kill(syscall.Signal(msg.Signal))
+		}
+	}()
+
+	status := <-wait
+	mu.Lock()
+	exited = true
+	mu.Unlock()
+
+	return writeMessage(conn, &Reply{Exited: true, Status: int(status)}, nil)
+}
+
+// writeMessage sends the JSON encoding of v with the control message oob.
+func writeMessage(conn *net.UnixConn, v interface{}, oob []byte) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxMessageSize {
+		return fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+	}
+	_, _, err = conn.WriteMsgUnix(b, oob, nil)
+	return err
+}
+
+// readMessage reads a message and decodes it into v.
+func readMessage(conn *net.UnixConn, v interface{}) error {
+	b := make([]byte, maxMessageSize)
+	n, err := conn.Read(b)
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("connection closed")
+	}
+	return json.Unmarshal(b[:n], v)
+}
+
+// readRequest reads the request into req and returns the file
+// descriptors passed with it.
+func readRequest(conn *net.UnixConn, req *Request) ([]*os.File, error) {
+	b := make([]byte, maxMessageSize)
+	oob := make([]byte, syscall.CmsgSpace(3*4))
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(b, oob)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*os.File
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			fds, err := syscall.ParseUnixRights(&msg)
+			if err != nil {
+				continue
+			}
+			for _, fd := range fds {
+				syscall.CloseOnExec(fd)
+				files = append(files, os.NewFile(uintptr(fd), "fd"))
+			}
+		}
+	}
+
+	if err := json.Unmarshal(b[:n], req); err != nil {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, err
+	}
+	return files, nil
+}
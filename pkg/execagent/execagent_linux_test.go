@@ -0,0 +1,149 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package execagent
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// start starts the requested process and waits for it in a goroutine,
+// the exec agent of instances reaps processes from the container
+// process loop instead.
+func start(req *Request, files []*os.File) (int, <-chan syscall.WaitStatus, error) {
+	p, err := os.StartProcess(req.Args[0], req.Args, &os.ProcAttr{
+		Dir:   req.Cwd,
+		Env:   req.Env,
+		Files: files,
+		Sys:   &syscall.SysProcAttr{Setpgid: true},
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	wait := make(chan syscall.WaitStatus, 1)
+	go func() {
+		state, _ := p.Wait()
+		wait <- state.Sys().(syscall.WaitStatus)
+	}()
+	return p.Pid, wait, nil
+}
+
+func TestExecAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execagent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "exec-agent.sock")
+	l, err := net.Listen(Network, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go ServeConn(c.(*net.UnixConn), start)
+		}
+	}()
+
+	// run executes args with the agent and returns its output
+	// and wait status, the process is signaled with sig once
+	// started if sig is not zero
+	run := func(req *Request, sig syscall.Signal) (string, syscall.WaitStatus, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		p, err := Start(path, req, []*os.File{os.Stdin, w, os.Stderr})
+		w.Close()
+		if err != nil {
+			return "", 0, err
+		}
+		if sig != 0 {
+			if err := p.Signal(sig); err != nil {
+				t.Fatal(err)
+			}
+		}
+		status, err := p.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out), status, nil
+	}
+
+	out, status, err := run(&Request{
+		Args: []string{"/bin/sh", "-c", "echo $FOO; pwd; exit 3"},
+		Env:  []string{"FOO=bar"},
+		Cwd:  dir,
+	}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out != "bar\n"+dir+"\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if status.ExitStatus() != 3 {
+		t.Errorf("unexpected exit status %d instead of 3", status.ExitStatus())
+	}
+
+	_, status, err = run(&Request{Args: []string{"/bin/sh", "-c", "sleep 10"}}, syscall.SIGTERM)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !status.Signaled() || status.Signal() != syscall.SIGTERM {
+		t.Errorf("process not terminated by SIGTERM: %v", status)
+	}
+
+	_, _, err = run(&Request{Args: []string{filepath.Join(dir, "missing")}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("unexpected error for a missing program: %v", err)
+	}
+
+	// the process is signaled when the client disconnects
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p, err := Start(path, &Request{Args: []string{"/bin/sh", "-c", "sleep 10; echo done"}}, []*os.File{os.Stdin, w, os.Stderr})
+	w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p.conn.Close()
+
+	done := make(chan []byte, 1)
+	go func() {
+		out, _ := ioutil.ReadAll(r)
+		done <- out
+	}()
+	select {
+	case out := <-done:
+		if len(out) != 0 {
+			t.Errorf("process not terminated on disconnection: %q", out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("process not terminated on disconnection")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DriverFeature is a bit mask of the image mounts handled by a driver.
+type DriverFeature uint16
+
+const (
+	// SquashfsFeature means the driver mounts squashfs images
+	SquashfsFeature DriverFeature = 1 << iota
+	// Ext3Feature means the driver mounts ext3 images
+	Ext3Feature
+	// ErofsFeature means the driver mounts EROFS images
+	ErofsFeature
+	// OverlayFeature means the driver mounts overlay filesystems
+	OverlayFeature
+)
+
+// FilesystemFeature returns the driver feature required to mount the
+// filesystem fstype, zero is returned for unknown filesystems.
+func FilesystemFeature(fstype string) DriverFeature {
+	switch fstype {
+	case "squashfs":
+		return SquashfsFeature
+	case "ext3":
+		return Ext3Feature
+	case "erofs":
+		return ErofsFeature
+	case "overlay":
+		return OverlayFeature
+	}
+	return 0
+}
+
+// MountParams describes an image mount requested to a driver.
+type MountParams struct {
+	// Source is the image file path, for overlay it's the
+	// source passed to the mount system call. Images opened by
+	// the runtime are referenced by a /proc/self/fd/N path valid
+	// in the calling process, drivers running helper programs
+	// must pass them the file descriptor N
+	Source string
+	// Target is the mount point of the image in the container
+	// session directory
+	Target string
+	// Filesystem is the image filesystem type
+	Filesystem string
+	// Flags are the mount flags
+	Flags uintptr
+	// Offset is the filesystem partition offset in the image file
+	Offset uint64
+	// Size is the filesystem partition size
+	Size uint64
+	// Options are the filesystem specific mount options
+	Options []string
+}
+
+// MountFunc performs a mount with the privileges of the runtime engine,
+// it takes the same arguments as the mount system call.
+type MountFunc func(source string, target string, filesystem string, flags uintptr, data string) error
+
+// Driver is the interface implemented by image drivers, they replace
+// the runtime engine mount of the image filesystems they support.
+type Driver interface {
+	// Features returns the image filesystems mounted by the driver.
+	Features() DriverFeature
+	// Mount mounts an image described by params, mount can be used
+	// by drivers requiring privileges to mount filesystems.
+	Mount(params *MountParams, mount MountFunc) error
+	// Unmount is called during container cleanup for each target
+	// mounted by the driver, the container mount namespace is
+	// already gone at this stage, it allows drivers to release
+	// resources associated with the mount.
+	Unmount(target string) error
+}
+
+var (
+	driversMu         sync.Mutex
+	registeredDrivers = make(map[string]Driver)
+)
+
+// RegisterDriver registers an image driver under the name referenced
+// by the "image driver" directive of singularity.conf.
+func RegisterDriver(name string, driver Driver) error {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		return fmt.Errorf("nil image driver %q", name)
+	}
+	if _, ok := registeredDrivers[name]; ok {
+		return fmt.Errorf("image driver %q is already registered", name)
+	}
+	registeredDrivers[name] = driver
+	return nil
+}
+
+// GetDriver returns the image driver registered with name or nil if
+// there is no such driver.
+func GetDriver(name string) Driver {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	return registeredDrivers[name]
+}
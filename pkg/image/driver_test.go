@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"testing"
+)
+
+type testDriver struct{}
+
+func (d *testDriver) Features() DriverFeature {
+	return SquashfsFeature | OverlayFeature
+}
+
+func (d *testDriver) Mount(params *MountParams, mount MountFunc) error {
+	return mount(params.Source, params.Target, params.Filesystem, params.Flags, "")
+}
+
+func (d *testDriver) Unmount(target string) error {
+	return nil
+}
+
+func TestRegisterDriver(t *testing.T) {
+	if GetDriver("test") != nil {
+		t.Fatalf("unexpected driver registered")
+	}
+	if err := RegisterDriver("test", nil); err == nil {
+		t.Errorf("unexpected success with nil driver")
+	}
+
+	driver := &testDriver{}
+	if err := RegisterDriver("test", driver); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := RegisterDriver("test", driver); err == nil {
+		t.Errorf("unexpected success while registering driver twice")
+	}
+	if d := GetDriver("test"); d != driver {
+		t.Errorf("got driver %v, expected %v", d, driver)
+	}
+}
+
+func TestFilesystemFeature(t *testing.T) {
+	tests := []struct {
+		fstype  string
+		feature DriverFeature
+	}{
+		{"squashfs", SquashfsFeature},
+		{"ext3", Ext3Feature},
+		{"erofs", ErofsFeature},
+		{"overlay", OverlayFeature},
+		{"tmpfs", 0},
+	}
+
+	driver := &testDriver{}
+	for _, tt := range tests {
+		if f := FilesystemFeature(tt.fstype); f != tt.feature {
+			t.Errorf("got feature %d for %s, expected %d", f, tt.fstype, tt.feature)
+		}
+	}
+	if driver.Features()&FilesystemFeature("ext3") != 0 {
+		t.Errorf("unexpected ext3 support")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	erofsMagicOffset = 1024
+	erofsMagic       = 0xE0F5E1E2
+)
+
+type erofsFormat struct{}
+
+// CheckErofsHeader checks if byte content contains a valid EROFS header
+// and returns offset where EROFS partition begin
+func CheckErofsHeader(b []byte) (uint64, error) {
+	var offset uint64 = erofsMagicOffset
+
+	o := bytes.Index(b, []byte(launchString))
+	if o > 0 {
+		offset += uint64(o + len(launchString) + 1)
+	}
+
+	if offset+4 > uint64(len(b)) {
+		return offset, debugError("can't find EROFS information header")
+	}
+	if binary.LittleEndian.Uint32(b[offset:]) != erofsMagic {
+		return offset, debugError("not a valid EROFS image")
+	}
+	offset -= erofsMagicOffset
+	return offset, nil
+}
+
+func (f *erofsFormat) initializer(img *Image, fileinfo os.FileInfo) error {
+	if fileinfo.IsDir() {
+		return debugError("not an EROFS image")
+	}
+	b := make([]byte, bufferSize)
+	if n, err := img.File.Read(b); err != nil || n != bufferSize {
+		return debugErrorf("can't read first %d bytes: %s", bufferSize, err)
+	}
+	offset, err := CheckErofsHeader(b)
+	if err != nil {
+		return err
+	}
+	img.Type = EROFS
+	img.Partitions = []Section{
+		{
+			Offset: offset,
+			Size:   uint64(fileinfo.Size()) - offset,
+			Type:   EROFS,
+			Name:   RootFs,
+		},
+	}
+
+	if img.Writable {
+		sylog.Warningf("EROFS is not a writable filesystem")
+		img.Writable = false
+	}
+
+	return nil
+}
+
+func (f *erofsFormat) openMode(writable bool) int {
+	return os.O_RDONLY
+}
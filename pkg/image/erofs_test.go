@@ -0,0 +1,45 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestCheckErofsHeader(t *testing.T) {
+	header := "#!/usr/bin/env run-singularity\n"
+
+	plain := make([]byte, bufferSize)
+	binary.LittleEndian.PutUint32(plain[erofsMagicOffset:], erofsMagic)
+
+	launch := make([]byte, bufferSize)
+	copy(launch, header)
+	binary.LittleEndian.PutUint32(launch[len(header)+erofsMagicOffset:], erofsMagic)
+
+	tests := []struct {
+		name   string
+		b      []byte
+		offset uint64
+		valid  bool
+	}{
+		{"empty", make([]byte, bufferSize), 0, false},
+		{"plain", plain, 0, true},
+		{"launch script", launch, uint64(len(header)), true},
+		{"truncated", plain[:erofsMagicOffset+2], 0, false},
+	}
+
+	for _, tt := range tests {
+		offset, err := CheckErofsHeader(tt.b)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		} else if tt.valid && offset != tt.offset {
+			t.Errorf("%s: got offset %d, expected %d", tt.name, offset, tt.offset)
+		}
+	}
+}
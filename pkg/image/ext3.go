@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"unsafe"
 )
@@ -23,6 +24,7 @@ const (
 	rocompatSparseSuper = 0x1
 	rocompatLargeFile   = 0x2
 	rocompatBtreeDir    = 0x4
+	extSuperblockOffset = 1024
 )
 
 const notValidExt3ImageMessage = "file is not a valid ext3 image"
@@ -36,6 +38,36 @@ type extFSInfo struct {
 	Rocompat uint32
 }
 
+// extSuperblock holds the leading counters of an ext superblock.
+type extSuperblock struct {
+	InodesCount     uint32
+	BlocksCount     uint32
+	RBlocksCount    uint32
+	FreeBlocksCount uint32
+	FreeInodesCount uint32
+	FirstDataBlock  uint32
+	LogBlockSize    uint32
+}
+
+// Ext3Usage describes the block and inode usage of an ext3 filesystem.
+type Ext3Usage struct {
+	BlockSize  uint64
+	Blocks     uint64
+	FreeBlocks uint64
+	Inodes     uint64
+	FreeInodes uint64
+}
+
+// Size returns the size in bytes of the filesystem.
+func (u *Ext3Usage) Size() uint64 {
+	return u.Blocks * u.BlockSize
+}
+
+// Used returns the number of bytes used in the filesystem.
+func (u *Ext3Usage) Used() uint64 {
+	return (u.Blocks - u.FreeBlocks) * u.BlockSize
+}
+
 type ext3Format struct{}
 
 // CheckExt3Header checks if byte content contains a valid ext3 header
@@ -73,6 +105,35 @@ func CheckExt3Header(b []byte) (uint64, error) {
 	return offset, nil
 }
 
+// ReadExt3Usage returns the usage recorded in the superblock of the ext3
+// filesystem starting at offset in r. The counters are updated by the
+// kernel when the filesystem is synced or unmounted, they may be stale
+// while the filesystem is mounted.
+func ReadExt3Usage(r io.ReaderAt, offset int64) (*Ext3Usage, error) {
+	b := make([]byte, bufferSize)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return nil, fmt.Errorf("can't read first %d bytes: %s", bufferSize, err)
+	}
+	hdrOffset, err := CheckExt3Header(b)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := extSuperblock{}
+	sr := io.NewSectionReader(r, offset+int64(hdrOffset)+extSuperblockOffset, int64(binary.Size(sb)))
+	if err := binary.Read(sr, binary.LittleEndian, &sb); err != nil {
+		return nil, fmt.Errorf("can't read ext3 superblock: %s", err)
+	}
+
+	return &Ext3Usage{
+		BlockSize:  1024 << sb.LogBlockSize,
+		Blocks:     uint64(sb.BlocksCount),
+		FreeBlocks: uint64(sb.FreeBlocksCount),
+		Inodes:     uint64(sb.InodesCount),
+		FreeInodes: uint64(sb.FreeInodesCount),
+	}, nil
+}
+
 func (f *ext3Format) initializer(img *Image, fileinfo os.FileInfo) error {
 	if fileinfo.IsDir() {
 		return debugError("not an ext3 image")
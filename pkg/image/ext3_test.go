@@ -134,6 +134,42 @@ func TestCheckExt3Header(t *testing.T) {
 	}
 }
 
+func TestReadExt3Usage(t *testing.T) {
+	f, err := ioutil.TempFile("", "ext3-usage-")
+	if err != nil {
+		t.Fatalf("cannot create temporary file: %s", err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	createFullVirtualBlockDevice(t, path, "ext3")
+
+	img, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("cannot open %s: %s", path, err)
+	}
+	defer img.Close()
+
+	usage, err := ReadExt3Usage(img, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if usage.Size() != 10000*1024 {
+		t.Errorf("got filesystem size %d, expected %d", usage.Size(), 10000*1024)
+	}
+	if usage.FreeBlocks == 0 || usage.FreeBlocks >= usage.Blocks {
+		t.Errorf("unexpected free blocks %d for %d blocks", usage.FreeBlocks, usage.Blocks)
+	}
+	if usage.FreeInodes == 0 || usage.FreeInodes >= usage.Inodes {
+		t.Errorf("unexpected free inodes %d for %d inodes", usage.FreeInodes, usage.Inodes)
+	}
+
+	if _, err := ReadExt3Usage(bytes.NewReader(make([]byte, bufferSize)), 0); err == nil {
+		t.Errorf("unexpected success with an empty buffer")
+	}
+}
+
 func TestInitializer(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
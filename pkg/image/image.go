@@ -6,15 +6,14 @@
 package image
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
+	"github.com/sylabs/singularity/pkg/util/errcode"
 	"github.com/sylabs/singularity/pkg/util/fs/lock"
 )
 
@@ -29,6 +28,10 @@ const (
 	SIF
 	// ENCRYPTSQUASHFS constant for encrypted squashfs format
 	ENCRYPTSQUASHFS
+	// EROFS constant for EROFS format
+	EROFS
+	// LUKS constant for LUKS encrypted ext3 format
+	LUKS
 )
 
 const (
@@ -52,7 +55,7 @@ func debugErrorf(format string, a ...interface{}) error {
 }
 
 // ErrUnknownFormat represents an unknown image format error.
-var ErrUnknownFormat = errors.New("image format not recognized")
+var ErrUnknownFormat = errcode.New(errcode.ImageFormat, "image format not recognized")
 
 var registeredFormats = []struct {
 	name   string
@@ -61,7 +64,9 @@ var registeredFormats = []struct {
 	{"sandbox", &sandboxFormat{}},
 	{"sif", &sifFormat{}},
 	{"squashfs", &squashfsFormat{}},
+	{"erofs", &erofsFormat{}},
 	{"ext3", &ext3Format{}},
+	{"luks", &luksFormat{}},
 }
 
 // format describes the interface that an image format type must implement.
@@ -76,6 +81,7 @@ type Section struct {
 	Offset uint64 `json:"offset"`
 	Type   uint32 `json:"type"`
 	Name   string `json:"name"`
+	ID     uint32 `json:"id,omitempty"`
 }
 
 // Image describes an image object, an image is composed of one
@@ -119,7 +125,10 @@ func (i *Image) AuthorizedOwner(owners []string) (bool, error) {
 		return false, fmt.Errorf("failed to get stat for %s", i.Path)
 	}
 
-	uid := fileinfo.Sys().(*syscall.Stat_t).Uid
+	uid, _, err := fileOwner(fileinfo)
+	if err != nil {
+		return false, err
+	}
 	for _, owner := range owners {
 		pw, err := user.GetPwNam(owner)
 		if err != nil {
@@ -139,7 +148,10 @@ func (i *Image) AuthorizedGroup(groups []string) (bool, error) {
 		return false, fmt.Errorf("failed to get stat for %s", i.Path)
 	}
 
-	gid := fileinfo.Sys().(*syscall.Stat_t).Gid
+	_, gid, err := fileOwner(fileinfo)
+	if err != nil {
+		return false, err
+	}
 	for _, group := range groups {
 		gr, err := user.GetGrNam(group)
 		if err != nil {
@@ -209,7 +221,9 @@ func ResolvePath(path string) (string, error) {
 		return "", fmt.Errorf("failed to get absolute path: %s", err)
 	}
 	resolvedPath, err := filepath.EvalSymlinks(abspath)
-	if err != nil {
+	if os.IsNotExist(err) {
+		return "", errcode.Wrap(errcode.ImageNotFound, err, "failed to retrieve path for %s", path)
+	} else if err != nil {
 		return "", fmt.Errorf("failed to retrieve path for %s: %s", path, err)
 	}
 	return resolvedPath, nil
@@ -237,7 +251,7 @@ func Init(path string, writable bool) (*Image, error) {
 		mode := rf.format.openMode(writable)
 
 		if mode&os.O_RDWR != 0 {
-			if err := syscall.Access(resolvedPath, 2); err != nil {
+			if err := checkWritable(resolvedPath); err != nil {
 				sylog.Debugf("Opening %s in read-only mode: no write permissions", path)
 				mode = os.O_RDONLY
 				img.Writable = false
@@ -245,7 +259,9 @@ func Init(path string, writable bool) (*Image, error) {
 		}
 
 		img.File, err = os.OpenFile(resolvedPath, mode, 0)
-		if err != nil {
+		if os.IsPermission(err) {
+			return nil, errcode.Wrap(errcode.PermissionDenied, err, "could not open image %s", resolvedPath)
+		} else if err != nil {
 			continue
 		}
 		fileinfo, err := img.File.Stat()
@@ -266,7 +282,7 @@ func Init(path string, writable bool) (*Image, error) {
 
 		sylog.Debugf("%s image format detected", rf.name)
 
-		if _, _, err := syscall.Syscall(syscall.SYS_FCNTL, img.File.Fd(), syscall.F_SETFD, syscall.O_CLOEXEC); err != 0 {
+		if err := setCloseOnExec(img.File); err != nil {
 			sylog.Warningf("failed to set O_CLOEXEC flags on image")
 		}
 
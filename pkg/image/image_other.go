@@ -0,0 +1,44 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package image
+
+import (
+	"fmt"
+	"os"
+)
+
+// fileOwner is not supported on this platform as files are not
+// owned by a UID/GID pair.
+func fileOwner(fi os.FileInfo) (uint32, uint32, error) {
+	return 0, 0, fmt.Errorf("file ownership not supported on this platform")
+}
+
+// checkWritable relies on file permission bits as there is no
+// access(2) on this platform.
+func checkWritable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&0200 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// setCloseOnExec does nothing, files are not inherited by child
+// processes by default on this platform.
+func setCloseOnExec(f *os.File) error {
+	return nil
+}
+
+// unmap does nothing as image files are read without being mapped
+// into memory on this platform.
+func unmap(data []byte) error {
+	return nil
+}
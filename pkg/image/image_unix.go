@@ -0,0 +1,42 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package image
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner UID and GID of the file described by fi.
+func fileOwner(fi os.FileInfo) (uint32, uint32, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, fmt.Errorf("failed to get owner of %s", fi.Name())
+	}
+	return st.Uid, st.Gid, nil
+}
+
+// checkWritable returns an error if the user doesn't have write
+// permissions on path.
+func checkWritable(path string) error {
+	return syscall.Access(path, 2)
+}
+
+// setCloseOnExec sets the close-on-exec flag on the file.
+func setCloseOnExec(f *os.File) error {
+	if _, _, err := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_SETFD, syscall.O_CLOEXEC); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// unmap unmaps memory previously mapped from an image file.
+func unmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+)
+
+const (
+	luksMagic = "LUKS\xba\xbe"
+	// luksVersion is the LUKS header version used by encrypted
+	// containers and overlays, stored after the magic
+	luksVersion = 2
+)
+
+type luksFormat struct{}
+
+// CheckLUKSHeader checks if byte content contains a LUKS2 header,
+// it returns false for blank content which is considered as an
+// unformatted LUKS image.
+func CheckLUKSHeader(b []byte) (bool, error) {
+	if bytes.HasPrefix(b, []byte(luksMagic)) {
+		if len(b) < len(luksMagic)+2 {
+			return false, debugError("truncated LUKS header")
+		}
+		if v := binary.BigEndian.Uint16(b[len(luksMagic):]); v != luksVersion {
+			return false, debugErrorf("unsupported LUKS version %d", v)
+		}
+		return true, nil
+	}
+	for _, c := range b {
+		if c != 0 {
+			return false, debugError("not a LUKS image")
+		}
+	}
+	return false, nil
+}
+
+func (f *luksFormat) initializer(img *Image, fileinfo os.FileInfo) error {
+	if fileinfo.IsDir() {
+		return debugError("not a LUKS image")
+	}
+	b := make([]byte, bufferSize)
+	if n, err := img.File.Read(b); err != nil || n != bufferSize {
+		return debugErrorf("can't read first %d bytes: %s", bufferSize, err)
+	}
+	formatted, err := CheckLUKSHeader(b)
+	if err != nil {
+		return err
+	}
+	// blank files are only usable as writable encrypted overlay
+	if !formatted && !img.Writable {
+		return debugError("blank file is not writable")
+	}
+	img.Type = LUKS
+	img.Partitions = []Section{
+		{
+			Offset: 0,
+			Size:   uint64(fileinfo.Size()),
+			Type:   LUKS,
+			Name:   RootFs,
+		},
+	}
+	return nil
+}
+
+func (f *luksFormat) openMode(writable bool) int {
+	if writable {
+		return os.O_RDWR
+	}
+	return os.O_RDONLY
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"testing"
+)
+
+func TestCheckLUKSHeader(t *testing.T) {
+	luks := make([]byte, bufferSize)
+	copy(luks, luksMagic+"\x00\x02")
+
+	luks1 := make([]byte, bufferSize)
+	copy(luks1, luksMagic+"\x00\x01")
+
+	magic := make([]byte, bufferSize)
+	copy(magic, "LUKS\xba\xbf\x00\x02")
+
+	data := make([]byte, bufferSize)
+	data[bufferSize-1] = 1
+
+	tests := []struct {
+		name      string
+		b         []byte
+		formatted bool
+		valid     bool
+	}{
+		{"blank", make([]byte, bufferSize), false, true},
+		{"luks", luks, true, true},
+		{"luks1", luks1, false, false},
+		{"truncated", []byte(luksMagic), false, false},
+		{"bad magic", magic, false, false},
+		{"data", data, false, false},
+	}
+
+	for _, tt := range tests {
+		formatted, err := CheckLUKSHeader(tt.b)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		} else if formatted != tt.formatted {
+			t.Errorf("%s: got formatted %t, expected %t", tt.name, formatted, tt.formatted)
+		}
+	}
+}
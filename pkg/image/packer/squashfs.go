@@ -6,9 +6,14 @@
 package packer
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
 )
 
 // Squashfs represents a squashfs packer
@@ -28,6 +33,74 @@ func (s *Squashfs) HasMksquashfs() bool {
 	return s.MksquashfsPath != ""
 }
 
+// SquashfsFeatures describes the options supported by a mksquashfs binary.
+type SquashfsFeatures struct {
+	// Compressors lists the available compression algorithms, it's
+	// empty if mksquashfs doesn't report them
+	Compressors []string
+	// Processors reports if the -processors option is supported
+	Processors bool
+}
+
+// HasCompressor returns if the compression algorithm comp is available.
+func (f *SquashfsFeatures) HasCompressor(comp string) bool {
+	for _, c := range f.Compressors {
+		if c == comp {
+			return true
+		}
+	}
+	return false
+}
+
+// compressorRegexp matches the compressors listed by mksquashfs -help,
+// their options are indented further.
+var compressorRegexp = regexp.MustCompile(`^\t(\w+)(?: \(default\))?\s*$`)
+
+// parseMksquashfsHelp returns the features reported by mksquashfs -help.
+func parseMksquashfsHelp(help []byte) *SquashfsFeatures {
+	f := &SquashfsFeatures{}
+	compressors := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(help))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "-processors ") {
+			f.Processors = true
+		}
+		if strings.HasPrefix(line, "Compressors available") {
+			compressors = true
+			continue
+		}
+		if !compressors {
+			continue
+		}
+		if m := compressorRegexp.FindStringSubmatch(line); m != nil {
+			f.Compressors = append(f.Compressors, m[1])
+		}
+	}
+	return f
+}
+
+// Features returns the features of the mksquashfs binary.
+func (s *Squashfs) Features() (*SquashfsFeatures, error) {
+	if !s.HasMksquashfs() {
+		return nil, fmt.Errorf("mksquashfs not found")
+	}
+
+	// mksquashfs -help exits with a non zero status, only
+	// the output matters
+	var out bytes.Buffer
+	cmd := exec.Command(s.MksquashfsPath, "-help")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("while running %s: %v", s.MksquashfsPath, err)
+		}
+	}
+	return parseMksquashfsHelp(out.Bytes()), nil
+}
+
 func (s *Squashfs) create(files []string, dest string, opts []string) error {
 	var stderr bytes.Buffer
 
@@ -45,6 +118,7 @@ func (s *Squashfs) create(files []string, dest string, opts []string) error {
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("create command failed: %v: %s", err, stderr.String())
 	}
+	xattr.ParseSquashfsOutput(stderr.Bytes(), "").Warn()
 	return nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -78,3 +79,50 @@ func TestSquashfs(t *testing.T) {
 	// ensure we can extract these files from squashfs
 	checkArchive(t, image.Name(), []string{"squashfs.go", "squashfs_test.go"})
 }
+
+const testMksquashfsHelp = `SYNTAX:mksquashfs source1 source2 ...  dest [options] [-e list of exclude dirs/files]
+
+Filesystem build options:
+-comp <comp>		select <comp> compression
+			Compressors available:
+				gzip (default)
+				zstd
+-b <block_size>		set data block to <block_size>.  Default 128 Kbytes
+
+Mksquashfs runtime options:
+-processors <number>	Use <number> processors.  By default will use number of
+			processors available
+
+Compressors available and compressor specific options:
+	gzip (default)
+	  -Xcompression-level <compression-level>
+		<compression-level> should be 1 .. 9 (default 9)
+	lzo
+	  -Xalgorithm <algorithm>
+	lz4
+	  -Xhc
+	xz
+	  -Xbcj filter1,filter2,...,filterN
+	zstd
+	  -Xcompression-level <compression-level>
+`
+
+func TestParseMksquashfsHelp(t *testing.T) {
+	f := parseMksquashfsHelp([]byte(testMksquashfsHelp))
+
+	expected := &SquashfsFeatures{
+		Compressors: []string{"gzip", "lzo", "lz4", "xz", "zstd"},
+		Processors:  true,
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("got features %+v, expected %+v", f, expected)
+	}
+	if !f.HasCompressor("zstd") || f.HasCompressor("lzma") {
+		t.Errorf("unexpected compressor availability")
+	}
+
+	f = parseMksquashfsHelp([]byte("SYNTAX:mksquashfs source1 source2 ...  dest [options]\n"))
+	if len(f.Compressors) != 0 || f.Processors {
+		t.Errorf("unexpected features without compressors and processors options: %+v", f)
+	}
+}
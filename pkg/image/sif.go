@@ -10,9 +10,8 @@ import (
 	"fmt"
 	"os"
 	"runtime"
-	"syscall"
 
-	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sif"
 )
 
 const (
@@ -121,6 +120,7 @@ func (f *sifFormat) initializer(img *Image, fileinfo os.FileInfo) error {
 				Size:   uint64(desc.Filelen),
 				Name:   RootFs,
 				Type:   htype,
+				ID:     desc.ID,
 			},
 		}
 
@@ -161,6 +161,7 @@ func (f *sifFormat) initializer(img *Image, fileinfo os.FileInfo) error {
 				Size:   uint64(desc.Filelen),
 				Name:   desc.GetName(),
 				Type:   htype,
+				ID:     desc.ID,
 			}
 			img.Partitions = append(img.Partitions, partition)
 		} else if desc.Datatype != 0 {
@@ -169,6 +170,7 @@ func (f *sifFormat) initializer(img *Image, fileinfo os.FileInfo) error {
 				Size:   uint64(desc.Filelen),
 				Type:   uint32(desc.Datatype),
 				Name:   desc.GetName(),
+				ID:     desc.ID,
 			}
 			img.Sections = append(img.Sections, data)
 		}
@@ -179,7 +181,7 @@ func (f *sifFormat) initializer(img *Image, fileinfo os.FileInfo) error {
 	// UnloadContainer close image, just want to unmap image
 	// from memory
 	if !fimg.Amodebuf {
-		if err := syscall.Munmap(fimg.Filedata); err != nil {
+		if err := unmap(fimg.Filedata); err != nil {
 			return fmt.Errorf("while calling unmapping SIF file")
 		}
 	}
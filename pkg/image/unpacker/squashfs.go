@@ -12,6 +12,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs/xattr"
 )
 
 // Squashfs represents a squashfs unpacker
@@ -69,9 +71,11 @@ func (s *Squashfs) extract(files []string, reader io.Reader, dest string) error
 	if stdin {
 		cmd.Stdin = reader
 	}
-	if o, err := cmd.CombinedOutput(); err != nil {
+	o, err := cmd.CombinedOutput()
+	if err != nil {
 		return fmt.Errorf("extract command failed: %s: %s", string(o), err)
 	}
+	xattr.ParseSquashfsOutput(o, dest).Warn()
 	return nil
 }
 
@@ -0,0 +1,84 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/sif"
+)
+
+const (
+	// VerityHashName is the name of the SIF descriptor holding the
+	// dm-verity hash tree of the primary system partition
+	VerityHashName = "dm-verity"
+	// VerityConfigName is the name of the SIF descriptor holding the
+	// dm-verity root hash of the primary system partition
+	VerityConfigName = "dm-verity.json"
+)
+
+// maxVerityConfigSize is the maximum size of the dm-verity descriptor
+const maxVerityConfigSize = 4096
+
+// VerityConfig describes the dm-verity parameters stored in a SIF image.
+type VerityConfig struct {
+	RootHash string `json:"rootHash"`
+}
+
+// Verity locates the dm-verity hash tree of the primary system partition
+// of a SIF image.
+type Verity struct {
+	RootHash   string
+	HashOffset uint64
+	HashSize   uint64
+}
+
+// GetVerity returns the dm-verity hash tree of the primary system partition
+// of a SIF image, or nil if the image doesn't carry one.
+func GetVerity(img *Image) (*Verity, error) {
+	if img.Type != SIF {
+		return nil, nil
+	}
+
+	var hash, config *Section
+
+	for i, s := range img.Sections {
+		switch {
+		case s.Name == VerityHashName && s.Type == uint32(sif.DataGeneric):
+			hash = &img.Sections[i]
+		case s.Name == VerityConfigName && s.Type == uint32(sif.DataGenericJSON):
+			config = &img.Sections[i]
+		}
+	}
+	if hash == nil && config == nil {
+		return nil, nil
+	} else if hash == nil || config == nil {
+		return nil, fmt.Errorf("incomplete dm-verity data in %s, both %s and %s descriptors are required", img.Path, VerityHashName, VerityConfigName)
+	}
+
+	if config.Size > maxVerityConfigSize {
+		return nil, fmt.Errorf("dm-verity descriptor of %s is too large", img.Path)
+	}
+	data := make([]byte, config.Size)
+	if _, err := img.File.ReadAt(data, int64(config.Offset)); err != nil {
+		return nil, fmt.Errorf("while reading dm-verity descriptor of %s: %s", img.Path, err)
+	}
+
+	vc := VerityConfig{}
+	if err := json.Unmarshal(data, &vc); err != nil {
+		return nil, fmt.Errorf("while decoding dm-verity descriptor of %s: %s", img.Path, err)
+	}
+	if vc.RootHash == "" {
+		return nil, fmt.Errorf("no dm-verity root hash found in %s", img.Path)
+	}
+
+	return &Verity{
+		RootHash:   vc.RootHash,
+		HashOffset: hash.Offset,
+		HashSize:   hash.Size,
+	}, nil
+}
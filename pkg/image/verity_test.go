@@ -0,0 +1,64 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+func TestGetVerity(t *testing.T) {
+	f, err := ioutil.TempFile("", "verity-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	rootHash := strings.Repeat("ab", 32)
+	config := `{"rootHash":"` + rootHash + `"}`
+	f.WriteString("hashtree" + config + "{}")
+
+	hash := Section{Offset: 0, Size: 8, Type: uint32(sif.DataGeneric), Name: VerityHashName}
+	good := Section{Offset: 8, Size: uint64(len(config)), Type: uint32(sif.DataGenericJSON), Name: VerityConfigName}
+	empty := Section{Offset: uint64(8 + len(config)), Size: 2, Type: uint32(sif.DataGenericJSON), Name: VerityConfigName}
+	other := Section{Offset: 8, Size: uint64(len(config)), Type: uint32(sif.DataGenericJSON), Name: "oci-config.json"}
+
+	tests := []struct {
+		name     string
+		imgType  int
+		sections []Section
+		verity   *Verity
+		valid    bool
+	}{
+		{"not sif", SQUASHFS, []Section{hash, good}, nil, true},
+		{"no verity", SIF, []Section{other}, nil, true},
+		{"verity", SIF, []Section{other, hash, good}, &Verity{RootHash: rootHash, HashOffset: 0, HashSize: 8}, true},
+		{"missing hash tree", SIF, []Section{good}, nil, false},
+		{"missing root hash", SIF, []Section{hash}, nil, false},
+		{"empty root hash", SIF, []Section{hash, empty}, nil, false},
+	}
+
+	for _, tt := range tests {
+		img := &Image{Path: f.Name(), Type: tt.imgType, File: f, Sections: tt.sections}
+		v, err := GetVerity(img)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("%s: unexpected success", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if (v == nil) != (tt.verity == nil) || (v != nil && *v != *tt.verity) {
+			t.Errorf("%s: got %+v, expected %+v", tt.name, v, tt.verity)
+		}
+	}
+}
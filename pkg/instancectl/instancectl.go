@@ -0,0 +1,200 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package instancectl provides the JSON-RPC API of the control socket
+// served by the master process of Singularity instances.
+package instancectl
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+// ServiceName is the JSON-RPC service name of instance control sockets,
+// methods are called as ServiceName.Method.
+const ServiceName = "Instance"
+
+const (
+	// Stdout is the log stream of the instance standard output.
+	Stdout = "stdout"
+	// Stderr is the log stream of the instance standard error.
+	Stderr = "stderr"
+)
+
+// Stats holds the resource usage of an instance.
+type Stats struct {
+	// MemoryUsage is the memory usage in bytes.
+	MemoryUsage uint64 `json:"memoryUsage"`
+	// MemoryLimit is the memory limit in bytes, 0 means no limit.
+	MemoryLimit uint64 `json:"memoryLimit"`
+	// CPUUsage is the total CPU time consumed in nanoseconds.
+	CPUUsage uint64 `json:"cpuUsage"`
+	// Pids is the number of processes.
+	Pids uint64 `json:"pids"`
+}
+
+// ExecArgs defines the arguments to execute a command in an instance.
+type ExecArgs struct {
+	Args []string `json:"args"`
+}
+
+// ExecResult holds the result of a command executed in an instance.
+type ExecResult struct {
+	Output   []byte `json:"output"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// LogsArgs defines the arguments to read an instance log stream.
+type LogsArgs struct {
+	Stream string `json:"stream"`
+	Offset int64  `json:"offset"`
+	Size   int    `json:"size"`
+}
+
+// LogsResult holds data read from an instance log stream and the offset
+// to read the following data from.
+type LogsResult struct {
+	Data   []byte `json:"data"`
+	Offset int64  `json:"offset"`
+}
+
+// Empty is used by operations without arguments or result.
+type Empty struct{}
+
+// Handler implements the instance control operations.
+type Handler interface {
+	Stats() (*Stats, error)
+	Exec(args []string) (*ExecResult, error)
+	Pause() error
+	Resume() error
+	Logs(stream string, offset int64, size int) (*LogsResult, error)
+}
+
+// Methods exposes a Handler as JSON-RPC service methods.
+type Methods struct {
+	handler Handler
+}
+
+// Stats returns the instance resource usage.
+func (m *Methods) Stats(_ *Empty, reply *Stats) error {
+	stats, err := m.handler.Stats()
+	if err != nil {
+		return err
+	}
+	*reply = *stats
+	return nil
+}
+
+// Exec executes a command in the instance.
+func (m *Methods) Exec(args *ExecArgs, reply *ExecResult) error {
+	if len(args.Args) == 0 {
+		return fmt.Errorf("no command to execute")
+	}
+	result, err := m.handler.Exec(args.Args)
+	if err != nil {
+		return err
+	}
+	*reply = *result
+	return nil
+}
+
+// Pause suspends all instance processes.
+func (m *Methods) Pause(_ *Empty, _ *Empty) error {
+	return m.handler.Pause()
+}
+
+// Resume resumes all instance processes.
+func (m *Methods) Resume(_ *Empty, _ *Empty) error {
+	return m.handler.Resume()
+}
+
+// Logs reads an instance log stream.
+func (m *Methods) Logs(args *LogsArgs, reply *LogsResult) error {
+	if args.Stream != Stdout && args.Stream != Stderr {
+		return fmt.Errorf("unknown log stream %q", args.Stream)
+	}
+	result, err := m.handler.Logs(args.Stream, args.Offset, args.Size)
+	if err != nil {
+		return err
+	}
+	*reply = *result
+	return nil
+}
+
+// Serve serves the control operations implemented by h to connections
+// accepted by l until l is closed.
+func Serve(l net.Listener, h Handler) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, &Methods{handler: h}); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// Client is a client of an instance control socket.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the instance control socket path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("while connecting to instance control socket: %s", err)
+	}
+	return &Client{rpc: jsonrpc.NewClient(conn)}, nil
+}
+
+// Close closes the connection to the control socket.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// Stats returns the instance resource usage.
+func (c *Client) Stats() (*Stats, error) {
+	var reply Stats
+	if err := c.rpc.Call(ServiceName+".Stats", &Empty{}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Exec executes the command args in the instance and returns its
+// combined output and exit code.
+func (c *Client) Exec(args []string) (*ExecResult, error) {
+	var reply ExecResult
+	if err := c.rpc.Call(ServiceName+".Exec", &ExecArgs{Args: args}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Pause suspends all instance processes.
+func (c *Client) Pause() error {
+	return c.rpc.Call(ServiceName+".Pause", &Empty{}, &Empty{})
+}
+
+// Resume resumes all instance processes.
+func (c *Client) Resume() error {
+	return c.rpc.Call(ServiceName+".Resume", &Empty{}, &Empty{})
+}
+
+// Logs reads at most size bytes of the log stream starting at offset.
+func (c *Client) Logs(stream string, offset int64, size int) (*LogsResult, error) {
+	var reply LogsResult
+	args := &LogsArgs{Stream: stream, Offset: offset, Size: size}
+	if err := c.rpc.Call(ServiceName+".Logs", args, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
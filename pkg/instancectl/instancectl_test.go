@@ -0,0 +1,128 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instancectl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeHandler struct {
+	paused bool
+	logs   map[string]string
+}
+
+func (h *fakeHandler) Stats() (*Stats, error) {
+	return &Stats{MemoryUsage: 1024, MemoryLimit: 4096, CPUUsage: 42, Pids: 3}, nil
+}
+
+func (h *fakeHandler) Exec(args []string) (*ExecResult, error) {
+	if args[0] == "false" {
+		return &ExecResult{ExitCode: 1}, nil
+	}
+	return &ExecResult{Output: []byte(strings.Join(args, " "))}, nil
+}
+
+func (h *fakeHandler) Pause() error {
+	if h.paused {
+		return fmt.Errorf("instance already paused")
+	}
+	h.paused = true
+	return nil
+}
+
+func (h *fakeHandler) Resume() error {
+	if !h.paused {
+		return fmt.Errorf("instance not paused")
+	}
+	h.paused = false
+	return nil
+}
+
+func (h *fakeHandler) Logs(stream string, offset int64, size int) (*LogsResult, error) {
+	data := h.logs[stream][offset:]
+	if len(data) > size {
+		data = data[:size]
+	}
+	return &LogsResult{Data: []byte(data), Offset: offset + int64(len(data))}, nil
+}
+
+func TestControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instancectl-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "control.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	h := &fakeHandler{logs: map[string]string{Stdout: "hello world", Stderr: "oops"}}
+	go Serve(l, h)
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected, _ := h.Stats()
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("got stats %+v, expected %+v", stats, expected)
+	}
+
+	res, err := c.Exec([]string{"echo", "test"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(res.Output) != "echo test" || res.ExitCode != 0 {
+		t.Errorf("unexpected exec result %+v", res)
+	}
+	if res, err := c.Exec([]string{"false"}); err != nil || res.ExitCode != 1 {
+		t.Errorf("unexpected exec result %+v: %v", res, err)
+	}
+	if _, err := c.Exec(nil); err == nil {
+		t.Errorf("unexpected success with empty command")
+	}
+
+	if err := c.Pause(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := c.Pause(); err == nil || err.Error() != "instance already paused" {
+		t.Errorf("unexpected error for paused instance: %v", err)
+	}
+	if err := c.Resume(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	logs, err := c.Logs(Stdout, 6, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(logs.Data) != "wor" || logs.Offset != 9 {
+		t.Errorf("unexpected logs result %+v", logs)
+	}
+	if logs, err := c.Logs(Stderr, 0, 1024); err != nil || string(logs.Data) != "oops" {
+		t.Errorf("unexpected logs result %+v: %v", logs, err)
+	}
+	if _, err := c.Logs("stdin", 0, 1024); err == nil {
+		t.Errorf("unexpected success with unknown stream")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
 )
 
@@ -227,6 +228,46 @@ func (m *Setup) SetCapability(network string, capName string, args interface{})
 	return nil
 }
 
+// ParsePortMap parses a port mapping of the form
+// hostPort[:containerPort][/protocol], the container port defaults to the
+// host port and the protocol defaults to tcp.
+func ParsePortMap(value string) (*PortMapEntry, error) {
+	pm := &PortMapEntry{Protocol: "tcp"}
+
+	splittedPort := strings.SplitN(value, "/", 2)
+	if len(splittedPort) == 2 {
+		pm.Protocol = splittedPort[1]
+	}
+	if pm.Protocol != "tcp" && pm.Protocol != "udp" {
+		return nil, fmt.Errorf("only tcp and udp protocol can be specified")
+	}
+	ports := strings.Split(splittedPort[0], ":")
+	if len(ports) != 1 && len(ports) != 2 {
+		return nil, fmt.Errorf("portmap port argument is badly formatted")
+	}
+	if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
+		pm.HostPort = int(n)
+		if pm.HostPort <= 0 || pm.HostPort > 65535 {
+			return nil, fmt.Errorf("host port must be greater than 0 and less than 65535")
+		}
+	} else {
+		return nil, fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
+	}
+	if len(ports) == 2 {
+		if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
+			pm.ContainerPort = int(n)
+			if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
+				return nil, fmt.Errorf("container port must be greater than 0 and less than 65535")
+			}
+		} else {
+			return nil, fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
+		}
+	} else {
+		pm.ContainerPort = pm.HostPort
+	}
+	return pm, nil
+}
+
 // SetArgs affects arguments to corresponding network plugins
 func (m *Setup) SetArgs(args []string) error {
 	if len(m.networks) < 1 {
@@ -269,39 +310,12 @@ func (m *Setup) SetArgs(args []string) error {
 			key := kv[0]
 			value := kv[1]
 			if key == "portmap" {
-				pm := &PortMapEntry{}
-
-				splittedPort := strings.SplitN(value, "/", 2)
-				if len(splittedPort) != 2 {
+				if !strings.Contains(value, "/") {
 					return fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
 				}
-				pm.Protocol = splittedPort[1]
-				if pm.Protocol != "tcp" && pm.Protocol != "udp" {
-					return fmt.Errorf("only tcp and udp protocol can be specified")
-				}
-				ports := strings.Split(splittedPort[0], ":")
-				if len(ports) != 1 && len(ports) != 2 {
-					return fmt.Errorf("portmap port argument is badly formatted")
-				}
-				if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
-					pm.HostPort = int(n)
-					if pm.HostPort <= 0 || pm.HostPort > 65535 {
-						return fmt.Errorf("host port must be greater than 0 and less than 65535")
-					}
-				} else {
-					return fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
-				}
-				if len(ports) == 2 {
-					if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
-						pm.ContainerPort = int(n)
-						if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
-							return fmt.Errorf("container port must be greater than 0 and less than 65535")
-						}
-					} else {
-						return fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
-					}
-				} else {
-					pm.ContainerPort = pm.HostPort
+				pm, err := ParsePortMap(value)
+				if err != nil {
+					return err
 				}
 				if err := m.SetCapability(networkName, "portMappings", *pm); err != nil {
 					return err
@@ -460,20 +474,33 @@ func (m *Setup) command(command string) error {
 		for i := 0; i < len(m.networkConfList); i++ {
 			var err error
 			if m.result[i], err = config.AddNetworkList(ctx, m.networkConfList[i], m.runtimeConf[i]); err != nil {
-				for j := i - 1; j >= 0; j-- {
-					if err := config.DelNetworkList(ctx, m.networkConfList[j], m.runtimeConf[j]); err != nil {
-						return err
-					}
+				// the failing network may be partially configured (eg: port
+				// mappings rules), so it's torn down with the previous ones
+				if delErr := m.delNetworks(ctx, config, i); delErr != nil {
+					sylog.Warningf("Failed to tear down networks: %s", delErr)
 				}
 				return err
 			}
 		}
 	} else if command == "DEL" {
-		for i := 0; i < len(m.networkConfList); i++ {
-			if err := config.DelNetworkList(ctx, m.networkConfList[i], m.runtimeConf[i]); err != nil {
-				return err
+		return m.delNetworks(ctx, config, len(m.networkConfList)-1)
+	}
+	return nil
+}
+
+// delNetworks tears down networks from index last to the first one, it
+// continues on error to not leave port mappings rules of the remaining
+// networks behind and returns the first error encountered.
+func (m *Setup) delNetworks(ctx context.Context, config *libcni.CNIConfig, last int) error {
+	var firstErr error
+
+	for i := last; i >= 0; i-- {
+		if err := config.DelNetworkList(ctx, m.networkConfList[i], m.runtimeConf[i]); err != nil {
+			sylog.Debugf("Failed to tear down network %s: %s", m.networks[i], err)
+			if firstErr == nil {
+				firstErr = err
 			}
 		}
 	}
-	return nil
+	return firstErr
 }
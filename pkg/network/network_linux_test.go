@@ -287,6 +287,32 @@ func testSetArgs(setup *Setup, t *testing.T) {
 	}
 }
 
+func TestParsePortMap(t *testing.T) {
+	testPorts := []struct {
+		value    string
+		expected *PortMapEntry
+	}{
+		{"8080", &PortMapEntry{HostPort: 8080, ContainerPort: 8080, Protocol: "tcp"}},
+		{"8080:80", &PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}},
+		{"8080:80/udp", &PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "udp"}},
+		{"", nil},
+		{"8080:80/icmp", nil},
+		{"8080:0", nil},
+		{"8080:80:80", nil},
+		{"70000:80", nil},
+	}
+	for _, p := range testPorts {
+		pm, err := ParsePortMap(p.value)
+		if err != nil && p.expected != nil {
+			t.Errorf("unexpected failure for %q: %s", p.value, err)
+		} else if err == nil && p.expected == nil {
+			t.Errorf("unexpected success for %q", p.value)
+		} else if p.expected != nil && !reflect.DeepEqual(pm, p.expected) {
+			t.Errorf("got %+v for %q, expected %+v", pm, p.value, p.expected)
+		}
+	}
+}
+
 func TestNewSetup(t *testing.T) {
 	test.EnsurePrivilege(t)
 
@@ -0,0 +1,18 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+// ImageDriverHook allows a plugin to provide an image driver replacing the
+// runtime engine mount of some image filesystems. The driver is used when
+// its name is set with the "image driver" directive of singularity.conf.
+type ImageDriverHook struct {
+	Name   string
+	Driver image.Driver
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+// MountSpec describes a mount performed by the runtime engine while
+// setting up the container.
+type MountSpec struct {
+	// Source is the bind mounted path, the image file or the
+	// filesystem name
+	Source string
+	// Destination is the mount point in the container, or in the
+	// container session directory for image and layout mounts
+	Destination string
+	// Type is the filesystem type, empty for bind mounts
+	Type string
+	// Options are the mount options like in fstab, bind mounts have
+	// the bind option and remounts have the remount option
+	Options []string
+}
+
+// MountCallbackFn is the callback function type for mount hooks. It takes
+// a pointer to the mount about to be performed, or performed, by the runtime
+// engine. A pre-mount callback can modify the mount, returning an error
+// vetoes the mount and aborts the container creation.
+type MountCallbackFn func(*MountSpec) error
+
+// MountHook allows a plugin to be called before and after each mount of
+// the container setup, for example to enforce site policies on bind mounts.
+// Callbacks are executed by the runtime engine with its privileges, hooks
+// are called in registration order and either callback may be nil. Hooks
+// are only called when "plugin mount hooks" is enabled in singularity.conf.
+type MountHook struct {
+	Name      string
+	PreMount  MountCallbackFn
+	PostMount MountCallbackFn
+}
@@ -11,4 +11,6 @@ type HookRegistration interface {
 	RegisterStringFlag(StringFlagHook) error
 	RegisterBoolFlag(BoolFlagHook) error
 	RegisterCommand(CommandHook) error
+	RegisterImageDriver(ImageDriverHook) error
+	RegisterMountHook(MountHook) error
 }
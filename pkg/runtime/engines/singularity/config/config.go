@@ -7,6 +7,8 @@ package singularity
 
 import (
 	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/util/bind"
+	"github.com/sylabs/singularity/pkg/util/crypt"
 )
 
 // Name is the name of the runtime.
@@ -32,10 +34,21 @@ type FileConfig struct {
 	AllowContainerSquashfs  bool     `default:"yes" authorized:"yes,no" directive:"allow container squashfs"`
 	AllowContainerExtfs     bool     `default:"yes" authorized:"yes,no" directive:"allow container extfs"`
 	AllowContainerDir       bool     `default:"yes" authorized:"yes,no" directive:"allow container dir"`
+	AllowContainerErofs     bool     `default:"yes" authorized:"yes,no" directive:"allow container erofs"`
 	AlwaysUseNv             bool     `default:"no" authorized:"yes,no" directive:"always use nv"`
+	AlwaysUseRocm           bool     `default:"no" authorized:"yes,no" directive:"always use rocm"`
 	SharedLoopDevices       bool     `default:"no" authorized:"yes,no" directive:"shared loop devices"`
+	SessiondirAutoSize      bool     `default:"yes" authorized:"yes,no" directive:"sessiondir auto size"`
+	AllowRootfsInRAM        bool     `default:"yes" authorized:"yes,no" directive:"allow rootfs in ram"`
 	MaxLoopDevices          uint     `default:"256" directive:"max loop devices"`
 	SessiondirMaxSize       uint     `default:"16" directive:"sessiondir max size"`
+	RootfsInRAMMaxSize      uint     `default:"0" directive:"rootfs in ram max size"`
+	CacheMaxSize            uint     `default:"0" directive:"cache max size"`
+	CacheMaxAge             uint     `default:"0" directive:"cache max age"`
+	CacheLibraryMaxSize     uint     `default:"0" directive:"cache library max size"`
+	CacheOciMaxSize         uint     `default:"0" directive:"cache oci max size"`
+	CacheShubMaxSize        uint     `default:"0" directive:"cache shub max size"`
+	MksquashfsProcs         uint     `default:"0" directive:"mksquashfs procs"`
 	MountDev                string   `default:"yes" authorized:"yes,no,minimal" directive:"mount dev"`
 	EnableOverlay           string   `default:"try" authorized:"yes,no,try" directive:"enable overlay"`
 	BindPath                []string `default:"/etc/localtime,/etc/hosts" directive:"bind path"`
@@ -43,12 +56,41 @@ type FileConfig struct {
 	LimitContainerGroups    []string `directive:"limit container groups"`
 	LimitContainerPaths     []string `directive:"limit container paths"`
 	AutofsBugPath           []string `directive:"autofs bug path"`
+	ExecAgentUsers          []string `directive:"exec agent users"`
+	KeyBundleSigner         []string `directive:"key bundle signer"`
+	OciHooksDir             []string `directive:"oci hooks dir"`
+	PreMountHook            []string `directive:"pre mount hook"`
+	PostMountHook           []string `directive:"post mount hook"`
 	RootDefaultCapabilities string   `default:"full" authorized:"full,file,no" directive:"root default capabilities"`
 	MemoryFSType            string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
+	MksquashfsComp          string   `default:"gzip" authorized:"gzip,lzo,lz4,xz,zstd" directive:"mksquashfs comp"`
+	ComposefsVerity         string   `default:"off" authorized:"off,on,require" directive:"composefs verity"`
+	SifVerity               string   `default:"yes" authorized:"yes,no,require" directive:"sif verity"`
+	ComposefsStore          string   `directive:"composefs store"`
+	ComposefsStoreHash      string   `directive:"composefs store hash"`
+	ComposefsStoreRootHash  string   `directive:"composefs store root hash"`
+	SessiondirPath          string   `directive:"sessiondir path"`
 	CniConfPath             string   `directive:"cni configuration path"`
 	CniPluginPath           string   `directive:"cni plugin path"`
 	MksquashfsPath          string   `directive:"mksquashfs path"`
+	MksquashfsBlockSize     string   `directive:"mksquashfs block size"`
 	CryptsetupPath          string   `directive:"cryptsetup path"`
+	VeritysetupPath         string   `directive:"veritysetup path"`
+	ImageDriver             string   `directive:"image driver"`
+	PluginMountHooks        bool     `default:"no" authorized:"yes,no" directive:"plugin mount hooks"`
+}
+
+// JoinConfig describes the namespaces of a running process joined by
+// the container instead of creating them.
+type JoinConfig struct {
+	// Pid is the process whose namespaces are joined
+	Pid int `json:"pid"`
+	// Instance is the name of the instance whose process is
+	// joined, empty when the process is designated by its PID
+	Instance string `json:"instance,omitempty"`
+	// Namespaces lists the joined namespaces among net, ipc, uts,
+	// mount and pid
+	Namespaces []string `json:"namespaces"`
 }
 
 // JSONConfig stores engine specific confguration that is allowed to be set by the user
@@ -56,11 +98,19 @@ type JSONConfig struct {
 	ScratchDir        []string      `json:"scratchdir,omitempty"`
 	OverlayImage      []string      `json:"overlayImage,omitempty"`
 	BindPath          []string      `json:"bindpath,omitempty"`
+	Mounts            []bind.Mount  `json:"mounts,omitempty"`
 	NetworkArgs       []string      `json:"networkArgs,omitempty"`
+	Publish           []string      `json:"publish,omitempty"`
+	AddHosts          []string      `json:"addHosts,omitempty"`
 	Security          []string      `json:"security,omitempty"`
 	LibrariesPath     []string      `json:"librariesPath,omitempty"`
+	NvDevices         []string      `json:"nvDevices,omitempty"`
+	StartArgs         []string      `json:"startArgs,omitempty"`
+	StartEnv          []string      `json:"startEnv,omitempty"`
 	ImageList         []image.Image `json:"imageList,omitempty"`
 	OpenFd            []int         `json:"openFd,omitempty"`
+	OutputStreams     [2]int        `json:"outputStreams"`
+	ErrorStreams      [2]int        `json:"errorStreams"`
 	TargetGID         []int         `json:"targetGID,omitempty"`
 	Image             string        `json:"image"`
 	Workdir           string        `json:"workdir,omitempty"`
@@ -75,13 +125,26 @@ type JSONConfig struct {
 	Hostname          string        `json:"hostname,omitempty"`
 	Network           string        `json:"network,omitempty"`
 	DNS               string        `json:"dns,omitempty"`
+	DNSSearch         string        `json:"dnsSearch,omitempty"`
+	ResolvConf        string        `json:"resolvConf,omitempty"`
 	Cwd               string        `json:"cwd,omitempty"`
+	MPIABI            string        `json:"mpiABI,omitempty"`
+	RestoreDir        string        `json:"restoreDir,omitempty"`
+	HealthOnFailure   string        `json:"healthOnFailure,omitempty"`
+	LogFormat         string        `json:"logFormat,omitempty"`
+	LogMaxSize        int64         `json:"logMaxSize,omitempty"`
+	LogMaxFiles       int           `json:"logMaxFiles,omitempty"`
 	EncryptionKey     []byte        `json:"encryptionKey,omitempty"`
+	EncryptionKeyInfo *crypt.KeyInfo      `json:"encryptionKeyInfo,omitempty"`
+	VerityRootHash    string        `json:"verityRootHash,omitempty"`
+	Join              *JoinConfig   `json:"join,omitempty"`
 	TargetUID         int           `json:"targetUID,omitempty"`
 	WritableImage     bool          `json:"writableImage,omitempty"`
 	WritableTmpfs     bool          `json:"writableTmpfs,omitempty"`
+	RootfsInRAM       bool          `json:"rootfsInRAM,omitempty"`
 	Contain           bool          `json:"container,omitempty"`
 	Nv                bool          `json:"nv,omitempty"`
+	Rocm              bool          `json:"rocm,omitempty"`
 	CustomHome        bool          `json:"customHome,omitempty"`
 	Instance          bool          `json:"instance,omitempty"`
 	InstanceJoin      bool          `json:"instanceJoin,omitempty"`
@@ -91,10 +154,14 @@ type JSONConfig struct {
 	KeepPrivs         bool          `json:"keepPrivs,omitempty"`
 	NoPrivs           bool          `json:"noPrivs,omitempty"`
 	NoHome            bool          `json:"noHome,omitempty"`
+	NoHostnameFile    bool          `json:"noHostnameFile,omitempty"`
 	NoInit            bool          `json:"noInit,omitempty"`
+	Init              bool          `json:"init,omitempty"`
 	DeleteImage       bool          `json:"deleteImage,omitempty"`
 	Fakeroot          bool          `json:"fakeroot,omitempty"`
 	SignalPropagation bool          `json:"signalPropagation,omitempty"`
+	NoHealthcheck     bool          `json:"noHealthcheck,omitempty"`
+	ExecAgent         bool          `json:"execAgent,omitempty"`
 }
 
 // SetImage sets the container image path to be used by EngineConfig.JSON.
@@ -117,6 +184,18 @@ func (e *EngineConfig) GetEncryptionKey() []byte {
 	return e.JSON.EncryptionKey
 }
 
+// SetEncryptionKeyInfo sets the key material used to retrieve the key
+// for the image's system partition.
+func (e *EngineConfig) SetEncryptionKeyInfo(info *crypt.KeyInfo) {
+	e.JSON.EncryptionKeyInfo = info
+}
+
+// GetEncryptionKeyInfo retrieves the key material for the image's
+// system partition.
+func (e *EngineConfig) GetEncryptionKeyInfo() *crypt.KeyInfo {
+	return e.JSON.EncryptionKeyInfo
+}
+
 // SetWritableImage defines the container image as writable or not.
 func (e *EngineConfig) SetWritableImage(writable bool) {
 	e.JSON.WritableImage = writable
@@ -157,6 +236,26 @@ func (e *EngineConfig) GetNv() bool {
 	return e.JSON.Nv
 }
 
+// SetRocm sets rocm flag to bind ROCm libraries into container.
+func (e *EngineConfig) SetRocm(rocm bool) {
+	e.JSON.Rocm = rocm
+}
+
+// GetRocm returns if rocm flag is set or not.
+func (e *EngineConfig) GetRocm() bool {
+	return e.JSON.Rocm
+}
+
+// SetNvDevices sets the NVIDIA devices added to the container /dev.
+func (e *EngineConfig) SetNvDevices(devices []string) {
+	e.JSON.NvDevices = devices
+}
+
+// GetNvDevices returns the NVIDIA devices added to the container /dev.
+func (e *EngineConfig) GetNvDevices() []string {
+	return e.JSON.NvDevices
+}
+
 // SetWorkdir sets a work directory path.
 func (e *EngineConfig) SetWorkdir(name string) {
 	e.JSON.Workdir = name
@@ -217,6 +316,16 @@ func (e *EngineConfig) GetBindPath() []string {
 	return e.JSON.BindPath
 }
 
+// SetMounts sets the mounts requested with --mount.
+func (e *EngineConfig) SetMounts(mounts []bind.Mount) {
+	e.JSON.Mounts = mounts
+}
+
+// GetMounts retrieves the mounts requested with --mount.
+func (e *EngineConfig) GetMounts() []bind.Mount {
+	return e.JSON.Mounts
+}
+
 // SetCommand sets action command to execute.
 func (e *EngineConfig) SetCommand(command string) {
 	e.JSON.Command = command
@@ -277,6 +386,18 @@ func (e *EngineConfig) GetBootInstance() bool {
 	return e.JSON.BootInstance
 }
 
+// SetRestoreDir sets the checkpoint directory the instance
+// process tree is restored from.
+func (e *EngineConfig) SetRestoreDir(dir string) {
+	e.JSON.RestoreDir = dir
+}
+
+// GetRestoreDir returns the checkpoint directory the instance
+// process tree is restored from.
+func (e *EngineConfig) GetRestoreDir() string {
+	return e.JSON.RestoreDir
+}
+
 // SetAddCaps sets bounding/effective/permitted/inheritable/ambient capabilities to add.
 func (e *EngineConfig) SetAddCaps(caps string) {
 	e.JSON.AddCaps = caps
@@ -357,6 +478,17 @@ func (e *EngineConfig) GetNoInit() bool {
 	return e.JSON.NoInit
 }
 
+// SetInit sets init flag to start the shim init process as
+// a subreaper even without PID namespace
+func (e *EngineConfig) SetInit(val bool) {
+	e.JSON.Init = val
+}
+
+// GetInit returns if init flag is set or not
+func (e *EngineConfig) GetInit() bool {
+	return e.JSON.Init
+}
+
 // SetNetwork sets a list of commas separated networks to configure inside container
 func (e *EngineConfig) SetNetwork(network string) {
 	e.JSON.Network = network
@@ -377,6 +509,17 @@ func (e *EngineConfig) GetNetworkArgs() []string {
 	return e.JSON.NetworkArgs
 }
 
+// SetPublish sets the host ports published to the container with
+// the form hostPort[:containerPort][/protocol]
+func (e *EngineConfig) SetPublish(ports []string) {
+	e.JSON.Publish = ports
+}
+
+// GetPublish retrieves the host ports published to the container
+func (e *EngineConfig) GetPublish() []string {
+	return e.JSON.Publish
+}
+
 // SetDNS sets a commas separated list of DNS servers to add in resolv.conf
 func (e *EngineConfig) SetDNS(dns string) {
 	e.JSON.DNS = dns
@@ -387,6 +530,51 @@ func (e *EngineConfig) GetDNS() string {
 	return e.JSON.DNS
 }
 
+// SetDNSSearch sets a commas separated list of search domains to set in resolv.conf
+func (e *EngineConfig) SetDNSSearch(domains string) {
+	e.JSON.DNSSearch = domains
+}
+
+// GetDNSSearch retrieves list of search domains
+func (e *EngineConfig) GetDNSSearch() string {
+	return e.JSON.DNSSearch
+}
+
+// SetResolvConf sets the resolv.conf content used in place of the
+// host resolv.conf
+func (e *EngineConfig) SetResolvConf(content string) {
+	e.JSON.ResolvConf = content
+}
+
+// GetResolvConf retrieves the resolv.conf content used in place of
+// the host resolv.conf
+func (e *EngineConfig) GetResolvConf() string {
+	return e.JSON.ResolvConf
+}
+
+// SetAddHosts sets the host entries with the form name:ip to add
+// in /etc/hosts
+func (e *EngineConfig) SetAddHosts(hosts []string) {
+	e.JSON.AddHosts = hosts
+}
+
+// GetAddHosts retrieves the host entries to add in /etc/hosts
+func (e *EngineConfig) GetAddHosts() []string {
+	return e.JSON.AddHosts
+}
+
+// SetNoHostnameFile sets if the container hostname is not written
+// to /etc/hostname
+func (e *EngineConfig) SetNoHostnameFile(val bool) {
+	e.JSON.NoHostnameFile = val
+}
+
+// GetNoHostnameFile returns if the container hostname is not written
+// to /etc/hostname
+func (e *EngineConfig) GetNoHostnameFile() bool {
+	return e.JSON.NoHostnameFile
+}
+
 // SetImageList sets image list containing opened images
 func (e *EngineConfig) SetImageList(list []image.Image) {
 	e.JSON.ImageList = list
@@ -397,6 +585,18 @@ func (e *EngineConfig) GetImageList() []image.Image {
 	return e.JSON.ImageList
 }
 
+// SetVerityRootHash sets the dm-verity root hash of the root filesystem
+// image covered by a verified signature.
+func (e *EngineConfig) SetVerityRootHash(rootHash string) {
+	e.JSON.VerityRootHash = rootHash
+}
+
+// GetVerityRootHash returns the dm-verity root hash of the root filesystem
+// image covered by a verified signature.
+func (e *EngineConfig) GetVerityRootHash() string {
+	return e.JSON.VerityRootHash
+}
+
 // SetCwd sets current working directory
 func (e *EngineConfig) SetCwd(path string) {
 	e.JSON.Cwd = path
@@ -427,6 +627,18 @@ func (e *EngineConfig) GetWritableTmpfs() bool {
 	return e.JSON.WritableTmpfs
 }
 
+// SetRootfsInRAM sets flag to copy the container root filesystem
+// in memory before execution
+func (e *EngineConfig) SetRootfsInRAM(inRAM bool) {
+	e.JSON.RootfsInRAM = inRAM
+}
+
+// GetRootfsInRAM returns if the container root filesystem is copied
+// in memory or not
+func (e *EngineConfig) GetRootfsInRAM() bool {
+	return e.JSON.RootfsInRAM
+}
+
 // SetSecurity sets security feature arguments
 func (e *EngineConfig) SetSecurity(security []string) {
 	e.JSON.Security = security
@@ -479,6 +691,18 @@ func (e *EngineConfig) GetLibrariesPath() []string {
 	return e.JSON.LibrariesPath
 }
 
+// SetMPIABI sets the host MPI library soname the container MPI
+// library must be compatible with
+func (e *EngineConfig) SetMPIABI(abi string) {
+	e.JSON.MPIABI = abi
+}
+
+// GetMPIABI returns the host MPI library soname the container MPI
+// library must be compatible with
+func (e *EngineConfig) GetMPIABI() string {
+	return e.JSON.MPIABI
+}
+
 // SetFakeroot sets fakeroot flag
 func (e *EngineConfig) SetFakeroot(fakeroot bool) {
 	e.JSON.Fakeroot = fakeroot
@@ -512,3 +736,100 @@ func (e *EngineConfig) SetSignalPropagation(propagation bool) {
 func (e *EngineConfig) GetSignalPropagation() bool {
 	return e.JSON.SignalPropagation
 }
+
+// SetNoHealthcheck sets if the image healthcheck of an instance is disabled
+func (e *EngineConfig) SetNoHealthcheck(disable bool) {
+	e.JSON.NoHealthcheck = disable
+}
+
+// GetNoHealthcheck returns if the image healthcheck of an instance is disabled
+func (e *EngineConfig) GetNoHealthcheck() bool {
+	return e.JSON.NoHealthcheck
+}
+
+// SetExecAgent sets if the instance serves an exec agent spawning
+// processes in the container namespaces
+func (e *EngineConfig) SetExecAgent(agent bool) {
+	e.JSON.ExecAgent = agent
+}
+
+// GetExecAgent returns if the instance serves an exec agent
+func (e *EngineConfig) GetExecAgent() bool {
+	return e.JSON.ExecAgent
+}
+
+// SetHealthOnFailure sets the action taken when an instance becomes unhealthy
+func (e *EngineConfig) SetHealthOnFailure(action string) {
+	e.JSON.HealthOnFailure = action
+}
+
+// GetHealthOnFailure returns the action taken when an instance becomes unhealthy
+func (e *EngineConfig) GetHealthOnFailure() string {
+	return e.JSON.HealthOnFailure
+}
+
+// SetStartCommand sets the command line and the environment of the
+// command starting an instance, used to restart it
+func (e *EngineConfig) SetStartCommand(args []string, env []string) {
+	e.JSON.StartArgs = args
+	e.JSON.StartEnv = env
+}
+
+// GetStartCommand returns the command line and the environment of
+// the command starting an instance
+func (e *EngineConfig) GetStartCommand() ([]string, []string) {
+	return e.JSON.StartArgs, e.JSON.StartEnv
+}
+
+// SetLogFormat sets the format of the structured log of an instance,
+// an empty format keeps the instance output in plain log files
+func (e *EngineConfig) SetLogFormat(format string) {
+	e.JSON.LogFormat = format
+}
+
+// GetLogFormat returns the format of the structured log of an instance
+func (e *EngineConfig) GetLogFormat() string {
+	return e.JSON.LogFormat
+}
+
+// SetLogRotation sets the size in bytes after which the structured log
+// of an instance is rotated and the number of rotated files kept
+func (e *EngineConfig) SetLogRotation(maxSize int64, maxFiles int) {
+	e.JSON.LogMaxSize = maxSize
+	e.JSON.LogMaxFiles = maxFiles
+}
+
+// GetLogRotation returns the size in bytes after which the structured
+// log of an instance is rotated and the number of rotated files kept
+func (e *EngineConfig) GetLogRotation() (int64, int) {
+	return e.JSON.LogMaxSize, e.JSON.LogMaxFiles
+}
+
+// SetLogStreams sets the read and write ends of the pipes carrying the
+// output and error streams of the instance process to the logger
+func (e *EngineConfig) SetLogStreams(stdout [2]int, stderr [2]int) {
+	e.JSON.OutputStreams = stdout
+	e.JSON.ErrorStreams = stderr
+}
+
+// GetLogStreams returns the read and write ends of the pipes carrying
+// the output and error streams of the instance process to the logger
+func (e *EngineConfig) GetLogStreams() ([2]int, [2]int) {
+	return e.JSON.OutputStreams, e.JSON.ErrorStreams
+}
+
+// SetJoin sets the process whose namespaces are joined by the container,
+// the name of its instance if any and the list of joined namespaces
+func (e *EngineConfig) SetJoin(pid int, instance string, namespaces []string) {
+	e.JSON.Join = &JoinConfig{
+		Pid:        pid,
+		Instance:   instance,
+		Namespaces: namespaces,
+	}
+}
+
+// GetJoin returns the namespaces joined by the container or nil if
+// the container creates its own namespaces
+func (e *EngineConfig) GetJoin() *JoinConfig {
+	return e.JSON.Join
+}
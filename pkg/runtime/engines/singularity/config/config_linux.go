@@ -21,13 +21,17 @@ import (
 
 // EngineConfig stores both the JSONConfig and the FileConfig
 type EngineConfig struct {
-	JSON      *JSONConfig                `json:"jsonConfig"`
-	OciConfig *oci.Config                `json:"ociConfig"`
-	File      *FileConfig                `json:"-"`
-	Network   *network.Setup             `json:"-"`
-	Cgroups   *cgroups.Manager           `json:"-"`
-	CryptDev  string                     `json:"-"`
-	Plugin    map[string]json.RawMessage `json:"plugin"` // Plugin is the raw JSON representation of the plugin configurations
+	JSON              *JSONConfig                `json:"jsonConfig"`
+	OciConfig         *oci.Config                `json:"ociConfig"`
+	File              *FileConfig                `json:"-"`
+	Network           *network.Setup             `json:"-"`
+	Cgroups           *cgroups.Manager           `json:"-"`
+	CryptDev          string                     `json:"-"`
+	SessionDir        string                     `json:"-"`
+	FuseConnections   []uint32                   `json:"-"`      // FuseConnections are the FUSE helpers connections aborted on cleanup
+	FusePids          []int                      `json:"-"`      // FusePids are the FUSE helpers PIDs terminated on cleanup
+	ImageDriverMounts []string                   `json:"-"`      // ImageDriverMounts are the targets mounted by the image driver
+	Plugin            map[string]json.RawMessage `json:"plugin"` // Plugin is the raw JSON representation of the plugin configurations
 }
 
 // FuseInfo stores the FUSE-related information required or provided by
@@ -0,0 +1,202 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	pkcs11Scheme = "pkcs11:"
+	kmsScheme    = "kms:"
+	agentScheme  = "agent:"
+)
+
+// fingerprintLen is the length of the OpenPGP fingerprint stored at the
+// beginning of the signature descriptor entity, the key provider metadata
+// is stored after it.
+const fingerprintLen = 20
+
+// providerKeyTime is the creation time of the OpenPGP keys wrapping key
+// provider keys, it's fixed so that the fingerprint of a key provider key
+// is always the same.
+var providerKeyTime = time.Unix(0, 0)
+
+// signatureHash is the hash algorithm used for signatures made with
+// key provider keys.
+var signatureHash = crypto.SHA256
+
+// KeyProvider is a signing key held outside of the local keyring, by a
+// PKCS#11 token, a cloud KMS or a signing agent. The private key never
+// leaves the provider.
+type KeyProvider interface {
+	crypto.Signer
+	// Provider returns the key provider metadata recorded in the signature
+	// descriptor, it identifies the key and must not contain any secret.
+	Provider() string
+}
+
+// NewKeyProvider returns the key provider for a key URI:
+//
+//	pkcs11:<RFC 7512 URI attributes>    key stored in a PKCS#11 token
+//	kms:<helper>/<key id>               key held by singularity-kms-<helper>
+//	agent:<socket path>[#<key id>]      key held by a signing agent
+func NewKeyProvider(uri string) (KeyProvider, error) {
+	switch {
+	case strings.HasPrefix(uri, pkcs11Scheme):
+		return newPKCS11Provider(uri)
+	case strings.HasPrefix(uri, kmsScheme):
+		return newKMSProvider(uri)
+	case strings.HasPrefix(uri, agentScheme):
+		return newAgentProvider(uri)
+	}
+	return nil, fmt.Errorf("unsupported key URI %q: must start with %s, %s or %s", uri, pkcs11Scheme, kmsScheme, agentScheme)
+}
+
+// parsePublicKey parses a DER encoded PKIX or PKCS#1 public key, only
+// RSA and ECDSA keys can be used for signing.
+func parsePublicKey(der []byte) (crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		rsaPub, rsaErr := x509.ParsePKCS1PublicKey(der)
+		if rsaErr != nil {
+			return nil, fmt.Errorf("could not parse public key: %s", err)
+		}
+		pub = rsaPub
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// pgpSigner adapts a key provider to the OpenPGP package which expects
+// public keys as values and doesn't pass signer options for ECDSA keys.
+type pgpSigner struct {
+	KeyProvider
+}
+
+func (s pgpSigner) Public() crypto.PublicKey {
+	switch pub := s.KeyProvider.Public().(type) {
+	case *rsa.PublicKey:
+		return *pub
+	case *ecdsa.PublicKey:
+		return *pub
+	}
+	return nil
+}
+
+func (s pgpSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts == nil {
+		opts = signatureHash
+	}
+	return s.KeyProvider.Sign(rand, digest, opts)
+}
+
+// providerKey returns the OpenPGP private key signing with the key
+// provider p.
+func providerKey(p KeyProvider) (*packet.PrivateKey, error) {
+	signer := pgpSigner{p}
+	if signer.Public() == nil {
+		return nil, fmt.Errorf("unsupported public key type %T", p.Public())
+	}
+	key := packet.NewSignerPrivateKey(providerKeyTime, signer)
+	// the fingerprint of RSA keys is computed for the RSA algorithm, the
+	// exported key must be serialized with the same algorithm
+	if key.PubKeyAlgo == packet.PubKeyAlgoRSASignOnly {
+		key.PubKeyAlgo = packet.PubKeyAlgoRSA
+	}
+	return key, nil
+}
+
+// providerEntity returns an OpenPGP entity for the public key of the key
+// provider p, its identity is the key provider metadata.
+func providerEntity(p KeyProvider, pub *packet.PublicKey) *openpgp.Entity {
+	name := p.Provider()
+	primary := true
+
+	return &openpgp.Entity{
+		PrimaryKey: pub,
+		Identities: map[string]*openpgp.Identity{
+			name: {
+				Name:   name,
+				UserId: packet.NewUserId(name, "", ""),
+				SelfSignature: &packet.Signature{
+					SigType:      packet.SigTypePositiveCert,
+					PubKeyAlgo:   pub.PubKeyAlgo,
+					Hash:         signatureHash,
+					CreationTime: providerKeyTime,
+					IssuerKeyId:  &pub.KeyId,
+					FlagsValid:   true,
+					FlagSign:     true,
+					IsPrimaryId:  &primary,
+				},
+			},
+		},
+	}
+}
+
+// ExportProviderKey writes the OpenPGP public key of the key provider
+// referenced by keyURI to kpath, the identity is self-signed by the key
+// provider. Once imported with 'key import' or added to a key bundle,
+// signatures are verified without access to the key provider.
+func ExportProviderKey(keyURI, kpath string, armored bool) error {
+	p, err := NewKeyProvider(keyURI)
+	if err != nil {
+		return err
+	}
+
+	key, err := providerKey(p)
+	if err != nil {
+		return err
+	}
+
+	entity := providerEntity(p, &key.PublicKey)
+	for name, id := range entity.Identities {
+		if err := id.SelfSignature.SignUserId(name, &key.PublicKey, key, &packet.Config{DefaultHash: signatureHash}); err != nil {
+			return fmt.Errorf("could not self-sign key provider identity: %s", err)
+		}
+	}
+
+	file, err := os.Create(kpath)
+	if err != nil {
+		return fmt.Errorf("unable to create file: %v", err)
+	}
+	defer file.Close()
+
+	if armored {
+		w, err := armor.Encode(file, openpgp.PublicKeyType, nil)
+		if err != nil {
+			return fmt.Errorf("unable to serialize public key: %v", err)
+		}
+		if err := entity.Serialize(w); err != nil {
+			return fmt.Errorf("unable to serialize public key: %v", err)
+		}
+		err = w.Close()
+	} else {
+		err = entity.Serialize(file)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to serialize public key: %v", err)
+	}
+	fmt.Printf("Public key with fingerprint %X correctly exported to file: %s\n", key.Fingerprint, kpath)
+
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// kmsHelperPrefix is the prefix of the helper programs signing with
+// cloud KMS keys, kms:<name>/<key id> runs singularity-kms-<name>.
+const kmsHelperPrefix = "singularity-kms-"
+
+// hashNames maps the hash algorithms to their names in helper requests.
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// HelperRequest is a request sent to KMS helpers on their standard input
+// and to signing agents over their socket.
+type HelperRequest struct {
+	// Op is either "public" to get the public key or "sign" to sign
+	// a digest
+	Op string `json:"op"`
+	// Key is the key ID given in the key URI
+	Key string `json:"key,omitempty"`
+	// Hash is the name of the hash algorithm of the digest to sign
+	Hash string `json:"hash,omitempty"`
+	// Digest is the digest to sign
+	Digest []byte `json:"digest,omitempty"`
+}
+
+// HelperResponse is the response of KMS helpers and signing agents.
+type HelperResponse struct {
+	// PublicKey is the DER encoded PKIX public key
+	PublicKey []byte `json:"public_key,omitempty"`
+	// Signature is the PKCS#1 v1.5 signature for RSA keys or
+	// the ASN.1 signature for ECDSA keys
+	Signature []byte `json:"signature,omitempty"`
+	// Error reports why the request failed
+	Error string `json:"error,omitempty"`
+}
+
+// helperProvider signs with a key held by a KMS helper or a signing agent,
+// call sends a request and returns its response.
+type helperProvider struct {
+	provider string
+	key      string
+	pub      crypto.PublicKey
+	call     func(req *HelperRequest) (*HelperResponse, error)
+}
+
+func newHelperProvider(provider, key string, call func(*HelperRequest) (*HelperResponse, error)) (*helperProvider, error) {
+	p := &helperProvider{provider: provider, key: key, call: call}
+
+	resp, err := p.request(&HelperRequest{Op: "public", Key: key})
+	if err != nil {
+		return nil, fmt.Errorf("could not get public key from %s: %s", provider, err)
+	}
+	if p.pub, err = parsePublicKey(resp.PublicKey); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *helperProvider) request(req *HelperRequest) (*HelperResponse, error) {
+	resp, err := p.call(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp, nil
+}
+
+func (p *helperProvider) Public() crypto.PublicKey {
+	return p.pub
+}
+
+func (p *helperProvider) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, ok := hashNames[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm for %s signature", p.provider)
+	}
+
+	resp, err := p.request(&HelperRequest{Op: "sign", Key: p.key, Hash: hash, Digest: digest})
+	if err != nil {
+		return nil, fmt.Errorf("%s signature failed: %s", p.provider, err)
+	}
+	return resp.Signature, nil
+}
+
+func (p *helperProvider) Provider() string {
+	return p.provider
+}
+
+// newKMSProvider returns the provider for a kms:<helper>/<key id> URI, the
+// helper program receives a request on its standard input and writes the
+// response on its standard output.
+func newKMSProvider(uri string) (*helperProvider, error) {
+	ref := strings.SplitN(strings.TrimPrefix(uri, kmsScheme), "/", 2)
+	if len(ref) != 2 || ref[0] == "" || ref[1] == "" {
+		return nil, fmt.Errorf("KMS key URI must be of the form kms:<helper>/<key id>")
+	}
+
+	helper, err := exec.LookPath(kmsHelperPrefix + ref[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not find KMS helper: %s", err)
+	}
+
+	call := func(req *HelperRequest) (*HelperResponse, error) {
+		in, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var stdout, stderr bytes.Buffer
+
+		cmd := exec.Command(helper)
+		cmd.Stdin = bytes.NewReader(in)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		sylog.Debugf("Sending %s request to KMS helper %s", req.Op, helper)
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%s failed: %s: %s", helper, strings.TrimSpace(stderr.String()), err)
+		}
+
+		resp := new(HelperResponse)
+		if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+			return nil, fmt.Errorf("could not decode %s response: %s", helper, err)
+		}
+		return resp, nil
+	}
+
+	return newHelperProvider(uri, ref[1], call)
+}
+
+// newAgentProvider returns the provider for an agent:<socket path>[#<key id>]
+// URI, each request is sent as a JSON object over a new connection to the
+// agent unix socket which replies with a JSON object.
+func newAgentProvider(uri string) (*helperProvider, error) {
+	socket := strings.TrimPrefix(uri, agentScheme)
+	key := ""
+	if i := strings.IndexByte(socket, '#'); i >= 0 {
+		socket, key = socket[:i], socket[i+1:]
+	}
+	if socket == "" {
+		return nil, fmt.Errorf("agent key URI must be of the form agent:<socket path>[#<key id>]")
+	}
+
+	call := func(req *HelperRequest) (*HelperResponse, error) {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to signing agent: %s", err)
+		}
+		defer conn.Close()
+
+		sylog.Debugf("Sending %s request to signing agent %s", req.Op, socket)
+		if err := json.NewEncoder(conn).Encode(req); err != nil {
+			return nil, fmt.Errorf("could not send request to signing agent: %s", err)
+		}
+
+		resp := new(HelperResponse)
+		if err := json.NewDecoder(conn).Decode(resp); err != nil {
+			return nil, fmt.Errorf("could not decode signing agent response: %s", err)
+		}
+		return resp, nil
+	}
+
+	// the socket path is local to the signing host, only record the key
+	provider := strings.TrimSuffix(agentScheme, ":")
+	if key != "" {
+		provider = agentScheme + key
+	}
+	return newHelperProvider(provider, key, call)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/util/crypt"
+)
+
+// digestInfoPrefix holds the DER encoded DigestInfo prefixes of PKCS#1 v1.5
+// signatures, the RSA-PKCS mechanism only pads the data it signs.
+var digestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pkcs11Provider signs with a private key stored in a PKCS#11 token
+// through pkcs11-tool.
+type pkcs11Provider struct {
+	uri string
+	pub crypto.PublicKey
+}
+
+func newPKCS11Provider(uri string) (*pkcs11Provider, error) {
+	der, err := crypt.PKCS11Tool(uri, nil, "--read-object", "--type", "pubkey")
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key from PKCS#11 token: %s", err)
+	}
+	pub, err := parsePublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs11Provider{uri: uri, pub: pub}, nil
+}
+
+func (p *pkcs11Provider) Public() crypto.PublicKey {
+	return p.pub
+}
+
+func (p *pkcs11Provider) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := p.pub.(*ecdsa.PublicKey); ok {
+		return crypt.PKCS11Tool(p.uri, digest, "--sign", "--mechanism", "ECDSA", "--signature-format", "openssl")
+	}
+
+	prefix, ok := digestInfoPrefix[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm for PKCS#11 signature")
+	}
+	data := append(append([]byte{}, prefix...), digest...)
+	return crypt.PKCS11Tool(p.uri, data, "--sign", "--mechanism", "RSA-PKCS")
+}
+
+// Provider returns the PKCS#11 URI without its query attributes which
+// hold the module path and the PIN.
+func (p *pkcs11Provider) Provider() string {
+	return strings.SplitN(p.uri, "?", 2)[0]
+}
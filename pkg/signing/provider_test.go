@@ -0,0 +1,386 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !windows
+
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/image"
+	"golang.org/x/crypto/openpgp"
+)
+
+var testHashes = map[string]crypto.Hash{
+	"SHA256": crypto.SHA256,
+	"SHA384": crypto.SHA384,
+	"SHA512": crypto.SHA512,
+}
+
+// testAgent serves the signing agent protocol with an in-memory key.
+func testAgent(t *testing.T, socket string, key crypto.Signer) net.Listener {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("could not listen on %s: %s", socket, err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			req := new(HelperRequest)
+			resp := new(HelperResponse)
+			if err := json.NewDecoder(conn).Decode(req); err != nil {
+				resp.Error = err.Error()
+			} else if req.Op == "public" {
+				resp.PublicKey, err = x509.MarshalPKIXPublicKey(key.Public())
+			} else {
+				resp.Signature, err = key.Sign(rand.Reader, req.Digest, testHashes[req.Hash])
+			}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			json.NewEncoder(conn).Encode(resp)
+			conn.Close()
+		}
+	}()
+
+	return l
+}
+
+func createTestSIF(t *testing.T, dir string, extra ...sif.DescriptorInput) string {
+	path := filepath.Join(dir, "test.sif")
+
+	part := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Fname:    "rootfs",
+		Data:     []byte("test partition"),
+	}
+	part.Size = int64(len(part.Data))
+	if err := part.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)); err != nil {
+		t.Fatalf("could not set partition extra data: %s", err)
+	}
+
+	fimg, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: append([]sif.DescriptorInput{part}, extra...),
+	})
+	if err != nil {
+		t.Fatalf("could not create SIF: %s", err)
+	}
+	fimg.UnloadContainer()
+
+	return path
+}
+
+func TestSignWithProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-provider-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{name: "rsa", key: rsaKey},
+		{name: "ecdsa", key: ecdsaKey},
+	}
+
+	otherSocket := filepath.Join(dir, "other.sock")
+	other := testAgent(t, otherSocket, ecdsaKey)
+	defer other.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket := filepath.Join(dir, tt.name+".sock")
+			l := testAgent(t, socket, tt.key)
+			defer l.Close()
+
+			path := createTestSIF(t, dir)
+			defer os.Remove(path)
+
+			uri := "agent:" + socket + "#" + tt.name
+			if err := SignWithProvider(path, 0, false, uri); err != nil {
+				t.Fatalf("SignWithProvider() failed: %s", err)
+			}
+
+			if _, err := VerifyWithProvider(path, 0, false, uri, false); err != nil {
+				t.Fatalf("VerifyWithProvider() failed: %s", err)
+			}
+
+			out, err := VerifyWithProvider(path, 0, false, "agent:"+otherSocket, true)
+			if tt.name == "ecdsa" {
+				if err != nil {
+					t.Fatalf("VerifyWithProvider() failed with the same key: %s", err)
+				}
+			} else if err != ErrVerificationFail {
+				t.Fatalf("VerifyWithProvider() succeeded with another key")
+			}
+
+			// the key provider is only reported for verified signatures
+			provider := "agent:" + tt.name
+			if err != nil {
+				provider = ""
+			}
+			var keys KeyList
+			if err := json.Unmarshal([]byte(out), &keys); err != nil {
+				t.Fatalf("could not decode JSON output: %s", err)
+			}
+			if len(keys.SignerKeys) != 1 || keys.SignerKeys[0].Signer.Provider != provider {
+				t.Errorf("unexpected key provider reported: %+v", keys.SignerKeys)
+			}
+		})
+	}
+}
+
+func TestSignedText(t *testing.T) {
+	tests := []struct {
+		name      string
+		plaintext string
+		hash      string
+		provider  string
+	}{
+		{
+			name:      "Keyring",
+			plaintext: "SIFHASH:\nabcd\n",
+			hash:      "SIFHASH:\nabcd",
+		},
+		{
+			name:      "Provider",
+			plaintext: "SIFHASH:\nabcd\n" + providerHeader + "kms:gcp/key\n",
+			hash:      "SIFHASH:\nabcd",
+			provider:  "kms:gcp/key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, provider := signedText([]byte(tt.plaintext))
+			if string(hash) != tt.hash || provider != tt.provider {
+				t.Errorf("got %q %q, expected %q %q", hash, provider, tt.hash, tt.provider)
+			}
+		})
+	}
+}
+
+func TestProviderMetadataTampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-provider-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l := testAgent(t, socket, key)
+	defer l.Close()
+
+	path := createTestSIF(t, dir)
+	uri := "agent:" + socket + "#signing"
+	if err := SignWithProvider(path, 0, false, uri); err != nil {
+		t.Fatalf("SignWithProvider() failed: %s", err)
+	}
+
+	// rewrite the unsigned copy of the metadata in the signature descriptor
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entity []byte
+	for _, d := range fimg.DescrArr {
+		if d.Used && d.Datatype == sif.DataSignature {
+			entity, _ = d.GetEntity()
+		}
+	}
+	fimg.UnloadContainer()
+
+	orig := append(append([]byte{}, entity[:fingerprintLen]...), "agent:signing"...)
+	altered := append(append([]byte{}, entity[:fingerprintLen]...), "agent:altered"...)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, orig) {
+		t.Fatalf("key provider metadata not found in signature descriptor")
+	}
+	if err := ioutil.WriteFile(path, bytes.Replace(b, orig, altered, 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := VerifyWithProvider(path, 0, false, uri, false)
+	if err != ErrVerificationFail {
+		t.Fatalf("VerifyWithProvider() succeeded with altered key provider metadata")
+	}
+	if !strings.Contains(out, "key provider metadata differs") {
+		t.Errorf("altered key provider metadata not reported: %s", out)
+	}
+}
+
+func TestExportProviderKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-provider-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l := testAgent(t, socket, key)
+	defer l.Close()
+
+	path := createTestSIF(t, dir)
+	uri := "agent:" + socket + "#signing"
+	if err := SignWithProvider(path, 0, false, uri); err != nil {
+		t.Fatalf("SignWithProvider() failed: %s", err)
+	}
+
+	for _, armored := range []bool{false, true} {
+		kpath := filepath.Join(dir, "public.key")
+		if err := ExportProviderKey(uri, kpath, armored); err != nil {
+			t.Fatalf("ExportProviderKey() failed: %s", err)
+		}
+
+		f, err := os.Open(kpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keyring openpgp.EntityList
+		if armored {
+			keyring, err = openpgp.ReadArmoredKeyRing(f)
+		} else {
+			keyring, err = openpgp.ReadKeyRing(f)
+		}
+		f.Close()
+		if err != nil {
+			t.Fatalf("could not read exported key: %s", err)
+		}
+
+		// the exported key verifies signatures without the key provider
+		fp, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers, err := ValidSignersFp(fp, keyring)
+		fp.Close()
+		if err != nil {
+			t.Fatalf("ValidSignersFp() failed: %s", err)
+		}
+		if len(signers) != 1 || signers[0] != fmt.Sprintf("%X", keyring[0].PrimaryKey.Fingerprint) {
+			t.Errorf("signature not verified with the exported key: %v", signers)
+		}
+	}
+}
+
+func TestSignVerityRootHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-verity-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l := testAgent(t, socket, key)
+	defer l.Close()
+	uri := "agent:" + socket
+
+	rootHash := bytes.Repeat([]byte("a"), 64)
+	config, err := json.Marshal(image.VerityConfig{RootHash: string(rootHash)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// linked to the primary partition, the first descriptor
+	path := createTestSIF(t, dir, sif.DescriptorInput{
+		Datatype: sif.DataGenericJSON,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     1,
+		Fname:    image.VerityConfigName,
+		Data:     config,
+		Size:     int64(len(config)),
+	})
+
+	if err := SignWithProvider(path, 0, false, uri); err != nil {
+		t.Fatalf("SignWithProvider() failed: %s", err)
+	}
+	if _, err := VerifyWithProvider(path, 0, false, uri, false); err != nil {
+		t.Fatalf("VerifyWithProvider() failed: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, rootHash) != 1 {
+		t.Fatalf("root hash not found in image")
+	}
+	data = bytes.Replace(data, rootHash, bytes.Repeat([]byte("b"), len(rootHash)), 1)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyWithProvider(path, 0, false, uri, false); err != ErrVerificationFail {
+		t.Errorf("VerifyWithProvider() succeeded with a modified root hash")
+	}
+}
+
+func TestNewKeyProvider(t *testing.T) {
+	for _, uri := range []string{
+		"file:///tmp/key.pem",
+		"kms:",
+		"kms:aws",
+		"kms:unknown-helper/key",
+		"agent:",
+		"pkcs11:object=key",
+	} {
+		if _, err := NewKeyProvider(uri); err == nil {
+			t.Errorf("unexpected success with key URI %q", uri)
+		}
+	}
+}
@@ -14,13 +14,16 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/fatih/color"
-	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sif"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/sypgp"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 // ErrVerificationFail is the error when the verify fails
@@ -28,6 +31,8 @@ var ErrVerificationFail = errors.New("verification failed")
 
 var errNotFound = errors.New("key does not exist in local, or remote keystore")
 var errNotFoundLocal = errors.New("key not in local keyring")
+var errNotFoundBundle = errors.New("key not in key bundle")
+var errNotFoundProvider = errors.New("key not held by key provider")
 
 // Key is for json formatting.
 type Key struct {
@@ -41,6 +46,7 @@ type KeyEntity struct {
 	KeyLocal    bool
 	KeyCheck    bool
 	DataCheck   bool
+	Provider    string `json:",omitempty"`
 }
 
 // KeyList is a list of one or more keys.
@@ -62,8 +68,9 @@ func computeHashStr(fimg *sif.FileImage, descr []*sif.Descriptor) string {
 	return fmt.Sprintf("SIFHASH:\n%x", sum)
 }
 
-// sifAddSignature adds a signature block to a SIF file
-func sifAddSignature(fimg *sif.FileImage, groupid, link uint32, fingerprint [20]byte, signature []byte) error {
+// sifAddSignature adds a signature block to a SIF file, entity holds the
+// signer key fingerprint optionally followed by key provider metadata
+func sifAddSignature(fimg *sif.FileImage, groupid, link uint32, entity []byte, signature []byte) error {
 	// data we need to create a signature descriptor
 	siginput := sif.DescriptorInput{
 		Datatype: sif.DataSignature,
@@ -75,7 +82,7 @@ func sifAddSignature(fimg *sif.FileImage, groupid, link uint32, fingerprint [20]
 	siginput.Size = int64(binary.Size(siginput.Data))
 
 	// extra data needed for the creation of a signature descriptor
-	err := siginput.SetSignExtra(sif.HashSHA384, hex.EncodeToString(fingerprint[:]))
+	err := siginput.SetSignExtra(sif.HashSHA384, hex.EncodeToString(entity))
 	if err != nil {
 		return err
 	}
@@ -89,15 +96,69 @@ func sifAddSignature(fimg *sif.FileImage, groupid, link uint32, fingerprint [20]
 	return nil
 }
 
+// providerHeader prefixes the key provider metadata in the signed text of
+// signature blocks made with key provider keys, after the SIF hash.
+const providerHeader = "Key-Provider: "
+
+// signatureEntity returns the signature descriptor entity holding the key
+// fingerprint followed by the key provider metadata. The descriptor copy of
+// the metadata isn't covered by the signature, verify only reports the
+// metadata of the signed text and requires both to match.
+func signatureEntity(fingerprint [fingerprintLen]byte, provider string) ([]byte, error) {
+	if len(provider) > sif.DescrEntityLen-fingerprintLen {
+		return nil, fmt.Errorf("key provider metadata %q exceeds %d bytes", provider, sif.DescrEntityLen-fingerprintLen)
+	}
+	return append(fingerprint[:], provider...), nil
+}
+
+// signatureProvider returns the key provider metadata recorded in the
+// signature descriptor, or an empty string for keyring keys.
+func signatureProvider(descr *sif.Descriptor) string {
+	entity, err := descr.GetEntity()
+	if err != nil || len(entity) <= fingerprintLen {
+		return ""
+	}
+	return string(bytes.TrimRight(entity[fingerprintLen:], "\x00"))
+}
+
+// signedText returns the SIF hash and the key provider metadata of the
+// signed text of a signature block.
+func signedText(plaintext []byte) ([]byte, string) {
+	text := bytes.TrimRight(plaintext, "\n")
+	i := bytes.LastIndex(text, []byte("\n"+providerHeader))
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], string(text[i+1+len(providerHeader):])
+}
+
+// primPartDescrs returns the primary partition descriptor followed by the
+// descriptor holding its dm-verity root hash if any, signatures of the
+// primary partition also cover the root hash.
+func primPartDescrs(fimg *sif.FileImage) ([]*sif.Descriptor, error) {
+	part, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		return nil, fmt.Errorf("no primary partition found")
+	}
+
+	descr := []*sif.Descriptor{part}
+	linked, _, err := fimg.GetLinkedDescrsByType(part.ID, sif.DataGenericJSON)
+	if err == nil {
+		for _, d := range linked {
+			if d.GetName() == image.VerityConfigName {
+				descr = append(descr, d)
+			}
+		}
+	}
+	return descr, nil
+}
+
 // descrToSign determines via argument or interactively which descriptor to sign
 func descrToSign(fimg *sif.FileImage, id uint32, isGroup bool) (descr []*sif.Descriptor, err error) {
 	descr = make([]*sif.Descriptor, 1)
 
 	if id == 0 {
-		descr[0], _, err = fimg.GetPartPrimSys()
-		if err != nil {
-			return nil, fmt.Errorf("no primary partition found")
-		}
+		return primPartDescrs(fimg)
 	} else if isGroup {
 		var search = sif.Descriptor{
 			Groupid: id | sif.DescrGroupMask,
@@ -154,6 +215,35 @@ func Sign(cpath string, id uint32, isGroup bool, keyIdx int) error {
 		}
 	}
 
+	return signContainer(cpath, id, isGroup, entity.PrivateKey, "")
+}
+
+// SignWithProvider takes the path of a container and generates an OpenPGP
+// signature block for its system partition like Sign does, except that the
+// signing key is held by the key provider referenced by keyURI. The key
+// provider metadata is recorded in the signature descriptor.
+func SignWithProvider(cpath string, id uint32, isGroup bool, keyURI string) error {
+	p, err := NewKeyProvider(keyURI)
+	if err != nil {
+		return err
+	}
+
+	key, err := providerKey(p)
+	if err != nil {
+		return err
+	}
+
+	return signContainer(cpath, id, isGroup, key, p.Provider())
+}
+
+// signContainer adds a signature block made with key for the selected
+// descriptors of a container, provider is the key provider metadata.
+func signContainer(cpath string, id uint32, isGroup bool, key *packet.PrivateKey, provider string) error {
+	entity, err := signatureEntity(key.Fingerprint, provider)
+	if err != nil {
+		return err
+	}
+
 	// load the container
 	fimg, err := sif.LoadContainer(cpath, false)
 	if err != nil {
@@ -167,12 +257,16 @@ func Sign(cpath string, id uint32, isGroup bool, keyIdx int) error {
 		return fmt.Errorf("signing requires a primary partition: %s", err)
 	}
 
-	// signature also include data integrity check
+	// signature also include data integrity check, and the key provider
+	// metadata so that it can't be altered
 	sifhash := computeHashStr(&fimg, descr)
+	if provider != "" {
+		sifhash += "\n" + providerHeader + provider
+	}
 
 	// create an ascii armored signature block
 	var signedmsg bytes.Buffer
-	plaintext, err := clearsign.Encode(&signedmsg, entity.PrivateKey, nil)
+	plaintext, err := clearsign.Encode(&signedmsg, key, &packet.Config{DefaultHash: signatureHash})
 	if err != nil {
 		return fmt.Errorf("could not build a signature block: %s", err)
 	}
@@ -193,7 +287,7 @@ func Sign(cpath string, id uint32, isGroup bool, keyIdx int) error {
 		groupid = descr[0].Groupid
 		link = descr[0].ID
 	}
-	err = sifAddSignature(&fimg, groupid, link, entity.PrimaryKey.Fingerprint, signedmsg.Bytes())
+	err = sifAddSignature(&fimg, groupid, link, entity, signedmsg.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed adding signature block to SIF container file: %s", err)
 	}
@@ -203,11 +297,9 @@ func Sign(cpath string, id uint32, isGroup bool, keyIdx int) error {
 
 // return all signatures for the primary partition
 func getSigsPrimPart(fimg *sif.FileImage) (sigs []*sif.Descriptor, descr []*sif.Descriptor, err error) {
-	descr = make([]*sif.Descriptor, 1)
-
-	descr[0], _, err = fimg.GetPartPrimSys()
+	descr, err = primPartDescrs(fimg)
 	if err != nil {
-		return nil, nil, fmt.Errorf("no primary partition found")
+		return nil, nil, err
 	}
 
 	sigs, _, err = fimg.GetLinkedDescrsByType(descr[0].ID, sif.DataSignature)
@@ -297,6 +389,63 @@ func IsSigned(cpath, keyServerURI string, id uint32, isGroup bool, authToken str
 func Verify(cpath, keyServiceURI string, id uint32, isGroup bool, authToken string, localVerify, jsonVerify bool) (string, bool, error) {
 	keyring := sypgp.NewHandle("")
 
+	identify := func(block *clearsign.Block, data []byte, fingerprint string) (string, bool, error) {
+		return getSignerIdentity(keyring, block, data, fingerprint, keyServiceURI, authToken, localVerify)
+	}
+	return verify(cpath, id, isGroup, jsonVerify, "[LOCAL]", identify)
+}
+
+// VerifyBundle takes a container path (cpath), and verifies the signature
+// blocks of the specified descriptor like Verify does, except that signers
+// are only looked up in the trusted keys of bundle, neither the local keyring
+// nor a key server are used. Returns a string of formatted output, or json
+// (if jsonVerify is true).
+func VerifyBundle(cpath string, id uint32, isGroup bool, bundle *sypgp.Bundle, jsonVerify bool) (string, error) {
+	identify := func(block *clearsign.Block, data []byte, fingerprint string) (string, bool, error) {
+		signer, err := openpgp.CheckDetachedSignature(bundle.Keys, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
+		if err != nil {
+			return "", false, errNotFoundBundle
+		}
+		return getFirstIdentity(signer), true, nil
+	}
+	author, _, err := verify(cpath, id, isGroup, jsonVerify, "[BUNDLE]", identify)
+	return author, err
+}
+
+// VerifyWithProvider takes a container path (cpath), and verifies the
+// signature blocks of the specified descriptor like Verify does, except that
+// signers are only checked against the public key of the key provider
+// referenced by keyURI. Returns a string of formatted output, or json (if
+// jsonVerify is true).
+func VerifyWithProvider(cpath string, id uint32, isGroup bool, keyURI string, jsonVerify bool) (string, error) {
+	p, err := NewKeyProvider(keyURI)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := providerKey(p)
+	if err != nil {
+		return "", err
+	}
+	keyring := openpgp.EntityList{providerEntity(p, &key.PublicKey)}
+
+	identify := func(block *clearsign.Block, data []byte, fingerprint string) (string, bool, error) {
+		signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
+		if err != nil {
+			return "", false, errNotFoundProvider
+		}
+		return getFirstIdentity(signer), true, nil
+	}
+
+	scheme := strings.SplitN(keyURI, ":", 2)[0]
+	author, _, err := verify(cpath, id, isGroup, jsonVerify, "["+strings.ToUpper(scheme)+"]", identify)
+	return author, err
+}
+
+// verify checks signatures of the selected descriptors, identify returns the
+// identity of a signature block signer and if the signer key is trusted
+// locally, these signers are reported with localPrefix.
+func verify(cpath string, id uint32, isGroup bool, jsonVerify bool, localPrefix string, identify func(*clearsign.Block, []byte, string) (string, bool, error)) (string, bool, error) {
 	notLocalKey := false
 
 	fimg, err := sif.LoadContainer(cpath, true)
@@ -346,25 +495,29 @@ func Verify(cpath, keyServiceURI string, id uint32, isGroup bool, authToken stri
 			sylog.Verbosef("%s signature key (%s) corrupted, unable to read data", red("error:"), fingerprint)
 			author += fmt.Sprintf("%-18s Signature corrupted, unable to read data\n\n", red("[FAIL]"))
 
-			keySigner = makeKeyEntity("", fingerprint, false, false, false)
+			keySigner = makeKeyEntity("", fingerprint, "", false, false, false)
 			keyEntityList.SignerKeys = append(keyEntityList.SignerKeys, keySigner)
 
 			fail = true
 			continue
 		}
 
+		// the key provider metadata is only reported once the signature
+		// covering it is checked
+		hash, provider := signedText(block.Plaintext)
+
 		// (1) try to get identity of signer
-		i, local, err := getSignerIdentity(keyring, v, block, data, fingerprint, keyServiceURI, authToken, localVerify)
+		i, local, err := identify(block, data, fingerprint)
 		if err != nil {
 			// use [MISSING] if we get an error we expect
-			if err == errNotFound || err == errNotFoundLocal {
+			if err == errNotFound || err == errNotFoundLocal || err == errNotFoundBundle || err == errNotFoundProvider {
 				author += fmt.Sprintf("%-18s %s\n", red("[MISSING]"), err)
 			} else {
 				author += fmt.Sprintf("%-18s %s\n", red("[FAIL]"), err)
 			}
 			fail = true
 		} else {
-			prefix := green("[LOCAL]")
+			prefix := green(localPrefix)
 			if !local {
 				prefix = yellow("[REMOTE]")
 				notLocalKey = true
@@ -372,9 +525,18 @@ func Verify(cpath, keyServiceURI string, id uint32, isGroup bool, authToken stri
 
 			author += fmt.Sprintf("%-18s %s\n", prefix, i)
 		}
+		if err != nil {
+			provider = ""
+		} else if provider != signatureProvider(v) {
+			author += fmt.Sprintf("%-18s key provider metadata differs from the signed metadata\n", red("[FAIL]"))
+			provider = ""
+			fail = true
+		} else if provider != "" {
+			author += fmt.Sprintf("%-18s Signed with key provider: %s\n", green("[OK]"), provider)
+		}
 
 		// (2) Verify data integrity by comparing hashes
-		if !bytes.Equal(bytes.TrimRight(block.Plaintext, "\n"), []byte(sifhash)) {
+		if !bytes.Equal(hash, []byte(sifhash)) {
 			sylog.Verbosef("%s key (%s) hash differs, data may be corrupted", red("error:"), fingerprint)
 			author += fmt.Sprintf("%-18s system partition hash differs, data may be corrupted\n", red("[FAIL]"))
 			dataCheck = false
@@ -384,7 +546,7 @@ func Verify(cpath, keyServiceURI string, id uint32, isGroup bool, authToken stri
 		}
 		author += fmt.Sprintf("\n")
 
-		keySigner = makeKeyEntity(i, fingerprint, local, true, dataCheck)
+		keySigner = makeKeyEntity(i, fingerprint, provider, local, true, dataCheck)
 		keyEntityList.SignerKeys = append(keyEntityList.SignerKeys, keySigner)
 	}
 	keyEntityList.Signatures = len(signatures)
@@ -404,7 +566,7 @@ func Verify(cpath, keyServiceURI string, id uint32, isGroup bool, authToken stri
 	return author, notLocalKey, errRet
 }
 
-func makeKeyEntity(name, fingerprint string, local, corrupted, dataCheck bool) *Key {
+func makeKeyEntity(name, fingerprint, provider string, local, corrupted, dataCheck bool) *Key {
 	if name == "" {
 		name = "unknown"
 	}
@@ -416,6 +578,7 @@ func makeKeyEntity(name, fingerprint string, local, corrupted, dataCheck bool) *
 			KeyLocal:    local,
 			KeyCheck:    corrupted,
 			DataCheck:   dataCheck,
+			Provider:    provider,
 		},
 	}
 
@@ -430,7 +593,7 @@ func getFirstIdentity(e *openpgp.Entity) string {
 	return ""
 }
 
-func getSignerIdentity(keyring *sypgp.Handle, v *sif.Descriptor, block *clearsign.Block, data []byte, fingerprint, keyServiceURI, authToken string, local bool) (string, bool, error) {
+func getSignerIdentity(keyring *sypgp.Handle, block *clearsign.Block, data []byte, fingerprint, keyServiceURI, authToken string, local bool) (string, bool, error) {
 	// load the public keys available locally from the cache
 	elist, err := keyring.LoadPubKeyring()
 	if err != nil {
@@ -511,3 +674,38 @@ func GetSignEntitiesFp(fp *os.File) ([]string, error) {
 
 	return getSignEntities(&fimg)
 }
+
+// ValidSignersFp returns the fingerprints of the keys of keyring having a
+// valid signature for the primary partition of the SIF image opened as fp.
+// Signatures made for different data or with unknown keys are ignored.
+func ValidSignersFp(fp *os.File, keyring openpgp.EntityList) ([]string, error) {
+	fimg, err := sif.LoadContainerFp(fp, true)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, descr, err := getSigsPrimPart(&fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	sifhash := computeHashStr(&fimg, descr)
+
+	signers := make([]string, 0, len(signatures))
+	for _, v := range signatures {
+		block, _ := clearsign.Decode(v.GetData(&fimg))
+		if block == nil {
+			continue
+		}
+		if hash, _ := signedText(block.Plaintext); !bytes.Equal(hash, []byte(sifhash)) {
+			continue
+		}
+		signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint))
+	}
+
+	return signers, nil
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// bundleFormat identifies the format of key bundle documents.
+const bundleFormat = "singularity-key-bundle/v1"
+
+// Bundle is a versioned set of trusted public keys signed by a key
+// authority, it allows to verify images without keyserver access.
+type Bundle struct {
+	// Version is the bundle version set by the authority.
+	Version int
+	// Created is the bundle creation time.
+	Created time.Time
+	// Keys are the trusted public keys.
+	Keys openpgp.EntityList
+	// Signer is the key authority which signed the bundle.
+	Signer *openpgp.Entity
+
+	// digest is the SHA256 digest of the signed document.
+	digest string
+}
+
+// bundleState records the last key bundle accepted from a signer.
+type bundleState struct {
+	Version int    `json:"version"`
+	Digest  string `json:"digest"`
+}
+
+// bundleDocument is the clear-signed JSON document of a bundle.
+type bundleDocument struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Keys    string    `json:"keys"`
+}
+
+// WriteBundle writes to w a bundle with the provided version containing
+// the public keys, clear-signed with the decrypted private key signer.
+func WriteBundle(w io.Writer, keys openpgp.EntityList, signer *openpgp.Entity, version int) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no public keys to export")
+	}
+
+	var armored bytes.Buffer
+
+	aw, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range keys {
+		if err := e.Serialize(aw); err != nil {
+			return fmt.Errorf("unable to serialize public key %X: %s", e.PrimaryKey.Fingerprint, err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+
+	doc, err := json.MarshalIndent(bundleDocument{
+		Format:  bundleFormat,
+		Version: version,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Keys:    armored.String(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := clearsign.Encode(w, signer.PrivateKey, nil)
+	if err != nil {
+		return fmt.Errorf("could not build a signature block: %s", err)
+	}
+	if _, err := plaintext.Write(doc); err != nil {
+		return fmt.Errorf("failed writing key bundle: %s", err)
+	}
+	return plaintext.Close()
+}
+
+// ReadBundle reads a bundle from r and checks that it has been signed by
+// one of the trusted keys.
+func ReadBundle(r io.Reader, trusted openpgp.EntityList) (*Bundle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key bundle is not a clear-signed document")
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(trusted, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, fmt.Errorf("key bundle signature verification failed: %s", err)
+	}
+
+	var doc bundleDocument
+	if err := json.Unmarshal(block.Plaintext, &doc); err != nil {
+		return nil, fmt.Errorf("while parsing key bundle: %s", err)
+	}
+	if doc.Format != bundleFormat {
+		return nil, fmt.Errorf("unsupported key bundle format %q", doc.Format)
+	}
+
+	keys, err := openpgp.ReadArmoredKeyRing(strings.NewReader(doc.Keys))
+	if err != nil {
+		return nil, fmt.Errorf("while reading key bundle public keys: %s", err)
+	}
+
+	sum := sha256.Sum256(block.Plaintext)
+
+	return &Bundle{
+		Version: doc.Version,
+		Created: doc.Created,
+		Keys:    keys,
+		Signer:  signer,
+		digest:  hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// ExportBundle exports the public keys of the local keyring into a bundle
+// file (kpath) signed with a private key of the local keyring. Only keys
+// whose fingerprint ends with one of fingerprints are exported if any,
+// keyIdx selects the private key or prompts for it when set to -1.
+func (keyring *Handle) ExportBundle(kpath string, fingerprints []string, version int, keyIdx int) error {
+	if err := keyring.PathsCheck(); err != nil {
+		return err
+	}
+
+	pubEntityList, err := loadKeyring(keyring.PublicPath())
+	if err != nil {
+		return fmt.Errorf("unable to open local keyring: %v", err)
+	}
+
+	keys := pubEntityList
+	if len(fingerprints) > 0 {
+		keys = make(openpgp.EntityList, 0, len(fingerprints))
+		for _, f := range fingerprints {
+			e := findKeyByFingerprintSuffix(pubEntityList, f)
+			if e == nil {
+				return fmt.Errorf("no public key matching %s in local keyring", f)
+			}
+			keys = append(keys, e)
+		}
+	}
+
+	privEntityList, err := loadKeyring(keyring.SecretPath())
+	if err != nil {
+		return fmt.Errorf("unable to load private keyring: %v", err)
+	}
+	if len(privEntityList) == 0 {
+		return fmt.Errorf("no private keys in keyring. use 'key newpair' to generate a key, or 'key import' to import a private key from gpg")
+	}
+
+	var signer *openpgp.Entity
+	if keyIdx != -1 {
+		if keyIdx < 0 || keyIdx >= len(privEntityList) {
+			return fmt.Errorf("specified (-k, --keyidx) key index out of range")
+		}
+		signer = privEntityList[keyIdx]
+	} else if len(privEntityList) > 1 {
+		signer, err = SelectPrivKey(privEntityList)
+		if err != nil {
+			return fmt.Errorf("failed while reading selection: %s", err)
+		}
+	} else {
+		signer = privEntityList[0]
+	}
+
+	if signer.PrivateKey.Encrypted {
+		if err := DecryptKey(signer, ""); err != nil {
+			return fmt.Errorf("could not decrypt private key, wrong password?")
+		}
+	}
+
+	file, err := os.Create(kpath)
+	if err != nil {
+		return fmt.Errorf("unable to create file: %v", err)
+	}
+	defer file.Close()
+
+	if err := WriteBundle(file, keys, signer, version); err != nil {
+		os.Remove(kpath)
+		return err
+	}
+	fmt.Printf("Key bundle version %d with %d public key(s) signed by %X correctly exported to file: %s\n", version, len(keys), signer.PrimaryKey.Fingerprint, kpath)
+
+	return nil
+}
+
+// BundlesPath returns a string describing the path to the file recording
+// the last key bundle accepted from each signer.
+func (keyring *Handle) BundlesPath() string {
+	return filepath.Join(keyring.path, "pgp-bundles.json")
+}
+
+// LoadBundle reads the bundle file (kpath) and checks that it has been
+// signed by a key of the local public keyring whose fingerprint is one
+// of signers, as set by the key bundle signer directive. Bundles older
+// than the last one accepted from the same signer are refused, as well
+// as a different bundle with the same version, to prevent the rollback
+// to a bundle still trusting revoked keys.
+func (keyring *Handle) LoadBundle(kpath string, signers []string) (*Bundle, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no key bundle signer configured by the administrator")
+	}
+
+	pub, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("could not load public keyring: %s", err)
+	}
+
+	trusted := make(openpgp.EntityList, 0, len(signers))
+	for _, fp := range signers {
+		if e := findKeyByFingerprint(pub, strings.ToUpper(fp)); e != nil {
+			trusted = append(trusted, e)
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("none of the key bundle signers public keys found in local keyring, import them with 'key import'")
+	}
+
+	f, err := os.Open(kpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bundle, err := ReadBundle(f, trusted)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s, the bundle must be signed by a key bundle signer", kpath, err)
+	}
+
+	if err := keyring.checkBundleVersion(bundle); err != nil {
+		return nil, fmt.Errorf("%s: %s", kpath, err)
+	}
+	return bundle, nil
+}
+
+// checkBundleVersion checks that bundle is not older than the last
+// bundle accepted from its signer and records it otherwise.
+func (keyring *Handle) checkBundleVersion(bundle *Bundle) error {
+	states := make(map[string]bundleState)
+
+	data, err := ioutil.ReadFile(keyring.BundlesPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(data, &states); err != nil {
+			return fmt.Errorf("while parsing %s: %s", keyring.BundlesPath(), err)
+		}
+	}
+
+	fp := fmt.Sprintf("%X", bundle.Signer.PrimaryKey.Fingerprint)
+	if last, ok := states[fp]; ok {
+		if bundle.Version < last.Version {
+			return fmt.Errorf("key bundle version %d is older than the accepted version %d", bundle.Version, last.Version)
+		}
+		if bundle.Version == last.Version {
+			if bundle.digest != last.Digest {
+				return fmt.Errorf("key bundle version %d differs from the accepted bundle with the same version", bundle.Version)
+			}
+			return nil
+		}
+	}
+
+	if err := keyring.PathsCheck(); err != nil {
+		return err
+	}
+	states[fp] = bundleState{Version: bundle.Version, Digest: bundle.digest}
+	data, err = json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyring.BundlesPath(), data, 0600)
+}
+
+func findKeyByFingerprintSuffix(entities openpgp.EntityList, fingerprint string) *openpgp.Entity {
+	fingerprint = strings.ToUpper(fingerprint)
+	for _, e := range entities {
+		if strings.HasSuffix(fmt.Sprintf("%X", e.PrimaryKey.Fingerprint), fingerprint) {
+			return e
+		}
+	}
+	return nil
+}
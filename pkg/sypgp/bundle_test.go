@@ -0,0 +1,150 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestBundle(t *testing.T) {
+	authority, err := openpgp.NewEntity("Authority", "", "authority@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	other, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := WriteBundle(&buf, openpgp.EntityList{}, authority, 1); err == nil {
+		t.Errorf("unexpected success with an empty key list")
+	}
+	if err := WriteBundle(&buf, openpgp.EntityList{testEntity, other}, authority, 3); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data := buf.Bytes()
+
+	bundle, err := ReadBundle(bytes.NewReader(data), openpgp.EntityList{authority})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if bundle.Version != 3 {
+		t.Errorf("got version %d, expected 3", bundle.Version)
+	}
+	if bundle.Signer.PrimaryKey.Fingerprint != authority.PrimaryKey.Fingerprint {
+		t.Errorf("unexpected bundle signer %X", bundle.Signer.PrimaryKey.Fingerprint)
+	}
+	if len(bundle.Keys) != 2 {
+		t.Fatalf("got %d keys, expected 2", len(bundle.Keys))
+	}
+	fp := fmt.Sprintf("%X", testEntity.PrimaryKey.Fingerprint)
+	if findKeyByFingerprint(bundle.Keys, fp) == nil {
+		t.Errorf("key %s not found in bundle", fp)
+	}
+	if findKeyByFingerprintSuffix(bundle.Keys, fp[len(fp)-8:]) == nil {
+		t.Errorf("key ID %s not found in bundle", fp[len(fp)-8:])
+	}
+
+	// signer not trusted
+	if _, err := ReadBundle(bytes.NewReader(data), openpgp.EntityList{other}); err == nil {
+		t.Errorf("unexpected success with an untrusted signer")
+	}
+
+	// tampered version
+	tampered := bytes.Replace(data, []byte(`"version": 3`), []byte(`"version": 4`), 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatalf("version not found in bundle:\n%s", data)
+	}
+	if _, err := ReadBundle(bytes.NewReader(tampered), openpgp.EntityList{authority}); err == nil {
+		t.Errorf("unexpected success with a tampered bundle")
+	}
+}
+
+func TestLoadBundle(t *testing.T) {
+	authority, err := openpgp.NewEntity("Authority", "", "authority@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	other, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	authorityFp := fmt.Sprintf("%X", authority.PrimaryKey.Fingerprint)
+	otherFp := fmt.Sprintf("%X", other.PrimaryKey.Fingerprint)
+
+	dir, err := ioutil.TempDir("", "sypgp-bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyring := NewHandle(filepath.Join(dir, "keys"))
+	if err := keyring.PathsCheck(); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*openpgp.Entity{authority, other} {
+		if err := keyring.appendPubKey(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeBundle := func(name string, signer *openpgp.Entity, version int, keys ...*openpgp.Entity) string {
+		t.Helper()
+
+		var buf bytes.Buffer
+		if err := WriteBundle(&buf, keys, signer, version); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	v3 := writeBundle("v3", authority, 3, testEntity)
+	v3other := writeBundle("v3-other", authority, 3, testEntity, other)
+	v2 := writeBundle("v2", authority, 2, testEntity)
+	v4 := writeBundle("v4", authority, 4, testEntity)
+	signedByOther := writeBundle("v1-other", other, 1, testEntity)
+
+	tests := []struct {
+		name    string
+		path    string
+		signers []string
+		wantErr bool
+	}{
+		{"NoSigner", v3, nil, true},
+		{"SignerNotPinned", signedByOther, []string{authorityFp}, true},
+		{"UnknownSigner", v3, []string{"0123456789ABCDEF0123456789ABCDEF01234567"}, true},
+		{"Accepted", v3, []string{otherFp, authorityFp}, false},
+		{"SameBundle", v3, []string{authorityFp}, false},
+		{"SameVersionDifferentBundle", v3other, []string{authorityFp}, true},
+		{"Rollback", v2, []string{authorityFp}, true},
+		{"NewerVersion", v4, []string{authorityFp}, false},
+		{"RollbackAfterUpdate", v3, []string{authorityFp}, true},
+		{"OtherSigner", signedByOther, []string{otherFp}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keyring.LoadBundle(tt.path, tt.signers)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jsonresp "github.com/sylabs/json-resp"
+	"github.com/sylabs/scs-key-client/client"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// KeyGroup is a subscription of the local public keyring to a named
+// group of keys published on a key server. Group members are the keys
+// having a user ID with the group name as comment, for example
+// "Jane Doe (bio-apps-maintainers) <jane@example.com>", certified by
+// the group signer key. Anybody can publish a key with such a user ID,
+// the certification is what makes a key a group member.
+type KeyGroup struct {
+	// Name is the group name.
+	Name string `json:"name"`
+	// KeyserverURI is the key server the group is fetched from.
+	KeyserverURI string `json:"keyserver"`
+	// Signer is the fingerprint of the key certifying the group
+	// members, it must be present in the local public keyring.
+	Signer string `json:"signer"`
+	// Updated is the last time group members were fetched.
+	Updated time.Time `json:"updated"`
+	// Refresh is the interval after which group members are fetched
+	// again when the group is used, zero disables the refresh.
+	Refresh time.Duration `json:"refresh,omitempty"`
+	// Fingerprints are the keys added to the public keyring by
+	// the group, only those keys are removed from the keyring when
+	// they are dropped from the group.
+	Fingerprints []string `json:"fingerprints"`
+}
+
+// Stale returns whether the refresh interval of the group elapsed
+// at the time now since its members were last fetched.
+func (g *KeyGroup) Stale(now time.Time) bool {
+	return g.Refresh > 0 && now.Sub(g.Updated) >= g.Refresh
+}
+
+// GroupsPath returns a string describing the path to the key group
+// subscriptions file.
+func (keyring *Handle) GroupsPath() string {
+	return filepath.Join(keyring.path, "pgp-groups.json")
+}
+
+// LoadGroups returns the key groups the local public keyring is
+// subscribed to.
+func (keyring *Handle) LoadGroups() ([]*KeyGroup, error) {
+	var groups []*KeyGroup
+
+	data, err := ioutil.ReadFile(keyring.GroupsPath())
+	if os.IsNotExist(err) {
+		return groups, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %s", keyring.GroupsPath(), err)
+	}
+	return groups, nil
+}
+
+// storeGroups overwrites the key group subscriptions file.
+func (keyring *Handle) storeGroups(groups []*KeyGroup) error {
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyring.GroupsPath(), data, 0600)
+}
+
+// SubscribeGroup subscribes the local public keyring to the group name
+// of the key server and adds the group member keys certified by the key
+// with the fingerprint signer to the keyring. The group is fetched again
+// when used after the refresh interval, zero disables the refresh.
+func (keyring *Handle) SubscribeGroup(name, keyserverURI, authToken, signer string, refresh time.Duration) error {
+	if err := keyring.PathsCheck(); err != nil {
+		return err
+	}
+
+	groups, err := keyring.LoadGroups()
+	if err != nil {
+		return err
+	}
+	if findGroup(groups, name) != nil {
+		return fmt.Errorf("already subscribed to key group %s", name)
+	}
+
+	g := &KeyGroup{
+		Name:         name,
+		KeyserverURI: keyserverURI,
+		Signer:       strings.ToUpper(signer),
+		Refresh:      refresh,
+	}
+	if err := keyring.syncGroup(append(groups, g), g, authToken); err != nil {
+		return err
+	}
+	fmt.Printf("Subscribed to key group %s with %d key(s)\n", name, len(g.Fingerprints))
+
+	return nil
+}
+
+// UnsubscribeGroup removes the subscription to the group name and the
+// keys it added from the local public keyring.
+func (keyring *Handle) UnsubscribeGroup(name string) error {
+	groups, err := keyring.LoadGroups()
+	if err != nil {
+		return err
+	}
+
+	g := findGroup(groups, name)
+	if g == nil {
+		return fmt.Errorf("not subscribed to key group %s", name)
+	}
+
+	pub, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return fmt.Errorf("unable to list local keyring: %v", err)
+	}
+
+	others := removeGroup(groups, name)
+	pub, _, removed := mergeGroupKeys(pub, others, g, nil)
+
+	if err := keyring.storePubKeyring(pub); err != nil {
+		return err
+	}
+	if err := keyring.storeGroups(others); err != nil {
+		return err
+	}
+	fmt.Printf("Unsubscribed from key group %s, %d key(s) removed\n", name, removed)
+
+	return nil
+}
+
+// SyncGroups fetches the members of the subscribed key groups and
+// updates the local public keyring accordingly. The authentication
+// token is only sent to groups hosted on keyserverURI.
+func (keyring *Handle) SyncGroups(keyserverURI, authToken string) error {
+	groups, err := keyring.LoadGroups()
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		token := ""
+		if g.KeyserverURI == keyserverURI {
+			token = authToken
+		}
+		if err := keyring.syncGroup(groups, g, token); err != nil {
+			return fmt.Errorf("key group %s: %s", g.Name, err)
+		}
+	}
+	return nil
+}
+
+// RefreshGroups fetches the members of the subscribed key groups whose
+// refresh interval elapsed and updates the local public keyring, it is
+// called before the group keys are used. The authentication token is
+// only sent to groups hosted on keyserverURI.
+func (keyring *Handle) RefreshGroups(keyserverURI, authToken string) error {
+	groups, err := keyring.LoadGroups()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, g := range groups {
+		if !g.Stale(now) {
+			continue
+		}
+		sylog.Verbosef("Refreshing key group %s last updated on %s", g.Name, g.Updated)
+
+		token := ""
+		if g.KeyserverURI == keyserverURI {
+			token = authToken
+		}
+		if err := keyring.syncGroup(groups, g, token); err != nil {
+			return fmt.Errorf("key group %s: %s", g.Name, err)
+		}
+	}
+	return nil
+}
+
+// syncGroup fetches the members of the group g and updates the local
+// public keyring and the subscriptions file.
+func (keyring *Handle) syncGroup(groups []*KeyGroup, g *KeyGroup, authToken string) error {
+	pub, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return fmt.Errorf("unable to list local keyring: %v", err)
+	}
+
+	// the signer key must have been imported by the user, a key
+	// added by a group can't vouch for group members
+	if g.Signer == "" {
+		return fmt.Errorf("no signer key, subscribe again to the group with a signer key")
+	}
+	signer := findKeyByFingerprint(pub, g.Signer)
+	if signer == nil {
+		return fmt.Errorf("signer key %s not found in local keyring", g.Signer)
+	}
+	if findGroupByFingerprint(groups, g.Signer) != nil {
+		return fmt.Errorf("signer key %s was added by a key group", g.Signer)
+	}
+
+	members, err := FetchGroupKeys(g.Name, g.KeyserverURI, authToken, signer)
+	if err != nil {
+		return err
+	}
+
+	pub, added, removed := mergeGroupKeys(pub, removeGroup(groups, g.Name), g, members)
+	sylog.Verbosef("Key group %s: %d key(s) added, %d key(s) removed", g.Name, added, removed)
+
+	if err := keyring.storePubKeyring(pub); err != nil {
+		return err
+	}
+	g.Updated = time.Now().UTC().Truncate(time.Second)
+
+	return keyring.storeGroups(groups)
+}
+
+// mergeGroupKeys updates the public keys with the members of the group
+// g, keys previously added by g and no longer members are removed unless
+// another group holds them. Keys already present in pub and not added by
+// a group are left untouched. It returns the updated keys along with the
+// number of keys added and removed.
+func mergeGroupKeys(pub openpgp.EntityList, others []*KeyGroup, g *KeyGroup, members openpgp.EntityList) (openpgp.EntityList, int, int) {
+	owned := make(map[string]bool)
+	for _, o := range others {
+		for _, fp := range o.Fingerprints {
+			owned[fp] = true
+		}
+	}
+	for _, fp := range g.Fingerprints {
+		owned[fp] = true
+	}
+
+	added := 0
+	fingerprints := make([]string, 0, len(members))
+	current := make(map[string]bool)
+
+	for _, m := range members {
+		fp := fmt.Sprintf("%X", m.PrimaryKey.Fingerprint)
+		current[fp] = true
+
+		e := findKeyByFingerprint(pub, fp)
+		if e != nil && !owned[fp] {
+			// manually imported key
+			continue
+		}
+		fingerprints = append(fingerprints, fp)
+
+		if e != nil {
+			// replace with the key server copy to get
+			// revocations and new signatures
+			pub = removeKey(pub, fp)
+		} else {
+			added++
+		}
+		pub = append(pub, m)
+	}
+
+	removed := 0
+	for _, fp := range g.Fingerprints {
+		if current[fp] || findGroupByFingerprint(others, fp) != nil {
+			continue
+		}
+		if l := removeKey(pub, fp); l != nil {
+			pub = l
+			removed++
+		}
+	}
+
+	g.Fingerprints = fingerprints
+
+	return pub, added, removed
+}
+
+// FetchGroupKeys returns the keys of the group name published on the
+// key server and certified by signer.
+func FetchGroupKeys(name, keyserverURI, authToken string, signer *openpgp.Entity) (openpgp.EntityList, error) {
+	// Get a Key Service client.
+	c, err := client.NewClient(&client.Config{
+		BaseURL:   keyserverURI,
+		AuthToken: authToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keyText, err := c.PKSLookup(context.TODO(), nil, name, client.OperationGet, false, false, nil)
+	if err != nil {
+		if jerr, ok := err.(*jsonresp.Error); ok && jerr.Code == http.StatusUnauthorized {
+			// The request failed with HTTP code unauthorized. Guide user to fix that.
+			sylog.Infof(helpAuth)
+			return nil, fmt.Errorf("unauthorized or missing token")
+		} else if ok && jerr.Code == http.StatusNotFound {
+			return nil, fmt.Errorf("no keys found for group %s", name)
+		} else {
+			return nil, fmt.Errorf("failed to get group keys: %v", err)
+		}
+	}
+
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(keyText))
+	if err != nil {
+		return nil, err
+	}
+	return groupMembers(el, name, signer), nil
+}
+
+// groupMembers returns the entities having a user ID with the group
+// name as comment certified by signer, the search being a substring
+// match server side.
+func groupMembers(el openpgp.EntityList, name string, signer *openpgp.Entity) openpgp.EntityList {
+	members := make(openpgp.EntityList, 0, len(el))
+	for _, e := range el {
+		for _, id := range e.Identities {
+			if id.UserId != nil && id.UserId.Comment == name && certified(e, id, signer) {
+				members = append(members, e)
+				break
+			}
+		}
+	}
+	return members
+}
+
+// certified returns if the identity id of e carries a valid
+// certification signature of signer.
+func certified(e *openpgp.Entity, id *openpgp.Identity, signer *openpgp.Entity) bool {
+	for _, sig := range id.Signatures {
+		if sig.IssuerKeyId == nil || *sig.IssuerKeyId != signer.PrimaryKey.KeyId {
+			continue
+		}
+		if sig.SigType < packet.SigTypeGenericCert || sig.SigType > packet.SigTypePositiveCert {
+			continue
+		}
+		if signer.PrimaryKey.VerifyUserIdSignature(id.Name, e.PrimaryKey, sig) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func findGroup(groups []*KeyGroup, name string) *KeyGroup {
+	for _, g := range groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func findGroupByFingerprint(groups []*KeyGroup, fingerprint string) *KeyGroup {
+	for _, g := range groups {
+		for _, fp := range g.Fingerprints {
+			if fp == fingerprint {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+func removeGroup(groups []*KeyGroup, name string) []*KeyGroup {
+	others := make([]*KeyGroup, 0, len(groups))
+	for _, g := range groups {
+		if g.Name != name {
+			others = append(others, g)
+		}
+	}
+	return others
+}
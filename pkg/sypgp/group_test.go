@@ -0,0 +1,169 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestGroups(t *testing.T) {
+	const group = "bio-apps-maintainers"
+
+	newEntity := func(name, comment string) *openpgp.Entity {
+		e, err := openpgp.NewEntity(name, comment, "", nil)
+		if err != nil {
+			t.Fatalf("failed to create entity: %v", err)
+		}
+		return e
+	}
+	certify := func(e, signer *openpgp.Entity) *openpgp.Entity {
+		for name := range e.Identities {
+			if err := e.SignIdentity(name, signer, nil); err != nil {
+				t.Fatalf("failed to certify identity: %v", err)
+			}
+		}
+		return e
+	}
+	signer := newEntity("Signer", "")
+	other := newEntity("Other", "")
+	alice := certify(newEntity("Alice", group), signer)
+	bob := certify(newEntity("Bob", group), signer)
+	eve := certify(newEntity("Eve", "not-"+group), signer)
+	// uncertified or certified by another key
+	mallory := newEntity("Mallory", group)
+	trudy := certify(newEntity("Trudy", group), other)
+	manual := certify(newEntity("Manual", group), signer)
+	signerFp := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+
+	dir, err := ioutil.TempDir("", "sypgp-groups-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyring := NewHandle(dir)
+	if err := keyring.PathsCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.appendPubKey(manual); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := &mockPKSLookup{code: http.StatusOK, el: openpgp.EntityList{alice, bob, eve, mallory, trudy, manual}}
+	srv := httptest.NewServer(ms)
+	defer srv.Close()
+
+	checkKeys := func(expected ...*openpgp.Entity) {
+		t.Helper()
+
+		pub, err := keyring.LoadPubKeyring()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pub) != len(expected) {
+			t.Errorf("got %d keys in keyring, expected %d", len(pub), len(expected))
+		}
+		for _, e := range expected {
+			if findKeyByFingerprint(pub, fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)) == nil {
+				t.Errorf("key %X not found in keyring", e.PrimaryKey.Fingerprint)
+			}
+		}
+	}
+
+	// signer key not in the local keyring
+	if err := keyring.SubscribeGroup(group, srv.URL, "", signerFp, 0); err == nil {
+		t.Errorf("unexpected success while subscribing with an unknown signer")
+	}
+	checkKeys(manual)
+
+	if err := keyring.appendPubKey(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SubscribeGroup(group, srv.URL, "", signerFp, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := keyring.SubscribeGroup(group, srv.URL, "", signerFp, 0); err == nil {
+		t.Errorf("unexpected success while subscribing twice")
+	}
+	checkKeys(manual, signer, alice, bob)
+
+	// a key added by a group can't certify members of another group
+	aliceFp := fmt.Sprintf("%X", alice.PrimaryKey.Fingerprint)
+	if err := keyring.SubscribeGroup("other-group", srv.URL, "", aliceFp, 0); err == nil {
+		t.Errorf("unexpected success while subscribing with a group key as signer")
+	}
+
+	// bob and manual dropped from the group
+	ms.el = openpgp.EntityList{alice, mallory}
+	if err := keyring.SyncGroups(srv.URL, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkKeys(manual, signer, alice)
+
+	// groups without refresh interval are only refreshed by SyncGroups
+	ms.el = openpgp.EntityList{alice, bob}
+	if err := keyring.RefreshGroups(srv.URL, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkKeys(manual, signer, alice)
+
+	if err := keyring.UnsubscribeGroup(group); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkKeys(manual, signer)
+
+	groups, err := keyring.LoadGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("got %d groups, expected none", len(groups))
+	}
+	if err := keyring.UnsubscribeGroup(group); err == nil {
+		t.Errorf("unexpected success while unsubscribing twice")
+	}
+
+	// fresh groups are left untouched, stale groups are refreshed
+	if err := keyring.SubscribeGroup(group, srv.URL, "", signerFp, time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkKeys(manual, signer, alice, bob)
+
+	ms.el = openpgp.EntityList{alice}
+	if err := keyring.RefreshGroups(srv.URL, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkKeys(manual, signer, alice, bob)
+
+	groups, err = keyring.LoadGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups[0].Updated = groups[0].Updated.Add(-2 * time.Hour)
+	if err := keyring.storeGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.RefreshGroups(srv.URL, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkKeys(manual, signer, alice)
+
+	groups, err = keyring.LoadGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups[0].Stale(time.Now()) {
+		t.Errorf("group still stale after refresh")
+	}
+}
@@ -19,13 +19,13 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"text/tabwriter"
 	"time"
 
 	jsonresp "github.com/sylabs/json-resp"
 	"github.com/sylabs/scs-key-client/client"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/interactive"
 	"github.com/sylabs/singularity/pkg/syfs"
 	"golang.org/x/crypto/openpgp"
@@ -123,12 +123,12 @@ func (keyring *Handle) PublicPath() string {
 func ensureDirPrivate(dn string) error {
 	mode := os.FileMode(0700)
 
-	oldumask := syscall.Umask(0077)
+	oldumask := fs.Umask(0077)
 
 	err := os.MkdirAll(dn, mode)
 
 	// restore umask...
-	syscall.Umask(oldumask)
+	fs.Umask(oldumask)
 
 	// ... and check if there was an error in the os.MkdirAll call
 	if err != nil {
@@ -167,28 +167,28 @@ func ensureFilePrivate(fn string) error {
 	mode := os.FileMode(0600)
 
 	// just to be extra sure that we get the correct mode
-	oldumask := syscall.Umask(0077)
+	oldumask := fs.Umask(0077)
 
-	fs, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, mode)
+	f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, mode)
 
 	// restore umask...
-	syscall.Umask(oldumask)
+	fs.Umask(oldumask)
 
 	// ... and check if there was an error
 	if err != nil {
 		return err
 	}
-	defer fs.Close()
+	defer f.Close()
 
 	// check and fix permissions
-	fsinfo, err := fs.Stat()
+	fsinfo, err := f.Stat()
 	if err != nil {
 		return err
 	}
 
 	if currentMode := fsinfo.Mode(); currentMode != mode {
 		sylog.Warningf("File mode (%o) on %s needs to be %o, fixing that...", currentMode, fn, mode)
-		if err := fs.Chmod(mode); err != nil {
+		if err := f.Chmod(mode); err != nil {
 			return err
 		}
 	}
@@ -241,11 +241,11 @@ func (keyring *Handle) LoadPubKeyring() (openpgp.EntityList, error) {
 	return loadKeyring(keyring.PublicPath())
 }
 
-// loadKeysFromFile loads one or more keys from the specified file.
+// LoadKeysFromFile loads one or more keys from the specified file.
 //
 // The key can be either a public or private key, and the file might be
 // in binary or ascii armored format.
-func loadKeysFromFile(fn string) (openpgp.EntityList, error) {
+func LoadKeysFromFile(fn string) (openpgp.EntityList, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		return nil, err
@@ -253,17 +253,22 @@ func loadKeysFromFile(fn string) (openpgp.EntityList, error) {
 
 	defer f.Close()
 
-	if entities, err := openpgp.ReadKeyRing(f); err == nil {
+	return ReadKeys(f)
+}
+
+// ReadKeys reads one or more keys from r, in binary or ascii armored format.
+func ReadKeys(r io.ReadSeeker) (openpgp.EntityList, error) {
+	if entities, err := openpgp.ReadKeyRing(r); err == nil {
 		return entities, nil
 	}
 
 	// cannot load keys from file, perhaps it's ascii armored?
 	// rewind and try again
-	if _, err := f.Seek(0, io.SeekStart); err != nil {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
 
-	return openpgp.ReadArmoredKeyRing(f)
+	return openpgp.ReadArmoredKeyRing(r)
 }
 
 // printEntity pretty prints an entity entry to w
@@ -1111,7 +1116,7 @@ func (keyring *Handle) importPublicKey(entity *openpgp.Entity) error {
 // binary or ascii-armored format.
 func (keyring *Handle) ImportKey(kpath string) error {
 	// Load the private key as an entitylist
-	pathEntityList, err := loadKeysFromFile(kpath)
+	pathEntityList, err := LoadKeysFromFile(kpath)
 	if err != nil {
 		return fmt.Errorf("unable to get entity from: %s: %v", kpath, err)
 	}
@@ -0,0 +1,177 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package bind parses the mount specifications given with --mount, their
+// format is a comma separated list of key=value pairs compatible with the
+// Docker and Podman --mount option.
+package bind
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mount types
+const (
+	// BindType binds a host path
+	BindType = "bind"
+	// ImageType mounts a partition of an image file
+	ImageType = "image"
+	// TmpfsType mounts a new temporary filesystem
+	TmpfsType = "tmpfs"
+)
+
+var propagations = map[string]bool{
+	"private":  true,
+	"rprivate": true,
+	"shared":   true,
+	"rshared":  true,
+	"slave":    true,
+	"rslave":   true,
+}
+
+// Mount describes a mount requested with --mount.
+type Mount struct {
+	// Type is the mount type: bind, image or tmpfs
+	Type string `json:"type"`
+	// Source is the host path for bind and image mounts
+	Source string `json:"source,omitempty"`
+	// Destination is the absolute path in the container
+	Destination string `json:"destination"`
+	// ReadOnly mounts the destination read-only
+	ReadOnly bool `json:"readonly,omitempty"`
+	// Propagation is the mount propagation of a bind mount
+	Propagation string `json:"propagation,omitempty"`
+	// PartitionID is the SIF descriptor ID of the partition mounted
+	// by an image mount, the first partition is mounted if zero
+	PartitionID uint32 `json:"partitionID,omitempty"`
+	// TmpfsSize is the size limit in bytes of a tmpfs mount
+	TmpfsSize int64 `json:"tmpfsSize,omitempty"`
+	// TmpfsMode is the permission mode of the root of a tmpfs mount
+	TmpfsMode uint32 `json:"tmpfsMode,omitempty"`
+}
+
+// parseSize parses a size in bytes with an optional k, m or g suffix.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	mult := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		mult = 1 << 10
+	case "m":
+		mult = 1 << 20
+	case "g":
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// ParseMountString parses a mount specification like
+// type=bind,source=/data,destination=/mnt,ro.
+func ParseMountString(spec string) (Mount, error) {
+	m := Mount{Type: BindType}
+
+	r := csv.NewReader(strings.NewReader(spec))
+	fields, err := r.Read()
+	if err != nil {
+		return m, fmt.Errorf("malformed mount specification %q: %s", spec, err)
+	}
+
+	typeOptions := make(map[string]string)
+
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		} else if key != "ro" && key != "readonly" {
+			return m, fmt.Errorf("mount option %q requires a value", key)
+		}
+
+		switch key {
+		case "type":
+			m.Type = value
+		case "source", "src":
+			m.Source = value
+		case "destination", "dst", "target":
+			m.Destination = value
+		case "ro", "readonly":
+			m.ReadOnly = true
+			if value != "" {
+				if m.ReadOnly, err = strconv.ParseBool(value); err != nil {
+					return m, fmt.Errorf("invalid %s value %q", key, value)
+				}
+			}
+		case "bind-propagation":
+			if !propagations[value] {
+				return m, fmt.Errorf("invalid bind propagation %q", value)
+			}
+			m.Propagation = value
+			typeOptions[key] = BindType
+		case "id":
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || id == 0 {
+				return m, fmt.Errorf("invalid partition ID %q", value)
+			}
+			m.PartitionID = uint32(id)
+			typeOptions[key] = ImageType
+		case "tmpfs-size":
+			if m.TmpfsSize, err = parseSize(value); err != nil {
+				return m, fmt.Errorf("invalid tmpfs-size: %s", err)
+			}
+			typeOptions[key] = TmpfsType
+		case "tmpfs-mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || mode > 07777 {
+				return m, fmt.Errorf("invalid tmpfs-mode %q", value)
+			}
+			m.TmpfsMode = uint32(mode)
+			typeOptions[key] = TmpfsType
+		default:
+			return m, fmt.Errorf("unknown mount option %q", key)
+		}
+	}
+
+	switch m.Type {
+	case BindType, ImageType:
+		if m.Source == "" {
+			return m, fmt.Errorf("%s mount requires a source", m.Type)
+		}
+	case TmpfsType:
+		if m.Source != "" {
+			return m, fmt.Errorf("tmpfs mount doesn't accept a source")
+		}
+	default:
+		return m, fmt.Errorf("unsupported mount type %q", m.Type)
+	}
+
+	for opt, t := range typeOptions {
+		if t != m.Type {
+			return m, fmt.Errorf("%s option is only valid for %s mounts", opt, t)
+		}
+	}
+
+	if m.Destination == "" {
+		return m, fmt.Errorf("%s mount requires a destination", m.Type)
+	} else if !filepath.IsAbs(m.Destination) {
+		return m, fmt.Errorf("mount destination %s must be an absolute path", m.Destination)
+	}
+	m.Destination = filepath.Clean(m.Destination)
+
+	return m, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package bind
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMountString(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		expectError bool
+		expected    Mount
+	}{
+		{
+			name: "bind",
+			spec: "type=bind,source=/data,destination=/mnt",
+			expected: Mount{
+				Type:        BindType,
+				Source:      "/data",
+				Destination: "/mnt",
+			},
+		},
+		{
+			name: "default bind with aliases",
+			spec: "src=/data,dst=/mnt/,ro,bind-propagation=rslave",
+			expected: Mount{
+				Type:        BindType,
+				Source:      "/data",
+				Destination: "/mnt",
+				ReadOnly:    true,
+				Propagation: "rslave",
+			},
+		},
+		{
+			name: "quoted source with comma",
+			spec: `type=bind,"src=/data/a,b",target=/mnt,readonly=false`,
+			expected: Mount{
+				Type:        BindType,
+				Source:      "/data/a,b",
+				Destination: "/mnt",
+			},
+		},
+		{
+			name: "image partition",
+			spec: "type=image,src=data.sif,dst=/data,id=4",
+			expected: Mount{
+				Type:        ImageType,
+				Source:      "data.sif",
+				Destination: "/data",
+				PartitionID: 4,
+			},
+		},
+		{
+			name: "tmpfs",
+			spec: "type=tmpfs,dst=/scratch,tmpfs-size=64m,tmpfs-mode=1770",
+			expected: Mount{
+				Type:        TmpfsType,
+				Destination: "/scratch",
+				TmpfsSize:   64 << 20,
+				TmpfsMode:   01770,
+			},
+		},
+		{
+			name:        "unknown type",
+			spec:        "type=volume,src=data,dst=/data",
+			expectError: true,
+		},
+		{
+			name:        "unknown option",
+			spec:        "src=/data,dst=/data,consistency=cached",
+			expectError: true,
+		},
+		{
+			name:        "no destination",
+			spec:        "type=bind,src=/data",
+			expectError: true,
+		},
+		{
+			name:        "relative destination",
+			spec:        "type=bind,src=/data,dst=data",
+			expectError: true,
+		},
+		{
+			name:        "bind without source",
+			spec:        "type=bind,dst=/data",
+			expectError: true,
+		},
+		{
+			name:        "tmpfs with source",
+			spec:        "type=tmpfs,src=/data,dst=/data",
+			expectError: true,
+		},
+		{
+			name:        "tmpfs option on bind",
+			spec:        "type=bind,src=/data,dst=/data,tmpfs-size=1g",
+			expectError: true,
+		},
+		{
+			name:        "invalid propagation",
+			spec:        "src=/data,dst=/data,bind-propagation=all",
+			expectError: true,
+		},
+		{
+			name:        "invalid tmpfs size",
+			spec:        "type=tmpfs,dst=/data,tmpfs-size=",
+			expectError: true,
+		},
+		{
+			name:        "option without value",
+			spec:        "type,src=/data,dst=/data",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseMountString(tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success for %q", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %s", tt.spec, err)
+			}
+			if !reflect.DeepEqual(m, tt.expected) {
+				t.Errorf("unexpected mount %+v (expected %+v)", m, tt.expected)
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
 
-package crypt
+package crypt_test
 
 import (
 	"io/ioutil"
@@ -15,13 +15,14 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/test"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/squashfs"
+	"github.com/sylabs/singularity/pkg/util/crypt"
 )
 
 func TestEncrypt(t *testing.T) {
 	test.EnsurePrivilege(t)
 	defer test.ResetPrivilege(t)
 
-	dev := &Device{}
+	dev := &crypt.Device{}
 
 	emptyFile, err := ioutil.TempFile("", "")
 	if err != nil {
@@ -105,7 +106,7 @@ func TestEncrypt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			devPath, err := dev.EncryptFilesystem(tt.path, tt.key)
 			if tt.shallPass && err != nil {
-				if err == ErrUnsupportedCryptsetupVersion {
+				if err == crypt.ErrUnsupportedCryptsetupVersion {
 					t.Skip("the version of cryptsetup available is not compatible")
 				} else {
 					t.Fatalf("test %s expected to succeed but failed: %s", tt.name, err)
@@ -0,0 +1,51 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package crypt
+
+import (
+	"errors"
+)
+
+// ErrUnsupportedPlatform is the error returned by crypt device operations
+// on platforms without device-mapper support.
+var ErrUnsupportedPlatform = errors.New("crypt devices are not supported on this platform")
+
+// CloseCryptDevice is not supported on this platform.
+func (crypt *Device) CloseCryptDevice(path string) error {
+	return ErrUnsupportedPlatform
+}
+
+// EncryptFilesystem is not supported on this platform.
+func (crypt *Device) EncryptFilesystem(path string, key []byte) (string, error) {
+	return "", ErrUnsupportedPlatform
+}
+
+// Open is not supported on this platform.
+func (crypt *Device) Open(key []byte, path string) (string, error) {
+	return "", ErrUnsupportedPlatform
+}
+
+// OpenReadOnly is not supported on this platform.
+func (crypt *Device) OpenReadOnly(key []byte, path string) (string, error) {
+	return "", ErrUnsupportedPlatform
+}
+
+// FormatOverlay is not supported on this platform.
+func (crypt *Device) FormatOverlay(key, encKey []byte, path string, uid, gid int) (string, error) {
+	return "", ErrUnsupportedPlatform
+}
+
+// OverlayKeyToken is not supported on this platform.
+func (crypt *Device) OverlayKeyToken(path string) ([]byte, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// DeferredClose is not supported on this platform.
+func (crypt *Device) DeferredClose(name string) error {
+	return ErrUnsupportedPlatform
+}
@@ -17,7 +17,6 @@ import (
 	"io/ioutil"
 
 	"github.com/pkg/errors"
-	"github.com/sylabs/sif/pkg/sif"
 )
 
 var (
@@ -31,10 +30,14 @@ const (
 	Unknown = iota
 	Passphrase
 	PEM
+	Keyfile
+	PKCS11
 )
 
 // KeyInfo contains information for passing around
-// or extracting a passphrase for an encrypted container
+// or extracting a passphrase for an encrypted container.
+// Path is the PEM key or keyfile path, Material is the
+// passphrase or the PKCS#11 URI of a token private key.
 type KeyInfo struct {
 	Format   int
 	Material string
@@ -62,6 +65,14 @@ func NewPlaintextKey(k KeyInfo) ([]byte, error) {
 		// return the original value unmodified
 		return []byte(k.Material), nil
 
+	case Keyfile:
+		return loadKeyfile(k.Path)
+
+	case PKCS11:
+		// token public keys are exported in PEM format
+		// to encrypt containers
+		return nil, errors.Wrap(ErrUnsupportedKeyURI, "PKCS#11 tokens can only be used for decryption")
+
 	default:
 		return nil, ErrUnsupportedKeyURI
 	}
@@ -88,7 +99,7 @@ func EncryptKey(k KeyInfo, plaintext []byte) ([]byte, error) {
 
 		return buf.Bytes(), nil
 
-	case Passphrase:
+	case Passphrase, Keyfile:
 		return nil, nil
 
 	default:
@@ -104,19 +115,25 @@ func PlaintextKey(k KeyInfo, image string) ([]byte, error) {
 			return nil, errors.Wrap(err, "loading private key for key decryption")
 		}
 
-		pemKey, err := getEncryptionKeyFromImage(image)
+		encKey, err := getEncryptedKey(image)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encKey, nil)
 		if err != nil {
-			return nil, errors.Wrapf(err, "loading encrypted key SIF image %s", image)
+			return nil, errors.Wrapf(err, "decrypting key from image %s", image)
 		}
 
-		pemBuf := bytes.NewReader(pemKey)
+		return plaintext, nil
 
-		encKey, err := loadPEMMessage(pemBuf)
+	case PKCS11:
+		encKey, err := getEncryptedKey(image)
 		if err != nil {
-			return nil, errors.Wrapf(err, "unpacking PEM message from SIF image %s", image)
+			return nil, err
 		}
 
-		plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encKey, nil)
+		plaintext, err := pkcs11Decrypt(k.Material, encKey)
 		if err != nil {
 			return nil, errors.Wrapf(err, "decrypting key from image %s", image)
 		}
@@ -126,11 +143,123 @@ func PlaintextKey(k KeyInfo, image string) ([]byte, error) {
 	case Passphrase:
 		return []byte(k.Material), nil
 
+	case Keyfile:
+		return loadKeyfile(k.Path)
+
 	default:
 		return nil, ErrUnsupportedKeyURI
 	}
 }
 
+// NewOverlayKey returns a new key for an encrypted overlay along with
+// the PEM message holding the key encrypted with the public key of the
+// PEM private key or of the PKCS#11 token key, the encrypted key is
+// stored in the overlay image to open it later. Passphrases and keyfiles
+// are used as is and have no encrypted key.
+func NewOverlayKey(k KeyInfo) ([]byte, []byte, error) {
+	var pubKey *rsa.PublicKey
+
+	switch k.Format {
+	case Passphrase, Keyfile:
+		key, err := PlaintextKey(k, "")
+		return key, nil, err
+
+	case PEM:
+		privateKey, err := loadPEMPrivateKey(k.Path)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "loading private key for key encryption")
+		}
+		pubKey = &privateKey.PublicKey
+
+	case PKCS11:
+		var err error
+		if pubKey, err = pkcs11PublicKey(k.Material); err != nil {
+			return nil, nil, errors.Wrap(err, "reading token public key for key encryption")
+		}
+
+	default:
+		return nil, nil, ErrUnsupportedKeyURI
+	}
+
+	key, err := getRandomBytes(64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubKey, key, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encrypting key")
+	}
+
+	var buf bytes.Buffer
+
+	if err := savePEMMessage(&buf, ciphertext); err != nil {
+		return nil, nil, errors.Wrap(err, "serializing encrypted key")
+	}
+
+	return key, buf.Bytes(), nil
+}
+
+// OverlayKey returns the key of an encrypted overlay decrypted from the
+// PEM message encKey stored in the overlay image.
+func OverlayKey(k KeyInfo, encKey []byte) ([]byte, error) {
+	ciphertext, err := loadPEMMessage(bytes.NewReader(encKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "unpacking encrypted overlay key")
+	}
+
+	switch k.Format {
+	case PEM:
+		privateKey, err := loadPEMPrivateKey(k.Path)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading private key for key decryption")
+		}
+		plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, ciphertext, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "decrypting overlay key")
+		}
+		return plaintext, nil
+
+	case PKCS11:
+		plaintext, err := pkcs11Decrypt(k.Material, ciphertext)
+		if err != nil {
+			return nil, errors.Wrap(err, "decrypting overlay key")
+		}
+		return plaintext, nil
+
+	default:
+		return nil, ErrUnsupportedKeyURI
+	}
+}
+
+// getEncryptedKey returns the encrypted key stored in the SIF image.
+func getEncryptedKey(image string) ([]byte, error) {
+	pemKey, err := getEncryptionKeyFromImage(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading encrypted key SIF image %s", image)
+	}
+
+	encKey, err := loadPEMMessage(bytes.NewReader(pemKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unpacking PEM message from SIF image %s", image)
+	}
+
+	return encKey, nil
+}
+
+// loadKeyfile returns the content of the keyfile used as is, like
+// a passphrase, to unlock the container filesystem.
+func loadKeyfile(fn string) ([]byte, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading keyfile")
+	}
+	if len(b) == 0 {
+		return nil, errors.Errorf("keyfile %s is empty", fn)
+	}
+	return b, nil
+}
+
 func loadPEMPrivateKey(fn string) (*rsa.PrivateKey, error) {
 	b, err := ioutil.ReadFile(fn)
 	if err != nil {
@@ -191,53 +320,3 @@ func savePEMMessage(w io.Writer, msg []byte) error {
 
 	return pem.Encode(w, b)
 }
-
-func getEncryptionKeyFromImage(fn string) ([]byte, error) {
-	img, err := sif.LoadContainer(fn, true)
-	if err != nil {
-		return nil, errors.Wrapf(err, "loading container image from %s", fn)
-	}
-	defer img.UnloadContainer()
-
-	primDescr, _, err := img.GetPartPrimSys()
-	if err != nil {
-		return nil, errors.Wrapf(err, "retrieving primary system partition from %s", fn)
-	}
-
-	descr, _, err := img.GetLinkedDescrsByType(primDescr.ID, sif.DataCryptoMessage)
-	if err != nil {
-		return nil, errors.Wrapf(err, "retrieving linked descriptors for primary system partition from %s", fn)
-	}
-
-	for _, d := range descr {
-		format, err := d.GetFormatType()
-		if err != nil {
-			return nil, errors.Wrapf(err, "while retrieving cryptographic message format")
-		}
-
-		message, err := d.GetMessageType()
-		if err != nil {
-			return nil, errors.Wrapf(err, "while retrieving cryptographic message type")
-		}
-
-		// currently only support one type of message
-		if format != sif.FormatPEM || message != sif.MessageRSAOAEP {
-			continue
-		}
-
-		// TODO(ian): For now, assume the first linked message is what we
-		// are looking for. We should consider what we want to do in the
-		// case of multiple linked messages
-		data := d.GetData(&img)
-		if data == nil {
-			return nil, errors.Wrapf(ErrNoEncryptedKeyData, "retrieving encrypted key data from %s", fn)
-		}
-
-		key := make([]byte, len(data))
-		copy(key, data)
-
-		return key, nil
-	}
-
-	return nil, errors.Wrapf(ErrEncryptedKeyNotFound, "reading from %s", fn)
-}
@@ -0,0 +1,61 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package crypt
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sylabs/singularity/internal/pkg/sif"
+)
+
+func getEncryptionKeyFromImage(fn string) ([]byte, error) {
+	img, err := sif.LoadContainer(fn, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading container image from %s", fn)
+	}
+	defer img.UnloadContainer()
+
+	primDescr, _, err := img.GetPartPrimSys()
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieving primary system partition from %s", fn)
+	}
+
+	descr, _, err := img.GetLinkedDescrsByType(primDescr.ID, sif.DataCryptoMessage)
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieving linked descriptors for primary system partition from %s", fn)
+	}
+
+	for _, d := range descr {
+		format, err := d.GetFormatType()
+		if err != nil {
+			return nil, errors.Wrapf(err, "while retrieving cryptographic message format")
+		}
+
+		message, err := d.GetMessageType()
+		if err != nil {
+			return nil, errors.Wrapf(err, "while retrieving cryptographic message type")
+		}
+
+		// currently only support one type of message
+		if format != sif.FormatPEM || message != sif.MessageRSAOAEP {
+			continue
+		}
+
+		// TODO(ian): For now, assume the first linked message is what we
+		// are looking for. We should consider what we want to do in the
+		// case of multiple linked messages
+		data := d.GetData(&img)
+		if data == nil {
+			return nil, errors.Wrapf(ErrNoEncryptedKeyData, "retrieving encrypted key data from %s", fn)
+		}
+
+		key := make([]byte, len(data))
+		copy(key, data)
+
+		return key, nil
+	}
+
+	return nil, errors.Wrapf(ErrEncryptedKeyNotFound, "reading from %s", fn)
+}
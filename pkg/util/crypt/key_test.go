@@ -6,7 +6,15 @@
 package crypt
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -15,6 +23,7 @@ import (
 
 const (
 	invalidPemPath = "nothing"
+	invalidKeyfile = "nothing"
 	testPassphrase = "test"
 )
 
@@ -130,6 +139,11 @@ func TestPlaintextKey(t *testing.T) {
 			keyInfo:       KeyInfo{Format: PEM, Path: invalidPemPath},
 			expectedError: errors.Wrap(fmt.Errorf("open nothing: no such file or directory"), "loading private key for key decryption"),
 		},
+		{
+			name:          "invalid keyfile",
+			keyInfo:       KeyInfo{Format: Keyfile, Path: invalidKeyfile},
+			expectedError: errors.Wrap(fmt.Errorf("open nothing: no such file or directory"), "loading keyfile"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,3 +158,68 @@ func TestPlaintextKey(t *testing.T) {
 		})
 	}
 }
+
+func writePEMPrivateKey(t *testing.T, path string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %s", err)
+	}
+	b := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("failed to write private key: %s", err)
+	}
+}
+
+func TestOverlayKey(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "overlay-key-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pemPath := filepath.Join(dir, "key.pem")
+	writePEMPrivateKey(t, pemPath)
+	otherPath := filepath.Join(dir, "other.pem")
+	writePEMPrivateKey(t, otherPath)
+
+	passphrase := KeyInfo{Format: Passphrase, Material: testPassphrase}
+	key, encKey, err := NewOverlayKey(passphrase)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if string(key) != testPassphrase || encKey != nil {
+		t.Fatalf("passphrase not used as is")
+	}
+
+	keyInfo := KeyInfo{Format: PEM, Path: pemPath}
+	key, encKey, err = NewOverlayKey(keyInfo)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if encKey == nil {
+		t.Fatalf("no encrypted key returned")
+	} else if bytes.Contains(encKey, key) {
+		t.Fatalf("encrypted key contains the plaintext key")
+	}
+
+	plaintext, err := OverlayKey(keyInfo, encKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !bytes.Equal(plaintext, key) {
+		t.Fatalf("decrypted key doesn't match the overlay key")
+	}
+
+	if _, err := OverlayKey(KeyInfo{Format: PEM, Path: otherPath}, encKey); err == nil {
+		t.Fatalf("unexpected success with another private key")
+	}
+	if _, err := OverlayKey(passphrase, encKey); err == nil {
+		t.Fatalf("unexpected success with a passphrase")
+	}
+	if _, _, err := NewOverlayKey(KeyInfo{Format: PEM, Path: invalidPemPath}); err == nil {
+		t.Fatalf("unexpected success with an invalid PEM key")
+	}
+}
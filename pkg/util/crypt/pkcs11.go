@@ -0,0 +1,225 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const pkcs11Scheme = "pkcs11:"
+
+// pkcs11PinEnv is the environment variable passing the token PIN to
+// pkcs11-tool, the PIN is never passed as an argument which would be
+// visible to other users.
+const pkcs11PinEnv = "SINGULARITY_PKCS11_PIN"
+
+// pkcs11URI holds the attributes of a PKCS#11 URI as described
+// in RFC 7512 which are used to select the token private key.
+type pkcs11URI struct {
+	token     string
+	object    string
+	id        []byte
+	module    string
+	pin       string
+	pinSource string
+}
+
+// parsePKCS11URI parses a PKCS#11 URI, the module-path query attribute
+// is required to load the token library.
+func parsePKCS11URI(uri string) (*pkcs11URI, error) {
+	if !strings.HasPrefix(uri, pkcs11Scheme) {
+		return nil, errors.Wrapf(ErrUnsupportedKeyURI, "%q is not a PKCS#11 URI", uri)
+	}
+
+	p := new(pkcs11URI)
+
+	path := strings.TrimPrefix(uri, pkcs11Scheme)
+	query := ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+
+	attrs := func(s, sep string, set func(k, v string) error) error {
+		for _, attr := range strings.Split(s, sep) {
+			if attr == "" {
+				continue
+			}
+			kv := strings.SplitN(attr, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("malformed PKCS#11 URI attribute %q", attr)
+			}
+			v, err := url.PathUnescape(kv[1])
+			if err != nil {
+				return fmt.Errorf("malformed PKCS#11 URI attribute %q: %s", attr, err)
+			}
+			if err := set(kv[0], v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := attrs(path, ";", func(k, v string) error {
+		switch k {
+		case "token":
+			p.token = v
+		case "object":
+			p.object = v
+		case "id":
+			p.id = []byte(v)
+		case "type":
+			if v != "private" {
+				return fmt.Errorf("PKCS#11 URI must reference a private key")
+			}
+		default:
+			sylog.Debugf("Ignoring PKCS#11 URI attribute %s", k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = attrs(query, "&", func(k, v string) error {
+		switch k {
+		case "module-path":
+			p.module = v
+		case "pin-value":
+			p.pin = v
+		case "pin-source":
+			p.pinSource = strings.TrimPrefix(v, "file:")
+		default:
+			sylog.Debugf("Ignoring PKCS#11 URI query attribute %s", k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.module == "" {
+		return nil, fmt.Errorf("PKCS#11 URI requires a module-path attribute")
+	}
+	if p.object == "" && p.id == nil {
+		return nil, fmt.Errorf("PKCS#11 URI requires an object or id attribute")
+	}
+
+	return p, nil
+}
+
+// args returns the pkcs11-tool arguments selecting the token private key
+// and the environment variables they reference.
+func (p *pkcs11URI) args() ([]string, []string, error) {
+	args := []string{"--module", p.module}
+
+	if p.token != "" {
+		args = append(args, "--token-label", p.token)
+	}
+	if p.id != nil {
+		args = append(args, "--id", hex.EncodeToString(p.id))
+	}
+	if p.object != "" {
+		args = append(args, "--label", p.object)
+	}
+
+	pin := p.pin
+	if p.pinSource != "" {
+		b, err := ioutil.ReadFile(p.pinSource)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "reading PKCS#11 PIN")
+		}
+		pin = strings.TrimRight(string(b), "\r\n")
+	}
+
+	var env []string
+	if pin != "" {
+		args = append(args, "--login", "--pin", "env:"+pkcs11PinEnv)
+		env = append(env, pkcs11PinEnv+"="+pin)
+	}
+
+	return args, env, nil
+}
+
+// PKCS11Tool runs pkcs11-tool with the arguments selecting the token
+// key referenced by the PKCS#11 URI followed by args, and returns its
+// output. The token library is loaded by pkcs11-tool running with the
+// real user and group IDs of the calling process.
+func PKCS11Tool(uri string, stdin []byte, args ...string) ([]byte, error) {
+	p, err := parsePKCS11URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	tool, err := exec.LookPath("pkcs11-tool")
+	if err != nil {
+		return nil, errors.Wrap(err, "looking for pkcs11-tool")
+	}
+
+	keyArgs, env, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(tool, append(keyArgs, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = realUserAttr()
+
+	sylog.Debugf("Running pkcs11-tool with PKCS#11 module %s", p.module)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pkcs11-tool failed: %s: %s", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// pkcs11Decrypt decrypts the RSA-OAEP encrypted key with the private
+// key stored in the token referenced by the PKCS#11 URI, the private
+// key never leaves the token.
+func pkcs11Decrypt(uri string, ciphertext []byte) ([]byte, error) {
+	return PKCS11Tool(uri, ciphertext,
+		"--decrypt",
+		"--mechanism", "RSA-PKCS-OAEP",
+		"--hash-algorithm", "SHA256",
+		"--mgf", "MGF1-SHA256",
+	)
+}
+
+// pkcs11PublicKey returns the RSA public key of the token key pair
+// referenced by the PKCS#11 URI.
+func pkcs11PublicKey(uri string) (*rsa.PublicKey, error) {
+	der, err := PKCS11Tool(uri, nil, "--read-object", "--type", "pubkey")
+	if err != nil {
+		return nil, err
+	}
+
+	// recent pkcs11-tool versions export a SubjectPublicKeyInfo,
+	// older ones the raw PKCS#1 public key
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("token public key is not an RSA key")
+		}
+		return rsaPub, nil
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
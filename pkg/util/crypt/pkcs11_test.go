@@ -0,0 +1,119 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package crypt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	tests := []struct {
+		name        string
+		uri         string
+		expectError bool
+		expected    *pkcs11URI
+	}{
+		{
+			name:        "not a PKCS#11 URI",
+			uri:         "file:///tmp/key.pem",
+			expectError: true,
+		},
+		{
+			name:        "no module path",
+			uri:         "pkcs11:object=key",
+			expectError: true,
+		},
+		{
+			name:        "no object",
+			uri:         "pkcs11:token=hsm?module-path=/usr/lib/softhsm/libsofthsm2.so",
+			expectError: true,
+		},
+		{
+			name:        "public key",
+			uri:         "pkcs11:object=key;type=public?module-path=/usr/lib/softhsm/libsofthsm2.so",
+			expectError: true,
+		},
+		{
+			name:        "malformed attribute",
+			uri:         "pkcs11:object?module-path=/usr/lib/softhsm/libsofthsm2.so",
+			expectError: true,
+		},
+		{
+			name: "full",
+			uri:  "pkcs11:token=My%20HSM;id=%01%02;object=key;type=private;manufacturer=x?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+			expected: &pkcs11URI{
+				token:  "My HSM",
+				object: "key",
+				id:     []byte{1, 2},
+				module: "/usr/lib/softhsm/libsofthsm2.so",
+				pin:    "1234",
+			},
+		},
+		{
+			name: "pin source",
+			uri:  "pkcs11:object=key?pin-source=file:/run/pin&module-path=/lib/p11.so",
+			expected: &pkcs11URI{
+				object:    "key",
+				module:    "/lib/p11.so",
+				pinSource: "/run/pin",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePKCS11URI(tt.uri)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("unexpected success for %s", tt.uri)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(p, tt.expected) {
+				t.Errorf("got %+v, expected %+v", p, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPKCS11Args(t *testing.T) {
+	p := &pkcs11URI{
+		token:  "hsm",
+		object: "key",
+		id:     []byte{0xab},
+		module: "/lib/p11.so",
+		pin:    "1234",
+	}
+	expected := []string{
+		"--module", "/lib/p11.so",
+		"--token-label", "hsm",
+		"--id", "ab",
+		"--label", "key",
+		"--login", "--pin", "env:" + pkcs11PinEnv,
+	}
+	expectedEnv := []string{pkcs11PinEnv + "=1234"}
+
+	args, env, err := p.args()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("got %v, expected %v", args, expected)
+	}
+	if !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("got environment %v, expected %v", env, expectedEnv)
+	}
+	for _, a := range args {
+		if strings.Contains(a, p.pin) {
+			t.Errorf("PIN passed as argument %q", a)
+		}
+	}
+}
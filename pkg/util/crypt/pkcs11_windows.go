@@ -0,0 +1,16 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package crypt
+
+import (
+	"syscall"
+)
+
+// realUserAttr returns no attributes, pkcs11-tool runs with the
+// credentials of the calling process.
+func realUserAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package errcode provides errors carrying a stable error code, allowing
+// scripts to distinguish failures by exit code or JSON output rather than
+// by matching error messages.
+package errcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Code identifies a class of error with a stable name and exit code.
+type Code int
+
+const (
+	// Unknown is the code of errors which don't carry an error code.
+	Unknown Code = iota
+	// InvalidArgument is used for command line usage errors.
+	InvalidArgument
+	// ImageNotFound is used when an image can't be found locally or remotely.
+	ImageNotFound
+	// ImageFormat is used when an image format is not recognized or corrupted.
+	ImageFormat
+	// PermissionDenied is used when an operation is not permitted to the user.
+	PermissionDenied
+	// LoopDeviceExhausted is used when no loop device is available.
+	LoopDeviceExhausted
+	// InstanceNotFound is used when a named instance doesn't exist.
+	InstanceNotFound
+	// Configuration is used when a configuration file is invalid.
+	Configuration
+	// NoSpace is used when a filesystem set up by Singularity is full.
+	NoSpace
+)
+
+var codes = map[Code]struct {
+	name     string
+	exitCode int
+}{
+	Unknown:             {"UNKNOWN", 255},
+	InvalidArgument:     {"INVALID_ARGUMENT", 1},
+	ImageNotFound:       {"IMAGE_NOT_FOUND", 254},
+	ImageFormat:         {"IMAGE_FORMAT", 253},
+	PermissionDenied:    {"PERMISSION_DENIED", 252},
+	LoopDeviceExhausted: {"LOOP_DEVICE_EXHAUSTED", 251},
+	InstanceNotFound:    {"INSTANCE_NOT_FOUND", 250},
+	Configuration:       {"CONFIGURATION", 249},
+	NoSpace:             {"NO_SPACE", 248},
+}
+
+// String returns the stable name of the error code.
+func (c Code) String() string {
+	if d, ok := codes[c]; ok {
+		return d.name
+	}
+	return codes[Unknown].name
+}
+
+// ExitCode returns the process exit code associated to the error code.
+func (c Code) ExitCode() int {
+	if d, ok := codes[c]; ok {
+		return d.exitCode
+	}
+	return codes[Unknown].exitCode
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Code) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Lookup returns the error code corresponding to the name.
+func Lookup(name string) (Code, bool) {
+	for c, d := range codes {
+		if d.name == name {
+			return c, true
+		}
+	}
+	return Unknown, false
+}
+
+// Error is an error carrying an error code, it can optionally
+// wrap an underlying error.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the wrapped error if any.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error with the provided code and formatted message.
+func New(code Code, format string, a ...interface{}) error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// Wrap returns an error wrapping err with a formatted message prefix,
+// the returned error message is formatted as "message: err". If code
+// is Unknown, the code carried by err is preserved.
+func Wrap(code Code, err error, format string, a ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	if code == Unknown {
+		code = CodeOf(err)
+	}
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+		Err:     err,
+	}
+}
+
+// CodeOf returns the first error code found in the chain of
+// wrapped errors, or Unknown if none of them carries a code.
+func CodeOf(err error) Code {
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.Code != Unknown {
+			return e.Code
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return Unknown
+}
+
+// ExitCode returns the process exit code associated to err.
+func ExitCode(err error) int {
+	return CodeOf(err).ExitCode()
+}
+
+// encodeSep separates the error code name from the message in
+// an encoded error.
+const encodeSep = "|"
+
+// Encode returns an error whose message embeds the error code
+// so it survives transports carrying only error strings, like
+// net/rpc. Decode must be used on the receiving side.
+func Encode(err error) error {
+	if err == nil {
+		return nil
+	}
+	code := CodeOf(err)
+	if code == Unknown {
+		return err
+	}
+	return fmt.Errorf("%s%s%s", code, encodeSep, err)
+}
+
+// Decode returns the coded error corresponding to an error
+// previously encoded with Encode, if err wasn't encoded it is
+// returned as is.
+func Decode(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	i := strings.Index(msg, encodeSep)
+	if i < 0 {
+		return err
+	}
+	code, ok := Lookup(msg[:i])
+	if !ok {
+		return err
+	}
+	return &Error{Code: code, Message: msg[i+len(encodeSep):]}
+}
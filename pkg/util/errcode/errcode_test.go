@@ -0,0 +1,129 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package errcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	notFound := New(ImageNotFound, "image %s not found", "test.sif")
+
+	tests := []struct {
+		name     string
+		err      error
+		code     Code
+		exitCode int
+		message  string
+	}{
+		{
+			name:     "nil error",
+			err:      nil,
+			code:     Unknown,
+			exitCode: 255,
+		},
+		{
+			name:     "uncoded error",
+			err:      fmt.Errorf("some error"),
+			code:     Unknown,
+			exitCode: 255,
+			message:  "some error",
+		},
+		{
+			name:     "coded error",
+			err:      notFound,
+			code:     ImageNotFound,
+			exitCode: 254,
+			message:  "image test.sif not found",
+		},
+		{
+			name:     "wrapped preserving code",
+			err:      Wrap(Unknown, notFound, "while starting container"),
+			code:     ImageNotFound,
+			exitCode: 254,
+			message:  "while starting container: image test.sif not found",
+		},
+		{
+			name:     "wrapped overriding code",
+			err:      Wrap(PermissionDenied, fmt.Errorf("EPERM"), "open failed"),
+			code:     PermissionDenied,
+			exitCode: 252,
+			message:  "open failed: EPERM",
+		},
+		{
+			name:     "wrapped without message",
+			err:      Wrap(InvalidArgument, fmt.Errorf("bad flag"), ""),
+			code:     InvalidArgument,
+			exitCode: 1,
+			message:  "bad flag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := CodeOf(tt.err); code != tt.code {
+				t.Errorf("unexpected code: got %s, expected %s", code, tt.code)
+			}
+			if exitCode := ExitCode(tt.err); exitCode != tt.exitCode {
+				t.Errorf("unexpected exit code: got %d, expected %d", exitCode, tt.exitCode)
+			}
+			if tt.err != nil && tt.err.Error() != tt.message {
+				t.Errorf("unexpected message: got %q, expected %q", tt.err.Error(), tt.message)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	err := Wrap(Unknown, New(LoopDeviceExhausted, "no loop devices available"), "attach failed")
+
+	// simulate a transport keeping only error message
+	transported := fmt.Errorf("%s", Encode(err))
+
+	decoded := Decode(transported)
+	if CodeOf(decoded) != LoopDeviceExhausted {
+		t.Errorf("unexpected code after decoding: %s", CodeOf(decoded))
+	}
+	if decoded.Error() != err.Error() {
+		t.Errorf("unexpected message after decoding: got %q, expected %q", decoded.Error(), err.Error())
+	}
+
+	plain := fmt.Errorf("plain|error")
+	if Encode(plain) != plain {
+		t.Errorf("uncoded error should not be encoded")
+	}
+	if Decode(plain) != plain {
+		t.Errorf("unencoded error should be returned as is")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := New(InstanceNotFound, "no instance found with name test")
+	if e := WriteJSON(&buf, err); e != nil {
+		t.Fatalf("unexpected error: %s", e)
+	}
+
+	var report struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	if e := json.Unmarshal(buf.Bytes(), &report); e != nil {
+		t.Fatalf("unexpected error while decoding JSON: %s", e)
+	}
+	if report.Error["code"] != "INSTANCE_NOT_FOUND" {
+		t.Errorf("unexpected code: %v", report.Error["code"])
+	}
+	if report.Error["exitCode"] != float64(250) {
+		t.Errorf("unexpected exit code: %v", report.Error["exitCode"])
+	}
+	if report.Error["message"] != err.Error() {
+		t.Errorf("unexpected message: %v", report.Error["message"])
+	}
+}
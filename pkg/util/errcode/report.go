@@ -0,0 +1,72 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package errcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const jsonEnv = "SINGULARITY_JSON_ERRORS"
+
+var jsonOutput = os.Getenv(jsonEnv) == "1"
+
+// Report is the JSON representation of an error.
+type Report struct {
+	Code     Code   `json:"code"`
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message"`
+}
+
+// NewReport returns the report corresponding to err.
+func NewReport(err error) Report {
+	code := CodeOf(err)
+	return Report{
+		Code:     code,
+		ExitCode: code.ExitCode(),
+		Message:  err.Error(),
+	}
+}
+
+// WriteJSON writes the JSON report corresponding to err to w.
+func WriteJSON(w io.Writer, err error) error {
+	return json.NewEncoder(w).Encode(struct {
+		Error Report `json:"error"`
+	}{NewReport(err)})
+}
+
+// SetJSON enables or disables JSON output of fatal errors.
+func SetJSON(enabled bool) {
+	jsonOutput = enabled
+}
+
+// GetEnvVar returns a formatted environment variable string which
+// can later be interpreted by a child process to report errors the
+// same way.
+func GetEnvVar() string {
+	if jsonOutput {
+		return jsonEnv + "=1"
+	}
+	return jsonEnv + "=0"
+}
+
+// Fatal reports err on the standard error, as a JSON object if JSON
+// output was enabled, and exits with the exit code associated to err.
+// Code that may be imported by other projects should NOT use Fatal.
+func Fatal(err error) {
+	code := ExitCode(err)
+	if jsonOutput {
+		if e := WriteJSON(os.Stderr, err); e != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		os.Exit(code)
+	}
+	sylog.FatalCodef(code, "%s", err)
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package lock
+
+// Exclusive is not supported on this platform and returns
+// ErrLockNotSupported.
+func Exclusive(path string) (fd int, err error) {
+	return -1, ErrLockNotSupported
+}
+
+// Release is not supported on this platform and returns
+// ErrLockNotSupported.
+func Release(fd int) error {
+	return ErrLockNotSupported
+}
+
+// Lock is not supported on this platform and returns
+// ErrLockNotSupported.
+func (r *ByteRange) Lock() error {
+	return ErrLockNotSupported
+}
+
+// RLock is not supported on this platform and returns
+// ErrLockNotSupported.
+func (r *ByteRange) RLock() error {
+	return ErrLockNotSupported
+}
+
+// Unlock is not supported on this platform and returns
+// ErrLockNotSupported.
+func (r *ByteRange) Unlock() error {
+	return ErrLockNotSupported
+}
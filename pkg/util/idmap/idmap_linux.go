@@ -0,0 +1,206 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package idmap creates idmapped bind mounts, the owner of the files of
+// an idmapped mount is mapped through the ID mappings of a user namespace.
+package idmap
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// system calls introduced with the new mount API, their numbers
+// are the same on all supported architectures
+const (
+	sysOpenTree     = 428
+	sysMoveMount    = 429
+	sysMountSetattr = 442
+)
+
+const (
+	openTreeClone       = 0x1
+	atEmptyPath         = 0x1000
+	atRecursive         = 0x8000
+	moveMountFEmptyPath = 0x4
+	mountAttrIdmap      = 0x100000
+)
+
+// mountAttr is the mount_attr structure passed to mount_setattr.
+type mountAttr struct {
+	attrSet     uint64
+	attrClr     uint64
+	propagation uint64
+	usernsFd    uint64
+}
+
+var (
+	probeOnce sync.Once
+	supported bool
+)
+
+// Supported returns if the kernel provides idmapped mounts, they were
+// introduced in Linux 5.12. Filesystems may still not support them.
+func Supported() bool {
+	probeOnce.Do(func() {
+		// with an invalid file descriptor mount_setattr fails with
+		// EBADF if available and ENOSYS otherwise
+		fd := -1
+		attr := mountAttr{attrSet: mountAttrIdmap}
+		empty := []byte{0}
+		_, _, errno := syscall.Syscall6(
+			sysMountSetattr,
+			uintptr(fd),
+			uintptr(unsafe.Pointer(&empty[0])),
+			atEmptyPath,
+			uintptr(unsafe.Pointer(&attr)),
+			unsafe.Sizeof(attr),
+			0,
+		)
+		supported = errno != syscall.ENOSYS
+	})
+	return supported
+}
+
+// BindMount bind mounts source on target with the ownership of files
+// mapped through the user namespace userns. The source is recursively
+// bind mounted if recursive is true.
+func BindMount(source, target, userns string, recursive bool) error {
+	tree, err := OpenTree(source, userns, recursive)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(tree)
+
+	return MoveMount(tree, target)
+}
+
+// OpenTree returns a file descriptor referencing a detached bind mount
+// of source with the ownership of files mapped through the user namespace
+// userns, the mount is attached with MoveMount. Idmapped mounts require
+// CAP_SYS_ADMIN in the user namespace owning the source filesystem, the
+// user namespace userns is only used for the ID mappings.
+func OpenTree(source, userns string, recursive bool) (int, error) {
+	nsfd, err := syscall.Open(userns, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("could not open user namespace %s: %s", userns, err)
+	}
+	defer syscall.Close(nsfd)
+
+	flags := uintptr(openTreeClone | syscall.O_CLOEXEC)
+	attrFlags := uintptr(atEmptyPath)
+	if recursive {
+		flags |= atRecursive
+		attrFlags |= atRecursive
+	}
+
+	src, err := syscall.BytePtrFromString(source)
+	if err != nil {
+		return -1, err
+	}
+	cwd := unix.AT_FDCWD
+	tree, _, errno := syscall.Syscall(sysOpenTree, uintptr(cwd), uintptr(unsafe.Pointer(src)), flags)
+	if errno != 0 {
+		return -1, errno
+	}
+
+	empty := []byte{0}
+	attr := mountAttr{
+		attrSet:  mountAttrIdmap,
+		usernsFd: uint64(nsfd),
+	}
+	_, _, errno = syscall.Syscall6(
+		sysMountSetattr,
+		tree,
+		uintptr(unsafe.Pointer(&empty[0])),
+		attrFlags,
+		uintptr(unsafe.Pointer(&attr)),
+		unsafe.Sizeof(attr),
+		0,
+	)
+	if errno != 0 {
+		syscall.Close(int(tree))
+		return -1, errno
+	}
+	return int(tree), nil
+}
+
+// MoveMount attaches the detached mount referenced by the file
+// descriptor tree on target, target must be in the mount namespace
+// of the calling process.
+func MoveMount(tree int, target string) error {
+	dst, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	empty := []byte{0}
+	cwd := unix.AT_FDCWD
+	_, _, errno := syscall.Syscall6(
+		sysMoveMount,
+		uintptr(tree),
+		uintptr(unsafe.Pointer(&empty[0])),
+		uintptr(cwd),
+		uintptr(unsafe.Pointer(dst)),
+		moveMountFEmptyPath,
+		0,
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// UserNamespace is a user namespace held by a child process, it provides
+// the ID mappings of idmapped mounts.
+type UserNamespace struct {
+	// Path is the path of the user namespace, valid until Close
+	// is called.
+	Path string
+
+	cmd   *exec.Cmd
+	stdin io.Closer
+}
+
+// NewUserNamespace creates a user namespace mapping only the user ID uid
+// and the group ID gid to themselves. Through an idmapped mount using it,
+// files owned by uid and gid keep their owner while all other owners are
+// unmapped, files can't be created with other owners.
+func NewUserNamespace(uid, gid int) (*UserNamespace, error) {
+	// the child process waits for its standard input to be closed,
+	// which also happens if the calling process exits
+	cmd := exec.Command("/bin/cat")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		return nil, fmt.Errorf("could not create user namespace: %s", err)
+	}
+
+	return &UserNamespace{
+		Path:  fmt.Sprintf("/proc/%d/ns/user", cmd.Process.Pid),
+		cmd:   cmd,
+		stdin: stdin,
+	}, nil
+}
+
+// Close terminates the process holding the user namespace, idmapped
+// mounts already created keep their ID mappings.
+func (u *UserNamespace) Close() error {
+	u.stdin.Close()
+	return u.cmd.Wait()
+}
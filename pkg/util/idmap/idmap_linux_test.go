@@ -0,0 +1,145 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package idmap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestBindMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idmap-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := BindMount(dir, dir, "/non/existent/ns/user", false); err == nil {
+		t.Errorf("unexpected success with a non existent user namespace")
+	}
+
+	if !Supported() {
+		t.Skip("idmapped mounts not supported by kernel")
+	}
+	if err := BindMount("/non/existent", dir, "/proc/self/ns/user", false); err == nil {
+		t.Errorf("unexpected success with a non existent source")
+	}
+}
+
+func TestNewUserNamespace(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+
+	ns, err := NewUserNamespace(uid, gid)
+	if err != nil {
+		t.Skipf("could not create user namespace: %s", err)
+	}
+	defer ns.Close()
+
+	for _, m := range []struct {
+		file string
+		id   int
+	}{
+		{"uid_map", uid},
+		{"gid_map", gid},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filepath.Dir(ns.Path)), m.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := strings.Fields(string(b))
+		expected := []string{strconv.Itoa(m.id), strconv.Itoa(m.id), "1"}
+		if strings.Join(fields, " ") != strings.Join(expected, " ") {
+			t.Errorf("got %s %q, expected %q", m.file, fields, expected)
+		}
+	}
+
+	if err := ns.Close(); err != nil {
+		t.Errorf("unexpected error while closing user namespace: %s", err)
+	}
+}
+
+func TestBindMountMapping(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	if !Supported() {
+		t.Skip("idmapped mounts not supported by kernel")
+	}
+
+	dir, err := ioutil.TempDir("", "idmap-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(dir, "target")
+	for _, d := range []string{source, target} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the temporary directory filesystem may not support idmapped mounts
+	if err := syscall.Mount("tmpfs", source, "tmpfs", 0, "mode=0755"); err != nil {
+		t.Fatalf("could not mount tmpfs on %s: %s", source, err)
+	}
+	defer syscall.Unmount(source, syscall.MNT_DETACH)
+
+	file := filepath.Join(source, "file")
+	if err := ioutil.WriteFile(file, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(file, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mappings are those of a user namespace held by a child process
+	const hostID = 100000
+
+	cmd := exec.Command("/bin/cat")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostID, Size: 65536}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostID, Size: 65536}},
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("could not create user namespace: %s", err)
+	}
+	defer func() {
+		stdin.Close()
+		cmd.Wait()
+	}()
+
+	userns := fmt.Sprintf("/proc/%d/ns/user", cmd.Process.Pid)
+	if err := BindMount(source, target, userns, false); err == syscall.EINVAL {
+		t.Skip("idmapped mounts not supported by tmpfs")
+	} else if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer syscall.Unmount(target, syscall.MNT_DETACH)
+
+	fi, err := os.Stat(filepath.Join(target, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if st.Uid != hostID || st.Gid != hostID {
+		t.Errorf("file owned by %d:%d, expected %d:%d", st.Uid, st.Gid, hostID, hostID)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package ldcache lists the host libraries known by the dynamic linker
+// cache.
+package ldcache
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// entryRegexp matches the library entries of ldconfig -p output:
+// libnvidia-ml.so.1 (libc6,x86-64) => /usr/lib64/nvidia/libnvidia-ml.so.1
+var entryRegexp = regexp.MustCompile(`(?m)^(.*)\s*\(.*\)\s*=>\s*(.*)$`)
+
+// Load runs ldconfig -p and returns a map of the library paths with
+// their associated library name.
+func Load() (map[string]string, error) {
+	ldConfig, err := exec.LookPath("ldconfig")
+	if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
+		sylog.Debugf("Could not find ldconfig in PATH")
+		ldConfig = "/sbin/ldconfig"
+	} else if err != nil {
+		return nil, fmt.Errorf("could not lookup ldconfig: %v", err)
+	}
+
+	out, err := exec.Command(ldConfig, "-p").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not execute ldconfig: %v", err)
+	}
+	return Parse(out), nil
+}
+
+// Parse parses ldconfig -p output and returns a map of the library
+// paths with their associated library name.
+func Parse(out []byte) map[string]string {
+	cache := make(map[string]string)
+	for _, match := range entryRegexp.FindAllSubmatch(bytes.TrimSpace(out), -1) {
+		libName := strings.TrimSpace(string(match[1]))
+		libPath := strings.TrimSpace(string(match[2]))
+		cache[libPath] = libName
+	}
+	return cache
+}
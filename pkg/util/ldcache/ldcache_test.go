@@ -0,0 +1,28 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ldcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	out := []byte(`1024 libs found in cache ` + "`/etc/ld.so.cache'" + `
+	libamdhip64.so.4 (libc6,x86-64) => /opt/rocm/lib/libamdhip64.so.4
+	libhsa-runtime64.so.1 (libc6,x86-64) => /opt/rocm/lib/libhsa-runtime64.so.1
+	libc.so.6 (libc6,x86-64, OS ABI: Linux 3.2.0) => /lib/x86_64-linux-gnu/libc.so.6
+`)
+
+	expected := map[string]string{
+		"/opt/rocm/lib/libamdhip64.so.4":      "libamdhip64.so.4",
+		"/opt/rocm/lib/libhsa-runtime64.so.1": "libhsa-runtime64.so.1",
+		"/lib/x86_64-linux-gnu/libc.so.6":     "libc.so.6",
+	}
+	if cache := Parse(out); !reflect.DeepEqual(cache, expected) {
+		t.Errorf("got %v, expected %v", cache, expected)
+	}
+}
@@ -5,11 +5,21 @@
 
 package loop
 
+import (
+	"github.com/sylabs/singularity/pkg/util/errcode"
+)
+
+// ErrNoDevice is returned when all loop devices are in use.
+var ErrNoDevice = errcode.New(errcode.LoopDeviceExhausted, "no loop devices available")
+
 // Device describes a loop device
 type Device struct {
 	MaxLoopDevices int
 	Shared         bool
-	Info           *Info64
+	// DirectIO enables direct I/O on the backing file of attached
+	// devices, bypassing the page cache of the host filesystem
+	DirectIO bool
+	Info     *Info64
 }
 
 // Loop device flags values
@@ -48,6 +58,13 @@ const (
 	CmdSetDirectIO = 0x4C08
 )
 
+// Loop control device IOCTL commands
+const (
+	CmdCtlAdd     = 0x4C80
+	CmdCtlRemove  = 0x4C81
+	CmdCtlGetFree = 0x4C82
+)
+
 // Info64 contains information about a loop device.
 type Info64 struct {
 	Device         uint64
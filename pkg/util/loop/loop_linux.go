@@ -14,6 +14,14 @@ import (
 	"github.com/sylabs/singularity/pkg/util/fs/lock"
 )
 
+const (
+	// controlPath is the loop control device allocating loop devices
+	controlPath = "/dev/loop-control"
+	// maxGetFreeAttempts is the number of free loop devices tried
+	// when they are concurrently attached by other processes
+	maxGetFreeAttempts = 10
+)
+
 // AttachFromFile finds a free loop device, opens it, and stores file descriptor
 // provided by image file pointer
 func (loop *Device) AttachFromFile(image *os.File, mode int, number *int) error {
@@ -51,20 +59,12 @@ func (loop *Device) AttachFromFile(image *os.File, mode int, number *int) error
 					continue
 				}
 			}
-			return fmt.Errorf("no loop devices available")
+			return ErrNoDevice
 		}
 
 		path = fmt.Sprintf("/dev/loop%d", device)
-		if fi, err := os.Stat(path); err != nil {
-			dev := int((7 << 8) | (device & 0xff) | ((device & 0xfff00) << 12))
-			esys := syscall.Mknod(path, syscall.S_IFBLK|0660, dev)
-			if errno, ok := esys.(syscall.Errno); ok {
-				if errno != syscall.EEXIST {
-					return esys
-				}
-			}
-		} else if fi.Mode()&os.ModeDevice == 0 {
-			return fmt.Errorf("%s is not a block device", path)
+		if err := createDevice(path, device); err != nil {
+			return err
 		}
 
 		if loopFd, err = syscall.Open(path, mode, 0600); err != nil {
@@ -105,9 +105,133 @@ func (loop *Device) AttachFromFile(image *os.File, mode int, number *int) error
 		return fmt.Errorf("failed to set loop flags on loop device: %s", syscall.Errno(err))
 	}
 
+	if loop.DirectIO {
+		if err := SetDirectIO(uintptr(loopFd), true); err != nil {
+			return fmt.Errorf("failed to enable direct I/O on loop device %s: %s", path, err)
+		}
+	}
+
 	return nil
 }
 
+// AttachEphemeral attaches the image file to a free loop device allocated
+// by the loop control device and returns the opened loop device. Ephemeral
+// devices are never shared and have the autoclear flag set, the kernel
+// detaches them once the returned file is closed and the last mount using
+// them is gone. Direct I/O is enabled if DirectIO is set
+func (loop *Device) AttachEphemeral(image *os.File, mode int, number *int) (*os.File, error) {
+	if image == nil {
+		return nil, fmt.Errorf("empty file pointer")
+	}
+
+	info := Info64{}
+	if loop.Info != nil {
+		info = *loop.Info
+	}
+	info.Flags |= FlagsAutoClear
+
+	ctl, err := os.OpenFile(controlPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open loop control device: %s", err)
+	}
+	defer ctl.Close()
+
+	// LOOP_CTL_GET_FREE doesn't reserve the device, another process
+	// may attach it before us
+	for attempt := 0; attempt < maxGetFreeAttempts; attempt++ {
+		device, _, esys := syscall.Syscall(syscall.SYS_IOCTL, ctl.Fd(), CmdCtlGetFree, 0)
+		if esys == syscall.ENOSPC {
+			return nil, ErrNoDevice
+		} else if esys != 0 {
+			return nil, fmt.Errorf("failed to get a free loop device: %s", esys)
+		}
+
+		path := fmt.Sprintf("/dev/loop%d", device)
+		if err := createDevice(path, int(device)); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, mode, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open loop device %s: %s", path, err)
+		}
+
+		if _, _, esys := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), CmdSetFd, image.Fd()); esys == syscall.EBUSY {
+			f.Close()
+			continue
+		} else if esys != 0 {
+			f.Close()
+			return nil, fmt.Errorf("failed to attach image to loop device %s: %s", path, esys)
+		}
+
+		if _, _, esys := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), CmdSetStatus64, uintptr(unsafe.Pointer(&info))); esys != 0 {
+			DetachFromFd(f.Fd())
+			f.Close()
+			return nil, fmt.Errorf("failed to set loop flags on loop device %s: %s", path, esys)
+		}
+
+		if loop.DirectIO {
+			if err := SetDirectIO(f.Fd(), true); err != nil {
+				DetachFromFd(f.Fd())
+				f.Close()
+				return nil, fmt.Errorf("failed to enable direct I/O on loop device %s: %s", path, err)
+			}
+		}
+
+		*number = int(device)
+		return f, nil
+	}
+
+	return nil, ErrNoDevice
+}
+
+// createDevice creates the block device node of the loop device number if
+// it doesn't exist
+func createDevice(path string, number int) error {
+	if fi, err := os.Stat(path); err != nil {
+		dev := int((7 << 8) | (number & 0xff) | ((number & 0xfff00) << 12))
+		esys := syscall.Mknod(path, syscall.S_IFBLK|0660, dev)
+		if errno, ok := esys.(syscall.Errno); ok {
+			if errno != syscall.EEXIST {
+				return esys
+			}
+		}
+	} else if fi.Mode()&os.ModeDevice == 0 {
+		return fmt.Errorf("%s is not a block device", path)
+	}
+	return nil
+}
+
+// SetDirectIO enables or disables direct I/O on an opened loop device
+func SetDirectIO(fd uintptr, enable bool) error {
+	arg := uintptr(0)
+	if enable {
+		arg = 1
+	}
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, fd, CmdSetDirectIO, arg); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// DetachFromFd detaches the image of an opened loop device, if the device
+// is still in use the kernel sets the autoclear flag instead
+func DetachFromFd(fd uintptr) error {
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, fd, CmdClrFd, 0); err != 0 && err != syscall.ENXIO {
+		return fmt.Errorf("failed to detach loop device: %s", err)
+	}
+	return nil
+}
+
+// DetachFromPath detaches the image of a loop device from path
+func DetachFromPath(path string) error {
+	loop, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open loop device %s: %s", path, err)
+	}
+	defer loop.Close()
+	return DetachFromFd(loop.Fd())
+}
+
 // AttachFromPath finds a free loop device, opens it, and stores file descriptor
 // of opened image path
 func (loop *Device) AttachFromPath(image string, mode int, number *int) error {
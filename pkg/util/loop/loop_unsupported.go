@@ -33,3 +33,24 @@ func GetStatusFromFd(fd uintptr) (*Info64, error) {
 func GetStatusFromPath(path string) (*Info64, error) {
 	return nil, fmt.Errorf("unsupported on this platform")
 }
+
+// AttachEphemeral attaches the image file to a free loop device allocated
+// by the loop control device and returns the opened loop device
+func (loop *Device) AttachEphemeral(image *os.File, mode int, number *int) (*os.File, error) {
+	return nil, fmt.Errorf("unsupported on this platform")
+}
+
+// SetDirectIO enables or disables direct I/O on an opened loop device
+func SetDirectIO(fd uintptr, enable bool) error {
+	return fmt.Errorf("unsupported on this platform")
+}
+
+// DetachFromFd detaches the image of an opened loop device
+func DetachFromFd(fd uintptr) error {
+	return fmt.Errorf("unsupported on this platform")
+}
+
+// DetachFromPath detaches the image of a loop device from path
+func DetachFromPath(path string) error {
+	return fmt.Errorf("unsupported on this platform")
+}
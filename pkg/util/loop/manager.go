@@ -0,0 +1,70 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package loop
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Manager attaches ephemeral loop devices and tracks the devices it owns.
+// When created with a state directory, each attachment is recorded along
+// with its owner process so attachments leaked by a process which exited
+// without detaching them, like a crashed starter, are detached by GC.
+type Manager struct {
+	// Device holds the configuration of attached loop devices
+	Device *Device
+
+	stateDir string
+	mutex    sync.Mutex
+	owned    map[int]*os.File
+}
+
+// attachment is the record of a loop device attached by a manager.
+type attachment struct {
+	// Pid is the owner process
+	Pid int `json:"pid"`
+	// StartTime is the start time of the owner process to detect
+	// a reused PID
+	StartTime uint64 `json:"startTime"`
+	// Device is the device number of the image file
+	Device uint64 `json:"device"`
+	// Inode is the inode number of the image file
+	Inode uint64 `json:"inode"`
+}
+
+// NewManager returns a loop device manager attaching devices configured
+// by device. Attachments are recorded in stateDir unless it's empty.
+func NewManager(device *Device, stateDir string) (*Manager, error) {
+	if device == nil {
+		return nil, fmt.Errorf("nil loop device configuration")
+	}
+	if stateDir != "" {
+		if err := os.MkdirAll(stateDir, 0700); err != nil {
+			return nil, fmt.Errorf("while creating loop state directory: %s", err)
+		}
+	}
+	return &Manager{
+		Device:   device,
+		stateDir: stateDir,
+		owned:    make(map[int]*os.File),
+	}, nil
+}
+
+// Devices returns the numbers of the loop devices owned by the manager.
+func (m *Manager) Devices() []int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	devices := make([]int, 0, len(m.owned))
+	for number := range m.owned {
+		devices = append(devices, number)
+	}
+	sort.Ints(devices)
+	return devices
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package loop
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/pkg/util/fs/lock"
+)
+
+// Attach attaches the image file to an ephemeral loop device owned by the
+// manager and returns the loop device number.
+func (m *Manager) Attach(image *os.File, mode int) (int, error) {
+	if image == nil {
+		return -1, fmt.Errorf("empty file pointer")
+	}
+	fi, err := image.Stat()
+	if err != nil {
+		return -1, err
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	number := -1
+	f, err := m.Device.AttachEphemeral(image, mode, &number)
+	if err != nil {
+		return -1, err
+	}
+
+	if m.stateDir != "" {
+		pid := os.Getpid()
+		startTime, err := processStartTime(pid)
+		if err == nil {
+			err = m.record(number, &attachment{
+				Pid:       pid,
+				StartTime: startTime,
+				Device:    uint64(st.Dev),
+				Inode:     uint64(st.Ino),
+			})
+		}
+		if err != nil {
+			DetachFromFd(f.Fd())
+			f.Close()
+			return -1, fmt.Errorf("while recording loop device %d: %s", number, err)
+		}
+	}
+
+	m.owned[number] = f
+	return number, nil
+}
+
+// Release closes the loop device number without detaching it, the device
+// is detached by the kernel when the last mount using it is gone.
+func (m *Manager) Release(number int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	f, ok := m.owned[number]
+	if !ok {
+		return fmt.Errorf("loop device %d is not owned by this manager", number)
+	}
+	delete(m.owned, number)
+	m.removeRecord(number)
+	return f.Close()
+}
+
+// Detach detaches and closes the loop device number.
+func (m *Manager) Detach(number int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.detach(number)
+}
+
+// Close detaches and closes all the loop devices owned by the manager.
+func (m *Manager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var firstErr error
+	for number := range m.owned {
+		if err := m.detach(number); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *Manager) detach(number int) error {
+	f, ok := m.owned[number]
+	if !ok {
+		return fmt.Errorf("loop device %d is not owned by this manager", number)
+	}
+	delete(m.owned, number)
+	m.removeRecord(number)
+
+	err := DetachFromFd(f.Fd())
+	f.Close()
+	return err
+}
+
+// GC detaches the loop devices recorded in the state directory by
+// processes which are gone and still attached to the recorded image. It
+// returns the numbers of the detached devices.
+func (m *Manager) GC() ([]int, error) {
+	if m.stateDir == "" {
+		return nil, fmt.Errorf("loop device manager has no state directory")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fd, err := lock.Exclusive(m.stateDir)
+	if err != nil {
+		return nil, fmt.Errorf("while locking loop state directory: %s", err)
+	}
+	defer lock.Release(fd)
+
+	entries, err := ioutil.ReadDir(m.stateDir)
+	if err != nil {
+		return nil, fmt.Errorf("while reading loop state directory: %s", err)
+	}
+
+	var detached []int
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "loop") || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(e.Name(), "loop"), ".json"))
+		if err != nil {
+			continue
+		}
+		if _, ok := m.owned[number]; ok {
+			continue
+		}
+
+		path := filepath.Join(m.stateDir, e.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return detached, err
+		}
+		a := &attachment{}
+		if err := json.Unmarshal(b, a); err != nil {
+			// a corrupted record can't be matched with a device
+			os.Remove(path)
+			continue
+		}
+		if startTime, err := processStartTime(a.Pid); err == nil && startTime == a.StartTime {
+			continue
+		}
+
+		// the device may have been reused since the owner is gone
+		device := fmt.Sprintf("/dev/loop%d", number)
+		if loop, err := os.Open(device); err == nil {
+			status, err := GetStatusFromFd(loop.Fd())
+			if err == nil && status.Device == a.Device && status.Inode == a.Inode {
+				err = DetachFromFd(loop.Fd())
+				if err == nil {
+					detached = append(detached, number)
+				}
+			}
+			loop.Close()
+			if err != nil {
+				return detached, fmt.Errorf("while detaching leaked loop device %s: %s", device, err)
+			}
+		}
+		os.Remove(path)
+	}
+
+	return detached, nil
+}
+
+// record writes the attachment record of the loop device number.
+func (m *Manager) record(number int, a *attachment) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.recordPath(number), b, 0600)
+}
+
+// removeRecord removes the attachment record of the loop device number.
+func (m *Manager) removeRecord(number int) {
+	if m.stateDir != "" {
+		os.Remove(m.recordPath(number))
+	}
+}
+
+func (m *Manager) recordPath(number int) string {
+	return filepath.Join(m.stateDir, fmt.Sprintf("loop%d.json", number))
+}
+
+// processStartTime returns the start time of the process pid in clock
+// ticks since boot.
+func processStartTime(pid int) (uint64, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces and parenthesis
+	i := strings.LastIndexByte(string(b), ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed stat file for process %d", pid)
+	}
+	// starttime is the 22th field, the 20th after the command name
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed stat file for process %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package loop
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestAttachEphemeral(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	loopDev := &Device{
+		Info: &Info64{
+			Flags: FlagsReadOnly,
+		},
+	}
+
+	number := -1
+	if _, err := loopDev.AttachEphemeral(nil, os.O_RDONLY, &number); err == nil {
+		t.Errorf("unexpected success with a nil file pointer")
+	}
+
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+
+	loop, err := loopDev.AttachEphemeral(f, os.O_RDONLY, &number)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer loop.Close()
+
+	status, err := GetStatusFromFd(loop.Fd())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.Device != st.Dev || status.Inode != st.Ino {
+		t.Errorf("bad file association for /dev/loop%d", number)
+	}
+	if status.Flags&FlagsAutoClear == 0 {
+		t.Errorf("autoclear flag not set on /dev/loop%d", number)
+	}
+	if loopDev.Info.Flags&FlagsAutoClear != 0 {
+		t.Errorf("device configuration modified by ephemeral attachment")
+	}
+
+	// ephemeral devices are never shared
+	other := -1
+	loop2, err := loopDev.AttachEphemeral(f, os.O_RDONLY, &other)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if other == number {
+		t.Errorf("attached to the same loop block device /dev/loop%d", number)
+	}
+	if err := DetachFromFd(loop2.Fd()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	loop2.Close()
+}
+
+func TestManager(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	stateDir, err := ioutil.TempDir("", "loop-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+
+	if _, err := NewManager(nil, stateDir); err == nil {
+		t.Errorf("unexpected success with a nil device configuration")
+	}
+
+	m, err := NewManager(&Device{Info: &Info64{Flags: FlagsReadOnly}}, stateDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer m.Close()
+
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	first, err := m.Attach(f, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := m.Attach(f, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if devices := m.Devices(); len(devices) != 2 {
+		t.Errorf("manager owns %v, expected 2 devices", devices)
+	}
+	if _, err := os.Stat(m.recordPath(first)); err != nil {
+		t.Errorf("attachment of /dev/loop%d not recorded: %s", first, err)
+	}
+
+	if err := m.Detach(second); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := m.Detach(second); err == nil {
+		t.Errorf("unexpected success while detaching a device not owned")
+	}
+	if _, err := os.Stat(m.recordPath(second)); !os.IsNotExist(err) {
+		t.Errorf("record of detached /dev/loop%d not removed", second)
+	}
+
+	// devices owned by a running process are not collected
+	if detached, err := m.GC(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if len(detached) != 0 {
+		t.Errorf("devices %v of a running process collected", detached)
+	}
+
+	// simulate a device leaked by a process which exited
+	cmd := exec.Command("/bin/true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+
+	leaked := -1
+	leakDev := &Device{MaxLoopDevices: 256, Info: &Info64{Flags: FlagsReadOnly}}
+	if err := leakDev.AttachFromFile(f, os.O_RDONLY, &leaked); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = m.record(leaked, &attachment{
+		Pid:    cmd.Process.Pid,
+		Device: st.Dev,
+		Inode:  st.Ino,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a record whose device is attached to another image is ignored
+	if err := ioutil.WriteFile(filepath.Join(stateDir, "loop99999.json"), []byte(`{"pid":1,"inode":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	detached, err := m.GC()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(detached) != 1 || detached[0] != leaked {
+		t.Errorf("collected %v, expected /dev/loop%d", detached, leaked)
+	}
+	status, err := GetStatusFromPath(fmt.Sprintf("/dev/loop%d", leaked))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the device is still opened by AttachFromFile, the kernel sets
+	// autoclear instead of detaching it
+	if status.Inode != 0 && status.Flags&FlagsAutoClear == 0 {
+		t.Errorf("leaked /dev/loop%d not detached", leaked)
+	}
+	if _, err := os.Stat(m.recordPath(leaked)); !os.IsNotExist(err) {
+		t.Errorf("record of leaked /dev/loop%d not removed", leaked)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "loop99999.json")); !os.IsNotExist(err) {
+		t.Errorf("record of missing /dev/loop99999 not removed")
+	}
+
+	if err := m.Release(first); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if devices := m.Devices(); len(devices) != 0 {
+		t.Errorf("manager still owns %v", devices)
+	}
+}
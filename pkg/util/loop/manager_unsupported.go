@@ -0,0 +1,39 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package loop
+
+import (
+	"fmt"
+	"os"
+)
+
+// Attach attaches the image file to an ephemeral loop device owned by the
+// manager and returns the loop device number.
+func (m *Manager) Attach(image *os.File, mode int) (int, error) {
+	return -1, fmt.Errorf("unsupported on this platform")
+}
+
+// Release closes the loop device number without detaching it.
+func (m *Manager) Release(number int) error {
+	return fmt.Errorf("unsupported on this platform")
+}
+
+// Detach detaches and closes the loop device number.
+func (m *Manager) Detach(number int) error {
+	return fmt.Errorf("unsupported on this platform")
+}
+
+// Close detaches and closes all the loop devices owned by the manager.
+func (m *Manager) Close() error {
+	return nil
+}
+
+// GC detaches the loop devices leaked by processes which are gone.
+func (m *Manager) GC() ([]int, error) {
+	return nil, fmt.Errorf("unsupported on this platform")
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package mpi provides the host files and environment required by
+// containerized MPI applications launched by a resource manager or
+// by a host MPI launcher.
+package mpi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/ldcache"
+)
+
+const (
+	// PMIx wires the PMIx server of the resource manager (eg: srun --mpi=pmix).
+	PMIx = "pmix"
+	// PMI2 wires the PMI-2 interface of the resource manager (eg: srun --mpi=pmi2).
+	PMI2 = "pmi2"
+	// Hybrid wires any PMI interface found for ranks launched by the host
+	// MPI launcher and checks that the container MPI is ABI compatible with
+	// the host MPI.
+	Hybrid = "hybrid"
+)
+
+// Paths describes host files and environment required by
+// containerized MPI applications.
+type Paths struct {
+	// Binds are host directories holding PMI sockets.
+	Binds []string
+	// Libraries are host PMI libraries bound in the container.
+	Libraries []string
+	// Env are KEY=VALUE environment variables set in the container.
+	Env []string
+	// ABI is the soname of the host MPI library the container MPI
+	// must be compatible with, only set for hybrid mode.
+	ABI string
+}
+
+var (
+	pmixEnv = []string{"PMIX_"}
+	pmi2Env = []string{"PMI_"}
+
+	pmixLibs = []string{"libpmix.so"}
+	pmi2Libs = []string{"libpmi2.so", "libpmi.so"}
+
+	// variables holding PMIx server rendezvous URIs
+	pmixURIEnv = regexp.MustCompile(`^PMIX_SERVER_URI[0-9]*$`)
+	// variables holding PMIx temporary directories
+	pmixTmpEnv = []string{"PMIX_SERVER_TMPDIR", "PMIX_SYSTEM_TMPDIR"}
+
+	libmpiRegexp = regexp.MustCompile(`^libmpi\.so\.[0-9]+`)
+)
+
+// Modes returns the list of supported modes.
+func Modes() []string {
+	return []string{PMIx, PMI2, Hybrid}
+}
+
+// Setup returns the host files and environment required for mode,
+// envPath is the PATH used to find the host MPI launcher.
+func Setup(mode string, environ []string, envPath string) (*Paths, error) {
+	cache, err := ldcache.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := paths(mode, environ, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == Hybrid {
+		p.ABI = hostABI(envPath, cache)
+		if p.ABI == "" {
+			return nil, fmt.Errorf("no host MPI library found, is MPI installed on this host?")
+		}
+		sylog.Debugf("Host MPI library ABI: %s", p.ABI)
+	}
+
+	return p, nil
+}
+
+// paths returns host files and environment required for mode from
+// environ and the host libraries cache (path -> library name).
+func paths(mode string, environ []string, cache map[string]string) (*Paths, error) {
+	p := new(Paths)
+
+	hasPMIx := hasEnv(environ, "PMIX_RANK") || hasEnv(environ, "PMIX_NAMESPACE")
+	hasPMI2 := hasEnv(environ, "PMI_FD") || hasEnv(environ, "PMI_RANK")
+
+	switch mode {
+	case PMIx:
+		if !hasPMIx {
+			return nil, fmt.Errorf("no PMIx environment found, was the job launched with srun --mpi=pmix?")
+		}
+	case PMI2:
+		if !hasPMI2 {
+			return nil, fmt.Errorf("no PMI-2 environment found, was the job launched with srun --mpi=pmi2?")
+		}
+	case Hybrid:
+		if !hasPMIx && !hasPMI2 {
+			return nil, fmt.Errorf("no PMIx or PMI-2 environment found, was the job launched with mpirun or srun?")
+		}
+	default:
+		return nil, fmt.Errorf("unknown MPI mode %q, supported modes are: %s", mode, strings.Join(Modes(), ", "))
+	}
+
+	if hasPMIx && mode != PMI2 {
+		p.Env = append(p.Env, filterEnv(environ, pmixEnv)...)
+		p.Binds = append(p.Binds, pmixSocketDirs(environ)...)
+		p.Libraries = append(p.Libraries, findLibraries(cache, pmixLibs)...)
+	}
+	if hasPMI2 && mode != PMIx {
+		p.Env = append(p.Env, filterEnv(environ, pmi2Env)...)
+		p.Libraries = append(p.Libraries, findLibraries(cache, pmi2Libs)...)
+	}
+
+	p.Env = unique(p.Env)
+	p.Binds = unique(p.Binds)
+	p.Libraries = unique(p.Libraries)
+
+	return p, nil
+}
+
+// CheckABI checks that the MPI library found in the container root
+// filesystem rootfs has the same soname than the host MPI library.
+func CheckABI(host string, rootfs string) error {
+	patterns := []string{
+		"/usr/lib64", "/usr/lib", "/usr/local/lib", "/usr/local/lib64",
+		"/usr/lib/*-linux-gnu", "/usr/lib/*-linux-gnu/*/lib",
+		"/usr/lib64/*/lib", "/opt/*/lib", "/opt/*/lib64",
+	}
+
+	var found []string
+	for _, p := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(rootfs, p, "libmpi.so.*"))
+		for _, m := range matches {
+			soname := libmpiRegexp.FindString(filepath.Base(m))
+			if soname == "" {
+				continue
+			}
+			if soname == host {
+				return nil
+			}
+			found = append(found, soname)
+		}
+	}
+
+	if len(found) == 0 {
+		sylog.Warningf("No MPI library found in container, unable to check ABI compatibility with host %s", host)
+		return nil
+	}
+	return fmt.Errorf("container MPI library %s is not ABI compatible with host MPI library %s", strings.Join(unique(found), ", "), host)
+}
+
+// hostABI returns the soname of the host MPI library, the library
+// shipped with the mpirun launcher found in envPath is preferred.
+func hostABI(envPath string, cache map[string]string) string {
+	if mpirun := lookPath("mpirun", envPath); mpirun != "" {
+		if p, err := filepath.EvalSymlinks(mpirun); err == nil {
+			mpirun = p
+		}
+		prefix := filepath.Dir(filepath.Dir(mpirun))
+		for _, lib := range []string{"lib", "lib64"} {
+			matches, _ := filepath.Glob(filepath.Join(prefix, lib, "libmpi.so.*"))
+			for _, m := range matches {
+				if soname := libmpiRegexp.FindString(filepath.Base(m)); soname != "" {
+					return soname
+				}
+			}
+		}
+	}
+
+	var sonames []string
+	for _, name := range cache {
+		if soname := libmpiRegexp.FindString(name); soname != "" {
+			sonames = append(sonames, soname)
+		}
+	}
+	if len(sonames) == 0 {
+		return ""
+	}
+	sort.Strings(sonames)
+	return sonames[0]
+}
+
+// lookPath searches for the executable file in the directories
+// named by envPath, PATH is used if envPath is empty.
+func lookPath(file string, envPath string) string {
+	if envPath == "" {
+		envPath = os.Getenv("PATH")
+	}
+	for _, dir := range filepath.SplitList(envPath) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, file)
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return path
+		}
+	}
+	return ""
+}
+
+func findLibraries(cache map[string]string, prefixes []string) []string {
+	var libs []string
+	for libPath, libName := range cache {
+		for _, p := range prefixes {
+			if strings.HasPrefix(libName, p) {
+				libs = append(libs, libPath)
+			}
+		}
+	}
+	sort.Strings(libs)
+	return libs
+}
+
+// pmixSocketDirs returns the directories holding PMIx server
+// rendezvous sockets.
+func pmixSocketDirs(environ []string) []string {
+	var dirs []string
+	for _, e := range environ {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			continue
+		}
+		for _, name := range pmixTmpEnv {
+			if kv[0] == name {
+				dirs = append(dirs, kv[1])
+			}
+		}
+		if !pmixURIEnv.MatchString(kv[0]) {
+			continue
+		}
+		// URI format: <namespace>.<rank>;<transport>:<address>
+		uri := kv[1]
+		if i := strings.Index(uri, ";"); i >= 0 {
+			uri = uri[i+1:]
+		}
+		if strings.HasPrefix(uri, "usock:") {
+			dirs = append(dirs, filepath.Dir(strings.TrimPrefix(uri, "usock:")))
+		}
+	}
+	return dirs
+}
+
+func hasEnv(environ []string, name string) bool {
+	for _, e := range environ {
+		if strings.HasPrefix(e, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func filterEnv(environ []string, prefixes []string) []string {
+	var env []string
+	for _, e := range environ {
+		for _, p := range prefixes {
+			if strings.HasPrefix(e, p) {
+				env = append(env, e)
+				break
+			}
+		}
+	}
+	return env
+}
+
+func unique(list []string) []string {
+	seen := make(map[string]bool)
+	var l []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			l = append(l, s)
+		}
+	}
+	return l
+}
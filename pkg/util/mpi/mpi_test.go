@@ -0,0 +1,143 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package mpi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/util/ldcache"
+)
+
+const ldconfigOutput = `4 libs found in cache '/etc/ld.so.cache'
+	libpmix.so.2 (libc6,x86-64) => /usr/lib64/libpmix.so.2
+	libpmi2.so.0 (libc6,x86-64) => /usr/lib64/libpmi2.so.0
+	libpmi.so.0 (libc6,x86-64) => /usr/lib64/libpmi.so.0
+	libmpi.so.40 (libc6,x86-64) => /usr/lib64/openmpi/lib/libmpi.so.40
+`
+
+func TestPaths(t *testing.T) {
+	cache := ldcache.Parse([]byte(ldconfigOutput))
+
+	pmixEnviron := []string{
+		"HOME=/home/user",
+		"PMIX_RANK=0",
+		"PMIX_NAMESPACE=slurm.pmix.42.0",
+		"PMIX_SERVER_URI21=pmix-server.1234;usock:/var/spool/slurmd/pmix.42.0/pmix.1234",
+		"PMIX_SERVER_TMPDIR=/var/spool/slurmd/pmix.42.0",
+	}
+	pmi2Environ := []string{
+		"HOME=/home/user",
+		"PMI_FD=5",
+		"PMI_RANK=0",
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		environ  []string
+		expected *Paths
+		fail     bool
+	}{
+		{
+			name:    "unknown mode",
+			mode:    "mpich",
+			environ: pmixEnviron,
+			fail:    true,
+		},
+		{
+			name:    "pmix without environment",
+			mode:    PMIx,
+			environ: pmi2Environ,
+			fail:    true,
+		},
+		{
+			name:    "pmi2 without environment",
+			mode:    PMI2,
+			environ: pmixEnviron,
+			fail:    true,
+		},
+		{
+			name:    "hybrid without environment",
+			mode:    Hybrid,
+			environ: []string{"HOME=/home/user"},
+			fail:    true,
+		},
+		{
+			name:    "pmix",
+			mode:    PMIx,
+			environ: pmixEnviron,
+			expected: &Paths{
+				Binds:     []string{"/var/spool/slurmd/pmix.42.0"},
+				Libraries: []string{"/usr/lib64/libpmix.so.2"},
+				Env:       pmixEnviron[1:],
+			},
+		},
+		{
+			name:    "pmi2",
+			mode:    PMI2,
+			environ: pmi2Environ,
+			expected: &Paths{
+				Libraries: []string{"/usr/lib64/libpmi.so.0", "/usr/lib64/libpmi2.so.0"},
+				Env:       pmi2Environ[1:],
+			},
+		},
+		{
+			name:    "hybrid",
+			mode:    Hybrid,
+			environ: pmi2Environ,
+			expected: &Paths{
+				Libraries: []string{"/usr/lib64/libpmi.so.0", "/usr/lib64/libpmi2.so.0"},
+				Env:       pmi2Environ[1:],
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := paths(tt.mode, tt.environ, cache)
+			if err != nil && !tt.fail {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.fail {
+				t.Fatalf("unexpected success")
+			}
+			if !tt.fail && !reflect.DeepEqual(p, tt.expected) {
+				t.Errorf("got %+v, expected %+v", p, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckABI(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "mpi-rootfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	// no MPI library in container, only a warning is displayed
+	if err := CheckABI("libmpi.so.40", rootfs); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	libDir := filepath.Join(rootfs, "usr", "lib64")
+	if err := os.MkdirAll(libDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(libDir, "libmpi.so.40.20.2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckABI("libmpi.so.40", rootfs); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := CheckABI("libmpi.so.12", rootfs); err == nil {
+		t.Errorf("unexpected success with incompatible ABI")
+	}
+}
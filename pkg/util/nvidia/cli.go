@@ -0,0 +1,221 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package nvidia
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// deviceRegexp matches a GPU selected by index, GPU or MIG UUID, or a MIG
+// device selected by GPU index and MIG index.
+var deviceRegexp = regexp.MustCompile(`^([0-9]+(:[0-9]+)?|(GPU|MIG)-(GPU-)?[0-9a-fA-F-]+(/[0-9]+/[0-9]+)?)$`)
+
+// Driver describes the files of the host NVIDIA driver to bind into a
+// container and the devices of the GPUs it can access.
+type Driver struct {
+	// Version is the driver version, empty if not reported
+	Version string
+	// Libraries are the paths of the driver libraries
+	Libraries []string
+	// Binaries are the paths of the driver binaries
+	Binaries []string
+	// IPCs are the paths of the driver sockets and directories
+	IPCs []string
+	// Devices are the paths of the driver and GPU devices
+	Devices []string
+}
+
+// ParseDevices validates a device selection, a comma separated list of GPU
+// indexes, GPU UUIDs, MIG device UUIDs or MIG devices selected as GPU:MIG
+// indexes. An empty selection or "all" selects all the GPUs.
+func ParseDevices(devices string) ([]string, error) {
+	if devices == "" || devices == "all" {
+		return nil, nil
+	}
+
+	var list []string
+	for _, d := range strings.Split(devices, ",") {
+		d = strings.TrimSpace(d)
+		if !deviceRegexp.MatchString(d) {
+			return nil, fmt.Errorf("invalid NVIDIA device %q", d)
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// Discover returns the NVIDIA driver files and the devices of the GPUs
+// selected by devices. The files are reported by nvidia-container-cli for
+// the host driver version, if nvidia-container-cli is not found it falls
+// back to the libraries listed in nvliblistFile and to the GPUs selected by
+// index. envPath is the PATH used to search binaries if not empty.
+func Discover(nvliblistFile string, envPath string, devices string) (*Driver, error) {
+	selection, err := ParseDevices(devices)
+	if err != nil {
+		return nil, err
+	}
+
+	if envPath != "" {
+		oldPath := os.Getenv("PATH")
+		os.Setenv("PATH", envPath)
+		defer os.Setenv("PATH", oldPath)
+	}
+
+	driver, err := cliDriver(selection)
+	if err == nil {
+		return driver, nil
+	}
+	sylog.Verbosef("nvidia-container-cli returned: %v", err)
+	sylog.Verbosef("Falling back to nvliblist.conf")
+
+	driver = &Driver{}
+	driver.Devices, err = legacyDevices(selection)
+	if err != nil {
+		return nil, err
+	}
+	driver.Libraries, driver.Binaries, err = Paths(nvliblistFile, "")
+	if err != nil {
+		return nil, err
+	}
+	driver.IPCs = IpcsPath("")
+
+	return driver, nil
+}
+
+// cliDriver queries nvidia-container-cli for the driver files and the
+// devices of the selected GPUs.
+func cliDriver(selection []string) (*Driver, error) {
+	device := "all"
+	if len(selection) > 0 {
+		device = strings.Join(selection, ",")
+	}
+
+	// without filtering options, all the files and devices are listed
+	out, err := runCli("list", "--device="+device)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := parseList(out)
+	if len(driver.Libraries) == 0 {
+		return nil, fmt.Errorf("nvidia-container-cli didn't report any driver library")
+	}
+
+	if info, err := runCli("info", "--csv"); err != nil {
+		sylog.Debugf("Could not get NVIDIA driver version: %s", err)
+	} else {
+		driver.Version = parseVersion(info)
+	}
+	sylog.Debugf("Found NVIDIA driver version %q with %d libraries, %d binaries and %d devices", driver.Version, len(driver.Libraries), len(driver.Binaries), len(driver.Devices))
+
+	return driver, nil
+}
+
+// runCli runs nvidia-container-cli with args and returns its output.
+func runCli(args ...string) ([]byte, error) {
+	nvidiaCLIPath, err := exec.LookPath("nvidia-container-cli")
+	if err != nil {
+		return nil, fmt.Errorf("could not find nvidia-container-cli: %v", err)
+	}
+
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(nvidiaCLIPath, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("could not execute nvidia-container-cli %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// parseList sorts the absolute paths reported by nvidia-container-cli list.
+func parseList(out []byte) *Driver {
+	driver := &Driver{}
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if !filepath.IsAbs(path) || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		switch {
+		case strings.HasPrefix(path, "/dev/"):
+			driver.Devices = append(driver.Devices, path)
+		case strings.Contains(filepath.Base(path), ".so"):
+			driver.Libraries = append(driver.Libraries, path)
+		default:
+			// persistenced and MPS sockets are IPCs
+			if fi, err := os.Stat(path); err == nil && (fi.Mode()&os.ModeSocket != 0 || fi.IsDir()) {
+				driver.IPCs = append(driver.IPCs, path)
+			} else {
+				driver.Binaries = append(driver.Binaries, path)
+			}
+		}
+	}
+	return driver
+}
+
+// parseVersion returns the driver version from the output of
+// nvidia-container-cli info --csv.
+func parseVersion(out []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	// the first line is the header "NVRM version,CUDA version"
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "NVRM version") || !scanner.Scan() {
+		return ""
+	}
+	return strings.TrimSpace(strings.Split(scanner.Text(), ",")[0])
+}
+
+// legacyDevices returns the NVIDIA devices of the GPUs selected by index
+// by globbing /dev, GPUs selected by UUID and MIG devices require
+// nvidia-container-cli.
+func legacyDevices(selection []string) ([]string, error) {
+	if len(selection) == 0 {
+		return Devices(true)
+	}
+
+	devs, err := Devices(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range selection {
+		if strings.ContainsAny(d, ":-") {
+			return nil, fmt.Errorf("NVIDIA device %s can't be selected without nvidia-container-cli", d)
+		}
+		dev := "/dev/nvidia" + d
+		if _, err := os.Stat(dev); err != nil {
+			return nil, fmt.Errorf("NVIDIA device %s not found: %s", d, err)
+		}
+		devs = append(devs, dev)
+	}
+	return devs, nil
+}
+
+// IsDevice returns true if path is an NVIDIA device path, the runtime
+// engine only adds NVIDIA devices to the container /dev.
+func IsDevice(path string) bool {
+	if filepath.Clean(path) != path {
+		return false
+	}
+	for _, pattern := range []string{"/dev/nvidia*", "/dev/nvidia-caps/nvidia-cap*"} {
+		if match, _ := filepath.Match(pattern, path); match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package nvidia
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDevices(t *testing.T) {
+	tests := []struct {
+		devices  string
+		expected []string
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"all", nil, false},
+		{"0", []string{"0"}, false},
+		{"0, 2", []string{"0", "2"}, false},
+		{"0:1", []string{"0:1"}, false},
+		{"GPU-2ac2e5bb-4d0a-4a33-8bc0-7d5b8a1f1d6c", []string{"GPU-2ac2e5bb-4d0a-4a33-8bc0-7d5b8a1f1d6c"}, false},
+		{"MIG-GPU-2ac2e5bb-4d0a-4a33-8bc0-7d5b8a1f1d6c/1/0", []string{"MIG-GPU-2ac2e5bb-4d0a-4a33-8bc0-7d5b8a1f1d6c/1/0"}, false},
+		{"0,", nil, true},
+		{"../sda", nil, true},
+		{"0 --load-kmods", nil, true},
+	}
+
+	for _, tt := range tests {
+		devices, err := ParseDevices(tt.devices)
+		if tt.wantErr && err == nil {
+			t.Errorf("unexpected success for %q", tt.devices)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.devices, err)
+		} else if !reflect.DeepEqual(devices, tt.expected) {
+			t.Errorf("got %v for %q, expected %v", devices, tt.devices, tt.expected)
+		}
+	}
+}
+
+func TestIsDevice(t *testing.T) {
+	tests := map[string]bool{
+		"/dev/nvidia0":                      true,
+		"/dev/nvidiactl":                    true,
+		"/dev/nvidia-caps/nvidia-cap12":     true,
+		"/dev/nvidia-caps/../sda":           false,
+		"/dev/sda":                          false,
+		"/dev/nvidia0/../../etc/shadow":     false,
+		"/tmp/dev/nvidia0":                  false,
+		"/dev/nvidia-caps/nvidia-cap1/../x": false,
+	}
+
+	for path, expected := range tests {
+		if IsDevice(path) != expected {
+			t.Errorf("IsDevice(%s) returned %v", path, !expected)
+		}
+	}
+}
+
+func TestCliDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-cli-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+info)
+	echo "NVRM version,CUDA version"
+	echo "450.51.06,11.0"
+	echo
+	echo "Device Index,Device Minor,Model,Brand,GPU UUID,Bus Location,Architecture"
+	;;
+list)
+	[ "$2" = "--device=0:1" ] || exit 1
+	echo /dev/nvidiactl
+	echo /dev/nvidia0
+	echo /dev/nvidia-caps/nvidia-cap12
+	echo /usr/bin/nvidia-smi
+	echo /usr/lib/x86_64-linux-gnu/libcuda.so.450.51.06
+	echo /usr/lib/x86_64-linux-gnu/libcuda.so.450.51.06
+	echo %s
+	;;
+esac
+`, socket)
+	if err := ioutil.WriteFile(filepath.Join(dir, "nvidia-container-cli"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := Discover("", dir, "0:1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &Driver{
+		Version:   "450.51.06",
+		Libraries: []string{"/usr/lib/x86_64-linux-gnu/libcuda.so.450.51.06"},
+		Binaries:  []string{"/usr/bin/nvidia-smi"},
+		IPCs:      []string{socket},
+		Devices:   []string{"/dev/nvidiactl", "/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap12"},
+	}
+	if !reflect.DeepEqual(driver, expected) {
+		t.Errorf("got %+v, expected %+v", driver, expected)
+	}
+
+	if _, err := Discover("", dir, "0;reboot"); err == nil {
+		t.Errorf("unexpected success with an invalid device selection")
+	}
+}
@@ -13,10 +13,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/ldcache"
 )
 
 // nvidiaContainerCli runs `nvidia-container-cli list` and returns list of
@@ -85,13 +85,11 @@ func nvliblist(nvliblistFile string) ([]string, error) {
 // Paths returns list of nvidia libraries and binaries that should
 // be added to mounted into container if it needs NVIDIA GPUs.
 func Paths(nvliblistFile string, envPath string) ([]string, []string, error) {
-	ldConfig, err := exec.LookPath("ldconfig")
-	if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
-		sylog.Debugf("Could not find ldconfig in PATH")
-		ldConfig = "ldconfig"
-	}
+	// store library name with associated path, ldconfig is looked up
+	// in the host PATH
+	ldCache, err := ldcache.Load()
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not lookup ldconfig: %v", err)
+		return nil, nil, err
 	}
 	if envPath != "" {
 		oldPath := os.Getenv("PATH")
@@ -111,20 +109,6 @@ func Paths(nvliblistFile string, envPath string) ([]string, []string, error) {
 		}
 	}
 
-	// walk through the ldconfig output and add entries which contain the filenames
-	// returned by nvidia-container-cli OR the nvliblist.conf file contents
-	out, err := exec.Command(ldConfig, "-p").Output()
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not execute ldconfig: %v", err)
-	}
-
-	// sample ldconfig -p output:
-	// libnvidia-ml.so.1 (libc6,x86-64) => /usr/lib64/nvidia/libnvidia-ml.so.1
-	r, err := regexp.Compile(`(?m)^(.*)\s*\(.*\)\s*=>\s*(.*)$`)
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not compile ldconfig regexp: %v", err)
-	}
-
 	// get elf machine to match correct libraries during ldconfig lookup
 	self, err := elf.Open("/proc/self/exe")
 	if err != nil {
@@ -136,18 +120,6 @@ func Paths(nvliblistFile string, envPath string) ([]string, []string, error) {
 		sylog.Warningf("Could not close ELF: %v", err)
 	}
 
-	// store library name with associated path
-	ldCache := make(map[string]string)
-	for _, match := range r.FindAllSubmatch(out, -1) {
-		if match != nil {
-			// libName is the "libnvidia-ml.so.1" (from the above example)
-			// libPath is the "/usr/lib64/nvidia/libnvidia-ml.so.1" (from the above example)
-			libName := strings.TrimSpace(string(match[1]))
-			libPath := strings.TrimSpace(string(match[2]))
-			ldCache[libPath] = libName
-		}
-	}
-
 	// trach binaries/libraries to eliminate duplicates
 	bins := make(map[string]struct{})
 	libs := make(map[string]struct{})
@@ -155,7 +127,8 @@ func Paths(nvliblistFile string, envPath string) ([]string, []string, error) {
 	var libraries []string
 	var binaries []string
 	for _, nvidiaFile := range nvidiaFiles {
-		// if the file contains a ".so", treat it as a library
+		// if the file contains a ".so", treat it as a library and add
+		// the ldconfig entries which start with the file name
 		if strings.Contains(nvidiaFile, ".so") {
 			for libPath, libName := range ldCache {
 				if !strings.HasPrefix(libName, nvidiaFile) {
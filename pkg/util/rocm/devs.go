@@ -0,0 +1,34 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package rocm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// kfdDevice is the kernel fusion driver device used by the ROCm
+	// runtime to submit work to AMD GPUs
+	kfdDevice = "/dev/kfd"
+	// renderGlob matches the DRM render nodes of the GPUs
+	renderGlob = "/dev/dri/renderD*"
+)
+
+// Devices returns the kernel fusion driver device and the DRM render nodes
+// present on host, the kernel fusion driver is required by the ROCm runtime.
+func Devices() ([]string, error) {
+	if _, err := os.Stat(kfdDevice); err != nil {
+		return nil, fmt.Errorf("could not find AMD GPU compute device: %v", err)
+	}
+
+	renders, err := filepath.Glob(renderGlob)
+	if err != nil {
+		return nil, fmt.Errorf("could not list DRM render nodes: %v", err)
+	}
+	return append([]string{kfdDevice}, renders...), nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package rocm discovers the AMD GPU devices and the ROCm user-space
+// libraries and binaries of the host to bind into a container.
+package rocm
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/ldcache"
+)
+
+// VisibleDevicesEnv are the environment variables selecting the GPUs used
+// by the ROCm runtime, they are passed to the container even with a clean
+// environment.
+var VisibleDevicesEnv = []string{
+	"ROCR_VISIBLE_DEVICES",
+	"HIP_VISIBLE_DEVICES",
+	"GPU_DEVICE_ORDINAL",
+}
+
+// rocmliblist returns the libraries and binaries specified in the file
+// rocmliblistFile.
+//
+// Blank lines and lines starting with # are ignored.
+func rocmliblist(rocmliblistFile string) ([]string, error) {
+	file, err := os.Open(rocmliblistFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", rocmliblistFile, err)
+	}
+	defer file.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && line[0] != '#' {
+			files = append(files, line)
+		}
+	}
+	return files, scanner.Err()
+}
+
+// Paths returns the ROCm libraries and binaries listed in rocmliblistFile
+// found on the host. Libraries are looked up in the ldconfig cache and only
+// those matching the architecture of the running binary are returned,
+// binaries are looked up in envPath if not empty.
+func Paths(rocmliblistFile string, envPath string) ([]string, []string, error) {
+	rocmFiles, err := rocmliblist(rocmliblistFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read rocmliblist.conf: %v", err)
+	}
+
+	if envPath != "" {
+		oldPath := os.Getenv("PATH")
+		os.Setenv("PATH", envPath)
+		defer os.Setenv("PATH", oldPath)
+	}
+
+	cache, err := ldcache.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// get elf machine to match correct libraries during ldconfig lookup
+	self, err := elf.Open("/proc/self/exe")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open /proc/self/exe: %v", err)
+	}
+	machine := self.Machine
+	self.Close()
+
+	libs := make(map[string]struct{})
+	bins := make(map[string]struct{})
+
+	var libraries []string
+	var binaries []string
+	for _, rocmFile := range rocmFiles {
+		if !strings.Contains(rocmFile, ".so") {
+			binary, err := exec.LookPath(rocmFile)
+			if err != nil {
+				sylog.Debugf("ROCm binary %s not found", rocmFile)
+				continue
+			}
+			if _, ok := bins[binary]; !ok {
+				bins[binary] = struct{}{}
+				binaries = append(binaries, binary)
+			}
+			continue
+		}
+
+		for libPath, libName := range cache {
+			if !strings.HasPrefix(libName, rocmFile) {
+				continue
+			}
+			if _, ok := libs[libName]; ok {
+				continue
+			}
+			elib, err := elf.Open(libPath)
+			if err != nil {
+				sylog.Debugf("ignore library %s: %s", libName, err)
+				continue
+			}
+			if elib.Machine == machine {
+				libs[libName] = struct{}{}
+				libraries = append(libraries, libPath)
+			}
+			elib.Close()
+		}
+	}
+
+	sort.Strings(libraries)
+	return libraries, binaries, nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package rocm
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRocmliblist(t *testing.T) {
+	f, err := ioutil.TempFile("", "rocmliblist-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("# binaries\nrocm-smi\n\n  # libraries\nlibamdhip64.so\n  libhsa-runtime64.so  \n")
+	f.Close()
+
+	files, err := rocmliblist(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"rocm-smi", "libamdhip64.so", "libhsa-runtime64.so"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("got %v, expected %v", files, expected)
+	}
+
+	if _, err := rocmliblist("/non/existent/rocmliblist.conf"); err == nil {
+		t.Errorf("unexpected success with a non existent file")
+	}
+}
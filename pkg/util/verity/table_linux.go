@@ -0,0 +1,128 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package verity
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// dmTableStatus is DM_TABLE_STATUS, _IOWR(0xfd, 12, struct dm_ioctl)
+	// has the same value on all architectures
+	dmTableStatus = 0xc138fd0c
+	// dmStatusTableFlag requests the table instead of the status
+	dmStatusTableFlag = 1 << 4
+	// dmBufferFullFlag is set when the result doesn't fit the buffer
+	dmBufferFullFlag = 1 << 8
+)
+
+// dmIoctl is the struct dm_ioctl header of device mapper requests.
+type dmIoctl struct {
+	Version     [3]uint32
+	DataSize    uint32
+	DataStart   uint32
+	TargetCount uint32
+	OpenCount   int32
+	Flags       uint32
+	EventNr     uint32
+	Padding     uint32
+	Dev         uint64
+	Name        [128]byte
+	UUID        [129]byte
+	Data        [7]byte
+}
+
+// dmTargetSpec is the struct dm_target_spec header of a table target,
+// it's followed by the target parameters.
+type dmTargetSpec struct {
+	SectorStart uint64
+	Length      uint64
+	Status      int32
+	Next        uint32
+	TargetType  [16]byte
+}
+
+// dmTarget is a target of a device mapper table.
+type dmTarget struct {
+	Type   string
+	Params string
+}
+
+// deviceTable returns the table targets of the device mapper device name.
+func deviceTable(name string) ([]dmTarget, error) {
+	control, err := os.OpenFile("/dev/mapper/control", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open device mapper control device: %s", err)
+	}
+	defer control.Close()
+
+	for size := 16 << 10; ; size *= 2 {
+		buf := make([]byte, size)
+		dm := (*dmIoctl)(unsafe.Pointer(&buf[0]))
+		dm.Version = [3]uint32{4, 0, 0}
+		dm.DataSize = uint32(size)
+		dm.DataStart = uint32(unsafe.Sizeof(*dm))
+		dm.Flags = dmStatusTableFlag
+		copy(dm.Name[:len(dm.Name)-1], name)
+
+		_, _, esys := syscall.Syscall(syscall.SYS_IOCTL, control.Fd(), dmTableStatus, uintptr(unsafe.Pointer(&buf[0])))
+		if esys != 0 {
+			return nil, fmt.Errorf("could not get table of device %s: %s", name, esys)
+		}
+		if dm.Flags&dmBufferFullFlag != 0 {
+			continue
+		}
+		return parseTargets(buf[dm.DataStart:dm.DataSize], int(dm.TargetCount))
+	}
+}
+
+// parseTargets parses count target specifications and their parameters
+// from the result data of a table status request.
+func parseTargets(data []byte, count int) ([]dmTarget, error) {
+	var targets []dmTarget
+	specSize := int(unsafe.Sizeof(dmTargetSpec{}))
+
+	for i, offset := 0, 0; i < count; i++ {
+		if offset+specSize > len(data) {
+			return nil, fmt.Errorf("truncated device mapper table")
+		}
+		spec := (*dmTargetSpec)(unsafe.Pointer(&data[offset]))
+		params := data[offset+specSize:]
+		if end := bytes.IndexByte(params, 0); end >= 0 {
+			params = params[:end]
+		}
+		targets = append(targets, dmTarget{
+			Type:   string(bytes.TrimRight(spec.TargetType[:], "\x00")),
+			Params: string(params),
+		})
+		// next is the offset of the next target from the start of data
+		offset = int(spec.Next)
+	}
+	return targets, nil
+}
+
+// checkTable returns an error if the table targets are not the ones of a
+// dm-verity device verified with rootHash.
+func checkTable(targets []dmTarget, rootHash string) error {
+	if len(targets) != 1 || targets[0].Type != "verity" {
+		return fmt.Errorf("not a dm-verity device")
+	}
+	// <version> <data dev> <hash dev> <data block size> <hash block size>
+	// <data blocks> <hash start block> <algorithm> <root hash> <salt> ...
+	fields := strings.Fields(targets[0].Params)
+	if len(fields) < 10 {
+		return fmt.Errorf("malformed dm-verity table %q", targets[0].Params)
+	}
+	if !strings.EqualFold(fields[8], rootHash) {
+		return fmt.Errorf("device is verified with root hash %s", fields[8])
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package verity maps images through dm-verity devices checking their
+// integrity against a root hash on every read.
+package verity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/bin"
+	"github.com/sylabs/singularity/pkg/util/fs/lock"
+)
+
+// DeviceName returns the device mapper name of the device verified
+// with rootHash, the data of devices sharing the same name is the same.
+func DeviceName(rootHash string) string {
+	return "singularity-verity-" + strings.ToLower(rootHash)
+}
+
+// CheckRootHash returns an error if rootHash is not an hexadecimal
+// encoded hash.
+func CheckRootHash(rootHash string) error {
+	b, err := hex.DecodeString(rootHash)
+	if err != nil || len(b) < 20 {
+		return fmt.Errorf("invalid dm-verity root hash %q", rootHash)
+	}
+	return nil
+}
+
+// Open maps the data image verified with the hash tree file hash and
+// rootHash to a device mapper device and returns the device path. An
+// already mapped device with the same root hash is reused once its table
+// is checked, so containers sharing the image also share its page cache.
+func Open(data, hash, rootHash string) (string, error) {
+	if err := CheckRootHash(rootHash); err != nil {
+		return "", err
+	}
+
+	veritysetup, err := bin.Veritysetup()
+	if err != nil {
+		return "", err
+	}
+
+	fd, err := lock.Exclusive("/dev/mapper")
+	if err != nil {
+		return "", err
+	}
+	defer lock.Release(fd)
+
+	name := DeviceName(rootHash)
+	path := "/dev/mapper/" + name
+
+	if _, err := os.Stat(path); err == nil {
+		// anybody able to create a device mapper device can use the
+		// name, the root hash verifies the data read from the device
+		targets, err := deviceTable(name)
+		if err != nil {
+			return "", err
+		}
+		if err := checkTable(targets, rootHash); err != nil {
+			return "", fmt.Errorf("refusing to reuse %s: %s", path, err)
+		}
+		sylog.Debugf("Reusing dm-verity device %s", path)
+		return path, nil
+	}
+
+	cmd := exec.Command(veritysetup, "open", data, name, hash, rootHash)
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("unable to open dm-verity device for %s: %s", data, strings.TrimSpace(string(out)))
+	}
+
+	return path, nil
+}
+
+// CloseDeferred removes the device verified with rootHash once it's not
+// used anymore, devices already in use by other containers are kept until
+// their last user is gone.
+func CloseDeferred(rootHash string) error {
+	if err := CheckRootHash(rootHash); err != nil {
+		return err
+	}
+
+	veritysetup, err := bin.Veritysetup()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(veritysetup, "close", "--deferred", DeviceName(rootHash))
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to close dm-verity device %s: %s", DeviceName(rootHash), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Format computes the hash tree of the data image into the hash file
+// and returns its root hash.
+func Format(data, hash string) (string, error) {
+	veritysetup, err := bin.Veritysetup()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(veritysetup, "format", data, hash)
+	sylog.Debugf("Running %s %s", cmd.Path, strings.Join(cmd.Args, " "))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("unable to compute dm-verity hash tree of %s: %s", data, strings.TrimSpace(string(out)))
+	}
+	return parseRootHash(out)
+}
+
+// parseRootHash returns the root hash reported by veritysetup format.
+func parseRootHash(out []byte) (string, error) {
+	for _, line := range strings.Split(string(out), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "Root hash" {
+			continue
+		}
+		rootHash := strings.TrimSpace(kv[1])
+		if err := CheckRootHash(rootHash); err != nil {
+			return "", err
+		}
+		return rootHash, nil
+	}
+	return "", fmt.Errorf("no root hash found in veritysetup output")
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package verity
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestCheckRootHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		rootHash string
+		valid    bool
+	}{
+		{"sha256", strings.Repeat("ab", 32), true},
+		{"sha1", strings.Repeat("01", 20), true},
+		{"empty", "", false},
+		{"short", "abcdef", false},
+		{"not hexadecimal", strings.Repeat("zz", 32), false},
+		{"option injection", "--" + strings.Repeat("ab", 32), false},
+	}
+
+	for _, tt := range tests {
+		err := CheckRootHash(tt.rootHash)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+	}
+}
+
+func TestParseRootHash(t *testing.T) {
+	rootHash := strings.Repeat("4f", 32)
+	out := []byte(`VERITY header information for hash.img
+UUID:            	2e4f5a8c-1c1a-4a43-b6f4-5bb0d1c2a2e1
+Hash type:       	1
+Data blocks:     	2048
+Data block size: 	4096
+Hash block size: 	4096
+Hash algorithm:  	sha256
+Salt:            	` + strings.Repeat("0a", 32) + `
+Root hash:      	` + rootHash + `
+`)
+
+	got, err := parseRootHash(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != rootHash {
+		t.Errorf("got root hash %s, expected %s", got, rootHash)
+	}
+
+	if _, err := parseRootHash([]byte("Hash type: 1\n")); err == nil {
+		t.Errorf("unexpected success without root hash")
+	}
+	if _, err := parseRootHash([]byte("Root hash: nothex\n")); err == nil {
+		t.Errorf("unexpected success with an invalid root hash")
+	}
+}
+
+func TestCheckTable(t *testing.T) {
+	rootHash := strings.Repeat("4f", 32)
+	params := "1 7:0 7:1 4096 4096 2048 1 sha256 " + rootHash + " " + strings.Repeat("0a", 32)
+
+	tests := []struct {
+		name    string
+		targets []dmTarget
+		valid   bool
+	}{
+		{"verity", []dmTarget{{"verity", params}}, true},
+		{"upper case root hash", []dmTarget{{"verity", strings.Replace(params, rootHash, strings.ToUpper(rootHash), 1)}}, true},
+		{"other root hash", []dmTarget{{"verity", strings.Replace(params, rootHash, strings.Repeat("ab", 32), 1)}}, false},
+		{"linear", []dmTarget{{"linear", "7:0 0"}}, false},
+		{"multiple targets", []dmTarget{{"verity", params}, {"linear", "7:0 0"}}, false},
+		{"no target", nil, false},
+		{"malformed", []dmTarget{{"verity", "1 7:0 7:1"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := checkTable(tt.targets, rootHash)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	specSize := int(unsafe.Sizeof(dmTargetSpec{}))
+	if specSize != 40 || unsafe.Sizeof(dmIoctl{}) != 312 {
+		t.Fatalf("device mapper structures don't match the kernel ones")
+	}
+
+	// targets are aligned on 8 bytes like the kernel does it
+	var data []byte
+	for i, target := range []dmTarget{{"verity", "1 7:0 7:1"}, {"linear", "7:2 0"}} {
+		size := (specSize + len(target.Params) + 1 + 7) &^ 7
+		buf := make([]byte, size)
+		spec := (*dmTargetSpec)(unsafe.Pointer(&buf[0]))
+		copy(spec.TargetType[:], target.Type)
+		copy(buf[specSize:], target.Params)
+		if i == 0 {
+			spec.Next = uint32(size)
+		}
+		data = append(data, buf...)
+	}
+
+	targets, err := parseTargets(data, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []dmTarget{{"verity", "1 7:0 7:1"}, {"linear", "7:2 0"}}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("got targets %v, expected %v", targets, expected)
+	}
+
+	if _, err := parseTargets(data[:specSize-1], 1); err == nil {
+		t.Errorf("unexpected success with truncated data")
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package verity
+
+import (
+	"errors"
+)
+
+// ErrUnsupportedPlatform is the error returned by dm-verity operations
+// on platforms without device-mapper support.
+var ErrUnsupportedPlatform = errors.New("dm-verity is not supported on this platform")
+
+// Format is not supported on this platform.
+func Format(data, hash string) (string, error) {
+	return "", ErrUnsupportedPlatform
+}